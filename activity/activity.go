@@ -0,0 +1,376 @@
+// Package activity account requests by user and client, for chargeback and for spotting a
+// runaway client. Usage is aggregated by hour in memory and saved to one json file per hour.
+//
+package activity
+
+import (
+	"context"
+	"encoding/json"
+	"io/ioutil"
+	"net"
+	"net/http"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/adyzng/GoSymbols/config"
+	log "gopkg.in/clog.v1"
+)
+
+// Activity kinds
+const (
+	KindAPI      = "api"
+	KindDownload = "download"
+	KindIngest   = "ingest"
+)
+
+const (
+	// Anonymous user of requests without session
+	Anonymous = "anonymous"
+
+	hourFormat = "2006010215"
+	maxObjects = 100 // distinct objects kept of one usage
+
+	slowMinTransfers = 5 // measured downloads before a client or segment can be flagged slow
+)
+
+// Event is one accounted request
+//
+type Event struct {
+	User    string
+	Client  string
+	Kind    string
+	Branch  string
+	Object  string        // downloaded symbol or ingested build
+	Bytes   int64         // bytes sent
+	Elapsed time.Duration // time to send the response
+}
+
+// Usage of one user from one client, in one hour or summarized over a range
+//
+type Usage struct {
+	Hour      string           `json:"hour,omitempty"` // 2006010215
+	User      string           `json:"user,omitempty"`
+	Client    string           `json:"client,omitempty"`
+	Requests  int64            `json:"requests"`
+	Downloads int64            `json:"downloads"`
+	Ingests   int64            `json:"ingests"`
+	Bytes     int64            `json:"bytes"`
+	Peak      int64            `json:"peak"`              // max requests of one user from one client in one hour
+	Objects   map[string]int64 `json:"objects,omitempty"` // `{branch}/{object}` downloaded or ingested
+	Dropped   int64            `json:"dropped,omitempty"` // objects not kept beyond the limit
+
+	// downloads big enough to measure throughput, see `[activity] MIN_TRANSFER_KB`
+	Transfers     int64 `json:"transfers,omitempty"`
+	TransferBytes int64 `json:"transferBytes,omitempty"`
+	TransferMs    int64 `json:"transferMs,omitempty"`
+	SlowTransfers int64 `json:"slowTransfers,omitempty"` // below `[activity] SLOW_KBPS`
+	Throughput    int64 `json:"throughput,omitempty"`    // KB/s of measured downloads, set by Summarize
+	Slow          bool  `json:"slow,omitempty"`          // most measured downloads are slow, set by Summarize
+}
+
+type ctxKey struct{}
+
+// WithEvent attach the event accounting request `r`, handlers describe what the request did
+// by Annotate.
+//
+func WithEvent(r *http.Request, e *Event) *http.Request {
+	return r.WithContext(context.WithValue(r.Context(), ctxKey{}, e))
+}
+
+// Annotate the event of request with what is downloaded or ingested, no-op if the request
+// is not accounted.
+//
+func Annotate(r *http.Request, kind, branch, object string) {
+	if e, ok := r.Context().Value(ctxKey{}).(*Event); ok {
+		e.Kind, e.Branch, e.Object = kind, branch, object
+	}
+}
+
+func (u *Usage) addObject(name string, count int64) {
+	if u.Objects == nil {
+		u.Objects = make(map[string]int64)
+	}
+	if _, ok := u.Objects[name]; !ok && len(u.Objects) >= maxObjects {
+		u.Dropped += count
+		return
+	}
+	u.Objects[name] += count
+}
+
+// addTransfer measure throughput of one download, small files are dominated by latency
+// and not measured.
+func (u *Usage) addTransfer(bytes int64, elapsed time.Duration) {
+	if elapsed <= 0 || bytes < int64(config.ActivityMinTransferKB)<<10 {
+		return
+	}
+	ms := int64(elapsed / time.Millisecond)
+	if ms <= 0 {
+		ms = 1
+	}
+	u.Transfers++
+	u.TransferBytes += bytes
+	u.TransferMs += ms
+	if bytes*1000/ms < int64(config.ActivitySlowKBps)<<10 {
+		u.SlowTransfers++
+	}
+}
+
+// rate set throughput and slow flag of summarized usage
+func (u *Usage) rate() {
+	if u.TransferMs > 0 {
+		u.Throughput = u.TransferBytes * 1000 / u.TransferMs >> 10
+	}
+	u.Slow = u.Transfers >= slowMinTransfers && u.SlowTransfers*2 > u.Transfers
+}
+
+// Segment return the network of client address, /24 of IPv4 or /64 of IPv6, so slow
+// transfers of one site or VPN pool show up together.
+//
+func Segment(client string) string {
+	ip := net.ParseIP(client)
+	if ip == nil {
+		return client
+	}
+	if v4 := ip.To4(); v4 != nil {
+		return (&net.IPNet{IP: v4.Mask(net.CIDRMask(24, 32)), Mask: net.CIDRMask(24, 32)}).String()
+	}
+	return (&net.IPNet{IP: ip.Mask(net.CIDRMask(64, 128)), Mask: net.CIDRMask(64, 128)}).String()
+}
+
+func (u *Usage) merge(o *Usage) {
+	u.Requests += o.Requests
+	u.Downloads += o.Downloads
+	u.Ingests += o.Ingests
+	u.Bytes += o.Bytes
+	u.Dropped += o.Dropped
+	u.Transfers += o.Transfers
+	u.TransferBytes += o.TransferBytes
+	u.TransferMs += o.TransferMs
+	u.SlowTransfers += o.SlowTransfers
+	if o.Peak > u.Peak {
+		u.Peak = o.Peak
+	}
+	for name, count := range o.Objects {
+		u.addObject(name, count)
+	}
+}
+
+var (
+	mx    sync.Mutex
+	hour  string            // hour of usage in memory
+	usage map[string]*Usage // `{user}|{client}` => usage of the hour
+	dirty bool
+)
+
+func activityDir() string {
+	dir := config.ActivityDir
+	if !filepath.IsAbs(dir) {
+		dir = filepath.Join(config.AppPath, dir)
+	}
+	return dir
+}
+
+func hourFile(h string) string {
+	return filepath.Join(activityDir(), h+".json")
+}
+
+func loadHour(h string) []*Usage {
+	var arr []*Usage
+	if data, err := ioutil.ReadFile(hourFile(h)); err == nil {
+		if err = json.Unmarshal(data, &arr); err != nil {
+			log.Warn("[Activity] Invalid activity file %s: %v.", hourFile(h), err)
+		}
+	}
+	return arr
+}
+
+// switchHour save usage of previous hour and load the one of `h`, in case server restarted.
+// Must hold mx.
+func switchHour(h string) {
+	if hour == h {
+		return
+	}
+	saveLocked()
+	hour, usage = h, make(map[string]*Usage)
+	for _, u := range loadHour(h) {
+		usage[u.User+"|"+u.Client] = u
+	}
+}
+
+// Record account an event to current hour.
+//
+func Record(e *Event) {
+	if config.ActivityDir == "" {
+		return
+	}
+	user := e.User
+	if user == "" {
+		user = Anonymous
+	}
+
+	mx.Lock()
+	defer mx.Unlock()
+	switchHour(time.Now().Format(hourFormat))
+	key := user + "|" + e.Client
+	u := usage[key]
+	if u == nil {
+		u = &Usage{Hour: hour, User: user, Client: e.Client}
+		usage[key] = u
+	}
+	u.Requests++
+	u.Peak = u.Requests
+	u.Bytes += e.Bytes
+	switch e.Kind {
+	case KindDownload:
+		u.Downloads++
+		u.addTransfer(e.Bytes, e.Elapsed)
+	case KindIngest:
+		u.Ingests++
+	}
+	if e.Object != "" {
+		u.addObject(e.Branch+"/"+e.Object, 1)
+	}
+	dirty = true
+}
+
+// saveLocked write usage of current hour, must hold mx.
+func saveLocked() {
+	if !dirty || hour == "" {
+		return
+	}
+	arr := make([]*Usage, 0, len(usage))
+	for _, u := range usage {
+		arr = append(arr, u)
+	}
+	data, _ := json.Marshal(arr)
+	if err := os.MkdirAll(activityDir(), 0755); err != nil {
+		log.Error(2, "[Activity] Create activity folder failed: %v.", err)
+		return
+	}
+	tmp := hourFile(hour) + ".tmp"
+	if err := ioutil.WriteFile(tmp, data, 0644); err != nil {
+		log.Error(2, "[Activity] Save activity of %s failed: %v.", hour, err)
+		return
+	}
+	if err := os.Rename(tmp, hourFile(hour)); err != nil {
+		log.Error(2, "[Activity] Save activity of %s failed: %v.", hour, err)
+		return
+	}
+	dirty = false
+}
+
+// Flush save usage in memory.
+//
+func Flush() {
+	mx.Lock()
+	defer mx.Unlock()
+	saveLocked()
+}
+
+// prune remove hour files older than `[activity] RETENTION_DAYS`
+func prune(now time.Time) {
+	if config.ActivityRetentionDays <= 0 {
+		return
+	}
+	oldest := now.AddDate(0, 0, -config.ActivityRetentionDays).Format(hourFormat)
+	files, _ := filepath.Glob(filepath.Join(activityDir(), "*.json"))
+	for _, fpath := range files {
+		if h := strings.TrimSuffix(filepath.Base(fpath), ".json"); h < oldest {
+			os.Remove(fpath)
+		}
+	}
+}
+
+// Run save usage each minute and prune expired files until `done` closed.
+//
+func Run(done <-chan struct{}) {
+	if config.ActivityDir == "" {
+		return
+	}
+	ticker := time.NewTicker(time.Minute)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-done:
+			Flush()
+			return
+		case now := <-ticker.C:
+			Flush()
+			if now.Minute() == 0 {
+				prune(now)
+			}
+		}
+	}
+}
+
+// Hourly return usage of each hour in [from, to), oldest first.
+//
+func Hourly(from, to time.Time) []*Usage {
+	first, last := from.Format(hourFormat), to.Format(hourFormat)
+	mx.Lock()
+	saveLocked()
+	mx.Unlock()
+
+	var arr []*Usage
+	files, _ := filepath.Glob(filepath.Join(activityDir(), "*.json"))
+	sort.Strings(files)
+	for _, fpath := range files {
+		h := strings.TrimSuffix(filepath.Base(fpath), ".json")
+		if h < first || h >= last {
+			continue
+		}
+		arr = append(arr, loadHour(h)...)
+	}
+	return arr
+}
+
+// Summarize usage in [from, to) by `user`, `client`, `segment` or `hour`, heaviest first.
+// Only usage of `user` and `client` is taken if they are not empty.
+//
+func Summarize(from, to time.Time, by, user, client string) []*Usage {
+	sums := make(map[string]*Usage)
+	for _, u := range Hourly(from, to) {
+		if (user != "" && !strings.EqualFold(u.User, user)) || (client != "" && u.Client != client) {
+			continue
+		}
+		var key string
+		sum := &Usage{}
+		switch by {
+		case "client":
+			key, sum.Client = u.Client, u.Client
+		case "segment":
+			key = Segment(u.Client)
+			sum.Client = key
+		case "hour":
+			key, sum.Hour = u.Hour, u.Hour
+		default:
+			key, sum.User = strings.ToLower(u.User), u.User
+		}
+		if s, ok := sums[key]; ok {
+			sum = s
+		} else {
+			sums[key] = sum
+		}
+		sum.merge(u)
+	}
+
+	arr := make([]*Usage, 0, len(sums))
+	for _, s := range sums {
+		s.rate()
+		arr = append(arr, s)
+	}
+	sort.Slice(arr, func(i, j int) bool {
+		if by == "hour" {
+			return arr[i].Hour < arr[j].Hour
+		}
+		if arr[i].Bytes != arr[j].Bytes {
+			return arr[i].Bytes > arr[j].Bytes
+		}
+		return arr[i].Requests > arr[j].Requests
+	})
+	return arr
+}
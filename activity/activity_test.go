@@ -0,0 +1,142 @@
+package activity
+
+import (
+	"fmt"
+	"io/ioutil"
+	"net/http/httptest"
+	"os"
+	"testing"
+	"time"
+
+	"github.com/adyzng/GoSymbols/config"
+)
+
+func TestSummarize(t *testing.T) {
+	root, _ := ioutil.TempDir("", "activity")
+	defer os.RemoveAll(root)
+	defer func(p, d string) { config.AppPath, config.ActivityDir = p, d }(config.AppPath, config.ActivityDir)
+	config.AppPath, config.ActivityDir = root, "usage"
+
+	for i := 0; i < 3; i++ {
+		r := httptest.NewRequest("GET", "/api/symbol/UDP/ABC1/foo.pdb", nil)
+		ev := &Event{Kind: KindAPI}
+		r = WithEvent(r, ev)
+		Annotate(r, KindDownload, "UDP", "ABC1/foo.pdb")
+		ev.User, ev.Client, ev.Bytes = "alice", "10.0.0.1", 100
+		Record(ev)
+	}
+	Record(&Event{User: "alice", Client: "10.0.0.2", Kind: KindIngest, Branch: "UDP", Object: "1.0"})
+	Record(&Event{Client: "10.0.0.9", Kind: KindAPI, Bytes: 10})
+
+	now := time.Now()
+	users := Summarize(now.Add(-time.Hour), now.Add(time.Hour), "user", "", "")
+	if len(users) != 2 || users[0].User != "alice" {
+		t.Fatalf("expect alice and anonymous, got %+v", users)
+	}
+	alice := users[0]
+	if alice.Requests != 4 || alice.Downloads != 3 || alice.Ingests != 1 || alice.Bytes != 300 || alice.Peak != 3 {
+		t.Errorf("unexpected usage of alice %+v", alice)
+	}
+	if alice.Objects["UDP/ABC1/foo.pdb"] != 3 || alice.Objects["UDP/1.0"] != 1 {
+		t.Errorf("unexpected objects of alice %v", alice.Objects)
+	}
+	if users[1].User != Anonymous {
+		t.Errorf("expect anonymous, got %s", users[1].User)
+	}
+
+	// saved usage is loaded again after restart
+	mx.Lock()
+	hour, usage = "", nil
+	mx.Unlock()
+	clients := Summarize(now.Add(-time.Hour), now.Add(time.Hour), "client", "alice", "")
+	if len(clients) != 2 || clients[0].Client != "10.0.0.1" {
+		t.Errorf("expect 2 clients of alice, got %+v", clients)
+	}
+}
+
+func TestSlowSegments(t *testing.T) {
+	root, _ := ioutil.TempDir("", "activity")
+	defer os.RemoveAll(root)
+	defer func(p, d string, slow, min int) {
+		config.AppPath, config.ActivityDir = p, d
+		config.ActivitySlowKBps, config.ActivityMinTransferKB = slow, min
+	}(config.AppPath, config.ActivityDir, config.ActivitySlowKBps, config.ActivityMinTransferKB)
+	config.AppPath, config.ActivityDir = root, "usage"
+	config.ActivitySlowKBps, config.ActivityMinTransferKB = 512, 256
+	mx.Lock()
+	hour, usage = "", nil
+	mx.Unlock()
+
+	if s := Segment("10.1.2.3"); s != "10.1.2.0/24" {
+		t.Errorf("unexpected segment %s", s)
+	}
+	if s := Segment("2001:db8::1"); s != "2001:db8::/64" {
+		t.Errorf("unexpected segment %s", s)
+	}
+
+	for i := 0; i < 6; i++ {
+		// 1MB in 4s over VPN, 1MB in 100ms on LAN
+		Record(&Event{Client: fmt.Sprintf("10.8.0.%d", i), Kind: KindDownload, Bytes: 1 << 20, Elapsed: 4 * time.Second})
+		Record(&Event{Client: "10.0.0.1", Kind: KindDownload, Bytes: 1 << 20, Elapsed: 100 * time.Millisecond})
+	}
+	// small file not measured
+	Record(&Event{Client: "10.0.0.1", Kind: KindDownload, Bytes: 1024, Elapsed: time.Second})
+
+	now := time.Now()
+	segs := Summarize(now.Add(-time.Hour), now.Add(time.Hour), "segment", "", "")
+	if len(segs) != 2 {
+		t.Fatalf("expect 2 segments, got %+v", segs)
+	}
+	for _, s := range segs {
+		switch s.Client {
+		case "10.8.0.0/24":
+			if !s.Slow || s.Transfers != 6 || s.Throughput != 256 {
+				t.Errorf("expect vpn segment flagged slow, got %+v", s)
+			}
+		case "10.0.0.0/24":
+			if s.Slow || s.Transfers != 6 || s.Downloads != 7 || s.Throughput != 10240 {
+				t.Errorf("expect lan segment not slow, got %+v", s)
+			}
+		default:
+			t.Errorf("unexpected segment %+v", s)
+		}
+	}
+	if clients := Summarize(now.Add(-time.Hour), now.Add(time.Hour), "client", "", "10.8.0.1"); len(clients) != 1 || clients[0].Slow {
+		t.Errorf("expect single vpn client not flagged with one transfer, got %+v", clients)
+	}
+}
+
+func TestSymbolHeatmap(t *testing.T) {
+	root, _ := ioutil.TempDir("", "activity")
+	defer os.RemoveAll(root)
+	defer func(p, d string) { config.AppPath, config.ActivityDir = p, d }(config.AppPath, config.ActivityDir)
+	config.AppPath, config.ActivityDir = root, "usage"
+	mx.Lock()
+	hour, usage = "", nil
+	mx.Unlock()
+
+	Record(&Event{User: "alice", Kind: KindDownload, Branch: "UDP", Object: "ABC1/vddk.pdb"})
+	Record(&Event{User: "bob", Kind: KindDownload, Branch: "UDP", Object: "ABC2/VDDK.pdb"})
+	Record(&Event{User: "bob", Kind: KindDownload, Branch: "ASBU", Object: "ABC1/vddk.pdb"})
+	Record(&Event{User: "bob", Kind: KindDownload, Branch: "UDP", Object: "DEF1/foo.pdb"})
+	Record(&Event{User: "bob", Kind: KindIngest, Branch: "UDP", Object: "1.0"})
+
+	now := time.Now()
+	from := time.Date(now.Year(), now.Month(), now.Day(), 0, 0, 0, 0, time.Local).AddDate(0, 0, -1)
+	hm := SymbolHeatmap(from, from.AddDate(0, 0, 2), "day", "", "")
+	if len(hm.Buckets) != 2 || len(hm.Symbols) != 2 {
+		t.Fatalf("expect 2 days and 2 symbols, got %+v", hm)
+	}
+	vddk := hm.Symbols[0]
+	if vddk.Name != "vddk.pdb" && vddk.Name != "VDDK.pdb" || vddk.Downloads != 3 || vddk.Hashes != 2 {
+		t.Errorf("unexpected heat of vddk %+v", vddk)
+	}
+	if vddk.Branches["UDP"] != 2 || vddk.Branches["ASBU"] != 1 || vddk.Buckets[0] != 0 || vddk.Buckets[1] != 3 {
+		t.Errorf("unexpected branches or buckets of vddk %+v", vddk)
+	}
+
+	hm = SymbolHeatmap(from, from.AddDate(0, 0, 2), "hour", "udp", "VDDK*")
+	if len(hm.Buckets) != 48 || len(hm.Symbols) != 1 || hm.Symbols[0].Downloads != 2 {
+		t.Errorf("expect vddk downloaded twice in UDP, got %+v", hm.Symbols)
+	}
+}
@@ -0,0 +1,109 @@
+package activity
+
+import (
+	"path"
+	"sort"
+	"strings"
+	"time"
+)
+
+// SymbolHeat is downloads of one symbol name across branches
+//
+type SymbolHeat struct {
+	Name      string           `json:"name"`
+	Downloads int64            `json:"downloads"`
+	Hashes    int              `json:"hashes"`   // distinct hashes downloaded
+	Branches  map[string]int64 `json:"branches"` // branch => downloads
+	Buckets   []int64          `json:"buckets"`  // downloads in each of Heatmap.Buckets
+}
+
+// Heatmap is downloads of symbols by name over time, for component owners to see which of
+// their symbols are used in debugging.
+//
+type Heatmap struct {
+	Step    string        `json:"step"`    // day or hour
+	Buckets []string      `json:"buckets"` // start of each bucket, 2006-01-02 or 2006-01-02 15:00
+	Symbols []*SymbolHeat `json:"symbols"` // most downloaded first
+	Dropped int64         `json:"dropped"` // objects over the per hour limit of a user, not attributed
+	Unused  []string      `json:"unused,omitempty"`
+}
+
+// splitDownload split object `{branch}/{hash}/{name}` of a download, false for ingests
+// which are `{branch}/{version}`
+func splitDownload(obj string) (branch, hash, name string, ok bool) {
+	ss := strings.Split(obj, "/")
+	if len(ss) != 3 || ss[2] == "" {
+		return "", "", "", false
+	}
+	return ss[0], ss[1], ss[2], true
+}
+
+// SymbolHeatmap aggregate downloads in [from, to) by symbol name into buckets of `step`
+// (day or hour). Only downloads of `branch` and names matching `pattern` (case insensitive,
+// `*` matches any) are taken if they are not empty.
+//
+func SymbolHeatmap(from, to time.Time, step, branch, pattern string) *Heatmap {
+	format, next := "2006-01-02", func(t time.Time) time.Time { return t.AddDate(0, 0, 1) }
+	if step == "hour" {
+		format, next = "2006-01-02 15:00", func(t time.Time) time.Time { return t.Add(time.Hour) }
+	} else {
+		step = "day"
+	}
+	hm := &Heatmap{Step: step, Buckets: []string{}, Symbols: []*SymbolHeat{}}
+	index := make(map[string]int)
+	for t := from; t.Before(to); t = next(t) {
+		if _, ok := index[t.Format(format)]; !ok {
+			index[t.Format(format)] = len(hm.Buckets)
+			hm.Buckets = append(hm.Buckets, t.Format(format))
+		}
+	}
+
+	pattern = strings.ToLower(pattern)
+	heats := make(map[string]*SymbolHeat)
+	hashes := make(map[string]map[string]bool)
+	for _, u := range Hourly(from, to) {
+		hm.Dropped += u.Dropped
+		t, err := time.ParseInLocation(hourFormat, u.Hour, time.Local)
+		if err != nil {
+			continue
+		}
+		bucket, ok := index[t.Format(format)]
+		if !ok {
+			continue
+		}
+		for obj, n := range u.Objects {
+			br, hash, name, ok := splitDownload(obj)
+			if !ok || (branch != "" && !strings.EqualFold(br, branch)) {
+				continue
+			}
+			lower := strings.ToLower(name)
+			if pattern != "" {
+				if match, _ := path.Match(pattern, lower); !match {
+					continue
+				}
+			}
+			heat := heats[lower]
+			if heat == nil {
+				heat = &SymbolHeat{Name: name, Branches: make(map[string]int64), Buckets: make([]int64, len(hm.Buckets))}
+				heats[lower] = heat
+				hashes[lower] = make(map[string]bool)
+			}
+			heat.Downloads += n
+			heat.Branches[br] += n
+			heat.Buckets[bucket] += n
+			hashes[lower][strings.ToLower(hash)] = true
+		}
+	}
+
+	for lower, heat := range heats {
+		heat.Hashes = len(hashes[lower])
+		hm.Symbols = append(hm.Symbols, heat)
+	}
+	sort.Slice(hm.Symbols, func(i, j int) bool {
+		if hm.Symbols[i].Downloads != hm.Symbols[j].Downloads {
+			return hm.Symbols[i].Downloads > hm.Symbols[j].Downloads
+		}
+		return hm.Symbols[i].Name < hm.Symbols[j].Name
+	})
+	return hm
+}
@@ -0,0 +1,182 @@
+package alert
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"sync"
+	"time"
+
+	"github.com/adyzng/GoSymbols/config"
+	log "gopkg.in/clog.v1"
+)
+
+const (
+	maxRecent = 200
+)
+
+// Alert kinds
+const (
+	KindSymbolConflict   = "symbol-conflict"
+	KindUnsignedRelease  = "unsigned-release"
+	KindMalformedAdmin   = "malformed-admin"
+	KindWeeklyReport     = "weekly-report"
+	KindShareUnreachable = "share-unreachable"
+	KindShareSlow        = "share-slow"
+	KindEncryptFailed    = "encrypt-failed"
+	KindMalwareDetected  = "malware-detected"
+	KindStoreReadOnly    = "store-read-only"
+	KindNewBuild         = "new-build"
+	KindBackendSync      = "backend-sync"
+	KindInvalidSymbols   = "invalid-symbols"
+	KindShadowMismatch   = "shadow-mismatch"
+)
+
+// Alert is one raised alert
+//
+type Alert struct {
+	Time    string `json:"time"`
+	Kind    string `json:"kind"`
+	Branch  string `json:"branch,omitempty"`
+	Message string `json:"message"`
+	HTML    string `json:"html,omitempty"` // rich content of notification, eg: report
+}
+
+// Sink deliver alerts to external system
+//
+type Sink interface {
+	// Name of the sink, used in log
+	Name() string
+	// Send an alert, called in background
+	Send(a *Alert) error
+}
+
+var (
+	mx     sync.RWMutex
+	once   sync.Once
+	recent []*Alert
+	sinks  []Sink
+
+	sending sync.WaitGroup
+)
+
+func setup() {
+	if config.AlertWebhook != "" {
+		Register(&Webhook{URL: config.AlertWebhook})
+	}
+}
+
+// Register add an sink, all alerts raised after will be sent to it.
+//
+func Register(s Sink) {
+	mx.Lock()
+	defer mx.Unlock()
+	sinks = append(sinks, s)
+	log.Info("[Alert] Register sink %s.", s.Name())
+}
+
+// Raise record an alert and dispatch it to all sinks.
+//
+func Raise(kind, branch, format string, args ...interface{}) *Alert {
+	once.Do(setup)
+
+	a := &Alert{
+		Time:    time.Now().Format("2006-01-02 15:04:05"),
+		Kind:    kind,
+		Branch:  branch,
+		Message: fmt.Sprintf(format, args...),
+	}
+	log.Warn("[Alert] %s %s: %s", a.Kind, a.Branch, a.Message)
+
+	mx.Lock()
+	recent = append(recent, a)
+	if len(recent) > maxRecent {
+		recent = recent[len(recent)-maxRecent:]
+	}
+	mx.Unlock()
+
+	dispatch(a)
+	return a
+}
+
+// Deliver send an notification (eg: report) to all sinks, it's not kept in recent alerts.
+//
+func Deliver(a *Alert) {
+	once.Do(setup)
+	if a.Time == "" {
+		a.Time = time.Now().Format("2006-01-02 15:04:05")
+	}
+	log.Info("[Alert] Deliver %s %s.", a.Kind, a.Branch)
+	dispatch(a)
+}
+
+func dispatch(a *Alert) {
+	mx.RLock()
+	targets := make([]Sink, len(sinks))
+	copy(targets, sinks)
+	mx.RUnlock()
+
+	for _, s := range targets {
+		sending.Add(1)
+		go func(s Sink) {
+			defer sending.Done()
+			if err := s.Send(a); err != nil {
+				log.Error(2, "[Alert] Send alert to %s failed: %v.", s.Name(), err)
+			}
+		}(s)
+	}
+}
+
+// Wait block until all alerts being sent are finished, before the process exit.
+//
+func Wait() {
+	sending.Wait()
+}
+
+// Recent return the latest `n` alerts, newest first. n <= 0 return all.
+//
+func Recent(n int) []*Alert {
+	mx.RLock()
+	defer mx.RUnlock()
+	if n <= 0 || n > len(recent) {
+		n = len(recent)
+	}
+	arr := make([]*Alert, 0, n)
+	for i := len(recent) - 1; i >= 0 && len(arr) < n; i-- {
+		arr = append(arr, recent[i])
+	}
+	return arr
+}
+
+// Webhook post alert in json to given URL
+//
+type Webhook struct {
+	URL string
+}
+
+var httpClient = &http.Client{
+	Timeout: time.Second * 15,
+}
+
+// Name of webhook sink
+func (w *Webhook) Name() string {
+	return "webhook(" + w.URL + ")"
+}
+
+// Send post alert to webhook
+func (w *Webhook) Send(a *Alert) error {
+	body, err := json.Marshal(a)
+	if err != nil {
+		return err
+	}
+	resp, err := httpClient.Post(w.URL, "application/json", bytes.NewReader(body))
+	if err != nil {
+		return err
+	}
+	resp.Body.Close()
+	if resp.StatusCode >= 300 {
+		return fmt.Errorf("webhook response %s", resp.Status)
+	}
+	return nil
+}
@@ -0,0 +1,123 @@
+package audit
+
+import (
+	"bufio"
+	"encoding/json"
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/adyzng/GoSymbols/config"
+	log "gopkg.in/clog.v1"
+)
+
+// Entry is one audited operation
+//
+type Entry struct {
+	Time   string `json:"time"`
+	User   string `json:"user"`
+	Action string `json:"action"`
+	Branch string `json:"branch,omitempty"`
+	Detail string `json:"detail"`
+}
+
+var (
+	mx     sync.Mutex
+	file   *os.File // audit log kept open for append
+	opened string   // path of `file`, reopened if config.AuditFile changed
+)
+
+func auditFile() string {
+	if filepath.IsAbs(config.AuditFile) {
+		return config.AuditFile
+	}
+	return filepath.Join(config.AppPath, config.AuditFile)
+}
+
+// open return the audit log opened for append, must hold mx
+func open() (*os.File, error) {
+	fpath := auditFile()
+	if file != nil && opened == fpath {
+		return file, nil
+	}
+	if file != nil {
+		file.Close()
+		file = nil
+	}
+	fd, err := os.OpenFile(fpath, os.O_WRONLY|os.O_CREATE|os.O_APPEND, 0644)
+	if err != nil {
+		return nil, err
+	}
+	file, opened = fd, fpath
+	return file, nil
+}
+
+// Record append an entry to audit log, one json per line.
+//
+func Record(user, action, branch, format string, args ...interface{}) error {
+	e := &Entry{
+		Time:   time.Now().Format("2006-01-02 15:04:05"),
+		User:   user,
+		Action: action,
+		Branch: branch,
+		Detail: fmt.Sprintf(format, args...),
+	}
+	data, _ := json.Marshal(e)
+
+	mx.Lock()
+	defer mx.Unlock()
+	fd, err := open()
+	if err != nil {
+		log.Error(2, "[Audit] Open audit log failed: %v.", err)
+		return err
+	}
+	if _, err = fd.Write(append(data, '\n')); err != nil {
+		// reopen on next record, eg: the log was moved away
+		fd.Close()
+		file = nil
+		log.Error(2, "[Audit] Write audit log failed: %v.", err)
+		return err
+	}
+	log.Info("[Audit] %s %s %s: %s", e.User, e.Action, e.Branch, e.Detail)
+	return nil
+}
+
+// Recent return the latest `n` entries of given branch (empty for all), newest first.
+//
+func Recent(n int, branch string) ([]*Entry, error) {
+	mx.Lock()
+	defer mx.Unlock()
+	fd, err := os.Open(auditFile())
+	if os.IsNotExist(err) {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+	defer fd.Close()
+
+	var all []*Entry
+	scan := bufio.NewScanner(fd)
+	scan.Buffer(make([]byte, 64*1024), 16<<20)
+	for scan.Scan() {
+		var e Entry
+		if json.Unmarshal(scan.Bytes(), &e) != nil {
+			continue
+		}
+		if branch == "" || strings.EqualFold(e.Branch, branch) {
+			all = append(all, &e)
+		}
+	}
+
+	if n <= 0 || n > len(all) {
+		n = len(all)
+	}
+	arr := make([]*Entry, 0, n)
+	for i := len(all) - 1; i >= 0 && len(arr) < n; i-- {
+		arr = append(arr, all[i])
+	}
+	return arr, scan.Err()
+}
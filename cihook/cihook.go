@@ -0,0 +1,215 @@
+// Package cihook parse build notifications posted by CI systems, Jenkins (notification
+// plugin), TeamCity (tcWebHooks json) and GitHub Actions (workflow_run event), so finished
+// builds are ingested at once instead of waiting for the next poll of latestbuild.txt.
+//
+package cihook
+
+import (
+	"crypto/hmac"
+	"crypto/sha256"
+	"crypto/subtle"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"path"
+	"strings"
+
+	"github.com/adyzng/GoSymbols/config"
+)
+
+// CI systems
+const (
+	Jenkins  = "jenkins"
+	TeamCity = "teamcity"
+	GitHub   = "github"
+)
+
+var (
+	ErrUnknownPayload = errors.New("unknown webhook payload")
+	ErrNoBuildNumber  = errors.New("webhook payload without build number")
+)
+
+// Build is the build reported by a webhook.
+//
+type Build struct {
+	System  string `json:"system"`
+	Job     string `json:"job"`     // jenkins job, teamcity build configuration id, or `{repo}/{workflow}`
+	Number  string `json:"number"`  // build number, the version of the build on share
+	Status  string `json:"status"`  // result in lower case, eg: success, failure
+	Done    bool   `json:"done"`    // finished, not queued or started
+	Success bool   `json:"success"` // finished and succeeded, the only builds to ingest
+}
+
+type jenkinsPayload struct {
+	Name  string `json:"name"`
+	Build *struct {
+		Number json.Number `json:"number"`
+		Phase  string      `json:"phase"`
+		Status string      `json:"status"`
+	} `json:"build"`
+}
+
+type teamcityPayload struct {
+	Build *struct {
+		BuildTypeID string `json:"buildTypeId"`
+		BuildNumber string `json:"buildNumber"`
+		BuildResult string `json:"buildResult"`
+		NotifyType  string `json:"notifyType"`
+	} `json:"build"`
+}
+
+type githubPayload struct {
+	Action      string `json:"action"`
+	WorkflowRun *struct {
+		Name       string      `json:"name"`
+		RunNumber  json.Number `json:"run_number"`
+		Status     string      `json:"status"`
+		Conclusion string      `json:"conclusion"`
+	} `json:"workflow_run"`
+	Repository *struct {
+		FullName string `json:"full_name"`
+	} `json:"repository"`
+}
+
+// Parse decode webhook `body`, the CI system is told by the headers or the shape of payload.
+//
+func Parse(header http.Header, body []byte) (*Build, error) {
+	if event := header.Get("X-GitHub-Event"); event != "" {
+		if event != "workflow_run" {
+			return nil, fmt.Errorf("unsupported github event %s", event)
+		}
+		return parseGitHub(body)
+	}
+
+	var probe struct {
+		Build map[string]interface{} `json:"build"`
+	}
+	if err := json.Unmarshal(body, &probe); err != nil {
+		return nil, err
+	}
+	switch {
+	case probe.Build == nil:
+		return nil, ErrUnknownPayload
+	case probe.Build["buildTypeId"] != nil:
+		return parseTeamCity(body)
+	case probe.Build["phase"] != nil:
+		return parseJenkins(body)
+	}
+	return nil, ErrUnknownPayload
+}
+
+func parseJenkins(body []byte) (*Build, error) {
+	p := jenkinsPayload{}
+	if err := json.Unmarshal(body, &p); err != nil {
+		return nil, err
+	}
+	if p.Build.Number == "" {
+		return nil, ErrNoBuildNumber
+	}
+	phase := strings.ToUpper(p.Build.Phase)
+	b := &Build{
+		System: Jenkins,
+		Job:    p.Name,
+		Number: p.Build.Number.String(),
+		Status: strings.ToLower(p.Build.Status),
+		Done:   phase == "COMPLETED" || phase == "FINALIZED",
+	}
+	b.Success = b.Done && b.Status == "success"
+	return b, nil
+}
+
+func parseTeamCity(body []byte) (*Build, error) {
+	p := teamcityPayload{}
+	if err := json.Unmarshal(body, &p); err != nil {
+		return nil, err
+	}
+	if p.Build.BuildNumber == "" {
+		return nil, ErrNoBuildNumber
+	}
+	b := &Build{
+		System: TeamCity,
+		Job:    p.Build.BuildTypeID,
+		Number: p.Build.BuildNumber,
+		Status: strings.ToLower(p.Build.BuildResult),
+		Done:   p.Build.NotifyType == "buildFinished",
+	}
+	b.Success = b.Done && b.Status == "success"
+	return b, nil
+}
+
+func parseGitHub(body []byte) (*Build, error) {
+	p := githubPayload{}
+	if err := json.Unmarshal(body, &p); err != nil {
+		return nil, err
+	}
+	if p.WorkflowRun == nil {
+		return nil, ErrUnknownPayload
+	}
+	if p.WorkflowRun.RunNumber == "" {
+		return nil, ErrNoBuildNumber
+	}
+	job := p.WorkflowRun.Name
+	if p.Repository != nil && p.Repository.FullName != "" {
+		job = p.Repository.FullName + "/" + job
+	}
+	b := &Build{
+		System: GitHub,
+		Job:    job,
+		Number: p.WorkflowRun.RunNumber.String(),
+		Status: strings.ToLower(p.WorkflowRun.Conclusion),
+		Done:   p.Action == "completed" || p.WorkflowRun.Status == "completed",
+	}
+	b.Success = b.Done && b.Status == "success"
+	return b, nil
+}
+
+// Verify check the request is signed by `[hooks] SECRET`, GitHub sign the body in header
+// X-Hub-Signature-256, other systems give the secret in `?secret=` or header X-Hook-Secret.
+//
+func Verify(r *http.Request, body []byte) bool {
+	secret := config.HookSecret
+	if secret == "" {
+		return false
+	}
+	if sig := r.Header.Get("X-Hub-Signature-256"); sig != "" {
+		mac := hmac.New(sha256.New, []byte(secret))
+		mac.Write(body)
+		expect := "sha256=" + hex.EncodeToString(mac.Sum(nil))
+		return hmac.Equal([]byte(strings.ToLower(sig)), []byte(expect))
+	}
+	given := r.Header.Get("X-Hook-Secret")
+	if given == "" {
+		given = r.URL.Query().Get("secret")
+	}
+	return given != "" && subtle.ConstantTimeCompare([]byte(given), []byte(secret)) == 1
+}
+
+// Branch return the branch of build `b` by `[hooks] RULES`, `{system}:{job pattern}={branch}`
+// where system may be `*` and pattern is a case insensitive glob, the first matching wins.
+// Without matching rule the branch is given by `fallback` of the job, eg: the branch of
+// the same build name.
+//
+func Branch(b *Build, fallback func(job string) string) string {
+	job := strings.ToLower(b.Job)
+	for _, rule := range config.HookRules {
+		idx := strings.LastIndex(rule, "=")
+		sep := strings.Index(rule, ":")
+		if idx == -1 || sep == -1 || sep > idx {
+			continue
+		}
+		system := strings.ToLower(strings.TrimSpace(rule[:sep]))
+		pattern := strings.ToLower(strings.TrimSpace(rule[sep+1 : idx]))
+		if system != "*" && system != b.System {
+			continue
+		}
+		if ok, _ := path.Match(pattern, job); ok || pattern == "*" {
+			return strings.TrimSpace(rule[idx+1:])
+		}
+	}
+	if fallback != nil {
+		return fallback(b.Job)
+	}
+	return ""
+}
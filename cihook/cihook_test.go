@@ -0,0 +1,121 @@
+package cihook
+
+import (
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/hex"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/adyzng/GoSymbols/config"
+)
+
+func TestParse(t *testing.T) {
+	cases := []struct {
+		event   string
+		body    string
+		expect  Build
+		failure bool
+	}{
+		{
+			body:   `{"name":"UDP-main","build":{"number":538,"phase":"FINALIZED","status":"SUCCESS"}}`,
+			expect: Build{System: Jenkins, Job: "UDP-main", Number: "538", Status: "success", Done: true, Success: true},
+		},
+		{
+			body:   `{"name":"UDP-main","build":{"number":539,"phase":"STARTED"}}`,
+			expect: Build{System: Jenkins, Job: "UDP-main", Number: "539"},
+		},
+		{
+			body:   `{"build":{"buildTypeId":"Udp_Main","buildNumber":"4175.2-538","buildResult":"failure","notifyType":"buildFinished"}}`,
+			expect: Build{System: TeamCity, Job: "Udp_Main", Number: "4175.2-538", Status: "failure", Done: true},
+		},
+		{
+			event:  "workflow_run",
+			body:   `{"action":"completed","workflow_run":{"name":"build","run_number":42,"conclusion":"success"},"repository":{"full_name":"corp/udp"}}`,
+			expect: Build{System: GitHub, Job: "corp/udp/build", Number: "42", Status: "success", Done: true, Success: true},
+		},
+		{event: "push", body: `{}`, failure: true},
+		{body: `{"name":"UDP-main"}`, failure: true},
+		{body: `{"name":"UDP-main","build":{"phase":"FINALIZED"}}`, failure: true},
+	}
+	for _, c := range cases {
+		header := http.Header{}
+		if c.event != "" {
+			header.Set("X-GitHub-Event", c.event)
+		}
+		b, err := Parse(header, []byte(c.body))
+		if c.failure {
+			if err == nil {
+				t.Errorf("parse %s should fail, got %+v", c.body, b)
+			}
+			continue
+		}
+		if err != nil {
+			t.Errorf("parse %s failed: %v", c.body, err)
+			continue
+		}
+		if *b != c.expect {
+			t.Errorf("parse %s got %+v, expect %+v", c.body, *b, c.expect)
+		}
+	}
+}
+
+func TestVerify(t *testing.T) {
+	defer func(s string) { config.HookSecret = s }(config.HookSecret)
+	body := []byte(`{"action":"completed"}`)
+
+	config.HookSecret = ""
+	r := httptest.NewRequest("POST", "/api/v1/hooks?secret=", nil)
+	if Verify(r, body) {
+		t.Errorf("verify without secret configured should fail")
+	}
+
+	config.HookSecret = "s3cret"
+	mac := hmac.New(sha256.New, []byte("s3cret"))
+	mac.Write(body)
+	r = httptest.NewRequest("POST", "/api/v1/hooks", nil)
+	r.Header.Set("X-Hub-Signature-256", "sha256="+hex.EncodeToString(mac.Sum(nil)))
+	if !Verify(r, body) {
+		t.Errorf("verify github signature failed")
+	}
+	if Verify(r, []byte(`{"action":"requested"}`)) {
+		t.Errorf("verify github signature of another body should fail")
+	}
+
+	if !Verify(httptest.NewRequest("POST", "/api/v1/hooks?secret=s3cret", nil), body) {
+		t.Errorf("verify secret in query failed")
+	}
+	r = httptest.NewRequest("POST", "/api/v1/hooks", nil)
+	r.Header.Set("X-Hook-Secret", "wrong")
+	if Verify(r, body) {
+		t.Errorf("verify wrong secret should fail")
+	}
+}
+
+func TestBranch(t *testing.T) {
+	defer func(rules []string) { config.HookRules = rules }(config.HookRules)
+	config.HookRules = []string{"jenkins:UDP-main=UDPMAIN", "github:corp/udp/*=UDP", "*:nightly-*=NIGHTLY", "bad rule"}
+
+	fallback := func(job string) string {
+		if strings.EqualFold(job, "Udp_Main") {
+			return "UDPv6.5"
+		}
+		return ""
+	}
+	cases := map[Build]string{
+		{System: Jenkins, Job: "udp-MAIN"}:        "UDPMAIN",
+		{System: TeamCity, Job: "UDP-main"}:       "",
+		{System: GitHub, Job: "corp/udp/build"}:   "UDP",
+		{System: TeamCity, Job: "nightly-x64"}:    "NIGHTLY",
+		{System: TeamCity, Job: "Udp_Main"}:       "UDPv6.5",
+		{System: GitHub, Job: "corp/other/build"}: "",
+	}
+	for b, expect := range cases {
+		b := b
+		if got := Branch(&b, fallback); got != expect {
+			t.Errorf("branch of %s job %s got %q, expect %q", b.System, b.Job, got, expect)
+		}
+	}
+}
@@ -1,7 +1,9 @@
 package cmd
 
 import (
+	"context"
 	"errors"
+	"strings"
 
 	"github.com/adyzng/GoSymbols/symbol"
 	"github.com/urfave/cli"
@@ -18,6 +20,8 @@ var AddBuild = cli.Command{
 	Flags: []cli.Flag{
 		stringFlag("branch, b", "", "The branch name in the symbol store."),
 		stringFlag("version, v", "", "The build version, empty version for the latest build."),
+		stringFlag("files, f", "", "Comma separated pdb names or globs, add only them to an exist build."),
+		boolFlag("force", "Re-publish all pdbs of an exist build, the new files supersede the old ones."),
 	},
 }
 
@@ -31,8 +35,8 @@ func addBuild(c *cli.Context) error {
 	}
 
 	build := ""
-	if c.IsSet("build") {
-		build = c.String("build")
+	if c.IsSet("version") {
+		build = c.String("version")
 	}
 
 	log.Info("[App] Add build %s for branch %s", build, bname)
@@ -47,5 +51,24 @@ func addBuild(c *cli.Context) error {
 		return errors.New("branch not exist")
 	}
 
-	return builder.AddBuild(build)
+	if c.Bool("force") {
+		if build == "" {
+			return errors.New("force re-ingest need build version")
+		}
+		br, ok := builder.(*symbol.BrBuilder)
+		if !ok {
+			return errors.New("branch not support re-ingest")
+		}
+		_, err := br.Reingest(build)
+		return err
+	}
+	if files := c.String("files"); files != "" {
+		if build == "" {
+			return errors.New("supplement need build version")
+		}
+		log.Info("[App] Supplement build %s with %s.", build, files)
+		_, err := builder.AddSupplement(build, strings.Split(files, ","))
+		return err
+	}
+	return builder.AddBuild(context.Background(), build)
 }
@@ -0,0 +1,73 @@
+package cmd
+
+import (
+	"errors"
+	"fmt"
+	"time"
+
+	"github.com/adyzng/GoSymbols/symbol"
+	"github.com/urfave/cli"
+
+	log "gopkg.in/clog.v1"
+)
+
+// Backfill ...
+var Backfill = cli.Command{
+	Name:        "backfill",
+	Usage:       "Ingest all missing builds of specified branch.",
+	Description: "Enumerate Build* folders on build server, and add the ones not in symbol store oldest first.",
+	Action:      runBackfill,
+	Flags: []cli.Flag{
+		stringFlag("branch, b", "", "The branch name in the symbol store."),
+		intFlag("limit, l", 0, "Max builds to add, 0 for all."),
+		intFlag("interval, i", 0, "Seconds to pause between two builds."),
+		boolFlag("dry-run, n", "Only list the missing builds."),
+	},
+}
+
+func runBackfill(c *cli.Context) error {
+	bname := c.String("branch")
+	if bname == "" {
+		return errors.New("empty branch name")
+	}
+
+	ss := symbol.GetServer()
+	if err := ss.LoadBranchs(); err != nil {
+		return err
+	}
+	builder, ok := ss.Get(bname).(*symbol.BrBuilder)
+	if !ok {
+		log.Warn("[App] Branch %s not exist.", bname)
+		return errors.New("branch not exist")
+	}
+
+	if c.Bool("dry-run") {
+		missing, err := builder.MissingBuilds()
+		if err != nil {
+			return err
+		}
+		for _, sb := range missing {
+			fmt.Printf("%s\t%s\t%d\n", sb.Version, sb.Date, sb.Size)
+		}
+		fmt.Printf("%d builds missing.\n", len(missing))
+		return nil
+	}
+
+	progress, err := ss.Backfill(bname, symbol.BackfillOption{
+		Limit:    c.Int("limit"),
+		Interval: c.Int("interval"),
+	})
+	if err != nil {
+		return err
+	}
+	for progress.Running {
+		time.Sleep(time.Second * 5)
+		progress = ss.BackfillProgress(bname)
+		fmt.Printf("[%d/%d] failed %d, current %s\n",
+			progress.Done, progress.Total, progress.Failed, progress.Current)
+	}
+	for ver, msg := range progress.Errors {
+		fmt.Printf("Build %s failed: %s\n", ver, msg)
+	}
+	return nil
+}
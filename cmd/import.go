@@ -0,0 +1,57 @@
+package cmd
+
+import (
+	"encoding/json"
+	"errors"
+	"os"
+
+	"github.com/adyzng/GoSymbols/symbol"
+	"github.com/urfave/cli"
+
+	log "gopkg.in/clog.v1"
+)
+
+// Import ...
+var Import = cli.Command{
+	Name:        "import",
+	Usage:       "Create branches from a csv file for mass onboarding.",
+	Description: "Read branches from a csv with a header row of storeName, buildPath, schedule, retention (and buildName, storePath, priority, detector). Each row is validated and reported, the valid ones are created. Builds of the new branches are ingested by the web service.",
+	Action:      runImport,
+	Flags: []cli.Flag{
+		stringFlag("file, f", "", "The csv file of branches, saved by Excel is accepted."),
+		boolFlag("dry-run", "Only validate the rows, create nothing."),
+	},
+}
+
+func runImport(c *cli.Context) error {
+	file := c.String("file")
+	if file == "" {
+		return errors.New("empty csv file")
+	}
+	fd, err := os.Open(file)
+	if err != nil {
+		return err
+	}
+	defer fd.Close()
+
+	rows, err := symbol.ParseBranchCSV(fd)
+	if err != nil {
+		return err
+	}
+	ss := symbol.GetServer()
+	if err = ss.LoadBranchs(); err != nil {
+		return err
+	}
+
+	log.Info("[App] Import %d branches from %s.", len(rows), file)
+	report := ss.ImportBranches(rows, c.Bool("dry-run"), "cli")
+	enc := json.NewEncoder(os.Stdout)
+	enc.SetIndent("", "  ")
+	if err = enc.Encode(report); err != nil {
+		return err
+	}
+	if report.Invalid > 0 {
+		return errors.New("invalid rows in csv")
+	}
+	return nil
+}
@@ -0,0 +1,49 @@
+package cmd
+
+import (
+	"encoding/json"
+	"errors"
+	"os"
+
+	"github.com/adyzng/GoSymbols/symbol"
+	"github.com/urfave/cli"
+)
+
+// Merge ...
+var Merge = cli.Command{
+	Name:        "merge",
+	Usage:       "Find branches sharing build path, and merge one into another.",
+	Description: "Without --from and --into, list branches pointing to the same build path. Otherwise re-key the transactions of --from after the last one of --into, copy their symbols and remove --from from the branch list. Versions in both branches with different symbols are listed as conflicts, and nothing is merged. The store folder of --from is kept.",
+	Action:      runMerge,
+	Flags: []cli.Flag{
+		stringFlag("from", "", "The branch merged and removed."),
+		stringFlag("into", "", "The branch to keep."),
+		boolFlag("dry-run, n", "Only show the transactions to merge."),
+	},
+}
+
+func runMerge(c *cli.Context) error {
+	ss := symbol.GetServer()
+	if err := ss.LoadBranchs(); err != nil {
+		return err
+	}
+
+	enc := json.NewEncoder(os.Stdout)
+	enc.SetIndent("", "  ")
+	from, into := c.String("from"), c.String("into")
+	if from == "" && into == "" {
+		return enc.Encode(ss.FindDuplicates())
+	}
+	if from == "" || into == "" {
+		return errors.New("both --from and --into are required")
+	}
+
+	report, err := ss.MergeBranch(from, into, "cli", c.Bool("dry-run"))
+	if err == symbol.ErrMergeConflict {
+		enc.Encode(report)
+	}
+	if err != nil {
+		return err
+	}
+	return enc.Encode(report)
+}
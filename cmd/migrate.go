@@ -0,0 +1,54 @@
+package cmd
+
+import (
+	"encoding/json"
+	"errors"
+	"os"
+
+	"github.com/adyzng/GoSymbols/symbol"
+	"github.com/urfave/cli"
+
+	log "gopkg.in/clog.v1"
+)
+
+// MigrateLayout ...
+var MigrateLayout = cli.Command{
+	Name:        "migrate-layout",
+	Usage:       "Convert specified branch to symstore two-tier layout in place.",
+	Description: "Move every symbol folder of the store under the folder named by its first 2 chars and create index2.txt, so symstore.exe keep adding files in two-tier layout. It can be run again if interrupted. While the server is running, prefer `POST /api/branches/{name}/layout` so it migrates in process.",
+	Action:      runMigrateLayout,
+	Flags: []cli.Flag{
+		stringFlag("branch, b", "", "The branch name in the symbol store."),
+		boolFlag("dry-run, n", "Only count the folders to move."),
+	},
+}
+
+func runMigrateLayout(c *cli.Context) error {
+	bname := c.String("branch")
+	if bname == "" {
+		return errors.New("empty branch name")
+	}
+
+	ss := symbol.GetServer()
+	if err := ss.LoadBranchs(); err != nil {
+		return err
+	}
+	builder, ok := ss.Get(bname).(*symbol.BrBuilder)
+	if !ok {
+		log.Warn("[App] Branch %s not exist.", bname)
+		return errors.New("branch not exist")
+	}
+
+	report, err := builder.MigrateLayout(c.Bool("dry-run"))
+	if err != nil {
+		return err
+	}
+	if !report.DryRun {
+		if err = ss.SaveBranchs(""); err != nil {
+			log.Warn("[App] Save branches failed: %v.", err)
+		}
+	}
+	enc := json.NewEncoder(os.Stdout)
+	enc.SetIndent("", "  ")
+	return enc.Encode(report)
+}
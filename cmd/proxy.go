@@ -0,0 +1,91 @@
+package cmd
+
+import (
+	"context"
+	"fmt"
+	"net/http"
+	"os"
+	"os/signal"
+	"strconv"
+	"strings"
+
+	"github.com/adyzng/GoSymbols/config"
+	"github.com/adyzng/GoSymbols/proxy"
+	"github.com/urfave/cli"
+
+	log "gopkg.in/clog.v1"
+)
+
+// Proxy local cache daemon subcommand
+//
+var Proxy = cli.Command{
+	Name:        "proxy",
+	Usage:       "Start local symbol cache daemon",
+	Description: "Serve symsrv requests from local debugger, read through from central symbol servers.",
+	Action:      runProxy,
+	Flags: []cli.Flag{
+		stringFlag("address, a", "", "Listen address, 0.0.0.0 to act as shared upstream proxy"),
+		stringFlag("port, p", "", "Listen port, default [proxy] PORT"),
+		stringFlag("upstream, u", "", "Comma separated upstream URL templates"),
+		stringFlag("dir, d", "", "Local cache folder"),
+		intFlag("size, s", 0, "Max cache size in MB"),
+	},
+}
+
+func runProxy(c *cli.Context) error {
+	upstreams := config.ProxyUpstreams
+	if c.IsSet("upstream") {
+		upstreams = strings.Split(c.String("upstream"), ",")
+	}
+	if len(upstreams) == 0 {
+		return fmt.Errorf("no upstream symbol server")
+	}
+	dir := config.ProxyCacheDir
+	if c.IsSet("dir") {
+		dir = c.String("dir")
+	}
+	size := config.ProxyCacheSize
+	if c.IsSet("size") {
+		size = int64(c.Int("size"))
+	}
+	port := config.ProxyPort
+	if c.IsSet("port") {
+		n, err := strconv.ParseUint(c.String("port"), 10, 16)
+		if err != nil {
+			return fmt.Errorf("invalid port %s", c.String("port"))
+		}
+		port = uint(n)
+	}
+
+	address := config.ProxyAddress
+	if c.IsSet("address") {
+		address = c.String("address")
+	}
+
+	cache, err := proxy.NewCache(dir, size<<20)
+	if err != nil {
+		return err
+	}
+	serv := http.Server{
+		Addr: fmt.Sprintf("%s:%d", address, port),
+		Handler: &proxy.Server{
+			Cache:  cache,
+			Client: proxy.NewClient(upstreams),
+			Token:  config.ProxyToken,
+		},
+	}
+
+	go func() {
+		sigs := make(chan os.Signal, 1)
+		signal.Notify(sigs, os.Interrupt, os.Kill)
+		<-sigs
+		log.Info("[App] Receive terminate signal!")
+		serv.Shutdown(context.Background())
+	}()
+
+	log.Info("[App] Symbol cache listening %s, upstream %v.", serv.Addr, upstreams)
+	if err = serv.ListenAndServe(); err != http.ErrServerClosed {
+		return err
+	}
+	return nil
+}
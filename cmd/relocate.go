@@ -0,0 +1,49 @@
+package cmd
+
+import (
+	"encoding/json"
+	"os"
+
+	"github.com/adyzng/GoSymbols/symbol"
+	"github.com/urfave/cli"
+
+	log "gopkg.in/clog.v1"
+)
+
+// Relocate ...
+var Relocate = cli.Command{
+	Name:        "relocate",
+	Usage:       "Move all branches from one store root to another, eg: to a new server.",
+	Description: "Run with the server stopped after the stores are copied (start the read-only window with `POST /api/relocation/cutover` before copying). Store paths of branches under --from, branch.bin and file.ptr pointing to --from are rewritten to --to. Nothing is changed if a relocated store has no 000Admin, unless --force. Update DESTINATION in config.ini as reported.",
+	Action:      runRelocate,
+	Flags: []cli.Flag{
+		stringFlag("from", "", "The current store root, eg: D:\\SymbolServer."),
+		stringFlag("to", "", "The new store root, eg: \\\\symbols2\\SymbolServer."),
+		boolFlag("dry-run, n", "Only verify the new stores and count the references to rewrite."),
+		boolFlag("force", "Relocate even if some new stores are unreachable."),
+	},
+}
+
+func runRelocate(c *cli.Context) error {
+	ss := symbol.GetServer()
+	if err := ss.LoadBranchs(); err != nil {
+		return err
+	}
+
+	report, err := ss.Relocate(c.String("from"), c.String("to"), c.Bool("dry-run"), c.Bool("force"))
+	if report != nil {
+		enc := json.NewEncoder(os.Stdout)
+		enc.SetIndent("", "  ")
+		enc.Encode(report)
+	}
+	if err != nil {
+		return err
+	}
+	if !report.DryRun {
+		if err = ss.SaveBranchs(""); err != nil {
+			log.Warn("[App] Save branches failed: %v.", err)
+			return err
+		}
+	}
+	return nil
+}
@@ -0,0 +1,48 @@
+package cmd
+
+import (
+	"encoding/json"
+	"errors"
+	"os"
+
+	"github.com/adyzng/GoSymbols/symbol"
+	"github.com/urfave/cli"
+
+	log "gopkg.in/clog.v1"
+)
+
+// Repair ...
+var Repair = cli.Command{
+	Name:        "repair",
+	Usage:       "Rebuild malformed admin files of specified branch.",
+	Description: "Reconstruct server.txt and lastid.txt from the per-transaction files in 000Admin, and drop invalid lines of transaction files. Originals are kept in 000Admin/quarantine.",
+	Action:      runRepair,
+	Flags: []cli.Flag{
+		stringFlag("branch, b", "", "The branch name in the symbol store."),
+	},
+}
+
+func runRepair(c *cli.Context) error {
+	bname := c.String("branch")
+	if bname == "" {
+		return errors.New("empty branch name")
+	}
+
+	ss := symbol.GetServer()
+	if err := ss.LoadBranchs(); err != nil {
+		return err
+	}
+	builder, ok := ss.Get(bname).(*symbol.BrBuilder)
+	if !ok {
+		log.Warn("[App] Branch %s not exist.", bname)
+		return errors.New("branch not exist")
+	}
+
+	report, err := builder.Repair()
+	if err != nil {
+		return err
+	}
+	enc := json.NewEncoder(os.Stdout)
+	enc.SetIndent("", "  ")
+	return enc.Encode(report)
+}
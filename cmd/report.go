@@ -0,0 +1,55 @@
+package cmd
+
+import (
+	"io/ioutil"
+	"os"
+	"time"
+
+	"github.com/adyzng/GoSymbols/alert"
+	"github.com/adyzng/GoSymbols/report"
+	"github.com/adyzng/GoSymbols/symbol"
+	"github.com/urfave/cli"
+
+	log "gopkg.in/clog.v1"
+)
+
+// Report ...
+var Report = cli.Command{
+	Name:        "report",
+	Usage:       "Generate the symbol store summary report.",
+	Description: "Summarize builds ingested, failures, growth and missing builds per product group in html. The server send it weekly on [report] SCHEDULE.",
+	Action:      runReport,
+	Flags: []cli.Flag{
+		intFlag("days, d", 7, "Report period until now in days."),
+		stringFlag("output, o", "", "Write the html to file instead of stdout."),
+		boolFlag("send", "Send the report to alert sinks."),
+	},
+}
+
+func runReport(c *cli.Context) error {
+	ss := symbol.GetServer()
+	if err := ss.LoadBranchs(); err != nil {
+		return err
+	}
+
+	now := time.Now()
+	rp := report.Generate(now.AddDate(0, 0, -c.Int("days")), now)
+	if c.Bool("send") {
+		if err := rp.Deliver(); err != nil {
+			return err
+		}
+		alert.Wait()
+		log.Info("[App] Report sent.")
+		return nil
+	}
+
+	data, err := rp.HTML()
+	if err != nil {
+		return err
+	}
+	if out := c.String("output"); out != "" {
+		return ioutil.WriteFile(out, data, 0644)
+	}
+	_, err = os.Stdout.Write(data)
+	return err
+}
@@ -0,0 +1,60 @@
+package cmd
+
+import (
+	"encoding/json"
+	"errors"
+	"os"
+
+	"github.com/adyzng/GoSymbols/symbol"
+	"github.com/urfave/cli"
+
+	log "gopkg.in/clog.v1"
+)
+
+// Seal ...
+var Seal = cli.Command{
+	Name:        "seal",
+	Usage:       "Seal specified branch as immutable, or unseal it.",
+	Description: "A sealed branch refuses ingest, purge, merge and other changes of its store until unsealed, and is skipped by scheduled update. With --read-only all files of the store are also set read-only on disk.",
+	Action:      runSeal,
+	Flags: []cli.Flag{
+		stringFlag("branch, b", "", "The branch name in the symbol store."),
+		stringFlag("reason, r", "", "Why the branch is sealed, eg: legal hold."),
+		boolFlag("read-only", "Set files of the store read-only on disk."),
+		boolFlag("unseal", "Make the branch writable again."),
+	},
+}
+
+func runSeal(c *cli.Context) error {
+	bname := c.String("branch")
+	if bname == "" {
+		return errors.New("empty branch name")
+	}
+
+	ss := symbol.GetServer()
+	if err := ss.LoadBranchs(); err != nil {
+		return err
+	}
+	builder, ok := ss.Get(bname).(*symbol.BrBuilder)
+	if !ok {
+		log.Warn("[App] Branch %s not exist.", bname)
+		return errors.New("branch not exist")
+	}
+
+	if c.Bool("unseal") {
+		if err := builder.Unseal("cli"); err != nil {
+			return err
+		}
+		return ss.SaveBranchs("")
+	}
+	seal, err := builder.Seal("cli", c.String("reason"), c.Bool("read-only"))
+	if err != nil {
+		return err
+	}
+	if err = ss.SaveBranchs(""); err != nil {
+		return err
+	}
+	enc := json.NewEncoder(os.Stdout)
+	enc.SetIndent("", "  ")
+	return enc.Encode(seal)
+}
@@ -0,0 +1,36 @@
+package cmd
+
+import (
+	"encoding/json"
+	"os"
+
+	"github.com/adyzng/GoSymbols/symbol"
+	"github.com/urfave/cli"
+
+	log "gopkg.in/clog.v1"
+)
+
+// Snapshot ...
+var Snapshot = cli.Command{
+	Name:        "snapshot",
+	Usage:       "Write an consistent snapshot marker of the symbol store.",
+	Description: "Record the last transaction no. of every branch, for backup or rsync jobs. Use the /api/snapshot while server is running.",
+	Action:      runSnapshot,
+}
+
+func runSnapshot(c *cli.Context) error {
+	ss := symbol.GetServer()
+	if err := ss.LoadBranchs(); err != nil {
+		return err
+	}
+
+	marker, err := ss.Snapshot(0)
+	if err != nil {
+		return err
+	}
+	log.Info("[App] Snapshot %s.", marker.ID)
+
+	enc := json.NewEncoder(os.Stdout)
+	enc.SetIndent("", "  ")
+	return enc.Encode(marker)
+}
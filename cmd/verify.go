@@ -0,0 +1,54 @@
+package cmd
+
+import (
+	"encoding/json"
+	"errors"
+	"os"
+
+	"github.com/adyzng/GoSymbols/symbol"
+	"github.com/urfave/cli"
+
+	log "gopkg.in/clog.v1"
+)
+
+// Verify ...
+var Verify = cli.Command{
+	Name:        "verify",
+	Usage:       "Check admin files of specified branch against the signed integrity records.",
+	Description: "Recompute the hmac chain of 000Admin/integrity.txt with [integrity] KEY_FILE, and compare server.txt lines and transaction files with the signed ones. Exit with error if anything was changed out of GoSymbols.",
+	Action:      runVerify,
+	Flags: []cli.Flag{
+		stringFlag("branch, b", "", "The branch name in the symbol store."),
+	},
+}
+
+func runVerify(c *cli.Context) error {
+	bname := c.String("branch")
+	if bname == "" {
+		return errors.New("empty branch name")
+	}
+
+	ss := symbol.GetServer()
+	if err := ss.LoadBranchs(); err != nil {
+		return err
+	}
+	builder, ok := ss.Get(bname).(*symbol.BrBuilder)
+	if !ok {
+		log.Warn("[App] Branch %s not exist.", bname)
+		return errors.New("branch not exist")
+	}
+
+	report, err := builder.Verify()
+	if err != nil {
+		return err
+	}
+	enc := json.NewEncoder(os.Stdout)
+	enc.SetIndent("", "  ")
+	if err = enc.Encode(report); err != nil {
+		return err
+	}
+	if !report.OK() {
+		return errors.New("admin files tampered")
+	}
+	return nil
+}
@@ -9,8 +9,13 @@ import (
 	"sync"
 	"time"
 
+	"github.com/adyzng/GoSymbols/activity"
 	"github.com/adyzng/GoSymbols/config"
+	"github.com/adyzng/GoSymbols/event"
+	"github.com/adyzng/GoSymbols/federation"
+	"github.com/adyzng/GoSymbols/report"
 	"github.com/adyzng/GoSymbols/route"
+	"github.com/adyzng/GoSymbols/standby"
 	"github.com/adyzng/GoSymbols/symbol"
 	"github.com/urfave/cli"
 
@@ -41,14 +46,16 @@ func runWeb(c *cli.Context) error {
 	done := make(chan struct{}, 1)
 	serv := http.Server{
 		Addr:         fmt.Sprintf("%s:%d", config.Address, config.Port),
-		Handler:      route.NewRouter(),
+		Handler:      route.PrefixHandler(route.ZoneHandler(route.CorsHandler(route.NewRouter()))),
 		ReadTimeout:  time.Second * 15,
 		WriteTimeout: time.Second * 15,
+		ConnContext:  route.ConnContext,
+		ConnState:    route.ConnState,
 	}
 
 	log.Info("[App] Start %s ...", config.AppName)
 	var wg sync.WaitGroup
-	wg.Add(3)
+	wg.Add(8)
 
 	go func() {
 		defer wg.Done()
@@ -59,6 +66,26 @@ func runWeb(c *cli.Context) error {
 		defer wg.Done()
 		symbol.GetServer().Run(done)
 	}()
+	go func() {
+		defer wg.Done()
+		federation.Get().Run(done)
+	}()
+	go func() {
+		defer wg.Done()
+		standby.Get().Run(done)
+	}()
+	go func() {
+		defer wg.Done()
+		report.Run(done)
+	}()
+	go func() {
+		defer wg.Done()
+		activity.Run(done)
+	}()
+	go func() {
+		defer wg.Done()
+		event.Run(done)
+	}()
 	go func() {
 		defer wg.Done()
 		sigs := make(chan os.Signal, 1)
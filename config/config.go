@@ -2,6 +2,7 @@ package config
 
 import (
 	"fmt"
+	"net/url"
 	"os"
 	"os/exec"
 	"path/filepath"
@@ -18,9 +19,11 @@ var (
 	AppName   string
 	IsWindows bool
 
-	WebRoot string // website assets folder
-	Address string // website listen address
-	Port    uint   // website listen port
+	WebRoot  string // website assets folder
+	Address  string // website listen address
+	Port     uint   // website listen port
+	BaseURL  string // external url behind reverse proxy, eg: https://tools/symbols
+	BasePath string // path of BaseURL, eg: /symbols, empty if served at root
 
 	ClientID    string //
 	ClientKey   string //
@@ -28,14 +31,173 @@ var (
 	RedirectURI string
 	GraphScope  string
 
+	SessionIdleTimeout  int  // minutes a session without request live, 0 to disable
+	SessionRememberDays int  // lifetime of `remember me` sessions
+	SessionSecure       bool // send session cookies over https only
+
 	LogPath         string
-	SymStoreExe     string
+	SymStoreExe     string // symstore.exe path, empty or `native` to write stores without it
 	Destination     string // pdb server destination
 	BuildSource     string // pdb source folder
 	PDBZipFile      string // pdb zip file, default `debug.zip`
 	LatestBuildFile string // latest build trigger file `latestbuild.txt`
 	ScheduleTime    string // default trigger time in 24H, eg: 5:00 => 5:00AM
 	SymExcludeList  []string
+	ParseMode       string // strict or lenient when symstore admin files are malformed
+	StoreLayout     int    // 1 flat or 2 two-tier (index2.txt) for new stores
+	WarmupWorkers   int    // max branches parsed concurrently at startup
+	SharedStore     string // folder under Destination new branches share, empty for a folder per branch
+	MetadataDB      string // bbolt database of what is parsed from admin files, relative to app path, empty to parse them on every load
+	SymbolCache     int    // max symbol lines of parsed transactions kept in memory, least recently used builds are evicted
+
+	ScheduleBlackouts []string // `{days} HH:MM-HH:MM` windows scheduled updates are deferred out of
+	ScheduleInterval  int      // minutes between update cycles of all branches
+	SchedulePollers   int      // max branches whose build share is checked concurrently
+
+	IngestWorkers    int    // max concurrent AddBuild jobs
+	ConflictPolicy   string // reject, overwrite or keep-both when same key has different content
+	SplitFiles       int    // max symbol files of one symstore transaction, 0 to never split
+	SignTool         string // signtool.exe used to verify Authenticode signature of ingested binaries
+	ReadOnlyProbe    int    // seconds between writability checks of a store turned read-only
+	MakeCabExe       string // makecab.exe compressing stored files, eg: foo.pdb => foo.pd_, empty or `native` to compress without it
+	Compress         bool   // store ingested files compressed, the same as `symstore.exe add /compress`
+	SymStoreProcs    int    // max concurrent symstore.exe, 0 for unlimited
+	SymStorePriority string // normal, below-normal or idle cpu and io priority of symstore.exe and makecab.exe
+	RecompressRate   int    // MB read per second by recompression migration, 0 for unlimited
+	DedupDir         string // blob store on the volume of the stores, identical files are hard links to one blob, empty to disable
+	ShadowDir        string // staging stores of shadow ingests comparing the native writer with symstore.exe, empty to disable
+	CopyTimeout      int    // seconds the debug zip copy of an ingest may take, 0 for no limit
+	SymStoreTimeout  int    // seconds symstore of an ingest may take before it's killed, 0 for no limit
+
+	ScanMode     string // exec or icap to scan every ingested file, empty to disable
+	ScanCommand  string // exec scanner command line, `{file}` is replaced by the scanned file
+	ScanDetected []int  // exec scanner exit codes which mean detected, others than 0 are errors
+	ScanICAP     string // icap scanner service, eg: icap://av:1344/avscan
+	ScanTimeout  int    // seconds of one file scan
+	ScanFailOpen bool   // ingest files the scanner failed on instead of failing the ingest
+
+	ValidateMode   string // native or symchk to check pdbs before symstore, empty to disable
+	ValidateAction string // reject fails the ingest of a build with bad pdbs, flag ingests and alerts
+	SymChkExe      string // symchk.exe matching binaries to pdbs in symchk mode
+
+	AlertWebhook string // post alerts to this url
+	AuditFile    string // audit log of destructive operations, relative to app path
+
+	ActivityDir           string // hourly usage by user and client, relative to app path, empty to disable
+	ActivityRetentionDays int    // days hourly usage is kept
+	ActivitySlowKBps      int    // downloads below this KB/s are slow
+	ActivityMinTransferKB int    // smaller downloads are not measured for throughput
+
+	MetricsDiskInterval int // seconds between walking stores for the disk usage of /metrics
+
+	EventJournal     string // journal of store events delivered to buses, relative to app path, empty to disable
+	EventNATS        string // nats://[user:pass@]host:4222 publishing events to
+	EventNATSSubject string // subject prefix, events go to `{prefix}.{kind}`
+	EventKafkaREST   string // Kafka REST proxy publishing events to, eg: http://kafka-rest:8082
+	EventKafkaTopic  string // topic of events on Kafka
+
+	SrcSrvURL          string   // source server url template embedded in pdbs at ingest, empty to disable, see package sourceindex
+	SrcSrvRevision     string   // revision template, default `{version}`
+	SrcSrvRoots        []string // source roots on build machine mapped to the source server
+	SrcSrvTranslations []string // `{build path}={repository path}` prefixes translated before Roots
+	PdbStrExe          string   // pdbstr.exe writing srcsrv stream
+
+	DumpSymsExe string // dump_syms converting pdbs to Breakpad symbols at ingest, empty to disable
+
+	JiraURL      string   // Jira commented on when symbols of linked builds are published, empty to disable
+	JiraUser     string   // Jira account, basic auth with JiraToken
+	JiraToken    string   // Jira api token
+	JiraProjects []string // project keys of issue keys parsed from `changes` of build-info.json
+
+	ProxyUpstreams []string // central servers for local cache daemon
+	ProxyCacheDir  string   // local cache folder
+	ProxyCacheSize int64    // max cache size in MB
+	ProxyAddress   string   // listen address, 0.0.0.0 to act as shared upstream proxy
+	ProxyPort      uint     // local cache daemon listen port
+	ProxyToken     string   // bearer token of cache management api, loopback only if empty
+
+	FederationPeers   []string // backing GoSymbols servers, eg: http://symbols-sh:8080
+	FederationRefresh int      // seconds between refreshing branch list of peers
+
+	MetadataDriver  string   // postgres or mysql of MetadataDSN
+	MetadataDSN     string   // SQL database of metadata shared by servers, replaces MetadataDB, empty for none
+	MetadataReadDSN []string // read replicas of MetadataDSN serving heavy list requests
+	MetadataMaxLag  int      // seconds a replica may lag behind the primary and still be read
+
+	StandbyRole     string // primary or standby of StandbyPeer, empty to disable
+	StandbyPeer     string // the other instance, eg: http://symbols-dr:8080
+	StandbyInterval int    // seconds between metadata sync (standby) or fence checks (primary)
+	StandbyToken    string // shared secret of the pair, required by store file and fence api
+
+	NuGetUser       string // user of feeds requiring authentication, any for token only feeds
+	NuGetToken      string // api key or personal access token of feeds
+	NuGetTimeout    int    // seconds of each feed request
+	NuGetPrerelease bool   // ingest prerelease versions as the latest
+
+	HookSecret string   // secret of CI webhooks, signature of GitHub or `?secret=`, empty leave them to api auth
+	HookRules  []string // `{system}:{job glob}={branch}` mapping CI jobs to branches, see package cihook
+
+	ArchiveDir      string // archives can only be mounted from this folder
+	ArchiveMountDir string // folder to extract mounted archives
+
+	UploadDir     string // debug zips pushed over http wait here for ingest
+	UploadMaxSize int64  // MB of one upload, 0 for no limit
+
+	StorageMode         string // `disk`, or `memory` to keep branch list and stores in memory for tests
+	StorageS3Region     string // region of s3:// backends, AWS_REGION if empty
+	StorageS3Endpoint   string // S3 compatible endpoint, eg: MinIO, AWS if empty
+	StorageS3AccessKey  string // AWS_ACCESS_KEY_ID if empty
+	StorageS3SecretKey  string // AWS_SECRET_ACCESS_KEY if empty
+	StorageAzureKey     string // shared key of azblob:// account, AZURE_STORAGE_KEY if empty
+	StorageGCSAccessKey string // HMAC access key of gs:// backends
+	StorageGCSSecretKey string // HMAC secret of gs:// backends
+
+	RoutingSites          []string // `{site}:{cidr}|{cidr}`, client networks of each site
+	RoutingReplicas       []string // `{site}:{url}`, replica serving each site
+	RoutingTrustForwarded bool     // take client address from X-Forwarded-For
+
+	ServeExtensions []string // extensions of files served for download, others are refused and audited
+	ServeMiss       string   // 404, empty or message answered to file.ptr of symbols not found
+	ServeMissRules  []string // `ua:{substring}={mode}` or `path:{prefix}={mode}`, the first matching wins over ServeMiss
+
+	CorsBrowseOrigins     []string // origins allowed to call GET api, `*` for any without credentials
+	CorsBrowseMethods     []string // methods of browse group, default GET,HEAD
+	CorsBrowseCredentials bool     // allow cookies on cross-origin browse requests
+	CorsAdminOrigins      []string // origins allowed to call mutating api, empty to deny
+	CorsAdminMethods      []string // methods of admin group, default POST,PUT,DELETE
+	CorsAdminCredentials  bool     // allow cookies on cross-origin admin requests
+	CorsHeaders           []string // request headers allowed in preflight
+	CorsMaxAge            int      // seconds browsers cache preflight result
+	FrameAncestors        string   // `frame-ancestors` of web pages, who can embed the portal
+
+	AuthSymbols  []string // methods accepted by symbol downloads: anonymous, session, basic, token, ip
+	AuthBrowse   []string // methods accepted by GET api, empty leave it to the handlers
+	AuthAdmin    []string // methods accepted by mutating api, empty leave it to the handlers
+	AuthUsers    []string // `{user}:{bcrypt hash of password}` of basic auth, eg: `htpasswd -nbB`
+	AuthTokens   []string // tokens accepted in `?token=`, `/token/{token}/` path or bearer header
+	AuthAllowIPs []string // client networks in cidr, eg: build agents and debugger hosts
+
+	AuthBranchGroups []string // `{branch}:{group}|{group}`, symbols of the branch only served to these groups
+	AuthRoles        []string // `{user or group}:{role}` of viewer, uploader or admin, empty to leave api to the zones
+
+	LDAPURL    string // ldap:// or ldaps:// directory checking basic auth users not in `USERS`, eg: active directory
+	LDAPBind   string // bind name of user, `{user}` is replaced, eg: {user}@corp.example.com
+	LDAPBaseDN string // search base of user groups, eg: DC=corp,DC=example,DC=com
+	LDAPDomain string // netbios domain prefixed to users and groups, eg: CORP gives CORP\UDP-Devs
+
+	EncryptionKeyFile string // `{branch} = {hex key}` lines of encrypted branches, relative to app path
+	IntegrityKeyFile  string // hex hmac key signing admin metadata, relative to app path, empty to disable
+
+	ShareLatencyLimit int // ms, alert when reading build share is slower
+	ShareDownCycles   int // alert when build share is unreachable for this many update cycles
+
+	ReportSchedule string   // weekly report time, eg: Mon 08:00, empty to disable
+	ReportGroups   []string // product groups, eg: UDP:UDP*|D2D*
+
+	FaultTargets    []string // fetch, storage, symstore, network or all, empty to disable fault injection
+	FaultErrorRate  float64  // probability an operation on target fail
+	FaultLatency    int      // milliseconds added to each operation on target
+	FaultShortWrite float64  // probability a storage write is truncated
 )
 
 func init() {
@@ -88,9 +250,8 @@ func LoadConfig(files ...interface{}) error {
 	Debug, _ = base.Key("Debug").Bool()
 
 	SymStoreExe = base.Key("SYMSTORE_EXE").String()
-	if SymStoreExe == "" {
-		fmt.Println("[Config] SYMSTORE_EXE is missing.")
-		log.Fatal(2, "[Config] SYMSTORE_EXE is missing.")
+	if SymStoreExe == "" || strings.EqualFold(SymStoreExe, "native") {
+		log.Info("[Config] SYMSTORE_EXE not set, write symbol stores natively.")
 	}
 
 	Destination = base.Key("DESTINATION").String()
@@ -123,6 +284,349 @@ func LoadConfig(files ...interface{}) error {
 	for index, v := range SymExcludeList {
 		SymExcludeList[index] = strings.ToLower(v)
 	}
+	ParseMode = strings.ToLower(base.Key("PARSE_MODE").String())
+	if ParseMode != "strict" {
+		ParseMode = "lenient"
+	}
+	SharedStore = base.Key("SHARED_STORE").String()
+	StoreLayout, _ = base.Key("STORE_LAYOUT").Int()
+	if StoreLayout != 2 {
+		StoreLayout = 1
+	}
+	WarmupWorkers, _ = base.Key("WARMUP_WORKERS").Int()
+	if WarmupWorkers <= 0 {
+		WarmupWorkers = 4
+	}
+	MetadataDB = base.Key("METADATA_DB").String()
+	SymbolCache = 200000
+	if base.HasKey("SYMBOL_CACHE") {
+		SymbolCache, _ = base.Key("SYMBOL_CACHE").Int()
+	}
+
+	schedule := cfg.Section("schedule")
+	ScheduleBlackouts = schedule.Key("BLACKOUT").Strings(",")
+	ScheduleInterval, _ = schedule.Key("INTERVAL").Int()
+	if ScheduleInterval <= 0 {
+		ScheduleInterval = 120
+	}
+	SchedulePollers, _ = schedule.Key("POLLERS").Int()
+	if SchedulePollers <= 0 {
+		SchedulePollers = 8
+	}
+
+	ingest := cfg.Section("ingest")
+	IngestWorkers, _ = ingest.Key("WORKERS").Int()
+	if IngestWorkers <= 0 {
+		IngestWorkers = 2
+	}
+	ConflictPolicy = strings.ToLower(ingest.Key("CONFLICT_POLICY").String())
+	switch ConflictPolicy {
+	case "reject", "overwrite", "keep-both":
+	default:
+		ConflictPolicy = "keep-both"
+	}
+	SignTool = ingest.Key("SIGNTOOL").String()
+	SplitFiles, _ = ingest.Key("SPLIT_FILES").Int()
+	ReadOnlyProbe, _ = ingest.Key("READONLY_PROBE").Int()
+	if ReadOnlyProbe <= 0 {
+		ReadOnlyProbe = 30
+	}
+	MakeCabExe = ingest.Key("MAKECAB_EXE").String()
+	Compress, _ = ingest.Key("COMPRESS").Bool()
+	RecompressRate, _ = ingest.Key("RECOMPRESS_RATE").Int()
+	DedupDir = ingest.Key("DEDUP_DIR").String()
+	ShadowDir = ingest.Key("SHADOW_DIR").String()
+	CopyTimeout, _ = ingest.Key("COPY_TIMEOUT").Int()
+	SymStoreTimeout, _ = ingest.Key("SYMSTORE_TIMEOUT").Int()
+	SymStoreProcs = 1
+	if ingest.HasKey("SYMSTORE_PROCS") {
+		SymStoreProcs, _ = ingest.Key("SYMSTORE_PROCS").Int()
+	}
+	SymStorePriority = strings.ToLower(ingest.Key("SYMSTORE_PRIORITY").String())
+	switch SymStorePriority {
+	case "normal", "below-normal", "idle":
+	default:
+		SymStorePriority = "below-normal"
+	}
+
+	scan := cfg.Section("scan")
+	ScanMode = strings.ToLower(scan.Key("MODE").String())
+	switch ScanMode {
+	case "", "exec", "icap":
+	default:
+		log.Warn("[Config] Unknown scan mode %s, scanning disabled.", ScanMode)
+		ScanMode = ""
+	}
+	ScanCommand = scan.Key("COMMAND").String()
+	ScanDetected = scan.Key("DETECTED_EXIT").Ints(",")
+	if len(ScanDetected) == 0 {
+		ScanDetected = []int{1}
+	}
+	ScanICAP = scan.Key("ICAP").String()
+	ScanTimeout, _ = scan.Key("TIMEOUT").Int()
+	if ScanTimeout <= 0 {
+		ScanTimeout = 60
+	}
+	ScanFailOpen, _ = scan.Key("FAIL_OPEN").Bool()
+
+	validate := cfg.Section("validate")
+	ValidateMode = strings.ToLower(validate.Key("MODE").String())
+	switch ValidateMode {
+	case "", "native", "symchk":
+	default:
+		log.Warn("[Config] Unknown validate mode %s, validation disabled.", ValidateMode)
+		ValidateMode = ""
+	}
+	ValidateAction = strings.ToLower(validate.Key("ACTION").String())
+	if ValidateAction != "reject" {
+		ValidateAction = "flag"
+	}
+	SymChkExe = validate.Key("SYMCHK").String()
+	if SymChkExe == "" {
+		SymChkExe = "symchk.exe"
+	}
+
+	AlertWebhook = cfg.Section("alert").Key("WEBHOOK").String()
+	AuditFile = cfg.Section("audit").Key("FILE").String()
+	if AuditFile == "" {
+		AuditFile = "audit.log"
+	}
+
+	activity := cfg.Section("activity")
+	ActivityDir = "usage"
+	if activity.HasKey("DIR") {
+		ActivityDir = activity.Key("DIR").String()
+	}
+	ActivityRetentionDays, _ = activity.Key("RETENTION_DAYS").Int()
+	if ActivityRetentionDays <= 0 {
+		ActivityRetentionDays = 90
+	}
+	ActivitySlowKBps, _ = activity.Key("SLOW_KBPS").Int()
+	if ActivitySlowKBps <= 0 {
+		ActivitySlowKBps = 512
+	}
+	ActivityMinTransferKB, _ = activity.Key("MIN_TRANSFER_KB").Int()
+	if ActivityMinTransferKB <= 0 {
+		ActivityMinTransferKB = 256
+	}
+
+	MetricsDiskInterval, _ = cfg.Section("metrics").Key("DISK_INTERVAL").Int()
+	if MetricsDiskInterval <= 0 {
+		MetricsDiskInterval = 600
+	}
+
+	events := cfg.Section("events")
+	EventJournal = events.Key("JOURNAL").String()
+	EventNATS = events.Key("NATS_URL").String()
+	EventNATSSubject = events.Key("NATS_SUBJECT").String()
+	if EventNATSSubject == "" {
+		EventNATSSubject = "gosymbols"
+	}
+	EventKafkaREST = events.Key("KAFKA_REST").String()
+	EventKafkaTopic = events.Key("KAFKA_TOPIC").String()
+	if EventKafkaTopic == "" {
+		EventKafkaTopic = "gosymbols-events"
+	}
+
+	srcsrv := cfg.Section("srcsrv")
+	SrcSrvURL = srcsrv.Key("URL").String()
+	SrcSrvRevision = srcsrv.Key("REVISION").String()
+	SrcSrvRoots = srcsrv.Key("ROOTS").Strings(",")
+	SrcSrvTranslations = srcsrv.Key("TRANSLATIONS").Strings(",")
+	PdbStrExe = srcsrv.Key("PDBSTR_EXE").String()
+	if PdbStrExe == "" {
+		PdbStrExe = "pdbstr.exe"
+	}
+
+	DumpSymsExe = cfg.Section("breakpad").Key("DUMP_SYMS").String()
+
+	jira := cfg.Section("jira")
+	JiraURL = strings.TrimRight(jira.Key("URL").String(), "/")
+	JiraUser = jira.Key("USER").String()
+	JiraToken = jira.Key("TOKEN").String()
+	JiraProjects = jira.Key("PROJECTS").Strings(",")
+
+	proxy := cfg.Section("proxy")
+	ProxyUpstreams = proxy.Key("UPSTREAM").Strings(",")
+	ProxyCacheDir = proxy.Key("CACHE_DIR").String()
+	if ProxyCacheDir == "" {
+		ProxyCacheDir = "symcache"
+	}
+	ProxyCacheSize, _ = proxy.Key("CACHE_SIZE").Int64()
+	if ProxyCacheSize <= 0 {
+		ProxyCacheSize = 10240
+	}
+	ProxyAddress = proxy.Key("ADDRESS").String()
+	if ProxyAddress == "" {
+		ProxyAddress = "127.0.0.1"
+	}
+	ProxyPort, _ = proxy.Key("PORT").Uint()
+	if ProxyPort == 0 {
+		ProxyPort = 8090
+	}
+	ProxyToken = proxy.Key("TOKEN").String()
+
+	federation := cfg.Section("federation")
+	FederationPeers = federation.Key("PEERS").Strings(",")
+	FederationRefresh, _ = federation.Key("REFRESH").Int()
+	if FederationRefresh <= 0 {
+		FederationRefresh = 60
+	}
+
+	metadata := cfg.Section("metadata")
+	MetadataDriver = strings.ToLower(metadata.Key("DRIVER").String())
+	MetadataDSN = metadata.Key("DSN").String()
+	MetadataReadDSN = metadata.Key("READ_DSN").Strings(",")
+	MetadataMaxLag, _ = metadata.Key("MAX_LAG").Int()
+	if MetadataMaxLag <= 0 {
+		MetadataMaxLag = 10
+	}
+
+	standby := cfg.Section("standby")
+	StandbyRole = strings.ToLower(standby.Key("ROLE").String())
+	switch StandbyRole {
+	case "", "primary", "standby":
+	default:
+		log.Warn("[Config] Invalid standby ROLE %s, disabled.", StandbyRole)
+		StandbyRole = ""
+	}
+	StandbyPeer = strings.TrimRight(standby.Key("PEER").String(), "/")
+	StandbyInterval, _ = standby.Key("INTERVAL").Int()
+	if StandbyInterval <= 0 {
+		StandbyInterval = 60
+	}
+	StandbyToken = standby.Key("TOKEN").String()
+
+	nuget := cfg.Section("nuget")
+	NuGetUser = nuget.Key("USER").String()
+	NuGetToken = nuget.Key("TOKEN").String()
+	NuGetTimeout, _ = nuget.Key("TIMEOUT").Int()
+	if NuGetTimeout <= 0 {
+		NuGetTimeout = 300
+	}
+	NuGetPrerelease, _ = nuget.Key("PRERELEASE").Bool()
+
+	hooks := cfg.Section("hooks")
+	HookSecret = hooks.Key("SECRET").String()
+	HookRules = hooks.Key("RULES").Strings(",")
+
+	ArchiveDir = cfg.Section("archive").Key("DIR").String()
+	if ArchiveDir == "" {
+		ArchiveDir = "archives"
+	}
+	ArchiveMountDir = cfg.Section("archive").Key("MOUNT_DIR").String()
+	if ArchiveMountDir == "" {
+		ArchiveMountDir = "mounts"
+	}
+
+	upload := cfg.Section("upload")
+	UploadDir = upload.Key("DIR").String()
+	if UploadDir == "" {
+		UploadDir = "uploads"
+	}
+	UploadMaxSize, _ = upload.Key("MAX_SIZE").Int64()
+
+	storage := cfg.Section("storage")
+	StorageMode = strings.ToLower(storage.Key("MODE").String())
+	switch StorageMode {
+	case "disk", "memory":
+	default:
+		StorageMode = "disk"
+	}
+	StorageS3Region = storage.Key("S3_REGION").String()
+	StorageS3Endpoint = storage.Key("S3_ENDPOINT").String()
+	StorageS3AccessKey = storage.Key("S3_ACCESS_KEY").String()
+	StorageS3SecretKey = storage.Key("S3_SECRET_KEY").String()
+	StorageAzureKey = storage.Key("AZURE_KEY").String()
+	StorageGCSAccessKey = storage.Key("GCS_ACCESS_KEY").String()
+	StorageGCSSecretKey = storage.Key("GCS_SECRET_KEY").String()
+
+	routing := cfg.Section("routing")
+	RoutingSites = routing.Key("SITES").Strings(",")
+	RoutingReplicas = routing.Key("REPLICAS").Strings(",")
+	RoutingTrustForwarded, _ = routing.Key("TRUST_FORWARDED").Bool()
+
+	ServeExtensions = nil
+	for _, ext := range cfg.Section("serve").Key("EXTENSIONS").Strings(",") {
+		if ext = strings.ToLower(ext); ext != "" && !strings.HasPrefix(ext, ".") {
+			ext = "." + ext
+		}
+		ServeExtensions = append(ServeExtensions, ext)
+	}
+	if len(ServeExtensions) == 0 {
+		ServeExtensions = []string{".pdb", ".dll", ".exe", ".sys", ".ocx", ".drv", ".sym", ".dbg",
+			".pd_", ".dl_", ".ex_", ".sy_", ".oc_", ".dr_", ".db_"}
+	}
+	ServeMiss = strings.ToLower(cfg.Section("serve").Key("MISS").String())
+	switch ServeMiss {
+	case "404", "empty", "message":
+	default:
+		ServeMiss = "404"
+	}
+	ServeMissRules = cfg.Section("serve").Key("MISS_RULES").Strings(",")
+
+	cors := cfg.Section("cors")
+	CorsBrowseOrigins = cors.Key("BROWSE_ORIGINS").Strings(",")
+	CorsBrowseMethods = cors.Key("BROWSE_METHODS").Strings(",")
+	if len(CorsBrowseMethods) == 0 {
+		CorsBrowseMethods = []string{"GET", "HEAD"}
+	}
+	CorsBrowseCredentials, _ = cors.Key("BROWSE_CREDENTIALS").Bool()
+	CorsAdminOrigins = cors.Key("ADMIN_ORIGINS").Strings(",")
+	CorsAdminMethods = cors.Key("ADMIN_METHODS").Strings(",")
+	if len(CorsAdminMethods) == 0 {
+		CorsAdminMethods = []string{"POST", "PUT", "DELETE"}
+	}
+	CorsAdminCredentials, _ = cors.Key("ADMIN_CREDENTIALS").Bool()
+	CorsHeaders = cors.Key("HEADERS").Strings(",")
+	if len(CorsHeaders) == 0 {
+		CorsHeaders = []string{"Content-Type"}
+	}
+	CorsMaxAge, _ = cors.Key("MAX_AGE").Int()
+	if CorsMaxAge <= 0 {
+		CorsMaxAge = 600
+	}
+	FrameAncestors = cors.Key("FRAME_ANCESTORS").String()
+	if FrameAncestors == "" {
+		FrameAncestors = "'self'"
+	}
+
+	authSec := cfg.Section("auth")
+	AuthSymbols = authSec.Key("SYMBOLS").Strings(",")
+	AuthBrowse = authSec.Key("BROWSE").Strings(",")
+	AuthAdmin = authSec.Key("ADMIN").Strings(",")
+	AuthUsers = authSec.Key("USERS").Strings(",")
+	AuthTokens = authSec.Key("TOKENS").Strings(",")
+	AuthAllowIPs = authSec.Key("ALLOW_IPS").Strings(",")
+	AuthBranchGroups = authSec.Key("BRANCH_GROUPS").Strings(",")
+	AuthRoles = authSec.Key("ROLES").Strings(",")
+	LDAPURL = authSec.Key("LDAP_URL").String()
+	LDAPBind = authSec.Key("LDAP_BIND").String()
+	LDAPBaseDN = authSec.Key("LDAP_BASE_DN").String()
+	LDAPDomain = authSec.Key("LDAP_DOMAIN").String()
+
+	EncryptionKeyFile = cfg.Section("encryption").Key("KEY_FILE").String()
+	IntegrityKeyFile = cfg.Section("integrity").Key("KEY_FILE").String()
+
+	share := cfg.Section("share")
+	ShareLatencyLimit, _ = share.Key("LATENCY_LIMIT").Int()
+	ShareDownCycles, _ = share.Key("DOWN_CYCLES").Int()
+	if ShareDownCycles <= 0 {
+		ShareDownCycles = 3
+	}
+
+	report := cfg.Section("report")
+	ReportSchedule = report.Key("SCHEDULE").String()
+	ReportGroups = report.Key("GROUPS").Strings(",")
+
+	fault := cfg.Section("fault")
+	FaultTargets = fault.Key("TARGETS").Strings(",")
+	FaultErrorRate, _ = fault.Key("ERROR_RATE").Float64()
+	FaultLatency, _ = fault.Key("LATENCY").Int()
+	FaultShortWrite, _ = fault.Key("SHORT_WRITE").Float64()
+	if len(FaultTargets) != 0 {
+		log.Warn("[Config] Fault injection enabled on %v, error rate %.2f.", FaultTargets, FaultErrorRate)
+	}
 
 	appSec := cfg.Section("app")
 	ClientID = appSec.Key("CLIENT_ID").String()
@@ -130,6 +634,17 @@ func LoadConfig(files ...interface{}) error {
 	GraphScope = appSec.Key("GRAPH_SCOPE").String()
 	RedirectURI = appSec.Key("REDIRECT_URI").String()
 
+	sess := cfg.Section("session")
+	SessionIdleTimeout, _ = sess.Key("IDLE_TIMEOUT").Int()
+	if SessionIdleTimeout < 0 {
+		SessionIdleTimeout = 0
+	}
+	SessionRememberDays, _ = sess.Key("REMEMBER_DAYS").Int()
+	if SessionRememberDays <= 0 {
+		SessionRememberDays = 14
+	}
+	SessionSecure, _ = sess.Key("SECURE_COOKIE").Bool()
+
 	web := cfg.Section("web")
 	Address = web.Key("ADDRESS").String()
 	WebRoot = web.Key("WEB_ROOT").String()
@@ -140,10 +655,34 @@ func LoadConfig(files ...interface{}) error {
 	if Port == 0 {
 		Port = 8080
 	}
+	BaseURL = strings.TrimRight(web.Key("BASE_URL").String(), "/")
+	BasePath = ""
+	if u, err := url.Parse(BaseURL); err == nil {
+		BasePath = strings.TrimRight(u.Path, "/")
+	} else {
+		log.Warn("[Config] Invalid BASE_URL %s: %v.", BaseURL, err)
+		BaseURL = ""
+	}
 
 	return nil
 }
 
+// URL return `path` under BasePath, used for redirects and links of the web site.
+//
+func URL(path string) string {
+	return BasePath + path
+}
+
+// ExternalURL return absolute url of `path` by BaseURL, or URL(path) if BaseURL not set.
+// Links returned to api clients use it.
+//
+func ExternalURL(path string) string {
+	if BaseURL == "" {
+		return URL(path)
+	}
+	return BaseURL + path
+}
+
 // GetTriggerTime ...
 //
 func GetTriggerTime() (hour, min int) {
@@ -0,0 +1,21 @@
+package config
+
+import (
+	"testing"
+)
+
+func TestExternalURL(t *testing.T) {
+	defer func(u, p string) { BaseURL, BasePath = u, p }(BaseURL, BasePath)
+
+	BaseURL, BasePath = "", ""
+	if u := ExternalURL("/p/abc"); u != "/p/abc" {
+		t.Errorf("expect /p/abc, got %s", u)
+	}
+	BaseURL, BasePath = "https://tools/symbols", "/symbols"
+	if u := URL("/"); u != "/symbols/" {
+		t.Errorf("expect /symbols/, got %s", u)
+	}
+	if u := ExternalURL("/p/abc"); u != "https://tools/symbols/p/abc" {
+		t.Errorf("expect https://tools/symbols/p/abc, got %s", u)
+	}
+}
@@ -0,0 +1,349 @@
+// Package encrypt seal symbol files at rest with AES-GCM. Files are split in chunks which are
+// sealed separately, so an encrypted file can still be read at any offset to serve Range
+// requests, and a truncated or reordered file fails to decrypt.
+//
+package encrypt
+
+import (
+	"bufio"
+	"bytes"
+	"crypto/aes"
+	"crypto/cipher"
+	"crypto/rand"
+	"encoding/binary"
+	"encoding/hex"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"strings"
+
+	"github.com/adyzng/GoSymbols/config"
+)
+
+const (
+	chunkSize  = 64 << 10
+	headerSize = 16 // magic + nonce prefix
+	prefixSize = 8
+	tagSize    = 16 // GCM tag of each chunk
+)
+
+var (
+	magic = []byte("GSYMENC1")
+)
+
+var (
+	ErrNoKey   = fmt.Errorf("encryption key not found")
+	ErrBadKey  = fmt.Errorf("encryption key must be 32 bytes in hex")
+	ErrCorrupt = fmt.Errorf("encrypted file corrupt or key mismatch")
+)
+
+// KeyProvider return the 32 bytes AES key of a branch, by store name.
+//
+type KeyProvider interface {
+	Key(branch string) ([]byte, error)
+}
+
+// Keys is the secrets provider of branch keys, replace it to fetch keys from a vault.
+var Keys KeyProvider = fileKeys{}
+
+// fileKeys read keys from `[encryption] KEY_FILE`, one `{branch} = {hex key}` per line
+type fileKeys struct{}
+
+func (fileKeys) Key(branch string) ([]byte, error) {
+	fpath := config.EncryptionKeyFile
+	if fpath == "" {
+		return nil, ErrNoKey
+	}
+	if !filepath.IsAbs(fpath) {
+		fpath = filepath.Join(config.AppPath, fpath)
+	}
+	fd, err := os.Open(fpath)
+	if err != nil {
+		return nil, err
+	}
+	defer fd.Close()
+
+	scan := bufio.NewScanner(fd)
+	for scan.Scan() {
+		line := strings.TrimSpace(scan.Text())
+		if line == "" || strings.HasPrefix(line, "#") {
+			continue
+		}
+		kv := strings.SplitN(line, "=", 2)
+		if len(kv) != 2 || !strings.EqualFold(strings.TrimSpace(kv[0]), branch) {
+			continue
+		}
+		key, err := hex.DecodeString(strings.TrimSpace(kv[1]))
+		if err != nil || len(key) != 32 {
+			return nil, ErrBadKey
+		}
+		return key, nil
+	}
+	if err = scan.Err(); err != nil {
+		return nil, err
+	}
+	return nil, ErrNoKey
+}
+
+func newAEAD(key []byte) (cipher.AEAD, error) {
+	if len(key) != 32 {
+		return nil, ErrBadKey
+	}
+	block, err := aes.NewCipher(key)
+	if err != nil {
+		return nil, err
+	}
+	return cipher.NewGCM(block)
+}
+
+// nonce of chunk `index`, the last chunk is also bound by additional data so truncation is detected
+func chunkNonce(prefix []byte, index uint32) []byte {
+	nonce := make([]byte, 12)
+	copy(nonce, prefix)
+	binary.BigEndian.PutUint32(nonce[prefixSize:], index)
+	return nonce
+}
+
+func chunkAD(last bool) []byte {
+	if last {
+		return []byte{1}
+	}
+	return []byte{0}
+}
+
+// IsEncrypted check if the file is written by Encrypt
+//
+func IsEncrypted(fpath string) bool {
+	fd, err := os.Open(fpath)
+	if err != nil {
+		return false
+	}
+	defer fd.Close()
+	return IsSealed(bufio.NewReader(fd))
+}
+
+// IsSealed check if content of `r` is written by Encrypt, nothing is consumed.
+//
+func IsSealed(r *bufio.Reader) bool {
+	head, err := r.Peek(len(magic))
+	return err == nil && bytes.Equal(head, magic)
+}
+
+// SealedSize return the size Encrypt write for `size` bytes of plain content.
+//
+func SealedSize(size int64) int64 {
+	chunks := (size + chunkSize - 1) / chunkSize
+	if chunks == 0 {
+		// empty content is still sealed in one chunk
+		chunks = 1
+	}
+	return headerSize + size + chunks*tagSize
+}
+
+// Encrypt write `r` to `w` sealed by `key`.
+//
+func Encrypt(w io.Writer, r io.Reader, key []byte) error {
+	aead, err := newAEAD(key)
+	if err != nil {
+		return err
+	}
+	prefix := make([]byte, prefixSize)
+	if _, err = rand.Read(prefix); err != nil {
+		return err
+	}
+	if _, err = w.Write(append(append([]byte{}, magic...), prefix...)); err != nil {
+		return err
+	}
+
+	// read one chunk ahead to know which one is the last
+	cur, next := make([]byte, chunkSize), make([]byte, chunkSize)
+	n, err := io.ReadFull(r, cur)
+	if err != nil && err != io.EOF && err != io.ErrUnexpectedEOF {
+		return err
+	}
+	var out []byte
+	for index := uint32(0); ; index++ {
+		m := 0
+		if n == chunkSize {
+			if m, err = io.ReadFull(r, next); err != nil && err != io.EOF && err != io.ErrUnexpectedEOF {
+				return err
+			}
+		}
+		last := m == 0
+		out = aead.Seal(out[:0], chunkNonce(prefix, index), cur[:n], chunkAD(last))
+		if _, err = w.Write(out); err != nil {
+			return err
+		}
+		if last {
+			return nil
+		}
+		cur, next, n = next, cur, m
+	}
+}
+
+// EncryptFile replace the file by its encrypted content, an already encrypted file is kept.
+//
+func EncryptFile(fpath string, key []byte) error {
+	if IsEncrypted(fpath) {
+		return nil
+	}
+	fs, err := os.Open(fpath)
+	if err != nil {
+		return err
+	}
+	defer fs.Close()
+	st, err := fs.Stat()
+	if err != nil {
+		return err
+	}
+
+	tmp := fpath + ".enc"
+	fd, err := os.OpenFile(tmp, os.O_WRONLY|os.O_CREATE|os.O_TRUNC, st.Mode().Perm())
+	if err != nil {
+		return err
+	}
+	w := bufio.NewWriter(fd)
+	if err = Encrypt(w, fs, key); err == nil {
+		err = w.Flush()
+	}
+	if e := fd.Close(); err == nil {
+		err = e
+	}
+	if err != nil {
+		os.Remove(tmp)
+		return err
+	}
+	fs.Close()
+	os.Chtimes(tmp, st.ModTime(), st.ModTime())
+	return os.Rename(tmp, fpath)
+}
+
+// File is an encrypted file opened for reading plain content at any offset.
+//
+type File struct {
+	fd     *os.File
+	aead   cipher.AEAD
+	prefix []byte
+	size   int64  // plain size
+	chunks uint32 // count of chunks
+	pos    int64
+	index  int64 // decrypted chunk in buf, -1 if none
+	buf    []byte
+}
+
+// Open an encrypted file with `key`.
+//
+func Open(fpath string, key []byte) (*File, error) {
+	aead, err := newAEAD(key)
+	if err != nil {
+		return nil, err
+	}
+	fd, err := os.Open(fpath)
+	if err != nil {
+		return nil, err
+	}
+	st, err := fd.Stat()
+	if err != nil {
+		fd.Close()
+		return nil, err
+	}
+	head := make([]byte, headerSize)
+	if _, err = io.ReadFull(fd, head); err != nil || !bytes.Equal(head[:len(magic)], magic) {
+		fd.Close()
+		return nil, ErrCorrupt
+	}
+
+	sealed := int64(chunkSize + aead.Overhead())
+	body := st.Size() - headerSize
+	full, rem := body/sealed, body%sealed
+	f := &File{
+		fd:     fd,
+		aead:   aead,
+		prefix: head[len(magic):],
+		size:   full * chunkSize,
+		chunks: uint32(full),
+		index:  -1,
+	}
+	if rem > 0 {
+		if rem < int64(aead.Overhead()) {
+			fd.Close()
+			return nil, ErrCorrupt
+		}
+		f.size += rem - int64(aead.Overhead())
+		f.chunks++
+	}
+	if f.chunks == 0 {
+		fd.Close()
+		return nil, ErrCorrupt
+	}
+	return f, nil
+}
+
+// Size of the plain content
+func (f *File) Size() int64 {
+	return f.size
+}
+
+func (f *File) load(index int64) error {
+	if index == f.index {
+		return nil
+	}
+	sealed := int64(chunkSize + f.aead.Overhead())
+	data := make([]byte, sealed)
+	n, err := f.fd.ReadAt(data, headerSize+index*sealed)
+	if err != nil && err != io.EOF {
+		return err
+	}
+	last := uint32(index) == f.chunks-1
+	buf, err := f.aead.Open(f.buf[:0], chunkNonce(f.prefix, uint32(index)), data[:n], chunkAD(last))
+	if err != nil {
+		f.index = -1
+		return ErrCorrupt
+	}
+	f.buf, f.index = buf, index
+	return nil
+}
+
+// Read implement io.Reader
+func (f *File) Read(p []byte) (int, error) {
+	if f.pos >= f.size {
+		if f.size == 0 {
+			// authenticate the empty chunk, an empty file is never trusted without it
+			if err := f.load(0); err != nil {
+				return 0, err
+			}
+		}
+		return 0, io.EOF
+	}
+	index := f.pos / chunkSize
+	if err := f.load(index); err != nil {
+		return 0, err
+	}
+	n := copy(p, f.buf[f.pos-index*chunkSize:])
+	f.pos += int64(n)
+	return n, nil
+}
+
+// Seek implement io.Seeker
+func (f *File) Seek(offset int64, whence int) (int64, error) {
+	switch whence {
+	case io.SeekStart:
+	case io.SeekCurrent:
+		offset += f.pos
+	case io.SeekEnd:
+		offset += f.size
+	default:
+		return f.pos, fmt.Errorf("invalid whence %d", whence)
+	}
+	if offset < 0 {
+		return f.pos, fmt.Errorf("negative position %d", offset)
+	}
+	f.pos = offset
+	return f.pos, nil
+}
+
+// Close the underlying file
+func (f *File) Close() error {
+	return f.fd.Close()
+}
@@ -0,0 +1,97 @@
+package encrypt
+
+import (
+	"bytes"
+	"io"
+	"io/ioutil"
+	"math/rand"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/adyzng/GoSymbols/config"
+)
+
+func TestEncryptFile(t *testing.T) {
+	root, err := ioutil.TempDir("", "encrypt")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(root)
+	key := bytes.Repeat([]byte{7}, 32)
+
+	for _, size := range []int{0, 1, chunkSize, chunkSize*2 + 100} {
+		plain := make([]byte, size)
+		rand.Read(plain)
+		fpath := filepath.Join(root, "foo.pdb")
+		ioutil.WriteFile(fpath, plain, 0644)
+
+		if err = EncryptFile(fpath, key); err != nil || !IsEncrypted(fpath) {
+			t.Fatalf("encrypt %d bytes failed: %v", size, err)
+		}
+		sealed, _ := ioutil.ReadFile(fpath)
+		EncryptFile(fpath, key)
+		if again, _ := ioutil.ReadFile(fpath); !bytes.Equal(sealed, again) {
+			t.Fatal("expect encrypted file kept")
+		}
+
+		f, err := Open(fpath, key)
+		if err != nil || f.Size() != int64(size) {
+			t.Fatalf("open %d bytes failed: %v", size, err)
+		}
+		data, err := ioutil.ReadAll(f)
+		if err != nil || !bytes.Equal(data, plain) {
+			t.Fatalf("decrypt %d bytes mismatch: %v", size, err)
+		}
+		if size > chunkSize {
+			f.Seek(chunkSize-10, io.SeekStart)
+			part := make([]byte, 20)
+			if _, err = io.ReadFull(f, part); err != nil || !bytes.Equal(part, plain[chunkSize-10:chunkSize+10]) {
+				t.Fatalf("read across chunks mismatch: %v", err)
+			}
+		}
+		f.Close()
+
+		// truncated at chunk boundary or wrong key never decrypt
+		if size > chunkSize {
+			ioutil.WriteFile(fpath, sealed[:headerSize+chunkSize+16], 0644)
+			if f, err = Open(fpath, key); err == nil {
+				_, err = ioutil.ReadAll(f)
+				f.Close()
+			}
+			if err != ErrCorrupt {
+				t.Fatalf("expect truncated file detected, got %v", err)
+			}
+		}
+		ioutil.WriteFile(fpath, sealed, 0644)
+		if f, err = Open(fpath, bytes.Repeat([]byte{8}, 32)); err == nil {
+			_, err = ioutil.ReadAll(f)
+			f.Close()
+		}
+		if err != ErrCorrupt {
+			t.Fatalf("expect wrong key refused, got %v", err)
+		}
+	}
+}
+
+func TestFileKeys(t *testing.T) {
+	root, err := ioutil.TempDir("", "keys")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(root)
+	defer func(file string) { config.EncryptionKeyFile = file }(config.EncryptionKeyFile)
+	config.EncryptionKeyFile = filepath.Join(root, "branch.keys")
+
+	ioutil.WriteFile(config.EncryptionKeyFile, []byte("# keys\r\nUDPv6.5 = "+strings.Repeat("ab", 32)+"\r\nShort = abcd\r\n"), 0600)
+	if key, err := Keys.Key("udpv6.5"); err != nil || len(key) != 32 || key[0] != 0xab {
+		t.Fatalf("unexpected key %x (%v)", key, err)
+	}
+	if _, err = Keys.Key("Short"); err != ErrBadKey {
+		t.Fatalf("expect bad key, got %v", err)
+	}
+	if _, err = Keys.Key("Other"); err != ErrNoKey {
+		t.Fatalf("expect no key, got %v", err)
+	}
+}
@@ -0,0 +1,334 @@
+// Package event publish store events to message buses, so downstream systems (crash pipeline,
+// data lake) subscribe instead of polling. Events are appended to a journal before anything
+// is sent, and delivered to each bus from its own cursor, so they are delivered at least once
+// and can be replayed by moving the cursor back. Consumers dedupe by `seq`.
+//
+package event
+
+import (
+	"bufio"
+	"encoding/json"
+	"fmt"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"sort"
+	"sync"
+	"time"
+
+	"github.com/adyzng/GoSymbols/config"
+	log "gopkg.in/clog.v1"
+)
+
+// Event kinds
+const (
+	KindIngestComplete = "ingest-complete"
+	KindBuildDeleted   = "build-deleted"
+	KindVerifyFailed   = "verification-failure"
+	KindTicketLinked   = "ticket-linked"
+)
+
+const (
+	batchSize     = 100
+	retryInterval = time.Second * 30
+)
+
+var (
+	ErrDisabled   = fmt.Errorf("event journal not configured")
+	ErrUnknownBus = fmt.Errorf("unknown event bus")
+)
+
+// Event is one store event
+//
+type Event struct {
+	Seq     uint64   `json:"seq"` // increasing number in journal, the replay cursor
+	Time    string   `json:"time"`
+	Kind    string   `json:"kind"`
+	Branch  string   `json:"branch"`
+	Build   string   `json:"build,omitempty"` // transaction ID
+	Version string   `json:"version,omitempty"`
+	Message string   `json:"message,omitempty"`
+	Tickets []string `json:"tickets,omitempty"` // Jira issue keys linked to the build
+}
+
+// Bus deliver events to a message bus
+//
+type Bus interface {
+	// Name of the bus, key of its cursor
+	Name() string
+	// Publish events in order, return nil only when the bus accepted all of them
+	Publish(events []*Event) error
+}
+
+var (
+	mx      sync.Mutex
+	once    sync.Once
+	lastSeq uint64
+	buses   []Bus
+	wake    = make(chan struct{}, 1)
+)
+
+func setup() {
+	if config.EventNATS != "" {
+		Register(&NATS{URL: config.EventNATS, Subject: config.EventNATSSubject})
+	}
+	if config.EventKafkaREST != "" {
+		Register(&Kafka{URL: config.EventKafkaREST, Topic: config.EventKafkaTopic})
+	}
+	if config.JiraURL != "" {
+		Register(&Jira{URL: config.JiraURL, User: config.JiraUser, Token: config.JiraToken})
+	}
+}
+
+func journalFile() string {
+	if config.EventJournal == "" || filepath.IsAbs(config.EventJournal) {
+		return config.EventJournal
+	}
+	return filepath.Join(config.AppPath, config.EventJournal)
+}
+
+// cursorFile keep the delivered seq of each bus, `{bus name}` => seq
+func cursorFile() string {
+	return journalFile() + ".cursor"
+}
+
+// Register add a bus, journaled events after its cursor are delivered to it.
+//
+func Register(b Bus) {
+	mx.Lock()
+	buses = append(buses, b)
+	mx.Unlock()
+	log.Info("[Event] Register bus %s.", b.Name())
+	notify()
+}
+
+func notify() {
+	select {
+	case wake <- struct{}{}:
+	default:
+	}
+}
+
+// Publish append event `e` to journal with the next seq, and wake the delivery. The event
+// is dropped if `[events] JOURNAL` is empty.
+//
+func Publish(e *Event) error {
+	fpath := journalFile()
+	if fpath == "" {
+		return ErrDisabled
+	}
+	if e.Time == "" {
+		e.Time = time.Now().Format("2006-01-02 15:04:05")
+	}
+
+	mx.Lock()
+	defer mx.Unlock()
+	e.Seq = journalSeq() + 1
+	data, _ := json.Marshal(e)
+	fd, err := os.OpenFile(fpath, os.O_WRONLY|os.O_CREATE|os.O_APPEND, 0644)
+	if err != nil {
+		log.Error(2, "[Event] Open journal failed: %v.", err)
+		return err
+	}
+	defer fd.Close()
+	if _, err = fd.Write(append(data, '\n')); err == nil {
+		err = fd.Sync()
+	}
+	if err != nil {
+		log.Error(2, "[Event] Write journal failed: %v.", err)
+		return err
+	}
+	lastSeq = e.Seq
+	log.Trace("[Event] %d %s %s %s.", e.Seq, e.Kind, e.Branch, e.Build)
+	notify()
+	return nil
+}
+
+// journalSeq return seq of the last journaled event, caller hold `mx`
+func journalSeq() uint64 {
+	if lastSeq == 0 {
+		if last, err := readJournal(journalFile(), 0, 0); err == nil && len(last) > 0 {
+			lastSeq = last[0].Seq
+		}
+	}
+	return lastSeq
+}
+
+// readJournal return at most `n` events after seq `after`, oldest first. With `n` 0 only
+// the last event is returned.
+func readJournal(fpath string, after uint64, n int) ([]*Event, error) {
+	fd, err := os.Open(fpath)
+	if os.IsNotExist(err) {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+	defer fd.Close()
+
+	var arr []*Event
+	var last *Event
+	scan := bufio.NewScanner(fd)
+	scan.Buffer(make([]byte, 64*1024), 16<<20)
+	for scan.Scan() {
+		e := &Event{}
+		if err := json.Unmarshal(scan.Bytes(), e); err != nil {
+			// truncated by crash while appending
+			continue
+		}
+		last = e
+		if e.Seq > after && n > 0 {
+			if arr = append(arr, e); len(arr) >= n {
+				break
+			}
+		}
+	}
+	if n == 0 && last != nil {
+		arr = append(arr, last)
+	}
+	return arr, scan.Err()
+}
+
+// Read return at most `n` journaled events after seq `after`, oldest first.
+//
+func Read(after uint64, n int) ([]*Event, error) {
+	fpath := journalFile()
+	if fpath == "" {
+		return nil, ErrDisabled
+	}
+	if n <= 0 {
+		n = batchSize
+	}
+	mx.Lock()
+	defer mx.Unlock()
+	return readJournal(fpath, after, n)
+}
+
+func loadCursors() map[string]uint64 {
+	cursors := make(map[string]uint64)
+	data, err := ioutil.ReadFile(cursorFile())
+	if err != nil {
+		return cursors
+	}
+	if err = json.Unmarshal(data, &cursors); err != nil {
+		log.Error(2, "[Event] Invalid cursor file %s: %v.", cursorFile(), err)
+	}
+	return cursors
+}
+
+func saveCursor(name string, seq uint64) error {
+	mx.Lock()
+	defer mx.Unlock()
+	cursors := loadCursors()
+	cursors[name] = seq
+	data, _ := json.MarshalIndent(cursors, "", "\t")
+	tmp := cursorFile() + ".tmp"
+	if err := ioutil.WriteFile(tmp, data, 0644); err != nil {
+		return err
+	}
+	return os.Rename(tmp, cursorFile())
+}
+
+// Cursor is the delivery position of one bus
+//
+type Cursor struct {
+	Bus     string `json:"bus"`
+	Seq     uint64 `json:"seq"`     // last event delivered
+	Pending uint64 `json:"pending"` // events journaled after it
+}
+
+// Cursors return delivery position of registered buses.
+//
+func Cursors() []*Cursor {
+	once.Do(setup)
+	mx.Lock()
+	defer mx.Unlock()
+	cursors := loadCursors()
+	arr := make([]*Cursor, 0, len(buses))
+	for _, b := range buses {
+		c := &Cursor{Bus: b.Name(), Seq: cursors[b.Name()]}
+		if last := journalSeq(); last > c.Seq {
+			c.Pending = last - c.Seq
+		}
+		arr = append(arr, c)
+	}
+	sort.Slice(arr, func(i, j int) bool {
+		return arr[i].Bus < arr[j].Bus
+	})
+	return arr
+}
+
+// Rewind move cursor of bus `name` back to `seq`, events after it are delivered again.
+//
+func Rewind(name string, seq uint64) error {
+	once.Do(setup)
+	if journalFile() == "" {
+		return ErrDisabled
+	}
+	mx.Lock()
+	found := false
+	for _, b := range buses {
+		found = found || b.Name() == name
+	}
+	mx.Unlock()
+	if !found {
+		return ErrUnknownBus
+	}
+	if err := saveCursor(name, seq); err != nil {
+		return err
+	}
+	log.Info("[Event] Rewind bus %s to %d.", name, seq)
+	notify()
+	return nil
+}
+
+// deliver send events after the cursor of `b` in batches, until all sent or one failed.
+func deliver(b Bus) error {
+	for {
+		mx.Lock()
+		after := loadCursors()[b.Name()]
+		events, err := readJournal(journalFile(), after, batchSize)
+		mx.Unlock()
+		if err != nil || len(events) == 0 {
+			return err
+		}
+		if err = b.Publish(events); err != nil {
+			return err
+		}
+		last := events[len(events)-1].Seq
+		if err = saveCursor(b.Name(), last); err != nil {
+			return err
+		}
+		log.Trace("[Event] Deliver %d events to %s, cursor %d.", len(events), b.Name(), last)
+	}
+}
+
+// Run deliver journaled events to buses whenever events are published, failed buses are
+// retried until `done` closed.
+//
+func Run(done <-chan struct{}) {
+	once.Do(setup)
+	if journalFile() == "" {
+		return
+	}
+	log.Info("[Event] Event delivery start ...")
+	for {
+		mx.Lock()
+		targets := make([]Bus, len(buses))
+		copy(targets, buses)
+		mx.Unlock()
+		for _, b := range targets {
+			if err := deliver(b); err != nil {
+				log.Warn("[Event] Deliver events to %s failed: %v.", b.Name(), err)
+			}
+		}
+
+		select {
+		case <-done:
+			log.Info("[Event] Event delivery stop.")
+			return
+		case <-wake:
+		case <-time.After(retryInterval):
+		}
+	}
+}
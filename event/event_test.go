@@ -0,0 +1,163 @@
+package event
+
+import (
+	"bufio"
+	"fmt"
+	"io/ioutil"
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/adyzng/GoSymbols/config"
+)
+
+type fakeBus struct {
+	fail     bool
+	received []uint64
+}
+
+func (f *fakeBus) Name() string {
+	return "fake"
+}
+
+func (f *fakeBus) Publish(events []*Event) error {
+	if f.fail {
+		return fmt.Errorf("bus down")
+	}
+	for _, e := range events {
+		f.received = append(f.received, e.Seq)
+	}
+	return nil
+}
+
+func TestDeliver(t *testing.T) {
+	root, err := ioutil.TempDir("", "event")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(root)
+	defer func(journal string) { config.EventJournal = journal }(config.EventJournal)
+	config.EventJournal = filepath.Join(root, "events.log")
+	once.Do(func() {})
+	lastSeq, buses = 0, nil
+
+	bus := &fakeBus{fail: true}
+	Register(bus)
+	for i := 0; i < 3; i++ {
+		if err := Publish(&Event{Kind: KindIngestComplete, Branch: "UDP", Build: fmt.Sprintf("%010d", i+1)}); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if err := deliver(bus); err == nil {
+		t.Fatalf("expect delivery failed")
+	}
+	if c := Cursors(); len(c) != 1 || c[0].Seq != 0 || c[0].Pending != 3 {
+		t.Fatalf("expect 3 events pending, got %+v", c[0])
+	}
+
+	// delivered once the bus is back, from the cursor
+	bus.fail = false
+	if err := deliver(bus); err != nil || len(bus.received) != 3 {
+		t.Fatalf("expect 3 events delivered, got %v (%v)", bus.received, err)
+	}
+	if err := Rewind("fake", 1); err != nil {
+		t.Fatal(err)
+	}
+	if err := deliver(bus); err != nil || fmt.Sprint(bus.received) != "[1 2 3 2 3]" {
+		t.Errorf("expect events after 1 replayed, got %v (%v)", bus.received, err)
+	}
+	if events, _ := Read(2, 0); len(events) != 1 || events[0].Seq != 3 {
+		t.Errorf("unexpected events after 2: %v", events)
+	}
+	if err := Rewind("unknown", 0); err != ErrUnknownBus {
+		t.Errorf("expect unknown bus, got %v", err)
+	}
+}
+
+func TestNATS(t *testing.T) {
+	l, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer l.Close()
+	subjects := make(chan string, 10)
+	go func() {
+		conn, err := l.Accept()
+		if err != nil {
+			return
+		}
+		defer conn.Close()
+		conn.Write([]byte("INFO {\"server_id\":\"test\"}\r\n"))
+		r := bufio.NewReader(conn)
+		for {
+			line, err := r.ReadString('\n')
+			if err != nil {
+				return
+			}
+			switch fields := strings.Fields(line); fields[0] {
+			case "PUB":
+				subjects <- fields[1]
+				r.ReadString('\n')
+			case "PING":
+				conn.Write([]byte("PONG\r\n"))
+			}
+		}
+	}()
+
+	n := &NATS{URL: "nats://user:secret@" + l.Addr().String(), Subject: "gosymbols"}
+	if strings.Contains(n.Name(), "secret") {
+		t.Errorf("credentials in bus name %s", n.Name())
+	}
+	err = n.Publish([]*Event{{Seq: 1, Kind: KindBuildDeleted}, {Seq: 2, Kind: KindVerifyFailed}})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if s := <-subjects; s != "gosymbols.build-deleted" {
+		t.Errorf("unexpected subject %s", s)
+	}
+	if s := <-subjects; s != "gosymbols.verification-failure" {
+		t.Errorf("unexpected subject %s", s)
+	}
+}
+
+func TestJira(t *testing.T) {
+	var comments []string
+	fail := "UDP-2"
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		user, token, _ := r.BasicAuth()
+		if user != "bot" || token != "secret" {
+			w.WriteHeader(http.StatusUnauthorized)
+			return
+		}
+		key := strings.TrimSuffix(strings.TrimPrefix(r.URL.Path, "/rest/api/2/issue/"), "/comment")
+		if key == fail {
+			w.WriteHeader(http.StatusServiceUnavailable)
+			return
+		}
+		comments = append(comments, key)
+		w.WriteHeader(http.StatusCreated)
+	}))
+	defer srv.Close()
+
+	j := &Jira{URL: srv.URL, User: "bot", Token: "secret"}
+	events := []*Event{
+		{Seq: 1, Kind: KindIngestComplete, Branch: "UDP", Version: "100", Tickets: []string{"UDP-1"}},
+		{Seq: 2, Kind: KindBuildDeleted, Branch: "UDP", Version: "99", Tickets: []string{"UDP-1"}},
+		{Seq: 3, Kind: KindTicketLinked, Branch: "UDP", Version: "100", Tickets: []string{"UDP-3", "UDP-2"}},
+	}
+	if err := j.Publish(events); err == nil {
+		t.Fatal("expect comment on UDP-2 failed")
+	}
+	// retried batch don't comment twice
+	fail = ""
+	if err := j.Publish(events); err != nil {
+		t.Fatal(err)
+	}
+	if fmt.Sprint(comments) != "[UDP-1 UDP-3 UDP-2]" {
+		t.Errorf("unexpected comments %v", comments)
+	}
+}
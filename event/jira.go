@@ -0,0 +1,109 @@
+package event
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"net/url"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/adyzng/GoSymbols/config"
+	log "gopkg.in/clog.v1"
+)
+
+// Jira comment on issues linked to a build when its symbols are published, or when issues
+// are linked to a published build. Comments of a batch failed half way are not posted
+// again while the service runs, but may be after restart.
+//
+type Jira struct {
+	URL   string // eg: https://jira.example.com
+	User  string
+	Token string
+
+	mx      sync.Mutex
+	sent    uint64          // seq of the last event commented
+	partial map[string]bool // issues commented of the event after `sent`
+}
+
+var jiraClient = &http.Client{
+	Timeout: time.Second * 30,
+}
+
+// Name of Jira bus
+func (j *Jira) Name() string {
+	return "jira(" + strings.TrimRight(j.URL, "/") + ")"
+}
+
+// Publish comment on issues of ingest-complete and ticket-linked events
+func (j *Jira) Publish(events []*Event) error {
+	j.mx.Lock()
+	defer j.mx.Unlock()
+	for _, e := range events {
+		if e.Seq <= j.sent {
+			continue
+		}
+		text := jiraComment(e)
+		for _, key := range e.Tickets {
+			if text == "" || j.partial[key] {
+				continue
+			}
+			if err := j.comment(key, text); err != nil {
+				return fmt.Errorf("comment on %s failed: %v", key, err)
+			}
+			if j.partial == nil {
+				j.partial = make(map[string]bool)
+			}
+			j.partial[key] = true
+		}
+		j.sent, j.partial = e.Seq, nil
+	}
+	return nil
+}
+
+// jiraComment return the comment of event `e`, empty if it's not commented
+func jiraComment(e *Event) string {
+	var text string
+	switch e.Kind {
+	case KindIngestComplete:
+		text = fmt.Sprintf("Symbols of build %s of branch %s are published to the symbol server.", e.Version, e.Branch)
+	case KindTicketLinked:
+		text = fmt.Sprintf("Build %s of branch %s is linked to this issue, its symbols are on the symbol server.", e.Version, e.Branch)
+	default:
+		return ""
+	}
+	if config.BaseURL != "" && e.Build != "" {
+		text += "\n" + config.ExternalURL("/api/v1/branches/"+url.PathEscape(e.Branch)+"/builds/"+e.Build)
+	}
+	return text
+}
+
+// comment post `text` to issue `key` by Jira REST api v2
+func (j *Jira) comment(key, text string) error {
+	body, _ := json.Marshal(map[string]string{"body": text})
+	target := strings.TrimRight(j.URL, "/") + "/rest/api/2/issue/" + url.PathEscape(key) + "/comment"
+	req, err := http.NewRequest("POST", target, bytes.NewReader(body))
+	if err != nil {
+		return err
+	}
+	req.Header.Set("Content-Type", "application/json")
+	if j.User != "" {
+		req.SetBasicAuth(j.User, j.Token)
+	}
+	resp, err := jiraClient.Do(req)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode == http.StatusNotFound {
+		// deleted or mistyped issue, nothing to retry
+		log.Warn("[Event] Jira issue %s not found, comment dropped.", key)
+		return nil
+	}
+	if resp.StatusCode >= 300 {
+		return fmt.Errorf("jira response %s", resp.Status)
+	}
+	return nil
+}
@@ -0,0 +1,70 @@
+package event
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"net/url"
+	"strings"
+	"time"
+)
+
+// Kafka publish events to a topic through Kafka REST proxy (v2 api), keyed by branch so
+// events of one branch stay in order on one partition.
+//
+type Kafka struct {
+	URL   string // REST proxy, eg: http://kafka-rest:8082
+	Topic string
+}
+
+var kafkaClient = &http.Client{
+	Timeout: time.Second * 30,
+}
+
+// Name of Kafka bus
+func (k *Kafka) Name() string {
+	return "kafka(" + strings.TrimRight(k.URL, "/") + "/" + k.Topic + ")"
+}
+
+// Publish a batch of events in one produce request
+func (k *Kafka) Publish(events []*Event) error {
+	type record struct {
+		Key   string `json:"key"`
+		Value *Event `json:"value"`
+	}
+	var req struct {
+		Records []record `json:"records"`
+	}
+	for _, e := range events {
+		req.Records = append(req.Records, record{Key: e.Branch, Value: e})
+	}
+	body, _ := json.Marshal(&req)
+
+	target := strings.TrimRight(k.URL, "/") + "/topics/" + url.PathEscape(k.Topic)
+	resp, err := kafkaClient.Post(target, "application/vnd.kafka.json.v2+json", bytes.NewReader(body))
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode >= 300 {
+		return fmt.Errorf("kafka rest proxy response %s", resp.Status)
+	}
+
+	var result struct {
+		Offsets []struct {
+			ErrorCode int    `json:"error_code"`
+			Error     string `json:"error"`
+		} `json:"offsets"`
+	}
+	if err = json.NewDecoder(resp.Body).Decode(&result); err != nil {
+		return err
+	}
+	for _, off := range result.Offsets {
+		if off.ErrorCode != 0 || off.Error != "" {
+			// records of the batch before it are published again, consumers dedupe by seq
+			return fmt.Errorf("kafka produce failed: %d %s", off.ErrorCode, off.Error)
+		}
+	}
+	return nil
+}
@@ -0,0 +1,89 @@
+package event
+
+import (
+	"bufio"
+	"encoding/json"
+	"fmt"
+	"net"
+	"net/url"
+	"strings"
+	"time"
+)
+
+const natsTimeout = time.Second * 15
+
+// NATS publish events to `{Subject}.{kind}` of a NATS server by its text protocol. A batch
+// is accepted once the server answer PING sent after it, so nothing is lost by a broken
+// connection without being published again.
+//
+type NATS struct {
+	URL     string // nats://[user:pass@]host:4222
+	Subject string // subject prefix, eg: gosymbols
+}
+
+// Name of NATS bus, credentials are left out
+func (n *NATS) Name() string {
+	u, err := url.Parse(n.URL)
+	if err != nil {
+		return "nats"
+	}
+	return "nats(" + u.Host + "/" + n.Subject + ")"
+}
+
+// Publish a batch of events on one connection
+func (n *NATS) Publish(events []*Event) error {
+	u, err := url.Parse(n.URL)
+	if err != nil {
+		return err
+	}
+	host := u.Host
+	if u.Port() == "" {
+		host = net.JoinHostPort(u.Hostname(), "4222")
+	}
+	conn, err := net.DialTimeout("tcp", host, natsTimeout)
+	if err != nil {
+		return err
+	}
+	defer conn.Close()
+	conn.SetDeadline(time.Now().Add(natsTimeout))
+
+	r := bufio.NewReader(conn)
+	line, err := r.ReadString('\n')
+	if err != nil {
+		return err
+	}
+	if !strings.HasPrefix(line, "INFO ") {
+		return fmt.Errorf("unexpected nats greeting %q", strings.TrimSpace(line))
+	}
+
+	opts := map[string]interface{}{"verbose": false, "pedantic": false, "name": "GoSymbols"}
+	if u.User != nil {
+		opts["user"] = u.User.Username()
+		opts["pass"], _ = u.User.Password()
+	}
+	connect, _ := json.Marshal(opts)
+	w := bufio.NewWriter(conn)
+	fmt.Fprintf(w, "CONNECT %s\r\n", connect)
+	for _, e := range events {
+		data, _ := json.Marshal(e)
+		fmt.Fprintf(w, "PUB %s.%s %d\r\n%s\r\n", n.Subject, e.Kind, len(data), data)
+	}
+	w.WriteString("PING\r\n")
+	if err = w.Flush(); err != nil {
+		return err
+	}
+
+	for {
+		line, err = r.ReadString('\n')
+		if err != nil {
+			return err
+		}
+		switch line = strings.TrimSpace(line); {
+		case line == "PONG":
+			return nil
+		case strings.HasPrefix(line, "-ERR"):
+			return fmt.Errorf("nats %s", line)
+		}
+		// INFO updates or +OK
+	}
+}
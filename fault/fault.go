@@ -0,0 +1,232 @@
+// Package fault inject errors, latency and short writes to storage and network
+// operations, to verify the retry, rollback and verification paths. It is enabled
+// by `[fault] TARGETS` and must never be turned on in production.
+//
+package fault
+
+import (
+	"fmt"
+	"io"
+	"io/fs"
+	"math/rand"
+	"net/http"
+	"os"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/adyzng/GoSymbols/config"
+	log "gopkg.in/clog.v1"
+)
+
+// Targets
+const (
+	Fetch    = "fetch"    // copy debug zip from build server
+	Storage  = "storage"  // write admin files, add transactions and open files of symbol store
+	SymStore = "symstore" // symstore.exe add
+	Network  = "network"  // http requests to upstreams and peers
+)
+
+var (
+	ErrInjected = fmt.Errorf("injected fault")
+)
+
+var (
+	mx  sync.Mutex
+	rnd = rand.New(rand.NewSource(time.Now().UnixNano()))
+)
+
+// Enabled check if faults are injected to `target`
+//
+func Enabled(target string) bool {
+	for _, t := range config.FaultTargets {
+		t = strings.TrimSpace(t)
+		if strings.EqualFold(t, target) || strings.EqualFold(t, "all") {
+			return true
+		}
+	}
+	return false
+}
+
+func roll(rate float64) bool {
+	if rate <= 0 {
+		return false
+	}
+	mx.Lock()
+	defer mx.Unlock()
+	return rnd.Float64() < rate
+}
+
+func delay() {
+	if config.FaultLatency > 0 {
+		time.Sleep(time.Duration(config.FaultLatency) * time.Millisecond)
+	}
+}
+
+// Check add latency and fail with config.FaultErrorRate if `target` is enabled.
+//
+func Check(target string) error {
+	if !Enabled(target) {
+		return nil
+	}
+	delay()
+	if roll(config.FaultErrorRate) {
+		log.Warn("[Fault] Inject error to %s.", target)
+		return ErrInjected
+	}
+	return nil
+}
+
+// reader fail in the middle of the stream
+type reader struct {
+	r      io.Reader
+	target string
+	reads  int
+	failAt int
+}
+
+func (r *reader) Read(p []byte) (int, error) {
+	if r.failAt == 0 {
+		return r.r.Read(p)
+	}
+	if r.reads++; r.reads == r.failAt {
+		log.Warn("[Fault] Inject error to %s after %d reads.", r.target, r.reads-1)
+		return 0, ErrInjected
+	}
+	n, err := r.r.Read(p)
+	if err == io.EOF {
+		// stream shorter than the failure point, break it at the end
+		log.Warn("[Fault] Inject error to %s at end of stream.", r.target)
+		return n, ErrInjected
+	}
+	return n, err
+}
+
+// Reader wrap `r` of target, the stream is chosen to fail with config.FaultErrorRate
+// at one of its first reads, as if the connection is lost in the middle.
+//
+func Reader(target string, r io.Reader) io.Reader {
+	if !Enabled(target) {
+		return r
+	}
+	delay()
+	fr := &reader{r: r, target: target}
+	if roll(config.FaultErrorRate) {
+		mx.Lock()
+		fr.failAt = 1 + rnd.Intn(4)
+		mx.Unlock()
+	}
+	return fr
+}
+
+// writer truncate writes
+type writer struct {
+	w      io.Writer
+	target string
+}
+
+func (w *writer) Write(p []byte) (int, error) {
+	if err := Check(w.target); err != nil {
+		return 0, err
+	}
+	if len(p) > 1 && roll(config.FaultShortWrite) {
+		log.Warn("[Fault] Inject short write to %s.", w.target)
+		n, _ := w.w.Write(p[:len(p)/2])
+		return n, io.ErrShortWrite
+	}
+	return w.w.Write(p)
+}
+
+// Writer wrap `w` of target, each write may fail with config.FaultErrorRate or
+// be truncated with config.FaultShortWrite.
+//
+func Writer(target string, w io.Writer) io.Writer {
+	if !Enabled(target) {
+		return w
+	}
+	return &writer{w: w, target: target}
+}
+
+// WriteFile is ioutil.WriteFile with faults of target.
+//
+func WriteFile(target, fpath string, data []byte, perm os.FileMode) error {
+	fd, err := os.OpenFile(fpath, os.O_WRONLY|os.O_CREATE|os.O_TRUNC, perm)
+	if err != nil {
+		return err
+	}
+	n, err := Writer(target, fd).Write(data)
+	if err == nil && n < len(data) {
+		err = io.ErrShortWrite
+	}
+	if err1 := fd.Close(); err == nil {
+		err = err1
+	}
+	return err
+}
+
+// filesystem fail opening files and break reads of the opened ones
+type filesystem struct {
+	fsys   fs.FS
+	target string
+}
+
+// file break reads of an opened file, Stat and Close are the original ones
+type file struct {
+	fs.File
+	r io.Reader
+}
+
+func (f *file) Read(p []byte) (int, error) {
+	return f.r.Read(p)
+}
+
+func (f *filesystem) Open(name string) (fs.File, error) {
+	if err := Check(f.target); err != nil {
+		return nil, &fs.PathError{Op: "open", Path: name, Err: err}
+	}
+	fd, err := f.fsys.Open(name)
+	if err != nil {
+		return nil, err
+	}
+	return &file{File: fd, r: Reader(f.target, fd)}, nil
+}
+
+// FS wrap `fsys` of target, opening a file may fail with config.FaultErrorRate and its
+// content may break in the middle as Reader.
+//
+func FS(target string, fsys fs.FS) fs.FS {
+	if !Enabled(target) {
+		return fsys
+	}
+	return &filesystem{fsys: fsys, target: target}
+}
+
+// transport fail requests before they are sent
+type transport struct {
+	rt     http.RoundTripper
+	target string
+}
+
+func (t *transport) RoundTrip(req *http.Request) (*http.Response, error) {
+	if err := Check(t.target); err != nil {
+		return nil, err
+	}
+	resp, err := t.rt.RoundTrip(req)
+	if err == nil && Enabled(t.target) {
+		resp.Body = struct {
+			io.Reader
+			io.Closer
+		}{Reader(t.target, resp.Body), resp.Body}
+	}
+	return resp, err
+}
+
+// Transport wrap `rt` (http.DefaultTransport if nil) of target, requests may fail
+// before sent and response bodies may break in the middle.
+//
+func Transport(target string, rt http.RoundTripper) http.RoundTripper {
+	if rt == nil {
+		rt = http.DefaultTransport
+	}
+	return &transport{rt: rt, target: target}
+}
@@ -0,0 +1,101 @@
+package fault
+
+import (
+	"bytes"
+	"errors"
+	"io"
+	"io/fs"
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/adyzng/GoSymbols/config"
+)
+
+func inject(targets []string, errRate, shortWrite float64) func() {
+	t, e, s := config.FaultTargets, config.FaultErrorRate, config.FaultShortWrite
+	config.FaultTargets, config.FaultErrorRate, config.FaultShortWrite = targets, errRate, shortWrite
+	return func() {
+		config.FaultTargets, config.FaultErrorRate, config.FaultShortWrite = t, e, s
+	}
+}
+
+func TestDisabled(t *testing.T) {
+	defer inject(nil, 1, 1)()
+	if err := Check(Storage); err != nil {
+		t.Fatal(err)
+	}
+	r := bytes.NewReader([]byte("data"))
+	if Reader(Fetch, r) != io.Reader(r) {
+		t.Fatal("expect reader not wrapped when disabled")
+	}
+}
+
+func TestReaderAndWriter(t *testing.T) {
+	defer inject([]string{Fetch, Storage}, 1, 0)()
+	if err := Check(Fetch); err != ErrInjected {
+		t.Fatalf("expect injected error, got %v", err)
+	}
+	if err := Check(Network); err != nil {
+		t.Fatalf("expect network not injected, got %v", err)
+	}
+	if _, err := ioutil.ReadAll(Reader(Fetch, bytes.NewReader(make([]byte, 1<<20)))); err != ErrInjected {
+		t.Fatalf("expect stream broken, got %v", err)
+	}
+
+	config.FaultErrorRate, config.FaultShortWrite = 0, 1
+	dir, _ := ioutil.TempDir("", "fault")
+	defer os.RemoveAll(dir)
+	fpath := filepath.Join(dir, "file")
+	if err := WriteFile(Storage, fpath, []byte("0123456789"), 0644); err != io.ErrShortWrite {
+		t.Fatalf("expect short write, got %v", err)
+	}
+	if data, _ := ioutil.ReadFile(fpath); string(data) != "01234" {
+		t.Fatalf("expect truncated file, got %q", data)
+	}
+}
+
+func TestTransport(t *testing.T) {
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Write([]byte("ok"))
+	}))
+	defer srv.Close()
+	client := &http.Client{Transport: Transport(Network, nil)}
+
+	defer inject([]string{"all"}, 1, 0)()
+	if _, err := client.Get(srv.URL); err == nil {
+		t.Fatal("expect request failed")
+	}
+	config.FaultErrorRate = 0
+	resp, err := client.Get(srv.URL)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer resp.Body.Close()
+	if data, _ := ioutil.ReadAll(resp.Body); string(data) != "ok" {
+		t.Fatalf("unexpected body %q", data)
+	}
+}
+
+func TestFS(t *testing.T) {
+	dir, _ := ioutil.TempDir("", "fault")
+	defer os.RemoveAll(dir)
+	ioutil.WriteFile(filepath.Join(dir, "server.txt"), []byte("data"), 0644)
+	fsys := os.DirFS(dir)
+
+	defer inject([]string{Storage}, 1, 0)()
+	if _, err := fs.ReadFile(FS(Storage, fsys), "server.txt"); !errors.Is(err, ErrInjected) {
+		t.Fatalf("expect open failed, got %v", err)
+	}
+	config.FaultErrorRate = 0
+	if data, err := fs.ReadFile(FS(Storage, fsys), "server.txt"); err != nil || string(data) != "data" {
+		t.Fatalf("unexpected content %q (%v)", data, err)
+	}
+	config.FaultTargets = nil
+	if FS(Storage, fsys) != fsys {
+		t.Fatal("expect filesystem not wrapped when disabled")
+	}
+}
@@ -0,0 +1,294 @@
+package federation
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"net/http/httputil"
+	"net/url"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/adyzng/GoSymbols/config"
+	"github.com/adyzng/GoSymbols/fault"
+	"github.com/adyzng/GoSymbols/symbol"
+	log "gopkg.in/clog.v1"
+)
+
+// HeaderForwarded mark requests sent by an federation front-end,
+// peers never forward them again, so two instances pointing to each other won't loop.
+const HeaderForwarded = "X-GoSymbols-Federated"
+
+var (
+	fed  *Federation
+	once sync.Once
+)
+
+// Peer is one backing GoSymbols instance
+//
+type Peer struct {
+	URL      string           `json:"url"`
+	Updated  string           `json:"updated"`
+	Error    string           `json:"error,omitempty"`
+	Branches []*symbol.Branch `json:"-"`
+	proxy    *httputil.ReverseProxy
+}
+
+// Federation forward lookup and browse requests of branches not on local store
+// to the peer which hold it, and merge the results.
+//
+type Federation struct {
+	mx     sync.RWMutex
+	peers  []*Peer
+	owners map[string]*Peer // lower branch name => peer
+	http   *http.Client
+}
+
+// Get return single instance of federation with `config.FederationPeers`.
+//
+func Get() *Federation {
+	once.Do(func() {
+		fed = New(config.FederationPeers)
+	})
+	return fed
+}
+
+// New ...
+func New(peers []string) *Federation {
+	f := &Federation{
+		owners: make(map[string]*Peer),
+		http: &http.Client{
+			Timeout:   time.Second * 30,
+			Transport: fault.Transport(fault.Network, nil),
+		},
+	}
+	for _, p := range peers {
+		p = strings.TrimRight(strings.TrimSpace(p), "/")
+		if p == "" {
+			continue
+		}
+		u, err := url.Parse(p)
+		if err != nil || u.Host == "" {
+			log.Warn("[Fed] Invalid peer %s: %v.", p, err)
+			continue
+		}
+		proxy := httputil.NewSingleHostReverseProxy(u)
+		director := proxy.Director
+		proxy.Director = func(r *http.Request) {
+			director(r)
+			r.Host = u.Host
+			r.Header.Set(HeaderForwarded, "1")
+			stripCredentials(r)
+		}
+		f.peers = append(f.peers, &Peer{URL: p, proxy: proxy})
+	}
+	return f
+}
+
+// Enabled return true if any peer configured.
+func (f *Federation) Enabled() bool {
+	return len(f.peers) > 0
+}
+
+// Run refresh branches of peers periodically until done.
+//
+func (f *Federation) Run(done <-chan struct{}) {
+	if !f.Enabled() {
+		return
+	}
+	log.Info("[Fed] Federate %d peers.", len(f.peers))
+	interval := time.Duration(config.FederationRefresh) * time.Second
+	for {
+		f.Refresh()
+		select {
+		case <-done:
+			log.Info("[Fed] Federation stopped.")
+			return
+		case <-time.After(interval):
+		}
+	}
+}
+
+// restResponse is the envelope of peer api response
+type restResponse struct {
+	Code    int             `json:"code"`
+	Message string          `json:"message"`
+	Data    json.RawMessage `json:"data"`
+}
+
+func (f *Federation) call(peer *Peer, method, path string, body []byte, out interface{}) error {
+	req, err := http.NewRequest(method, peer.URL+path, bytes.NewReader(body))
+	if err != nil {
+		return err
+	}
+	req.Header.Set(HeaderForwarded, "1")
+	if body != nil {
+		req.Header.Set("Content-Type", "application/json")
+	}
+	resp, err := f.http.Do(req)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode != http.StatusOK {
+		return fmt.Errorf("response %s", resp.Status)
+	}
+
+	var rr restResponse
+	if err = json.NewDecoder(resp.Body).Decode(&rr); err != nil {
+		return err
+	}
+	if rr.Code != 0 {
+		return fmt.Errorf("error %d: %s", rr.Code, rr.Message)
+	}
+	return json.Unmarshal(rr.Data, out)
+}
+
+// Refresh fetch branch list of all peers, first peer in config win if branch name collide.
+//
+func (f *Federation) Refresh() {
+	var wg sync.WaitGroup
+	lists := make([][]*symbol.Branch, len(f.peers))
+	errs := make([]error, len(f.peers))
+	for i, peer := range f.peers {
+		wg.Add(1)
+		go func(i int, peer *Peer) {
+			defer wg.Done()
+			var bl struct {
+				Branchs []*symbol.Branch `json:"branchs"`
+			}
+			errs[i] = f.call(peer, "GET", "/api/branches", nil, &bl)
+			lists[i] = bl.Branchs
+		}(i, peer)
+	}
+	wg.Wait()
+
+	f.mx.Lock()
+	defer f.mx.Unlock()
+	now := time.Now().Format("2006-01-02 15:04:05")
+	owners := make(map[string]*Peer)
+	for i, peer := range f.peers {
+		if errs[i] != nil {
+			// keep the last known branches, peer may come back soon
+			log.Warn("[Fed] Refresh peer %s failed: %v.", peer.URL, errs[i])
+			peer.Error = errs[i].Error()
+		} else {
+			peer.Error = ""
+			peer.Updated = now
+			peer.Branches = lists[i]
+			for _, b := range peer.Branches {
+				b.Server = peer.URL
+			}
+		}
+		for _, b := range peer.Branches {
+			lower := strings.ToLower(b.StoreName)
+			if _, ok := owners[lower]; !ok {
+				owners[lower] = peer
+			}
+		}
+	}
+	f.owners = owners
+}
+
+// Peers return status of all peers.
+//
+func (f *Federation) Peers() []Peer {
+	f.mx.RLock()
+	defer f.mx.RUnlock()
+	ps := make([]Peer, 0, len(f.peers))
+	for _, p := range f.peers {
+		ps = append(ps, Peer{URL: p.URL, Updated: p.Updated, Error: p.Error})
+	}
+	return ps
+}
+
+// Branches return branches hold by peers, `Branch.Server` is the peer url.
+//
+func (f *Federation) Branches() []*symbol.Branch {
+	f.mx.RLock()
+	defer f.mx.RUnlock()
+	var bs []*symbol.Branch
+	for _, peer := range f.peers {
+		for _, b := range peer.Branches {
+			if f.owners[strings.ToLower(b.StoreName)] == peer {
+				nb := *b
+				bs = append(bs, &nb)
+			}
+		}
+	}
+	return bs
+}
+
+// Owner return the peer which hold given branch, nil if unknown.
+//
+func (f *Federation) Owner(branch string) *Peer {
+	f.mx.RLock()
+	defer f.mx.RUnlock()
+	return f.owners[strings.ToLower(branch)]
+}
+
+// stripCredentials remove session, bearer and query tokens, peers only answer anonymous reads.
+func stripCredentials(r *http.Request) {
+	r.Header.Del("Authorization")
+	r.Header.Del("Proxy-Authorization")
+	r.Header.Del("Cookie")
+	if q := r.URL.Query(); q.Get("token") != "" {
+		q.Del("token")
+		r.URL.RawQuery = q.Encode()
+	}
+}
+
+// Forward proxy the read request to peer without credentials, other methods are refused.
+//
+func (f *Federation) Forward(peer *Peer, w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodGet && r.Method != http.MethodHead {
+		log.Warn("[Fed] Refuse to forward %s %s to %s.", r.Method, r.URL.Path, peer.URL)
+		w.WriteHeader(http.StatusMethodNotAllowed)
+		return
+	}
+	log.Trace("[Fed] Forward %s %s to %s.", r.Method, r.URL.Path, peer.URL)
+	peer.proxy.ServeHTTP(w, r)
+}
+
+// Query post `body` to `path` of every peer concurrently, `handler` is called
+// with the `data` of each succeed response, in peer order.
+//
+func (f *Federation) Query(method, path string, body interface{}, handler func(peer *Peer, data json.RawMessage) error) error {
+	var payload []byte
+	if body != nil {
+		var err error
+		if payload, err = json.Marshal(body); err != nil {
+			return err
+		}
+	}
+
+	var wg sync.WaitGroup
+	results := make([]json.RawMessage, len(f.peers))
+	for i, peer := range f.peers {
+		wg.Add(1)
+		go func(i int, peer *Peer) {
+			defer wg.Done()
+			if err := f.call(peer, method, path, payload, &results[i]); err != nil {
+				log.Warn("[Fed] Query %s of %s failed: %v.", path, peer.URL, err)
+			}
+		}(i, peer)
+	}
+	wg.Wait()
+
+	for i, peer := range f.peers {
+		if results[i] == nil {
+			continue
+		}
+		if err := handler(peer, results[i]); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// IsForwarded check if request come from another federation front-end.
+func IsForwarded(r *http.Request) bool {
+	return r.Header.Get(HeaderForwarded) != ""
+}
@@ -0,0 +1,75 @@
+package federation
+
+import (
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+)
+
+func fakePeer(branches ...string) *httptest.Server {
+	return httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		switch r.URL.Path {
+		case "/api/branches":
+			var list []string
+			for _, b := range branches {
+				list = append(list, fmt.Sprintf(`{"storeName":%q}`, b))
+			}
+			fmt.Fprintf(w, `{"code":0,"message":"ok","data":{"total":%d,"branchs":[%s]}}`,
+				len(list), strings.Join(list, ","))
+		default:
+			if r.Header.Get("Authorization") != "" || r.Header.Get("Cookie") != "" || r.URL.Query().Get("token") != "" {
+				w.WriteHeader(http.StatusForbidden)
+				return
+			}
+			fmt.Fprintf(w, `{"code":0,"data":{"forwarded":%q}}`, r.Header.Get(HeaderForwarded))
+		}
+	}))
+}
+
+func TestFederation(t *testing.T) {
+	p1 := fakePeer("UDPv6.5", "Shared")
+	defer p1.Close()
+	p2 := fakePeer("UDPv7.0", "Shared")
+	defer p2.Close()
+
+	f := New([]string{p1.URL, p2.URL + "/", "not a url"})
+	f.Refresh()
+
+	if peer := f.Owner("udpv7.0"); peer == nil || peer.URL != p2.URL {
+		t.Fatalf("expect UDPv7.0 on %s, got %+v", p2.URL, peer)
+	}
+	if peer := f.Owner("shared"); peer == nil || peer.URL != p1.URL {
+		t.Fatalf("expect first peer win, got %+v", peer)
+	}
+	if bs := f.Branches(); len(bs) != 3 {
+		t.Fatalf("expect 3 merged branches, got %d", len(bs))
+	}
+
+	w := httptest.NewRecorder()
+	r := httptest.NewRequest("GET", "/api/branches/UDPv7.0?token=secret", nil)
+	r.Header.Set("Authorization", "Bearer secret")
+	r.AddCookie(&http.Cookie{Name: "sess", Value: "secret"})
+	f.Forward(f.Owner("UDPv7.0"), w, r)
+	var rr restResponse
+	if err := json.Unmarshal(w.Body.Bytes(), &rr); err != nil || string(rr.Data) != `{"forwarded":"1"}` {
+		t.Fatalf("unexpected forward response %s (%v)", w.Body.String(), err)
+	}
+
+	w = httptest.NewRecorder()
+	f.Forward(f.Owner("UDPv7.0"), w, httptest.NewRequest("DELETE", "/api/branches/UDPv7.0", nil))
+	if w.Code != http.StatusMethodNotAllowed {
+		t.Fatalf("expect mutation refused, got %d", w.Code)
+	}
+
+	calls := 0
+	f.Query("POST", "/api/symbols/exists", map[string]string{}, func(peer *Peer, data json.RawMessage) error {
+		calls++
+		return nil
+	})
+	if calls != 2 {
+		t.Fatalf("expect 2 peers queried, got %d", calls)
+	}
+}
@@ -41,6 +41,17 @@ func main() {
 		cmd.Web,
 		cmd.Admin,
 		cmd.AddBuild,
+		cmd.Backfill,
+		cmd.Proxy,
+		cmd.Snapshot,
+		cmd.Repair,
+		cmd.MigrateLayout,
+		cmd.Merge,
+		cmd.Seal,
+		cmd.Verify,
+		cmd.Report,
+		cmd.Relocate,
+		cmd.Import,
 	}
 
 	app.Flags = append(app.Flags, []cli.Flag{}...)
@@ -0,0 +1,270 @@
+package metastore
+
+import (
+	"context"
+	"database/sql"
+	"strings"
+)
+
+// maxName is the longest symbol name indexed, the index column limit of MySQL
+const maxName = 191
+
+// Record is a build or transaction as saved by the caller, `Data` is text, usually json.
+// It is passed as string, drivers send []byte as binary.
+//
+type Record struct {
+	ID   string
+	Data []byte
+}
+
+// Symbol is an entry of a transaction indexed by name and hash
+//
+type Symbol struct {
+	Name string
+	Hash string
+}
+
+// Ref is a transaction of branch holding symbol `Name`
+//
+type Ref struct {
+	Branch string
+	ID     string
+	Name   string
+}
+
+// Branch return the saved branch `name`, nil if not saved.
+//
+func (s *Store) Branch(ctx context.Context, name string) ([]byte, error) {
+	var data []byte
+	err := s.queryRow(ctx, s.reader(ctx), "SELECT data FROM branches WHERE name = ?", strings.ToLower(name)).Scan(&data)
+	if err == sql.ErrNoRows {
+		return nil, nil
+	}
+	return data, err
+}
+
+// PutBranch save branch `name`.
+//
+func (s *Store) PutBranch(name string, data []byte) error {
+	name = strings.ToLower(name)
+	return s.update(func(tx *sql.Tx) error {
+		ctx := context.Background()
+		if _, err := s.exec(ctx, tx, "DELETE FROM branches WHERE name = ?", name); err != nil {
+			return err
+		}
+		_, err := s.exec(ctx, tx, "INSERT INTO branches (name, data) VALUES (?, ?)", name, string(data))
+		return err
+	})
+}
+
+// DeleteBranch remove branch `name` and everything saved of its store.
+//
+func (s *Store) DeleteBranch(name string) error {
+	return s.update(func(tx *sql.Tx) error {
+		if _, err := s.exec(context.Background(), tx, "DELETE FROM branches WHERE name = ?", strings.ToLower(name)); err != nil {
+			return err
+		}
+		return s.dropParsed(tx, name)
+	})
+}
+
+// DropParsed remove builds, transactions and symbols of branch `name`, the branch is kept.
+//
+func (s *Store) DropParsed(name string) error {
+	return s.update(func(tx *sql.Tx) error {
+		return s.dropParsed(tx, name)
+	})
+}
+
+func (s *Store) dropParsed(tx *sql.Tx, name string) error {
+	name = strings.ToLower(name)
+	for _, table := range []string{"symbols", "transactions", "builds", "build_stamps"} {
+		if _, err := s.exec(context.Background(), tx, "DELETE FROM "+table+" WHERE branch = ?", name); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// Builds return builds of branch saved with `stamp` whose IDs are in the inclusive range
+// [from, to], empty bound is open. False if the builds saved are of another stamp.
+//
+func (s *Store) Builds(ctx context.Context, branch, stamp, from, to string) ([]*Record, bool, error) {
+	branch = strings.ToLower(branch)
+	var recs []*Record
+	found := false
+	err := s.view(ctx, func(tx *sql.Tx) error {
+		var saved string
+		err := s.queryRow(ctx, tx, "SELECT stamp FROM build_stamps WHERE branch = ?", branch).Scan(&saved)
+		if err == sql.ErrNoRows {
+			return nil
+		} else if err != nil || saved != stamp {
+			return err
+		}
+		found = true
+
+		query, args := "SELECT id, data FROM builds WHERE branch = ?", []interface{}{branch}
+		if from != "" {
+			query, args = query+" AND id >= ?", append(args, from)
+		}
+		if to != "" {
+			query, args = query+" AND id <= ?", append(args, to)
+		}
+		rows, err := s.query(ctx, tx, query+" ORDER BY id", args...)
+		if err != nil {
+			return err
+		}
+		defer rows.Close()
+		for rows.Next() {
+			rec := &Record{}
+			if err = rows.Scan(&rec.ID, &rec.Data); err != nil {
+				return err
+			}
+			recs = append(recs, rec)
+		}
+		return rows.Err()
+	})
+	if err != nil {
+		return nil, false, err
+	}
+	return recs, found, nil
+}
+
+// PutBuilds replace builds of branch parsed with `stamp`. Transactions of builds no longer
+// there are dropped with their symbols.
+//
+func (s *Store) PutBuilds(branch, stamp string, builds []*Record) error {
+	branch = strings.ToLower(branch)
+	ctx := context.Background()
+	return s.update(func(tx *sql.Tx) error {
+		for _, table := range []string{"builds", "build_stamps"} {
+			if _, err := s.exec(ctx, tx, "DELETE FROM "+table+" WHERE branch = ?", branch); err != nil {
+				return err
+			}
+		}
+		stmt, err := tx.PrepareContext(ctx, s.dialect.rebind("INSERT INTO builds (branch, id, data) VALUES (?, ?, ?)"))
+		if err != nil {
+			return err
+		}
+		defer stmt.Close()
+		for _, rec := range builds {
+			if _, err = stmt.ExecContext(ctx, branch, rec.ID, string(rec.Data)); err != nil {
+				return err
+			}
+		}
+		if _, err = s.exec(ctx, tx, "INSERT INTO build_stamps (branch, stamp) VALUES (?, ?)", branch, stamp); err != nil {
+			return err
+		}
+		for _, table := range []string{"symbols", "transactions"} {
+			if _, err = s.exec(ctx, tx, "DELETE FROM "+table+" WHERE branch = ? AND id NOT IN (SELECT id FROM builds WHERE branch = ?)",
+				branch, branch); err != nil {
+				return err
+			}
+		}
+		return nil
+	})
+}
+
+// Transaction return transaction `id` of branch, false if not saved or saved of another
+// `stamp`.
+//
+func (s *Store) Transaction(ctx context.Context, branch, id, stamp string) ([]byte, bool, error) {
+	var saved string
+	var data []byte
+	err := s.queryRow(ctx, s.reader(ctx), "SELECT stamp, data FROM transactions WHERE branch = ? AND id = ?",
+		strings.ToLower(branch), id).Scan(&saved, &data)
+	if err == sql.ErrNoRows {
+		return nil, false, nil
+	} else if err != nil {
+		return nil, false, err
+	}
+	return data, saved == stamp, nil
+}
+
+// PutTransaction save transaction `id` of branch parsed with `stamp` and index its symbols.
+//
+func (s *Store) PutTransaction(branch, id, stamp string, data []byte, syms []*Symbol) error {
+	branch = strings.ToLower(branch)
+	ctx := context.Background()
+	return s.update(func(tx *sql.Tx) error {
+		for _, table := range []string{"symbols", "transactions"} {
+			if _, err := s.exec(ctx, tx, "DELETE FROM "+table+" WHERE branch = ? AND id = ?", branch, id); err != nil {
+				return err
+			}
+		}
+		if _, err := s.exec(ctx, tx, "INSERT INTO transactions (branch, id, stamp, data) VALUES (?, ?, ?, ?)",
+			branch, id, stamp, string(data)); err != nil {
+			return err
+		}
+		stmt, err := tx.PrepareContext(ctx, s.dialect.rebind("INSERT INTO symbols (branch, id, name, hash) VALUES (?, ?, ?, ?)"))
+		if err != nil {
+			return err
+		}
+		defer stmt.Close()
+		for _, sym := range syms {
+			if len(sym.Name) > maxName {
+				continue
+			}
+			if _, err = stmt.ExecContext(ctx, branch, id, strings.ToLower(sym.Name), strings.ToLower(sym.Hash)); err != nil {
+				return err
+			}
+		}
+		return nil
+	})
+}
+
+// HasSymbol check transaction `id` of branch has a symbol whose `field`, name or hash, is
+// `value`. Known is false if the transaction isn't saved or the name is too long to be
+// indexed.
+//
+func (s *Store) HasSymbol(ctx context.Context, branch, id, field, value string) (has, known bool, err error) {
+	if (field != "name" && field != "hash") || len(value) > maxName {
+		return false, false, nil
+	}
+	branch = strings.ToLower(branch)
+	err = s.view(ctx, func(tx *sql.Tx) error {
+		var n int
+		err := s.queryRow(ctx, tx, "SELECT COUNT(*) FROM transactions WHERE branch = ? AND id = ?", branch, id).Scan(&n)
+		if err != nil || n == 0 {
+			return err
+		}
+		known = true
+		err = s.queryRow(ctx, tx, "SELECT COUNT(*) FROM symbols WHERE branch = ? AND id = ? AND "+field+" = ?",
+			branch, id, strings.ToLower(value)).Scan(&n)
+		has = n != 0
+		return err
+	})
+	return has, known, err
+}
+
+// FindHash return transactions of all branches holding a symbol of `hash`.
+//
+func (s *Store) FindHash(ctx context.Context, hash string) ([]*Ref, error) {
+	return s.refs(ctx, "SELECT DISTINCT branch, id, name FROM symbols WHERE hash = ? ORDER BY branch, id, name",
+		strings.ToLower(hash))
+}
+
+// FindNames return transactions of all branches holding a symbol whose name starts with
+// `prefix`, ordered by name.
+//
+func (s *Store) FindNames(ctx context.Context, prefix string) ([]*Ref, error) {
+	return s.refs(ctx, "SELECT DISTINCT branch, id, name FROM symbols WHERE name LIKE ? ESCAPE '!' ORDER BY name, branch, id",
+		likePrefix(strings.ToLower(prefix)))
+}
+
+func (s *Store) refs(ctx context.Context, query string, args ...interface{}) ([]*Ref, error) {
+	rows, err := s.query(ctx, s.reader(ctx), query, args...)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+	var refs []*Ref
+	for rows.Next() {
+		ref := &Ref{}
+		if err = rows.Scan(&ref.Branch, &ref.ID, &ref.Name); err != nil {
+			return nil, err
+		}
+		refs = append(refs, ref)
+	}
+	return refs, rows.Err()
+}
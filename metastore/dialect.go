@@ -0,0 +1,78 @@
+package metastore
+
+import (
+	"strconv"
+	"strings"
+)
+
+// dialect is what differs between the supported databases. Queries are written with `?`
+// placeholders and portable statements, only the schema is per database.
+type dialect struct {
+	driver     string
+	numbered   bool       // placeholders are $1, $2 ...
+	migrations [][]string // schema version N is reached by running migrations[N-1], append only
+}
+
+var dialects = map[string]*dialect{
+	"postgres": {
+		driver:   "postgres",
+		numbered: true,
+		migrations: [][]string{
+			// 1: branches, builds, transactions, symbol index and heartbeat
+			{
+				"CREATE TABLE IF NOT EXISTS branches (name VARCHAR(255) PRIMARY KEY, data TEXT NOT NULL)",
+				"CREATE TABLE IF NOT EXISTS build_stamps (branch VARCHAR(255) PRIMARY KEY, stamp VARCHAR(64) NOT NULL)",
+				"CREATE TABLE IF NOT EXISTS builds (branch VARCHAR(255) NOT NULL, id VARCHAR(32) NOT NULL, data TEXT NOT NULL, PRIMARY KEY (branch, id))",
+				"CREATE TABLE IF NOT EXISTS transactions (branch VARCHAR(255) NOT NULL, id VARCHAR(32) NOT NULL, stamp VARCHAR(64) NOT NULL, data TEXT NOT NULL, PRIMARY KEY (branch, id))",
+				"CREATE TABLE IF NOT EXISTS symbols (branch VARCHAR(255) NOT NULL, id VARCHAR(32) NOT NULL, name VARCHAR(255) NOT NULL, hash VARCHAR(128) NOT NULL)",
+				"CREATE INDEX IF NOT EXISTS symbols_tx ON symbols (branch, id)",
+				"CREATE INDEX IF NOT EXISTS symbols_hash ON symbols (hash)",
+				"CREATE INDEX IF NOT EXISTS symbols_name ON symbols (name varchar_pattern_ops)",
+				"CREATE TABLE IF NOT EXISTS heartbeat (id INT PRIMARY KEY, beat BIGINT NOT NULL)",
+				"INSERT INTO heartbeat (id, beat) VALUES (1, 0) ON CONFLICT DO NOTHING",
+			},
+		},
+	},
+	"mysql": {
+		driver: "mysql",
+		migrations: [][]string{
+			// 1: branches, builds, transactions, symbol index and heartbeat. Indexed columns
+			// of utf8mb4 are at most 191 characters.
+			{
+				"CREATE TABLE IF NOT EXISTS branches (name VARCHAR(191) PRIMARY KEY, data LONGTEXT NOT NULL)",
+				"CREATE TABLE IF NOT EXISTS build_stamps (branch VARCHAR(191) PRIMARY KEY, stamp VARCHAR(64) NOT NULL)",
+				"CREATE TABLE IF NOT EXISTS builds (branch VARCHAR(191) NOT NULL, id VARCHAR(32) NOT NULL, data LONGTEXT NOT NULL, PRIMARY KEY (branch, id))",
+				"CREATE TABLE IF NOT EXISTS transactions (branch VARCHAR(191) NOT NULL, id VARCHAR(32) NOT NULL, stamp VARCHAR(64) NOT NULL, data LONGTEXT NOT NULL, PRIMARY KEY (branch, id))",
+				"CREATE TABLE IF NOT EXISTS symbols (branch VARCHAR(191) NOT NULL, id VARCHAR(32) NOT NULL, name VARCHAR(191) NOT NULL, hash VARCHAR(128) NOT NULL, " +
+					"INDEX symbols_tx (branch, id), INDEX symbols_hash (hash), INDEX symbols_name (name))",
+				"CREATE TABLE IF NOT EXISTS heartbeat (id INT PRIMARY KEY, beat BIGINT NOT NULL)",
+				"INSERT IGNORE INTO heartbeat (id, beat) VALUES (1, 0)",
+			},
+		},
+	},
+}
+
+// rebind replace `?` placeholders of query for the database
+func (d *dialect) rebind(query string) string {
+	if !d.numbered {
+		return query
+	}
+	var sb strings.Builder
+	n := 0
+	for i := 0; i < len(query); i++ {
+		if query[i] != '?' {
+			sb.WriteByte(query[i])
+			continue
+		}
+		n++
+		sb.WriteByte('$')
+		sb.WriteString(strconv.Itoa(n))
+	}
+	return sb.String()
+}
+
+// likePrefix return the LIKE pattern of names starting with `prefix`, escaped by `!`
+func likePrefix(prefix string) string {
+	r := strings.NewReplacer("!", "!!", "%", "!%", "_", "!_")
+	return r.Replace(prefix) + "%"
+}
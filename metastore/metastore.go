@@ -0,0 +1,322 @@
+// Package metastore keep metadata parsed from symstore admin files in an external SQL
+// database, Postgres or MySQL, so servers of a large deployment share it. Writes go to the
+// primary database. Reads of requests marked by WithReplica go to a read replica which isn't
+// lagging behind, so heavy browse traffic scales independently of ingest.
+//
+package metastore
+
+import (
+	"context"
+	"database/sql"
+	"fmt"
+	"strings"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	_ "github.com/go-sql-driver/mysql"
+	_ "github.com/lib/pq"
+	log "gopkg.in/clog.v1"
+)
+
+const (
+	defaultMaxLag = 10 * time.Second
+	openTimeout   = 10 * time.Second
+)
+
+// beatInterval between heartbeats written to the primary, replica lag is measured by them
+var beatInterval = time.Second
+
+// Options of the metadata database
+//
+type Options struct {
+	Driver   string        // postgres or mysql
+	DSN      string        // data source name of the primary
+	Replicas []string      // data source names of the read replicas
+	MaxLag   time.Duration // replicas further behind the primary are not read, 0 for 10 seconds
+}
+
+// Store is the metadata database, see Open. Branch, symbol name and hash are saved lower
+// case, so they are matched case insensitively.
+//
+type Store struct {
+	dialect  *dialect
+	primary  *sql.DB
+	replicas []*replica
+	maxLag   time.Duration
+	next     uint32
+	done     chan struct{}
+	wg       sync.WaitGroup
+}
+
+// replica is a read replica, readable while its last heartbeat is recent
+type replica struct {
+	name string
+	db   *sql.DB
+
+	mx      sync.Mutex
+	lag     time.Duration
+	err     error
+	checked time.Time
+}
+
+// ReplicaStatus is the state of a read replica as of its last check
+//
+type ReplicaStatus struct {
+	Name     string    `json:"name"`
+	LagMs    int64     `json:"lagMs"`
+	Error    string    `json:"error,omitempty"`
+	Checked  time.Time `json:"checked"`
+	Readable bool      `json:"readable"`
+}
+
+// Open connect the primary database and migrate its schema, then the read replicas. A
+// replica which can't be reached is only skipped until it can.
+//
+func Open(opt Options) (*Store, error) {
+	d, ok := dialects[strings.ToLower(opt.Driver)]
+	if !ok {
+		return nil, fmt.Errorf("unknown metadata database driver %q", opt.Driver)
+	}
+	primary, err := sql.Open(d.driver, opt.DSN)
+	if err != nil {
+		return nil, err
+	}
+	ctx, cancel := context.WithTimeout(context.Background(), openTimeout)
+	defer cancel()
+	if err = primary.PingContext(ctx); err != nil {
+		primary.Close()
+		return nil, err
+	}
+	s := &Store{
+		dialect: d,
+		primary: primary,
+		maxLag:  opt.MaxLag,
+		done:    make(chan struct{}),
+	}
+	if s.maxLag <= 0 {
+		s.maxLag = defaultMaxLag
+	}
+	if err = s.migrate(ctx); err != nil {
+		primary.Close()
+		return nil, err
+	}
+
+	for i, dsn := range opt.Replicas {
+		db, err := sql.Open(d.driver, dsn)
+		if err != nil {
+			// DSN is not logged, it may hold the password
+			log.Warn("[Meta] Open read replica #%d failed: %v.", i+1, err)
+			continue
+		}
+		s.replicas = append(s.replicas, &replica{name: fmt.Sprintf("#%d", i+1), db: db})
+	}
+	s.wg.Add(1)
+	go s.heartbeat()
+	return s, nil
+}
+
+// Close stop the heartbeat and close all connections.
+//
+func (s *Store) Close() error {
+	close(s.done)
+	s.wg.Wait()
+	for _, r := range s.replicas {
+		r.db.Close()
+	}
+	return s.primary.Close()
+}
+
+// migrate run the migrations newer than schema version of the database
+func (s *Store) migrate(ctx context.Context) error {
+	if _, err := s.primary.ExecContext(ctx, "CREATE TABLE IF NOT EXISTS meta_schema (version INT NOT NULL)"); err != nil {
+		return err
+	}
+	version, found := 0, true
+	err := s.primary.QueryRowContext(ctx, "SELECT version FROM meta_schema").Scan(&version)
+	if err == sql.ErrNoRows {
+		found, err = false, nil
+	}
+	if err != nil {
+		return err
+	}
+	migrations := s.dialect.migrations
+	if version > len(migrations) {
+		return fmt.Errorf("schema version %d is newer than %d of this server", version, len(migrations))
+	}
+	for ; version < len(migrations); version++ {
+		for _, stmt := range migrations[version] {
+			if _, err = s.primary.ExecContext(ctx, stmt); err != nil {
+				return fmt.Errorf("migration %d: %v", version+1, err)
+			}
+		}
+		if found {
+			_, err = s.exec(ctx, s.primary, "UPDATE meta_schema SET version = ?", version+1)
+		} else {
+			_, err = s.exec(ctx, s.primary, "INSERT INTO meta_schema (version) VALUES (?)", version+1)
+			found = true
+		}
+		if err != nil {
+			return err
+		}
+		log.Info("[Meta] Metadata schema migrated to %d.", version+1)
+	}
+	return nil
+}
+
+// heartbeat write the time to the primary and check what the replicas have seen of it
+func (s *Store) heartbeat() {
+	defer s.wg.Done()
+	for {
+		s.checkReplicas()
+		ctx, cancel := context.WithTimeout(context.Background(), beatInterval)
+		if _, err := s.exec(ctx, s.primary, "UPDATE heartbeat SET beat = ? WHERE id = 1", time.Now().UnixNano()); err != nil {
+			log.Warn("[Meta] Write heartbeat failed: %v.", err)
+		}
+		cancel()
+		select {
+		case <-s.done:
+			return
+		case <-time.After(beatInterval):
+		}
+	}
+}
+
+// checkReplicas read the last heartbeat each replica has. Lag is the age of that heartbeat,
+// the replica has every write made before it.
+func (s *Store) checkReplicas() {
+	for _, r := range s.replicas {
+		var beat int64
+		ctx, cancel := context.WithTimeout(context.Background(), beatInterval)
+		err := s.queryRow(ctx, r.db, "SELECT beat FROM heartbeat WHERE id = 1").Scan(&beat)
+		cancel()
+
+		r.mx.Lock()
+		if err != nil && r.err == nil {
+			log.Warn("[Meta] Read replica %s is not readable: %v.", r.name, err)
+		}
+		r.err, r.lag, r.checked = err, time.Since(time.Unix(0, beat)), time.Now()
+		r.mx.Unlock()
+	}
+}
+
+// readable check replica is reachable, no further behind than `maxLag` and checked lately
+func (r *replica) readable(maxLag time.Duration) (time.Duration, bool) {
+	r.mx.Lock()
+	defer r.mx.Unlock()
+	ok := r.err == nil && !r.checked.IsZero() && r.lag <= maxLag && time.Since(r.checked) <= maxLag
+	return r.lag, ok
+}
+
+// Replicas return the state of read replicas.
+//
+func (s *Store) Replicas() []*ReplicaStatus {
+	arr := make([]*ReplicaStatus, 0, len(s.replicas))
+	for _, r := range s.replicas {
+		lag, ok := r.readable(s.maxLag)
+		st := &ReplicaStatus{Name: r.name, LagMs: int64(lag / time.Millisecond), Readable: ok}
+		r.mx.Lock()
+		st.Checked = r.checked
+		if r.err != nil {
+			st.Error = r.err.Error()
+		}
+		r.mx.Unlock()
+		arr = append(arr, st)
+	}
+	return arr
+}
+
+// replicaRead of request marked by WithReplica, the max lag of replicas it read
+type replicaRead struct {
+	mx  sync.Mutex
+	lag time.Duration
+	hit bool
+}
+
+type replicaKey struct{}
+
+// WithReplica mark `ctx` of a heavy list request, its reads may be served by a read replica,
+// see ReplicaLag.
+//
+func WithReplica(ctx context.Context) context.Context {
+	return context.WithValue(ctx, replicaKey{}, &replicaRead{})
+}
+
+// ReplicaLag return how far behind the primary the data read for `ctx` may be, false if it
+// was all read from the primary.
+//
+func ReplicaLag(ctx context.Context) (time.Duration, bool) {
+	rr, ok := ctx.Value(replicaKey{}).(*replicaRead)
+	if !ok {
+		return 0, false
+	}
+	rr.mx.Lock()
+	defer rr.mx.Unlock()
+	return rr.lag, rr.hit
+}
+
+// reader return the database reads of `ctx` go to. Requests of WithReplica read the
+// readable replicas in turn, the primary if there is none.
+func (s *Store) reader(ctx context.Context) *sql.DB {
+	rr, ok := ctx.Value(replicaKey{}).(*replicaRead)
+	if !ok || len(s.replicas) == 0 {
+		return s.primary
+	}
+	n := len(s.replicas)
+	start := int(atomic.AddUint32(&s.next, 1))
+	for i := 0; i < n; i++ {
+		r := s.replicas[(start+i)%n]
+		if lag, ok := r.readable(s.maxLag); ok {
+			rr.mx.Lock()
+			if !rr.hit || lag > rr.lag {
+				rr.lag = lag
+			}
+			rr.hit = true
+			rr.mx.Unlock()
+			return r.db
+		}
+	}
+	return s.primary
+}
+
+// execer is a database or transaction
+type execer interface {
+	ExecContext(ctx context.Context, query string, args ...interface{}) (sql.Result, error)
+	QueryContext(ctx context.Context, query string, args ...interface{}) (*sql.Rows, error)
+	QueryRowContext(ctx context.Context, query string, args ...interface{}) *sql.Row
+}
+
+func (s *Store) exec(ctx context.Context, db execer, query string, args ...interface{}) (sql.Result, error) {
+	return db.ExecContext(ctx, s.dialect.rebind(query), args...)
+}
+
+func (s *Store) query(ctx context.Context, db execer, query string, args ...interface{}) (*sql.Rows, error) {
+	return db.QueryContext(ctx, s.dialect.rebind(query), args...)
+}
+
+func (s *Store) queryRow(ctx context.Context, db execer, query string, args ...interface{}) *sql.Row {
+	return db.QueryRowContext(ctx, s.dialect.rebind(query), args...)
+}
+
+// update run `fn` in a transaction of the primary, rolled back if it fails
+func (s *Store) update(fn func(tx *sql.Tx) error) error {
+	tx, err := s.primary.Begin()
+	if err != nil {
+		return err
+	}
+	if err = fn(tx); err != nil {
+		tx.Rollback()
+		return err
+	}
+	return tx.Commit()
+}
+
+// view run `fn` in a read-only snapshot of the database reads of `ctx` go to
+func (s *Store) view(ctx context.Context, fn func(tx *sql.Tx) error) error {
+	tx, err := s.reader(ctx).BeginTx(ctx, &sql.TxOptions{Isolation: sql.LevelRepeatableRead, ReadOnly: true})
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback()
+	return fn(tx)
+}
@@ -0,0 +1,145 @@
+package metastore
+
+import (
+	"context"
+	"database/sql"
+	"os"
+	"testing"
+	"time"
+)
+
+func TestRebind(t *testing.T) {
+	query := "SELECT id FROM builds WHERE branch = ? AND id >= ?"
+	if q := dialects["postgres"].rebind(query); q != "SELECT id FROM builds WHERE branch = $1 AND id >= $2" {
+		t.Errorf("unexpected postgres query %s", q)
+	}
+	if q := dialects["mysql"].rebind(query); q != query {
+		t.Errorf("unexpected mysql query %s", q)
+	}
+	if p := likePrefix("a_b%!"); p != "a!_b!%!!%" {
+		t.Errorf("unexpected like pattern %s", p)
+	}
+}
+
+func TestReader(t *testing.T) {
+	open := func() *sql.DB {
+		db, err := sql.Open("postgres", "host=localhost")
+		if err != nil {
+			t.Fatal(err)
+		}
+		return db
+	}
+	now := time.Now()
+	s := &Store{
+		primary: open(),
+		maxLag:  defaultMaxLag,
+		replicas: []*replica{
+			{name: "#1", db: open(), lag: time.Second, checked: now},
+			{name: "#2", db: open(), lag: time.Minute, checked: now},
+			{name: "#3", db: open(), lag: 2 * time.Second, checked: now},
+		},
+	}
+
+	// only requests marked read replicas
+	if s.reader(context.Background()) != s.primary {
+		t.Fatal("expect unmarked request read the primary")
+	}
+	ctx := WithReplica(context.Background())
+	seen := make(map[*sql.DB]bool)
+	for i := 0; i < 4; i++ {
+		seen[s.reader(ctx)] = true
+	}
+	if len(seen) != 2 || seen[s.replicas[1].db] || seen[s.primary] {
+		t.Fatalf("expect readable replicas read in turn, got %d", len(seen))
+	}
+	if lag, ok := ReplicaLag(ctx); !ok || lag != 2*time.Second {
+		t.Errorf("expect max lag of replicas read, got %v", lag)
+	}
+
+	// unreachable or not checked for a while, fall back to the primary
+	s.replicas[0].err = sql.ErrConnDone
+	s.replicas[2].checked = now.Add(-time.Hour)
+	ctx = WithReplica(context.Background())
+	if s.reader(ctx) != s.primary {
+		t.Fatal("expect primary read without readable replica")
+	}
+	if _, ok := ReplicaLag(ctx); ok {
+		t.Error("expect no replica lag of request read the primary")
+	}
+	if st := s.Replicas(); len(st) != 3 || st[0].Readable || st[0].Error == "" || st[1].LagMs != 60000 {
+		t.Errorf("unexpected replica status %+v", st[0])
+	}
+}
+
+// TestStore run against the database of METASTORE_DRIVER and METASTORE_DSN, eg: postgres
+// and "postgres://gosymbols@localhost/test?sslmode=disable".
+func TestStore(t *testing.T) {
+	driver, dsn := os.Getenv("METASTORE_DRIVER"), os.Getenv("METASTORE_DSN")
+	if dsn == "" {
+		t.Skip("METASTORE_DSN not set")
+	}
+	beatInterval = 100 * time.Millisecond
+	s, err := Open(Options{Driver: driver, DSN: dsn, Replicas: []string{dsn}})
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer s.Close()
+	defer s.DeleteBranch("TestStore")
+
+	if err = s.PutBranch("TestStore", []byte(`{"storeName":"TestStore"}`)); err != nil {
+		t.Fatal(err)
+	}
+	if data, err := s.Branch(context.Background(), "teststore"); err != nil || string(data) != `{"storeName":"TestStore"}` {
+		t.Fatalf("unexpected branch %s (%v)", data, err)
+	}
+
+	builds := []*Record{{ID: "0000000001", Data: []byte("1")}, {ID: "0000000002", Data: []byte("2")}, {ID: "0000000003", Data: []byte("3")}}
+	if err = s.PutBuilds("TestStore", "s1", builds); err != nil {
+		t.Fatal(err)
+	}
+	for id, hash := range map[string]string{"0000000001": "AB1", "0000000003": "AB3"} {
+		syms := []*Symbol{{Name: "Foo.pdb", Hash: hash}, {Name: "bar_1.dll", Hash: hash}}
+		if err = s.PutTransaction("TestStore", id, "t"+id, []byte(id), syms); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if recs, ok, err := s.Builds(context.Background(), "TestStore", "s1", "0000000002", ""); err != nil || !ok || len(recs) != 2 {
+		t.Fatalf("expect 2 builds from 0000000002, got %d (%v)", len(recs), err)
+	}
+	if _, ok, _ := s.Builds(context.Background(), "TestStore", "s0", "", ""); ok {
+		t.Fatal("expect builds of another stamp not found")
+	}
+	if data, ok, err := s.Transaction(context.Background(), "TestStore", "0000000003", "t0000000003"); err != nil || !ok || string(data) != "0000000003" {
+		t.Fatalf("unexpected transaction %s (%v)", data, err)
+	}
+	if has, known, err := s.HasSymbol(context.Background(), "TestStore", "0000000001", "name", "FOO.PDB"); err != nil || !known || !has {
+		t.Fatalf("expect foo.pdb indexed (%v)", err)
+	}
+	if _, known, _ := s.HasSymbol(context.Background(), "TestStore", "0000000002", "hash", "AB1"); known {
+		t.Fatal("expect transaction not saved unknown")
+	}
+	if refs, err := s.FindHash(context.Background(), "ab1"); err != nil || len(refs) != 2 || refs[0].ID != "0000000001" {
+		t.Fatalf("unexpected refs by hash %v (%v)", refs, err)
+	}
+	if refs, err := s.FindNames(context.Background(), "bar_"); err != nil || len(refs) != 2 || refs[0].Name != "bar_1.dll" {
+		t.Fatalf("unexpected refs by name %v (%v)", refs, err)
+	}
+
+	// transactions of builds no longer in server.txt are dropped
+	if err = s.PutBuilds("TestStore", "s2", builds[1:]); err != nil {
+		t.Fatal(err)
+	}
+	if _, ok, _ := s.Transaction(context.Background(), "TestStore", "0000000001", "t0000000001"); ok {
+		t.Fatal("expect transaction of removed build dropped")
+	}
+
+	// the replica has the heartbeat once checked
+	time.Sleep(3 * beatInterval)
+	ctx := WithReplica(context.Background())
+	if refs, err := s.FindHash(ctx, "ab3"); err != nil || len(refs) != 2 {
+		t.Fatalf("unexpected refs from replica %v (%v)", refs, err)
+	}
+	if _, ok := ReplicaLag(ctx); !ok {
+		t.Errorf("expect read from replica, got %+v", s.Replicas()[0])
+	}
+}
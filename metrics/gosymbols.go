@@ -0,0 +1,25 @@
+package metrics
+
+// Metrics of GoSymbols, labelled by branch store name
+var (
+	BuildsIngested = NewCounter("gosymbols_builds_ingested_total",
+		"Builds ingested to the symbol store.", "branch")
+	SymbolsStored = NewCounter("gosymbols_symbols_stored_total",
+		"Symbol files added to the symbol store by ingests.", "branch")
+	IngestFailures = NewCounter("gosymbols_ingest_failures_total",
+		"Ingests which failed.", "branch")
+	IngestStage = NewHistogram("gosymbols_ingest_stage_seconds",
+		"Duration of ingest stages: copy, unzip, symstore and metadata.", DurationBuckets, "stage")
+	LastIngest = NewGauge("gosymbols_last_ingest_timestamp_seconds",
+		"Unix time of the last successful ingest.", "branch")
+
+	StoreBytes = NewGauge("gosymbols_store_bytes",
+		"Disk usage of the symbol store.", "branch")
+	StoreBuilds = NewGauge("gosymbols_store_builds",
+		"Builds held in the symbol store.", "branch")
+
+	Requests = NewCounter("gosymbols_http_requests_total",
+		"Requests served by route and status code.", "route", "code")
+	RequestSeconds = NewHistogram("gosymbols_http_request_seconds",
+		"Duration of served requests.", RequestBuckets, "route")
+)
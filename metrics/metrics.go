@@ -0,0 +1,241 @@
+// Package metrics expose counters, gauges and histograms of ingestion, store and serving
+// in the Prometheus text format at /metrics, so stalled ingests and failing branches
+// can be alerted on.
+//
+//	refer: https://prometheus.io/docs/instrumenting/exposition_formats/
+//
+package metrics
+
+import (
+	"fmt"
+	"io"
+	"math"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+)
+
+const (
+	typeCounter   = "counter"
+	typeGauge     = "gauge"
+	typeHistogram = "histogram"
+)
+
+var (
+	// DurationBuckets of ingest stages in seconds, zips of big builds take minutes to copy
+	DurationBuckets = []float64{1, 5, 15, 30, 60, 120, 300, 600, 1800, 3600}
+	// RequestBuckets of served requests in seconds
+	RequestBuckets = []float64{.005, .01, .025, .05, .1, .25, .5, 1, 2.5, 5, 10}
+)
+
+// series is the value of one label set
+type series struct {
+	labels []string
+	value  float64
+	counts []uint64 // histogram buckets, not cumulative
+	sum    float64
+	count  uint64
+}
+
+// family is a metric and all its label sets
+type family struct {
+	name    string
+	help    string
+	kind    string
+	labels  []string
+	buckets []float64
+	mx      sync.Mutex
+	series  map[string]*series
+}
+
+var (
+	regMx    sync.Mutex
+	families []*family
+	scrapes  []func()
+)
+
+func register(name, help, kind string, buckets []float64, labels []string) *family {
+	f := &family{
+		name:    name,
+		help:    help,
+		kind:    kind,
+		labels:  labels,
+		buckets: buckets,
+		series:  make(map[string]*series),
+	}
+	regMx.Lock()
+	families = append(families, f)
+	regMx.Unlock()
+	return f
+}
+
+// get return series of label `values`, created on first use
+func (f *family) get(values []string) *series {
+	if len(values) != len(f.labels) {
+		panic(fmt.Sprintf("metric %s has %d labels, %d given", f.name, len(f.labels), len(values)))
+	}
+	key := strings.Join(values, "\xff")
+	s, ok := f.series[key]
+	if !ok {
+		s = &series{labels: append([]string(nil), values...)}
+		if f.kind == typeHistogram {
+			s.counts = make([]uint64, len(f.buckets))
+		}
+		f.series[key] = s
+	}
+	return s
+}
+
+// Counter is a monotonic value, eg: builds ingested
+//
+type Counter struct{ f *family }
+
+// NewCounter register counter `name` with label names `labels`.
+//
+func NewCounter(name, help string, labels ...string) *Counter {
+	return &Counter{register(name, help, typeCounter, nil, labels)}
+}
+
+// Add `v` to the counter of label `values`.
+//
+func (c *Counter) Add(v float64, values ...string) {
+	c.f.mx.Lock()
+	c.f.get(values).value += v
+	c.f.mx.Unlock()
+}
+
+// Inc add 1 to the counter of label `values`.
+//
+func (c *Counter) Inc(values ...string) {
+	c.Add(1, values...)
+}
+
+// Gauge is a value that goes up and down, eg: store disk usage
+//
+type Gauge struct{ f *family }
+
+// NewGauge register gauge `name` with label names `labels`.
+//
+func NewGauge(name, help string, labels ...string) *Gauge {
+	return &Gauge{register(name, help, typeGauge, nil, labels)}
+}
+
+// Set the gauge of label `values` to `v`.
+//
+func (g *Gauge) Set(v float64, values ...string) {
+	g.f.mx.Lock()
+	g.f.get(values).value = v
+	g.f.mx.Unlock()
+}
+
+// Reset remove all label sets, eg: before setting the gauges of the current branches.
+//
+func (g *Gauge) Reset() {
+	g.f.mx.Lock()
+	g.f.series = make(map[string]*series)
+	g.f.mx.Unlock()
+}
+
+// Histogram count observations in buckets, eg: durations of ingest stages
+//
+type Histogram struct{ f *family }
+
+// NewHistogram register histogram `name` of upper bounds `buckets` in increasing order.
+//
+func NewHistogram(name, help string, buckets []float64, labels ...string) *Histogram {
+	return &Histogram{register(name, help, typeHistogram, buckets, labels)}
+}
+
+// Observe add `v` to the histogram of label `values`.
+//
+func (h *Histogram) Observe(v float64, values ...string) {
+	h.f.mx.Lock()
+	defer h.f.mx.Unlock()
+	s := h.f.get(values)
+	if i := sort.SearchFloat64s(h.f.buckets, v); i < len(s.counts) {
+		s.counts[i]++
+	}
+	s.sum += v
+	s.count++
+}
+
+// OnScrape register `fn` called before each scrape, to update gauges computed on demand.
+//
+func OnScrape(fn func()) {
+	regMx.Lock()
+	scrapes = append(scrapes, fn)
+	regMx.Unlock()
+}
+
+func formatValue(v float64) string {
+	switch {
+	case math.IsInf(v, 1):
+		return "+Inf"
+	case math.IsInf(v, -1):
+		return "-Inf"
+	}
+	return strconv.FormatFloat(v, 'g', -1, 64)
+}
+
+var labelEscaper = strings.NewReplacer(`\`, `\\`, `"`, `\"`, "\n", `\n`)
+
+// labelSet format `{name="value",...}` of names and values, extra is appended as is
+func labelSet(names, values []string, extra string) string {
+	var arr []string
+	for i, n := range names {
+		arr = append(arr, n+`="`+labelEscaper.Replace(values[i])+`"`)
+	}
+	if extra != "" {
+		arr = append(arr, extra)
+	}
+	if len(arr) == 0 {
+		return ""
+	}
+	return "{" + strings.Join(arr, ",") + "}"
+}
+
+// write the family in text format, series ordered by labels
+func (f *family) write(w io.Writer) {
+	f.mx.Lock()
+	defer f.mx.Unlock()
+	fmt.Fprintf(w, "# HELP %s %s\n", f.name, strings.Replace(f.help, "\n", " ", -1))
+	fmt.Fprintf(w, "# TYPE %s %s\n", f.name, f.kind)
+
+	keys := make([]string, 0, len(f.series))
+	for k := range f.series {
+		keys = append(keys, k)
+	}
+	sort.Strings(keys)
+	for _, k := range keys {
+		s := f.series[k]
+		if f.kind != typeHistogram {
+			fmt.Fprintf(w, "%s%s %s\n", f.name, labelSet(f.labels, s.labels, ""), formatValue(s.value))
+			continue
+		}
+		var acc uint64
+		for i, le := range f.buckets {
+			acc += s.counts[i]
+			fmt.Fprintf(w, "%s_bucket%s %d\n", f.name, labelSet(f.labels, s.labels, `le="`+formatValue(le)+`"`), acc)
+		}
+		fmt.Fprintf(w, "%s_bucket%s %d\n", f.name, labelSet(f.labels, s.labels, `le="+Inf"`), s.count)
+		fmt.Fprintf(w, "%s_sum%s %s\n", f.name, labelSet(f.labels, s.labels, ""), formatValue(s.sum))
+		fmt.Fprintf(w, "%s_count%s %d\n", f.name, labelSet(f.labels, s.labels, ""), s.count)
+	}
+}
+
+// Write all metrics to `w` in Prometheus text format.
+//
+func Write(w io.Writer) {
+	regMx.Lock()
+	fns := append([]func(){}, scrapes...)
+	fams := append([]*family{}, families...)
+	regMx.Unlock()
+
+	for _, fn := range fns {
+		fn()
+	}
+	for _, f := range fams {
+		f.write(w)
+	}
+}
@@ -0,0 +1,64 @@
+package metrics
+
+import (
+	"bytes"
+	"strings"
+	"testing"
+)
+
+func TestWrite(t *testing.T) {
+	c := NewCounter("test_ingested_total", "Builds ingested.", "branch")
+	g := NewGauge("test_store_bytes", "Disk usage.", "branch")
+	h := NewHistogram("test_stage_seconds", "Stage durations.", []float64{1, 10}, "stage")
+
+	c.Inc("UDP")
+	c.Add(2, "UDP")
+	c.Inc(`quote"d`)
+	g.Set(1024, "UDP")
+	h.Observe(0.5, "copy")
+	h.Observe(5, "copy")
+	h.Observe(50, "copy")
+
+	scraped := 0
+	OnScrape(func() { scraped++ })
+
+	buf := &bytes.Buffer{}
+	Write(buf)
+	out := buf.String()
+	if scraped != 1 {
+		t.Errorf("scrape hook called %d times, expect 1", scraped)
+	}
+	for _, line := range []string{
+		"# TYPE test_ingested_total counter",
+		`test_ingested_total{branch="UDP"} 3`,
+		`test_ingested_total{branch="quote\"d"} 1`,
+		"# HELP test_store_bytes Disk usage.",
+		`test_store_bytes{branch="UDP"} 1024`,
+		"# TYPE test_stage_seconds histogram",
+		`test_stage_seconds_bucket{stage="copy",le="1"} 1`,
+		`test_stage_seconds_bucket{stage="copy",le="10"} 2`,
+		`test_stage_seconds_bucket{stage="copy",le="+Inf"} 3`,
+		`test_stage_seconds_sum{stage="copy"} 55.5`,
+		`test_stage_seconds_count{stage="copy"} 3`,
+	} {
+		if !strings.Contains(out, line+"\n") {
+			t.Errorf("missing %q in:\n%s", line, out)
+		}
+	}
+
+	g.Reset()
+	buf.Reset()
+	Write(buf)
+	if strings.Contains(buf.String(), `test_store_bytes{`) {
+		t.Errorf("gauge series remain after reset")
+	}
+}
+
+func TestLabelCount(t *testing.T) {
+	defer func() {
+		if recover() == nil {
+			t.Errorf("counter with wrong label count should panic")
+		}
+	}()
+	NewCounter("test_labels_total", "Labels.", "branch").Inc()
+}
@@ -0,0 +1,182 @@
+// Package nuget pull symbol packages from an NuGet v3 feed. Symbol packages (.snupkg or the
+// legacy .symbols.nupkg) are zip files holding the portable pdbs of the package.
+//
+package nuget
+
+import (
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/adyzng/GoSymbols/config"
+	"github.com/adyzng/GoSymbols/fault"
+	log "gopkg.in/clog.v1"
+)
+
+const (
+	baseAddressType = "PackageBaseAddress/3.0.0" // flat container resource of service index
+)
+
+var (
+	ErrNoPackage = fmt.Errorf("no symbol package on feed")
+
+	// symbol package kinds tried in order, the package itself may carry pdbs too
+	packageExts = []string{".snupkg", ".symbols.nupkg", ".nupkg"}
+)
+
+var (
+	mx    sync.Mutex
+	feeds = make(map[string]*Feed) // feed url => feed
+)
+
+// Feed is an NuGet v3 feed, eg: https://nuget.example.com/v3/index.json
+//
+type Feed struct {
+	URL  string
+	http *http.Client
+	mx   sync.Mutex
+	base string // flat container address, resolved from service index on first use
+}
+
+// Open return the feed of `url`, feeds are shared by branches pulling from the same url.
+//
+func Open(url string) *Feed {
+	mx.Lock()
+	defer mx.Unlock()
+	if f, ok := feeds[url]; ok {
+		return f
+	}
+	f := &Feed{
+		URL: url,
+		http: &http.Client{
+			Timeout:   time.Duration(config.NuGetTimeout) * time.Second,
+			Transport: fault.Transport(fault.Network, nil),
+		},
+	}
+	feeds[url] = f
+	return f
+}
+
+func (f *Feed) get(url string) (*http.Response, error) {
+	req, err := http.NewRequest("GET", url, nil)
+	if err != nil {
+		return nil, err
+	}
+	if config.NuGetToken != "" {
+		// Azure Artifacts, ProGet and most internal feeds accept a token as basic auth password
+		req.SetBasicAuth(config.NuGetUser, config.NuGetToken)
+	}
+	resp, err := f.http.Do(req)
+	if err != nil {
+		return nil, err
+	}
+	if resp.StatusCode != http.StatusOK {
+		resp.Body.Close()
+		return resp, fmt.Errorf("GET %s response %s", url, resp.Status)
+	}
+	return resp, nil
+}
+
+func (f *Feed) getJSON(url string, out interface{}) error {
+	resp, err := f.get(url)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+	return json.NewDecoder(resp.Body).Decode(out)
+}
+
+// baseAddress resolve flat container address from service index. An url not ending with
+// `index.json` is taken as the flat container itself.
+func (f *Feed) baseAddress() (string, error) {
+	f.mx.Lock()
+	defer f.mx.Unlock()
+	if f.base != "" {
+		return f.base, nil
+	}
+	if !strings.HasSuffix(strings.ToLower(f.URL), "index.json") {
+		f.base = strings.TrimRight(f.URL, "/")
+		return f.base, nil
+	}
+
+	var index struct {
+		Resources []struct {
+			ID   string `json:"@id"`
+			Type string `json:"@type"`
+		} `json:"resources"`
+	}
+	if err := f.getJSON(f.URL, &index); err != nil {
+		return "", err
+	}
+	for _, res := range index.Resources {
+		if res.Type == baseAddressType {
+			f.base = strings.TrimRight(res.ID, "/")
+			return f.base, nil
+		}
+	}
+	return "", fmt.Errorf("feed %s has no %s resource", f.URL, baseAddressType)
+}
+
+// Versions return versions of package `id`, oldest first as the feed list them.
+//
+func (f *Feed) Versions(id string) ([]string, error) {
+	base, err := f.baseAddress()
+	if err != nil {
+		return nil, err
+	}
+	var list struct {
+		Versions []string `json:"versions"`
+	}
+	if err = f.getJSON(fmt.Sprintf("%s/%s/index.json", base, strings.ToLower(id)), &list); err != nil {
+		return nil, err
+	}
+	return list.Versions, nil
+}
+
+// Latest return the latest version of package `id`, prerelease versions are skipped
+// unless `[nuget] PRERELEASE`.
+//
+func (f *Feed) Latest(id string) (string, error) {
+	versions, err := f.Versions(id)
+	if err != nil {
+		return "", err
+	}
+	for i := len(versions) - 1; i >= 0; i-- {
+		if config.NuGetPrerelease || !strings.Contains(versions[i], "-") {
+			return versions[i], nil
+		}
+	}
+	return "", ErrNoPackage
+}
+
+// Download write the symbol package of `id` `version` to `w`, return the package file name.
+//
+func (f *Feed) Download(id, version string, w io.Writer) (string, error) {
+	base, err := f.baseAddress()
+	if err != nil {
+		return "", err
+	}
+	lid, lver := strings.ToLower(id), strings.ToLower(version)
+	for _, ext := range packageExts {
+		name := lid + "." + lver + ext
+		resp, err := f.get(fmt.Sprintf("%s/%s/%s/%s", base, lid, lver, name))
+		if resp != nil && resp.StatusCode == http.StatusNotFound {
+			continue
+		}
+		if err != nil {
+			return "", err
+		}
+		n, err := io.Copy(w, resp.Body)
+		resp.Body.Close()
+		if err != nil {
+			return "", err
+		}
+		log.Info("[NuGet] Download %s (%d bytes) from %s.", name, n, f.URL)
+		return name, nil
+	}
+	return "", ErrNoPackage
+}
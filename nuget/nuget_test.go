@@ -0,0 +1,54 @@
+package nuget
+
+import (
+	"bytes"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/adyzng/GoSymbols/config"
+)
+
+func TestFeed(t *testing.T) {
+	var srv *httptest.Server
+	srv = httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		switch r.URL.Path {
+		case "/v3/index.json":
+			fmt.Fprintf(w, `{"version":"3.0.0","resources":[`+
+				`{"@id":"%s/search","@type":"SearchQueryService"},`+
+				`{"@id":"%s/flat/","@type":"PackageBaseAddress/3.0.0"}]}`, srv.URL, srv.URL)
+		case "/flat/foo.core/index.json":
+			w.Write([]byte(`{"versions":["1.0.0","1.1.0","1.2.0-beta.1"]}`))
+		case "/flat/foo.core/1.1.0/foo.core.1.1.0.symbols.nupkg":
+			w.Write([]byte("symbols"))
+		default:
+			http.NotFound(w, r)
+		}
+	}))
+	defer srv.Close()
+
+	f := Open(srv.URL + "/v3/index.json")
+	if Open(f.URL) != f {
+		t.Errorf("feed of same url should be shared")
+	}
+	ver, err := f.Latest("Foo.Core")
+	if err != nil || ver != "1.1.0" {
+		t.Fatalf("expect latest 1.1.0, got %s (%v)", ver, err)
+	}
+	config.NuGetPrerelease = true
+	ver, _ = f.Latest("Foo.Core")
+	config.NuGetPrerelease = false
+	if ver != "1.2.0-beta.1" {
+		t.Errorf("expect prerelease 1.2.0-beta.1, got %s", ver)
+	}
+
+	var buf bytes.Buffer
+	name, err := f.Download("Foo.Core", "1.1.0", &buf)
+	if err != nil || name != "foo.core.1.1.0.symbols.nupkg" || buf.String() != "symbols" {
+		t.Fatalf("expect legacy symbol package, got %s %q (%v)", name, buf.String(), err)
+	}
+	if _, err = f.Download("Foo.Core", "1.0.0", &buf); err != ErrNoPackage {
+		t.Errorf("expect no package, got %v", err)
+	}
+}
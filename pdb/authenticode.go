@@ -0,0 +1,437 @@
+package pdb
+
+import (
+	"bytes"
+	"crypto"
+	"crypto/ecdsa"
+	"crypto/rsa"
+	_ "crypto/sha1" // digest of older Authenticode signatures
+	_ "crypto/sha256"
+	_ "crypto/sha512"
+	"crypto/x509"
+	"encoding/asn1"
+	"encoding/binary"
+	"fmt"
+	"io"
+	"math/big"
+	"path/filepath"
+	"strings"
+	"time"
+)
+
+// Signing status of PE binaries
+const (
+	SignUnsigned = "unsigned" // no embedded Authenticode signature
+	SignSigned   = "signed"   // image digest and signature verified, chain not verified
+	SignValid    = "valid"    // verified by signtool
+	SignInvalid  = "invalid"  // malformed, modified after signing, signer certificate expired, or rejected by signtool
+)
+
+var (
+	oidSignedData       = asn1.ObjectIdentifier{1, 2, 840, 113549, 1, 7, 2}
+	oidSigningTime      = asn1.ObjectIdentifier{1, 2, 840, 113549, 1, 9, 5}
+	oidCounterSignature = asn1.ObjectIdentifier{1, 2, 840, 113549, 1, 9, 6}
+	oidRFC3161Timestamp = asn1.ObjectIdentifier{1, 3, 6, 1, 4, 1, 311, 3, 3, 1}
+	oidMessageDigest    = asn1.ObjectIdentifier{1, 2, 840, 113549, 1, 9, 4}
+	oidSpcIndirectData  = asn1.ObjectIdentifier{1, 3, 6, 1, 4, 1, 311, 2, 1, 4}
+
+	digestOIDs = []struct {
+		oid  asn1.ObjectIdentifier
+		hash crypto.Hash
+	}{
+		{asn1.ObjectIdentifier{1, 3, 14, 3, 2, 26}, crypto.SHA1},
+		{asn1.ObjectIdentifier{2, 16, 840, 1, 101, 3, 4, 2, 1}, crypto.SHA256},
+		{asn1.ObjectIdentifier{2, 16, 840, 1, 101, 3, 4, 2, 2}, crypto.SHA384},
+		{asn1.ObjectIdentifier{2, 16, 840, 1, 101, 3, 4, 2, 3}, crypto.SHA512},
+	}
+)
+
+// SignInfo is the Authenticode signature status of an PE binary
+//
+type SignInfo struct {
+	Status    string `json:"status"`
+	Signer    string `json:"signer,omitempty"`
+	Timestamp string `json:"timestamp,omitempty"`
+	Error     string `json:"error,omitempty"`
+}
+
+// IsBinary check if file is an PE binary by extension.
+//
+func IsBinary(name string) bool {
+	switch strings.ToLower(filepath.Ext(name)) {
+	case ".dll", ".exe", ".sys", ".ocx", ".drv":
+		return true
+	}
+	return false
+}
+
+// ReadSignInfo parse the embedded Authenticode signature of PE binary, and verify the image
+// digest and the signature of signer. The certificate chain is not verified, only the signer
+// certificate validity at signing time.
+//
+func ReadSignInfo(r io.ReaderAt) (*SignInfo, error) {
+	img, err := certificateTable(r)
+	if err != nil {
+		return nil, err
+	}
+	if img.cert == nil {
+		return &SignInfo{Status: SignUnsigned}, nil
+	}
+
+	info := &SignInfo{Status: SignSigned}
+	cert, when, err := parsePKCS7(img.cert)
+	if err == nil {
+		err = verifyDigest(r, img, cert)
+	}
+	if err != nil {
+		info.Status = SignInvalid
+		info.Error = err.Error()
+		if cert != nil {
+			info.Signer = cert.Subject.CommonName
+		}
+		return info, nil
+	}
+	info.Signer = cert.Subject.CommonName
+	check := time.Now()
+	if !when.IsZero() {
+		info.Timestamp = when.Format("2006-01-02 15:04:05")
+		check = when
+	}
+	if check.Before(cert.NotBefore) || check.After(cert.NotAfter) {
+		info.Status = SignInvalid
+		info.Error = "signer certificate not valid at signing time"
+	}
+	return info, nil
+}
+
+// peImage locate the fields excluded from the Authenticode image digest
+type peImage struct {
+	checksumAt int64  // CheckSum of optional header
+	dirAt      int64  // security data directory
+	certAt     int64  // certificate table
+	certSize   int64  // bytes of certificate table
+	cert       []byte // first WIN_CERTIFICATE content, nil if not signed
+}
+
+// certificateTable locate the Authenticode fields of PE file, `cert` is nil if not signed
+func certificateTable(r io.ReaderAt) (*peImage, error) {
+	buf := make([]byte, 4)
+	if _, err := r.ReadAt(buf, 0x3C); err != nil {
+		return nil, ErrUnknownFormat
+	}
+	off := int64(binary.LittleEndian.Uint32(buf))
+
+	hdr := make([]byte, 24+2)
+	if _, err := r.ReadAt(hdr, off); err != nil {
+		return nil, ErrCorrupted
+	}
+	if !bytes.Equal(hdr[:4], []byte("PE\x00\x00")) {
+		return nil, ErrUnknownFormat
+	}
+
+	// security directory is the 5th data directory of optional header
+	opt := off + 24
+	var countAt, dirAt int64
+	switch binary.LittleEndian.Uint16(hdr[24:]) {
+	case 0x10b: // PE32
+		countAt, dirAt = opt+92, opt+96+4*8
+	case 0x20b: // PE32+
+		countAt, dirAt = opt+108, opt+112+4*8
+	default:
+		return nil, ErrCorrupted
+	}
+	if _, err := r.ReadAt(buf, countAt); err != nil {
+		return nil, ErrCorrupted
+	}
+	img := &peImage{checksumAt: opt + 64, dirAt: dirAt}
+	if binary.LittleEndian.Uint32(buf) < 5 {
+		return img, nil
+	}
+	dir := make([]byte, 8)
+	if _, err := r.ReadAt(dir, dirAt); err != nil {
+		return nil, ErrCorrupted
+	}
+	addr, size := binary.LittleEndian.Uint32(dir), binary.LittleEndian.Uint32(dir[4:])
+	if addr == 0 || size < 8 {
+		return img, nil
+	}
+	if size > 16<<20 {
+		return nil, ErrCorrupted
+	}
+
+	// WIN_CERTIFICATE: dwLength, wRevision, wCertificateType, bCertificate
+	cert := make([]byte, size)
+	if _, err := r.ReadAt(cert, int64(addr)); err != nil && err != io.EOF {
+		return nil, ErrCorrupted
+	}
+	length := binary.LittleEndian.Uint32(cert)
+	if length < 8 || length > size {
+		return nil, ErrCorrupted
+	}
+	img.certAt, img.certSize, img.cert = int64(addr), int64(size), cert[8:length]
+	return img, nil
+}
+
+// imageDigest hash the PE file except the checksum, the security directory and the
+// certificate table, as Authenticode does for files with sections in order.
+func imageDigest(r io.ReaderAt, img *peImage, h crypto.Hash) ([]byte, error) {
+	hash := h.New()
+	for _, part := range [][2]int64{
+		{0, img.checksumAt},
+		{img.checksumAt + 4, img.dirAt},
+		{img.dirAt + 8, img.certAt},
+		{img.certAt + img.certSize, 1 << 62},
+	} {
+		if part[1] <= part[0] {
+			continue
+		}
+		if _, err := io.Copy(hash, io.NewSectionReader(r, part[0], part[1]-part[0])); err != nil {
+			return nil, err
+		}
+	}
+	return hash.Sum(nil), nil
+}
+
+type algorithmIdentifier struct {
+	Algorithm  asn1.ObjectIdentifier
+	Parameters asn1.RawValue `asn1:"optional"`
+}
+
+type spcIndirectData struct {
+	Data          asn1.RawValue
+	MessageDigest struct {
+		Algorithm asn1.RawValue
+		Digest    []byte
+	}
+}
+
+// digestHash return the hash of digest algorithm identifier `der`
+func digestHash(der []byte) (crypto.Hash, error) {
+	var alg algorithmIdentifier
+	if _, err := asn1.Unmarshal(der, &alg); err != nil {
+		return 0, err
+	}
+	for _, d := range digestOIDs {
+		if d.oid.Equal(alg.Algorithm) {
+			return d.hash, nil
+		}
+	}
+	return 0, fmt.Errorf("unsupported digest algorithm %v", alg.Algorithm)
+}
+
+// checkSignature verify `sig` of `signed` by the key of `cert`. SHA1 signatures of older
+// binaries are still accepted, unlike x509.Certificate.CheckSignature.
+func checkSignature(cert *x509.Certificate, h crypto.Hash, signed, sig []byte) error {
+	sum := h.New()
+	sum.Write(signed)
+	switch key := cert.PublicKey.(type) {
+	case *rsa.PublicKey:
+		return rsa.VerifyPKCS1v15(key, h, sum.Sum(nil), sig)
+	case *ecdsa.PublicKey:
+		if !ecdsa.VerifyASN1(key, sum.Sum(nil), sig) {
+			return fmt.Errorf("ecdsa verification failure")
+		}
+		return nil
+	}
+	return fmt.Errorf("unsupported signer key %v", cert.PublicKeyAlgorithm)
+}
+
+// verifyDigest check the image digest signed in SpcIndirectDataContent match the file,
+// the messageDigest attribute match the content, and the signer signed the attributes.
+func verifyDigest(r io.ReaderAt, img *peImage, cert *x509.Certificate) error {
+	sd, err := parseSignedData(img.cert)
+	if err != nil {
+		return err
+	}
+	var ci contentInfo
+	if _, err = asn1.Unmarshal(sd.ContentInfo.FullBytes, &ci); err != nil {
+		return err
+	}
+	if !ci.ContentType.Equal(oidSpcIndirectData) {
+		return fmt.Errorf("not an Authenticode signature")
+	}
+	var spc spcIndirectData
+	if _, err = asn1.Unmarshal(ci.Content.Bytes, &spc); err != nil {
+		return err
+	}
+	h, err := digestHash(spc.MessageDigest.Algorithm.FullBytes)
+	if err != nil {
+		return err
+	}
+	digest, err := imageDigest(r, img, h)
+	if err != nil {
+		return err
+	}
+	if !bytes.Equal(digest, spc.MessageDigest.Digest) {
+		return fmt.Errorf("image digest mismatch, modified after signing")
+	}
+
+	// messageDigest is taken on the content octets of SpcIndirectDataContent
+	si := sd.SignerInfos[0]
+	if h, err = digestHash(si.DigestAlgorithm.FullBytes); err != nil {
+		return err
+	}
+	var content asn1.RawValue
+	if _, err = asn1.Unmarshal(ci.Content.Bytes, &content); err != nil {
+		return err
+	}
+	sum := h.New()
+	sum.Write(content.Bytes)
+	var signed []byte
+	for _, a := range attributes(si.AuthAttributes.Bytes) {
+		if a.Type.Equal(oidMessageDigest) {
+			asn1.Unmarshal(a.Values.Bytes, &signed)
+		}
+	}
+	if signed == nil || !bytes.Equal(signed, sum.Sum(nil)) {
+		return fmt.Errorf("message digest mismatch")
+	}
+
+	// authenticated attributes are signed as SET OF, not the implicit [0] tag
+	attrs := append([]byte{}, si.AuthAttributes.FullBytes...)
+	attrs[0] = 0x31
+	if err = checkSignature(cert, h, attrs, si.EncryptedDigest); err != nil {
+		return fmt.Errorf("signature not verified: %v", err)
+	}
+	return nil
+}
+
+type contentInfo struct {
+	ContentType asn1.ObjectIdentifier
+	Content     asn1.RawValue `asn1:"explicit,optional,tag:0"`
+}
+
+type signedData struct {
+	Version          int
+	DigestAlgorithms asn1.RawValue
+	ContentInfo      asn1.RawValue
+	Certificates     asn1.RawValue `asn1:"optional,tag:0"`
+	CRLs             asn1.RawValue `asn1:"optional,tag:1"`
+	SignerInfos      []signerInfo  `asn1:"set"`
+}
+
+type issuerAndSerial struct {
+	Issuer asn1.RawValue
+	Serial *big.Int
+}
+
+type signerInfo struct {
+	Version            int
+	IssuerAndSerial    issuerAndSerial
+	DigestAlgorithm    asn1.RawValue
+	AuthAttributes     asn1.RawValue `asn1:"optional,tag:0"`
+	DigestEncAlgorithm asn1.RawValue
+	EncryptedDigest    []byte
+	UnauthAttributes   asn1.RawValue `asn1:"optional,tag:1"`
+}
+
+type attribute struct {
+	Type   asn1.ObjectIdentifier
+	Values asn1.RawValue `asn1:"set"`
+}
+
+type tstInfo struct {
+	Version        int
+	Policy         asn1.ObjectIdentifier
+	MessageImprint asn1.RawValue
+	Serial         *big.Int
+	GenTime        time.Time `asn1:"generalized"`
+}
+
+func parseSignedData(der []byte) (*signedData, error) {
+	var ci contentInfo
+	if _, err := asn1.Unmarshal(der, &ci); err != nil {
+		return nil, err
+	}
+	if !ci.ContentType.Equal(oidSignedData) {
+		return nil, fmt.Errorf("not pkcs7 signed data")
+	}
+	var sd signedData
+	if _, err := asn1.Unmarshal(ci.Content.Bytes, &sd); err != nil {
+		return nil, err
+	}
+	if len(sd.SignerInfos) == 0 {
+		return nil, fmt.Errorf("no signer")
+	}
+	return &sd, nil
+}
+
+// parsePKCS7 return the signer certificate and signing time (zero if not timestamped)
+func parsePKCS7(der []byte) (*x509.Certificate, time.Time, error) {
+	sd, err := parseSignedData(der)
+	if err != nil {
+		return nil, time.Time{}, err
+	}
+	certs, err := x509.ParseCertificates(sd.Certificates.Bytes)
+	if err != nil {
+		return nil, time.Time{}, err
+	}
+
+	si := sd.SignerInfos[0]
+	var signer *x509.Certificate
+	for _, c := range certs {
+		if c.SerialNumber.Cmp(si.IssuerAndSerial.Serial) == 0 &&
+			bytes.Equal(c.RawIssuer, si.IssuerAndSerial.Issuer.FullBytes) {
+			signer = c
+			break
+		}
+	}
+	if signer == nil {
+		return nil, time.Time{}, fmt.Errorf("signer certificate not found")
+	}
+	return signer, signingTime(si.UnauthAttributes.Bytes), nil
+}
+
+func attributes(data []byte) []attribute {
+	var attrs []attribute
+	for len(data) > 0 {
+		var a attribute
+		rest, err := asn1.Unmarshal(data, &a)
+		if err != nil {
+			break
+		}
+		attrs = append(attrs, a)
+		data = rest
+	}
+	return attrs
+}
+
+// signingTime read time from legacy counter signature or RFC3161 timestamp
+func signingTime(unauth []byte) time.Time {
+	for _, a := range attributes(unauth) {
+		switch {
+		case a.Type.Equal(oidCounterSignature):
+			var cs signerInfo
+			if _, err := asn1.Unmarshal(a.Values.Bytes, &cs); err != nil {
+				continue
+			}
+			for _, aa := range attributes(cs.AuthAttributes.Bytes) {
+				var t time.Time
+				if aa.Type.Equal(oidSigningTime) {
+					if _, err := asn1.Unmarshal(aa.Values.Bytes, &t); err == nil {
+						return t
+					}
+				}
+			}
+
+		case a.Type.Equal(oidRFC3161Timestamp):
+			sd, err := parseSignedData(a.Values.Bytes)
+			if err != nil {
+				continue
+			}
+			var eci contentInfo
+			var content []byte
+			if _, err = asn1.Unmarshal(sd.ContentInfo.FullBytes, &eci); err != nil {
+				continue
+			}
+			if _, err = asn1.Unmarshal(eci.Content.Bytes, &content); err != nil {
+				continue
+			}
+			var tst tstInfo
+			if _, err = asn1.Unmarshal(content, &tst); err == nil {
+				return tst.GenTime
+			}
+		}
+	}
+	return time.Time{}
+}
@@ -0,0 +1,180 @@
+package pdb
+
+import (
+	"bytes"
+	"crypto"
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/sha256"
+	"crypto/x509"
+	"crypto/x509/pkix"
+	"encoding/asn1"
+	"encoding/binary"
+	"math/big"
+	"strings"
+	"testing"
+	"time"
+)
+
+func rawSet(items ...[]byte) asn1.RawValue {
+	der, _ := asn1.Marshal(asn1.RawValue{
+		Class:      asn1.ClassUniversal,
+		Tag:        asn1.TagSet,
+		IsCompound: true,
+		Bytes:      bytes.Join(items, nil),
+	})
+	return asn1.RawValue{FullBytes: der}
+}
+
+func implicit(tag int, items ...[]byte) asn1.RawValue {
+	return asn1.RawValue{
+		Class:      asn1.ClassContextSpecific,
+		Tag:        tag,
+		IsCompound: true,
+		Bytes:      bytes.Join(items, nil),
+	}
+}
+
+// fakeSignature build an Authenticode signature of image `digest` (sha256) with counter
+// signature time `when`
+func fakeSignature(t *testing.T, when time.Time, digest []byte) []byte {
+	key, _ := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	tmpl := &x509.Certificate{
+		SerialNumber: big.NewInt(42),
+		Subject:      pkix.Name{CommonName: "Arcserve (USA) LLC"},
+		NotBefore:    time.Date(2017, 1, 1, 0, 0, 0, 0, time.UTC),
+		NotAfter:     time.Date(2019, 1, 1, 0, 0, 0, 0, time.UTC),
+	}
+	certDER, err := x509.CreateCertificate(rand.Reader, tmpl, tmpl, &key.PublicKey, key)
+	if err != nil {
+		t.Fatal(err)
+	}
+	cert, _ := x509.ParseCertificate(certDER)
+	null, _ := asn1.Marshal(asn1.RawValue{Tag: asn1.TagSequence, IsCompound: true})
+
+	sha256Alg, _ := asn1.Marshal(algorithmIdentifier{Algorithm: digestOIDs[1].oid})
+	var spc spcIndirectData
+	spc.Data = asn1.RawValue{FullBytes: null}
+	spc.MessageDigest.Algorithm = asn1.RawValue{FullBytes: sha256Alg}
+	spc.MessageDigest.Digest = digest
+	spcDER, _ := asn1.Marshal(spc)
+	content, _ := asn1.Marshal(contentInfo{
+		ContentType: oidSpcIndirectData,
+		Content:     asn1.RawValue{Class: asn1.ClassContextSpecific, Tag: 0, IsCompound: true, Bytes: spcDER},
+	})
+	var spcRaw asn1.RawValue
+	asn1.Unmarshal(spcDER, &spcRaw)
+	msgDigest := sha256.Sum256(spcRaw.Bytes)
+	octets, _ := asn1.Marshal(msgDigest[:])
+	auth, _ := asn1.Marshal(attribute{Type: oidMessageDigest, Values: rawSet(octets)})
+	signed := sha256.Sum256(rawSet(auth).FullBytes)
+	sig, err := ecdsa.SignASN1(rand.Reader, key, signed[:])
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	stime, _ := asn1.Marshal(when)
+	attr, _ := asn1.Marshal(attribute{Type: oidSigningTime, Values: rawSet(stime)})
+	counter, _ := asn1.Marshal(signerInfo{
+		Version:            1,
+		IssuerAndSerial:    issuerAndSerial{Issuer: asn1.RawValue{FullBytes: cert.RawIssuer}, Serial: big.NewInt(1)},
+		DigestAlgorithm:    asn1.RawValue{FullBytes: null},
+		AuthAttributes:     implicit(0, attr),
+		DigestEncAlgorithm: asn1.RawValue{FullBytes: null},
+		EncryptedDigest:    []byte{1},
+	})
+	unauth, _ := asn1.Marshal(attribute{Type: oidCounterSignature, Values: rawSet(counter)})
+
+	si, _ := asn1.Marshal(signerInfo{
+		Version:            1,
+		IssuerAndSerial:    issuerAndSerial{Issuer: asn1.RawValue{FullBytes: cert.RawIssuer}, Serial: cert.SerialNumber},
+		DigestAlgorithm:    asn1.RawValue{FullBytes: sha256Alg},
+		AuthAttributes:     implicit(0, auth),
+		DigestEncAlgorithm: asn1.RawValue{FullBytes: null},
+		EncryptedDigest:    sig,
+		UnauthAttributes:   implicit(1, unauth),
+	})
+	sd, err := asn1.Marshal(struct {
+		Version          int
+		DigestAlgorithms asn1.RawValue
+		ContentInfo      asn1.RawValue
+		Certificates     asn1.RawValue
+		SignerInfos      asn1.RawValue
+	}{1, rawSet(), asn1.RawValue{FullBytes: content}, implicit(0, certDER), rawSet(si)})
+	if err != nil {
+		t.Fatal(err)
+	}
+	der, err := asn1.Marshal(contentInfo{
+		ContentType: oidSignedData,
+		Content:     asn1.RawValue{Class: asn1.ClassContextSpecific, Tag: 0, IsCompound: true, Bytes: sd},
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	return der
+}
+
+// fakePE32 build an PE32 header with optional certificate table
+func fakePE32(cert []byte) []byte {
+	file := make([]byte, 512, 512+8+len(cert))
+	le := binary.LittleEndian
+	copy(file, "MZ")
+	le.PutUint32(file[0x3C:], 0x80)
+	copy(file[0x80:], "PE\x00\x00")
+	opt := 0x80 + 24
+	le.PutUint16(file[opt:], 0x10b)
+	le.PutUint32(file[opt+92:], 16)
+	if cert != nil {
+		le.PutUint32(file[opt+96+32:], 512)
+		le.PutUint32(file[opt+96+36:], uint32(8+len(cert)))
+		hdr := make([]byte, 8)
+		le.PutUint32(hdr, uint32(8+len(cert)))
+		le.PutUint16(hdr[4:], 0x0200)
+		le.PutUint16(hdr[6:], 2)
+		file = append(append(file, hdr...), cert...)
+	}
+	return file
+}
+
+func TestSignInfo(t *testing.T) {
+	info, err := ReadSignInfo(bytes.NewReader(fakePE32(nil)))
+	if err != nil || info.Status != SignUnsigned {
+		t.Fatalf("expect unsigned, got %+v (%v)", info, err)
+	}
+
+	// the digest doesn't cover the certificate table
+	img, err := certificateTable(bytes.NewReader(fakePE32([]byte("placeholder"))))
+	if err != nil {
+		t.Fatal(err)
+	}
+	digest, _ := imageDigest(bytes.NewReader(fakePE32([]byte("placeholder"))), img, crypto.SHA256)
+
+	when := time.Date(2017, 10, 22, 5, 16, 24, 0, time.UTC)
+	info, err = ReadSignInfo(bytes.NewReader(fakePE32(fakeSignature(t, when, digest))))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if info.Status != SignSigned || info.Signer != "Arcserve (USA) LLC" || info.Timestamp == "" {
+		t.Fatalf("unexpected sign info %+v", info)
+	}
+
+	// modified after signing
+	file := fakePE32(fakeSignature(t, when, digest))
+	file[0x40] ^= 1
+	info, _ = ReadSignInfo(bytes.NewReader(file))
+	if info.Status != SignInvalid || !strings.Contains(info.Error, "digest mismatch") {
+		t.Fatalf("expect digest mismatch, got %+v", info)
+	}
+
+	// signed after the certificate expired
+	info, _ = ReadSignInfo(bytes.NewReader(fakePE32(fakeSignature(t, when.AddDate(3, 0, 0), digest))))
+	if info.Status != SignInvalid {
+		t.Fatalf("expect invalid, got %+v", info)
+	}
+
+	info, _ = ReadSignInfo(bytes.NewReader(fakePE32([]byte("garbage"))))
+	if info.Status != SignInvalid {
+		t.Fatalf("expect invalid, got %+v", info)
+	}
+}
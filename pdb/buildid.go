@@ -0,0 +1,105 @@
+package pdb
+
+import (
+	"bytes"
+	"debug/elf"
+	"encoding/binary"
+	"encoding/hex"
+	"fmt"
+	"io"
+	"strings"
+)
+
+var (
+	ErrNoBuildID = fmt.Errorf("binary has no build id")
+	ErrStripped  = fmt.Errorf("binary is stripped")
+
+	elfMagic = []byte(elf.ELFMAG)
+)
+
+const (
+	gnuBuildIDPrefix = "elf-buildid-" // ssqp key of gnu build-id
+	goBuildIDPrefix  = "go-buildid-"  // go build id, `/` replaced by `.` to be a folder name
+
+	noteGNUBuildID = 3 // NT_GNU_BUILD_ID
+	noteGoBuildID  = 4 // note type of .note.go.buildid
+)
+
+// IsELF check if `r` start with ELF magic.
+//
+func IsELF(r io.ReaderAt) bool {
+	head := make([]byte, len(elfMagic))
+	_, err := r.ReadAt(head, 0)
+	return err == nil && bytes.Equal(head, elfMagic)
+}
+
+// ReadBuildID return the store key of an unstripped ELF binary, from its GNU build-id if
+// exist or else its Go build id. Binaries without DWARF nor Go pclntab are ErrStripped.
+//
+func ReadBuildID(r io.ReaderAt) (string, error) {
+	f, err := elf.NewFile(r)
+	if err != nil {
+		return "", ErrUnknownFormat
+	}
+	defer f.Close()
+
+	var gnuID, goID string
+	debug := false
+	for _, sec := range f.Sections {
+		switch sec.Name {
+		case ".debug_info", ".zdebug_info", ".gopclntab":
+			debug = true
+		}
+		if sec.Type != elf.SHT_NOTE {
+			continue
+		}
+		data, err := sec.Data()
+		if err != nil {
+			return "", ErrCorrupted
+		}
+		readNotes(data, f.ByteOrder, func(name string, typ uint32, desc []byte) {
+			switch {
+			case name == "GNU" && typ == noteGNUBuildID && gnuID == "":
+				gnuID = hex.EncodeToString(desc)
+			case name == "Go" && typ == noteGoBuildID && goID == "":
+				goID = string(desc)
+			}
+		})
+	}
+	if !debug {
+		return "", ErrStripped
+	}
+	switch {
+	case gnuID != "":
+		return gnuBuildIDPrefix + gnuID, nil
+	case goID != "":
+		return BuildIDKey(goID), nil
+	}
+	return "", ErrNoBuildID
+}
+
+// readNotes walk ELF notes of a SHT_NOTE section, name and desc are 4 bytes aligned
+func readNotes(data []byte, order binary.ByteOrder, handler func(name string, typ uint32, desc []byte)) {
+	align := func(n uint32) uint32 { return (n + 3) &^ 3 }
+	for len(data) >= 12 {
+		nameSize, descSize, typ := order.Uint32(data[0:4]), order.Uint32(data[4:8]), order.Uint32(data[8:12])
+		data = data[12:]
+		if uint64(align(nameSize))+uint64(align(descSize)) > uint64(len(data)) {
+			return
+		}
+		name := strings.TrimRight(string(data[:nameSize]), "\x00")
+		data = data[align(nameSize):]
+		handler(name, typ, data[:descSize])
+		data = data[align(descSize):]
+	}
+}
+
+// BuildIDKey return the store key of build id as debuggers ask for it, hex for GNU build-id
+// (as pprof and debuginfod clients use) or the Go build id `{action id}/{content id}`.
+//
+func BuildIDKey(id string) string {
+	if _, err := hex.DecodeString(id); err == nil {
+		return gnuBuildIDPrefix + strings.ToLower(id)
+	}
+	return goBuildIDPrefix + strings.Replace(id, "/", ".", -1)
+}
@@ -0,0 +1,42 @@
+package pdb
+
+import (
+	"os"
+	"strings"
+	"testing"
+)
+
+func TestBuildIDKey(t *testing.T) {
+	for id, expect := range map[string]string{
+		"5F0A3C9B2D":           "elf-buildid-5f0a3c9b2d",
+		"abc_-1/def-2/ghi/jkl": "go-buildid-abc_-1.def-2.ghi.jkl",
+	} {
+		if key := BuildIDKey(id); key != expect {
+			t.Errorf("expect key %s of %s, got %s", expect, id, key)
+		}
+	}
+}
+
+func TestReadBuildID(t *testing.T) {
+	exe, err := os.Executable()
+	if err != nil {
+		t.Skip(err)
+	}
+	fd, err := os.Open(exe)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer fd.Close()
+	if !IsELF(fd) {
+		t.Skip("test binary is not ELF")
+	}
+
+	// the test binary is an unstripped Go binary
+	key, err := ReadKey(fd)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !strings.HasPrefix(key, goBuildIDPrefix) && !strings.HasPrefix(key, gnuBuildIDPrefix) {
+		t.Errorf("unexpected key %s", key)
+	}
+}
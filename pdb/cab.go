@@ -0,0 +1,282 @@
+package pdb
+
+import (
+	"bytes"
+	"compress/flate"
+	"encoding/binary"
+	"fmt"
+	"io"
+	"time"
+)
+
+// Cabinet files stored by `symstore.exe add /compress` or makecab.exe hold one symbol file.
+// Only MSZIP and uncompressed cabinets are read and written, LZX ones are refused.
+
+var (
+	ErrInvalidCab     = fmt.Errorf("not a cabinet file")
+	ErrCabUnsupported = fmt.Errorf("cabinet not supported, only single MSZIP cabinets")
+	ErrCabTooLarge    = fmt.Errorf("file too large for a cabinet")
+)
+
+const (
+	cabBlock    = 32768      // uncompressed bytes of each CFDATA, also the MSZIP window
+	cabMaxFile  = 0x7FFF8000 // max uncompressed bytes of a folder
+	cabHeader   = 36         // CFHEADER without reserve
+	cabFolder   = 8          // CFFOLDER without reserve
+	cabFileHead = 16         // CFFILE without name
+	cabDataHead = 8          // CFDATA without reserve
+
+	cabTypeNone  = 0
+	cabTypeMSZIP = 1
+
+	cabFlagPrev    = 0x1
+	cabFlagNext    = 0x2
+	cabFlagReserve = 0x4
+
+	cabAttrArchive = 0x20
+	cabAttrUTF8    = 0x80
+)
+
+// dosTime encode `t` as the date and time of CFFILE
+func dosTime(t time.Time) (uint16, uint16) {
+	if t.Year() < 1980 {
+		return 1<<5 | 1, 0
+	}
+	date := uint16(t.Year()-1980)<<9 | uint16(t.Month())<<5 | uint16(t.Day())
+	tm := uint16(t.Hour())<<11 | uint16(t.Minute())<<5 | uint16(t.Second()/2)
+	return date, tm
+}
+
+// WriteCab compress `src` into `dst` as the only file `name` of an MSZIP cabinet, the same
+// as `makecab.exe`. Files over 2GB don't fit in a cabinet, ErrCabTooLarge is returned.
+//
+func WriteCab(dst io.WriteSeeker, name string, modTime time.Time, src io.Reader) error {
+	start, err := dst.Seek(0, io.SeekCurrent)
+	if err != nil {
+		return err
+	}
+	attrs := uint16(cabAttrArchive)
+	for _, c := range []byte(name) {
+		if c >= 0x80 {
+			attrs |= cabAttrUTF8
+			break
+		}
+	}
+	date, tm := dosTime(modTime)
+	coffFiles := uint32(cabHeader + cabFolder)
+	coffData := coffFiles + cabFileHead + uint32(len(name)) + 1
+
+	// sizes and block count are patched once the data is written
+	head := &bytes.Buffer{}
+	head.WriteString("MSCF")
+	binary.Write(head, binary.LittleEndian, []uint32{0, 0, 0, coffFiles, 0})
+	head.Write([]byte{3, 1})                                         // version 1.3
+	binary.Write(head, binary.LittleEndian, []uint16{1, 1, 0, 0, 0}) // folders, files, flags, set ID, index
+	binary.Write(head, binary.LittleEndian, coffData)
+	binary.Write(head, binary.LittleEndian, []uint16{0, cabTypeMSZIP})
+	binary.Write(head, binary.LittleEndian, []uint32{0, 0})
+	binary.Write(head, binary.LittleEndian, []uint16{0, date, tm, attrs})
+	head.WriteString(name)
+	head.WriteByte(0)
+	if _, err = dst.Write(head.Bytes()); err != nil {
+		return err
+	}
+
+	var (
+		total  int64
+		blocks uint16
+		window []byte
+		block  = make([]byte, cabBlock)
+		packed = &bytes.Buffer{}
+	)
+	for {
+		n, err := io.ReadFull(src, block)
+		if n == 0 && (err == io.EOF || err == io.ErrUnexpectedEOF) {
+			break
+		} else if err != nil && err != io.ErrUnexpectedEOF {
+			return err
+		}
+		if total += int64(n); total > cabMaxFile {
+			return ErrCabTooLarge
+		}
+
+		// each block is a whole deflate stream, with the previous block as dictionary
+		packed.Reset()
+		packed.WriteString("CK")
+		fw, err := flate.NewWriterDict(packed, flate.DefaultCompression, window)
+		if err != nil {
+			return err
+		}
+		fw.Write(block[:n])
+		if err = fw.Close(); err != nil {
+			return err
+		}
+		binary.Write(dst, binary.LittleEndian, uint32(0)) // checksum not computed
+		binary.Write(dst, binary.LittleEndian, []uint16{uint16(packed.Len()), uint16(n)})
+		if _, err = dst.Write(packed.Bytes()); err != nil {
+			return err
+		}
+		blocks++
+		window = append(window[:0], block[:n]...)
+		if n < cabBlock {
+			break
+		}
+	}
+
+	end, err := dst.Seek(0, io.SeekCurrent)
+	if err != nil {
+		return err
+	}
+	for _, patch := range []struct {
+		off int64
+		val interface{}
+	}{
+		{8, uint32(end - start)},          // cbCabinet
+		{cabHeader + 4, blocks},           // cCFData
+		{int64(coffFiles), uint32(total)}, // cbFile
+	} {
+		if _, err = dst.Seek(start+patch.off, io.SeekStart); err != nil {
+			return err
+		}
+		if err = binary.Write(dst, binary.LittleEndian, patch.val); err != nil {
+			return err
+		}
+	}
+	_, err = dst.Seek(end, io.SeekStart)
+	return err
+}
+
+// CabReader expand the first file of a cabinet, see OpenCab.
+//
+type CabReader struct {
+	Name    string
+	Size    int64
+	ModTime time.Time
+
+	r       io.Reader
+	typ     uint16
+	blocks  int    // CFDATA left
+	reserve int    // reserved bytes of each CFDATA
+	left    int64  // bytes of the file not read yet
+	window  []byte // last expanded block, dictionary of the next one
+	buf     []byte // expanded bytes not read yet
+}
+
+// OpenCab parse the header of cabinet `r`, the first file is then read from the returned
+// reader, eg: foo.pdb from foo.pd_.
+//
+func OpenCab(r io.ReadSeeker) (*CabReader, error) {
+	head := make([]byte, cabHeader)
+	if _, err := io.ReadFull(r, head); err != nil || string(head[:4]) != "MSCF" {
+		return nil, ErrInvalidCab
+	}
+	le := binary.LittleEndian
+	coffFiles := le.Uint32(head[16:])
+	folders, files, flags := le.Uint16(head[26:]), le.Uint16(head[28:]), le.Uint16(head[30:])
+	if folders == 0 || files == 0 || flags&(cabFlagPrev|cabFlagNext) != 0 {
+		return nil, ErrCabUnsupported
+	}
+
+	cbFolder, cbData := 0, 0
+	if flags&cabFlagReserve != 0 {
+		res := make([]byte, 4)
+		if _, err := io.ReadFull(r, res); err != nil {
+			return nil, ErrInvalidCab
+		}
+		cbFolder, cbData = int(res[2]), int(res[3])
+		if _, err := r.Seek(int64(le.Uint16(res)), io.SeekCurrent); err != nil {
+			return nil, err
+		}
+	}
+	folder := make([]byte, cabFolder+cbFolder)
+	if _, err := io.ReadFull(r, folder); err != nil {
+		return nil, ErrInvalidCab
+	}
+	c := &CabReader{
+		r:       r,
+		typ:     le.Uint16(folder[6:]) & 0xF,
+		blocks:  int(le.Uint16(folder[4:])),
+		reserve: cbData,
+	}
+	if c.typ != cabTypeNone && c.typ != cabTypeMSZIP {
+		return nil, ErrCabUnsupported
+	}
+
+	if _, err := r.Seek(int64(coffFiles), io.SeekStart); err != nil {
+		return nil, err
+	}
+	file := make([]byte, cabFileHead+256)
+	n, err := io.ReadAtLeast(r, file, cabFileHead+1)
+	if err != nil {
+		return nil, ErrInvalidCab
+	}
+	end := bytes.IndexByte(file[cabFileHead:n], 0)
+	if end < 0 || le.Uint32(file[4:]) != 0 || le.Uint16(file[8:]) != 0 {
+		// the first file must start the first folder
+		return nil, ErrCabUnsupported
+	}
+	date, tm := le.Uint16(file[10:]), le.Uint16(file[12:])
+	c.Name = string(file[cabFileHead : cabFileHead+end])
+	c.Size = int64(le.Uint32(file))
+	c.left = c.Size
+	c.ModTime = time.Date(int(date>>9)+1980, time.Month(date>>5&0xF), int(date&0x1F),
+		int(tm>>11), int(tm>>5&0x3F), int(tm&0x1F)*2, 0, time.Local)
+
+	if _, err = r.Seek(int64(le.Uint32(folder)), io.SeekStart); err != nil {
+		return nil, err
+	}
+	return c, nil
+}
+
+// next expand the next CFDATA of the folder
+func (c *CabReader) next() error {
+	if c.blocks == 0 {
+		return io.ErrUnexpectedEOF
+	}
+	c.blocks--
+	head := make([]byte, cabDataHead+c.reserve)
+	if _, err := io.ReadFull(c.r, head); err != nil {
+		return io.ErrUnexpectedEOF
+	}
+	data := make([]byte, binary.LittleEndian.Uint16(head[4:]))
+	size := int(binary.LittleEndian.Uint16(head[6:]))
+	if _, err := io.ReadFull(c.r, data); err != nil {
+		return io.ErrUnexpectedEOF
+	}
+	if c.typ == cabTypeNone {
+		c.buf = data
+		return nil
+	}
+
+	if len(data) < 2 || data[0] != 'C' || data[1] != 'K' {
+		return ErrInvalidCab
+	}
+	out := make([]byte, size)
+	fr := flate.NewReaderDict(bytes.NewReader(data[2:]), c.window)
+	if _, err := io.ReadFull(fr, out); err != nil {
+		return fmt.Errorf("expand cabinet block: %v", err)
+	}
+	if c.window = append(c.window, out...); len(c.window) > cabBlock {
+		c.window = c.window[len(c.window)-cabBlock:]
+	}
+	c.buf = out
+	return nil
+}
+
+func (c *CabReader) Read(p []byte) (int, error) {
+	if c.left <= 0 {
+		return 0, io.EOF
+	}
+	for len(c.buf) == 0 {
+		if err := c.next(); err != nil {
+			return 0, err
+		}
+	}
+	n := copy(p, c.buf)
+	if int64(n) > c.left {
+		n = int(c.left)
+	}
+	c.buf = c.buf[n:]
+	c.left -= int64(n)
+	return n, nil
+}
@@ -0,0 +1,89 @@
+package pdb
+
+import (
+	"bytes"
+	"encoding/binary"
+	"io/ioutil"
+	"math/rand"
+	"os"
+	"testing"
+	"time"
+)
+
+func TestCab(t *testing.T) {
+	fd, err := ioutil.TempFile("", "cab")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.Remove(fd.Name())
+	defer fd.Close()
+
+	// several blocks, matches across blocks need the previous one as dictionary
+	words := []string{"Symbol", "Store", "foo.pdb", "\x00\x01\x02", "RSDS"}
+	rnd := rand.New(rand.NewSource(1))
+	var data []byte
+	for len(data) < 3*cabBlock+100 {
+		data = append(data, words[rnd.Intn(len(words))]...)
+	}
+	mod := time.Date(2017, 7, 4, 14, 44, 14, 0, time.Local)
+	if err = WriteCab(fd, "foo.pdb", mod, bytes.NewReader(data)); err != nil {
+		t.Fatal(err)
+	}
+	if st, _ := fd.Stat(); st.Size() >= int64(len(data)) {
+		t.Errorf("cabinet not compressed, %d bytes", st.Size())
+	}
+
+	fd.Seek(0, 0)
+	cab, err := OpenCab(fd)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if cab.Name != "foo.pdb" || cab.Size != int64(len(data)) || !cab.ModTime.Equal(mod) {
+		t.Errorf("unexpected file %s, %d bytes, %v", cab.Name, cab.Size, cab.ModTime)
+	}
+	if out, err := ioutil.ReadAll(cab); err != nil || !bytes.Equal(out, data) {
+		t.Errorf("expanded content mismatch, %d bytes (%v)", len(out), err)
+	}
+
+	if _, err = OpenCab(bytes.NewReader([]byte("MZ garbage"))); err != ErrInvalidCab {
+		t.Errorf("expect invalid cabinet, got %v", err)
+	}
+}
+
+func TestCabStored(t *testing.T) {
+	// uncompressed cabinet with reserved bytes, as written by `makecab /D CompressionType=NONE`
+	le := binary.LittleEndian
+	content := []byte("not compressed")
+	var cab bytes.Buffer
+	cab.WriteString("MSCF")
+	binary.Write(&cab, le, []uint32{0, 0, 0, 0, 0})
+	cab.Write([]byte{3, 1})
+	binary.Write(&cab, le, []uint16{1, 1, cabFlagReserve, 0, 0})
+	binary.Write(&cab, le, uint16(2))   // header reserve
+	cab.Write([]byte{0, 4, 0xAA, 0xBB}) // folder and data reserve, header reserve bytes
+	coffData := cab.Len() + cabFolder + cabFileHead + len("bar.dll") + 1
+	binary.Write(&cab, le, uint32(coffData))
+	binary.Write(&cab, le, []uint16{1, cabTypeNone})
+	le.PutUint32(cab.Bytes()[16:], uint32(cab.Len()))
+	binary.Write(&cab, le, []uint32{uint32(len(content)), 0})
+	binary.Write(&cab, le, []uint16{0, 0, 0, cabAttrArchive})
+	cab.WriteString("bar.dll\x00")
+	binary.Write(&cab, le, uint32(0))
+	binary.Write(&cab, le, []uint16{uint16(len(content)), uint16(len(content))})
+	cab.Write([]byte{1, 2, 3, 4})
+	cab.Write(content)
+
+	r, err := OpenCab(bytes.NewReader(cab.Bytes()))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if out, err := ioutil.ReadAll(r); err != nil || r.Name != "bar.dll" || !bytes.Equal(out, content) {
+		t.Errorf("unexpected %s: %q (%v)", r.Name, out, err)
+	}
+
+	// LZX folder
+	le.PutUint16(cab.Bytes()[cabHeader+4+2+6:], 3)
+	if _, err = OpenCab(bytes.NewReader(cab.Bytes())); err != ErrCabUnsupported {
+		t.Errorf("expect unsupported, got %v", err)
+	}
+}
@@ -0,0 +1,98 @@
+package pdb
+
+import (
+	"bytes"
+	"debug/pe"
+	"encoding/binary"
+	"fmt"
+	"io"
+)
+
+var (
+	ErrNoCodeView = fmt.Errorf("binary has no codeview record")
+)
+
+const (
+	debugDirectory   = 6 // IMAGE_DIRECTORY_ENTRY_DEBUG
+	debugTypeCV      = 2 // IMAGE_DEBUG_TYPE_CODEVIEW
+	debugEntrySize   = 28
+	maxCodeViewBytes = 4096
+)
+
+// CodeView is the RSDS record of an PE binary, the identity and path of the pdb it's
+// built with. The key of a matched pdb is Signature.Key().
+//
+type CodeView struct {
+	Signature
+	Path string // pdb path on the build machine
+}
+
+// ReadCodeView parse the RSDS CodeView record in the debug directory of PE binary.
+// ErrNoCodeView if it's built without pdb.
+//
+func ReadCodeView(r io.ReaderAt) (*CodeView, error) {
+	f, err := pe.NewFile(r)
+	if err != nil {
+		return nil, ErrUnknownFormat
+	}
+	defer f.Close()
+
+	var dir pe.DataDirectory
+	switch h := f.OptionalHeader.(type) {
+	case *pe.OptionalHeader32:
+		if h.NumberOfRvaAndSizes > debugDirectory {
+			dir = h.DataDirectory[debugDirectory]
+		}
+	case *pe.OptionalHeader64:
+		if h.NumberOfRvaAndSizes > debugDirectory {
+			dir = h.DataDirectory[debugDirectory]
+		}
+	}
+	if dir.VirtualAddress == 0 || dir.Size < debugEntrySize {
+		return nil, ErrNoCodeView
+	}
+
+	// debug directory is in a section, map its rva to file offset
+	var data []byte
+	for _, s := range f.Sections {
+		if dir.VirtualAddress < s.VirtualAddress || dir.VirtualAddress+dir.Size > s.VirtualAddress+s.Size {
+			continue
+		}
+		data = make([]byte, dir.Size)
+		if _, err = r.ReadAt(data, int64(s.Offset+dir.VirtualAddress-s.VirtualAddress)); err != nil {
+			return nil, ErrCorrupted
+		}
+		break
+	}
+	if data == nil {
+		return nil, ErrCorrupted
+	}
+
+	// IMAGE_DEBUG_DIRECTORY: characteristics, stamp, version, type, size, rva, file offset
+	for ; len(data) >= debugEntrySize; data = data[debugEntrySize:] {
+		if binary.LittleEndian.Uint32(data[12:]) != debugTypeCV {
+			continue
+		}
+		size := binary.LittleEndian.Uint32(data[16:])
+		if size < 24 || size > maxCodeViewBytes {
+			return nil, ErrCorrupted
+		}
+		cv := make([]byte, size)
+		if _, err = r.ReadAt(cv, int64(binary.LittleEndian.Uint32(data[24:]))); err != nil {
+			return nil, ErrCorrupted
+		}
+		if !bytes.Equal(cv[:4], []byte("RSDS")) {
+			// NB10 of VC6 era pdb, not in pdb 7.0 format
+			return nil, ErrNoCodeView
+		}
+		rec := &CodeView{}
+		copy(rec.GUID[:], cv[4:20])
+		rec.Age = binary.LittleEndian.Uint32(cv[20:24])
+		rec.Path = string(cv[24:])
+		if end := bytes.IndexByte(cv[24:], 0); end >= 0 {
+			rec.Path = string(cv[24 : 24+end])
+		}
+		return rec, nil
+	}
+	return nil, ErrNoCodeView
+}
@@ -0,0 +1,70 @@
+package pdb
+
+import (
+	"bytes"
+	"encoding/binary"
+	"testing"
+)
+
+// fakeCodeView build an PE32 binary with one section holding the debug directory and the
+// RSDS record, nil `pdbPath` for no debug directory
+func fakeCodeView(guid [16]byte, age uint32, pdbPath []byte) []byte {
+	file := make([]byte, 0x400)
+	le := binary.LittleEndian
+	copy(file, "MZ")
+	le.PutUint32(file[0x3C:], 0x80)
+	copy(file[0x80:], "PE\x00\x00")
+	le.PutUint16(file[0x84:], 0x14c) // i386
+	le.PutUint16(file[0x86:], 1)     // sections
+	le.PutUint16(file[0x94:], 224)   // optional header size
+
+	opt := file[0x98:]
+	le.PutUint16(opt, 0x10b)
+	le.PutUint32(opt[92:], 16)
+	if pdbPath != nil {
+		le.PutUint32(opt[96+6*8:], 0x1000)
+		le.PutUint32(opt[96+6*8+4:], debugEntrySize)
+	}
+
+	sec := file[0x98+224:]
+	copy(sec, ".rdata")
+	le.PutUint32(sec[8:], 0x200)   // virtual size
+	le.PutUint32(sec[12:], 0x1000) // virtual address
+	le.PutUint32(sec[16:], 0x200)  // raw size
+	le.PutUint32(sec[20:], 0x200)  // raw offset
+
+	entry := file[0x200:]
+	le.PutUint32(entry[12:], debugTypeCV)
+	le.PutUint32(entry[16:], uint32(24+len(pdbPath)+1))
+	le.PutUint32(entry[24:], 0x200+debugEntrySize)
+	cv := entry[debugEntrySize:]
+	copy(cv, "RSDS")
+	copy(cv[4:], guid[:])
+	le.PutUint32(cv[20:], age)
+	copy(cv[24:], pdbPath)
+	return file
+}
+
+func TestReadCodeView(t *testing.T) {
+	guid := [16]byte{0xFE, 0x68, 0x38, 0x8E, 0xFA, 0xE1, 0xC8, 0x4A,
+		0xA4, 0x2D, 0x0F, 0xAC, 0xA6, 0x5E, 0x0B, 0xE4}
+	cv, err := ReadCodeView(bytes.NewReader(fakeCodeView(guid, 1, []byte(`D:\build\out\ca_a.pdb`))))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if cv.Key() != "8E3868FEE1FA4AC8A42D0FACA65E0BE41" || cv.Path != `D:\build\out\ca_a.pdb` {
+		t.Errorf("unexpected codeview %s %s", cv.Key(), cv.Path)
+	}
+	// same key as the pdb it's built with
+	key, _ := ReadKey(bytes.NewReader(fakePDB(guid, 2, 1)))
+	if key != cv.Key() {
+		t.Errorf("expect binary key %s matching pdb %s", cv.Key(), key)
+	}
+
+	if _, err = ReadCodeView(bytes.NewReader(fakeCodeView(guid, 1, nil))); err != ErrNoCodeView {
+		t.Errorf("expect no codeview, got %v", err)
+	}
+	if _, err = ReadCodeView(bytes.NewReader(fakePDB(guid, 1, 1))); err != ErrUnknownFormat {
+		t.Errorf("expect pdb not an PE, got %v", err)
+	}
+}
@@ -0,0 +1,51 @@
+package pdb
+
+import (
+	"path/filepath"
+	"strings"
+)
+
+var (
+	// extensions of files symstore.exe may store compressed, the last char become `_`
+	compressibleExts = []string{".pdb", ".dll", ".exe", ".sys", ".ocx", ".drv", ".sym", ".dbg"}
+)
+
+// IsCompressed check if file name is a compressed symbol file, eg: `foo.pd_`.
+//
+func IsCompressed(name string) bool {
+	ext := filepath.Ext(name)
+	return len(ext) > 2 && ext[len(ext)-1] == '_'
+}
+
+// CompressedName return the cab file name symstore.exe /compress use, eg: foo.pdb => foo.pd_
+//
+func CompressedName(name string) string {
+	if name == "" || IsCompressed(name) {
+		return name
+	}
+	return name[:len(name)-1] + "_"
+}
+
+// UncompressedNames return the names compressed file `name` may come from, eg: foo.pd_ =>
+// foo.pdb. Symbols are stored under the folder of the uncompressed name.
+//
+func UncompressedNames(name string) []string {
+	if !IsCompressed(name) {
+		return nil
+	}
+	ext := filepath.Ext(name)
+	prefix := strings.ToLower(ext[:len(ext)-1])
+	upper := strings.ToUpper(ext) == ext
+	var names []string
+	for _, e := range compressibleExts {
+		if !strings.HasPrefix(e, prefix) {
+			continue
+		}
+		last := e[len(e)-1:]
+		if upper {
+			last = strings.ToUpper(last)
+		}
+		names = append(names, name[:len(name)-1]+last)
+	}
+	return names
+}
@@ -0,0 +1,293 @@
+package pdb
+
+import (
+	"bytes"
+	"encoding/binary"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"strings"
+)
+
+var (
+	ErrUnknownFormat = fmt.Errorf("unknown symbol file format")
+	ErrCorrupted     = fmt.Errorf("corrupted symbol file")
+)
+
+var (
+	msfMagic      = []byte("Microsoft C/C++ MSF 7.00\r\n\x1aDS\x00\x00\x00")
+	portableMagic = []byte("BSJB") // ECMA-335 metadata root of portable pdb
+)
+
+const (
+	streamPDB = 1 // pdb info stream
+	streamDBI = 3 // debug info stream
+)
+
+// Signature is the identity of an PDB 7.0 file
+//
+type Signature struct {
+	GUID [16]byte
+	Age  uint32
+}
+
+// Key return the symbol store key, eg: 8E3868FEE1FA4AC8A42D0FACA65E0BE41
+func (s *Signature) Key() string {
+	g := s.GUID
+	return fmt.Sprintf("%08X%04X%04X%X%X",
+		binary.LittleEndian.Uint32(g[0:4]),
+		binary.LittleEndian.Uint16(g[4:6]),
+		binary.LittleEndian.Uint16(g[6:8]),
+		g[8:16],
+		s.Age)
+}
+
+// IsSymbolFile check if file is one of the type symbol store accept by extension.
+//
+func IsSymbolFile(name string) bool {
+	switch strings.ToLower(filepath.Ext(name)) {
+	case ".pdb", ".dll", ".exe", ".sys", ".ocx", ".drv":
+		return true
+	}
+	return false
+}
+
+// HasExtension check if file name end with one of `exts`, eg: `.pdb` or compressed `.pd_`.
+//
+func HasExtension(name string, exts []string) bool {
+	ext := strings.ToLower(filepath.Ext(name))
+	if ext == "" {
+		return false
+	}
+	for _, e := range exts {
+		if e == ext {
+			return true
+		}
+	}
+	return false
+}
+
+// Key return the symbol store key (hash directory name) of given pdb, PE or ELF file.
+//
+func Key(fpath string) (string, error) {
+	fd, err := os.Open(fpath)
+	if err != nil {
+		return "", err
+	}
+	defer fd.Close()
+	return ReadKey(fd)
+}
+
+// ReadKey detect the format and return the symbol store key.
+//
+func ReadKey(r io.ReaderAt) (string, error) {
+	head := make([]byte, len(msfMagic))
+	if _, err := r.ReadAt(head, 0); err != nil {
+		return "", ErrUnknownFormat
+	}
+	if bytes.Equal(head, msfMagic) {
+		sig, err := ReadSignature(r)
+		if err != nil {
+			return "", err
+		}
+		return sig.Key(), nil
+	}
+	if head[0] == 'M' && head[1] == 'Z' {
+		return peKey(r)
+	}
+	if bytes.Equal(head[:4], portableMagic) {
+		sig, err := ReadPortableID(r)
+		if err != nil {
+			return "", err
+		}
+		return sig.Key(), nil
+	}
+	if bytes.Equal(head[:4], elfMagic) {
+		return ReadBuildID(r)
+	}
+	return "", ErrUnknownFormat
+}
+
+// ReadSignature parse GUID and age from MSF 7.0 pdb file.
+//
+func ReadSignature(r io.ReaderAt) (*Signature, error) {
+	f, err := openMSF(r)
+	if err != nil {
+		return nil, err
+	}
+
+	info, err := f.stream(streamPDB)
+	if err != nil || len(info) < 28 {
+		return nil, ErrCorrupted
+	}
+	sig := &Signature{Age: binary.LittleEndian.Uint32(info[8:12])}
+	copy(sig.GUID[:], info[12:28])
+
+	// symstore use the age in DBI stream if exist
+	if dbi, err := f.stream(streamDBI); err == nil && len(dbi) >= 12 {
+		sig.Age = binary.LittleEndian.Uint32(dbi[8:12])
+	}
+	return sig, nil
+}
+
+// ReadPortableID parse pdb id of .NET portable pdb from its #Pdb metadata stream. The age
+// is always 0xFFFFFFFF, so the key is the SSQP key `{guid}FFFFFFFF`.
+//
+func ReadPortableID(r io.ReaderAt) (*Signature, error) {
+	hdr := make([]byte, 16)
+	if _, err := r.ReadAt(hdr, 0); err != nil || !bytes.Equal(hdr[:4], portableMagic) {
+		return nil, ErrUnknownFormat
+	}
+	verLen := int64(binary.LittleEndian.Uint32(hdr[12:16]))
+	if verLen > 255 {
+		return nil, ErrCorrupted
+	}
+	buf := make([]byte, 4)
+	pos := 16 + verLen
+	if _, err := r.ReadAt(buf, pos); err != nil {
+		return nil, ErrCorrupted
+	}
+	count := int(binary.LittleEndian.Uint16(buf[2:4]))
+	pos += 4
+
+	// stream headers: offset, size, name zero terminated and padded to 4 bytes
+	for i := 0; i < count; i++ {
+		sh := make([]byte, 8+32)
+		n, err := r.ReadAt(sh, pos)
+		if n < 9 && err != nil {
+			return nil, ErrCorrupted
+		}
+		sh = sh[:n]
+		end := bytes.IndexByte(sh[8:], 0)
+		if end < 0 {
+			return nil, ErrCorrupted
+		}
+		if string(sh[8:8+end]) == "#Pdb" {
+			id := make([]byte, 20)
+			if _, err := r.ReadAt(id, int64(binary.LittleEndian.Uint32(sh[0:4]))); err != nil {
+				return nil, ErrCorrupted
+			}
+			sig := &Signature{Age: 0xFFFFFFFF}
+			copy(sig.GUID[:], id[:16])
+			return sig, nil
+		}
+		pos += 8 + int64(end+4)&^3
+	}
+	return nil, ErrCorrupted
+}
+
+// msf is the multi-stream file container of pdb
+type msf struct {
+	r         io.ReaderAt
+	blockSize uint32
+	sizes     []uint32
+	blocks    [][]uint32
+}
+
+func openMSF(r io.ReaderAt) (*msf, error) {
+	sb := make([]byte, 24)
+	if _, err := r.ReadAt(sb, int64(len(msfMagic))); err != nil {
+		return nil, ErrCorrupted
+	}
+	f := &msf{
+		r:         r,
+		blockSize: binary.LittleEndian.Uint32(sb[0:4]),
+	}
+	dirBytes := binary.LittleEndian.Uint32(sb[12:16])
+	mapAddr := binary.LittleEndian.Uint32(sb[20:24])
+	if f.blockSize == 0 || f.blockSize&(f.blockSize-1) != 0 || f.blockSize > 1<<16 {
+		return nil, ErrCorrupted
+	}
+
+	// block map list the blocks of stream directory
+	dirBlocks := (dirBytes + f.blockSize - 1) / f.blockSize
+	bmap := make([]byte, dirBlocks*4)
+	if _, err := r.ReadAt(bmap, int64(mapAddr)*int64(f.blockSize)); err != nil {
+		return nil, ErrCorrupted
+	}
+	dir := make([]byte, 0, dirBlocks*f.blockSize)
+	for i := uint32(0); i < dirBlocks; i++ {
+		data, err := f.block(binary.LittleEndian.Uint32(bmap[i*4:]))
+		if err != nil {
+			return nil, err
+		}
+		dir = append(dir, data...)
+	}
+	dir = dir[:dirBytes]
+
+	// directory: count, sizes[count], blocks of each stream
+	if len(dir) < 4 {
+		return nil, ErrCorrupted
+	}
+	count := binary.LittleEndian.Uint32(dir)
+	pos := uint32(4)
+	if uint64(count)*4+4 > uint64(len(dir)) {
+		return nil, ErrCorrupted
+	}
+	f.sizes = make([]uint32, count)
+	for i := range f.sizes {
+		f.sizes[i] = binary.LittleEndian.Uint32(dir[pos:])
+		pos += 4
+	}
+	f.blocks = make([][]uint32, count)
+	for i, size := range f.sizes {
+		if size == 0xFFFFFFFF {
+			continue
+		}
+		n := (size + f.blockSize - 1) / f.blockSize
+		if uint64(pos)+uint64(n)*4 > uint64(len(dir)) {
+			return nil, ErrCorrupted
+		}
+		f.blocks[i] = make([]uint32, n)
+		for j := range f.blocks[i] {
+			f.blocks[i][j] = binary.LittleEndian.Uint32(dir[pos:])
+			pos += 4
+		}
+	}
+	return f, nil
+}
+
+func (f *msf) block(idx uint32) ([]byte, error) {
+	data := make([]byte, f.blockSize)
+	if _, err := f.r.ReadAt(data, int64(idx)*int64(f.blockSize)); err != nil && err != io.EOF {
+		return nil, ErrCorrupted
+	}
+	return data, nil
+}
+
+func (f *msf) stream(idx int) ([]byte, error) {
+	if idx >= len(f.sizes) || f.sizes[idx] == 0xFFFFFFFF {
+		return nil, ErrCorrupted
+	}
+	data := make([]byte, 0, len(f.blocks[idx])*int(f.blockSize))
+	for _, b := range f.blocks[idx] {
+		blk, err := f.block(b)
+		if err != nil {
+			return nil, err
+		}
+		data = append(data, blk...)
+	}
+	return data[:f.sizes[idx]], nil
+}
+
+// peKey return TimeDateStamp + SizeOfImage of PE file, eg: 59C0C5B3a3000
+func peKey(r io.ReaderAt) (string, error) {
+	buf := make([]byte, 4)
+	if _, err := r.ReadAt(buf, 0x3C); err != nil {
+		return "", ErrCorrupted
+	}
+	off := int64(binary.LittleEndian.Uint32(buf))
+
+	// PE signature (4) + COFF header (20) + optional header up to SizeOfImage (60)
+	hdr := make([]byte, 84)
+	if _, err := r.ReadAt(hdr, off); err != nil {
+		return "", ErrCorrupted
+	}
+	if !bytes.Equal(hdr[:4], []byte("PE\x00\x00")) {
+		return "", ErrUnknownFormat
+	}
+	stamp := binary.LittleEndian.Uint32(hdr[8:12])
+	size := binary.LittleEndian.Uint32(hdr[24+56 : 24+60])
+	return fmt.Sprintf("%08X%x", stamp, size), nil
+}
@@ -0,0 +1,121 @@
+package pdb
+
+import (
+	"bytes"
+	"encoding/binary"
+	"testing"
+)
+
+// fakePDB build an minimal MSF 7.0 file with pdb info and dbi stream
+func fakePDB(guid [16]byte, infoAge, dbiAge uint32) []byte {
+	const bs = 512
+	file := make([]byte, bs*5)
+	le := binary.LittleEndian
+
+	copy(file, msfMagic)
+	sb := file[len(msfMagic):]
+	le.PutUint32(sb[0:], bs)  // block size
+	le.PutUint32(sb[4:], 1)   // free block map
+	le.PutUint32(sb[8:], 5)   // num blocks
+	le.PutUint32(sb[12:], 36) // directory bytes
+	le.PutUint32(sb[20:], 1)  // block map addr
+
+	le.PutUint32(file[bs:], 2) // directory at block 2
+
+	dir := file[bs*2:]
+	le.PutUint32(dir[0:], 4)           // 4 streams
+	le.PutUint32(dir[4:], 0)           // stream 0
+	le.PutUint32(dir[8:], 28)          // pdb info
+	le.PutUint32(dir[12:], 0xFFFFFFFF) // nil stream
+	le.PutUint32(dir[16:], 12)         // dbi
+	le.PutUint32(dir[20:], 3)          // pdb info block
+	le.PutUint32(dir[24:], 4)          // dbi block
+
+	info := file[bs*3:]
+	le.PutUint32(info[0:], 20000404)
+	le.PutUint32(info[8:], infoAge)
+	copy(info[12:], guid[:])
+
+	dbi := file[bs*4:]
+	le.PutUint32(dbi[8:], dbiAge)
+	return file
+}
+
+func TestPDBKey(t *testing.T) {
+	guid := [16]byte{0xFE, 0x68, 0x38, 0x8E, 0xFA, 0xE1, 0xC8, 0x4A,
+		0xA4, 0x2D, 0x0F, 0xAC, 0xA6, 0x5E, 0x0B, 0xE4}
+	key, err := ReadKey(bytes.NewReader(fakePDB(guid, 2, 1)))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if key != "8E3868FEE1FA4AC8A42D0FACA65E0BE41" {
+		t.Errorf("unexpected key %s", key)
+	}
+}
+
+func TestPEKey(t *testing.T) {
+	file := make([]byte, 512)
+	le := binary.LittleEndian
+	copy(file, "MZ")
+	le.PutUint32(file[0x3C:], 0x80)
+	copy(file[0x80:], "PE\x00\x00")
+	le.PutUint32(file[0x80+8:], 0x59C0C5B3)     // TimeDateStamp
+	le.PutUint32(file[0x80+24+56:], 0x000a3000) // SizeOfImage
+
+	key, err := ReadKey(bytes.NewReader(file))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if key != "59C0C5B3a3000" {
+		t.Errorf("unexpected key %s", key)
+	}
+}
+
+func TestPortableKey(t *testing.T) {
+	guid := [16]byte{0xFE, 0x68, 0x38, 0x8E, 0xFA, 0xE1, 0xC8, 0x4A,
+		0xA4, 0x2D, 0x0F, 0xAC, 0xA6, 0x5E, 0x0B, 0xE4}
+	file := make([]byte, 84)
+	le := binary.LittleEndian
+	copy(file, portableMagic)
+	le.PutUint32(file[12:], 12) // version length
+	copy(file[16:], "PDB v1.0")
+	le.PutUint16(file[30:], 2)  // streams
+	le.PutUint32(file[32:], 0)  // #~ offset
+	le.PutUint32(file[36:], 0)  // #~ size
+	copy(file[40:], "#~")       // padded to 4 bytes
+	le.PutUint32(file[44:], 64) // #Pdb offset
+	le.PutUint32(file[48:], 20) // #Pdb size
+	copy(file[52:], "#Pdb")     // padded to 8 bytes
+	copy(file[64:], guid[:])
+
+	key, err := ReadKey(bytes.NewReader(file))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if key != "8E3868FEE1FA4AC8A42D0FACA65E0BE4FFFFFFFF" {
+		t.Errorf("unexpected key %s", key)
+	}
+}
+
+func TestUnknownFormat(t *testing.T) {
+	if _, err := ReadKey(bytes.NewReader(make([]byte, 64))); err != ErrUnknownFormat {
+		t.Errorf("expect unknown format, got %v", err)
+	}
+}
+
+func TestHasExtension(t *testing.T) {
+	exts := []string{".pdb", ".dll", ".pd_"}
+	for name, expect := range map[string]bool{
+		"foo.pdb":     true,
+		"FOO.PDB":     true,
+		"foo.pd_":     true,
+		"foo.dll":     true,
+		"foo.txt":     false,
+		"foo":         false,
+		"foo.pdb.bat": false,
+	} {
+		if HasExtension(name, exts) != expect {
+			t.Errorf("expect %s allowed %v", name, expect)
+		}
+	}
+}
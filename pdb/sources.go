@@ -0,0 +1,85 @@
+package pdb
+
+import (
+	"bytes"
+	"encoding/binary"
+	"io"
+	"os"
+	"strings"
+)
+
+const (
+	dbiHeaderSize = 64
+)
+
+// ReadSources list source files compiled into pdb, from the file info substream of DBI
+// stream. Names are as recorded on the build machine, duplicates are removed.
+//
+func ReadSources(r io.ReaderAt) ([]string, error) {
+	f, err := openMSF(r)
+	if err != nil {
+		return nil, err
+	}
+	dbi, err := f.stream(streamDBI)
+	if err != nil || len(dbi) < dbiHeaderSize {
+		return nil, ErrCorrupted
+	}
+
+	le := binary.LittleEndian
+	modInfo := int64(int32(le.Uint32(dbi[24:])))
+	secContrib := int64(int32(le.Uint32(dbi[28:])))
+	secMap := int64(int32(le.Uint32(dbi[32:])))
+	srcInfo := int64(int32(le.Uint32(dbi[36:])))
+	start := dbiHeaderSize + modInfo + secContrib + secMap
+	if modInfo < 0 || secContrib < 0 || secMap < 0 || srcInfo < 4 || start+srcInfo > int64(len(dbi)) {
+		return nil, ErrCorrupted
+	}
+	info := dbi[start : start+srcInfo]
+
+	// NumModules, NumSourceFiles (overflow with > 64K files, summed from counts instead),
+	// ModIndices[NumModules], ModFileCounts[NumModules], FileNameOffsets[], NamesBuffer
+	mods := int(le.Uint16(info[0:]))
+	pos := 4 + mods*2
+	if pos+mods*2 > len(info) {
+		return nil, ErrCorrupted
+	}
+	files := 0
+	for i := 0; i < mods; i++ {
+		files += int(le.Uint16(info[pos+i*2:]))
+	}
+	pos += mods * 2
+	names := pos + files*4
+	if names > len(info) {
+		return nil, ErrCorrupted
+	}
+
+	seen := make(map[string]bool, files)
+	var sources []string
+	for i := 0; i < files; i++ {
+		off := names + int(le.Uint32(info[pos+i*4:]))
+		if off >= len(info) {
+			return nil, ErrCorrupted
+		}
+		end := bytes.IndexByte(info[off:], 0)
+		if end < 0 {
+			return nil, ErrCorrupted
+		}
+		name := string(info[off : off+end])
+		if lower := strings.ToLower(name); name != "" && !seen[lower] {
+			seen[lower] = true
+			sources = append(sources, name)
+		}
+	}
+	return sources, nil
+}
+
+// Sources list source files compiled into pdb file `fpath`, see ReadSources.
+//
+func Sources(fpath string) ([]string, error) {
+	fd, err := os.Open(fpath)
+	if err != nil {
+		return nil, err
+	}
+	defer fd.Close()
+	return ReadSources(fd)
+}
@@ -0,0 +1,58 @@
+package pdb
+
+import (
+	"bytes"
+	"encoding/binary"
+	"testing"
+)
+
+// withSources put file info substream of `modules` into dbi stream of fake pdb
+func withSources(file []byte, modules [][]string) []byte {
+	const bs = 512
+	le := binary.LittleEndian
+	var names []byte
+	var offsets []uint32
+	for _, files := range modules {
+		for _, name := range files {
+			offsets = append(offsets, uint32(len(names)))
+			names = append(append(names, name...), 0)
+		}
+	}
+
+	var info bytes.Buffer
+	binary.Write(&info, le, uint16(len(modules)))
+	binary.Write(&info, le, uint16(len(offsets)))
+	for range modules {
+		binary.Write(&info, le, uint16(0))
+	}
+	for _, files := range modules {
+		binary.Write(&info, le, uint16(len(files)))
+	}
+	binary.Write(&info, le, offsets)
+	info.Write(names)
+
+	dbi := file[bs*4:]
+	le.PutUint32(dbi[36:], uint32(info.Len())) // source info size
+	copy(dbi[dbiHeaderSize:], info.Bytes())
+	le.PutUint32(file[bs*2+16:], uint32(dbiHeaderSize+info.Len())) // dbi stream size
+	return file
+}
+
+func TestReadSources(t *testing.T) {
+	file := withSources(fakePDB([16]byte{1}, 1, 1), [][]string{
+		{`S:\src\udp\main.cpp`, `S:\src\udp\main.h`},
+		{`S:\src\udp\util.cpp`, `s:\src\udp\MAIN.H`},
+	})
+	sources, err := ReadSources(bytes.NewReader(file))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(sources) != 3 || sources[0] != `S:\src\udp\main.cpp` || sources[2] != `S:\src\udp\util.cpp` {
+		t.Errorf("unexpected sources %q", sources)
+	}
+
+	// dbi without source info
+	if _, err = ReadSources(bytes.NewReader(fakePDB([16]byte{1}, 1, 1))); err != ErrCorrupted {
+		t.Errorf("expect corrupted, got %v", err)
+	}
+}
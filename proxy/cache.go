@@ -0,0 +1,279 @@
+package proxy
+
+import (
+	"container/list"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+
+	log "gopkg.in/clog.v1"
+)
+
+// MaxPins is the max count of pinned keys, pins of a build being debugged are far less.
+const MaxPins = 100000
+
+// ErrTooManyPins is returned by `Pin` when the pins would exceed `MaxPins`
+var ErrTooManyPins = fmt.Errorf("more than %d keys pinned", MaxPins)
+
+// entry is one cached file
+type entry struct {
+	key    string // name/hash/file
+	size   int64
+	refs   int  // being served, can't be evicted
+	pinned bool // pinned by user, can't be evicted
+}
+
+// Stats of cache usage
+//
+type Stats struct {
+	Hits         int64   `json:"hits"`
+	Misses       int64   `json:"misses"`
+	HitRatio     float64 `json:"hitRatio"`
+	Evictions    int64   `json:"evictions"`
+	EvictedBytes int64   `json:"evictedBytes"`
+	Files        int     `json:"files"`
+	Pinned       int     `json:"pinned"`
+	Bytes        int64   `json:"bytes"`
+	MaxBytes     int64   `json:"maxBytes"`
+}
+
+// Cache is a size bounded disk cache, least recently used files are evicted first.
+// Files being served or pinned are never evicted.
+//
+type Cache struct {
+	dir      string
+	maxBytes int64
+	mx       sync.Mutex
+	size     int64
+	lru      *list.List               // front is most recently used
+	index    map[string]*list.Element // key => element of *entry
+	pins     map[string]bool          // pinned keys, may not be cached yet
+	stats    Stats
+}
+
+// NewCache open the cache folder and index exist files, oldest modified are evicted first.
+//
+func NewCache(dir string, maxBytes int64) (*Cache, error) {
+	if err := os.MkdirAll(dir, 0755); err != nil {
+		return nil, err
+	}
+	c := &Cache{
+		dir:      dir,
+		maxBytes: maxBytes,
+		lru:      list.New(),
+		index:    make(map[string]*list.Element),
+		pins:     make(map[string]bool),
+	}
+
+	type file struct {
+		key   string
+		size  int64
+		mtime time.Time
+	}
+	var files []file
+	filepath.Walk(dir, func(fpath string, info os.FileInfo, err error) error {
+		if err != nil || info.IsDir() || strings.HasSuffix(info.Name(), ".tmp") {
+			return nil
+		}
+		rel, _ := filepath.Rel(dir, fpath)
+		files = append(files, file{filepath.ToSlash(rel), info.Size(), info.ModTime()})
+		return nil
+	})
+	sort.Slice(files, func(i, j int) bool { return files[i].mtime.Before(files[j].mtime) })
+	for _, f := range files {
+		c.index[f.key] = c.lru.PushFront(&entry{key: f.key, size: f.size})
+		c.size += f.size
+	}
+
+	log.Info("[Cache] Open %s with %d files, %d bytes.", dir, len(files), c.size)
+	c.mx.Lock()
+	c.evict()
+	c.mx.Unlock()
+	return c, nil
+}
+
+func (c *Cache) path(key string) string {
+	return filepath.Join(c.dir, filepath.FromSlash(key))
+}
+
+// Get return the local path of cached file and mark it recently used.
+//
+func (c *Cache) Get(key string) (string, bool) {
+	c.mx.Lock()
+	defer c.mx.Unlock()
+	if el, ok := c.index[key]; ok {
+		c.stats.Hits++
+		c.lru.MoveToFront(el)
+		fpath := c.path(key)
+		now := time.Now()
+		os.Chtimes(fpath, now, now) // keep order across restart
+		return fpath, true
+	}
+	c.stats.Misses++
+	return "", false
+}
+
+// Acquire is `Get` that also hold the file from eviction until `Release`.
+//
+func (c *Cache) Acquire(key string) (string, bool) {
+	if _, ok := c.Get(key); !ok {
+		return "", false
+	}
+	return c.hold(key) // evicted meanwhile if not ok
+}
+
+// hold keep the file from eviction until `Release`, unlike `Acquire` no hit is counted.
+func (c *Cache) hold(key string) (string, bool) {
+	c.mx.Lock()
+	defer c.mx.Unlock()
+	el, ok := c.index[key]
+	if !ok {
+		return "", false
+	}
+	el.Value.(*entry).refs++
+	return c.path(key), true
+}
+
+// Release the file hold by `Acquire`.
+//
+func (c *Cache) Release(key string) {
+	c.mx.Lock()
+	defer c.mx.Unlock()
+	if el, ok := c.index[key]; ok {
+		if e := el.Value.(*entry); e.refs > 0 {
+			e.refs--
+		}
+	}
+	c.evict()
+}
+
+// Pin keep the given keys from eviction, eg: all symbols of the build being debugged.
+// Keys not cached yet are pinned once they are added. Nothing is pinned if the keys
+// would exceed `MaxPins`.
+//
+func (c *Cache) Pin(keys ...string) error {
+	c.mx.Lock()
+	defer c.mx.Unlock()
+	added := make(map[string]bool)
+	for _, key := range keys {
+		if !c.pins[key] {
+			added[key] = true
+		}
+	}
+	if len(c.pins)+len(added) > MaxPins {
+		return ErrTooManyPins
+	}
+	for _, key := range keys {
+		c.pins[key] = true
+		if el, ok := c.index[key]; ok {
+			el.Value.(*entry).pinned = true
+		}
+	}
+	return nil
+}
+
+// Unpin allow the given keys to be evicted again, no keys unpin all.
+//
+func (c *Cache) Unpin(keys ...string) {
+	c.mx.Lock()
+	defer c.mx.Unlock()
+	if len(keys) == 0 {
+		for key := range c.pins {
+			keys = append(keys, key)
+		}
+	}
+	for _, key := range keys {
+		delete(c.pins, key)
+		if el, ok := c.index[key]; ok {
+			el.Value.(*entry).pinned = false
+		}
+	}
+	c.evict()
+}
+
+// Stats return snapshot of cache usage
+//
+func (c *Cache) Stats() Stats {
+	c.mx.Lock()
+	defer c.mx.Unlock()
+	st := c.stats
+	st.Files = c.lru.Len()
+	st.Bytes = c.size
+	st.MaxBytes = c.maxBytes
+	st.Pinned = len(c.pins)
+	if total := st.Hits + st.Misses; total > 0 {
+		st.HitRatio = float64(st.Hits) / float64(total)
+	}
+	return st
+}
+
+// Put save content from `r` to cache, the file is visible only if fully written.
+//
+func (c *Cache) Put(key string, r io.Reader) (int64, error) {
+	fpath := c.path(key)
+	if err := os.MkdirAll(filepath.Dir(fpath), 0755); err != nil {
+		return 0, err
+	}
+	tmp, err := ioutil.TempFile(filepath.Dir(fpath), filepath.Base(fpath)+".*.tmp")
+	if err != nil {
+		return 0, err
+	}
+	size, err := io.Copy(tmp, r)
+	tmp.Close()
+	if err != nil {
+		os.Remove(tmp.Name())
+		return 0, err
+	}
+	if err = os.Rename(tmp.Name(), fpath); err != nil {
+		os.Remove(tmp.Name())
+		return 0, err
+	}
+
+	c.mx.Lock()
+	defer c.mx.Unlock()
+	if el, ok := c.index[key]; ok {
+		c.size -= el.Value.(*entry).size
+		c.lru.Remove(el)
+	}
+	c.index[key] = c.lru.PushFront(&entry{key: key, size: size, pinned: c.pins[key]})
+	c.size += size
+	c.evict()
+	return size, nil
+}
+
+// Size return total bytes and count of cached files
+func (c *Cache) Size() (int64, int) {
+	c.mx.Lock()
+	defer c.mx.Unlock()
+	return c.size, c.lru.Len()
+}
+
+// evict remove least recently used files until under limit, must hold lock.
+// Pinned and in use files are skipped, so the cache may stay over limit.
+func (c *Cache) evict() {
+	el := c.lru.Back()
+	for c.maxBytes > 0 && c.size > c.maxBytes && el != nil {
+		e := el.Value.(*entry)
+		prev := el.Prev()
+		if e.pinned || e.refs > 0 {
+			el = prev
+			continue
+		}
+		c.lru.Remove(el)
+		el = prev
+		delete(c.index, e.key)
+		c.size -= e.size
+		c.stats.Evictions++
+		c.stats.EvictedBytes += e.size
+		if err := os.Remove(c.path(e.key)); err != nil && !os.IsNotExist(err) {
+			log.Warn("[Cache] Evict %s failed: %v.", e.key, err)
+		}
+		log.Trace("[Cache] Evict %s (%d bytes).", e.key, e.size)
+	}
+}
@@ -0,0 +1,222 @@
+package proxy
+
+import (
+	"crypto/subtle"
+	"encoding/json"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"net"
+	"net/http"
+	"os"
+	"path"
+	"strings"
+	"time"
+
+	"github.com/adyzng/GoSymbols/fault"
+	"github.com/adyzng/GoSymbols/site"
+	log "gopkg.in/clog.v1"
+)
+
+const (
+	// CacheControl of served symbol files. They are addressed by hash but may still be
+	// replaced or purged, so clients revalidate with ETag instead of trusting them forever.
+	CacheControl = "public, max-age=31536000"
+)
+
+// Client fetch symbols from the central GoSymbols servers.
+//
+// Each upstream is an URL template with `{name}`, `{hash}` and `{file}` placeholders,
+// eg: http://symbols:8080/api/symbol/UDPMAIN/{hash}/{name}.
+// Upstream without placeholder is treated as symsrv layout `{upstream}/{name}/{hash}/{file}`.
+//
+type Client struct {
+	Upstreams []string
+	http      *http.Client
+}
+
+// NewClient ...
+func NewClient(upstreams []string) *Client {
+	return &Client{
+		Upstreams: upstreams,
+		http: &http.Client{
+			Timeout:   time.Minute * 10,
+			Transport: fault.Transport(fault.Network, nil),
+		},
+	}
+}
+
+func expand(upstream, name, hash, file string) string {
+	if !strings.Contains(upstream, "{") {
+		return strings.TrimRight(upstream, "/") + "/" + name + "/" + hash + "/" + file
+	}
+	r := strings.NewReplacer("{name}", name, "{hash}", hash, "{file}", file)
+	return r.Replace(upstream)
+}
+
+// Fetch try every upstream in order, return the first succeed response body.
+// If upstream send the checksum header, reading the body to the end fail with
+// `ErrChecksumMismatch` when the content is corrupted.
+//
+func (c *Client) Fetch(name, hash, file string) (io.ReadCloser, int64, error) {
+	var lastErr error = os.ErrNotExist
+	for _, up := range c.Upstreams {
+		uri := expand(up, name, hash, file)
+		req, err := http.NewRequest(http.MethodGet, uri, nil)
+		if err != nil {
+			lastErr = err
+			continue
+		}
+		req.Header.Set(site.HeaderReplica, "1")
+		resp, err := c.http.Do(req)
+		if err != nil {
+			log.Warn("[Proxy] Fetch %s failed: %v.", uri, err)
+			lastErr = err
+			continue
+		}
+		if resp.StatusCode == http.StatusOK {
+			log.Trace("[Proxy] Fetch %s.", uri)
+			return VerifyReader(resp.Body, resp.Header.Get(HeaderChecksum)), resp.ContentLength, nil
+		}
+		resp.Body.Close()
+		if resp.StatusCode != http.StatusNotFound {
+			lastErr = fmt.Errorf("upstream %s response %s", uri, resp.Status)
+		}
+	}
+	return nil, 0, lastErr
+}
+
+// Server answer symsrv requests `/{name}/{hash}/{file}` from local cache,
+// missing files are read through from upstreams.
+//
+type Server struct {
+	Cache  *Cache
+	Client *Client
+	Token  string // bearer token of cache management, loopback clients only if empty
+}
+
+// parseKey split symsrv request path into name, hash, file
+func parseKey(urlPath string) (name, hash, file string, ok bool) {
+	p := path.Clean("/" + urlPath)
+	ss := strings.Split(strings.Trim(p, "/"), "/")
+	if len(ss) != 3 {
+		return "", "", "", false
+	}
+	for _, s := range ss {
+		if s == "" || s == "." || s == ".." {
+			return "", "", "", false
+		}
+	}
+	return ss[0], ss[1], ss[2], true
+}
+
+// authorized check the request carry `Token` as bearer token, without token only
+// requests from the local machine are accepted.
+func (s *Server) authorized(r *http.Request) bool {
+	if s.Token == "" {
+		host, _, err := net.SplitHostPort(r.RemoteAddr)
+		ip := net.ParseIP(host)
+		return err == nil && ip != nil && ip.IsLoopback()
+	}
+	auth := r.Header.Get("Authorization")
+	if !strings.HasPrefix(auth, "Bearer ") {
+		return false
+	}
+	return subtle.ConstantTimeCompare([]byte(auth[len("Bearer "):]), []byte(s.Token)) == 1
+}
+
+// serveAdmin handle cache management requests under `/_cache/`
+//	/_cache/stats [GET]          cache statistics
+//	/_cache/pin   [POST|DELETE]  pin or unpin keys, one `name/hash/file` per line, see authorized
+func (s *Server) serveAdmin(w http.ResponseWriter, r *http.Request) {
+	switch {
+	case r.URL.Path == "/_cache/stats" && r.Method == http.MethodGet:
+		w.Header().Set("Content-Type", "application/json; charset=UTF-8")
+		json.NewEncoder(w).Encode(s.Cache.Stats())
+
+	case r.URL.Path == "/_cache/pin" && (r.Method == http.MethodPost || r.Method == http.MethodDelete):
+		if !s.authorized(r) {
+			w.WriteHeader(http.StatusUnauthorized)
+			return
+		}
+		data, err := ioutil.ReadAll(io.LimitReader(r.Body, 4<<20))
+		if err != nil {
+			w.WriteHeader(http.StatusBadRequest)
+			return
+		}
+		var keys []string
+		for _, line := range strings.Split(string(data), "\n") {
+			if name, hash, file, ok := parseKey(strings.TrimSpace(line)); ok {
+				keys = append(keys, strings.ToLower(name+"/"+hash+"/"+file))
+			}
+		}
+		if r.Method == http.MethodPost {
+			if err = s.Cache.Pin(keys...); err != nil {
+				log.Warn("[Proxy] Pin %d keys failed: %v.", len(keys), err)
+				http.Error(w, err.Error(), http.StatusRequestEntityTooLarge)
+				return
+			}
+			log.Info("[Proxy] Pin %d keys.", len(keys))
+		} else {
+			s.Cache.Unpin(keys...)
+			log.Info("[Proxy] Unpin %d keys.", len(keys))
+		}
+		w.WriteHeader(http.StatusOK)
+
+	default:
+		http.NotFound(w, r)
+	}
+}
+
+// ServeHTTP implement http.Handler
+func (s *Server) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	if strings.HasPrefix(r.URL.Path, "/_cache/") {
+		s.serveAdmin(w, r)
+		return
+	}
+	if r.Method != http.MethodGet && r.Method != http.MethodHead {
+		w.WriteHeader(http.StatusMethodNotAllowed)
+		return
+	}
+	name, hash, file, ok := parseKey(r.URL.Path)
+	if !ok {
+		http.NotFound(w, r)
+		return
+	}
+	key := strings.ToLower(name + "/" + hash + "/" + file)
+
+	if fpath, ok := s.Cache.Acquire(key); ok {
+		defer s.Cache.Release(key)
+		log.Trace("[Proxy] Cache hit %s.", key)
+		w.Header().Set("Cache-Control", CacheControl)
+		http.ServeFile(w, r, fpath)
+		return
+	}
+
+	body, _, err := s.Client.Fetch(name, hash, file)
+	if err != nil {
+		if os.IsNotExist(err) {
+			http.NotFound(w, r)
+		} else {
+			log.Error(2, "[Proxy] Fetch %s failed: %v.", key, err)
+			w.WriteHeader(http.StatusBadGateway)
+		}
+		return
+	}
+	defer body.Close()
+
+	if _, err = s.Cache.Put(key, body); err != nil {
+		log.Error(2, "[Proxy] Cache %s failed: %v.", key, err)
+		w.WriteHeader(http.StatusBadGateway)
+		return
+	}
+	fpath, ok := s.Cache.hold(key)
+	if !ok {
+		// evicted at once, cache is smaller than the file
+		http.NotFound(w, r)
+		return
+	}
+	defer s.Cache.Release(key)
+	w.Header().Set("Cache-Control", CacheControl)
+	http.ServeFile(w, r, fpath)
+}
@@ -0,0 +1,188 @@
+package proxy
+
+import (
+	"fmt"
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"strings"
+	"testing"
+)
+
+func TestReadThrough(t *testing.T) {
+	hits := 0
+	upstream := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		hits++
+		if r.URL.Path == "/api/symbol/main/AAAA1/foo.pdb" {
+			w.Write([]byte(strings.Repeat("x", 100)))
+			return
+		}
+		http.NotFound(w, r)
+	}))
+	defer upstream.Close()
+
+	dir, err := ioutil.TempDir("", "symcache")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+
+	cache, err := NewCache(dir, 150)
+	if err != nil {
+		t.Fatal(err)
+	}
+	srv := httptest.NewServer(&Server{
+		Cache:  cache,
+		Client: NewClient([]string{upstream.URL + "/api/symbol/main/{hash}/{name}"}),
+	})
+	defer srv.Close()
+
+	for i := 0; i < 2; i++ {
+		resp, err := http.Get(srv.URL + "/foo.pdb/AAAA1/foo.pdb")
+		if err != nil {
+			t.Fatal(err)
+		}
+		data, _ := ioutil.ReadAll(resp.Body)
+		resp.Body.Close()
+		if resp.StatusCode != http.StatusOK || len(data) != 100 {
+			t.Fatalf("unexpected response %s, %d bytes", resp.Status, len(data))
+		}
+	}
+	if hits != 1 {
+		t.Fatalf("expect 1 upstream request, got %d", hits)
+	}
+	if st := cache.Stats(); st.Hits != 1 || st.Misses != 1 {
+		t.Fatalf("expect 1 hit and 1 miss, got %+v", st)
+	}
+
+	resp, _ := http.Get(srv.URL + "/bar.pdb/BBBB1/bar.pdb")
+	resp.Body.Close()
+	if resp.StatusCode != http.StatusNotFound {
+		t.Fatalf("expect not found, got %s", resp.Status)
+	}
+}
+
+func TestCacheEvict(t *testing.T) {
+	dir, err := ioutil.TempDir("", "symcache")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+
+	cache, _ := NewCache(dir, 250)
+	cache.Put("a/1/a", strings.NewReader(strings.Repeat("a", 100)))
+	cache.Put("b/1/b", strings.NewReader(strings.Repeat("b", 100)))
+	cache.Get("a/1/a")
+	cache.Put("c/1/c", strings.NewReader(strings.Repeat("c", 100)))
+
+	if _, ok := cache.Get("b/1/b"); ok {
+		t.Error("least recently used b should be evicted")
+	}
+	if _, ok := cache.Get("a/1/a"); !ok {
+		t.Error("a should be kept")
+	}
+	if size, n := cache.Size(); size != 200 || n != 2 {
+		t.Errorf("unexpected cache size %d, %d files", size, n)
+	}
+}
+
+func TestCachePin(t *testing.T) {
+	dir, err := ioutil.TempDir("", "symcache")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+
+	cache, _ := NewCache(dir, 150)
+	cache.Pin("a/1/a")
+	cache.Put("a/1/a", strings.NewReader(strings.Repeat("a", 100)))
+	cache.Put("b/1/b", strings.NewReader(strings.Repeat("b", 100)))
+
+	if _, ok := cache.Get("a/1/a"); !ok {
+		t.Error("pinned a should be kept")
+	}
+	if _, ok := cache.Get("b/1/b"); ok {
+		t.Error("b should be evicted")
+	}
+
+	st := cache.Stats()
+	if st.Evictions != 1 || st.Hits != 1 || st.Misses != 1 || st.Pinned != 1 {
+		t.Errorf("unexpected stats %+v", st)
+	}
+}
+
+func TestPinAuth(t *testing.T) {
+	dir, err := ioutil.TempDir("", "symcache")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+
+	cache, _ := NewCache(dir, 150)
+	s := &Server{Cache: cache, Token: "secret"}
+	pin := func(auth string) int {
+		r := httptest.NewRequest(http.MethodPost, "/_cache/pin", strings.NewReader("a/1/a\n"))
+		if auth != "" {
+			r.Header.Set("Authorization", auth)
+		}
+		w := httptest.NewRecorder()
+		s.ServeHTTP(w, r)
+		return w.Code
+	}
+	if code := pin(""); code != http.StatusUnauthorized {
+		t.Errorf("expect unauthorized without token, got %d", code)
+	}
+	if code := pin("Bearer wrong"); code != http.StatusUnauthorized {
+		t.Errorf("expect unauthorized with wrong token, got %d", code)
+	}
+	if code := pin("Bearer secret"); code != http.StatusOK || cache.Stats().Pinned != 1 {
+		t.Errorf("expect pinned with token, got %d", code)
+	}
+
+	s.Token = ""
+	if code := pin(""); code != http.StatusUnauthorized {
+		t.Errorf("expect remote client refused, got %d", code) // httptest remote 192.0.2.1
+	}
+
+	keys := make([]string, MaxPins)
+	for i := range keys {
+		keys[i] = fmt.Sprintf("b/%d/b", i)
+	}
+	if err = cache.Pin(keys...); err != ErrTooManyPins || cache.Stats().Pinned != 1 {
+		t.Errorf("expect too many pins, got %v", err)
+	}
+}
+
+func TestVerifyChecksum(t *testing.T) {
+	// sha256 of "abc"
+	sum := "ba7816bf8f01cfea414140de5dae2223b00361a396177a9cb410ff61f20015ad"
+	upstream := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set(HeaderChecksum, sum)
+		if r.URL.Path == "/good.pdb/AAAA1/good.pdb" {
+			w.Write([]byte("abc"))
+		} else {
+			w.Write([]byte("abd"))
+		}
+	}))
+	defer upstream.Close()
+
+	dir, err := ioutil.TempDir("", "verify")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+
+	c := NewClient([]string{upstream.URL})
+	good := dir + "/good.pdb"
+	if err := c.Download("good.pdb", "AAAA1", "good.pdb", good); err != nil {
+		t.Fatal(err)
+	}
+	bad := dir + "/bad.pdb"
+	if err := c.Download("bad.pdb", "AAAA1", "bad.pdb", bad); err != ErrChecksumMismatch {
+		t.Fatalf("expect checksum mismatch, got %v", err)
+	}
+	if _, err := os.Stat(bad); !os.IsNotExist(err) {
+		t.Fatalf("corrupted file should not be saved: %v", err)
+	}
+}
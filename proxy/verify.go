@@ -0,0 +1,87 @@
+package proxy
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"fmt"
+	"hash"
+	"io"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"strings"
+)
+
+const (
+	// HeaderChecksum carry the hex sha256 of served symbol file
+	HeaderChecksum = "X-Checksum-Sha256"
+)
+
+var (
+	ErrChecksumMismatch = fmt.Errorf("checksum mismatch")
+)
+
+// verifyReader hash the content while reading, and fail at EOF if not match.
+type verifyReader struct {
+	rc   io.ReadCloser
+	h    hash.Hash
+	want string
+}
+
+// VerifyReader wrap `rc` so that reading to the end return `ErrChecksumMismatch`
+// if the content doesn't match the hex `sha256`. Empty `sha256` return `rc` as is.
+//
+func VerifyReader(rc io.ReadCloser, sha256sum string) io.ReadCloser {
+	if sha256sum == "" {
+		return rc
+	}
+	return &verifyReader{
+		rc:   rc,
+		h:    sha256.New(),
+		want: strings.ToLower(sha256sum),
+	}
+}
+
+func (v *verifyReader) Read(p []byte) (int, error) {
+	n, err := v.rc.Read(p)
+	v.h.Write(p[:n])
+	if err == io.EOF {
+		if got := hex.EncodeToString(v.h.Sum(nil)); got != v.want {
+			return n, ErrChecksumMismatch
+		}
+	}
+	return n, err
+}
+
+func (v *verifyReader) Close() error {
+	return v.rc.Close()
+}
+
+// Download fetch symbol file to `dest` and verify the checksum sent by server,
+// `dest` is left untouched if the transfer is corrupted.
+//
+func (c *Client) Download(name, hash, file, dest string) error {
+	body, _, err := c.Fetch(name, hash, file)
+	if err != nil {
+		return err
+	}
+	defer body.Close()
+
+	if err = os.MkdirAll(filepath.Dir(dest), 0755); err != nil {
+		return err
+	}
+	tmp, err := ioutil.TempFile(filepath.Dir(dest), filepath.Base(dest)+".*.tmp")
+	if err != nil {
+		return err
+	}
+	_, err = io.Copy(tmp, body)
+	tmp.Close()
+	if err != nil {
+		os.Remove(tmp.Name())
+		return err
+	}
+	if err = os.Rename(tmp.Name(), dest); err != nil {
+		os.Remove(tmp.Name())
+	}
+	return err
+}
@@ -0,0 +1,434 @@
+package query
+
+import (
+	"fmt"
+	"path"
+	"strconv"
+	"strings"
+	"time"
+	"unicode"
+)
+
+// Kind of field, decide how values are compared
+//
+type Kind int
+
+// Field kinds
+const (
+	String  Kind = iota // case insensitive, `~` match glob or substring
+	Number              // integer or float
+	Version             // dot or dash separated numbers, eg: 4175.2-538
+	Date                // 2006-01-02 or 2006-01-02 15:04:05
+	Bool                // true or false
+)
+
+// Schema is the filterable fields of an list, field name => kind
+//
+type Schema map[string]Kind
+
+// Expr is a parsed filter expression.
+// `get` return the value of field, as it is formatted in json.
+//
+type Expr interface {
+	Match(get func(field string) string) bool
+	String() string
+}
+
+// Cond is a single comparison, eg: `version>=4175`
+//
+type Cond struct {
+	Field string
+	Op    string // =, !=, >, >=, <, <=, ~, !~
+	Value string
+	Kind  Kind
+}
+
+// Logic combine two expressions with AND or OR
+//
+type Logic struct {
+	Op    string
+	Left  Expr
+	Right Expr
+}
+
+// Not negate an expression
+//
+type Not struct {
+	X Expr
+}
+
+// Match evaluate the condition against field value
+func (c *Cond) Match(get func(field string) string) bool {
+	val := get(c.Field)
+	switch c.Op {
+	case "~":
+		return like(val, c.Value)
+	case "!~":
+		return !like(val, c.Value)
+	}
+
+	cmp := compare(c.Kind, val, c.Value)
+	switch c.Op {
+	case "=":
+		return cmp == 0
+	case "!=":
+		return cmp != 0
+	case ">":
+		return cmp > 0
+	case ">=":
+		return cmp >= 0
+	case "<":
+		return cmp < 0
+	case "<=":
+		return cmp <= 0
+	}
+	return false
+}
+
+func (c *Cond) String() string {
+	return fmt.Sprintf("%s%s%q", c.Field, c.Op, c.Value)
+}
+
+// Match evaluate both sides, short circuit
+func (l *Logic) Match(get func(field string) string) bool {
+	if l.Op == "AND" {
+		return l.Left.Match(get) && l.Right.Match(get)
+	}
+	return l.Left.Match(get) || l.Right.Match(get)
+}
+
+func (l *Logic) String() string {
+	return fmt.Sprintf("(%s %s %s)", l.Left, l.Op, l.Right)
+}
+
+// Match negate the inner expression
+func (n *Not) Match(get func(field string) string) bool {
+	return !n.X.Match(get)
+}
+
+func (n *Not) String() string {
+	return fmt.Sprintf("NOT %s", n.X)
+}
+
+// Conjuncts split the top level AND of expression, eg: `a AND (b OR c) AND d` gives
+// a, (b OR c) and d. A backend translates the conditions it indexes and match the rest.
+//
+func Conjuncts(e Expr) []Expr {
+	if l, ok := e.(*Logic); ok && l.Op == "AND" {
+		return append(Conjuncts(l.Left), Conjuncts(l.Right)...)
+	}
+	if e == nil {
+		return nil
+	}
+	return []Expr{e}
+}
+
+// Fields return names of fields referenced by expression
+//
+func Fields(e Expr) []string {
+	switch x := e.(type) {
+	case *Cond:
+		return []string{x.Field}
+	case *Logic:
+		return append(Fields(x.Left), Fields(x.Right)...)
+	case *Not:
+		return Fields(x.X)
+	}
+	return nil
+}
+
+// Parse compile filter expression against the schema, eg:
+//	version>=4175 AND arch=x64 AND date>2024-01-01
+//	(name~ca_* OR name="foo bar.pdb") AND NOT release=true
+// Empty expression return nil Expr, which means no filter.
+//
+func Parse(expr string, schema Schema) (Expr, error) {
+	toks, err := tokenize(expr)
+	if err != nil {
+		return nil, err
+	}
+	if len(toks) == 0 {
+		return nil, nil
+	}
+
+	p := &parser{toks: toks, schema: schema}
+	e, err := p.parseOr()
+	if err != nil {
+		return nil, err
+	}
+	if p.pos < len(p.toks) {
+		return nil, fmt.Errorf("unexpected %q at %d", p.toks[p.pos].text, p.toks[p.pos].at)
+	}
+	return e, nil
+}
+
+type tokType int
+
+const (
+	tokWord tokType = iota
+	tokQuoted
+	tokOp
+	tokLParen
+	tokRParen
+)
+
+type token struct {
+	typ  tokType
+	text string
+	at   int
+}
+
+func isSpecial(r byte) bool {
+	return strings.IndexByte("()=!<>~\"", r) != -1 || unicode.IsSpace(rune(r))
+}
+
+func tokenize(s string) ([]token, error) {
+	var toks []token
+	for i := 0; i < len(s); {
+		c := s[i]
+		switch {
+		case unicode.IsSpace(rune(c)):
+			i++
+		case c == '(':
+			toks = append(toks, token{tokLParen, "(", i})
+			i++
+		case c == ')':
+			toks = append(toks, token{tokRParen, ")", i})
+			i++
+		case c == '"':
+			end := strings.IndexByte(s[i+1:], '"')
+			if end == -1 {
+				return nil, fmt.Errorf("unterminated quote at %d", i)
+			}
+			toks = append(toks, token{tokQuoted, s[i+1 : i+1+end], i})
+			i += end + 2
+		case strings.IndexByte("=!<>~", c) != -1:
+			op := string(c)
+			if i+1 < len(s) && (s[i+1] == '=' || (c == '!' && s[i+1] == '~')) {
+				op += string(s[i+1])
+			}
+			if op == "!" {
+				return nil, fmt.Errorf("invalid operator %q at %d", op, i)
+			}
+			toks = append(toks, token{tokOp, op, i})
+			i += len(op)
+			if op == "==" {
+				toks[len(toks)-1].text = "="
+			}
+		default:
+			start := i
+			for i < len(s) && !isSpecial(s[i]) {
+				i++
+			}
+			toks = append(toks, token{tokWord, s[start:i], start})
+		}
+	}
+	return toks, nil
+}
+
+type parser struct {
+	toks   []token
+	pos    int
+	schema Schema
+}
+
+func (p *parser) peekKeyword(kw string) bool {
+	return p.pos < len(p.toks) && p.toks[p.pos].typ == tokWord && strings.EqualFold(p.toks[p.pos].text, kw)
+}
+
+func (p *parser) parseOr() (Expr, error) {
+	left, err := p.parseAnd()
+	for err == nil && p.peekKeyword("OR") {
+		p.pos++
+		var right Expr
+		if right, err = p.parseAnd(); err == nil {
+			left = &Logic{Op: "OR", Left: left, Right: right}
+		}
+	}
+	return left, err
+}
+
+func (p *parser) parseAnd() (Expr, error) {
+	left, err := p.parseUnary()
+	for err == nil && p.peekKeyword("AND") {
+		p.pos++
+		var right Expr
+		if right, err = p.parseUnary(); err == nil {
+			left = &Logic{Op: "AND", Left: left, Right: right}
+		}
+	}
+	return left, err
+}
+
+func (p *parser) parseUnary() (Expr, error) {
+	if p.pos >= len(p.toks) {
+		return nil, fmt.Errorf("unexpected end of expression")
+	}
+	if p.peekKeyword("NOT") {
+		p.pos++
+		x, err := p.parseUnary()
+		if err != nil {
+			return nil, err
+		}
+		return &Not{X: x}, nil
+	}
+	if p.toks[p.pos].typ == tokLParen {
+		p.pos++
+		e, err := p.parseOr()
+		if err != nil {
+			return nil, err
+		}
+		if p.pos >= len(p.toks) || p.toks[p.pos].typ != tokRParen {
+			return nil, fmt.Errorf("missing ')'")
+		}
+		p.pos++
+		return e, nil
+	}
+	return p.parseCond()
+}
+
+func (p *parser) parseCond() (Expr, error) {
+	if p.pos+3 > len(p.toks) {
+		return nil, fmt.Errorf("incomplete condition at %d", p.toks[p.pos].at)
+	}
+	field, op, val := p.toks[p.pos], p.toks[p.pos+1], p.toks[p.pos+2]
+	if field.typ != tokWord {
+		return nil, fmt.Errorf("expect field name at %d", field.at)
+	}
+	if op.typ != tokOp {
+		return nil, fmt.Errorf("expect operator after %s at %d", field.text, op.at)
+	}
+	if val.typ != tokWord && val.typ != tokQuoted {
+		return nil, fmt.Errorf("expect value after %s%s at %d", field.text, op.text, val.at)
+	}
+
+	name := strings.ToLower(field.text)
+	kind, ok := p.schema[name]
+	if !ok {
+		return nil, fmt.Errorf("unknown field %q", field.text)
+	}
+	c := &Cond{Field: name, Op: op.text, Value: val.text, Kind: kind}
+	if err := c.check(); err != nil {
+		return nil, err
+	}
+	p.pos += 3
+	return c, nil
+}
+
+// check the value is valid for field kind, and normalize it
+func (c *Cond) check() error {
+	if c.Op == "~" || c.Op == "!~" {
+		if c.Kind != String {
+			return fmt.Errorf("operator %s only apply to text field, not %s", c.Op, c.Field)
+		}
+		return nil
+	}
+	switch c.Kind {
+	case Number:
+		if _, err := strconv.ParseFloat(c.Value, 64); err != nil {
+			return fmt.Errorf("invalid number %q for %s", c.Value, c.Field)
+		}
+	case Date:
+		d, ok := normalizeDate(c.Value)
+		if !ok {
+			return fmt.Errorf("invalid date %q for %s", c.Value, c.Field)
+		}
+		c.Value = d
+	case Bool:
+		if _, err := strconv.ParseBool(c.Value); err != nil {
+			return fmt.Errorf("invalid bool %q for %s", c.Value, c.Field)
+		}
+		if c.Op != "=" && c.Op != "!=" {
+			return fmt.Errorf("operator %s not apply to %s", c.Op, c.Field)
+		}
+	}
+	return nil
+}
+
+var dateLayouts = []string{
+	"2006-01-02 15:04:05",
+	"2006-01-02 15:04",
+	"2006-01-02",
+	"2006/1/2",
+	"01/02/2006",
+}
+
+// normalizeDate format date as `2006-01-02 15:04:05`, the time part is omitted if not given,
+// then field values are compared by day, eg: `date=2024-01-01` match the whole day.
+func normalizeDate(s string) (string, bool) {
+	for _, layout := range dateLayouts {
+		t, err := time.ParseInLocation(layout, s, time.Local)
+		if err != nil {
+			continue
+		}
+		if strings.Contains(layout, "15") {
+			return t.Format("2006-01-02 15:04:05"), true
+		}
+		return t.Format("2006-01-02"), true
+	}
+	return "", false
+}
+
+func compare(kind Kind, a, b string) int {
+	switch kind {
+	case Number:
+		x, _ := strconv.ParseFloat(a, 64)
+		y, _ := strconv.ParseFloat(b, 64)
+		switch {
+		case x < y:
+			return -1
+		case x > y:
+			return 1
+		}
+		return 0
+	case Version:
+		return compareVersion(a, b)
+	case Date:
+		if d, ok := normalizeDate(a); ok {
+			a = d
+		}
+		if len(b) < len(a) {
+			// date only, compare by day
+			a = a[:len(b)]
+		}
+		return strings.Compare(a, b)
+	case Bool:
+		x, _ := strconv.ParseBool(a)
+		y, _ := strconv.ParseBool(b)
+		if x == y {
+			return 0
+		}
+		return 1
+	}
+	return strings.Compare(strings.ToLower(a), strings.ToLower(b))
+}
+
+// compareVersion compare numeric parts in order, missing parts of the shorter one
+// are ignored, so `4175.2-538` equals `4175` and is greater than `4174.9`.
+func compareVersion(a, b string) int {
+	split := func(s string) []string {
+		return strings.FieldsFunc(s, func(r rune) bool { return !unicode.IsDigit(r) })
+	}
+	pa, pb := split(a), split(b)
+	for i := 0; i < len(pa) && i < len(pb); i++ {
+		x, _ := strconv.ParseUint(pa[i], 10, 64)
+		y, _ := strconv.ParseUint(pb[i], 10, 64)
+		switch {
+		case x < y:
+			return -1
+		case x > y:
+			return 1
+		}
+	}
+	return 0
+}
+
+// like match glob if pattern has wildcard, otherwise substring. Case insensitive.
+func like(val, pattern string) bool {
+	val, pattern = strings.ToLower(val), strings.ToLower(pattern)
+	if strings.ContainsAny(pattern, "*?[") {
+		ok, _ := path.Match(pattern, val)
+		return ok
+	}
+	return strings.Contains(val, pattern)
+}
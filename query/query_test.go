@@ -0,0 +1,94 @@
+package query
+
+import "testing"
+
+var testSchema = Schema{
+	"version": Version,
+	"arch":    String,
+	"name":    String,
+	"date":    Date,
+	"size":    Number,
+	"release": Bool,
+}
+
+func TestParseMatch(t *testing.T) {
+	row := map[string]string{
+		"version": "4175.2-538",
+		"arch":    "x64",
+		"name":    "ca_agent.pdb",
+		"date":    "2024-03-05 10:20:30",
+		"size":    "1024",
+		"release": "false",
+	}
+	get := func(field string) string { return row[field] }
+
+	cases := []struct {
+		expr  string
+		match bool
+	}{
+		{"version>=4175 AND arch=x64 AND date>2024-01-01", true},
+		{"version>4175.2-537", true},
+		{"version<4175.2", false},
+		{"arch=X64 and not release=true", true},
+		{"name~ca_*.pdb", true},
+		{"name~agent", true},
+		{"name!~ca_*", false},
+		{"(arch=x86 OR size>=1024) AND date=2024-03-05", true},
+		{"arch = x86 OR name = \"foo bar.pdb\"", false},
+		{"date<\"2024-03-05 10:20:31\"", true},
+		{"size==1024.0", true},
+		{"", true},
+	}
+	for _, c := range cases {
+		e, err := Parse(c.expr, testSchema)
+		if err != nil {
+			t.Fatalf("parse %q failed: %v", c.expr, err)
+		}
+		if e == nil {
+			if c.expr != "" {
+				t.Fatalf("parse %q return nil", c.expr)
+			}
+			continue
+		}
+		if got := e.Match(get); got != c.match {
+			t.Errorf("%q (%s) match %v, expect %v", c.expr, e, got, c.match)
+		}
+	}
+}
+
+func TestParseError(t *testing.T) {
+	for _, expr := range []string{
+		"owner=me",
+		"arch=",
+		"arch x64",
+		"(arch=x64",
+		"arch=x64 AND",
+		"date>yesterday",
+		"size>big",
+		"release>true",
+		"version~41*",
+		"name=\"open",
+		"arch=x64 x86",
+	} {
+		if _, err := Parse(expr, testSchema); err == nil {
+			t.Errorf("expect error for %q", expr)
+		}
+	}
+}
+
+func TestConjuncts(t *testing.T) {
+	e, err := Parse("arch=x64 AND (name~ca_* OR size>1) AND NOT release=true", testSchema)
+	if err != nil {
+		t.Fatal(err)
+	}
+	parts := Conjuncts(e)
+	if len(parts) != 3 || parts[0].String() != `arch="x64"` {
+		t.Fatalf("unexpected conjuncts %v", parts)
+	}
+	if fields := Fields(parts[1]); len(fields) != 2 || fields[0] != "name" || fields[1] != "size" {
+		t.Fatalf("unexpected fields %v", fields)
+	}
+	if Conjuncts(nil) != nil {
+		t.Fatal("expect no conjunct of nil filter")
+	}
+}
@@ -0,0 +1,311 @@
+package report
+
+import (
+	"bytes"
+	"context"
+	"fmt"
+	"html/template"
+	"path"
+	"sort"
+	"strings"
+	"time"
+
+	"github.com/adyzng/GoSymbols/alert"
+	"github.com/adyzng/GoSymbols/config"
+	"github.com/adyzng/GoSymbols/symbol"
+	log "gopkg.in/clog.v1"
+)
+
+const (
+	dateFormat = "2006-01-02 15:04:05"
+	otherGroup = "Other"
+)
+
+// BranchReport summarize one branch in the report period
+//
+type BranchReport struct {
+	Branch      string                  `json:"branch"`
+	Builds      int                     `json:"builds"`      // builds ingested
+	Supplements int                     `json:"supplements"` // supplementary transactions
+	Files       int                     `json:"files"`       // symbol files added
+	Bytes       int64                   `json:"bytes"`       // store growth
+	Missing     int                     `json:"missing"`     // builds on build server not in store
+	Latest      string                  `json:"latest"`
+	Failures    []*symbol.IngestFailure `json:"failures,omitempty"`
+	SLO         *symbol.SLOStatus       `json:"slo,omitempty"` // latency of builds, nil if the branch has no SLO
+}
+
+// GroupReport summarize branches of one product group
+//
+type GroupReport struct {
+	Name     string          `json:"name"`
+	Builds   int             `json:"builds"`
+	Failures int             `json:"failures"`
+	Bytes    int64           `json:"bytes"`
+	Missing  int             `json:"missing"`
+	Late     int             `json:"late"` // builds available later than SLO
+	Branches []*BranchReport `json:"branches"`
+}
+
+// Report is the summary of all groups in period [From, To)
+//
+type Report struct {
+	From   string         `json:"from"`
+	To     string         `json:"to"`
+	Groups []*GroupReport `json:"groups"`
+}
+
+// group is one configured product group, `name:glob|glob`
+type group struct {
+	name  string
+	globs []string
+}
+
+func parseGroups(conf []string) []*group {
+	var groups []*group
+	for _, s := range conf {
+		idx := strings.Index(s, ":")
+		if idx <= 0 {
+			log.Warn("[Report] Invalid group %q, expect name:glob|glob.", s)
+			continue
+		}
+		groups = append(groups, &group{
+			name:  strings.TrimSpace(s[:idx]),
+			globs: strings.Split(strings.ToLower(s[idx+1:]), "|"),
+		})
+	}
+	return groups
+}
+
+// groupOf return the first group whose glob match branch name
+func groupOf(groups []*group, branch string) string {
+	lower := strings.ToLower(branch)
+	for _, g := range groups {
+		for _, glob := range g.globs {
+			if ok, _ := path.Match(strings.TrimSpace(glob), lower); ok {
+				return g.name
+			}
+		}
+	}
+	return otherGroup
+}
+
+// Generate summarize all local branches in period [from, to).
+//
+func Generate(from, to time.Time) *Report {
+	rp := &Report{
+		From: from.Format(dateFormat),
+		To:   to.Format(dateFormat),
+	}
+	groups := parseGroups(config.ReportGroups)
+	byName := make(map[string]*GroupReport)
+
+	symbol.GetServer().WalkBuilders(func(bu symbol.Builder) error {
+		b, ok := bu.(*symbol.BrBuilder)
+		if !ok {
+			return nil
+		}
+		br := branchReport(b, rp.From, rp.To)
+		name := groupOf(groups, b.Name())
+		g := byName[name]
+		if g == nil {
+			g = &GroupReport{Name: name}
+			byName[name] = g
+			rp.Groups = append(rp.Groups, g)
+		}
+		g.Branches = append(g.Branches, br)
+		g.Builds += br.Builds
+		g.Failures += len(br.Failures)
+		g.Bytes += br.Bytes
+		g.Missing += br.Missing
+		if br.SLO != nil {
+			g.Late += br.SLO.Violations
+		}
+		return nil
+	})
+
+	sort.Slice(rp.Groups, func(i, j int) bool {
+		if rp.Groups[i].Name == otherGroup || rp.Groups[j].Name == otherGroup {
+			return rp.Groups[j].Name == otherGroup && rp.Groups[i].Name != otherGroup
+		}
+		return rp.Groups[i].Name < rp.Groups[j].Name
+	})
+	for _, g := range rp.Groups {
+		sort.Slice(g.Branches, func(i, j int) bool {
+			return g.Branches[i].Branch < g.Branches[j].Branch
+		})
+	}
+	return rp
+}
+
+func branchReport(b *symbol.BrBuilder, from, to string) *BranchReport {
+	br := &BranchReport{
+		Branch: b.Name(),
+		Latest: b.LatestBuild,
+	}
+	b.ParseBuilds(context.Background(), func(build *symbol.Build) error {
+		if build.Date < from || build.Date >= to {
+			return nil
+		}
+		if build.SupplementOf == "" {
+			br.Builds++
+		} else {
+			br.Supplements++
+		}
+		files, size, err := b.TransactionSize(build.ID)
+		if err != nil {
+			log.Warn("[Report] Size of transaction %s in %s failed: %v.", build.ID, b.Name(), err)
+		}
+		br.Files += files
+		br.Bytes += size
+		return nil
+	})
+
+	failures, err := b.Failures(from)
+	if err != nil {
+		log.Warn("[Report] Read failures of %s failed: %v.", b.Name(), err)
+	}
+	for _, f := range failures {
+		if f.Date < to {
+			br.Failures = append(br.Failures, f)
+		}
+	}
+	if b.SLO > 0 {
+		br.SLO = b.SLOStatus(from, to)
+	}
+	if b.CanUpdate() {
+		if missing, err := b.MissingBuilds(); err == nil {
+			br.Missing = len(missing)
+		}
+	}
+	return br
+}
+
+var funcs = template.FuncMap{
+	"size": func(n int64) string {
+		switch {
+		case n >= 1<<30:
+			return fmt.Sprintf("%.1f GB", float64(n)/(1<<30))
+		case n >= 1<<20:
+			return fmt.Sprintf("%.1f MB", float64(n)/(1<<20))
+		}
+		return fmt.Sprintf("%.1f KB", float64(n)/(1<<10))
+	},
+}
+
+var page = template.Must(template.New("report").Funcs(funcs).Parse(`<!DOCTYPE html>
+<html>
+<head>
+<meta charset="utf-8">
+<title>Symbol store report {{.From}} - {{.To}}</title>
+<style>
+body { font-family: Segoe UI, Arial, sans-serif; font-size: 14px; }
+table { border-collapse: collapse; margin-bottom: 16px; }
+th, td { border: 1px solid #ccc; padding: 4px 8px; text-align: right; }
+th:first-child, td:first-child { text-align: left; }
+.bad { color: #c00; }
+</style>
+</head>
+<body>
+<h2>Symbol store report</h2>
+<p>{{.From}} - {{.To}}</p>
+{{range .Groups}}
+<h3>{{.Name}}</h3>
+<p>{{.Builds}} builds ingested, {{.Failures}} failures, {{size .Bytes}} growth, {{.Missing}} builds missing, {{.Late}} builds over SLO.</p>
+<table>
+<tr><th>Branch</th><th>Builds</th><th>Supplements</th><th>Files</th><th>Growth</th><th>Failures</th><th>Missing</th><th>Over SLO</th><th>Latency p95</th><th>Latest</th></tr>
+{{range .Branches}}
+<tr><td>{{.Branch}}</td><td>{{.Builds}}</td><td>{{.Supplements}}</td><td>{{.Files}}</td><td>{{size .Bytes}}</td>
+<td{{if .Failures}} class="bad"{{end}}>{{len .Failures}}</td><td{{if .Missing}} class="bad"{{end}}>{{.Missing}}</td>
+{{if .SLO}}<td{{if .SLO.Violations}} class="bad"{{end}}>{{.SLO.Violations}}/{{.SLO.Measured}}</td><td>{{.SLO.P95}} / {{.SLO.SLO}} min</td>{{else}}<td>-</td><td>-</td>{{end}}<td>{{.Latest}}</td></tr>
+{{end}}
+</table>
+{{range .Branches}}{{$branch := .Branch}}{{range .Failures}}
+<div class="bad">{{$branch}} build {{.Version}} failed at {{.Date}}: {{.Error}}</div>
+{{end}}{{if .SLO}}{{range .SLO.Violated}}
+<div class="bad">{{$branch}} build {{.Version}} available {{.Latency.Minutes}} minutes after built at {{.Latency.Built}}</div>
+{{end}}{{end}}{{end}}
+{{end}}
+</body>
+</html>
+`))
+
+// HTML render the report as standalone html page.
+//
+func (rp *Report) HTML() ([]byte, error) {
+	var buf bytes.Buffer
+	if err := page.Execute(&buf, rp); err != nil {
+		return nil, err
+	}
+	return buf.Bytes(), nil
+}
+
+// Deliver render one html summary per product group and send them to alert sinks.
+//
+func (rp *Report) Deliver() error {
+	for _, g := range rp.Groups {
+		single := &Report{From: rp.From, To: rp.To, Groups: []*GroupReport{g}}
+		data, err := single.HTML()
+		if err != nil {
+			return err
+		}
+		alert.Deliver(&alert.Alert{
+			Kind: alert.KindWeeklyReport,
+			Message: fmt.Sprintf("%s symbol report %s - %s: %d builds ingested, %d failures.",
+				g.Name, rp.From, rp.To, g.Builds, g.Failures),
+			HTML: string(data),
+		})
+	}
+	return nil
+}
+
+// nextRun return the next time matching schedule `Mon 08:00` after `now`
+func nextRun(schedule string, now time.Time) (time.Time, error) {
+	var day string
+	var hour, minute int
+	if _, err := fmt.Sscanf(schedule, "%s %d:%d", &day, &hour, &minute); err != nil || len(day) < 3 {
+		return time.Time{}, fmt.Errorf("invalid schedule %q, expect `Mon 08:00`", schedule)
+	}
+	weekday := -1
+	for d := time.Sunday; d <= time.Saturday; d++ {
+		if strings.EqualFold(d.String()[:3], day[:3]) {
+			weekday = int(d)
+		}
+	}
+	if weekday == -1 || hour > 23 || minute > 59 {
+		return time.Time{}, fmt.Errorf("invalid schedule %q, expect `Mon 08:00`", schedule)
+	}
+
+	next := time.Date(now.Year(), now.Month(), now.Day(), hour, minute, 0, 0, now.Location())
+	next = next.AddDate(0, 0, (weekday-int(now.Weekday())+7)%7)
+	if !next.After(now) {
+		next = next.AddDate(0, 0, 7)
+	}
+	return next, nil
+}
+
+// Run deliver the weekly report on config.ReportSchedule until `done` closed.
+//
+func Run(done <-chan struct{}) {
+	if config.ReportSchedule == "" {
+		return
+	}
+	for {
+		next, err := nextRun(config.ReportSchedule, time.Now())
+		if err != nil {
+			log.Error(2, "[Report] %v.", err)
+			return
+		}
+		log.Info("[Report] Next weekly report at %s.", next.Format(dateFormat))
+
+		select {
+		case <-done:
+			return
+		case <-time.After(time.Until(next)):
+		}
+		rp := Generate(next.AddDate(0, 0, -7), next)
+		if err = rp.Deliver(); err != nil {
+			log.Error(2, "[Report] Deliver weekly report failed: %v.", err)
+		}
+	}
+}
@@ -0,0 +1,87 @@
+package report
+
+import (
+	"fmt"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/adyzng/GoSymbols/config"
+	"github.com/adyzng/GoSymbols/symbol"
+)
+
+func TestNextRun(t *testing.T) {
+	// Wednesday
+	now := time.Date(2024, 3, 6, 10, 0, 0, 0, time.Local)
+	cases := map[string]string{
+		"Mon 08:00":    "2024-03-11 08:00:00",
+		"wed 11:30":    "2024-03-06 11:30:00",
+		"Wed 09:00":    "2024-03-13 09:00:00",
+		"Sunday 23:59": "2024-03-10 23:59:00",
+	}
+	for schedule, expect := range cases {
+		next, err := nextRun(schedule, now)
+		if err != nil || next.Format(dateFormat) != expect {
+			t.Errorf("%s: expect %s, got %s (%v)", schedule, expect, next.Format(dateFormat), err)
+		}
+	}
+	for _, schedule := range []string{"", "Mo 08:00", "Mon 25:00", "daily"} {
+		if _, err := nextRun(schedule, now); err == nil {
+			t.Errorf("expect error for %q", schedule)
+		}
+	}
+}
+
+func TestGenerate(t *testing.T) {
+	root, err := ioutil.TempDir("", "report")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(root)
+	config.Destination = root
+	config.ReportGroups = []string{"UDP:udp*|d2d*", "bad group"}
+
+	now := time.Now()
+	for _, name := range []string{"UDPMAIN", "Central"} {
+		store := filepath.Join(root, name)
+		admin := filepath.Join(store, "000Admin")
+		os.MkdirAll(admin, 0755)
+		server := fmt.Sprintf("0000000001,add,file,%s,\"%s\",\"100\",\"\",\r\n", now.AddDate(0, 0, -10).Format("01/02/2006,15:04:05"), name)
+		server += fmt.Sprintf("0000000002,add,file,%s,\"%s\",\"101\",\"\",\r\n", now.AddDate(0, 0, -1).Format("01/02/2006,15:04:05"), name)
+		ioutil.WriteFile(filepath.Join(admin, "server.txt"), []byte(server), 0644)
+		ioutil.WriteFile(filepath.Join(admin, "0000000002"), []byte("\"foo.pdb\\AAAA1\",\"S:\\000Unzip\\foo.pdb\"\r\n"), 0644)
+		os.MkdirAll(filepath.Join(store, "foo.pdb", "AAAA1"), 0755)
+		ioutil.WriteFile(filepath.Join(store, "foo.pdb", "AAAA1", "foo.pdb"), make([]byte, 2048), 0644)
+		ioutil.WriteFile(filepath.Join(admin, "failures.txt"), []byte(
+			now.AddDate(0, 0, -20).Format(dateFormat)+",99,old failure\r\n"+
+				now.AddDate(0, 0, -2).Format(dateFormat)+",102,<copy> timeout\r\n"), 0644)
+		ioutil.WriteFile(filepath.Join(admin, "latency.txt"), []byte(fmt.Sprintf("0000000002,%d,%d\r\n",
+			now.AddDate(0, 0, -1).Add(-3*time.Hour).Unix(), now.AddDate(0, 0, -1).Unix())), 0644)
+		symbol.GetServer().Add(&symbol.Branch{StoreName: name, StorePath: store, BuildPath: store, SLO: 60})
+		defer symbol.GetServer().Delete(name)
+	}
+
+	rp := Generate(now.AddDate(0, 0, -7), now)
+	if len(rp.Groups) != 2 || rp.Groups[0].Name != "UDP" || rp.Groups[1].Name != otherGroup {
+		t.Fatalf("unexpected groups %+v", rp.Groups)
+	}
+	br := rp.Groups[0].Branches[0]
+	if br.Branch != "UDPMAIN" || br.Builds != 1 || br.Files != 1 || br.Bytes != 2048 || len(br.Failures) != 1 {
+		t.Fatalf("unexpected branch report %+v", br)
+	}
+	if br.SLO == nil || br.SLO.Violations != 1 || rp.Groups[0].Late != 1 {
+		t.Fatalf("expect 1 build over SLO, got %+v", br.SLO)
+	}
+
+	data, err := rp.HTML()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !strings.Contains(string(data), "&lt;copy&gt; timeout") || !strings.Contains(string(data), "2.0 KB") ||
+		!strings.Contains(string(data), "available 180 minutes after built") {
+		t.Fatalf("unexpected html %s", data)
+	}
+}
@@ -22,6 +22,9 @@ const (
 	adAuthURI  = "https://login.microsoftonline.com/common/oauth2/v2.0/authorize"
 	adTokenURI = "https://login.microsoftonline.com/common/oauth2/v2.0/token"
 	graphURL   = "https://graph.microsoft.com/v1.0"
+
+	// StateRemember suffix of oauth state when user asked to be remembered
+	StateRemember = "-remember"
 )
 
 func getURL(typ string) string {
@@ -35,9 +38,9 @@ func getURL(typ string) string {
 	}
 }
 
-// AuthURL combine the auth url
+// AuthURL combine the auth url, `remember` is carried back to Authorize by state.
 //
-func AuthURL() string {
+func AuthURL(remember bool) string {
 	if location, err := url.Parse(adAuthURI); err == nil {
 		params := location.Query()
 		params.Add("client_id", config.ClientID)
@@ -45,7 +48,11 @@ func AuthURL() string {
 		params.Add("response_type", "code")
 		params.Add("response_mode", "form_post")
 		params.Add("scope", config.GraphScope)
-		params.Add("state", fmt.Sprintf("%d", time.Now().Unix()))
+		state := fmt.Sprintf("%d", time.Now().Unix())
+		if remember {
+			state += StateRemember
+		}
+		params.Add("state", state)
 		location.RawQuery = params.Encode()
 		return location.String()
 	}
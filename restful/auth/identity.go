@@ -0,0 +1,75 @@
+package auth
+
+import (
+	"context"
+	"net/http"
+	"strings"
+
+	"github.com/adyzng/GoSymbols/config"
+)
+
+type identityKey struct{}
+
+// Identity is who the request is authenticated as by the policy of its zone.
+//
+type Identity struct {
+	User   string   // eg: DOMAIN\user
+	Groups []string // eg: DOMAIN\UDP-Developers, only windows integrated auth give groups
+	Method string   // auth method which granted the request
+}
+
+// WithIdentity attach authenticated identity to request.
+//
+func WithIdentity(r *http.Request, id *Identity) *http.Request {
+	return r.WithContext(context.WithValue(r.Context(), identityKey{}, id))
+}
+
+// RequestIdentity return identity of request, nil if not authenticated by zone policy.
+//
+func RequestIdentity(r *http.Request) *Identity {
+	id, _ := r.Context().Value(identityKey{}).(*Identity)
+	return id
+}
+
+// InGroup check if the identity is member of `group`, case insensitive.
+//
+func (id *Identity) InGroup(group string) bool {
+	if id == nil {
+		return false
+	}
+	for _, g := range id.Groups {
+		if strings.EqualFold(g, group) {
+			return true
+		}
+	}
+	return false
+}
+
+// branchGroups return groups allowed to download symbols of `branch` by `[auth] BRANCH_GROUPS`,
+// nil if the branch is not restricted
+func branchGroups(branch string) []string {
+	for _, rule := range config.AuthBranchGroups {
+		ss := strings.SplitN(strings.TrimSpace(rule), ":", 2)
+		if len(ss) == 2 && strings.EqualFold(ss[0], branch) {
+			return strings.Split(ss[1], "|")
+		}
+	}
+	return nil
+}
+
+// BranchAllowed check if request can download symbols of `branch`. Restricted branches are
+// only served to members of their groups, so clients without group (token, ip...) are refused.
+//
+func BranchAllowed(r *http.Request, branch string) bool {
+	groups := branchGroups(branch)
+	if groups == nil {
+		return true
+	}
+	id := RequestIdentity(r)
+	for _, g := range groups {
+		if id.InGroup(strings.TrimSpace(g)) {
+			return true
+		}
+	}
+	return false
+}
@@ -0,0 +1,27 @@
+package auth
+
+import (
+	"net/http/httptest"
+	"testing"
+
+	"github.com/adyzng/GoSymbols/config"
+)
+
+func TestBranchAllowed(t *testing.T) {
+	defer func(groups []string) { config.AuthBranchGroups = groups }(config.AuthBranchGroups)
+	config.AuthBranchGroups = []string{`UDPMAIN:CORP\UDP-Devs|CORP\Support`}
+
+	r := httptest.NewRequest("GET", "/symbols/foo.pdb/ABC1/foo.pdb", nil)
+	if !BranchAllowed(r, "Other") {
+		t.Errorf("branch without groups is not restricted")
+	}
+	if BranchAllowed(r, "udpmain") {
+		t.Errorf("anonymous client allowed to restricted branch")
+	}
+	if BranchAllowed(WithIdentity(r, &Identity{User: "token"}), "UDPMAIN") {
+		t.Errorf("client without groups allowed to restricted branch")
+	}
+	if !BranchAllowed(WithIdentity(r, &Identity{User: `CORP\alice`, Groups: []string{`corp\support`}}), "UDPMAIN") {
+		t.Errorf("member of group refused")
+	}
+}
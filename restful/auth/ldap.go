@@ -0,0 +1,396 @@
+package auth
+
+import (
+	"bufio"
+	"crypto/sha256"
+	"crypto/tls"
+	"errors"
+	"fmt"
+	"io"
+	"net"
+	"net/url"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/adyzng/GoSymbols/config"
+	log "gopkg.in/clog.v1"
+)
+
+/**
+*
+*  Minimal ldap v3 client, simple bind of the user then search of its groups, enough for
+*  active directory and openldap.
+*
+*  refer: https://tools.ietf.org/html/rfc4511
+*
+**/
+
+const (
+	ldapTimeout  = 10 * time.Second
+	ldapCacheTTL = 5 * time.Minute // debuggers send credentials with every download
+
+	berInteger     = 0x02
+	berOctetString = 0x04
+	berEnumerated  = 0x0a
+	berSequence    = 0x30
+	berSet         = 0x31
+
+	ldapBindRequest   = 0x60
+	ldapBindResponse  = 0x61
+	ldapUnbindRequest = 0x42
+	ldapSearchRequest = 0x63
+	ldapSearchEntry   = 0x64
+	ldapSearchDone    = 0x65
+	ldapSimpleAuth    = 0x80
+	ldapEqualityMatch = 0xa3
+
+	ldapInvalidCredentials = 49
+)
+
+var (
+	ErrLDAPCredentials = errors.New("invalid ldap credentials")
+	ErrLDAPProtocol    = errors.New("unexpected ldap response")
+)
+
+// berPacket is one decoded ber element, primitive ones have `value`
+type berPacket struct {
+	tag      byte
+	value    []byte
+	children []*berPacket
+}
+
+// berEncode build element `tag` of `content`
+func berEncode(tag byte, content ...[]byte) []byte {
+	n := 0
+	for _, c := range content {
+		n += len(c)
+	}
+	buf := []byte{tag}
+	if n < 0x80 {
+		buf = append(buf, byte(n))
+	} else {
+		var size []byte
+		for v := n; v > 0; v >>= 8 {
+			size = append([]byte{byte(v)}, size...)
+		}
+		buf = append(buf, 0x80|byte(len(size)))
+		buf = append(buf, size...)
+	}
+	for _, c := range content {
+		buf = append(buf, c...)
+	}
+	return buf
+}
+
+func berInt(tag byte, n int) []byte {
+	v := []byte{byte(n)}
+	for n >>= 8; n > 0; n >>= 8 {
+		v = append([]byte{byte(n)}, v...)
+	}
+	if v[0]&0x80 != 0 {
+		v = append([]byte{0}, v...)
+	}
+	return berEncode(tag, v)
+}
+
+func berString(tag byte, s string) []byte {
+	return berEncode(tag, []byte(s))
+}
+
+// readBER read one whole element from `r`
+func readBER(r *bufio.Reader) ([]byte, error) {
+	head := make([]byte, 2)
+	if _, err := io.ReadFull(r, head); err != nil {
+		return nil, err
+	}
+	n := int(head[1])
+	if n&0x80 != 0 {
+		size := make([]byte, n&0x7f)
+		if len(size) == 0 || len(size) > 4 {
+			return nil, ErrLDAPProtocol
+		}
+		if _, err := io.ReadFull(r, size); err != nil {
+			return nil, err
+		}
+		head = append(head, size...)
+		n = 0
+		for _, b := range size {
+			n = n<<8 | int(b)
+		}
+	}
+	data := make([]byte, len(head)+n)
+	copy(data, head)
+	_, err := io.ReadFull(r, data[len(head):])
+	return data, err
+}
+
+// parseBER decode the element at the front of `data`, return the rest
+func parseBER(data []byte) (*berPacket, []byte, error) {
+	if len(data) < 2 {
+		return nil, nil, ErrLDAPProtocol
+	}
+	p := &berPacket{tag: data[0]}
+	n, i := int(data[1]), 2
+	if n&0x80 != 0 {
+		size := n & 0x7f
+		if size == 0 || size > 4 || len(data) < 2+size {
+			return nil, nil, ErrLDAPProtocol
+		}
+		n = 0
+		for _, b := range data[2 : 2+size] {
+			n = n<<8 | int(b)
+		}
+		i += size
+	}
+	if len(data) < i+n {
+		return nil, nil, ErrLDAPProtocol
+	}
+	content := data[i : i+n]
+	if p.tag&0x20 == 0 {
+		p.value = content
+		return p, data[i+n:], nil
+	}
+	for len(content) > 0 {
+		child, rest, err := parseBER(content)
+		if err != nil {
+			return nil, nil, err
+		}
+		p.children = append(p.children, child)
+		content = rest
+	}
+	return p, data[i+n:], nil
+}
+
+func (p *berPacket) int() int {
+	n := 0
+	for _, b := range p.value {
+		n = n<<8 | int(b)
+	}
+	return n
+}
+
+// ldapConn is a connection to the directory, requests are sent one at a time
+type ldapConn struct {
+	conn net.Conn
+	r    *bufio.Reader
+	id   int
+}
+
+func dialLDAP(addr string) (*ldapConn, error) {
+	u, err := url.Parse(addr)
+	if err != nil {
+		return nil, err
+	}
+	host := u.Host
+	dialer := &net.Dialer{Timeout: ldapTimeout}
+	var conn net.Conn
+	switch u.Scheme {
+	case "ldaps":
+		if u.Port() == "" {
+			host = net.JoinHostPort(host, "636")
+		}
+		conn, err = tls.DialWithDialer(dialer, "tcp", host, &tls.Config{ServerName: u.Hostname()})
+	case "ldap":
+		if u.Port() == "" {
+			host = net.JoinHostPort(host, "389")
+		}
+		conn, err = dialer.Dial("tcp", host)
+	default:
+		return nil, fmt.Errorf("unsupported ldap url %s", addr)
+	}
+	if err != nil {
+		return nil, err
+	}
+	conn.SetDeadline(time.Now().Add(ldapTimeout))
+	return &ldapConn{conn: conn, r: bufio.NewReader(conn)}, nil
+}
+
+// send request `op` in a new message
+func (c *ldapConn) send(op []byte) error {
+	c.id++
+	_, err := c.conn.Write(berEncode(berSequence, berInt(berInteger, c.id), op))
+	return err
+}
+
+// receive the protocol op of the next message
+func (c *ldapConn) receive() (*berPacket, error) {
+	data, err := readBER(c.r)
+	if err != nil {
+		return nil, err
+	}
+	msg, _, err := parseBER(data)
+	if err != nil {
+		return nil, err
+	}
+	if len(msg.children) < 2 || msg.children[0].int() != c.id {
+		return nil, ErrLDAPProtocol
+	}
+	return msg.children[1], nil
+}
+
+// result check LDAPResult of response `op`
+func ldapResult(op *berPacket) error {
+	if len(op.children) < 3 || op.children[0].tag != berEnumerated {
+		return ErrLDAPProtocol
+	}
+	switch code := op.children[0].int(); code {
+	case 0:
+		return nil
+	case ldapInvalidCredentials:
+		return ErrLDAPCredentials
+	default:
+		return fmt.Errorf("ldap error %d: %s", code, op.children[2].value)
+	}
+}
+
+func (c *ldapConn) bind(name, password string) error {
+	err := c.send(berEncode(ldapBindRequest,
+		berInt(berInteger, 3),
+		berString(berOctetString, name),
+		berString(ldapSimpleAuth, password)))
+	if err != nil {
+		return err
+	}
+	op, err := c.receive()
+	if err != nil {
+		return err
+	}
+	if op.tag != ldapBindResponse {
+		return ErrLDAPProtocol
+	}
+	return ldapResult(op)
+}
+
+// memberOf search the groups of `user` by account name under `base`
+func (c *ldapConn) memberOf(base, user string) ([]string, error) {
+	err := c.send(berEncode(ldapSearchRequest,
+		berString(berOctetString, base),
+		berInt(berEnumerated, 2), // whole subtree
+		berInt(berEnumerated, 0), // never deref aliases
+		berInt(berInteger, 1),
+		berInt(berInteger, int(ldapTimeout/time.Second)),
+		berEncode(0x01, []byte{0}), // types only: false
+		berEncode(ldapEqualityMatch,
+			berString(berOctetString, "sAMAccountName"),
+			berString(berOctetString, user)),
+		berEncode(berSequence, berString(berOctetString, "memberOf"))))
+	if err != nil {
+		return nil, err
+	}
+
+	var groups []string
+	for {
+		op, err := c.receive()
+		if err != nil {
+			return nil, err
+		}
+		switch op.tag {
+		case ldapSearchEntry:
+			if len(op.children) < 2 {
+				return nil, ErrLDAPProtocol
+			}
+			for _, attr := range op.children[1].children {
+				if len(attr.children) < 2 || !strings.EqualFold(string(attr.children[0].value), "memberOf") {
+					continue
+				}
+				for _, v := range attr.children[1].children {
+					groups = append(groups, string(v.value))
+				}
+			}
+		case ldapSearchDone:
+			return groups, ldapResult(op)
+		}
+	}
+}
+
+func (c *ldapConn) close() {
+	c.send(berEncode(ldapUnbindRequest))
+	c.conn.Close()
+}
+
+// groupName return the common name of group `dn`, eg: CN=UDP-Devs,OU=Groups,DC=corp => UDP-Devs
+func groupName(dn string) string {
+	rdn := dn
+	for i := 0; i < len(dn); i++ {
+		if dn[i] == '\\' {
+			i++
+		} else if dn[i] == ',' {
+			rdn = dn[:i]
+			break
+		}
+	}
+	if idx := strings.Index(rdn, "="); idx != -1 {
+		rdn = rdn[idx+1:]
+	}
+	return strings.Replace(rdn, "\\", "", -1)
+}
+
+// withDomain prefix `name` by `[auth] LDAP_DOMAIN`, as negotiate gives them
+func withDomain(name string) string {
+	if config.LDAPDomain == "" {
+		return name
+	}
+	return config.LDAPDomain + "\\" + name
+}
+
+type ldapCached struct {
+	sum    [32]byte
+	id     *Identity
+	expire time.Time
+}
+
+var (
+	ldapMx    sync.Mutex
+	ldapCache = make(map[string]*ldapCached)
+)
+
+// ldapIdentity authenticate `user` by binding to `[auth] LDAP_URL`, and read its groups if
+// `[auth] LDAP_BASE_DN` is set. Successful logins are cached for a few minutes.
+func ldapIdentity(user, password string) (*Identity, error) {
+	// DOMAIN\user or user@domain are given by windows clients
+	if idx := strings.LastIndex(user, "\\"); idx != -1 {
+		user = user[idx+1:]
+	}
+	if idx := strings.Index(user, "@"); idx != -1 {
+		user = user[:idx]
+	}
+	if user == "" || password == "" {
+		// empty password is an anonymous bind which always succeed
+		return nil, ErrLDAPCredentials
+	}
+
+	key := strings.ToLower(user)
+	sum := sha256.Sum256([]byte(key + ":" + password))
+	ldapMx.Lock()
+	if c, ok := ldapCache[key]; ok && c.sum == sum && time.Now().Before(c.expire) {
+		ldapMx.Unlock()
+		return c.id, nil
+	}
+	ldapMx.Unlock()
+
+	conn, err := dialLDAP(config.LDAPURL)
+	if err != nil {
+		return nil, err
+	}
+	defer conn.close()
+	if err = conn.bind(strings.Replace(config.LDAPBind, "{user}", user, -1), password); err != nil {
+		return nil, err
+	}
+	id := &Identity{User: withDomain(user), Method: "basic"}
+	if config.LDAPBaseDN != "" {
+		dns, err := conn.memberOf(config.LDAPBaseDN, user)
+		if err != nil {
+			return nil, err
+		}
+		for _, dn := range dns {
+			id.Groups = append(id.Groups, withDomain(groupName(dn)))
+		}
+	}
+	log.Trace("[Auth] Ldap user %s in %d groups.", id.User, len(id.Groups))
+
+	ldapMx.Lock()
+	ldapCache[key] = &ldapCached{sum: sum, id: id, expire: time.Now().Add(ldapCacheTTL)}
+	ldapMx.Unlock()
+	return id, nil
+}
@@ -0,0 +1,94 @@
+package auth
+
+import (
+	"bufio"
+	"net"
+	"testing"
+
+	"github.com/adyzng/GoSymbols/config"
+)
+
+// fakeDirectory serve bind and memberOf search of one user on `ln`
+func fakeDirectory(t *testing.T, ln net.Listener, bindName, password string, groups ...string) {
+	for {
+		conn, err := ln.Accept()
+		if err != nil {
+			return
+		}
+		go func(conn net.Conn) {
+			defer conn.Close()
+			r := bufio.NewReader(conn)
+			for {
+				data, err := readBER(r)
+				if err != nil {
+					return
+				}
+				msg, _, err := parseBER(data)
+				if err != nil {
+					t.Errorf("invalid ldap request: %v", err)
+					return
+				}
+				id, op := berInt(berInteger, msg.children[0].int()), msg.children[1]
+				result := func(tag byte, code int) []byte {
+					return berEncode(berSequence, id, berEncode(tag, berInt(berEnumerated, code),
+						berString(berOctetString, ""), berString(berOctetString, "")))
+				}
+				switch op.tag {
+				case ldapBindRequest:
+					code := 0
+					if string(op.children[1].value) != bindName || string(op.children[2].value) != password {
+						code = ldapInvalidCredentials
+					}
+					conn.Write(result(ldapBindResponse, code))
+				case ldapSearchRequest:
+					vals := make([][]byte, 0, len(groups))
+					for _, g := range groups {
+						vals = append(vals, berString(berOctetString, g))
+					}
+					conn.Write(berEncode(berSequence, id, berEncode(ldapSearchEntry,
+						berString(berOctetString, "CN=Alice,DC=corp"),
+						berEncode(berSequence, berEncode(berSequence,
+							berString(berOctetString, "memberOf"), berEncode(berSet, vals...))))))
+					conn.Write(result(ldapSearchDone, 0))
+				case ldapUnbindRequest:
+					return
+				}
+			}
+		}(conn)
+	}
+}
+
+func TestLDAPIdentity(t *testing.T) {
+	ln, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer ln.Close()
+	go fakeDirectory(t, ln, "alice@corp.example.com", "pa55", `CN=UDP-Devs,OU=Groups,DC=corp`, `CN=Dev\, Tools,DC=corp`)
+
+	defer func(url, bind, base, domain string) {
+		config.LDAPURL, config.LDAPBind, config.LDAPBaseDN, config.LDAPDomain = url, bind, base, domain
+	}(config.LDAPURL, config.LDAPBind, config.LDAPBaseDN, config.LDAPDomain)
+	config.LDAPURL = "ldap://" + ln.Addr().String()
+	config.LDAPBind, config.LDAPBaseDN, config.LDAPDomain = "{user}@corp.example.com", "DC=corp", "CORP"
+
+	if _, err = ldapIdentity("alice", "wrong"); err != ErrLDAPCredentials {
+		t.Errorf("expect invalid credentials, got %v", err)
+	}
+	if _, err = ldapIdentity("alice", ""); err != ErrLDAPCredentials {
+		t.Errorf("expect anonymous bind refused, got %v", err)
+	}
+	id, err := ldapIdentity(`CORP\alice`, "pa55")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if id.User != `CORP\alice` || len(id.Groups) != 2 || !id.InGroup(`CORP\UDP-Devs`) || !id.InGroup(`CORP\Dev, Tools`) {
+		t.Errorf("unexpected identity %+v", id)
+	}
+
+	// cached, the directory is not asked again
+	ln.Close()
+	if cached, err := ldapIdentity("alice", "pa55"); err != nil || cached != id {
+		t.Errorf("expect cached identity, got %+v (%v)", cached, err)
+	}
+}
@@ -0,0 +1,147 @@
+package auth
+
+import (
+	"crypto/subtle"
+	"net/http"
+	"strings"
+
+	"github.com/adyzng/GoSymbols/config"
+	"github.com/adyzng/GoSymbols/restful/session"
+	"github.com/adyzng/GoSymbols/standby"
+	"golang.org/x/crypto/bcrypt"
+	log "gopkg.in/clog.v1"
+)
+
+// Roles of `[auth] ROLES`, each include the permissions of the ones before
+const (
+	RoleViewer   = "viewer"   // browse branches and download symbols
+	RoleUploader = "uploader" // ingest builds and supplements
+	RoleAdmin    = "admin"    // create, modify and delete branches, purge builds
+)
+
+var roleRank = map[string]int{
+	RoleViewer:   1,
+	RoleUploader: 2,
+	RoleAdmin:    3,
+}
+
+// RolesEnabled check if api are restricted by `[auth] ROLES`.
+//
+func RolesEnabled() bool {
+	return len(config.AuthRoles) > 0
+}
+
+// RoleOf return the highest role granted to `id` by `[auth] ROLES`, empty if none. Rules
+// match the user or one of its groups, `*` any identity but anonymous, and clients without
+// user are matched by their auth method, eg: `token:uploader` for build agents.
+//
+func RoleOf(id *Identity) string {
+	if id == nil {
+		return ""
+	}
+	role := ""
+	for _, rule := range config.AuthRoles {
+		idx := strings.LastIndex(rule, ":")
+		if idx == -1 {
+			continue
+		}
+		subject := strings.TrimSpace(rule[:idx])
+		r := strings.ToLower(strings.TrimSpace(rule[idx+1:]))
+		matched := false
+		switch {
+		case subject == "*":
+			matched = id.Method != "anonymous"
+		case id.User != "":
+			matched = strings.EqualFold(subject, id.User) || id.InGroup(subject)
+		default:
+			matched = strings.EqualFold(subject, id.Method)
+		}
+		if matched && roleRank[r] > roleRank[role] {
+			role = r
+		}
+	}
+	return role
+}
+
+// Grants check if `role` include the permissions of `required`.
+//
+func Grants(role, required string) bool {
+	return roleRank[required] > 0 && roleRank[role] >= roleRank[required]
+}
+
+// SessionIdentity return the user logined by oauth, nil if no session.
+//
+func SessionIdentity(r *http.Request) *Identity {
+	c, _ := r.Cookie(session.CookieSessID)
+	if c == nil {
+		return nil
+	}
+	if token, ok := session.GetManager().Get(c.Value).(*GraphToken); ok {
+		return &Identity{User: token.UserName, Method: "session"}
+	}
+	return nil
+}
+
+// BasicIdentity check basic auth credentials of request against the bcrypt hashes of
+// `[auth] USERS`, then the directory of `[auth] LDAP_URL`. Nil if credentials are missing
+// or wrong.
+//
+func BasicIdentity(r *http.Request) *Identity {
+	user, pass, ok := r.BasicAuth()
+	if !ok {
+		return nil
+	}
+	valid := false
+	for _, u := range config.AuthUsers {
+		idx := strings.Index(u, ":")
+		if idx == -1 || !strings.EqualFold(strings.TrimSpace(u[:idx]), user) {
+			continue
+		}
+		valid = bcrypt.CompareHashAndPassword([]byte(strings.TrimSpace(u[idx+1:])), []byte(pass)) == nil
+		break
+	}
+	if valid {
+		return &Identity{User: user, Method: "basic"}
+	}
+	if config.LDAPURL == "" {
+		return nil
+	}
+	id, err := ldapIdentity(user, pass)
+	if err != nil {
+		log.Warn("[Auth] Ldap login of %s failed: %v.", user, err)
+		return nil
+	}
+	return id
+}
+
+// StandbyIdentity return the other instance of the standby pair, by `[standby] TOKEN` in
+// its requests, matched by `standby` rules of `[auth] ROLES`. Nil if the token is wrong.
+//
+func StandbyIdentity(r *http.Request) *Identity {
+	token := r.Header.Get(standby.HeaderToken)
+	if config.StandbyToken == "" || subtle.ConstantTimeCompare([]byte(token), []byte(config.StandbyToken)) != 1 {
+		return nil
+	}
+	return &Identity{Method: "standby"}
+}
+
+// Authenticate return identity of request given by its zone, or by the oauth session,
+// basic auth credentials or standby token if the zone has no policy or granted it without
+// user.
+//
+func Authenticate(r *http.Request) *Identity {
+	id := RequestIdentity(r)
+	if id != nil && id.User != "" {
+		return id
+	}
+	if user := SessionIdentity(r); user != nil {
+		return user
+	}
+	if user := BasicIdentity(r); user != nil {
+		return user
+	}
+	if peer := StandbyIdentity(r); peer != nil {
+		return peer
+	}
+	return id
+}
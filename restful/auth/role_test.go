@@ -0,0 +1,79 @@
+package auth
+
+import (
+	"net/http/httptest"
+	"testing"
+
+	"github.com/adyzng/GoSymbols/config"
+	"github.com/adyzng/GoSymbols/standby"
+)
+
+func TestRoleOf(t *testing.T) {
+	defer func(roles []string) { config.AuthRoles = roles }(config.AuthRoles)
+	config.AuthRoles = []string{`CORP\Symbol-Admins:admin`, `CORP\UDP-Build:uploader`, "alice:Uploader", "token:uploader", "*:viewer"}
+
+	cases := []struct {
+		id   *Identity
+		role string
+	}{
+		{nil, ""},
+		{&Identity{Method: "anonymous"}, ""},
+		{&Identity{Method: "ip"}, RoleViewer},
+		{&Identity{Method: "token"}, RoleUploader},
+		{&Identity{User: "ALICE", Method: "basic"}, RoleUploader},
+		{&Identity{User: `CORP\bob`, Groups: []string{`corp\udp-build`, `CORP\Symbol-Admins`}, Method: "negotiate"}, RoleAdmin},
+	}
+	for _, c := range cases {
+		if role := RoleOf(c.id); role != c.role {
+			t.Errorf("expect %+v granted %q, got %q", c.id, c.role, role)
+		}
+	}
+	if role := RoleOf(&Identity{Method: "standby"}); role != RoleViewer {
+		t.Errorf("expect standby peer granted viewer by *, got %q", role)
+	}
+	if !Grants(RoleAdmin, RoleUploader) || Grants(RoleViewer, RoleUploader) || Grants("", RoleViewer) || Grants(RoleAdmin, "") {
+		t.Errorf("unexpected role ranks")
+	}
+}
+
+func TestStandbyIdentity(t *testing.T) {
+	defer func(token string) { config.StandbyToken = token }(config.StandbyToken)
+	r := httptest.NewRequest("POST", "/api/standby/fence", nil)
+	r.Header.Set(standby.HeaderToken, "s3cret")
+	if StandbyIdentity(r) != nil {
+		t.Fatal("expect no peer without [standby] TOKEN")
+	}
+	config.StandbyToken = "s3cret"
+	if id := Authenticate(r); id == nil || id.Method != "standby" {
+		t.Fatalf("expect standby peer, got %+v", id)
+	}
+	r.Header.Set(standby.HeaderToken, "wrong")
+	if StandbyIdentity(r) != nil {
+		t.Error("expect wrong token refused")
+	}
+}
+
+func TestBasicIdentity(t *testing.T) {
+	defer func(users []string) { config.AuthUsers = users }(config.AuthUsers)
+	config.AuthUsers = []string{
+		// bcrypt of "password", and the unsalted sha256 no longer accepted
+		"windbg:$2a$04$BDzli4SpgwcFGU8GLyQNpesvynjQBfy/Z6A28Ka.WzWF7wbzK/OaW",
+		"legacy:5e884898da28047151d0e56f8dc6292773603d0d6aabbdd62a11ef721d1542d8",
+	}
+	for _, c := range []struct {
+		user, pass string
+		ok         bool
+	}{
+		{"windbg", "password", true},
+		{"WinDbg", "password", true},
+		{"windbg", "wrong", false},
+		{"legacy", "password", false},
+		{"nobody", "password", false},
+	} {
+		r := httptest.NewRequest("GET", "/api/branches", nil)
+		r.SetBasicAuth(c.user, c.pass)
+		if id := BasicIdentity(r); (id != nil) != c.ok {
+			t.Errorf("expect %s:%s accepted %v, got %+v", c.user, c.pass, c.ok, id)
+		}
+	}
+}
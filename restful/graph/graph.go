@@ -0,0 +1,290 @@
+package graph
+
+import (
+	"context"
+	"errors"
+	"sort"
+	"sync/atomic"
+
+	"github.com/adyzng/GoSymbols/query"
+	"github.com/adyzng/GoSymbols/symbol"
+	graphql "github.com/graph-gophers/graphql-go"
+)
+
+const (
+	MaxDepth    = 6     // max nested selection depth
+	MaxNodes    = 20000 // max objects resolved by one query
+	MaxList     = 500   // max items of one list field
+	MaxQueryLen = 8192  // max query text in bytes
+)
+
+var (
+	ErrTooComplex = errors.New("query too complex, select less items or fields")
+)
+
+const schemaText = `
+schema {
+	query: Query
+}
+
+type Query {
+	# local branches on symbol store
+	branches: [Branch!]!
+	branch(name: String!): Branch
+}
+
+type Branch {
+	name: String!
+	buildName: String!
+	updateDate: String!
+	latestBuild: String!
+	buildsCount: Int!
+	# latest builds first, filter is the same expression as REST api, eg: "version>=4175"
+	builds(last: Int = 10, filter: String): [Build!]!
+	build(id: String!): Build
+}
+
+type Build {
+	id: String!
+	# unique across branches, {store}@{id}
+	key: String!
+	store: String!
+	date: String!
+	version: String!
+	comment: String!
+	release: Boolean!
+	# pending, ingesting, verifying, complete, failed, deleted or archived
+	status: String!
+	supplementOf: String
+	supplements: [String!]!
+	symbolsCount: Int!
+	symbols(first: Int = 100, filter: String): [Symbol!]!
+}
+
+type Symbol {
+	name: String!
+	hash: String!
+	arch: String!
+	path: String!
+	version: String!
+	transaction: String!
+	url: String!
+	# published file name if renamed by branch rules at ingest
+	original: String
+}
+`
+
+// Schema is the parsed GraphQL schema over symbol store
+var Schema = graphql.MustParseSchema(schemaText, &Resolver{},
+	graphql.MaxDepth(MaxDepth),
+	graphql.MaxParallelism(4),
+)
+
+type budgetKey struct{}
+
+// WithBudget return context limit the objects resolved by one query to MaxNodes
+func WithBudget(ctx context.Context) context.Context {
+	n := int64(MaxNodes)
+	return context.WithValue(ctx, budgetKey{}, &n)
+}
+
+// spend `n` objects from query budget
+func spend(ctx context.Context, n int) error {
+	left, ok := ctx.Value(budgetKey{}).(*int64)
+	if ok && atomic.AddInt64(left, -int64(n)) < 0 {
+		return ErrTooComplex
+	}
+	return nil
+}
+
+// symbolsCost return the budget charged before symbols of build are parsed
+func symbolsCost(bu symbol.Builder, id string) int {
+	if b, ok := bu.(*symbol.BrBuilder); ok {
+		return b.SymbolsCost(id)
+	}
+	return 1
+}
+
+// limit clamp list argument to [0, MaxList]
+func limit(n int32) int {
+	if n < 0 {
+		return 0
+	}
+	if n > MaxList {
+		return MaxList
+	}
+	return int(n)
+}
+
+// Resolver is the root query resolver
+//
+type Resolver struct{}
+
+// Branches resolve all local branches
+func (r *Resolver) Branches(ctx context.Context) ([]*BranchResolver, error) {
+	var arr []*BranchResolver
+	symbol.GetServer().WalkBuilders(func(bu symbol.Builder) error {
+		if bu.CanBrowse() {
+			arr = append(arr, &BranchResolver{b: bu})
+		}
+		return nil
+	})
+	sort.Slice(arr, func(i, j int) bool {
+		return arr[i].b.Name() < arr[j].b.Name()
+	})
+	return arr, spend(ctx, len(arr))
+}
+
+// Branch resolve branch by store name
+func (r *Resolver) Branch(ctx context.Context, args struct{ Name string }) (*BranchResolver, error) {
+	bu := symbol.GetServer().Get(args.Name)
+	if bu == nil {
+		return nil, nil
+	}
+	return &BranchResolver{b: bu}, spend(ctx, 1)
+}
+
+// BranchResolver resolve branch fields
+//
+type BranchResolver struct {
+	b symbol.Builder
+}
+
+func (r *BranchResolver) Name() string        { return r.b.GetBranch().StoreName }
+func (r *BranchResolver) BuildName() string   { return r.b.GetBranch().BuildName }
+func (r *BranchResolver) UpdateDate() string  { return r.b.GetBranch().UpdateDate }
+func (r *BranchResolver) LatestBuild() string { return r.b.GetBranch().LatestBuild }
+func (r *BranchResolver) BuildsCount() int32  { return int32(r.b.GetBranch().BuildsCount) }
+
+// Builds resolve the latest `last` builds matching filter
+func (r *BranchResolver) Builds(ctx context.Context, args struct {
+	Last   int32
+	Filter *string
+}) ([]*BuildResolver, error) {
+	var filter query.Expr
+	if args.Filter != nil {
+		var err error
+		if filter, err = query.Parse(*args.Filter, symbol.BuildFields); err != nil {
+			return nil, err
+		}
+	}
+
+	builds, err := r.b.QueryBuilds(ctx, filter)
+	if err != nil {
+		return nil, err
+	}
+	r.b.GetBranch().SortBuilds(builds)
+	for i, j := 0, len(builds)-1; i < j; i, j = i+1, j-1 {
+		builds[i], builds[j] = builds[j], builds[i]
+	}
+	if n := limit(args.Last); len(builds) > n {
+		builds = builds[:n]
+	}
+
+	arr := make([]*BuildResolver, 0, len(builds))
+	for _, build := range builds {
+		arr = append(arr, &BuildResolver{b: r.b, build: build})
+	}
+	return arr, spend(ctx, len(arr))
+}
+
+// Build resolve build by transaction ID
+func (r *BranchResolver) Build(ctx context.Context, args struct{ ID string }) (*BuildResolver, error) {
+	var found *symbol.Build
+	_, err := r.b.ParseBuilds(ctx, func(build *symbol.Build) error {
+		if build.ID == args.ID {
+			found = build
+		}
+		return nil
+	})
+	if err != nil || found == nil {
+		return nil, err
+	}
+	return &BuildResolver{b: r.b, build: found}, spend(ctx, 1)
+}
+
+// BuildResolver resolve build fields
+//
+type BuildResolver struct {
+	b     symbol.Builder
+	build *symbol.Build
+}
+
+func (r *BuildResolver) ID() string            { return r.build.ID }
+func (r *BuildResolver) Key() string           { return r.build.Key }
+func (r *BuildResolver) Store() string         { return r.build.Store }
+func (r *BuildResolver) Date() string          { return r.build.Date }
+func (r *BuildResolver) Version() string       { return r.build.Version }
+func (r *BuildResolver) Comment() string       { return r.build.Comment }
+func (r *BuildResolver) Release() bool         { return r.build.Release }
+func (r *BuildResolver) Status() string        { return string(r.build.Status) }
+func (r *BuildResolver) Supplements() []string { return append([]string{}, r.build.Supplements...) }
+
+// SupplementOf resolve parent build ID, null if not an supplement
+func (r *BuildResolver) SupplementOf() *string {
+	if r.build.SupplementOf == "" {
+		return nil
+	}
+	return &r.build.SupplementOf
+}
+
+// SymbolsCount count the symbols without resolve them, charged by the transaction size
+func (r *BuildResolver) SymbolsCount(ctx context.Context) (int32, error) {
+	if err := spend(ctx, symbolsCost(r.b, r.build.ID)); err != nil {
+		return 0, err
+	}
+	n, err := r.b.ParseSymbols(r.build.ID, nil)
+	return int32(n), err
+}
+
+// Symbols resolve the first `first` symbols matching filter
+func (r *BuildResolver) Symbols(ctx context.Context, args struct {
+	First  int32
+	Filter *string
+}) ([]*SymbolResolver, error) {
+	var filter query.Expr
+	if args.Filter != nil {
+		var err error
+		if filter, err = query.Parse(*args.Filter, symbol.SymbolFields); err != nil {
+			return nil, err
+		}
+	}
+
+	if err := spend(ctx, symbolsCost(r.b, r.build.ID)); err != nil {
+		return nil, err
+	}
+	syms, err := r.b.QuerySymbols(ctx, r.build.ID, filter)
+	if err != nil {
+		return nil, err
+	}
+	if n := limit(args.First); len(syms) > n {
+		syms = syms[:n]
+	}
+	arr := make([]*SymbolResolver, 0, len(syms))
+	for _, sym := range syms {
+		arr = append(arr, &SymbolResolver{sym})
+	}
+	return arr, spend(ctx, len(arr))
+}
+
+// SymbolResolver resolve symbol fields
+//
+type SymbolResolver struct {
+	sym *symbol.Symbol
+}
+
+func (r *SymbolResolver) Name() string        { return r.sym.Name }
+func (r *SymbolResolver) Hash() string        { return r.sym.Hash }
+func (r *SymbolResolver) Arch() string        { return r.sym.Arch }
+func (r *SymbolResolver) Path() string        { return r.sym.Path }
+func (r *SymbolResolver) Version() string     { return r.sym.Version }
+func (r *SymbolResolver) Transaction() string { return r.sym.Transaction }
+func (r *SymbolResolver) URL() string         { return r.sym.URL }
+
+// Original resolve published file name, null if not renamed
+func (r *SymbolResolver) Original() *string {
+	if r.sym.Original == "" {
+		return nil
+	}
+	return &r.sym.Original
+}
@@ -0,0 +1,83 @@
+package graph
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/adyzng/GoSymbols/config"
+	"github.com/adyzng/GoSymbols/symbol"
+)
+
+func TestQuery(t *testing.T) {
+	root, err := ioutil.TempDir("", "graph")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(root)
+	config.Destination = root
+
+	admin := filepath.Join(root, "000Admin")
+	os.MkdirAll(admin, 0755)
+	server := ""
+	for i := 1; i <= 12; i++ {
+		id := fmt.Sprintf("%010d", i)
+		server += fmt.Sprintf("%s,add,file,07/04/2017,14:44:14,\"GraphTest\",\"4175.%d\",\"\",\r\n", id, i)
+		ioutil.WriteFile(filepath.Join(admin, id), []byte(fmt.Sprintf(
+			"\"foo.pdb\\AAAA%d\",\"S:\\000Unzip\\x64\\foo.pdb\"\r\n\"bar.pdb\\BBBB%d\",\"S:\\000Unzip\\x86\\bar.pdb\"\r\n", i, i)), 0644)
+	}
+	ioutil.WriteFile(filepath.Join(admin, "server.txt"), []byte(server), 0644)
+	if symbol.GetServer().Add(&symbol.Branch{StoreName: "GraphTest", StorePath: root, BuildPath: root}) == nil {
+		t.Fatal("add branch failed")
+	}
+	defer symbol.GetServer().Delete("GraphTest")
+
+	resp := Schema.Exec(WithBudget(context.Background()), `{
+		branch(name: "graphtest") {
+			name
+			builds(filter: "version>=4175.3") { id version symbolsCount symbols(filter: "arch=x64") { name url } }
+		}
+	}`, "", nil)
+	if len(resp.Errors) > 0 {
+		t.Fatal(resp.Errors)
+	}
+	var data struct {
+		Branch struct {
+			Name   string
+			Builds []struct {
+				ID           string
+				SymbolsCount int
+				Symbols      []struct{ Name, URL string }
+			}
+		}
+	}
+	if err := json.Unmarshal(resp.Data, &data); err != nil {
+		t.Fatal(err)
+	}
+	builds := data.Branch.Builds
+	if data.Branch.Name != "GraphTest" || len(builds) != 10 || builds[0].ID != "0000000012" ||
+		builds[0].SymbolsCount != 2 || len(builds[0].Symbols) != 1 || builds[0].Symbols[0].Name != "foo.pdb" {
+		t.Fatalf("unexpected result %s", resp.Data)
+	}
+
+	// budget exhausted
+	ctx := WithBudget(context.Background())
+	spend(ctx, MaxNodes)
+	resp = Schema.Exec(ctx, `{ branch(name: "GraphTest") { name } }`, "", nil)
+	if len(resp.Errors) == 0 || !strings.Contains(resp.Errors[0].Message, "too complex") {
+		t.Fatalf("expect too complex, got %v", resp.Errors)
+	}
+
+	// symbols are charged by transaction size before parsed, not as one node
+	ctx = WithBudget(context.Background())
+	spend(ctx, MaxNodes-3)
+	resp = Schema.Exec(ctx, `{ branch(name: "GraphTest") { builds(last: 1) { symbolsCount } } }`, "", nil)
+	if len(resp.Errors) == 0 || !strings.Contains(resp.Errors[0].Message, "too complex") {
+		t.Fatalf("expect too complex, got %v", resp.Errors)
+	}
+}
@@ -5,6 +5,7 @@ import (
 	"encoding/json"
 	"net/http"
 
+	"github.com/adyzng/GoSymbols/cihook"
 	"github.com/adyzng/GoSymbols/symbol"
 
 	log "gopkg.in/clog.v1"
@@ -43,13 +44,34 @@ type ErrCodeMsg struct {
 // BranchList return branch list of current symbol store
 //
 type BranchList struct {
-	Total   int              `json:"total"`
-	Branchs []*symbol.Branch `json:"branchs"`
+	Total   int           `json:"total"`
+	Branchs []*BranchItem `json:"branchs"`
 }
 type BuildList struct {
-	Branch string          `json:"branchName"`
-	Total  int             `json:"total"`
-	Builds []*symbol.Build `json:"builds"`
+	Branch string       `json:"branchName"`
+	Total  int          `json:"total"`
+	Builds []*BuildItem `json:"builds"`
+	AsOf   string       `json:"asOf,omitempty"` // last transaction applied when listing as of the past
+}
+type BuildDetail struct {
+	Build   *symbol.Build    `json:"build"`
+	Branch  *symbol.Branch   `json:"branch,omitempty"` // embed=branch
+	Total   int              `json:"total"`
+	Symbols []*symbol.Symbol `json:"symbols"`
+}
+
+// BranchItem is one branch of branch list, with objects asked by `embed=`
+//
+type BranchItem struct {
+	*symbol.Branch
+	Latest *symbol.Build `json:"latest,omitempty"` // embed=latest, the latest build
+}
+
+// BuildItem is one build of build list, with objects asked by `embed=`
+//
+type BuildItem struct {
+	*symbol.Build
+	Symbols []*symbol.Symbol `json:"symbols,omitempty"` // embed=symbols
 }
 type SymbolList struct {
 	Branch  string           `json:"branchName"`
@@ -64,6 +86,69 @@ type Message struct {
 	Date   string `json:"date,omitempty"`
 }
 
+// BuildTrigger is the request body of trigger build api
+//
+type BuildTrigger struct {
+	Version  string          `json:"version"`
+	Priority symbol.Priority `json:"priority"`
+}
+
+// BuildSupplement is the request body of supplement build api
+//
+type BuildSupplement struct {
+	Version string   `json:"version"`
+	Files   []string `json:"files"` // pdb names or glob patterns
+}
+
+// SymbolKey identify an symbol file in store
+//
+type SymbolKey struct {
+	Name string `json:"name"`
+	Hash string `json:"hash"`
+}
+
+// SymbolExists is one result of batch existence check
+//
+type SymbolExists struct {
+	SymbolKey
+	Exists bool   `json:"exists"`
+	Branch string `json:"branch,omitempty"`
+	Size   int64  `json:"size,omitempty"`
+	ETag   string `json:"etag,omitempty"`
+	URL    string `json:"url,omitempty"`
+}
+
+// BuildSigning is the signature status of binaries in a build
+//
+type BuildSigning struct {
+	Build    string               `json:"build"`
+	Blockers int                  `json:"blockers"` // unsigned or invalid binaries
+	Binaries []*symbol.BinarySign `json:"binaries"`
+}
+
+// PermalinkInfo is the permalink with its short url and current target url
+//
+type PermalinkInfo struct {
+	*symbol.Permalink
+	URL    string `json:"url"`
+	Target string `json:"target,omitempty"`
+}
+
+// HookResult is the response of CI webhook, the job is nil if the build was not queued
+//
+type HookResult struct {
+	*cihook.Build
+	Branch string      `json:"branch,omitempty"`
+	Job    *symbol.Job `json:"job,omitempty"`
+}
+
+// UploadResult is the response of symbol upload, the job is nil until the upload is complete
+//
+type UploadResult struct {
+	*symbol.Upload
+	Job *symbol.Job `json:"job,omitempty"`
+}
+
 // RestResponse is the basic struct used to wrap data back to client in json format.
 //
 type RestResponse struct {
@@ -86,8 +171,15 @@ func (r *RestResponse) ToJSON() string {
 // WriteJSON write json reponse to client
 //
 func (r *RestResponse) WriteJSON(w http.ResponseWriter) error {
+	return r.WriteStatus(w, http.StatusOK)
+}
+
+// WriteStatus write json reponse to client with http status `code`, for tooling which
+// check the status instead of the error code.
+//
+func (r *RestResponse) WriteStatus(w http.ResponseWriter, code int) error {
 	w.Header().Set("Content-Type", "application/json; charset=UTF-8")
-	w.WriteHeader(http.StatusOK)
+	w.WriteHeader(code)
 
 	if err := json.NewEncoder(w).Encode(r); err != nil {
 		log.Error(2, "[Restful] JSON.Encode(%+v) failed with %v.", r, err)
@@ -16,9 +16,21 @@ type MemoryStore struct {
 }
 type sessData struct {
 	expireAt int64
+	lastSeen int64
+	remember bool
+	csrf     string
 	data     interface{}
 }
 
+// expired check absolute lifetime, and idle timeout of session not remembered
+func (d *sessData) expired(now int64) bool {
+	if d.expireAt < now {
+		return true
+	}
+	idle := int64(IdleTimeout() / time.Second)
+	return !d.remember && idle > 0 && d.lastSeen+idle < now
+}
+
 // NewMemStore ...
 //
 func NewMemStore() SessStore {
@@ -27,11 +39,17 @@ func NewMemStore() SessStore {
 	}
 }
 
-// Get session
+// Get session, and keep it alive
 func (m *MemoryStore) Get(id string) interface{} {
-	m.mx.RLock()
-	defer m.mx.RUnlock()
+	m.mx.Lock()
+	defer m.mx.Unlock()
 	if d, ok := m.sess[id]; ok {
+		now := time.Now().Unix()
+		if d.expired(now) {
+			delete(m.sess, id)
+			return nil
+		}
+		d.lastSeen = now
 		return d.data
 	}
 	return nil
@@ -42,7 +60,7 @@ func (m *MemoryStore) Set(id string, data interface{}) error {
 	m.mx.Lock()
 	defer m.mx.Unlock()
 	if sd, ok := m.sess[id]; ok {
-		sd.expireAt = time.Now().Add(SessTimeout).Unix()
+		sd.lastSeen = time.Now().Unix()
 		sd.data = data
 		return nil
 	}
@@ -61,17 +79,30 @@ func (m *MemoryStore) Delete(id string) interface{} {
 }
 
 // Create new session
-func (m *MemoryStore) Create(data interface{}) string {
-	id := uuid.NewUUID()
+func (m *MemoryStore) Create(data interface{}, remember bool) string {
+	id, now := uuid.NewUUID(), time.Now()
 	m.mx.Lock()
 	defer m.mx.Unlock()
 	m.sess[id] = &sessData{
 		data:     data,
-		expireAt: time.Now().Add(SessTimeout).Unix(),
+		remember: remember,
+		csrf:     uuid.NewUUID(),
+		lastSeen: now.Unix(),
+		expireAt: now.Add(Lifetime(remember)).Unix(),
 	}
 	return id
 }
 
+// CSRFToken of session
+func (m *MemoryStore) CSRFToken(id string) string {
+	m.mx.RLock()
+	defer m.mx.RUnlock()
+	if d, ok := m.sess[id]; ok {
+		return d.csrf
+	}
+	return ""
+}
+
 // Udpate all sessions, if timeout, delete it
 // update `max` items at most each time.
 func (m *MemoryStore) Udpate(max int) int {
@@ -82,7 +113,7 @@ func (m *MemoryStore) Udpate(max int) int {
 	nowUnix := time.Now().Unix()
 
 	for key, val := range m.sess {
-		if val.expireAt < nowUnix {
+		if val.expired(nowUnix) {
 			delete(m.sess, key)
 		}
 		if total--; total == 0 {
@@ -0,0 +1,38 @@
+package session
+
+import (
+	"testing"
+	"time"
+
+	"github.com/adyzng/GoSymbols/config"
+)
+
+func TestIdleTimeout(t *testing.T) {
+	defer func(idle int) { config.SessionIdleTimeout = idle }(config.SessionIdleTimeout)
+	config.SessionIdleTimeout = 30
+
+	m := NewMemStore().(*MemoryStore)
+	short, long := m.Create("short", false), m.Create("long", true)
+	if m.CSRFToken(short) == "" || m.CSRFToken(short) == m.CSRFToken(long) {
+		t.Fatalf("expect distinct csrf token per session")
+	}
+
+	// idle for an hour
+	for _, d := range m.sess {
+		d.lastSeen -= 3600
+	}
+	if m.Get(short) != nil {
+		t.Errorf("expect idle session expired")
+	}
+	if m.Get(long) != "long" {
+		t.Errorf("expect remembered session alive when idle")
+	}
+	if m.CSRFToken(short) != "" {
+		t.Errorf("expect expired session removed")
+	}
+
+	m.sess[long].expireAt = time.Now().Add(-time.Second).Unix()
+	if m.Udpate(10); m.Get(long) != nil {
+		t.Errorf("expect remembered session expired after its lifetime")
+	}
+}
@@ -4,6 +4,7 @@ import (
 	"sync"
 	"time"
 
+	"github.com/adyzng/GoSymbols/config"
 	log "gopkg.in/clog.v1"
 )
 
@@ -14,6 +15,8 @@ const (
 	SessTimeout  = time.Hour * 24
 	CookieSessID = "session_id"
 	CookieMaxAge = time.Hour * 24 / time.Second
+	CookieCSRF   = "XSRF-TOKEN"   // readable by the web ui, echoed back in HeaderCSRF
+	HeaderCSRF   = "X-XSRF-TOKEN" // required on mutating requests of logined user
 )
 const (
 	_          StorType = iota
@@ -38,8 +41,26 @@ type SessStore interface {
 
 	// Delete session
 	Delete(id string) interface{}
-	// Create an new session
-	Create(data interface{}) string
+	// Create an new session, `remember` session live for `[session] REMEMBER_DAYS`
+	// and never expire when idle
+	Create(data interface{}, remember bool) string
+	// CSRFToken of the session, empty if session not exist
+	CSRFToken(id string) string
+}
+
+// Lifetime return absolute lifetime of new session.
+//
+func Lifetime(remember bool) time.Duration {
+	if remember && config.SessionRememberDays > 0 {
+		return time.Duration(config.SessionRememberDays) * time.Hour * 24
+	}
+	return SessTimeout
+}
+
+// IdleTimeout return how long a session not remembered live without request.
+//
+func IdleTimeout() time.Duration {
+	return time.Duration(config.SessionIdleTimeout) * time.Minute
 }
 
 // SessManager manage all sessions
@@ -0,0 +1,170 @@
+package restful
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"strings"
+
+	log "gopkg.in/clog.v1"
+)
+
+// fieldTree is the dotted json field paths, a leaf is the whole field
+type fieldTree map[string]fieldTree
+
+func (t fieldTree) add(path string) {
+	for _, name := range strings.Split(path, ".") {
+		sub, ok := t[name]
+		if !ok {
+			sub = make(fieldTree)
+			t[name] = sub
+		}
+		t = sub
+	}
+}
+
+// Shape is the response shaping of `fields=` and `embed=` query parameters.
+//
+//	fields=total,builds.id,builds.version	keep only given fields
+//	fields=-symbols.path					omit given fields
+//	embed=latest							add related objects, names are defined per api
+//
+// Field paths are json names relative to response data, arrays are transparent so
+// `builds.id` is the id of each build.
+//
+type Shape struct {
+	include fieldTree // nil for all fields
+	exclude fieldTree
+	embed   map[string]bool
+}
+
+// ParseShape parse shaping parameters of `r`, `embeds` is the names the api can embed.
+//
+func ParseShape(r *http.Request, embeds ...string) (*Shape, error) {
+	s := &Shape{exclude: make(fieldTree), embed: make(map[string]bool)}
+	for _, path := range strings.Split(r.URL.Query().Get("fields"), ",") {
+		path = strings.TrimSpace(path)
+		switch {
+		case path == "" || path == "-":
+		case path[0] == '-':
+			s.exclude.add(path[1:])
+		default:
+			if s.include == nil {
+				s.include = make(fieldTree)
+			}
+			s.include.add(path)
+		}
+	}
+	for _, name := range strings.Split(r.URL.Query().Get("embed"), ",") {
+		name = strings.TrimSpace(name)
+		if name == "" {
+			continue
+		}
+		known := false
+		for _, e := range embeds {
+			if strings.EqualFold(e, name) {
+				s.embed[e], known = true, true
+			}
+		}
+		if !known {
+			return nil, fmt.Errorf("unknown embed %s, expect one of %v", name, embeds)
+		}
+	}
+	return s, nil
+}
+
+// Embeds check if object `name` is asked to be embedded.
+//
+func (s *Shape) Embeds(name string) bool {
+	return s.embed[name]
+}
+
+// Wants check if top level field `name` is kept, so api can skip loading omitted fields.
+//
+func (s *Shape) Wants(name string) bool {
+	if sub, ok := s.exclude[name]; ok && len(sub) == 0 {
+		return false
+	}
+	if s.include == nil {
+		return true
+	}
+	_, ok := s.include[name]
+	return ok
+}
+
+// Apply select fields of response `data`, it's returned as is without `fields=`.
+//
+func (s *Shape) Apply(data interface{}) (interface{}, error) {
+	if s.include == nil && len(s.exclude) == 0 {
+		return data, nil
+	}
+	buf, err := json.Marshal(data)
+	if err != nil {
+		return nil, err
+	}
+	var v interface{}
+	dec := json.NewDecoder(bytes.NewReader(buf))
+	dec.UseNumber()
+	if err = dec.Decode(&v); err != nil {
+		return nil, err
+	}
+	if s.include != nil {
+		v = pickFields(v, s.include)
+	}
+	return omitFields(v, s.exclude), nil
+}
+
+// pickFields keep only fields of `v` in `t`
+func pickFields(v interface{}, t fieldTree) interface{} {
+	switch x := v.(type) {
+	case []interface{}:
+		for i := range x {
+			x[i] = pickFields(x[i], t)
+		}
+	case map[string]interface{}:
+		for name, val := range x {
+			sub, ok := t[name]
+			if !ok {
+				delete(x, name)
+			} else if len(sub) > 0 {
+				x[name] = pickFields(val, sub)
+			}
+		}
+	}
+	return v
+}
+
+// omitFields remove fields of `v` in `t`
+func omitFields(v interface{}, t fieldTree) interface{} {
+	switch x := v.(type) {
+	case []interface{}:
+		for i := range x {
+			x[i] = omitFields(x[i], t)
+		}
+	case map[string]interface{}:
+		for name, sub := range t {
+			val, ok := x[name]
+			if !ok {
+				continue
+			}
+			if len(sub) == 0 {
+				delete(x, name)
+			} else {
+				x[name] = omitFields(val, sub)
+			}
+		}
+	}
+	return v
+}
+
+// Shape apply `fields=` to response data, data is kept if it can't be shaped.
+//
+func (r *RestResponse) Shape(s *Shape) {
+	data, err := s.Apply(r.Data)
+	if err != nil {
+		log.Warn("[Restful] Shape response failed: %v.", err)
+		return
+	}
+	r.Data = data
+}
@@ -0,0 +1,53 @@
+package restful
+
+import (
+	"encoding/json"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/adyzng/GoSymbols/symbol"
+)
+
+func TestShape(t *testing.T) {
+	data := &BuildDetail{
+		Build: &symbol.Build{ID: "0000000001", Version: "100", Status: symbol.StatusComplete},
+		Total: 1,
+		Symbols: []*symbol.Symbol{
+			{Name: "a.pdb", Hash: "AB1", Path: "x64/a.pdb"},
+		},
+	}
+
+	cases := map[string]string{
+		"":                               `{"build":{"branch":"","comment":"","date":"","id":"0000000001","key":"","status":"complete","store":"","version":"100"},"symbols":[{"arch":"","hash":"AB1","name":"a.pdb","path":"x64/a.pdb","url":"","version":""}],"total":1}`,
+		"fields=build.id,symbols.name":   `{"build":{"id":"0000000001"},"symbols":[{"name":"a.pdb"}]}`,
+		"fields=total,-symbols.path":     `{"total":1}`,
+		"fields=-symbols.path,-build":    `{"symbols":[{"arch":"","hash":"AB1","name":"a.pdb","url":"","version":""}],"total":1}`,
+		"fields=symbols,-symbols.hash,-": `{"symbols":[{"arch":"","name":"a.pdb","path":"x64/a.pdb","url":"","version":""}]}`,
+	}
+	for q, expect := range cases {
+		shape, err := ParseShape(httptest.NewRequest("GET", "/api/builds/x?"+q, nil))
+		if err != nil {
+			t.Fatal(err)
+		}
+		resp := RestResponse{Data: data}
+		resp.Shape(shape)
+		out, _ := json.Marshal(resp.Data)
+		if q == "" {
+			// not shaped, marshal the generic form for comparison
+			var v interface{}
+			json.Unmarshal(out, &v)
+			out, _ = json.Marshal(v)
+		}
+		if string(out) != expect {
+			t.Errorf("%s: expect %s, got %s", q, expect, out)
+		}
+	}
+
+	shape, _ := ParseShape(httptest.NewRequest("GET", "/api/builds/x?fields=-symbols&embed=Branch", nil), "branch")
+	if shape.Wants("symbols") || !shape.Wants("total") || !shape.Embeds("branch") {
+		t.Errorf("unexpected shape %+v", shape)
+	}
+	if _, err := ParseShape(httptest.NewRequest("GET", "/api/branches?embed=nope", nil), "latest"); err == nil {
+		t.Errorf("unknown embed should fail")
+	}
+}
@@ -0,0 +1,154 @@
+package v1
+
+import (
+	"context"
+	"net/http"
+	"net/url"
+	"path"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/adyzng/GoSymbols/activity"
+	"github.com/adyzng/GoSymbols/restful"
+	"github.com/adyzng/GoSymbols/symbol"
+	log "gopkg.in/clog.v1"
+)
+
+// RestActivity response to activity dashboard api, usage of users and clients in time range
+//	[:]/api/activity?from=2006-01-02&to=2006-01-02&by=user&user=&client=&slow=false [GET]
+//
+//	@:from		{first day, default 7 days ago}
+//	@:to		{last day, default today}
+//	@:by		{user, client, segment or hour}
+//	@:user		{only usage of the user}
+//	@:client	{only usage of the client address}
+//	@:slow		{only clients or segments most downloads of which are slow}
+//
+//	@ return {
+//		RestResponse{Data: []*activity.Usage}
+//	}
+//
+func RestActivity(w http.ResponseWriter, r *http.Request) {
+	if _, token := loginRequired(r); token == nil {
+		w.WriteHeader(http.StatusUnauthorized)
+		log.Warn("[Restful] Login required.")
+		return
+	}
+
+	query := r.URL.Query()
+	resp := restful.RestResponse{}
+	today := time.Now()
+	to, err := parseDay(query.Get("to"), today)
+	if err != nil {
+		resp.ErrCodeMsg = restful.ErrInvalidParam
+		resp.Message = err.Error()
+		resp.WriteJSON(w)
+		return
+	}
+	from, err := parseDay(query.Get("from"), to.AddDate(0, 0, -6))
+	if err != nil {
+		resp.ErrCodeMsg = restful.ErrInvalidParam
+		resp.Message = err.Error()
+		resp.WriteJSON(w)
+		return
+	}
+
+	// `to` is inclusive
+	arr := activity.Summarize(from, to.AddDate(0, 0, 1), query.Get("by"), query.Get("user"), query.Get("client"))
+	if slow, _ := strconv.ParseBool(query.Get("slow")); slow {
+		flagged := make([]*activity.Usage, 0)
+		for _, u := range arr {
+			if u.Slow {
+				flagged = append(flagged, u)
+			}
+		}
+		arr = flagged
+	}
+	resp.Data = arr
+	resp.WriteJSON(w)
+}
+
+// parseDay parse `2006-01-02` in local time, `def` if empty
+func parseDay(s string, def time.Time) (time.Time, error) {
+	if s == "" {
+		s = def.Format("2006-01-02")
+	}
+	return time.ParseInLocation("2006-01-02", s, time.Local)
+}
+
+// RestHeatmap response to symbol usage heat map api, downloads of symbols by name per day
+// or hour across branches, so component owners know which of their pdbs are used
+//	[:]/api/activity/heatmap?from=2006-01-02&to=2006-01-02&step=day&branch=&name=vddk*.pdb&unused=false [GET]
+//
+//	@:from		{first day, default 30 days ago}
+//	@:to		{last day, default today}
+//	@:step		{day or hour}
+//	@:branch	{only downloads of the branch}
+//	@:name		{only symbols matching the name, `*` matches any}
+//	@:unused	{also list stored symbols never downloaded, need metadata database}
+//
+//	@ return {
+//		RestResponse{Data: *activity.Heatmap}
+//	}
+//
+func RestHeatmap(w http.ResponseWriter, r *http.Request) {
+	if _, token := loginRequired(r); token == nil {
+		w.WriteHeader(http.StatusUnauthorized)
+		log.Warn("[Restful] Login required.")
+		return
+	}
+
+	query := r.URL.Query()
+	resp := restful.RestResponse{}
+	to, err := parseDay(query.Get("to"), time.Now())
+	if err != nil {
+		resp.ErrCodeMsg = restful.ErrInvalidParam
+		resp.Message = err.Error()
+		resp.WriteJSON(w)
+		return
+	}
+	from, err := parseDay(query.Get("from"), to.AddDate(0, 0, -29))
+	if err != nil {
+		resp.ErrCodeMsg = restful.ErrInvalidParam
+		resp.Message = err.Error()
+		resp.WriteJSON(w)
+		return
+	}
+	if _, err = path.Match(query.Get("name"), ""); err != nil || from.After(to) {
+		resp.ErrCodeMsg = restful.ErrInvalidParam
+		resp.WriteJSON(w)
+		return
+	}
+
+	// `to` is inclusive
+	if resp.Data, err = symbolHeatmap(r.Context(), from, to.AddDate(0, 0, 1), query); err != nil {
+		resp.ErrCodeMsg = restful.ErrServerInner
+		resp.Message = err.Error()
+	}
+	resp.WriteJSON(w)
+}
+
+// symbolHeatmap aggregate downloads, and add stored names never downloaded if asked
+func symbolHeatmap(ctx context.Context, from, to time.Time, query url.Values) (*activity.Heatmap, error) {
+	branch, name := query.Get("branch"), query.Get("name")
+	hm := activity.SymbolHeatmap(from, to, query.Get("step"), branch, name)
+	if unused, _ := strconv.ParseBool(query.Get("unused")); !unused {
+		return hm, nil
+	}
+	names, err := symbol.GetServer().SymbolNames(ctx, branch, name)
+	if err != nil {
+		return nil, err
+	}
+	used := make(map[string]bool, len(hm.Symbols))
+	for _, heat := range hm.Symbols {
+		used[strings.ToLower(heat.Name)] = true
+	}
+	hm.Unused = make([]string, 0)
+	for _, n := range names {
+		if !used[n] {
+			hm.Unused = append(hm.Unused, n)
+		}
+	}
+	return hm, nil
+}
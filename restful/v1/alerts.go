@@ -0,0 +1,24 @@
+package v1
+
+import (
+	"net/http"
+	"strconv"
+
+	"github.com/adyzng/GoSymbols/alert"
+	"github.com/adyzng/GoSymbols/restful"
+)
+
+// RestAlertList response to alert list api
+//	[:]/api/alerts?n=50 [GET]
+//
+//	@ return {
+//		RestResponse{Data: []*alert.Alert}
+//	}
+//
+func RestAlertList(w http.ResponseWriter, r *http.Request) {
+	n, _ := strconv.Atoi(r.URL.Query().Get("n"))
+	resp := restful.RestResponse{
+		Data: alert.Recent(n),
+	}
+	resp.WriteJSON(w)
+}
@@ -0,0 +1,94 @@
+package v1
+
+import (
+	"encoding/json"
+	"fmt"
+	"net/http"
+
+	"github.com/adyzng/GoSymbols/restful"
+	"github.com/adyzng/GoSymbols/symbol"
+	"github.com/gorilla/mux"
+
+	log "gopkg.in/clog.v1"
+)
+
+// MountArchive response to mount archive api, serve an exported archive as read-only branch
+//	[:]/api/archives [POST]
+//
+//	@:BODY	{name: branch name, path: archive path under [archive] DIR}
+//
+//	@ return {
+//		RestResponse{Data: symbol.Branch}
+//	}
+//
+func MountArchive(w http.ResponseWriter, r *http.Request) {
+	_, token := loginRequired(r)
+	if token == nil {
+		w.WriteHeader(http.StatusUnauthorized)
+		log.Warn("[Restful] Login required.")
+		return
+	}
+
+	var req struct {
+		Name string `json:"name"`
+		Path string `json:"path"`
+	}
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		log.Error(2, "[Restful] Decode request body failed: %v.", err)
+		w.WriteHeader(http.StatusBadRequest)
+		return
+	}
+
+	resp := restful.RestResponse{}
+	if req.Name == "" || req.Path == "" {
+		resp.ErrCodeMsg = restful.ErrInvalidParam
+		resp.WriteJSON(w)
+		return
+	}
+
+	ss := symbol.GetServer()
+	b, err := ss.MountArchive(req.Name, req.Path)
+	if err != nil {
+		log.Error(2, "[Restful] Mount archive %s failed: %v.", req.Path, err)
+		resp.ErrCodeMsg = restful.ErrInvalidBranch
+		resp.Message = fmt.Sprintf("%s", err)
+		resp.WriteJSON(w)
+		return
+	}
+	ss.SaveBranchs("")
+
+	log.Info("[Restful] User %s mount archive %s as %s.", token.UserName, req.Path, req.Name)
+	resp.Data = b.GetBranch()
+	resp.WriteJSON(w)
+}
+
+// UnmountArchive response to unmount archive api
+//	[:]/api/archives/{name} [DELETE]
+//
+//	@:name	{branch name}
+//
+//	@ return {
+//		RestResponse
+//	}
+//
+func UnmountArchive(w http.ResponseWriter, r *http.Request) {
+	_, token := loginRequired(r)
+	if token == nil {
+		w.WriteHeader(http.StatusUnauthorized)
+		log.Warn("[Restful] Login required.")
+		return
+	}
+
+	bname := mux.Vars(r)["name"]
+	resp := restful.RestResponse{}
+	ss := symbol.GetServer()
+	if err := ss.UnmountArchive(bname); err != nil {
+		resp.ErrCodeMsg = restful.ErrUnknownBranch
+		resp.WriteJSON(w)
+		return
+	}
+	ss.SaveBranchs("")
+
+	log.Info("[Restful] User %s unmount archive %s.", token.UserName, bname)
+	resp.WriteJSON(w)
+}
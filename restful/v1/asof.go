@@ -0,0 +1,96 @@
+package v1
+
+import (
+	"fmt"
+	"net/http"
+
+	"github.com/adyzng/GoSymbols/query"
+	"github.com/adyzng/GoSymbols/restful"
+	"github.com/adyzng/GoSymbols/symbol"
+
+	log "gopkg.in/clog.v1"
+)
+
+// restBuildsAsOf response build list reconstructed from transaction history
+func restBuildsAsOf(w http.ResponseWriter, bu symbol.Builder, asOf string, filter query.Expr, shape *restful.Shape) {
+	resp := restful.RestResponse{}
+	b := storeBuilder(bu)
+	if b == nil {
+		resp.ErrCodeMsg = restful.ErrUnknownBranch
+		resp.WriteJSON(w)
+		return
+	}
+
+	state, err := b.StateAsOf(asOf)
+	if err != nil {
+		log.Error(2, "[Restful] Builds of %s as of %s failed: %v.", b.Name(), asOf, err)
+		resp.ErrCodeMsg = restful.ErrInvalidParam
+		resp.Message = fmt.Sprintf("%s", err)
+		resp.WriteJSON(w)
+		return
+	}
+	builds := state.Builds
+	if filter != nil {
+		builds = builds[:0]
+		for _, build := range state.Builds {
+			if filter.Match(build.Field) {
+				builds = append(builds, build)
+			}
+		}
+	}
+	items := make([]*restful.BuildItem, 0, len(builds))
+	for _, build := range builds {
+		item := &restful.BuildItem{Build: build}
+		if shape.Embeds("symbols") {
+			if item.Symbols, err = b.SymbolsAsOf(asOf, build.ID); err != nil {
+				log.Error(2, "[Restful] Symbols of %s:%s as of %s failed: %v.", b.Name(), build.ID, asOf, err)
+			}
+		}
+		items = append(items, item)
+	}
+	resp.Data = restful.BuildList{
+		Branch: b.Name(),
+		Total:  len(builds),
+		Builds: items,
+		AsOf:   state.LastID,
+	}
+	resp.Shape(shape)
+	resp.WriteJSON(w)
+}
+
+// restSymbolsAsOf response symbol list of build as it was at `asOf`
+func restSymbolsAsOf(w http.ResponseWriter, bu symbol.Builder, bid, asOf string, filter query.Expr, shape *restful.Shape) {
+	resp := restful.RestResponse{}
+	b := storeBuilder(bu)
+	if b == nil {
+		resp.ErrCodeMsg = restful.ErrUnknownBranch
+		resp.WriteJSON(w)
+		return
+	}
+
+	syms, err := b.SymbolsAsOf(asOf, bid)
+	if err != nil {
+		log.Error(2, "[Restful] Symbols of %s:%s as of %s failed: %v.", b.Name(), bid, asOf, err)
+		resp.ErrCodeMsg = restful.ErrInvalidParam
+		resp.Message = fmt.Sprintf("%s", err)
+		resp.WriteJSON(w)
+		return
+	}
+	if filter != nil {
+		matched := syms[:0]
+		for _, sym := range syms {
+			if filter.Match(sym.Field) {
+				matched = append(matched, sym)
+			}
+		}
+		syms = matched
+	}
+	resp.Data = restful.SymbolList{
+		Branch:  b.Name(),
+		Build:   bid,
+		Total:   len(syms),
+		Symbols: syms,
+	}
+	resp.Shape(shape)
+	resp.WriteJSON(w)
+}
@@ -0,0 +1,345 @@
+package v1
+
+import (
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"strconv"
+
+	"github.com/adyzng/GoSymbols/activity"
+	"github.com/adyzng/GoSymbols/audit"
+	"github.com/adyzng/GoSymbols/restful"
+	"github.com/adyzng/GoSymbols/restful/auth"
+	"github.com/adyzng/GoSymbols/symbol"
+	"github.com/gorilla/mux"
+
+	log "gopkg.in/clog.v1"
+)
+
+// apiUser return user logined by oauth, or authenticated by the policy of the zone (basic,
+// token, windows integrated) for tooling which can't login. Empty if neither, the zone
+// methods which don't tell who the client is (anonymous, ip) are not accepted.
+func apiUser(r *http.Request) string {
+	if _, token := loginRequired(r); token != nil {
+		return token.UserName
+	}
+	id := auth.RequestIdentity(r)
+	if id == nil || id.Method == "anonymous" || id.Method == "ip" {
+		return ""
+	}
+	if id.User != "" {
+		return id.User
+	}
+	return id.Method
+}
+
+// preview check `?preview=true` of mutating api, the change set is computed and returned
+// without applying it
+func preview(r *http.Request) bool {
+	p, _ := strconv.ParseBool(r.URL.Query().Get("preview"))
+	return p
+}
+
+// writeUnauthorized refuse request without apiUser
+func writeUnauthorized(w http.ResponseWriter) {
+	log.Warn("[Restful] Login or api credential required.")
+	resp := restful.RestResponse{ErrCodeMsg: restful.ErrLoginNeeded}
+	resp.WriteStatus(w, http.StatusUnauthorized)
+}
+
+// RestBranch response to branch resource api
+//	[:]/api/v1/branches/{name} [GET]
+//
+//	@:name		{branch name}
+//
+//	@ return {
+//		RestResponse{Data: restful.BranchItem}
+//	}
+//
+func RestBranch(w http.ResponseWriter, r *http.Request) {
+	resp := restful.RestResponse{}
+	bu := symbol.GetServer().Get(mux.Vars(r)["name"])
+	if bu == nil {
+		resp.ErrCodeMsg = restful.ErrUnknownBranch
+		resp.WriteStatus(w, http.StatusNotFound)
+		return
+	}
+	nb := *bu.GetBranch()
+	resp.Data = &restful.BranchItem{Branch: &nb, Latest: latestBuild(bu)}
+	resp.WriteJSON(w)
+}
+
+// PostBranch response to create branch resource api, the latest build is ingested if the
+// build share is accessible
+//	[:]/api/v1/branches [POST]
+//
+//	@:BODY		{symbol.Branch}
+//
+//	@ return {
+//		RestResponse{Data: symbol.Branch}
+//	}
+//
+func PostBranch(w http.ResponseWriter, r *http.Request) {
+	user := apiUser(r)
+	if user == "" {
+		writeUnauthorized(w)
+		return
+	}
+	var branch symbol.Branch
+	if err := json.NewDecoder(r.Body).Decode(&branch); err != nil {
+		log.Error(2, "[Restful] Decode request body failed: %v.", err)
+		w.WriteHeader(http.StatusBadRequest)
+		return
+	}
+
+	resp := restful.RestResponse{}
+	ss := symbol.GetServer()
+	if ss.Get(branch.StoreName) != nil {
+		resp.ErrCodeMsg = restful.ErrExistOnLocal
+		resp.WriteStatus(w, http.StatusConflict)
+		return
+	}
+	br := ss.Add(&branch)
+	if br == nil {
+		log.Warn("[Restful] Create invalid branch %v.", branch)
+		resp.ErrCodeMsg = restful.ErrInvalidBranch
+		resp.WriteStatus(w, http.StatusBadRequest)
+		return
+	}
+	if br.CanUpdate() {
+		ss.Trigger(br.Name(), "", symbol.PriorityDefault)
+	} else {
+		resp.Message = fmt.Sprintf("path not accessable (%s)", branch.BuildPath)
+	}
+	if err := ss.SaveBranchs(""); err != nil {
+		log.Warn("[Restful] Save branch (%v) failed: %v.", branch, err)
+	}
+	audit.Record(user, "create-branch", br.Name(), "build path %s, store path %s", branch.BuildPath, branch.StorePath)
+	log.Info("[Restful] User %s create branch %s.", user, br.Name())
+
+	resp.Data = br.GetBranch()
+	resp.WriteStatus(w, http.StatusCreated)
+}
+
+// ImportBranches response to bulk import branches api, the body is a csv of branches with a
+// header row (see symbol.ParseBranchCSV), raw or as the `file` field of a multipart form.
+// Each row is validated like a dry run and reported, valid ones are created.
+//	[:]/api/v1/branches/import?preview=true [POST]
+//
+//	@:preview	{optional, validate the rows without creating branches}
+//	@:BODY		{csv, storeName,buildPath,schedule,retention}
+//
+//	@ return {
+//		RestResponse{Data: symbol.ImportReport}
+//	}
+//
+func ImportBranches(w http.ResponseWriter, r *http.Request) {
+	user := apiUser(r)
+	if user == "" {
+		writeUnauthorized(w)
+		return
+	}
+	body := io.Reader(r.Body)
+	if file, _, err := r.FormFile("file"); err == nil {
+		defer file.Close()
+		body = file
+	}
+
+	resp := restful.RestResponse{}
+	rows, err := symbol.ParseBranchCSV(body)
+	if err != nil {
+		log.Warn("[Restful] Invalid branch csv from %s: %v.", user, err)
+		resp.ErrCodeMsg = restful.ErrInvalidParam
+		resp.Message = fmt.Sprintf("%s", err)
+		resp.WriteStatus(w, http.StatusBadRequest)
+		return
+	}
+	report := symbol.GetServer().ImportBranches(rows, preview(r), user)
+	log.Info("[Restful] User %s import %d branches, %d created.", user, len(rows), report.Created)
+	resp.Data = report
+	resp.WriteJSON(w)
+}
+
+// PutBranch response to modify branch resource api, the branch name is taken from path
+//	[:]/api/v1/branches/{name}?preview=true [PUT]
+//
+//	@:name		{branch name}
+//	@:preview	{optional, return the changes without applying them}
+//	@:BODY		{symbol.Branch}
+//
+//	@ return {
+//		RestResponse{Data: symbol.Branch or symbol.ModifyPreview}
+//	}
+//
+func PutBranch(w http.ResponseWriter, r *http.Request) {
+	user := apiUser(r)
+	if user == "" {
+		writeUnauthorized(w)
+		return
+	}
+	var branch symbol.Branch
+	if err := json.NewDecoder(r.Body).Decode(&branch); err != nil {
+		log.Error(2, "[Restful] Decode request body failed: %v.", err)
+		w.WriteHeader(http.StatusBadRequest)
+		return
+	}
+
+	resp := restful.RestResponse{}
+	ss := symbol.GetServer()
+	bu := ss.Get(mux.Vars(r)["name"])
+	if bu == nil {
+		resp.ErrCodeMsg = restful.ErrUnknownBranch
+		resp.WriteStatus(w, http.StatusNotFound)
+		return
+	}
+	branch.StoreName = bu.Name()
+	if preview(r) {
+		pv, err := ss.PreviewModify(&branch)
+		if err != nil {
+			resp.ErrCodeMsg = restful.ErrInvalidBranch
+			resp.Message = fmt.Sprintf("%s", err)
+			resp.WriteStatus(w, http.StatusBadRequest)
+			return
+		}
+		resp.Data = pv
+		resp.WriteJSON(w)
+		return
+	}
+	if ss.Modify(&branch) == nil {
+		log.Warn("[Restful] Modify invalid branch %v.", branch)
+		resp.ErrCodeMsg = restful.ErrInvalidBranch
+		resp.WriteStatus(w, http.StatusBadRequest)
+		return
+	}
+	if err := ss.SaveBranchs(""); err != nil {
+		log.Warn("[Restful] Save branch (%v) failed: %v.", branch, err)
+	}
+	audit.Record(user, "modify-branch", bu.Name(), "build path %s, store path %s", branch.BuildPath, branch.StorePath)
+	log.Info("[Restful] User %s modify branch %s.", user, bu.Name())
+
+	resp.Data = bu.GetBranch()
+	resp.WriteJSON(w)
+}
+
+// RemoveBranch response to delete branch resource api. The branch is no longer served or
+// updated, its store is left on disk and can be added back.
+//	[:]/api/v1/branches/{name} [DELETE]
+//
+//	@:name		{branch name}
+//
+//	@ return {
+//		RestResponse
+//	}
+//
+func RemoveBranch(w http.ResponseWriter, r *http.Request) {
+	user := apiUser(r)
+	if user == "" {
+		writeUnauthorized(w)
+		return
+	}
+
+	resp := restful.RestResponse{}
+	ss := symbol.GetServer()
+	bu := ss.Get(mux.Vars(r)["name"])
+	if bu == nil {
+		resp.ErrCodeMsg = restful.ErrUnknownBranch
+		resp.WriteStatus(w, http.StatusNotFound)
+		return
+	}
+	if bu.GetBranch().Sealed != nil {
+		resp.ErrCodeMsg = restful.ErrUnauthorized
+		resp.Message = fmt.Sprintf("%s", symbol.ErrSealed)
+		resp.WriteStatus(w, http.StatusConflict)
+		return
+	}
+	ss.Delete(bu.Name())
+	if err := ss.SaveBranchs(""); err != nil {
+		log.Warn("[Restful] Save branchs after deleting %s failed: %v.", bu.Name(), err)
+	}
+	audit.Record(user, "delete-branch", bu.Name(), "store %s left on disk", bu.GetBranch().StorePath)
+	log.Info("[Restful] User %s delete branch %s.", user, bu.Name())
+	resp.WriteJSON(w)
+}
+
+// RestBuild response to build resource api
+//	[:]/api/v1/branches/{name}/builds/{bid} [GET]
+//
+//	@:name		{branch name}
+//	@:bid		{build id}
+//
+//	@ return {
+//		RestResponse{Data: symbol.Build}
+//	}
+//
+func RestBuild(w http.ResponseWriter, r *http.Request) {
+	vars := mux.Vars(r)
+	resp := restful.RestResponse{}
+	bu := symbol.GetServer().Get(vars["name"])
+	if bu == nil {
+		resp.ErrCodeMsg = restful.ErrUnknownBranch
+		resp.WriteStatus(w, http.StatusNotFound)
+		return
+	}
+	var found *symbol.Build
+	bu.ParseBuilds(r.Context(), func(build *symbol.Build) error {
+		if build.ID == vars["bid"] {
+			found = build
+		}
+		return nil
+	})
+	if found == nil {
+		resp.ErrCodeMsg = restful.ErrInvalidParam
+		resp.Message = fmt.Sprintf("%s", symbol.ErrBuildNotExist)
+		resp.WriteStatus(w, http.StatusNotFound)
+		return
+	}
+	resp.Data = found
+	resp.WriteJSON(w)
+}
+
+// PostBuild response to add build resource api, the build is queued for ingest
+//	[:]/api/v1/branches/{name}/builds [POST]
+//
+//	@:name		{branch name}
+//	@:BODY		{version, priority}, empty version for the latest build
+//
+//	@ return {
+//		RestResponse{Data: symbol.Job}
+//	}
+//
+func PostBuild(w http.ResponseWriter, r *http.Request) {
+	user := apiUser(r)
+	if user == "" {
+		writeUnauthorized(w)
+		return
+	}
+	req := restful.BuildTrigger{Priority: symbol.PriorityDefault}
+	if r.ContentLength != 0 {
+		if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+			log.Error(2, "[Restful] Decode request body failed: %v.", err)
+			w.WriteHeader(http.StatusBadRequest)
+			return
+		}
+	}
+
+	bname := mux.Vars(r)["name"]
+	resp := restful.RestResponse{}
+	job, err := symbol.GetServer().Enqueue(bname, req.Version, req.Priority)
+	switch err {
+	case nil:
+	case symbol.ErrBranchNotInit:
+		resp.ErrCodeMsg = restful.ErrUnknownBranch
+		resp.WriteStatus(w, http.StatusNotFound)
+		return
+	default:
+		resp.ErrCodeMsg = restful.ErrServerInner
+		resp.Message = fmt.Sprintf("%s", err)
+		resp.WriteStatus(w, http.StatusServiceUnavailable)
+		return
+	}
+	log.Info("[Restful] User %s trigger branch %s build %s.", user, bname, req.Version)
+	activity.Annotate(r, activity.KindIngest, bname, req.Version)
+	resp.Data = job
+	resp.WriteStatus(w, http.StatusAccepted)
+}
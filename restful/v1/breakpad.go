@@ -0,0 +1,53 @@
+package v1
+
+import (
+	"net/http"
+
+	"github.com/adyzng/GoSymbols/activity"
+	"github.com/adyzng/GoSymbols/restful/auth"
+	"github.com/adyzng/GoSymbols/symbol"
+	"github.com/gorilla/mux"
+
+	log "gopkg.in/clog.v1"
+)
+
+// DownloadBreakpad response Breakpad symbols api, the layout of Breakpad symbol servers so
+// Socorro and minidump-stackwalk resolve crashes with symbol url `{server}/api/breakpad`.
+//	[:]/api/breakpad/{file}/{id}/{sym} [GET, HEAD]
+//
+//	@:file	{debug file, eg: foo.pdb}
+//	@:id	{debug id, guid and age}
+//	@:sym	{eg: foo.sym}
+//
+//	@ return file
+//
+func DownloadBreakpad(w http.ResponseWriter, r *http.Request) {
+	vars := mux.Vars(r)
+	file, id, sym := vars["file"], vars["id"], vars["sym"]
+
+	f := symbol.GetServer().FindBreakpad(file, id, sym)
+	if f == nil {
+		log.Trace("[Restful] Breakpad symbols %s/%s/%s not found.", file, id, sym)
+		w.WriteHeader(http.StatusNotFound)
+		return
+	}
+	if !auth.BranchAllowed(r, f.Builder.Name()) {
+		log.Warn("[Restful] Symbols of %s restricted, refuse breakpad %s/%s.", f.Builder.Name(), file, id)
+		w.WriteHeader(http.StatusForbidden)
+		return
+	}
+	fd, encrypted := openServed(w, r, f.Builder, f.Path)
+	if fd == nil {
+		return
+	}
+	defer fd.Close()
+
+	w.Header().Set("Content-Type", "text/plain; charset=utf-8")
+	w.Header().Set("ETag", f.ETag(id))
+	cacheControl(w, encrypted)
+	if r.Method == "GET" {
+		activity.Annotate(r, activity.KindDownload, f.Builder.Name(), id+"/"+sym)
+	}
+	http.ServeContent(w, r, sym, f.Info.ModTime(), fd)
+	log.Trace("[Restful] Send breakpad symbols complete. [%s %d: %s]", r.Method, f.Info.Size(), f.Path)
+}
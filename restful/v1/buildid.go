@@ -0,0 +1,60 @@
+package v1
+
+import (
+	"fmt"
+	"net/http"
+
+	"github.com/adyzng/GoSymbols/activity"
+	"github.com/adyzng/GoSymbols/restful/auth"
+	"github.com/adyzng/GoSymbols/symbol"
+	"github.com/gorilla/mux"
+
+	log "gopkg.in/clog.v1"
+)
+
+// DownloadBuildID response binary by build id api, the debuginfod protocol so pprof, delve
+// and gdb resolve symbols of Go (or other ELF) binaries with `DEBUGINFOD_URLS={server}/api`.
+//	[:]/api/buildid/{id}/{kind} [GET, HEAD]
+//
+//	@:id	{hex GNU build-id or Go build id}
+//	@:kind	{executable | debuginfo}, both are the unstripped binary
+//
+//	@ return file
+//
+func DownloadBuildID(w http.ResponseWriter, r *http.Request) {
+	vars := mux.Vars(r)
+	id, kind := vars["id"], vars["kind"]
+	if id == "" || (kind != "executable" && kind != "debuginfo") {
+		log.Warn("[Restful] Download build id invalid param: [%s, %s]", id, kind)
+		w.WriteHeader(http.StatusNotFound)
+		return
+	}
+
+	f := symbol.GetServer().FindBuildID(id)
+	if f == nil {
+		log.Trace("[Restful] Build id %s not found.", id)
+		w.WriteHeader(http.StatusNotFound)
+		return
+	}
+	if !auth.BranchAllowed(r, f.Builder.Name()) {
+		log.Warn("[Restful] Symbols of %s restricted, refuse build id %s.", f.Builder.Name(), id)
+		w.WriteHeader(http.StatusForbidden)
+		return
+	}
+	fd, encrypted := openServed(w, r, f.Builder, f.Path)
+	if fd == nil {
+		return
+	}
+	defer fd.Close()
+
+	name := f.Info.Name()
+	w.Header().Set("Content-Type", "application/octet-stream")
+	w.Header().Set("Content-Disposition", fmt.Sprintf("attachment; filename=\"%s\"", name))
+	w.Header().Set("ETag", f.ETag(id))
+	cacheControl(w, encrypted)
+	if r.Method == "GET" {
+		activity.Annotate(r, activity.KindDownload, f.Builder.Name(), id+"/"+name)
+	}
+	http.ServeContent(w, r, name, f.Info.ModTime(), fd)
+	log.Trace("[Restful] Send binary complete. [%s %d: %s]", r.Method, f.Info.Size(), f.Path)
+}
@@ -0,0 +1,93 @@
+package v1
+
+import (
+	"encoding/json"
+	"fmt"
+	"net/http"
+
+	"github.com/adyzng/GoSymbols/restful"
+	"github.com/adyzng/GoSymbols/symbol"
+	"github.com/gorilla/mux"
+
+	log "gopkg.in/clog.v1"
+)
+
+// RestChannels response to channels api, builds per channel of the branch
+//	[:]/api/branches/{name}/channels [GET]
+//
+//	@:name	{branch name}
+//
+//	@ return {
+//		RestResponse{Data: []*symbol.ChannelSummary}
+//	}
+//
+func RestChannels(w http.ResponseWriter, r *http.Request) {
+	vars := mux.Vars(r)
+	resp := restful.RestResponse{}
+
+	b := storeBuilder(symbol.GetServer().Get(vars["name"]))
+	if b == nil {
+		resp.ErrCodeMsg = restful.ErrUnknownBranch
+		resp.WriteJSON(w)
+		return
+	}
+	channels, err := b.ChannelSummaries()
+	if err != nil {
+		log.Error(2, "[Restful] Channels of %s failed: %v.", b.Name(), err)
+		resp.ErrCodeMsg = restful.ErrInvalidParam
+		resp.Message = fmt.Sprintf("%s", err)
+		resp.WriteJSON(w)
+		return
+	}
+	resp.Data = channels
+	resp.WriteJSON(w)
+}
+
+// SetBuildChannel response to tag build with channel api, empty channel remove the tag
+//	[:]/api/branches/{name}/{bid}/channel [POST]
+//
+//	@:name	{branch name}
+//	@:bid	{build id}
+//	@:BODY	{channel: "ga"}
+//
+//	@ return {
+//		RestResponse{Data: symbol.Build}
+//	}
+//
+func SetBuildChannel(w http.ResponseWriter, r *http.Request) {
+	_, token := loginRequired(r)
+	if token == nil {
+		w.WriteHeader(http.StatusUnauthorized)
+		log.Warn("[Restful] Login required.")
+		return
+	}
+
+	var req struct {
+		Channel string `json:"channel"`
+	}
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		log.Error(2, "[Restful] Decode request body failed: %v.", err)
+		w.WriteHeader(http.StatusBadRequest)
+		return
+	}
+
+	vars := mux.Vars(r)
+	resp := restful.RestResponse{}
+	b, ok := symbol.GetServer().Get(vars["name"]).(*symbol.BrBuilder)
+	if !ok {
+		resp.ErrCodeMsg = restful.ErrUnknownBranch
+		resp.WriteJSON(w)
+		return
+	}
+
+	build, err := b.SetChannel(vars["bid"], req.Channel)
+	if err != nil {
+		resp.ErrCodeMsg = restful.ErrInvalidParam
+		resp.Message = fmt.Sprintf("%s", err)
+		resp.WriteJSON(w)
+		return
+	}
+	log.Info("[Restful] User %s tag build %s of %s with channel %q.", token.UserName, vars["bid"], b.Name(), req.Channel)
+	resp.Data = build
+	resp.WriteJSON(w)
+}
@@ -0,0 +1,70 @@
+package v1
+
+import (
+	"fmt"
+	"net/http"
+
+	"github.com/adyzng/GoSymbols/restful"
+	"github.com/adyzng/GoSymbols/symbol"
+	"github.com/gorilla/mux"
+
+	log "gopkg.in/clog.v1"
+)
+
+// DedupBranch response to dedup api, link stored files of the branch ingested before
+// to the blob store, so identical files of all branches are stored once.
+//	[:]/api/branches/{name}/dedup [POST]
+//
+//	@:name		{branch name}
+//
+//	@ return {
+//		RestResponse{Data: symbol.DedupReport}
+//	}
+//
+func DedupBranch(w http.ResponseWriter, r *http.Request) {
+	_, token := loginRequired(r)
+	if token == nil {
+		w.WriteHeader(http.StatusUnauthorized)
+		log.Warn("[Restful] Login required.")
+		return
+	}
+
+	bname := mux.Vars(r)["name"]
+	resp := restful.RestResponse{}
+	report, err := symbol.GetServer().Dedup(bname, token.UserName)
+	if err != nil {
+		log.Warn("[Restful] Dedup branch %s failed: %v.", bname, err)
+		resp.ErrCodeMsg = restful.ErrInvalidBranch
+		resp.Message = fmt.Sprintf("%s", err)
+		resp.WriteJSON(w)
+		return
+	}
+	log.Info("[Restful] User %s dedup branch %s.", token.UserName, bname)
+	resp.Data = report
+	resp.WriteJSON(w)
+}
+
+// GetDedupStats response to dedup stats api, blobs shared by all branches and the
+// bytes saved by the links
+//	[:]/api/dedup [GET]
+//
+//	@ return {
+//		RestResponse{Data: *symbol.DedupStats}
+//	}
+//
+func GetDedupStats(w http.ResponseWriter, r *http.Request) {
+	resp := restful.RestResponse{}
+	stats, err := symbol.GetServer().DedupStats()
+	if err != nil {
+		log.Error(2, "[Restful] Get dedup stats failed: %v.", err)
+		resp.ErrCodeMsg = restful.ErrServerInner
+		resp.Message = fmt.Sprintf("%s", err)
+		resp.WriteJSON(w)
+		return
+	}
+	if stats == nil {
+		resp.Message = "dedup is disabled"
+	}
+	resp.Data = stats
+	resp.WriteJSON(w)
+}
@@ -0,0 +1,86 @@
+package v1
+
+import (
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"strconv"
+
+	"github.com/adyzng/GoSymbols/event"
+	"github.com/adyzng/GoSymbols/restful"
+
+	log "gopkg.in/clog.v1"
+)
+
+// RestEvents response to event journal api, consumers without bus poll it from their cursor
+//	[:]/api/events?after=0&n=100 [GET]
+//
+//	@ return {
+//		RestResponse{Data: []*event.Event}
+//	}
+//
+func RestEvents(w http.ResponseWriter, r *http.Request) {
+	after, _ := strconv.ParseUint(r.URL.Query().Get("after"), 10, 64)
+	n, _ := strconv.Atoi(r.URL.Query().Get("n"))
+	resp := restful.RestResponse{}
+	events, err := event.Read(after, n)
+	if err != nil {
+		log.Error(2, "[Restful] Read event journal failed: %v.", err)
+		resp.ErrCodeMsg = restful.ErrServerInner
+		resp.Message = fmt.Sprintf("%s", err)
+	}
+	resp.Data = events
+	resp.WriteJSON(w)
+}
+
+// RestEventCursors response to event bus cursors api
+//	[:]/api/events/cursors [GET]
+//
+//	@ return {
+//		RestResponse{Data: []*event.Cursor}
+//	}
+//
+func RestEventCursors(w http.ResponseWriter, r *http.Request) {
+	resp := restful.RestResponse{}
+	resp.Data = event.Cursors()
+	resp.WriteJSON(w)
+}
+
+// RewindEventCursor response to replay api, events after `seq` are delivered to the bus again
+//	[:]/api/events/cursors [POST]
+//
+//	@:BODY	{bus: "nats(nats:4222/gosymbols)", seq: 120}
+//
+//	@ return {
+//		RestResponse{Data: []*event.Cursor}
+//	}
+//
+func RewindEventCursor(w http.ResponseWriter, r *http.Request) {
+	_, token := loginRequired(r)
+	if token == nil {
+		w.WriteHeader(http.StatusUnauthorized)
+		log.Warn("[Restful] Login required.")
+		return
+	}
+
+	var req struct {
+		Bus string `json:"bus"`
+		Seq uint64 `json:"seq"`
+	}
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		log.Error(2, "[Restful] Decode request body failed: %v.", err)
+		w.WriteHeader(http.StatusBadRequest)
+		return
+	}
+
+	resp := restful.RestResponse{}
+	if err := event.Rewind(req.Bus, req.Seq); err != nil {
+		resp.ErrCodeMsg = restful.ErrInvalidParam
+		resp.Message = fmt.Sprintf("%s", err)
+		resp.WriteJSON(w)
+		return
+	}
+	log.Info("[Restful] User %s rewind event bus %s to %d.", token.UserName, req.Bus, req.Seq)
+	resp.Data = event.Cursors()
+	resp.WriteJSON(w)
+}
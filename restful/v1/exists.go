@@ -0,0 +1,243 @@
+package v1
+
+import (
+	"encoding/csv"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"strconv"
+	"strings"
+
+	"github.com/adyzng/GoSymbols/config"
+	"github.com/adyzng/GoSymbols/federation"
+	"github.com/adyzng/GoSymbols/restful"
+	"github.com/adyzng/GoSymbols/restful/auth"
+	"github.com/adyzng/GoSymbols/symbol"
+	"github.com/gorilla/mux"
+
+	log "gopkg.in/clog.v1"
+)
+
+const (
+	maxExistsKeys = 1000
+	maxGapKeys    = 20000
+)
+
+// SymbolsExist response to batch existence check api
+//	[:]/api/symbols/exists [POST]
+//
+//	@:BODY	{keys: [{name, hash}]}
+//
+//	@ return {
+//		RestResponse{Data: []*restful.SymbolExists}
+//	}
+//
+func SymbolsExist(w http.ResponseWriter, r *http.Request) {
+	var req struct {
+		Keys []restful.SymbolKey `json:"keys"`
+	}
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		log.Error(2, "[Restful] Decode request body failed: %v.", err)
+		w.WriteHeader(http.StatusBadRequest)
+		return
+	}
+
+	resp := restful.RestResponse{}
+	if len(req.Keys) > maxExistsKeys {
+		resp.ErrCodeMsg = restful.ErrInvalidParam
+		resp.Message = fmt.Sprintf("at most %d keys each request", maxExistsKeys)
+		resp.WriteJSON(w)
+		return
+	}
+
+	ss := symbol.GetServer()
+	result := make([]*restful.SymbolExists, 0, len(req.Keys))
+	for _, key := range req.Keys {
+		item := &restful.SymbolExists{SymbolKey: key}
+		if key.Name != "" && key.Hash != "" {
+			if f := ss.FindSymbol(key.Name, key.Hash); f != nil {
+				item.Exists = true
+				item.Branch = f.Builder.Name()
+				item.Size = f.Info.Size()
+				item.ETag = f.ETag(key.Hash)
+				item.URL = config.ExternalURL(fmt.Sprintf("/api/symbol/%s/%s/%s", item.Branch, key.Hash, key.Name))
+			}
+		}
+		result = append(result, item)
+	}
+
+	if fed := federation.Get(); fed.Enabled() && !federation.IsForwarded(r) {
+		lookupPeers(fed, result)
+	}
+
+	log.Trace("[Restful] Check existence of %d symbols.", len(result))
+	resp.Data = result
+	resp.WriteJSON(w)
+}
+
+// lookupPeers check the keys not found on local store against federation peers
+func lookupPeers(fed *federation.Federation, result []*restful.SymbolExists) {
+	missing := make(map[restful.SymbolKey]*restful.SymbolExists)
+	var keys []restful.SymbolKey
+	for _, item := range result {
+		if !item.Exists && item.Name != "" && item.Hash != "" {
+			missing[item.SymbolKey] = item
+			keys = append(keys, item.SymbolKey)
+		}
+	}
+	if len(keys) == 0 {
+		return
+	}
+
+	body := map[string]interface{}{"keys": keys}
+	fed.Query("POST", "/api/symbols/exists", body, func(peer *federation.Peer, data json.RawMessage) error {
+		var found []*restful.SymbolExists
+		if err := json.Unmarshal(data, &found); err != nil {
+			log.Warn("[Restful] Decode exists result of %s failed: %v.", peer.URL, err)
+			return nil
+		}
+		for _, f := range found {
+			// peers are queried in config order, keep the first hit
+			if item, ok := missing[f.SymbolKey]; ok && f.Exists && !item.Exists {
+				*item = *f
+			}
+		}
+		return nil
+	})
+}
+
+// SymbolGaps response to gap reconciliation api, the keys a customer's debugger failed
+// to resolve are checked against the store
+//	[:]/api/symbols/gaps?format=csv [POST]
+//
+//	@:BODY		{csv of name,hash rows (or symbol server paths), or json {keys: [{name, hash}]}}
+//	@:format	{optional, csv to download the report as csv}
+//
+//	@ return {
+//		RestResponse{Data: *symbol.GapReport}
+//	}
+//
+func SymbolGaps(w http.ResponseWriter, r *http.Request) {
+	var keys []symbol.SymbolKeyRef
+	var err error
+	if strings.HasPrefix(r.Header.Get("Content-Type"), "application/json") {
+		var req struct {
+			Keys []symbol.SymbolKeyRef `json:"keys"`
+		}
+		err = json.NewDecoder(r.Body).Decode(&req)
+		keys = req.Keys
+	} else {
+		keys, err = symbol.ParseKeyList(r.Body)
+	}
+
+	resp := restful.RestResponse{}
+	if err != nil {
+		log.Error(2, "[Restful] Decode key list failed: %v.", err)
+		resp.ErrCodeMsg = restful.ErrInvalidParam
+		resp.Message = fmt.Sprintf("%s", err)
+		resp.WriteJSON(w)
+		return
+	}
+	if len(keys) > maxGapKeys {
+		resp.ErrCodeMsg = restful.ErrInvalidParam
+		resp.Message = fmt.Sprintf("at most %d keys each request", maxGapKeys)
+		resp.WriteJSON(w)
+		return
+	}
+
+	report := symbol.GetServer().ReconcileKeys(keys)
+	if r.URL.Query().Get("format") != "csv" {
+		resp.Data = report
+		resp.WriteJSON(w)
+		return
+	}
+	w.Header().Set("Content-Type", "text/csv; charset=UTF-8")
+	w.Header().Set("Content-Disposition", "attachment; filename=\"gaps.csv\"")
+	cw := csv.NewWriter(w)
+	cw.Write([]string{"name", "hash", "status", "branch", "build", "version", "date", "hint"})
+	for _, e := range report.Entries {
+		var build, version, date string
+		if len(e.Builds) > 0 {
+			last := e.Builds[len(e.Builds)-1]
+			build, version, date = last.Key, last.Version, last.Date
+		}
+		cw.Write([]string{e.Name, e.Hash, e.Status, e.Branch, build, version, date, e.Hint})
+	}
+	cw.Flush()
+}
+
+// SearchSymbols response to symbol search api across all branches
+//	[:]/api/symbols/search?name=vddk*.pdb&hash=&arch=x64&version=&branch=&limit=100 [GET]
+//
+//	@:name		{symbol name, `*` matches any}
+//	@:hash		{symbol hash, name or hash is required}
+//	@:arch		{optional, x64 or x86}
+//	@:version	{optional, build version, `*` matches any}
+//	@:branch	{optional, branch name}
+//	@:limit		{optional, default 100, at most 1000}
+//
+//	@ return {
+//		RestResponse{Data: *symbol.SymbolResult}
+//	}
+//
+func SearchSymbols(w http.ResponseWriter, r *http.Request) {
+	query := r.URL.Query()
+	q := &symbol.SymbolQuery{
+		Name:    query.Get("name"),
+		Hash:    query.Get("hash"),
+		Arch:    query.Get("arch"),
+		Version: query.Get("version"),
+		Branch:  query.Get("branch"),
+		Allow: func(branch string) bool {
+			return auth.BranchAllowed(r, branch)
+		},
+	}
+	q.Limit, _ = strconv.Atoi(query.Get("limit"))
+
+	resp := restful.RestResponse{}
+	res, err := symbol.GetServer().SearchSymbols(r.Context(), q)
+	if err != nil {
+		resp.ErrCodeMsg = restful.ErrInvalidParam
+		resp.Message = fmt.Sprintf("%s", err)
+		resp.WriteJSON(w)
+		return
+	}
+	resp.Data = res
+	resp.WriteJSON(w)
+}
+
+// RestSymbolCache response to symbol cache api, how many symbols of recently browsed
+// builds are kept in memory, and the hits and evictions
+//	[:]/api/symbols/cache [GET]
+//
+//	@ return {
+//		RestResponse{Data: *symbol.TxCacheStats}
+//	}
+//
+func RestSymbolCache(w http.ResponseWriter, r *http.Request) {
+	resp := restful.RestResponse{
+		Data: symbol.GetServer().SymbolCache(),
+	}
+	resp.WriteJSON(w)
+}
+
+// WhoShips response to reverse lookup api, every branch and build shipping a symbol
+//	[:]/api/symbols/{name}/branches [GET]
+//
+//	@:name	{symbol file name, eg: vddkwrapper.pdb}
+//
+//	@ return {
+//		RestResponse{Data: []*symbol.Shipment}
+//	}
+//
+func WhoShips(w http.ResponseWriter, r *http.Request) {
+	name := mux.Vars(r)["name"]
+	resp := restful.RestResponse{}
+	if name == "" || strings.ContainsAny(name, "\\/") {
+		resp.ErrCodeMsg = restful.ErrInvalidParam
+		resp.WriteJSON(w)
+		return
+	}
+	resp.Data = symbol.GetServer().WhoShips(name)
+	resp.WriteJSON(w)
+}
@@ -0,0 +1,22 @@
+package v1
+
+import (
+	"net/http"
+
+	"github.com/adyzng/GoSymbols/federation"
+	"github.com/adyzng/GoSymbols/restful"
+)
+
+// RestFederationPeers response to federation peers api
+//	[:]/api/federation/peers [GET]
+//
+//	@ return {
+//		RestResponse{Data: []federation.Peer}
+//	}
+//
+func RestFederationPeers(w http.ResponseWriter, r *http.Request) {
+	resp := restful.RestResponse{
+		Data: federation.Get().Peers(),
+	}
+	resp.WriteJSON(w)
+}
@@ -0,0 +1,47 @@
+package v1
+
+import (
+	"encoding/json"
+	"net/http"
+
+	"github.com/adyzng/GoSymbols/restful/graph"
+
+	log "gopkg.in/clog.v1"
+)
+
+// GraphQL response to graphql api, the response is standard graphql json instead of RestResponse.
+//	[:]/api/graphql [POST]
+//
+//	@:BODY	{query: "{ branch(name: \"UDPMAIN\") { builds(last: 10) { id version symbolsCount } } }",
+//			 operationName: "", variables: {}}
+//
+//	@ return {
+//		data: {}, errors: []
+//	}
+//
+func GraphQL(w http.ResponseWriter, r *http.Request) {
+	var req struct {
+		Query         string                 `json:"query"`
+		OperationName string                 `json:"operationName"`
+		Variables     map[string]interface{} `json:"variables"`
+	}
+	body := http.MaxBytesReader(w, r.Body, graph.MaxQueryLen*2)
+	if err := json.NewDecoder(body).Decode(&req); err != nil {
+		log.Error(2, "[Restful] Decode graphql request failed: %v.", err)
+		w.WriteHeader(http.StatusBadRequest)
+		return
+	}
+	if len(req.Query) > graph.MaxQueryLen {
+		log.Warn("[Restful] GraphQL query too long: %d bytes.", len(req.Query))
+		w.WriteHeader(http.StatusRequestEntityTooLarge)
+		return
+	}
+
+	ctx := graph.WithBudget(r.Context())
+	resp := graph.Schema.Exec(ctx, req.Query, req.OperationName, req.Variables)
+	if len(resp.Errors) > 0 {
+		log.Warn("[Restful] GraphQL query failed: %v.", resp.Errors)
+	}
+	w.Header().Set("Content-Type", "application/json; charset=utf-8")
+	json.NewEncoder(w).Encode(resp)
+}
@@ -0,0 +1,82 @@
+package v1
+
+import (
+	"encoding/json"
+	"fmt"
+	"net/http"
+
+	"github.com/adyzng/GoSymbols/restful"
+	"github.com/adyzng/GoSymbols/symbol"
+	"github.com/gorilla/mux"
+
+	log "gopkg.in/clog.v1"
+)
+
+// RestLegalHolds response to legal hold report api, all builds currently under hold
+//	[:]/api/holds [GET]
+//
+//	@ return {
+//		RestResponse{Data: []*symbol.Hold}
+//	}
+//
+func RestLegalHolds(w http.ResponseWriter, r *http.Request) {
+	resp := restful.RestResponse{
+		Data: symbol.GetServer().LegalHolds(),
+	}
+	resp.WriteJSON(w)
+}
+
+// PlaceHold response to legal hold api, hold or release given build
+//	[:]/api/branches/{name}/{bid}/hold [POST, DELETE]
+//
+//	@:name	{branch name}
+//	@:bid	{build id}
+//	@:BODY	{reason: "case 2018-017", owner: "legal@company.com"} only for POST
+//
+//	@ return {
+//		RestResponse{Data: symbol.Hold}
+//	}
+//
+func PlaceHold(w http.ResponseWriter, r *http.Request) {
+	_, token := loginRequired(r)
+	if token == nil {
+		w.WriteHeader(http.StatusUnauthorized)
+		log.Warn("[Restful] Login required.")
+		return
+	}
+
+	var req struct {
+		Reason string `json:"reason"`
+		Owner  string `json:"owner"`
+	}
+	if r.Method == http.MethodPost {
+		if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+			log.Error(2, "[Restful] Decode request body failed: %v.", err)
+			w.WriteHeader(http.StatusBadRequest)
+			return
+		}
+	}
+
+	vars := mux.Vars(r)
+	resp := restful.RestResponse{}
+	b, ok := symbol.GetServer().Get(vars["name"]).(*symbol.BrBuilder)
+	if !ok {
+		resp.ErrCodeMsg = restful.ErrUnknownBranch
+		resp.WriteJSON(w)
+		return
+	}
+
+	var err error
+	if r.Method == http.MethodDelete {
+		log.Info("[Restful] User %s release hold of build %s of %s.", token.UserName, vars["bid"], b.Name())
+		err = b.ReleaseHold(vars["bid"], token.UserName)
+	} else {
+		log.Info("[Restful] User %s hold build %s of %s.", token.UserName, vars["bid"], b.Name())
+		resp.Data, err = b.PlaceHold(vars["bid"], req.Reason, req.Owner, token.UserName)
+	}
+	if err != nil {
+		resp.ErrCodeMsg = restful.ErrInvalidParam
+		resp.Message = fmt.Sprintf("%s", err)
+	}
+	resp.WriteJSON(w)
+}
@@ -0,0 +1,110 @@
+package v1
+
+import (
+	"fmt"
+	"io/ioutil"
+	"net/http"
+	"strings"
+
+	"github.com/adyzng/GoSymbols/activity"
+	"github.com/adyzng/GoSymbols/cihook"
+	"github.com/adyzng/GoSymbols/config"
+	"github.com/adyzng/GoSymbols/restful"
+	"github.com/adyzng/GoSymbols/restful/auth"
+	"github.com/adyzng/GoSymbols/symbol"
+
+	log "gopkg.in/clog.v1"
+)
+
+const maxHookPayload = 4 << 20 // github payloads embed the whole workflow run
+
+// hookBranch return the branch built by CI `job`, the one of the same build or store name.
+func hookBranch(job string) string {
+	name := ""
+	symbol.GetServer().WalkBuilders(func(bu symbol.Builder) error {
+		b := storeBuilder(bu)
+		if b != nil && name == "" && (strings.EqualFold(b.BuildName, job) || strings.EqualFold(b.StoreName, job)) {
+			name = b.StoreName
+		}
+		return nil
+	})
+	return name
+}
+
+// CIWebhook response to build notifications of Jenkins, TeamCity and GitHub Actions, the
+// finished and succeeded build is queued for ingest on the branch mapped by `[hooks] RULES`.
+//	[:]/api/v1/hooks [POST]
+//
+//	@:BODY		{webhook payload of the CI system}
+//
+//	@ return {
+//		RestResponse{Data: restful.HookResult}
+//	}
+//
+func CIWebhook(w http.ResponseWriter, r *http.Request) {
+	body, err := ioutil.ReadAll(http.MaxBytesReader(w, r.Body, maxHookPayload))
+	if err != nil {
+		log.Error(2, "[Restful] Read webhook payload failed: %v.", err)
+		w.WriteHeader(http.StatusBadRequest)
+		return
+	}
+
+	// CI systems sign with the shared secret, without one the hook is an api call
+	user := "webhook"
+	if config.HookSecret != "" {
+		if !cihook.Verify(r, body) {
+			log.Warn("[Restful] Webhook from %s with invalid secret.", r.RemoteAddr)
+			writeUnauthorized(w)
+			return
+		}
+	} else if user = apiUser(r); user == "" {
+		writeUnauthorized(w)
+		return
+	} else if auth.RolesEnabled() && !auth.Grants(auth.RoleOf(auth.Authenticate(r)), auth.RoleUploader) {
+		resp := restful.RestResponse{ErrCodeMsg: restful.ErrUnauthorized}
+		resp.WriteStatus(w, http.StatusForbidden)
+		return
+	}
+
+	resp := restful.RestResponse{}
+	build, err := cihook.Parse(r.Header, body)
+	if err != nil {
+		log.Warn("[Restful] Parse webhook payload failed: %v.", err)
+		resp.ErrCodeMsg = restful.ErrInvalidParam
+		resp.Message = fmt.Sprintf("%s", err)
+		resp.WriteStatus(w, http.StatusBadRequest)
+		return
+	}
+	result := &restful.HookResult{Build: build}
+	resp.Data = result
+	if !build.Success {
+		// started, queued or failed builds are acknowledged so CI don't retry them
+		log.Trace("[Restful] Ignore %s build %s #%s (%s).", build.System, build.Job, build.Number, build.Status)
+		resp.WriteJSON(w)
+		return
+	}
+
+	result.Branch = cihook.Branch(build, hookBranch)
+	if result.Branch == "" {
+		log.Warn("[Restful] No branch for %s job %s.", build.System, build.Job)
+		resp.ErrCodeMsg = restful.ErrUnknownBranch
+		resp.WriteStatus(w, http.StatusNotFound)
+		return
+	}
+	result.Job, err = symbol.GetServer().Enqueue(result.Branch, build.Number, symbol.PriorityDefault)
+	switch err {
+	case nil:
+	case symbol.ErrBranchNotInit:
+		resp.ErrCodeMsg = restful.ErrUnknownBranch
+		resp.WriteStatus(w, http.StatusNotFound)
+		return
+	default:
+		resp.ErrCodeMsg = restful.ErrServerInner
+		resp.Message = fmt.Sprintf("%s", err)
+		resp.WriteStatus(w, http.StatusServiceUnavailable)
+		return
+	}
+	log.Info("[Restful] %s job %s trigger branch %s build %s by %s.", build.System, build.Job, result.Branch, build.Number, user)
+	activity.Annotate(r, activity.KindIngest, result.Branch, build.Number)
+	resp.WriteStatus(w, http.StatusAccepted)
+}
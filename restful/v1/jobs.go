@@ -0,0 +1,91 @@
+package v1
+
+import (
+	"fmt"
+	"net/http"
+
+	"github.com/adyzng/GoSymbols/restful"
+	"github.com/adyzng/GoSymbols/symbol"
+	"github.com/gorilla/mux"
+	log "gopkg.in/clog.v1"
+)
+
+// RestJobs response to ingest jobs api, for the web UI to show ingest progress
+//	[:]/api/jobs?branch=&status=running [GET]
+//
+//	@:branch	{optional, branch name, empty for all}
+//	@:status	{optional, queued, running, succeeded, failed or canceled}
+//
+//	@ return {
+//		RestResponse{Data: []*symbol.Job}
+//	}
+//
+func RestJobs(w http.ResponseWriter, r *http.Request) {
+	query := r.URL.Query()
+	resp := restful.RestResponse{
+		Data: symbol.GetServer().Jobs(query.Get("branch"), symbol.JobStatus(query.Get("status"))),
+	}
+	resp.WriteJSON(w)
+}
+
+// RestJob response to ingest job api, status and stage of one job
+//	[:]/api/jobs/{id} [GET]
+//
+//	@:id	{job id returned by trigger}
+//
+//	@ return {
+//		RestResponse{Data: symbol.Job}
+//	}
+//
+func RestJob(w http.ResponseWriter, r *http.Request) {
+	resp := restful.RestResponse{}
+	job := symbol.GetServer().GetJob(mux.Vars(r)["id"])
+	if job == nil {
+		resp.ErrCodeMsg = restful.ErrInvalidParam
+		resp.Message = fmt.Sprintf("%s", symbol.ErrJobNotFound)
+		resp.WriteStatus(w, http.StatusNotFound)
+		return
+	}
+	resp.Data = job
+	resp.WriteJSON(w)
+}
+
+// CancelJob response to cancel ingest job api. A queued job is removed, a running one stops
+// at its next stage unless it's already storing symbols.
+//	[:]/api/jobs/{id} [DELETE]
+//
+//	@:id	{job id returned by trigger}
+//
+//	@ return {
+//		RestResponse{Data: symbol.Job}
+//	}
+//
+func CancelJob(w http.ResponseWriter, r *http.Request) {
+	_, token := loginRequired(r)
+	if token == nil {
+		w.WriteHeader(http.StatusUnauthorized)
+		log.Warn("[Restful] Login required.")
+		return
+	}
+
+	id := mux.Vars(r)["id"]
+	resp := restful.RestResponse{}
+	job, err := symbol.GetServer().CancelJob(id)
+	switch err {
+	case nil:
+	case symbol.ErrJobNotFound:
+		resp.ErrCodeMsg = restful.ErrInvalidParam
+		resp.Message = fmt.Sprintf("%s", err)
+		resp.WriteStatus(w, http.StatusNotFound)
+		return
+	default:
+		resp.ErrCodeMsg = restful.ErrInvalidParam
+		resp.Message = fmt.Sprintf("%s", err)
+		resp.Data = job
+		resp.WriteStatus(w, http.StatusConflict)
+		return
+	}
+	log.Info("[Restful] User %s cancel job %s of branch %s.", token.UserName, id, job.Branch)
+	resp.Data = job
+	resp.WriteJSON(w)
+}
@@ -0,0 +1,46 @@
+package v1
+
+import (
+	"fmt"
+	"net/http"
+
+	"github.com/adyzng/GoSymbols/restful"
+	"github.com/adyzng/GoSymbols/symbol"
+	"github.com/gorilla/mux"
+
+	log "gopkg.in/clog.v1"
+)
+
+// MigrateLayout response to convert store of branch to two-tier layout in the server, so
+// symbols keep being served from both layouts while folders are moved.
+//	[:]/api/branches/{name}/layout?dryRun=true [POST]
+//
+//	@:name		{branch name}
+//	@:dryRun	{optional, only count the folders to move}
+//
+//	@ return {
+//		RestResponse{Data: symbol.MigrateReport}
+//	}
+//
+func MigrateLayout(w http.ResponseWriter, r *http.Request) {
+	user := apiUser(r)
+	if user == "" {
+		writeUnauthorized(w)
+		return
+	}
+
+	bname := mux.Vars(r)["name"]
+	dryRun := r.URL.Query().Get("dryRun") == "true"
+	resp := restful.RestResponse{}
+	log.Info("[Restful] User %s migrate layout of branch %s, dry run %v.", user, bname, dryRun)
+	report, err := symbol.GetServer().MigrateLayout(bname, dryRun)
+	switch {
+	case err == symbol.ErrBranchNotInit:
+		resp.ErrCodeMsg = restful.ErrUnknownBranch
+	case err != nil:
+		resp.ErrCodeMsg = restful.ErrServerInner
+		resp.Message = fmt.Sprintf("%s", err)
+	}
+	resp.Data = report
+	resp.WriteJSON(w)
+}
@@ -3,7 +3,10 @@ package v1
 import (
 	"fmt"
 	"net/http"
+	"strings"
+	"time"
 
+	"github.com/adyzng/GoSymbols/config"
 	"github.com/adyzng/GoSymbols/restful"
 	"github.com/adyzng/GoSymbols/restful/auth"
 	"github.com/adyzng/GoSymbols/restful/session"
@@ -27,9 +30,9 @@ func loginRequired(r *http.Request) (string, *auth.GraphToken) {
 //	[:]/auth/login
 //
 func AuthLogin(w http.ResponseWriter, r *http.Request) {
-	redirect := "/"
+	redirect := config.URL("/")
 	if _, token := loginRequired(r); token == nil {
-		redirect = auth.AuthURL()
+		redirect = auth.AuthURL(r.FormValue("remember") != "")
 	} else {
 		log.Info("[Login] User %s already logined.", token.UserName)
 	}
@@ -54,7 +57,8 @@ func AuthLogout(w http.ResponseWriter, r *http.Request) {
 			log.Info("[Logout] user %s.", token.UserName)
 		}
 	}
-	w.Header().Set("Location", "/")
+	setSessionCookies(w, "", "", -1)
+	w.Header().Set("Location", config.URL("/"))
 	w.WriteHeader(http.StatusFound)
 }
 
@@ -87,23 +91,44 @@ func Authorize(w http.ResponseWriter, r *http.Request) {
 		return
 	}
 
-	sessID := session.GetManager().Create(token)
+	remember := strings.HasSuffix(state, auth.StateRemember)
+	sessID := session.GetManager().Create(token, remember)
 	if user, _ := auth.GetUserProfile("", token); user != nil {
 		token.UserName = user.DisplayName
 		log.Info("[Login] User (%s) login succeed.", user.DisplayName)
 	}
 
-	// set http cookie
+	// browser session cookie unless remembered, server side idle timeout apply
+	maxAge := 0
+	if remember {
+		maxAge = int(session.Lifetime(true) / time.Second)
+	}
+	setSessionCookies(w, sessID, session.GetManager().CSRFToken(sessID), maxAge)
+
+	w.Header().Set("Location", config.URL("/"))
+	w.WriteHeader(http.StatusFound)
+}
+
+// setSessionCookies set session id and its csrf token, `maxAge` < 0 to delete them
+func setSessionCookies(w http.ResponseWriter, sessID, csrf string, maxAge int) {
 	http.SetCookie(w, &http.Cookie{
 		Name:     session.CookieSessID,
-		MaxAge:   int(session.CookieMaxAge),
-		HttpOnly: false,
+		MaxAge:   maxAge,
+		HttpOnly: true,
+		Secure:   config.SessionSecure,
+		SameSite: http.SameSiteLaxMode,
 		Value:    sessID,
 		Path:     "/",
 	})
-
-	w.Header().Set("Location", "/")
-	w.WriteHeader(http.StatusFound)
+	// readable by the web ui to echo back in header
+	http.SetCookie(w, &http.Cookie{
+		Name:     session.CookieCSRF,
+		MaxAge:   maxAge,
+		Secure:   config.SessionSecure,
+		SameSite: http.SameSiteStrictMode,
+		Value:    csrf,
+		Path:     "/",
+	})
 }
 
 // GetUserProfile get user information
@@ -0,0 +1,74 @@
+package v1
+
+import (
+	"encoding/json"
+	"fmt"
+	"net/http"
+
+	"github.com/adyzng/GoSymbols/restful"
+	"github.com/adyzng/GoSymbols/symbol"
+
+	log "gopkg.in/clog.v1"
+)
+
+// RestDuplicateBranches response to duplicate branches api, branches sharing build path
+//	[:]/api/branches/duplicates [GET]
+//
+//	@ return {
+//		RestResponse{Data: []*symbol.DuplicateGroup}
+//	}
+//
+func RestDuplicateBranches(w http.ResponseWriter, r *http.Request) {
+	resp := restful.RestResponse{
+		Data: symbol.GetServer().FindDuplicates(),
+	}
+	resp.WriteJSON(w)
+}
+
+// MergeBranch response to merge branch api, consolidate builds of `from` into `into`.
+// The report of conflicting versions is returned along with the error.
+//	[:]/api/branches/merge?preview=true [POST]
+//
+//	@:BODY		{from: "UDPv6.5", into: "UDPv6.5U1", dryRun: true}
+//	@:preview	{optional, the same as dryRun}
+//
+//	@ return {
+//		RestResponse{Data: symbol.MergeReport}
+//	}
+//
+func MergeBranch(w http.ResponseWriter, r *http.Request) {
+	user := apiUser(r)
+	if user == "" {
+		writeUnauthorized(w)
+		return
+	}
+
+	var req struct {
+		From   string `json:"from"`
+		Into   string `json:"into"`
+		DryRun bool   `json:"dryRun"`
+	}
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		log.Error(2, "[Restful] Decode request body failed: %v.", err)
+		w.WriteHeader(http.StatusBadRequest)
+		return
+	}
+
+	req.DryRun = req.DryRun || preview(r)
+	resp := restful.RestResponse{}
+	if !req.DryRun {
+		log.Info("[Restful] User %s merge branch %s into %s.", user, req.From, req.Into)
+	}
+	report, err := symbol.GetServer().MergeBranch(req.From, req.Into, user, req.DryRun)
+	if err != nil {
+		resp.ErrCodeMsg = restful.ErrInvalidParam
+		resp.Message = fmt.Sprintf("%s", err)
+		if err == symbol.ErrMergeConflict {
+			resp.Data = report
+		}
+		resp.WriteJSON(w)
+		return
+	}
+	resp.Data = report
+	resp.WriteJSON(w)
+}
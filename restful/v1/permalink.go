@@ -0,0 +1,80 @@
+package v1
+
+import (
+	"encoding/json"
+	"fmt"
+	"net/http"
+
+	"github.com/adyzng/GoSymbols/config"
+	"github.com/adyzng/GoSymbols/restful"
+	"github.com/adyzng/GoSymbols/symbol"
+	"github.com/gorilla/mux"
+
+	log "gopkg.in/clog.v1"
+)
+
+// CreatePermalink response to create permalink api
+//	[:]/api/permalinks [POST]
+//
+//	@:BODY	{kind: build|symbol|search, branch, build, name, hash, query}
+//
+//	@ return {
+//		RestResponse{Data: restful.PermalinkInfo}
+//	}
+//
+func CreatePermalink(w http.ResponseWriter, r *http.Request) {
+	var req symbol.Permalink
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		log.Error(2, "[Restful] Decode request body failed: %v.", err)
+		w.WriteHeader(http.StatusBadRequest)
+		return
+	}
+
+	_, token := loginRequired(r)
+	if token == nil {
+		w.WriteHeader(http.StatusUnauthorized)
+		log.Warn("[Restful] Login required.")
+		return
+	}
+	req.Creator = token.UserName
+
+	resp := restful.RestResponse{}
+	link, err := symbol.GetServer().CreatePermalink(&req)
+	if err != nil {
+		resp.ErrCodeMsg = restful.ErrInvalidParam
+		resp.Message = fmt.Sprintf("%s", err)
+		resp.WriteJSON(w)
+		return
+	}
+	resp.Data = restful.PermalinkInfo{
+		Permalink: link,
+		URL:       config.ExternalURL("/p/" + link.ID),
+	}
+	resp.WriteJSON(w)
+}
+
+// ResolvePermalink response to resolve permalink api
+//	[:]/api/permalinks/{id} [GET]
+//
+//	@:id	{permalink id}
+//
+//	@ return {
+//		RestResponse{Data: restful.PermalinkInfo}
+//	}
+//
+func ResolvePermalink(w http.ResponseWriter, r *http.Request) {
+	resp := restful.RestResponse{}
+	link, target, err := symbol.GetServer().ResolvePermalink(mux.Vars(r)["id"])
+	if err != nil {
+		resp.ErrCodeMsg = restful.ErrInvalidParam
+		resp.Message = fmt.Sprintf("%s", err)
+		resp.WriteJSON(w)
+		return
+	}
+	resp.Data = restful.PermalinkInfo{
+		Permalink: link,
+		URL:       config.ExternalURL("/p/" + link.ID),
+		Target:    target,
+	}
+	resp.WriteJSON(w)
+}
@@ -0,0 +1,165 @@
+package v1
+
+import (
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"strconv"
+
+	"github.com/adyzng/GoSymbols/audit"
+	"github.com/adyzng/GoSymbols/restful"
+	"github.com/adyzng/GoSymbols/symbol"
+	"github.com/gorilla/mux"
+
+	log "gopkg.in/clog.v1"
+)
+
+// PurgeSymbols response to bulk symbol delete api. Without token it's a dry run that
+// return the matched symbols and a token, post again with the token to execute.
+//	[:]/api/branches/{name}/purge?preview=true [POST]
+//
+//	@:name		{branch name}
+//	@:preview	{optional, plan again even with token}
+//	@:BODY		{patterns: ["ca_*.pdb"], from: "500", to: "520", token: ""}
+//
+//	@ return {
+//		RestResponse{Data: symbol.PurgePlan}
+//	}
+//
+func PurgeSymbols(w http.ResponseWriter, r *http.Request) {
+	user := apiUser(r)
+	if user == "" {
+		writeUnauthorized(w)
+		return
+	}
+
+	var req struct {
+		symbol.PurgeOption
+		Token string `json:"token"`
+	}
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		log.Error(2, "[Restful] Decode request body failed: %v.", err)
+		w.WriteHeader(http.StatusBadRequest)
+		return
+	}
+
+	vars := mux.Vars(r)
+	resp := restful.RestResponse{}
+	b, ok := symbol.GetServer().Get(vars["name"]).(*symbol.BrBuilder)
+	if !ok {
+		resp.ErrCodeMsg = restful.ErrUnknownBranch
+		resp.WriteJSON(w)
+		return
+	}
+
+	var (
+		err  error
+		plan *symbol.PurgePlan
+	)
+	if req.Token == "" || preview(r) {
+		plan, err = b.PlanPurge(req.PurgeOption)
+	} else {
+		log.Info("[Restful] User %s execute purge %s of %s.", user, req.Token, b.Name())
+		plan, err = b.ExecutePurge(req.Token, user)
+	}
+	if err != nil {
+		resp.ErrCodeMsg = restful.ErrInvalidParam
+		resp.Message = fmt.Sprintf("%s", err)
+		resp.WriteJSON(w)
+		return
+	}
+	resp.Data = plan
+	resp.WriteJSON(w)
+}
+
+// RestAuditList response to audit log api
+//	[:]/api/audit?n=50&branch= [GET]
+//
+//	@ return {
+//		RestResponse{Data: []*audit.Entry}
+//	}
+//
+func RestAuditList(w http.ResponseWriter, r *http.Request) {
+	if _, token := loginRequired(r); token == nil {
+		w.WriteHeader(http.StatusUnauthorized)
+		log.Warn("[Restful] Login required.")
+		return
+	}
+
+	n, _ := strconv.Atoi(r.URL.Query().Get("n"))
+	resp := restful.RestResponse{}
+	entries, err := audit.Recent(n, r.URL.Query().Get("branch"))
+	if err != nil {
+		log.Error(2, "[Restful] Read audit log failed: %v.", err)
+		resp.ErrCodeMsg = restful.ErrServerInner
+		resp.Message = fmt.Sprintf("%s", err)
+	}
+	resp.Data = entries
+	resp.WriteJSON(w)
+}
+
+// VerifyBranch response to integrity check api of admin files
+//	[:]/api/branches/{name}/verify [GET]
+//
+//	@:name	{branch name}
+//
+//	@ return {
+//		RestResponse{Data: symbol.VerifyReport}
+//	}
+//
+func VerifyBranch(w http.ResponseWriter, r *http.Request) {
+	vars := mux.Vars(r)
+	resp := restful.RestResponse{}
+	b, ok := symbol.GetServer().Get(vars["name"]).(*symbol.BrBuilder)
+	if !ok {
+		resp.ErrCodeMsg = restful.ErrUnknownBranch
+		resp.WriteJSON(w)
+		return
+	}
+
+	report, err := b.Verify()
+	if err != nil {
+		resp.ErrCodeMsg = restful.ErrServerInner
+		resp.Message = fmt.Sprintf("%s", err)
+		resp.WriteJSON(w)
+		return
+	}
+	resp.Data = report
+	resp.WriteJSON(w)
+}
+
+// ReindexBranch response to rebuild metadata of branch from its 000Admin files and store
+// tree, when branch.bin is lost or the metadata database is restored from an old backup.
+//	[:]/api/branches/{name}/reindex [POST]
+//
+//	@:name	{branch name}
+//
+//	@ return {
+//		RestResponse{Data: symbol.ReindexReport}
+//	}
+//
+func ReindexBranch(w http.ResponseWriter, r *http.Request) {
+	user := apiUser(r)
+	if user == "" {
+		writeUnauthorized(w)
+		return
+	}
+
+	vars := mux.Vars(r)
+	resp := restful.RestResponse{}
+	b, ok := symbol.GetServer().Get(vars["name"]).(*symbol.BrBuilder)
+	if !ok {
+		resp.ErrCodeMsg = restful.ErrUnknownBranch
+		resp.WriteJSON(w)
+		return
+	}
+
+	log.Info("[Restful] User %s reindex branch %s.", user, b.Name())
+	report, err := b.Reindex()
+	if err != nil {
+		resp.ErrCodeMsg = restful.ErrServerInner
+		resp.Message = fmt.Sprintf("%s", err)
+	}
+	resp.Data = report
+	resp.WriteJSON(w)
+}
@@ -0,0 +1,137 @@
+package v1
+
+import (
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"strconv"
+
+	"github.com/adyzng/GoSymbols/restful"
+	"github.com/adyzng/GoSymbols/symbol"
+	"github.com/gorilla/mux"
+
+	log "gopkg.in/clog.v1"
+)
+
+// StartRecompress response to recompress api, migrate stored files of the branch to
+// compressed files in background, least downloaded and oldest builds first.
+//	[:]/api/branches/{name}/recompress [POST]
+//
+//	@:name		{branch name}
+//	@:BODY		{limit, rate}
+//
+//	@ return {
+//		RestResponse{Data: symbol.RecompressProgress}
+//	}
+//
+func StartRecompress(w http.ResponseWriter, r *http.Request) {
+	_, token := loginRequired(r)
+	if token == nil {
+		w.WriteHeader(http.StatusUnauthorized)
+		log.Warn("[Restful] Login required.")
+		return
+	}
+
+	bname := mux.Vars(r)["name"]
+	resp := restful.RestResponse{}
+
+	var opt symbol.RecompressOption
+	if r.ContentLength != 0 {
+		if err := json.NewDecoder(r.Body).Decode(&opt); err != nil {
+			log.Error(2, "[Restful] Decode request body failed: %v.", err)
+			w.WriteHeader(http.StatusBadRequest)
+			return
+		}
+	}
+
+	progress, err := symbol.GetServer().Recompress(bname, opt)
+	if err != nil {
+		log.Warn("[Restful] Recompress branch %s failed: %v.", bname, err)
+		resp.ErrCodeMsg = restful.ErrInvalidBranch
+		resp.Message = fmt.Sprintf("%s", err)
+		resp.WriteJSON(w)
+		return
+	}
+	log.Info("[Restful] User %s start recompress branch %s.", token.UserName, bname)
+	resp.Data = progress
+	resp.WriteJSON(w)
+}
+
+// GetRecompress response to recompress progress api
+//	[:]/api/branches/{name}/recompress [GET]
+//
+//	@:name		{branch name}
+//
+//	@ return {
+//		RestResponse{Data: symbol.RecompressProgress}
+//	}
+//
+func GetRecompress(w http.ResponseWriter, r *http.Request) {
+	bname := mux.Vars(r)["name"]
+	resp := restful.RestResponse{}
+
+	if progress := symbol.GetServer().RecompressProgress(bname); progress != nil {
+		resp.Data = progress
+	} else {
+		resp.ErrCodeMsg = restful.ErrInvalidParam
+		resp.Message = "no recompress task"
+	}
+	resp.WriteJSON(w)
+}
+
+// PauseRecompress response to pause or resume recompress api
+//	[:]/api/branches/{name}/recompress/pause?pause=false [POST]
+//
+//	@:name		{branch name}
+//	@:pause		{false to resume, default true}
+//
+//	@ return {
+//		RestResponse
+//	}
+//
+func PauseRecompress(w http.ResponseWriter, r *http.Request) {
+	_, token := loginRequired(r)
+	if token == nil {
+		w.WriteHeader(http.StatusUnauthorized)
+		log.Warn("[Restful] Login required.")
+		return
+	}
+
+	bname := mux.Vars(r)["name"]
+	pause, err := strconv.ParseBool(r.URL.Query().Get("pause"))
+	if err != nil {
+		pause = true
+	}
+	resp := restful.RestResponse{}
+	if !symbol.GetServer().PauseRecompress(bname, pause) {
+		resp.ErrCodeMsg = restful.ErrInvalidParam
+		resp.Message = "no running recompress task"
+	}
+	resp.WriteJSON(w)
+}
+
+// StopRecompress response to stop recompress api, files compressed so far are kept
+//	[:]/api/branches/{name}/recompress [DELETE]
+//
+//	@:name		{branch name}
+//
+//	@ return {
+//		RestResponse
+//	}
+//
+func StopRecompress(w http.ResponseWriter, r *http.Request) {
+	_, token := loginRequired(r)
+	if token == nil {
+		w.WriteHeader(http.StatusUnauthorized)
+		log.Warn("[Restful] Login required.")
+		return
+	}
+
+	bname := mux.Vars(r)["name"]
+	resp := restful.RestResponse{}
+	if !symbol.GetServer().StopRecompress(bname) {
+		resp.ErrCodeMsg = restful.ErrInvalidParam
+		resp.Message = "no running recompress task"
+	}
+	resp.WriteJSON(w)
+}
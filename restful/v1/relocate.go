@@ -0,0 +1,92 @@
+package v1
+
+import (
+	"encoding/json"
+	"fmt"
+	"net/http"
+
+	"github.com/adyzng/GoSymbols/restful"
+	"github.com/adyzng/GoSymbols/symbol"
+
+	log "gopkg.in/clog.v1"
+)
+
+// BeginCutover response to start relocation cutover api, stores are read-only and ingest
+// is paused until the cutover ends, so they can be copied to the new store root.
+//	[:]/api/relocation/cutover [POST]
+//
+//	@:BODY		{to}
+//
+//	@ return {
+//		RestResponse{Data: symbol.Cutover}
+//	}
+//
+func BeginCutover(w http.ResponseWriter, r *http.Request) {
+	_, token := loginRequired(r)
+	if token == nil {
+		w.WriteHeader(http.StatusUnauthorized)
+		log.Warn("[Restful] Login required.")
+		return
+	}
+
+	var req struct {
+		To string `json:"to"`
+	}
+	if r.ContentLength != 0 {
+		if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+			log.Error(2, "[Restful] Decode request body failed: %v.", err)
+			w.WriteHeader(http.StatusBadRequest)
+			return
+		}
+	}
+
+	resp := restful.RestResponse{}
+	c, err := symbol.GetServer().BeginCutover(token.UserName, req.To)
+	if err != nil {
+		resp.ErrCodeMsg = restful.ErrInvalidParam
+		resp.Message = fmt.Sprintf("%s", err)
+	}
+	resp.Data = c
+	resp.WriteJSON(w)
+}
+
+// GetCutover response to relocation cutover api
+//	[:]/api/relocation/cutover [GET]
+//
+//	@ return {
+//		RestResponse{Data: symbol.Cutover}
+//	}
+//
+func GetCutover(w http.ResponseWriter, r *http.Request) {
+	resp := restful.RestResponse{}
+	if c := symbol.GetServer().Cutover(); c != nil {
+		resp.Data = c
+	} else {
+		resp.ErrCodeMsg = restful.ErrInvalidParam
+		resp.Message = "no relocation cutover"
+	}
+	resp.WriteJSON(w)
+}
+
+// EndCutover response to end relocation cutover api, stores are writable again
+//	[:]/api/relocation/cutover [DELETE]
+//
+//	@ return {
+//		RestResponse
+//	}
+//
+func EndCutover(w http.ResponseWriter, r *http.Request) {
+	_, token := loginRequired(r)
+	if token == nil {
+		w.WriteHeader(http.StatusUnauthorized)
+		log.Warn("[Restful] Login required.")
+		return
+	}
+
+	resp := restful.RestResponse{}
+	if err := symbol.GetServer().EndCutover(token.UserName); err != nil {
+		resp.ErrCodeMsg = restful.ErrInvalidParam
+		resp.Message = fmt.Sprintf("%s", err)
+	}
+	resp.WriteJSON(w)
+}
@@ -0,0 +1,43 @@
+package v1
+
+import (
+	"net/http"
+	"strconv"
+	"time"
+
+	"github.com/adyzng/GoSymbols/report"
+	"github.com/adyzng/GoSymbols/restful"
+
+	log "gopkg.in/clog.v1"
+)
+
+// RestReport response to store report api, html page by default
+//	[:]/api/report?days=7&format=json [GET]
+//
+//	@:days		{optional, report period until now, default 7}
+//	@:format	{optional, json to get RestResponse{Data: report.Report}}
+//
+//	@ return text/html
+//
+func RestReport(w http.ResponseWriter, r *http.Request) {
+	days, _ := strconv.Atoi(r.URL.Query().Get("days"))
+	if days <= 0 {
+		days = 7
+	}
+	now := time.Now()
+	rp := report.Generate(now.AddDate(0, 0, -days), now)
+
+	if r.URL.Query().Get("format") == "json" {
+		resp := restful.RestResponse{Data: rp}
+		resp.WriteJSON(w)
+		return
+	}
+	data, err := rp.HTML()
+	if err != nil {
+		log.Error(2, "[Restful] Render report failed: %v.", err)
+		w.WriteHeader(http.StatusInternalServerError)
+		return
+	}
+	w.Header().Set("Content-Type", "text/html; charset=utf-8")
+	w.Write(data)
+}
@@ -0,0 +1,83 @@
+package v1
+
+import (
+	"fmt"
+	"net/http"
+
+	"github.com/adyzng/GoSymbols/restful"
+	"github.com/adyzng/GoSymbols/symbol"
+	"github.com/gorilla/mux"
+
+	log "gopkg.in/clog.v1"
+)
+
+// RestRetention response to retention preview api, the builds next scheduled pruning delete
+//	[:]/api/branches/{name}/retention [GET]
+//
+//	@:name	{branch name}
+//
+//	@ return {
+//		RestResponse{Data: symbol.RetentionPlan}
+//	}
+//
+func RestRetention(w http.ResponseWriter, r *http.Request) {
+	vars := mux.Vars(r)
+	resp := restful.RestResponse{}
+	b, ok := symbol.GetServer().Get(vars["name"]).(*symbol.BrBuilder)
+	if !ok {
+		resp.ErrCodeMsg = restful.ErrUnknownBranch
+		resp.WriteJSON(w)
+		return
+	}
+	plan, err := b.PlanRetention()
+	if err != nil {
+		log.Error(2, "[Restful] Retention of %s failed: %v.", b.Name(), err)
+		resp.ErrCodeMsg = restful.ErrInvalidParam
+		resp.Message = fmt.Sprintf("%s", err)
+		resp.WriteJSON(w)
+		return
+	}
+	resp.Data = plan
+	resp.WriteJSON(w)
+}
+
+// PruneBranch response to prune api, delete expired builds now instead of next cycle
+//	[:]/api/branches/{name}/retention?preview=true [POST]
+//
+//	@:name		{branch name}
+//	@:preview	{optional, the builds it would delete, the same as GET}
+//
+//	@ return {
+//		RestResponse{Data: symbol.RetentionPlan}
+//	}
+//
+func PruneBranch(w http.ResponseWriter, r *http.Request) {
+	user := apiUser(r)
+	if user == "" {
+		writeUnauthorized(w)
+		return
+	}
+
+	vars := mux.Vars(r)
+	resp := restful.RestResponse{}
+	b, ok := symbol.GetServer().Get(vars["name"]).(*symbol.BrBuilder)
+	if !ok {
+		resp.ErrCodeMsg = restful.ErrUnknownBranch
+		resp.WriteJSON(w)
+		return
+	}
+	if preview(r) {
+		RestRetention(w, r)
+		return
+	}
+	log.Info("[Restful] User %s prune branch %s.", user, b.Name())
+	plan, err := b.Prune(user)
+	if err != nil {
+		resp.ErrCodeMsg = restful.ErrInvalidParam
+		resp.Message = fmt.Sprintf("%s", err)
+		resp.WriteJSON(w)
+		return
+	}
+	resp.Data = plan
+	resp.WriteJSON(w)
+}
@@ -0,0 +1,32 @@
+package v1
+
+import (
+	"net/http"
+
+	"github.com/adyzng/GoSymbols/restful"
+	"github.com/adyzng/GoSymbols/symbol"
+
+	log "gopkg.in/clog.v1"
+)
+
+// RestQuarantine response to quarantine api, files detected by the ingest scanner
+//	[:]/api/quarantine?branch= [GET]
+//
+//	@:branch	{only the branch}
+//
+//	@ return {
+//		RestResponse{Data: []*symbol.QuarantinedFile}
+//	}
+//
+func RestQuarantine(w http.ResponseWriter, r *http.Request) {
+	_, token := loginRequired(r)
+	if token == nil {
+		w.WriteHeader(http.StatusUnauthorized)
+		log.Warn("[Restful] Login required.")
+		return
+	}
+	resp := restful.RestResponse{
+		Data: symbol.GetServer().Quarantined(r.URL.Query().Get("branch")),
+	}
+	resp.WriteJSON(w)
+}
@@ -0,0 +1,30 @@
+package v1
+
+import (
+	"net/http"
+	"strconv"
+
+	"github.com/adyzng/GoSymbols/restful"
+	"github.com/adyzng/GoSymbols/symbol"
+)
+
+// RestSchedule response to schedule api, upcoming update cycles for calendar view
+//	[:]/api/schedule?n=10&branch= [GET]
+//
+//	@:n			{count of upcoming cycles, default 10}
+//	@:branch	{only the branch}
+//
+//	@ return {
+//		RestResponse{Data: symbol.Schedule}
+//	}
+//
+func RestSchedule(w http.ResponseWriter, r *http.Request) {
+	n, _ := strconv.Atoi(r.URL.Query().Get("n"))
+	if n > 500 {
+		n = 500
+	}
+	resp := restful.RestResponse{
+		Data: symbol.GetServer().Schedule(r.URL.Query().Get("branch"), n),
+	}
+	resp.WriteJSON(w)
+}
@@ -0,0 +1,100 @@
+package v1
+
+import (
+	"encoding/json"
+	"fmt"
+	"net/http"
+
+	"github.com/adyzng/GoSymbols/restful"
+	"github.com/adyzng/GoSymbols/symbol"
+	"github.com/gorilla/mux"
+
+	log "gopkg.in/clog.v1"
+)
+
+// SealBranch response to seal api, the branch become immutable until unsealed
+//	[:]/api/branches/{name}/seal [POST]
+//
+//	@:name	{branch name}
+//	@:BODY	{reason: "legal hold", readOnly: true}
+//
+//	@ return {
+//		RestResponse{Data: symbol.Seal}
+//	}
+//
+func SealBranch(w http.ResponseWriter, r *http.Request) {
+	_, token := loginRequired(r)
+	if token == nil {
+		w.WriteHeader(http.StatusUnauthorized)
+		log.Warn("[Restful] Login required.")
+		return
+	}
+
+	var req struct {
+		Reason   string `json:"reason"`
+		ReadOnly bool   `json:"readOnly"`
+	}
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		log.Error(2, "[Restful] Decode request body failed: %v.", err)
+		w.WriteHeader(http.StatusBadRequest)
+		return
+	}
+
+	vars := mux.Vars(r)
+	resp := restful.RestResponse{}
+	b, ok := symbol.GetServer().Get(vars["name"]).(*symbol.BrBuilder)
+	if !ok {
+		resp.ErrCodeMsg = restful.ErrUnknownBranch
+		resp.WriteJSON(w)
+		return
+	}
+
+	log.Info("[Restful] User %s seal branch %s.", token.UserName, b.Name())
+	seal, err := b.Seal(token.UserName, req.Reason, req.ReadOnly)
+	if err != nil {
+		resp.ErrCodeMsg = restful.ErrInvalidParam
+		resp.Message = fmt.Sprintf("%s", err)
+		resp.WriteJSON(w)
+		return
+	}
+	symbol.GetServer().SaveBranchs("")
+	resp.Data = seal
+	resp.WriteJSON(w)
+}
+
+// UnsealBranch response to unseal api
+//	[:]/api/branches/{name}/seal [DELETE]
+//
+//	@:name	{branch name}
+//
+//	@ return {
+//		RestResponse{}
+//	}
+//
+func UnsealBranch(w http.ResponseWriter, r *http.Request) {
+	_, token := loginRequired(r)
+	if token == nil {
+		w.WriteHeader(http.StatusUnauthorized)
+		log.Warn("[Restful] Login required.")
+		return
+	}
+
+	vars := mux.Vars(r)
+	resp := restful.RestResponse{}
+	b, ok := symbol.GetServer().Get(vars["name"]).(*symbol.BrBuilder)
+	if !ok {
+		resp.ErrCodeMsg = restful.ErrUnknownBranch
+		resp.WriteJSON(w)
+		return
+	}
+
+	log.Info("[Restful] User %s unseal branch %s.", token.UserName, b.Name())
+	if err := b.Unseal(token.UserName); err != nil {
+		resp.ErrCodeMsg = restful.ErrInvalidParam
+		resp.Message = fmt.Sprintf("%s", err)
+		resp.WriteJSON(w)
+		return
+	}
+	symbol.GetServer().SaveBranchs("")
+	resp.WriteJSON(w)
+}
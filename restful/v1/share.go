@@ -0,0 +1,22 @@
+package v1
+
+import (
+	"net/http"
+
+	"github.com/adyzng/GoSymbols/restful"
+	"github.com/adyzng/GoSymbols/symbol"
+)
+
+// RestShareHealth response to build share health api
+//	[:]/api/shares [GET]
+//
+//	@ return {
+//		RestResponse{Data: []*symbol.ShareHealth}
+//	}
+//
+func RestShareHealth(w http.ResponseWriter, r *http.Request) {
+	resp := restful.RestResponse{
+		Data: symbol.GetServer().ShareHealth(),
+	}
+	resp.WriteJSON(w)
+}
@@ -0,0 +1,106 @@
+package v1
+
+import (
+	"encoding/json"
+	"fmt"
+	"net/http"
+
+	"github.com/adyzng/GoSymbols/restful"
+	"github.com/adyzng/GoSymbols/symbol"
+	"github.com/gorilla/mux"
+
+	log "gopkg.in/clog.v1"
+)
+
+// RestBuildSigning response to build signing status api
+//	[:]/api/branches/{name}/{bid}/signing [GET]
+//
+//	@:name	{branch name}
+//	@:bid	{build id}
+//
+//	@ return {
+//		RestResponse{Data: restful.BuildSigning}
+//	}
+//
+func RestBuildSigning(w http.ResponseWriter, r *http.Request) {
+	vars := mux.Vars(r)
+	resp := restful.RestResponse{}
+
+	b := storeBuilder(symbol.GetServer().Get(vars["name"]))
+	if b == nil {
+		resp.ErrCodeMsg = restful.ErrUnknownBranch
+		resp.WriteJSON(w)
+		return
+	}
+	if _, err := b.ParseBuilds(r.Context(), nil); err != nil {
+		log.Error(2, "[Restful] Parse builds for %s failed: %v.", b.Name(), err)
+	}
+
+	signs, err := b.Signing(vars["bid"])
+	if err != nil {
+		resp.ErrCodeMsg = restful.ErrInvalidParam
+		resp.Message = fmt.Sprintf("%s", err)
+		resp.WriteJSON(w)
+		return
+	}
+	data := restful.BuildSigning{
+		Build:    vars["bid"],
+		Binaries: signs,
+	}
+	for _, s := range signs {
+		if s.Blocker() {
+			data.Blockers++
+		}
+	}
+	resp.Data = data
+	resp.WriteJSON(w)
+}
+
+// MarkRelease response to mark release build api
+//	[:]/api/branches/{name}/{bid}/release [POST]
+//
+//	@:name	{branch name}
+//	@:bid	{build id}
+//	@:BODY	{release: bool}
+//
+//	@ return {
+//		RestResponse{Data: []*symbol.BinarySign unsigned or invalid binaries}
+//	}
+//
+func MarkRelease(w http.ResponseWriter, r *http.Request) {
+	_, token := loginRequired(r)
+	if token == nil {
+		w.WriteHeader(http.StatusUnauthorized)
+		log.Warn("[Restful] Login required.")
+		return
+	}
+
+	var req struct {
+		Release bool `json:"release"`
+	}
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		log.Error(2, "[Restful] Decode request body failed: %v.", err)
+		w.WriteHeader(http.StatusBadRequest)
+		return
+	}
+
+	vars := mux.Vars(r)
+	resp := restful.RestResponse{}
+	b, ok := symbol.GetServer().Get(vars["name"]).(*symbol.BrBuilder)
+	if !ok {
+		resp.ErrCodeMsg = restful.ErrUnknownBranch
+		resp.WriteJSON(w)
+		return
+	}
+
+	blockers, err := b.MarkRelease(vars["bid"], req.Release)
+	if err != nil {
+		resp.ErrCodeMsg = restful.ErrInvalidParam
+		resp.Message = fmt.Sprintf("%s", err)
+		resp.WriteJSON(w)
+		return
+	}
+	log.Info("[Restful] User %s mark build %s of %s release: %v.", token.UserName, vars["bid"], b.Name(), req.Release)
+	resp.Data = blockers
+	resp.WriteJSON(w)
+}
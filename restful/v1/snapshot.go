@@ -0,0 +1,78 @@
+package v1
+
+import (
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"time"
+
+	"github.com/adyzng/GoSymbols/restful"
+	"github.com/adyzng/GoSymbols/symbol"
+
+	log "gopkg.in/clog.v1"
+)
+
+// TakeSnapshot response to store snapshot api
+//	[:]/api/snapshot [POST]
+//
+//	@:BODY	{hold: seconds to keep writes frozen, 0 to resume at once}
+//
+//	@ return {
+//		RestResponse{Data: symbol.SnapshotMarker}
+//	}
+//
+func TakeSnapshot(w http.ResponseWriter, r *http.Request) {
+	_, token := loginRequired(r)
+	if token == nil {
+		w.WriteHeader(http.StatusUnauthorized)
+		log.Warn("[Restful] Login required.")
+		return
+	}
+
+	var req struct {
+		Hold int `json:"hold"`
+	}
+	if r.ContentLength != 0 {
+		if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+			log.Error(2, "[Restful] Decode request body failed: %v.", err)
+			w.WriteHeader(http.StatusBadRequest)
+			return
+		}
+	}
+
+	resp := restful.RestResponse{}
+	marker, err := symbol.GetServer().Snapshot(time.Duration(req.Hold) * time.Second)
+	if err != nil {
+		log.Error(2, "[Restful] Take snapshot failed: %v.", err)
+		resp.ErrCodeMsg = restful.ErrServerInner
+		resp.Message = fmt.Sprintf("%s", err)
+		resp.WriteJSON(w)
+		return
+	}
+	log.Info("[Restful] User %s take snapshot %s, hold %ds.", token.UserName, marker.ID, req.Hold)
+	resp.Data = marker
+	resp.WriteJSON(w)
+}
+
+// ReleaseSnapshot response to release snapshot api, resume store writes
+//	[:]/api/snapshot [DELETE]
+//
+//	@ return {
+//		RestResponse
+//	}
+//
+func ReleaseSnapshot(w http.ResponseWriter, r *http.Request) {
+	_, token := loginRequired(r)
+	if token == nil {
+		w.WriteHeader(http.StatusUnauthorized)
+		log.Warn("[Restful] Login required.")
+		return
+	}
+
+	resp := restful.RestResponse{}
+	if !symbol.GetServer().ReleaseSnapshot() {
+		resp.ErrCodeMsg = restful.ErrInvalidParam
+		resp.Message = "no snapshot hold"
+	}
+	resp.WriteJSON(w)
+}
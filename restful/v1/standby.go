@@ -0,0 +1,143 @@
+package v1
+
+import (
+	"crypto/subtle"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"os"
+
+	"github.com/adyzng/GoSymbols/config"
+	"github.com/adyzng/GoSymbols/restful"
+	"github.com/adyzng/GoSymbols/standby"
+	"github.com/adyzng/GoSymbols/symbol"
+	"github.com/gorilla/mux"
+
+	log "gopkg.in/clog.v1"
+)
+
+// standbyAuthorized check the request come from the other instance of the standby pair
+func standbyAuthorized(r *http.Request) bool {
+	token := r.Header.Get(standby.HeaderToken)
+	return config.StandbyToken != "" &&
+		subtle.ConstantTimeCompare([]byte(token), []byte(config.StandbyToken)) == 1
+}
+
+// RestStandby response to standby state api, role and epoch of this instance
+//	[:]/api/standby [GET]
+//
+//	@ return {
+//		RestResponse{Data: standby.State}
+//	}
+//
+func RestStandby(w http.ResponseWriter, r *http.Request) {
+	resp := restful.RestResponse{}
+	s := standby.Get()
+	if !s.Enabled() {
+		resp.ErrCodeMsg = restful.ErrInvalidParam
+		resp.Message = fmt.Sprintf("%s", standby.ErrDisabled)
+	} else {
+		resp.Data = s.State()
+	}
+	resp.WriteJSON(w)
+}
+
+// PromoteStandby response to promote api, make this instance the read-write primary
+// and fence the other one
+//	[:]/api/standby/promote [POST]
+//
+//	@ return {
+//		RestResponse{Data: standby.State}
+//	}
+//
+func PromoteStandby(w http.ResponseWriter, r *http.Request) {
+	_, token := loginRequired(r)
+	if token == nil {
+		w.WriteHeader(http.StatusUnauthorized)
+		log.Warn("[Restful] Login required.")
+		return
+	}
+
+	resp := restful.RestResponse{}
+	st, err := standby.Get().Promote(token.UserName)
+	if err != nil {
+		resp.ErrCodeMsg = restful.ErrInvalidParam
+		resp.Message = fmt.Sprintf("%s", err)
+	} else {
+		resp.Data = st
+	}
+	resp.WriteJSON(w)
+}
+
+// FenceStandby response to fence api, called by the promoted peer with its new epoch
+//	[:]/api/standby/fence [POST]
+//
+//	@:BODY		{epoch}
+//
+//	@ return {
+//		RestResponse
+//	}
+//
+func FenceStandby(w http.ResponseWriter, r *http.Request) {
+	if !standbyAuthorized(r) {
+		w.WriteHeader(http.StatusUnauthorized)
+		log.Warn("[Restful] Fence request without valid standby token from %s.", r.RemoteAddr)
+		return
+	}
+
+	var req struct {
+		Epoch int64 `json:"epoch"`
+	}
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		log.Error(2, "[Restful] Decode request body failed: %v.", err)
+		w.WriteHeader(http.StatusBadRequest)
+		return
+	}
+
+	resp := restful.RestResponse{}
+	if err := standby.Get().Fence(req.Epoch); err != nil {
+		resp.ErrCodeMsg = restful.ErrInvalidParam
+		resp.Message = fmt.Sprintf("%s", err)
+	}
+	resp.WriteJSON(w)
+}
+
+// RestStoreFile response to store file api, raw file listed by the sync manifest
+//	[:]/api/branches/{name}/file?path={relative path} [GET]
+//
+//	@:name		{branch name}
+//	@:path		{path relative to store, eg: 000Admin/server.txt}
+//
+//	@ return file
+//
+func RestStoreFile(w http.ResponseWriter, r *http.Request) {
+	if !standbyAuthorized(r) {
+		w.WriteHeader(http.StatusUnauthorized)
+		log.Warn("[Restful] Store file request without valid standby token from %s.", r.RemoteAddr)
+		return
+	}
+
+	b, ok := symbol.GetServer().Get(mux.Vars(r)["name"]).(*symbol.BrBuilder)
+	if !ok {
+		w.WriteHeader(http.StatusNotFound)
+		return
+	}
+	fpath, err := b.StoreFile(r.URL.Query().Get("path"))
+	if err != nil {
+		w.WriteHeader(http.StatusBadRequest)
+		return
+	}
+	fd, err := os.Open(fpath)
+	if err != nil {
+		w.WriteHeader(http.StatusNotFound)
+		return
+	}
+	defer fd.Close()
+	st, err := fd.Stat()
+	if err != nil || st.IsDir() {
+		w.WriteHeader(http.StatusNotFound)
+		return
+	}
+	w.Header().Set("Content-Type", "application/octet-stream")
+	http.ServeContent(w, r, st.Name(), st.ModTime(), fd)
+}
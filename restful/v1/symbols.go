@@ -1,53 +1,134 @@
 package v1
 
 import (
+	"context"
+	"encoding/base64"
+	"encoding/hex"
 	"encoding/json"
 	"fmt"
 	"io"
 	"net/http"
 	"os"
+	"strconv"
 	"strings"
 	"time"
 
+	"github.com/adyzng/GoSymbols/activity"
+	"github.com/adyzng/GoSymbols/audit"
+	"github.com/adyzng/GoSymbols/config"
+	"github.com/adyzng/GoSymbols/encrypt"
+	"github.com/adyzng/GoSymbols/federation"
+	"github.com/adyzng/GoSymbols/pdb"
+	"github.com/adyzng/GoSymbols/proxy"
+	"github.com/adyzng/GoSymbols/query"
 	"github.com/adyzng/GoSymbols/restful"
+	"github.com/adyzng/GoSymbols/restful/auth"
+	"github.com/adyzng/GoSymbols/site"
 	"github.com/adyzng/GoSymbols/symbol"
 	"github.com/gorilla/mux"
 
 	log "gopkg.in/clog.v1"
 )
 
+// storeBuilder return the store backed builder, include mounted archives
+func storeBuilder(bu symbol.Builder) *symbol.BrBuilder {
+	switch b := bu.(type) {
+	case *symbol.BrBuilder:
+		return b
+	case *symbol.ArchiveBuilder:
+		return b.BrBuilder
+	}
+	return nil
+}
+
 // RestBranchList response to restful API
-//	[:]/api/branches  [GET]
+//	[:]/api/branches?fields=&embed=latest  [GET]
+//
+//	@:fields	{optional, fields kept or omitted, eg: total,branchs.storeName or -branchs.storePath}
+//	@:embed		{optional, latest: the latest build of each branch}
 //
 //	@ return {
 //		Total: 		int
-//		Branchs: 	[]*symbol.Branch
+//		Branchs: 	[]*restful.BranchItem
 //	}
 //
 func RestBranchList(w http.ResponseWriter, r *http.Request) {
+	shape, err := restful.ParseShape(r, "latest")
+	if err != nil {
+		resp := restful.RestResponse{ErrCodeMsg: restful.ErrInvalidParam}
+		resp.Message = fmt.Sprintf("%s", err)
+		resp.WriteJSON(w)
+		return
+	}
+
 	bs := restful.BranchList{}
 	symbol.GetServer().WalkBuilders(func(bu symbol.Builder) error {
-		if b, ok := bu.(*symbol.BrBuilder); ok {
-			bs.Total++
-			nb := b.Branch
-			bs.Branchs = append(bs.Branchs, &nb)
+		b := storeBuilder(bu)
+		if b == nil {
+			return nil
 		}
+		bs.Total++
+		nb := b.Branch
+		item := &restful.BranchItem{Branch: &nb}
+		if shape.Embeds("latest") {
+			item.Latest = latestBuild(bu)
+		}
+		bs.Branchs = append(bs.Branchs, item)
 		return nil
 	})
+
+	// branches hold by peers, local one win if name collide
+	if fed := federation.Get(); fed.Enabled() && !federation.IsForwarded(r) {
+		for _, b := range fed.Branches() {
+			if symbol.GetServer().Get(b.StoreName) == nil {
+				bs.Total++
+				bs.Branchs = append(bs.Branchs, &restful.BranchItem{Branch: b})
+			}
+		}
+	}
 	resp := restful.RestResponse{
 		Data: &bs,
 	}
+	resp.Shape(shape)
 	resp.WriteJSON(w)
 }
 
+// latestBuild return the latest build of branch, supplementary transactions excluded
+func latestBuild(bu symbol.Builder) *symbol.Build {
+	var latest *symbol.Build
+	bu.ParseBuilds(context.Background(), func(build *symbol.Build) error {
+		if build.SupplementOf == "" && (latest == nil || build.ID > latest.ID) {
+			latest = build
+		}
+		return nil
+	})
+	return latest
+}
+
+// buildSymbols return symbols of build `bid`, nil if failed
+func buildSymbols(bu symbol.Builder, bid string) []*symbol.Symbol {
+	var syms []*symbol.Symbol
+	if _, err := bu.ParseSymbols(bid, func(sym *symbol.Symbol) error {
+		syms = append(syms, sym)
+		return nil
+	}); err != nil {
+		log.Error(2, "[Restful] Parse symbols for %s:%s failed: %v.", bu.Name(), bid, err)
+	}
+	return syms
+}
+
 // RestBuildList response to restful API
-//	[:]/api/branches/{name}  [GET]
+//	[:]/api/branches/{name}?asOf={transaction id|date}&q={filter}&fields=&embed=symbols  [GET]
 //
-//	@:name {branch name}
+//	@:name   {branch name}
+//	@:asOf   {optional, list builds as they were at given transaction or date}
+//	@:q      {optional, filter expression, eg: version>=4175 AND date>2024-01-01}
+//	@:fields {optional, fields kept or omitted, eg: builds.id,builds.status}
+//	@:embed  {optional, symbols: symbols of each build}
 //
 //	@return {
 //		Total: 		int
-//		Builds: 	[]*symbol.Build
+//		Builds: 	[]*restful.BuildItem
 //	}
 //
 func RestBuildList(w http.ResponseWriter, r *http.Request) {
@@ -56,22 +137,45 @@ func RestBuildList(w http.ResponseWriter, r *http.Request) {
 		ErrCodeMsg: restful.ErrInvalidParam,
 	}
 
+	filter, err := query.Parse(r.URL.Query().Get("q"), symbol.BuildFields)
+	if err != nil {
+		resp.Message = fmt.Sprintf("%s", err)
+		resp.WriteJSON(w)
+		return
+	}
+	shape, err := restful.ParseShape(r, "symbols")
+	if err != nil {
+		resp.Message = fmt.Sprintf("%s", err)
+		resp.WriteJSON(w)
+		return
+	}
 	if sname, ok := vars["name"]; ok {
 		builder := symbol.GetServer().Get(sname)
+		if asOf := r.URL.Query().Get("asOf"); asOf != "" && builder != nil {
+			restBuildsAsOf(w, builder, asOf, filter, shape)
+			return
+		}
 		if builder != nil {
 			blst := restful.BuildList{
 				Branch: sname,
 			}
-			_, err := builder.ParseBuilds(func(build *symbol.Build) error {
-				blst.Total++
-				blst.Builds = append(blst.Builds, build)
-				return nil
-			})
+			builds, err := builder.QueryBuilds(r.Context(), filter)
 			if err != nil {
 				log.Error(2, "[Restful] Parse builds for %s failed: %v.", sname, err)
 			}
+			builder.GetBranch().SortBuilds(builds)
+			for _, build := range builds {
+				blst.Total++
+				blst.Builds = append(blst.Builds, &restful.BuildItem{Build: build})
+			}
+			if shape.Embeds("symbols") {
+				for _, item := range blst.Builds {
+					item.Symbols = buildSymbols(builder, item.ID)
+				}
+			}
 			resp.Data = blst
 			resp.ErrCodeMsg = restful.ErrSucceed
+			resp.Shape(shape)
 		} else {
 			resp.ErrCodeMsg = restful.ErrUnknownBranch
 		}
@@ -80,10 +184,13 @@ func RestBuildList(w http.ResponseWriter, r *http.Request) {
 }
 
 // RestSymbolList response to restful API
-//	[:]/api/branches/:name/:bid  [GET]
+//	[:]/api/branches/:name/:bid?asOf={transaction id|date}&q={filter}  [GET]
 //
-//	@:name {branch name}
-//	@:bid  {build id}
+//	@:name   {branch name}
+//	@:bid    {build id}
+//	@:asOf   {optional, list symbols as they were at given transaction or date}
+//	@:q      {optional, filter expression, eg: arch=x64 AND name~ca_*}
+//	@:fields {optional, fields kept or omitted, eg: -symbols.path}
 //
 //	@ return {
 //		Total: 		int
@@ -96,25 +203,39 @@ func RestSymbolList(w http.ResponseWriter, r *http.Request) {
 		ErrCodeMsg: restful.ErrInvalidParam,
 	}
 
+	filter, err := query.Parse(r.URL.Query().Get("q"), symbol.SymbolFields)
+	if err != nil {
+		resp.Message = fmt.Sprintf("%s", err)
+		resp.WriteJSON(w)
+		return
+	}
+	shape, err := restful.ParseShape(r)
+	if err != nil {
+		resp.Message = fmt.Sprintf("%s", err)
+		resp.WriteJSON(w)
+		return
+	}
 	sname, bid := vars["name"], vars["bid"]
 	if sname != "" && bid != "" {
 		buider := symbol.GetServer().Get(sname)
+		if asOf := r.URL.Query().Get("asOf"); asOf != "" && buider != nil {
+			restSymbolsAsOf(w, buider, bid, asOf, filter, shape)
+			return
+		}
 		if buider != nil {
 			symLst := restful.SymbolList{
 				Branch: sname,
 				Build:  bid,
 			}
-			_, err := buider.ParseSymbols(bid, func(sym *symbol.Symbol) error {
-				symLst.Total++
-				symLst.Symbols = append(symLst.Symbols, sym)
-				return nil
-			})
+			syms, err := buider.QuerySymbols(r.Context(), bid, filter)
+			symLst.Total, symLst.Symbols = len(syms), syms
 			if err != nil {
 				log.Error(2, "[Restful] Parse symbols for %s:%s failed: %v.",
 					sname, bid, err)
 			}
 			resp.Data = symLst
 			resp.ErrCodeMsg = restful.ErrSucceed
+			resp.Shape(shape)
 		} else {
 			resp.ErrCodeMsg.Message = "no such build"
 		}
@@ -122,8 +243,71 @@ func RestSymbolList(w http.ResponseWriter, r *http.Request) {
 	resp.WriteJSON(w)
 }
 
+// RestBuildByKey response to build api by unique build key, version alone is ambiguous
+// across branches
+//	[:]/api/builds/{key}?q={filter}&fields=&embed=branch [GET]
+//
+//	@:key		{build key, eg: UDPv6.5U2@0000000012}
+//	@:q			{optional, filter expression of symbols}
+//	@:fields	{optional, fields kept or omitted, symbols are not loaded if omitted, eg: -symbols}
+//	@:embed		{optional, branch: the branch holding the build}
+//
+//	@ return {
+//		RestResponse{Data: restful.BuildDetail}
+//	}
+//
+func RestBuildByKey(w http.ResponseWriter, r *http.Request) {
+	resp := restful.RestResponse{}
+	filter, err := query.Parse(r.URL.Query().Get("q"), symbol.SymbolFields)
+	if err != nil {
+		resp.ErrCodeMsg = restful.ErrInvalidParam
+		resp.Message = fmt.Sprintf("%s", err)
+		resp.WriteJSON(w)
+		return
+	}
+	shape, err := restful.ParseShape(r, "branch")
+	if err != nil {
+		resp.ErrCodeMsg = restful.ErrInvalidParam
+		resp.Message = fmt.Sprintf("%s", err)
+		resp.WriteJSON(w)
+		return
+	}
+
+	b, build, err := symbol.GetServer().FindBuild(mux.Vars(r)["key"])
+	switch err {
+	case nil:
+	case symbol.ErrInvalidBuildKey:
+		resp.ErrCodeMsg = restful.ErrInvalidParam
+	case symbol.ErrBranchNotInit:
+		resp.ErrCodeMsg = restful.ErrUnknownBranch
+	default:
+		resp.ErrCodeMsg = restful.ErrInvalidParam
+	}
+	if err != nil {
+		resp.Message = fmt.Sprintf("%s", err)
+		resp.WriteJSON(w)
+		return
+	}
+
+	detail := restful.BuildDetail{Build: build}
+	if shape.Embeds("branch") {
+		nb := *b.GetBranch()
+		detail.Branch = &nb
+	}
+	if shape.Wants("symbols") || shape.Wants("total") {
+		detail.Symbols, err = b.QuerySymbols(r.Context(), build.ID, filter)
+		detail.Total = len(detail.Symbols)
+		if err != nil {
+			log.Error(2, "[Restful] Parse symbols of %s failed: %v.", build.Key, err)
+		}
+	}
+	resp.Data = detail
+	resp.Shape(shape)
+	resp.WriteJSON(w)
+}
+
 // DownloadSymbol response download symbol file api
-//	[:]/api/symbol/{branch}/{hash}/{name} [GET]
+//	[:]/api/symbol/{branch}/{hash}/{name} [GET, HEAD]
 //
 //	@:branch	{branch name}
 //	@:hash		{file hash}
@@ -143,6 +327,11 @@ func DownloadSymbol(w http.ResponseWriter, r *http.Request) {
 		w.WriteHeader(http.StatusNotFound)
 		return
 	}
+	if !pdb.HasExtension(fname, config.ServeExtensions) {
+		refuseServe(r, bname, hash, fname)
+		w.WriteHeader(http.StatusForbidden)
+		return
+	}
 
 	buider := symbol.GetServer().Get(bname)
 	if buider == nil {
@@ -151,30 +340,178 @@ func DownloadSymbol(w http.ResponseWriter, r *http.Request) {
 		w.WriteHeader(http.StatusNotFound)
 		return
 	}
+	sendSymbol(w, r, buider, bname, hash, fname)
+}
 
+// VirtualDirSymbol response symsrv request of branch exposed as an standalone symstore
+// share, so sympaths configured per branch (eg: srv*http://server/UDPMAIN) keep working.
+//	[:]/{dir}/{name}/{hash}/{file} [GET, HEAD]
+//
+//	@:dir		{virtual directory of branch}
+//	@:name		{file name}
+//	@:hash		{file hash}
+//	@:file		{file name, its compressed name or file.ptr}
+//
+//	@ return file
+//
+func VirtualDirSymbol(w http.ResponseWriter, r *http.Request) {
+	vars := mux.Vars(r)
+	dir := vars["dir"]
+	buider := symbol.GetServer().ByVirtualDir(dir)
+	if buider == nil {
+		log.Warn("[Restful] No branch at virtual directory %s.", dir)
+		w.WriteHeader(http.StatusNotFound)
+		return
+	}
+	serveSymSrv(w, r, []symbol.Builder{buider}, dir, vars["name"], vars["hash"], vars["file"])
+}
+
+// sendSymbol serve symbol file `hash`/`fname` of branch `buider`
+func sendSymbol(w http.ResponseWriter, r *http.Request, buider symbol.Builder, bname, hash, fname string) {
 	fpath := buider.GetSymbolPath(hash, fname)
-	fd, err := os.OpenFile(fpath, os.O_RDONLY, 666)
-	if err != nil {
-		log.Warn("[Restful] Open symbol file %s failed: %v.", fpath, err)
+	st, err := os.Stat(fpath)
+	if err != nil && !pdb.IsCompressed(fname) {
+		// stored compressed, eg: foo.pd_ of foo.pdb, it's expanded by sendFile
+		cpath := buider.GetSymbolPath(hash, pdb.CompressedName(fname))
+		if cst, cerr := os.Stat(cpath); cerr == nil {
+			fpath, st, err = cpath, cst, nil
+		}
+	}
+	if err != nil || st.IsDir() {
+		log.Warn("[Restful] Stat symbol file %s failed: %v.", fpath, err)
 		w.WriteHeader(http.StatusNotFound)
 		return
 	}
+	sendFile(w, r, buider, bname, hash, fname, fpath, st)
+}
+
+// sendFile serve file `fpath` as symbol `hash`/`fname` of branch `buider`
+func sendFile(w http.ResponseWriter, r *http.Request, buider symbol.Builder, bname, hash, fname, fpath string, st os.FileInfo) {
+	if !auth.BranchAllowed(r, buider.Name()) {
+		log.Warn("[Restful] Symbols of %s restricted, refuse %s.", buider.Name(), fpath)
+		w.WriteHeader(http.StatusForbidden)
+		return
+	}
+	fd, encrypted := openServed(w, r, buider, fpath)
+	if fd == nil {
+		return
+	}
 	defer fd.Close()
 
-	// set response header
+	// set response header, content is addressed by hash
+	sf := symbol.SymbolFile{Builder: buider, Path: fpath, Info: st}
+	if pdb.IsCompressed(fpath) && !pdb.IsCompressed(fname) {
+		sendExpanded(w, r, bname, hash, fname, fpath, sf.ETag(hash), encrypted, fd)
+		return
+	}
 	w.Header().Set("Content-Type", "application/octet-stream")
 	w.Header().Set("Content-Disposition", fmt.Sprintf("attachment; filename=\"%s\"", fname))
+	w.Header().Set("ETag", sf.ETag(hash))
+	cacheControl(w, encrypted)
+	if b := storeBuilder(buider); b != nil && !encrypted {
+		// checksum of encrypted file is taken on sealed content, not what is served
+		if sum, err := b.Checksum(fpath); err == nil {
+			w.Header().Set(proxy.HeaderChecksum, sum)
+			if raw, err := hex.DecodeString(sum); err == nil {
+				w.Header().Set("Digest", "SHA-256="+base64.StdEncoding.EncodeToString(raw))
+			}
+		} else if !os.IsNotExist(err) {
+			// file out of store (file.ptr) has no checksum
+			log.Warn("[Restful] Checksum of %s failed: %v.", fpath, err)
+		}
+	}
+
+	// serve HEAD, Range, If-Modified-Since and If-None-Match
+	if r.Method == "GET" {
+		activity.Annotate(r, activity.KindDownload, bname, hash+"/"+fname)
+	}
+	http.ServeContent(w, r, fname, st.ModTime(), fd)
+	log.Trace("[Restful] Send file complete. [%s %d: %s]", r.Method, st.Size(), fpath)
+}
+
+// openServed open stored file `fpath` of branch `buider` for serving its plain content. Files
+// of encrypted branch are decrypted and only served to login user, reported by `encrypted`.
+// Nil if refused or failed, the status is written then.
+func openServed(w http.ResponseWriter, r *http.Request, buider symbol.Builder, fpath string) (fd symbol.SymbolReader, encrypted bool) {
+	encrypted = encrypt.IsEncrypted(fpath) || buider.GetBranch().Encrypted
+	if encrypted {
+		if _, token := loginRequired(r); token == nil {
+			w.WriteHeader(http.StatusUnauthorized)
+			log.Warn("[Restful] Login required for encrypted symbol %s.", fpath)
+			return nil, encrypted
+		}
+	}
+	if b := storeBuilder(buider); b != nil {
+		content, _, err := b.OpenSymbol(fpath)
+		if err != nil {
+			log.Error(2, "[Restful] Open symbol file %s failed: %v.", fpath, err)
+			w.WriteHeader(http.StatusInternalServerError)
+			return nil, encrypted
+		}
+		return content, encrypted
+	}
+	content, err := os.Open(fpath)
+	if err != nil {
+		log.Warn("[Restful] Open symbol file %s failed: %v.", fpath, err)
+		w.WriteHeader(http.StatusNotFound)
+		return nil, encrypted
+	}
+	return content, encrypted
+}
+
+// cacheControl set Cache-Control of served symbol, decrypted content is never kept by proxies
+// or shared caches
+func cacheControl(w http.ResponseWriter, encrypted bool) {
+	if encrypted {
+		w.Header().Set("Cache-Control", "private, no-store")
+		return
+	}
+	w.Header().Set("Cache-Control", proxy.CacheControl)
+}
 
-	// send fil content
-	var size int64
-	if size, err = io.Copy(w, fd); err != nil {
-		log.Error(2, "[Restful] Send file failed: %v.", err)
+// sendExpanded serve the file packed in cab file `fpath` as symbol `hash`/`fname`, for clients
+// which don't expand compressed symbols. Range requests are not supported.
+func sendExpanded(w http.ResponseWriter, r *http.Request, bname, hash, fname, fpath, etag string, encrypted bool, fd io.ReadSeeker) {
+	cab, err := pdb.OpenCab(fd)
+	if err != nil {
+		log.Error(2, "[Restful] Expand symbol file %s failed: %v.", fpath, err)
 		w.WriteHeader(http.StatusInternalServerError)
 		return
 	}
+	w.Header().Set("ETag", etag)
+	cacheControl(w, encrypted)
+	if r.Header.Get("If-None-Match") == etag {
+		w.WriteHeader(http.StatusNotModified)
+		return
+	}
+	w.Header().Set("Content-Type", "application/octet-stream")
+	w.Header().Set("Content-Disposition", fmt.Sprintf("attachment; filename=\"%s\"", fname))
+	w.Header().Set("Content-Length", strconv.FormatInt(cab.Size, 10))
+	w.Header().Set("Last-Modified", cab.ModTime.UTC().Format(http.TimeFormat))
+	if r.Method != "GET" {
+		return
+	}
+	activity.Annotate(r, activity.KindDownload, bname, hash+"/"+fname)
+	n, err := io.Copy(w, cab)
+	if err != nil {
+		log.Warn("[Restful] Expand %s failed after %d bytes: %v.", fpath, n, err)
+		return
+	}
+	log.Trace("[Restful] Send expanded file complete. [%s %d: %s]", r.Method, n, fpath)
+}
 
-	//w.WriteHeader(http.StatusOK)
-	log.Trace("[Restful] Send file complete. [%d: %s]", size, fpath)
+// refuseServe audit download of file type not in `[serve] EXTENSIONS`
+func refuseServe(r *http.Request, bname, hash, fname string) {
+	user := activity.Anonymous
+	if _, token := loginRequired(r); token != nil {
+		user = token.UserName
+	}
+	client := r.RemoteAddr
+	if ip := site.Get().ClientIP(r); ip != nil {
+		client = ip.String()
+	}
+	log.Warn("[Restful] Refuse to serve %s/%s/%s to %s.", bname, hash, fname, client)
+	audit.Record(user, "refuse-serve", bname, "%s\\%s requested from %s, file type not allowed", fname, hash, client)
 }
 
 // ValidateBranch response to check branch api
@@ -213,15 +550,21 @@ func ValidateBranch(w http.ResponseWriter, r *http.Request) {
 }
 
 // ModifyBranch response to modify branch api
-//	[:]/api/branches/modify [POST]
+//	[:]/api/branches/modify?preview=true [POST]
 //
 //  @:BODY		{branch infomation}
+//	@:preview	{optional, return the changes without applying them}
 //
 //	@ return {
-//		RestResponse
+//		RestResponse{Data: symbol.ModifyPreview if preview}
 //	}
 //
 func ModifyBranch(w http.ResponseWriter, r *http.Request) {
+	user := apiUser(r)
+	if user == "" {
+		writeUnauthorized(w)
+		return
+	}
 	resp := restful.RestResponse{}
 	ss := symbol.GetServer()
 
@@ -231,12 +574,23 @@ func ModifyBranch(w http.ResponseWriter, r *http.Request) {
 		w.WriteHeader(http.StatusBadRequest)
 	}
 
+	if preview(r) {
+		pv, err := ss.PreviewModify(&branch)
+		if err != nil {
+			resp.ErrCodeMsg = restful.ErrInvalidBranch
+			resp.Message = fmt.Sprintf("%s", err)
+		}
+		resp.Data = pv
+		resp.WriteJSON(w)
+		return
+	}
 	if br := ss.Modify(&branch); br == nil {
 		log.Warn("[Restful] Modify invalid branch %v.", branch)
 		resp.ErrCodeMsg = restful.ErrInvalidBranch
 		resp.WriteJSON(w)
 		return
 	}
+	log.Info("[Restful] User %s modify branch %s.", user, branch.StoreName)
 	if err := ss.SaveBranchs(""); err != nil {
 		log.Warn("[Restful] Save branch (%v) failed: %v.", branch, err)
 	}
@@ -310,10 +664,9 @@ func FetchTodayMsg(w http.ResponseWriter, r *http.Request) {
 //	}
 //
 func CreateBranch(w http.ResponseWriter, r *http.Request) {
-	_, token := loginRequired(r)
-	if token == nil {
-		w.WriteHeader(http.StatusUnauthorized)
-		log.Warn("[Restful] Login required.")
+	user := apiUser(r)
+	if user == "" {
+		writeUnauthorized(w)
 		return
 	}
 	branch := symbol.Branch{}
@@ -334,15 +687,404 @@ func CreateBranch(w http.ResponseWriter, r *http.Request) {
 		resp.Message = fmt.Sprintf("path not accessable (%s)", branch.BuildPath)
 	} else {
 		// trigger add new build
-		go br.AddBuild("")
+		symbol.GetServer().Trigger(br.Name(), "", symbol.PriorityDefault)
 	}
 	if !br.CanBrowse() {
 		resp.Message = fmt.Sprintf("path not accessable (%s)", branch.StorePath)
 	}
-	log.Info("[Restful] User %s create branch %s.", token.UserName, br.Name())
+	log.Info("[Restful] User %s create branch %s.", user, br.Name())
 
 	if err := symbol.GetServer().SaveBranchs(""); err != nil {
 		log.Warn("[Restful] Save branch (%v) failed: %v.", branch, err)
 	}
 	resp.WriteJSON(w)
 }
+
+// TriggerBuild response to trigger ingest api
+//	[:]/api/branches/{name}/trigger [POST]
+//
+//	@:name		{branch name}
+//	@:BODY		{version, priority}
+//
+//	@ return {
+//		RestResponse{Data: symbol.Job}
+//	}
+//
+func TriggerBuild(w http.ResponseWriter, r *http.Request) {
+	user := apiUser(r)
+	if user == "" {
+		writeUnauthorized(w)
+		return
+	}
+
+	vars := mux.Vars(r)
+	bname := vars["name"]
+	resp := restful.RestResponse{}
+
+	req := restful.BuildTrigger{Priority: symbol.PriorityDefault}
+	if r.ContentLength != 0 {
+		if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+			log.Error(2, "[Restful] Decode request body failed: %v.", err)
+			w.WriteHeader(http.StatusBadRequest)
+			return
+		}
+	}
+
+	job, err := symbol.GetServer().Enqueue(bname, req.Version, req.Priority)
+	if err != nil {
+		log.Warn("[Restful] Trigger branch %s failed: %v.", bname, err)
+		resp.ErrCodeMsg = restful.ErrUnknownBranch
+		resp.Message = fmt.Sprintf("%s", err)
+		resp.WriteJSON(w)
+		return
+	}
+	log.Info("[Restful] User %s trigger branch %s build %s.", user, bname, req.Version)
+	activity.Annotate(r, activity.KindIngest, bname, req.Version)
+	resp.Data = job
+	resp.WriteJSON(w)
+}
+
+// StartBackfill response to backfill api, ingest all missing builds oldest first
+//	[:]/api/branches/{name}/backfill [POST]
+//
+//	@:name		{branch name}
+//	@:BODY		{limit, interval}
+//
+//	@ return {
+//		RestResponse{Data: symbol.BackfillProgress}
+//	}
+//
+func StartBackfill(w http.ResponseWriter, r *http.Request) {
+	user := apiUser(r)
+	if user == "" {
+		writeUnauthorized(w)
+		return
+	}
+
+	bname := mux.Vars(r)["name"]
+	resp := restful.RestResponse{}
+
+	var opt symbol.BackfillOption
+	if r.ContentLength != 0 {
+		if err := json.NewDecoder(r.Body).Decode(&opt); err != nil {
+			log.Error(2, "[Restful] Decode request body failed: %v.", err)
+			w.WriteHeader(http.StatusBadRequest)
+			return
+		}
+	}
+
+	progress, err := symbol.GetServer().Backfill(bname, opt)
+	if err != nil {
+		log.Warn("[Restful] Backfill branch %s failed: %v.", bname, err)
+		resp.ErrCodeMsg = restful.ErrInvalidBranch
+		resp.Message = fmt.Sprintf("%s", err)
+		resp.WriteJSON(w)
+		return
+	}
+	log.Info("[Restful] User %s start backfill branch %s.", user, bname)
+	activity.Annotate(r, activity.KindIngest, bname, "backfill")
+	resp.Data = progress
+	resp.WriteJSON(w)
+}
+
+// GetBackfill response to backfill progress api
+//	[:]/api/branches/{name}/backfill [GET]
+//
+//	@:name		{branch name}
+//
+//	@ return {
+//		RestResponse{Data: symbol.BackfillProgress}
+//	}
+//
+func GetBackfill(w http.ResponseWriter, r *http.Request) {
+	bname := mux.Vars(r)["name"]
+	resp := restful.RestResponse{}
+
+	if progress := symbol.GetServer().BackfillProgress(bname); progress != nil {
+		resp.Data = progress
+	} else {
+		resp.ErrCodeMsg = restful.ErrInvalidParam
+		resp.Message = "no backfill task"
+	}
+	resp.WriteJSON(w)
+}
+
+// RestServerBuilds response to build server listing api, pick a build to trigger
+//	[:]/api/branches/{name}/server-builds?missing=true [GET]
+//
+//	@:name		{branch name}
+//	@:missing	{only builds not ingested}
+//
+//	@ return {
+//		RestResponse{Data: []*symbol.ServerBuild}
+//	}
+//
+func RestServerBuilds(w http.ResponseWriter, r *http.Request) {
+	resp := restful.RestResponse{}
+	b, ok := symbol.GetServer().Get(mux.Vars(r)["name"]).(*symbol.BrBuilder)
+	if !ok {
+		resp.ErrCodeMsg = restful.ErrUnknownBranch
+		resp.WriteJSON(w)
+		return
+	}
+
+	var builds []*symbol.ServerBuild
+	var err error
+	if missing, _ := strconv.ParseBool(r.URL.Query().Get("missing")); missing {
+		builds, err = b.MissingBuilds()
+	} else {
+		builds, err = b.ServerBuilds()
+	}
+	if err != nil {
+		log.Warn("[Restful] List builds on build server of %s failed: %v.", b.Name(), err)
+		resp.ErrCodeMsg = restful.ErrServerInner
+		resp.Message = fmt.Sprintf("%s", err)
+		resp.WriteJSON(w)
+		return
+	}
+	resp.Data = builds
+	resp.WriteJSON(w)
+}
+
+// StopBackfill response to stop backfill api
+//	[:]/api/branches/{name}/backfill [DELETE]
+//
+//	@:name		{branch name}
+//
+//	@ return {
+//		RestResponse
+//	}
+//
+func StopBackfill(w http.ResponseWriter, r *http.Request) {
+	_, token := loginRequired(r)
+	if token == nil {
+		w.WriteHeader(http.StatusUnauthorized)
+		log.Warn("[Restful] Login required.")
+		return
+	}
+
+	bname := mux.Vars(r)["name"]
+	resp := restful.RestResponse{}
+	if !symbol.GetServer().StopBackfill(bname) {
+		resp.ErrCodeMsg = restful.ErrInvalidParam
+		resp.Message = "no running backfill task"
+	}
+	resp.WriteJSON(w)
+}
+
+// SupplementBuild response to supplement api, add selected pdbs to an exist build
+//	[:]/api/branches/{name}/supplement [POST]
+//
+//	@:name		{branch name}
+//	@:BODY		{version, files}
+//
+//	@ return {
+//		RestResponse{Data: symbol.Build}
+//	}
+//
+func SupplementBuild(w http.ResponseWriter, r *http.Request) {
+	user := apiUser(r)
+	if user == "" {
+		writeUnauthorized(w)
+		return
+	}
+
+	bname := mux.Vars(r)["name"]
+	resp := restful.RestResponse{}
+
+	var req restful.BuildSupplement
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		log.Error(2, "[Restful] Decode request body failed: %v.", err)
+		w.WriteHeader(http.StatusBadRequest)
+		return
+	}
+	if req.Version == "" || len(req.Files) == 0 {
+		resp.ErrCodeMsg = restful.ErrInvalidParam
+		resp.WriteJSON(w)
+		return
+	}
+
+	builder := symbol.GetServer().Get(bname)
+	if builder == nil {
+		resp.ErrCodeMsg = restful.ErrUnknownBranch
+		resp.WriteJSON(w)
+		return
+	}
+
+	build, err := builder.AddSupplement(req.Version, req.Files)
+	if err != nil {
+		log.Warn("[Restful] Supplement build %s:%s failed: %v.", bname, req.Version, err)
+		resp.ErrCodeMsg = restful.ErrServerInner
+		resp.Message = fmt.Sprintf("%s", err)
+		resp.WriteJSON(w)
+		return
+	}
+	log.Info("[Restful] User %s supplement build %s:%s with %v.",
+		user, bname, req.Version, req.Files)
+	activity.Annotate(r, activity.KindIngest, bname, req.Version)
+	resp.Data = build
+	resp.WriteJSON(w)
+}
+
+// RestSymbolHistory response to symbol history api, include superseded symbols
+//	[:]/api/branches/{name}/{bid}/history [GET]
+//
+//	@:name	{branch name}
+//	@:bid	{build id}
+//
+//	@ return {
+//		RestResponse{Data: restful.SymbolList}
+//	}
+//
+func RestSymbolHistory(w http.ResponseWriter, r *http.Request) {
+	vars := mux.Vars(r)
+	sname, bid := vars["name"], vars["bid"]
+	resp := restful.RestResponse{}
+
+	builder, ok := symbol.GetServer().Get(sname).(*symbol.BrBuilder)
+	if !ok {
+		resp.ErrCodeMsg = restful.ErrUnknownBranch
+		resp.WriteJSON(w)
+		return
+	}
+
+	syms, err := builder.SymbolHistory(bid)
+	if err != nil {
+		log.Error(2, "[Restful] Symbol history for %s:%s failed: %v.", sname, bid, err)
+		resp.ErrCodeMsg = restful.ErrInvalidParam
+		resp.Message = fmt.Sprintf("%s", err)
+		resp.WriteJSON(w)
+		return
+	}
+	resp.Data = restful.SymbolList{
+		Branch:  sname,
+		Build:   bid,
+		Total:   len(syms),
+		Symbols: syms,
+	}
+	resp.WriteJSON(w)
+}
+
+// RestSymbolSources response to pdb sources api, the source files of a stored pdb with
+// build machine paths translated to repository paths and their source server url
+//	[:]/api/branches/{name}/sources/{hash}/{file}?version= [GET]
+//
+//	@:name		{branch name}
+//	@:hash		{pdb hash}
+//	@:file		{pdb name}
+//	@:version	{optional, build whose revision the urls are of, default the first shipping it}
+//
+//	@ return {
+//		RestResponse{Data: symbol.SourceList}
+//	}
+//
+func RestSymbolSources(w http.ResponseWriter, r *http.Request) {
+	vars := mux.Vars(r)
+	bname, hash, file := vars["name"], vars["hash"], vars["file"]
+	resp := restful.RestResponse{}
+
+	builder, ok := symbol.GetServer().Get(bname).(*symbol.BrBuilder)
+	if !ok {
+		resp.ErrCodeMsg = restful.ErrUnknownBranch
+		resp.WriteStatus(w, http.StatusNotFound)
+		return
+	}
+	list, err := builder.Sources(hash, file, r.URL.Query().Get("version"))
+	if err != nil {
+		log.Warn("[Restful] Read sources of %s/%s in %s failed: %v.", hash, file, bname, err)
+		resp.ErrCodeMsg = restful.ErrInvalidParam
+		resp.Message = fmt.Sprintf("%s", err)
+		if os.IsNotExist(err) {
+			resp.WriteStatus(w, http.StatusNotFound)
+			return
+		}
+		resp.WriteJSON(w)
+		return
+	}
+	resp.Data = list
+	resp.WriteJSON(w)
+}
+
+// RestSyncManifest response to incremental sync manifest api
+//	[:]/api/branches/{name}/manifest?since={transaction id}&hash=1 [GET]
+//
+//	@:name		{branch name}
+//	@:since		{list files added after this transaction, empty for all}
+//	@:hash		{include sha256 of each file}
+//
+//	@ return {
+//		RestResponse{Data: symbol.SyncManifest}
+//	}
+//
+func RestSyncManifest(w http.ResponseWriter, r *http.Request) {
+	bname := mux.Vars(r)["name"]
+	query := r.URL.Query()
+	resp := restful.RestResponse{}
+
+	builder, ok := symbol.GetServer().Get(bname).(*symbol.BrBuilder)
+	if !ok {
+		resp.ErrCodeMsg = restful.ErrUnknownBranch
+		resp.WriteJSON(w)
+		return
+	}
+
+	withHash := query.Get("hash") == "1" || query.Get("hash") == "true"
+	m, err := builder.SyncManifest(query.Get("since"), withHash)
+	if err != nil {
+		log.Error(2, "[Restful] Sync manifest for %s failed: %v.", bname, err)
+		resp.ErrCodeMsg = restful.ErrServerInner
+		resp.Message = fmt.Sprintf("%s", err)
+		resp.WriteJSON(w)
+		return
+	}
+	resp.Data = m
+	resp.WriteJSON(w)
+}
+
+// SymbolChecksum response to symbol checksum api, the sidecar of download api
+//	[:]/api/symbol/{branch}/{hash}/{name}/checksum [GET]
+//
+//	@:branch	{branch name}
+//	@:hash		{file hash}
+//	@:name		{file name}
+//
+//	@ return {
+//		RestResponse{Data: {sha256, size}}
+//	}
+//
+func SymbolChecksum(w http.ResponseWriter, r *http.Request) {
+	vars := mux.Vars(r)
+	resp := restful.RestResponse{}
+
+	bu := symbol.GetServer().Get(vars["branch"])
+	b := storeBuilder(bu)
+	if b == nil {
+		resp.ErrCodeMsg = restful.ErrUnknownBranch
+		resp.WriteJSON(w)
+		return
+	}
+	if !auth.BranchAllowed(r, bu.Name()) {
+		w.WriteHeader(http.StatusForbidden)
+		return
+	}
+
+	// archive builder extract the file on first access
+	fpath := bu.GetSymbolPath(vars["hash"], vars["name"])
+	st, err := os.Stat(fpath)
+	if err != nil || st.IsDir() {
+		w.WriteHeader(http.StatusNotFound)
+		return
+	}
+	sum, err := b.Checksum(fpath)
+	if err != nil {
+		log.Error(2, "[Restful] Checksum of %s failed: %v.", fpath, err)
+		resp.ErrCodeMsg = restful.ErrServerInner
+		resp.WriteJSON(w)
+		return
+	}
+	resp.Data = map[string]interface{}{
+		"sha256": sum,
+		"size":   st.Size(),
+	}
+	resp.WriteJSON(w)
+}
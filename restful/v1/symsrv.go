@@ -0,0 +1,160 @@
+package v1
+
+import (
+	"fmt"
+	"io"
+	"net/http"
+	"os"
+	"strconv"
+	"strings"
+
+	"github.com/adyzng/GoSymbols/config"
+	"github.com/adyzng/GoSymbols/pdb"
+	"github.com/adyzng/GoSymbols/restful/auth"
+	"github.com/adyzng/GoSymbols/symbol"
+	"github.com/gorilla/mux"
+
+	log "gopkg.in/clog.v1"
+)
+
+const filePtr = "file.ptr"
+
+// Answers of `[serve] MISS` to file.ptr of symbols not found
+const (
+	missNotFound = "404"     // clean 404, what modern debuggers expect
+	missEmpty    = "empty"   // 200 with an empty file.ptr, expected by old internal tools
+	missMessage  = "message" // file.ptr of `MSG: ...`, symsrv print it and stop searching
+)
+
+// SymSrvSymbol response symsrv request of debuggers, so _NT_SYMBOL_PATH can point at the
+// service instead of an UNC share, eg: srv*C:\Symbols*http://server:8010/symbols. All
+// branches the client may access are searched.
+//	[:]/symbols/{name}/{hash}/{file} [GET, HEAD]
+//
+//	@:name		{file name}
+//	@:hash		{file hash}
+//	@:file		{file name, its compressed name or file.ptr}
+//
+//	@ return file
+//
+func SymSrvSymbol(w http.ResponseWriter, r *http.Request) {
+	vars := mux.Vars(r)
+	var builders []symbol.Builder
+	symbol.GetServer().WalkBuilders(func(b symbol.Builder) error {
+		// restricted branches are not searched for clients outside their groups
+		if auth.BranchAllowed(r, b.Name()) {
+			builders = append(builders, b)
+		}
+		return nil
+	})
+	serveSymSrv(w, r, builders, "symbols", vars["name"], vars["hash"], vars["file"])
+}
+
+// serveSymSrv serve `{name}/{hash}/{file}` from the first of `builders` holding it. The
+// debugger ask for the file, then its compressed name, then file.ptr. The file kept out of
+// store by file.ptr is redirected to if it's an url, or served if readable from here,
+// otherwise file.ptr is given to the debugger to follow itself.
+func serveSymSrv(w http.ResponseWriter, r *http.Request, builders []symbol.Builder, scope, name, hash, file string) {
+	ptr := strings.EqualFold(file, filePtr)
+	if !ptr && !strings.EqualFold(file, name) && !strings.EqualFold(file, pdb.CompressedName(name)) {
+		w.WriteHeader(http.StatusNotFound)
+		return
+	}
+	if !pdb.HasExtension(name, config.ServeExtensions) || (!ptr && !pdb.HasExtension(file, config.ServeExtensions)) {
+		refuseServe(r, scope, hash, file)
+		w.WriteHeader(http.StatusForbidden)
+		return
+	}
+
+	if !ptr {
+		for _, b := range builders {
+			fpath := b.GetSymbolPath(hash, file)
+			if st, err := os.Stat(fpath); err == nil && !st.IsDir() {
+				sendFile(w, r, b, b.Name(), hash, file, fpath, st)
+				return
+			}
+		}
+	}
+
+	for _, b := range builders {
+		fptr := symbol.PointerPath(b, hash, name)
+		target, msg, err := symbol.ReadPointer(fptr)
+		if os.IsNotExist(err) {
+			continue
+		}
+		if err != nil {
+			log.Warn("[Restful] Read %s failed: %v.", fptr, err)
+			continue
+		}
+
+		switch {
+		case ptr:
+			w.Header().Set("Content-Type", "text/plain")
+			http.ServeFile(w, r, fptr)
+		case msg != "" || !strings.EqualFold(file, name):
+			// message is shown by the debugger reading file.ptr, pointer is never compressed
+			w.WriteHeader(http.StatusNotFound)
+		case strings.HasPrefix(strings.ToLower(target), "http://") || strings.HasPrefix(strings.ToLower(target), "https://"):
+			http.Redirect(w, r, target, http.StatusFound)
+		default:
+			st, err := os.Stat(target)
+			if err != nil || st.IsDir() {
+				// not reachable from here, the debugger ask for file.ptr next
+				log.Trace("[Restful] Pointer target %s of %s/%s unreachable: %v.", target, hash, name, err)
+				w.WriteHeader(http.StatusNotFound)
+				return
+			}
+			sendFile(w, r, b, b.Name(), hash, file, target, st)
+		}
+		return
+	}
+	if ptr {
+		writeMiss(w, r, name, hash)
+		return
+	}
+	w.WriteHeader(http.StatusNotFound)
+}
+
+// missMode return how file.ptr miss of `r` is answered, by the first rule of `[serve] MISS_RULES`
+// matching its user agent or path prefix, otherwise `[serve] MISS`
+func missMode(r *http.Request) string {
+	ua := strings.ToLower(r.UserAgent())
+	for _, rule := range config.ServeMissRules {
+		idx := strings.LastIndex(rule, "=")
+		if idx == -1 {
+			continue
+		}
+		match, mode := strings.TrimSpace(rule[:idx]), strings.ToLower(strings.TrimSpace(rule[idx+1:]))
+		matched := false
+		switch {
+		case strings.HasPrefix(match, "ua:"):
+			matched = ua != "" && strings.Contains(ua, strings.ToLower(match[3:]))
+		case strings.HasPrefix(match, "path:"):
+			matched = strings.HasPrefix(strings.ToLower(r.URL.Path), strings.ToLower(match[5:]))
+		}
+		if matched {
+			return mode
+		}
+	}
+	return config.ServeMiss
+}
+
+// writeMiss answer file.ptr request of symbol `hash`/`name` held by no branch
+func writeMiss(w http.ResponseWriter, r *http.Request, name, hash string) {
+	switch missMode(r) {
+	case missEmpty:
+		w.Header().Set("Content-Type", "text/plain")
+		w.Header().Set("Content-Length", "0")
+		w.WriteHeader(http.StatusOK)
+	case missMessage:
+		msg := fmt.Sprintf("MSG: %s/%s not found on %s", name, hash, config.AppName)
+		w.Header().Set("Content-Type", "text/plain")
+		w.Header().Set("Content-Length", strconv.Itoa(len(msg)))
+		w.WriteHeader(http.StatusOK)
+		if r.Method != "HEAD" {
+			io.WriteString(w, msg)
+		}
+	default:
+		w.WriteHeader(http.StatusNotFound)
+	}
+}
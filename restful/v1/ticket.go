@@ -0,0 +1,77 @@
+package v1
+
+import (
+	"encoding/json"
+	"fmt"
+	"net/http"
+
+	"github.com/adyzng/GoSymbols/restful"
+	"github.com/adyzng/GoSymbols/symbol"
+	"github.com/gorilla/mux"
+	log "gopkg.in/clog.v1"
+)
+
+// LinkTickets response to build tickets api, replace Jira issues linked to given build
+//	[:]/api/branches/{name}/{bid}/tickets [PUT]
+//
+//	@:name	{branch name}
+//	@:bid	{build id}
+//	@:BODY	{tickets: ["UDP-123"]}, empty to unlink all
+//
+//	@ return {
+//		RestResponse{Data: []string}
+//	}
+//
+func LinkTickets(w http.ResponseWriter, r *http.Request) {
+	_, token := loginRequired(r)
+	if token == nil {
+		w.WriteHeader(http.StatusUnauthorized)
+		log.Warn("[Restful] Login required.")
+		return
+	}
+
+	var req struct {
+		Tickets []string `json:"tickets"`
+	}
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		log.Error(2, "[Restful] Decode request body failed: %v.", err)
+		w.WriteHeader(http.StatusBadRequest)
+		return
+	}
+
+	vars := mux.Vars(r)
+	resp := restful.RestResponse{}
+	b, ok := symbol.GetServer().Get(vars["name"]).(*symbol.BrBuilder)
+	if !ok {
+		resp.ErrCodeMsg = restful.ErrUnknownBranch
+		resp.WriteJSON(w)
+		return
+	}
+
+	log.Info("[Restful] User %s link build %s of %s to %v.", token.UserName, vars["bid"], b.Name(), req.Tickets)
+	keys, err := b.SetTickets(vars["bid"], req.Tickets, token.UserName)
+	if err != nil {
+		resp.ErrCodeMsg = restful.ErrInvalidParam
+		resp.Message = fmt.Sprintf("%s", err)
+		resp.WriteJSON(w)
+		return
+	}
+	resp.Data = keys
+	resp.WriteJSON(w)
+}
+
+// TicketBuilds response to ticket search api, builds of all branches linked to an issue
+//	[:]/api/tickets/{key}/builds [GET]
+//
+//	@:key	{Jira issue key, eg: UDP-123}
+//
+//	@ return {
+//		RestResponse{Data: []*symbol.Build}
+//	}
+//
+func TicketBuilds(w http.ResponseWriter, r *http.Request) {
+	resp := restful.RestResponse{
+		Data: symbol.GetServer().TicketBuilds(mux.Vars(r)["key"]),
+	}
+	resp.WriteJSON(w)
+}
@@ -0,0 +1,88 @@
+package v1
+
+import (
+	"net/http"
+	"strconv"
+	"time"
+
+	"github.com/adyzng/GoSymbols/restful"
+	"github.com/adyzng/GoSymbols/symbol"
+)
+
+// RestIngestTimings response to ingest stage timings api
+//	[:]/api/ingest/timings?branch=&n=50 [GET]
+//
+//	@:branch	{optional, branch name, empty for all}
+//	@:n			{optional, latest n builds, default all}
+//
+//	@ return {
+//		RestResponse{Data: []*symbol.BuildTiming}
+//	}
+//
+func RestIngestTimings(w http.ResponseWriter, r *http.Request) {
+	n, _ := strconv.Atoi(r.URL.Query().Get("n"))
+	resp := restful.RestResponse{
+		Data: symbol.GetServer().IngestTimings(r.URL.Query().Get("branch"), n),
+	}
+	resp.WriteJSON(w)
+}
+
+// RestIngestStatus response to ingest lifecycle api
+//	[:]/api/ingest/status?branch=&status=failed [GET]
+//
+//	@:branch	{optional, branch name, empty for all}
+//	@:status	{optional, pending, ingesting, verifying, complete, failed, deleted or archived}
+//
+//	@ return {
+//		RestResponse{Data: []*symbol.IngestStatus}
+//	}
+//
+func RestIngestStatus(w http.ResponseWriter, r *http.Request) {
+	status := symbol.BuildStatus(r.URL.Query().Get("status"))
+	resp := restful.RestResponse{
+		Data: symbol.GetServer().IngestStatus(r.URL.Query().Get("branch"), status),
+	}
+	resp.WriteJSON(w)
+}
+
+// RestIngestSLO response to ingest latency api, time from build completion to symbols
+// available against the SLO of each branch
+//	[:]/api/ingest/slo?branch=&days=7 [GET]
+//
+//	@:branch	{optional, branch name, empty for branches with SLO or measured builds}
+//	@:days		{optional, builds ingested in last days, default 7}
+//
+//	@ return {
+//		RestResponse{Data: []*symbol.SLOStatus}
+//	}
+//
+func RestIngestSLO(w http.ResponseWriter, r *http.Request) {
+	days, _ := strconv.Atoi(r.URL.Query().Get("days"))
+	if days <= 0 {
+		days = 7
+	}
+	from := time.Now().AddDate(0, 0, -days)
+	resp := restful.RestResponse{
+		Data: symbol.GetServer().SLOReport(r.URL.Query().Get("branch"), from),
+	}
+	resp.WriteJSON(w)
+}
+
+// RestShadowReports response to shadow ingest api, how stores written by the native writer
+// differ from symstore.exe
+//	[:]/api/ingest/shadow?branch=&mismatch=true [GET]
+//
+//	@:branch	{optional, branch name, empty for all}
+//	@:mismatch	{optional, only builds which differ}
+//
+//	@ return {
+//		RestResponse{Data: []*symbol.ShadowReport}
+//	}
+//
+func RestShadowReports(w http.ResponseWriter, r *http.Request) {
+	mismatch, _ := strconv.ParseBool(r.URL.Query().Get("mismatch"))
+	resp := restful.RestResponse{
+		Data: symbol.GetServer().ShadowReports(r.URL.Query().Get("branch"), mismatch),
+	}
+	resp.WriteJSON(w)
+}
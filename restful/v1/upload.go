@@ -0,0 +1,161 @@
+package v1
+
+import (
+	"fmt"
+	"io"
+	"mime"
+	"mime/multipart"
+	"net/http"
+	"strconv"
+	"strings"
+
+	"github.com/adyzng/GoSymbols/activity"
+	"github.com/adyzng/GoSymbols/restful"
+	"github.com/adyzng/GoSymbols/symbol"
+	"github.com/gorilla/mux"
+
+	log "gopkg.in/clog.v1"
+)
+
+// contentRange parse `bytes {start}-{end}/{total}` of a chunk, total is -1 if unknown (`*`)
+func contentRange(header string) (start, total int64, ok bool) {
+	if !strings.HasPrefix(header, "bytes ") {
+		return 0, 0, false
+	}
+	ss := strings.Split(strings.TrimPrefix(header, "bytes "), "/")
+	if len(ss) != 2 {
+		return 0, 0, false
+	}
+	rng := strings.Split(ss[0], "-")
+	start, err := strconv.ParseInt(rng[0], 10, 64)
+	if len(rng) != 2 || err != nil || start < 0 {
+		return 0, 0, false
+	}
+	if ss[1] == "*" {
+		return start, -1, true
+	}
+	if total, err = strconv.ParseInt(ss[1], 10, 64); err != nil || total < start {
+		return 0, 0, false
+	}
+	return start, total, true
+}
+
+// PostSymbols response to symbol upload api, build agents push the debug zip of a build
+// instead of the server copying it from the build share. The zip is the request body, sent
+// at once or in chunks with `Content-Range`, or symbol files are sent one by one as a
+// multipart form. The build is queued for ingest once the upload is complete.
+//	[:]/api/v1/branches/{name}/builds/{version}/symbols?priority= [POST]
+//
+//	@:name		{branch name}
+//	@:version	{build version}
+//	@:priority	{optional, priority of the ingest job}
+//	@:BODY		{debug zip, or multipart/form-data of pdb and binaries}
+//
+//	@ return {
+//		RestResponse{Data: restful.UploadResult}
+//	}
+//
+func PostSymbols(w http.ResponseWriter, r *http.Request) {
+	user := apiUser(r)
+	if user == "" {
+		writeUnauthorized(w)
+		return
+	}
+
+	vars := mux.Vars(r)
+	resp := restful.RestResponse{}
+	b, ok := symbol.GetServer().Get(vars["name"]).(*symbol.BrBuilder)
+	if !ok {
+		resp.ErrCodeMsg = restful.ErrUnknownBranch
+		resp.WriteStatus(w, http.StatusNotFound)
+		return
+	}
+	prio := symbol.PriorityDefault
+	if p := r.URL.Query().Get("priority"); p != "" {
+		var err error
+		if prio, err = symbol.ParsePriority(p); err != nil {
+			resp.ErrCodeMsg = restful.ErrInvalidParam
+			resp.Message = fmt.Sprintf("%s", err)
+			resp.WriteStatus(w, http.StatusBadRequest)
+			return
+		}
+	}
+
+	var (
+		err     error
+		up      *symbol.Upload
+		version = vars["version"]
+	)
+	if media, _, _ := mime.ParseMediaType(r.Header.Get("Content-Type")); media == "multipart/form-data" {
+		var mr *multipart.Reader
+		if mr, err = r.MultipartReader(); err != nil {
+			w.WriteHeader(http.StatusBadRequest)
+			return
+		}
+		up, err = b.UploadFiles(version, func() (string, io.Reader, error) {
+			for {
+				part, err := mr.NextPart()
+				if err != nil {
+					return "", nil, err
+				}
+				if part.FileName() != "" {
+					return part.FileName(), part, nil
+				}
+			}
+		})
+	} else {
+		// without Content-Range the body is the whole zip
+		header := r.Header.Get("Content-Range")
+		start, total, ok := int64(0), int64(-1), true
+		if header != "" {
+			start, total, ok = contentRange(header)
+		}
+		if !ok {
+			resp.ErrCodeMsg = restful.ErrInvalidParam
+			resp.Message = "invalid Content-Range"
+			resp.WriteStatus(w, http.StatusBadRequest)
+			return
+		}
+		up, err = b.AppendUpload(version, start, r.Body)
+		if err == nil && (header == "" || up.Size == total) {
+			up, err = b.FinishUpload(version)
+		}
+	}
+
+	result := &restful.UploadResult{Upload: up}
+	resp.Data = result
+	switch err {
+	case nil:
+	case symbol.ErrUploadOffset, symbol.ErrUploadBusy:
+		// the upload tell where to resume
+		resp.ErrCodeMsg = restful.ErrInvalidParam
+		resp.Message = fmt.Sprintf("%s", err)
+		resp.WriteStatus(w, http.StatusConflict)
+		return
+	case symbol.ErrUploadTooLarge:
+		resp.ErrCodeMsg = restful.ErrInvalidParam
+		resp.Message = fmt.Sprintf("%s", err)
+		resp.WriteStatus(w, http.StatusRequestEntityTooLarge)
+		return
+	default:
+		log.Warn("[Restful] Upload build %s of %s by %s failed: %v.", version, b.Name(), user, err)
+		resp.ErrCodeMsg = restful.ErrInvalidParam
+		resp.Message = fmt.Sprintf("%s", err)
+		resp.WriteStatus(w, http.StatusBadRequest)
+		return
+	}
+	if !up.Complete {
+		resp.WriteJSON(w)
+		return
+	}
+
+	if result.Job, err = symbol.GetServer().Enqueue(b.StoreName, version, prio); err != nil {
+		resp.ErrCodeMsg = restful.ErrServerInner
+		resp.Message = fmt.Sprintf("%s", err)
+		resp.WriteStatus(w, http.StatusServiceUnavailable)
+		return
+	}
+	log.Info("[Restful] User %s upload branch %s build %s, %d bytes.", user, b.Name(), version, up.Size)
+	activity.Annotate(r, activity.KindIngest, b.Name(), version)
+	resp.WriteStatus(w, http.StatusAccepted)
+}
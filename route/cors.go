@@ -0,0 +1,123 @@
+package route
+
+import (
+	"net/http"
+	"strconv"
+	"strings"
+
+	"github.com/adyzng/GoSymbols/config"
+	clog "gopkg.in/clog.v1"
+)
+
+// corsPolicy of an endpoint group
+//
+type corsPolicy struct {
+	Group       string
+	Origins     []string
+	Methods     []string
+	Credentials bool
+}
+
+// corsGroup return the policy of api request by method, safe methods belong to browse group,
+// others to admin group. Oauth redirects under `/api/auth/` are never cross-origin.
+//
+func corsGroup(path, method string) *corsPolicy {
+	if strings.HasPrefix(path, "/api/auth/") {
+		return nil
+	}
+	switch method {
+	case "GET", "HEAD":
+		return &corsPolicy{
+			Group:       "browse",
+			Origins:     config.CorsBrowseOrigins,
+			Methods:     config.CorsBrowseMethods,
+			Credentials: config.CorsBrowseCredentials,
+		}
+	default:
+		return &corsPolicy{
+			Group:       "admin",
+			Origins:     config.CorsAdminOrigins,
+			Methods:     config.CorsAdminMethods,
+			Credentials: config.CorsAdminCredentials,
+		}
+	}
+}
+
+// allowOrigin return value of `Access-Control-Allow-Origin`, empty if origin is not allowed.
+func (p *corsPolicy) allowOrigin(origin string) string {
+	for _, o := range p.Origins {
+		o = strings.TrimRight(strings.TrimSpace(o), "/")
+		if o == "*" && !p.Credentials {
+			return "*"
+		}
+		if strings.EqualFold(o, origin) {
+			return origin
+		}
+	}
+	return ""
+}
+
+func (p *corsPolicy) allowMethod(method string) bool {
+	for _, m := range p.Methods {
+		if strings.EqualFold(strings.TrimSpace(m), method) {
+			return true
+		}
+	}
+	return false
+}
+
+// CorsHandler add CORS headers to api responses for origins allowed by `[cors]`, and answer
+// preflight requests. Other pages only get `frame-ancestors` which limit who can embed them.
+//
+func CorsHandler(h http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if !strings.HasPrefix(r.URL.Path, "/api/") {
+			if config.FrameAncestors != "" {
+				w.Header().Set("Content-Security-Policy", "frame-ancestors "+config.FrameAncestors)
+			}
+			h.ServeHTTP(w, r)
+			return
+		}
+
+		origin := r.Header.Get("Origin")
+		if origin == "" {
+			h.ServeHTTP(w, r)
+			return
+		}
+		method := r.Method
+		preflight := r.Method == "OPTIONS" && r.Header.Get("Access-Control-Request-Method") != ""
+		if preflight {
+			method = r.Header.Get("Access-Control-Request-Method")
+		}
+
+		w.Header().Add("Vary", "Origin")
+		policy := corsGroup(r.URL.Path, method)
+		allow := ""
+		if policy != nil && policy.allowMethod(method) {
+			allow = policy.allowOrigin(origin)
+		}
+		if allow == "" {
+			if preflight {
+				clog.Warn("[CORS] Origin %s denied for %s %s.", origin, method, r.URL.Path)
+				w.WriteHeader(http.StatusForbidden)
+				return
+			}
+			h.ServeHTTP(w, r)
+			return
+		}
+
+		w.Header().Set("Access-Control-Allow-Origin", allow)
+		if policy.Credentials && allow != "*" {
+			w.Header().Set("Access-Control-Allow-Credentials", "true")
+		}
+		if !preflight {
+			w.Header().Set("Access-Control-Expose-Headers", "Content-Disposition, Content-Length, ETag, Digest, X-Checksum-Sha256")
+			h.ServeHTTP(w, r)
+			return
+		}
+		w.Header().Set("Access-Control-Allow-Methods", strings.Join(policy.Methods, ", "))
+		w.Header().Set("Access-Control-Allow-Headers", strings.Join(config.CorsHeaders, ", "))
+		w.Header().Set("Access-Control-Max-Age", strconv.Itoa(config.CorsMaxAge))
+		w.WriteHeader(http.StatusNoContent)
+	})
+}
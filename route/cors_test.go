@@ -0,0 +1,59 @@
+package route
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/adyzng/GoSymbols/config"
+)
+
+func TestCorsHandler(t *testing.T) {
+	defer func(b, a []string, c bool) {
+		config.CorsBrowseOrigins, config.CorsAdminOrigins, config.CorsAdminCredentials = b, a, c
+	}(config.CorsBrowseOrigins, config.CorsAdminOrigins, config.CorsAdminCredentials)
+	config.CorsBrowseOrigins = []string{"*"}
+	config.CorsBrowseMethods = []string{"GET", "HEAD"}
+	config.CorsAdminOrigins = []string{"https://devportal"}
+	config.CorsAdminMethods = []string{"POST", "DELETE"}
+	config.CorsAdminCredentials = true
+	config.FrameAncestors = "'self'"
+
+	h := CorsHandler(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {}))
+	serve := func(method, path, origin, want string) *httptest.ResponseRecorder {
+		r := httptest.NewRequest(method, path, nil)
+		r.Header.Set("Origin", origin)
+		if want != "" {
+			r.Header.Set("Access-Control-Request-Method", want)
+		}
+		w := httptest.NewRecorder()
+		h.ServeHTTP(w, r)
+		return w
+	}
+
+	w := serve("GET", "/api/branches", "https://any", "")
+	if w.Header().Get("Access-Control-Allow-Origin") != "*" || w.Header().Get("Access-Control-Allow-Credentials") != "" {
+		t.Errorf("browse: expect any origin without credentials, got %v", w.Header())
+	}
+	w = serve("OPTIONS", "/api/branches/UDP/seal", "https://any", "POST")
+	if w.Code != http.StatusForbidden {
+		t.Errorf("admin preflight from unknown origin: expect 403, got %d", w.Code)
+	}
+	w = serve("OPTIONS", "/api/branches/UDP/seal", "https://devportal", "POST")
+	if w.Code != http.StatusNoContent || w.Header().Get("Access-Control-Allow-Origin") != "https://devportal" ||
+		w.Header().Get("Access-Control-Allow-Credentials") != "true" {
+		t.Errorf("admin preflight: unexpected %d %v", w.Code, w.Header())
+	}
+	w = serve("OPTIONS", "/api/branches/UDP", "https://devportal", "PUT")
+	if w.Code != http.StatusForbidden {
+		t.Errorf("method not in admin group: expect 403, got %d", w.Code)
+	}
+	w = serve("GET", "/api/auth/login", "https://any", "")
+	if w.Header().Get("Access-Control-Allow-Origin") != "" {
+		t.Errorf("auth must not be cross-origin, got %v", w.Header())
+	}
+	w = serve("GET", "/", "https://any", "")
+	if w.Header().Get("Content-Security-Policy") == "" {
+		t.Errorf("expect frame-ancestors on web pages")
+	}
+}
@@ -1,14 +1,26 @@
 package route
 
 import (
+	"context"
+	"crypto/subtle"
+	"encoding/json"
 	"fmt"
 	"html/template"
 	"net/http"
 	"path/filepath"
+	"strconv"
 	"strings"
 	"time"
 
+	"github.com/adyzng/GoSymbols/activity"
 	"github.com/adyzng/GoSymbols/config"
+	"github.com/adyzng/GoSymbols/federation"
+	"github.com/adyzng/GoSymbols/metrics"
+	"github.com/adyzng/GoSymbols/restful/auth"
+	"github.com/adyzng/GoSymbols/restful/session"
+	"github.com/adyzng/GoSymbols/site"
+	"github.com/adyzng/GoSymbols/symbol"
+	"github.com/gorilla/mux"
 
 	clog "gopkg.in/clog.v1"
 )
@@ -19,7 +31,7 @@ func IndexHandle(w http.ResponseWriter, r *http.Request) {
 	index := filepath.Join(config.WebRoot, "index.html")
 	tmpl, err := template.ParseFiles(index)
 	if err == nil {
-		tmpl.Execute(w, nil)
+		tmpl.Execute(w, map[string]string{"Base": config.BasePath})
 		//w.WriteHeader(http.StatusOK)
 	} else {
 		w.WriteHeader(http.StatusInternalServerError)
@@ -27,6 +39,30 @@ func IndexHandle(w http.ResponseWriter, r *http.Request) {
 	}
 }
 
+// PermalinkHandle redirect permalink to the current location of its target
+//
+func PermalinkHandle(w http.ResponseWriter, r *http.Request) {
+	_, target, err := symbol.GetServer().ResolvePermalink(mux.Vars(r)["id"])
+	if err != nil {
+		clog.Warn("[Res] Resolve permalink %s failed: %v.", r.URL.Path, err)
+		http.NotFound(w, r)
+		return
+	}
+	http.Redirect(w, r, target, http.StatusFound)
+}
+
+// ReadyHandle report warm-up progress, 503 until metadata of all branches are loaded.
+// Symbol files are served in the meantime, only browse data may be incomplete.
+//
+func ReadyHandle(w http.ResponseWriter, r *http.Request) {
+	ss := symbol.GetServer()
+	w.Header().Set("Content-Type", "application/json; charset=UTF-8")
+	if !ss.Ready() {
+		w.WriteHeader(http.StatusServiceUnavailable)
+	}
+	json.NewEncoder(w).Encode(ss.WarmupStatus())
+}
+
 // StaticHandler serve public files, exclude folder
 //
 func StaticHandler(folder string) http.Handler {
@@ -41,14 +77,55 @@ func StaticHandler(folder string) http.Handler {
 	})
 }
 
+// MetricsHandle expose metrics of ingestion, stores and requests to Prometheus.
+//
+func MetricsHandle(w http.ResponseWriter, r *http.Request) {
+	w.Header().Set("Content-Type", "text/plain; version=0.0.4; charset=utf-8")
+	metrics.Write(w)
+}
+
+// PrefixHandler strip config.BasePath from request path, so the site work behind reverse
+// proxy which keep the path prefix, eg: nginx `location /symbols/`. Requests without the
+// prefix are served as is.
+//
+func PrefixHandler(h http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		prefix := config.BasePath
+		if prefix != "" && (r.URL.Path == prefix || strings.HasPrefix(r.URL.Path, prefix+"/")) {
+			r.URL.Path = r.URL.Path[len(prefix):]
+			if r.URL.Path == "" {
+				r.URL.Path = "/"
+			}
+			r.URL.RawPath = ""
+		}
+		h.ServeHTTP(w, r)
+	})
+}
+
 // LogHandler print request trace log
 //
 func LogHandler(h http.Handler, name string) http.Handler {
 	return http.HandlerFunc(func(resp http.ResponseWriter, r *http.Request) {
 		start := time.Now()
 		w := &ResponseLogger{w: resp}
+		ev := &activity.Event{Kind: activity.KindAPI}
+		r = activity.WithEvent(r, ev)
 		h.ServeHTTP(w, r)
 
+		code := w.StatusCode
+		if code == 0 {
+			code = http.StatusOK
+		}
+		metrics.Requests.Inc(name, strconv.Itoa(code))
+		metrics.RequestSeconds.Observe(time.Since(start).Seconds(), name)
+
+		// forwarded requests are accounted by the server forwarding them
+		if strings.HasPrefix(r.URL.Path, "/api/") && !federation.IsForwarded(r) {
+			ev.User, ev.Client, ev.Bytes = requestUser(r), requestClient(r), w.Bytes
+			ev.Elapsed = time.Since(start)
+			activity.Record(ev)
+		}
+
 		// "GET / HTTP/1.1" 200 2552 UserAgent
 		clog.Info("[API] %s - %d %s %s %s - %s",
 			r.RemoteAddr,
@@ -59,3 +136,154 @@ func LogHandler(h http.Handler, name string) http.Handler {
 			time.Since(start))
 	})
 }
+
+// requestUser return name of logined user, or anonymous
+func requestUser(r *http.Request) string {
+	if c, _ := r.Cookie(session.CookieSessID); c != nil {
+		if token, ok := session.GetManager().Get(c.Value).(*auth.GraphToken); ok && token.UserName != "" {
+			return token.UserName
+		}
+	}
+	return activity.Anonymous
+}
+
+func requestClient(r *http.Request) string {
+	if ip := site.Get().ClientIP(r); ip != nil {
+		return ip.String()
+	}
+	return r.RemoteAddr
+}
+
+// federatedRoutes are the lookup, search and browse api forwarded by FederateHandler.
+// Mutations and admin api of a branch must be called on the peer which hold it.
+var federatedRoutes = map[string]bool{
+	"GetBuildList":     true,
+	"GetSymbolList":    true,
+	"GetBuildSigning":  true,
+	"GetSymbolHistory": true,
+	"GetSymbolSources": true,
+	"GetChannels":      true,
+	"GetBranchV1":      true,
+	"ListBuildsV1":     true,
+	"GetBuildV1":       true,
+	"ListSymbolsV1":    true,
+	"DownloadSymbol":   true,
+	"SymbolChecksum":   true,
+}
+
+// FederateHandler forward read requests of branch not exist on local store to the peer
+// which hold it, see federatedRoutes.
+//
+func FederateHandler(h http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		fed := federation.Get()
+		if fed.Enabled() && !federation.IsForwarded(r) && (r.Method == "GET" || r.Method == "HEAD") {
+			vars := mux.Vars(r)
+			name := vars["name"]
+			if name == "" {
+				name = vars["branch"]
+			}
+			if name != "" && symbol.GetServer().Get(name) == nil {
+				if peer := fed.Owner(name); peer != nil {
+					fed.Forward(peer, w, r)
+					return
+				}
+			}
+		}
+		h.ServeHTTP(w, r)
+	})
+}
+
+// headerMetadataLag of responses read from a metadata replica, see ReplicaHandler
+const headerMetadataLag = "X-Metadata-Lag"
+
+// replicaRoutes are the heavy list and search api which read the metadata replicas, see
+// ReplicaHandler. Lookups and downloads always read the primary database.
+var replicaRoutes = map[string]bool{
+	"GetBuildList":     true,
+	"GetSymbolList":    true,
+	"BuildByKey":       true,
+	"ListBuildsV1":     true,
+	"ListSymbolsV1":    true,
+	"SearchSymbols":    true,
+	"GetSymbolHeatmap": true,
+	"GraphQL":          true,
+}
+
+// ReplicaHandler let metadata reads of the request go to the replicas `[metadata] READ_DSN`,
+// so heavy browse traffic doesn't hold up ingest, see replicaRoutes. A response read from a
+// replica has header `X-Metadata-Lag`, the milliseconds it may lag behind.
+//
+func ReplicaHandler(h http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		ctx := symbol.WithReplica(r.Context())
+		h.ServeHTTP(&lagWriter{ResponseWriter: w, ctx: ctx}, r.WithContext(ctx))
+	})
+}
+
+// lagWriter add `X-Metadata-Lag` of the replica reads before the response is written
+type lagWriter struct {
+	http.ResponseWriter
+	ctx     context.Context
+	written bool
+}
+
+func (w *lagWriter) WriteHeader(status int) {
+	if !w.written {
+		w.written = true
+		if lag, ok := symbol.ReplicaLag(w.ctx); ok {
+			w.Header().Set(headerMetadataLag, strconv.FormatInt(int64(lag/time.Millisecond), 10))
+		}
+	}
+	w.ResponseWriter.WriteHeader(status)
+}
+
+func (w *lagWriter) Write(data []byte) (int, error) {
+	if !w.written {
+		w.WriteHeader(http.StatusOK)
+	}
+	return w.ResponseWriter.Write(data)
+}
+
+// SiteHandler redirect symbol downloads to the replica nearest the client, see package site.
+//
+func SiteHandler(h http.HandlerFunc) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		if !federation.IsForwarded(r) {
+			if target := site.Get().Redirect(r); target != "" {
+				clog.Trace("[Res] Redirect %s to %s.", r.RemoteAddr, target)
+				http.Redirect(w, r, target, http.StatusFound)
+				return
+			}
+		}
+		h(w, r)
+	}
+}
+
+// CsrfHandler reject mutating requests of logined user without the csrf token of the session
+// in header, so other sites can't act on behalf of the user by its cookie. Requests without
+// session are left to the handler which require login.
+//
+func CsrfHandler(h http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		switch r.Method {
+		case "GET", "HEAD", "OPTIONS":
+			h.ServeHTTP(w, r)
+			return
+		}
+		if strings.HasPrefix(r.URL.Path, "/api/auth/") {
+			h.ServeHTTP(w, r)
+			return
+		}
+		if c, _ := r.Cookie(session.CookieSessID); c != nil {
+			expect := session.GetManager().CSRFToken(c.Value)
+			got := r.Header.Get(session.HeaderCSRF)
+			if expect != "" && subtle.ConstantTimeCompare([]byte(expect), []byte(got)) != 1 {
+				clog.Warn("[Restful] CSRF token mismatch on %s %s.", r.Method, r.URL.Path)
+				w.WriteHeader(http.StatusForbidden)
+				return
+			}
+		}
+		h.ServeHTTP(w, r)
+	})
+}
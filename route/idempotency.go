@@ -0,0 +1,163 @@
+package route
+
+import (
+	"bytes"
+	"crypto/sha256"
+	"io/ioutil"
+	"net/http"
+	"sync"
+	"time"
+
+	clog "gopkg.in/clog.v1"
+)
+
+const (
+	headerIdempotencyKey = "Idempotency-Key"
+	headerReplayed       = "Idempotent-Replayed"
+
+	idempotencyTTL  = 24 * time.Hour
+	idempotencyKeys = 10000 // responses kept at most, expired ones are dropped first
+)
+
+// idemEntry is the response of a request with idempotency key, `done` is false while the
+// first request is still running
+type idemEntry struct {
+	sum    [sha256.Size]byte
+	done   bool
+	at     time.Time
+	status int
+	header http.Header
+	body   []byte
+}
+
+// idemStore keep responses by user, method, uri and idempotency key
+type idemStore struct {
+	mx      sync.Mutex
+	entries map[string]*idemEntry
+}
+
+var idempotency = &idemStore{entries: make(map[string]*idemEntry)}
+
+// begin return the kept entry of `key`, or nil after reserving it for the caller
+func (s *idemStore) begin(key string, sum [sha256.Size]byte) *idemEntry {
+	s.mx.Lock()
+	defer s.mx.Unlock()
+	if e, ok := s.entries[key]; ok && time.Since(e.at) < idempotencyTTL {
+		return e
+	}
+	if len(s.entries) >= idempotencyKeys {
+		s.evict()
+	}
+	s.entries[key] = &idemEntry{sum: sum, at: time.Now()}
+	return nil
+}
+
+// evict drop expired entries, or the oldest done one if none expired, caller hold `mx`
+func (s *idemStore) evict() {
+	var oldest string
+	for key, e := range s.entries {
+		if time.Since(e.at) >= idempotencyTTL {
+			delete(s.entries, key)
+			continue
+		}
+		if e.done && (oldest == "" || e.at.Before(s.entries[oldest].at)) {
+			oldest = key
+		}
+	}
+	if len(s.entries) >= idempotencyKeys && oldest != "" {
+		delete(s.entries, oldest)
+	}
+}
+
+// finish keep the response of `key`, server errors (or panic) are dropped so the retry
+// run again
+func (s *idemStore) finish(key string, w *idemWriter) {
+	s.mx.Lock()
+	defer s.mx.Unlock()
+	e, ok := s.entries[key]
+	if !ok {
+		return
+	}
+	if w.status == 0 || w.status >= http.StatusInternalServerError {
+		delete(s.entries, key)
+		return
+	}
+	e.done, e.status, e.header, e.body = true, w.status, w.header, w.body.Bytes()
+}
+
+// idemWriter copy the response while writing it
+type idemWriter struct {
+	http.ResponseWriter
+	status int
+	header http.Header
+	body   bytes.Buffer
+}
+
+func (w *idemWriter) WriteHeader(status int) {
+	if w.status == 0 {
+		w.status = status
+		w.header = make(http.Header, len(w.Header()))
+		for k, v := range w.Header() {
+			w.header[k] = append([]string(nil), v...)
+		}
+	}
+	w.ResponseWriter.WriteHeader(status)
+}
+
+func (w *idemWriter) Write(data []byte) (int, error) {
+	if w.status == 0 {
+		w.WriteHeader(http.StatusOK)
+	}
+	w.body.Write(data)
+	return w.ResponseWriter.Write(data)
+}
+
+// IdempotentHandler replay the response of a mutating request retried with the same
+// `Idempotency-Key` header by the same user, so bulk changes are not applied twice. The
+// key reused with another body is refused, and so is a retry while the first is running.
+//
+func IdempotentHandler(h http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		key := r.Header.Get(headerIdempotencyKey)
+		if key == "" || r.Method == "GET" || r.Method == "HEAD" || r.Method == "OPTIONS" {
+			h.ServeHTTP(w, r)
+			return
+		}
+		body, err := ioutil.ReadAll(r.Body)
+		if err != nil {
+			w.WriteHeader(http.StatusBadRequest)
+			return
+		}
+		r.Body = ioutil.NopCloser(bytes.NewReader(body))
+
+		scope := requestUser(r) + " " + r.Method + " " + r.URL.RequestURI() + " " + key
+		sum := sha256.Sum256(body)
+		if e := idempotency.begin(scope, sum); e != nil {
+			idempotency.mx.Lock()
+			done, same, status, header, data := e.done, e.sum == sum, e.status, e.header, e.body
+			idempotency.mx.Unlock()
+			switch {
+			case !same:
+				clog.Warn("[Restful] Idempotency key %s reused with another request.", key)
+				w.WriteHeader(http.StatusUnprocessableEntity)
+			case !done:
+				w.WriteHeader(http.StatusConflict)
+			default:
+				for k, v := range header {
+					w.Header()[k] = v
+				}
+				w.Header().Set(headerReplayed, "true")
+				w.WriteHeader(status)
+				w.Write(data)
+			}
+			return
+		}
+
+		iw := &idemWriter{ResponseWriter: w}
+		defer func() { idempotency.finish(scope, iw) }()
+		h.ServeHTTP(iw, r)
+		if iw.status == 0 {
+			iw.WriteHeader(http.StatusOK)
+		}
+	})
+}
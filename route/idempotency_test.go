@@ -0,0 +1,84 @@
+package route
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"runtime"
+	"strings"
+	"testing"
+
+	"github.com/adyzng/GoSymbols/activity"
+)
+
+func TestIdempotentHandler(t *testing.T) {
+	calls := 0
+	block := make(chan struct{})
+	h := IdempotentHandler(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		calls++
+		if r.URL.Query().Get("block") != "" {
+			<-block
+		}
+		if r.URL.Query().Get("fail") != "" {
+			w.WriteHeader(http.StatusInternalServerError)
+			return
+		}
+		w.Header().Set("Content-Type", "application/json")
+		w.Write([]byte(`{"n": 1}`))
+	}))
+	serve := func(path, key, body string) *httptest.ResponseRecorder {
+		r := httptest.NewRequest("POST", path, strings.NewReader(body))
+		if key != "" {
+			r.Header.Set(headerIdempotencyKey, key)
+		}
+		w := httptest.NewRecorder()
+		h.ServeHTTP(w, r)
+		return w
+	}
+
+	serve("/api/branches/UDP/retention", "", "")
+	serve("/api/branches/UDP/retention", "", "")
+	if calls != 2 {
+		t.Fatalf("expect requests without key run each time, got %d", calls)
+	}
+
+	calls = 0
+	first := serve("/api/branches/merge", "k1", `{"from": "A"}`)
+	retry := serve("/api/branches/merge", "k1", `{"from": "A"}`)
+	if calls != 1 || retry.Code != http.StatusOK || retry.Body.String() != first.Body.String() ||
+		retry.Header().Get(headerReplayed) != "true" || retry.Header().Get("Content-Type") != "application/json" {
+		t.Errorf("expect retry replayed, got %d calls, %d %v %q", calls, retry.Code, retry.Header(), retry.Body)
+	}
+	if w := serve("/api/branches/merge", "k1", `{"from": "B"}`); w.Code != http.StatusUnprocessableEntity {
+		t.Errorf("expect key reused with another body refused, got %d", w.Code)
+	}
+	if serve("/api/branches/merge?preview=true", "k1", `{"from": "A"}`); calls != 2 {
+		t.Errorf("expect preview with the same key run, got %d calls", calls)
+	}
+
+	// server errors are not kept
+	serve("/api/branches/merge?fail=1", "k2", "")
+	serve("/api/branches/merge?fail=1", "k2", "")
+	if calls != 4 {
+		t.Errorf("expect failed request run again, got %d calls", calls)
+	}
+
+	done := make(chan struct{})
+	go func() {
+		serve("/api/branches/merge?block=1", "k3", "")
+		close(done)
+	}()
+	for {
+		idempotency.mx.Lock()
+		_, started := idempotency.entries[activity.Anonymous+" POST /api/branches/merge?block=1 k3"]
+		idempotency.mx.Unlock()
+		if started {
+			break
+		}
+		runtime.Gosched()
+	}
+	if w := serve("/api/branches/merge?block=1", "k3", ""); w.Code != http.StatusConflict {
+		t.Errorf("expect retry while running refused, got %d", w.Code)
+	}
+	close(block)
+	<-done
+}
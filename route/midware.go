@@ -7,6 +7,7 @@ import "net/http"
 type ResponseLogger struct {
 	w          http.ResponseWriter
 	StatusCode int
+	Bytes      int64 // body bytes written
 }
 
 // Header returns the header map that will be sent by
@@ -18,7 +19,9 @@ func (m *ResponseLogger) Header() http.Header {
 
 // Write writes the data to the connection as part of an HTTP reply.
 func (m *ResponseLogger) Write(data []byte) (int, error) {
-	return m.w.Write(data)
+	n, err := m.w.Write(data)
+	m.Bytes += int64(n)
+	return n, err
 }
 
 // WriteHeader sends an HTTP response header with status code.
@@ -0,0 +1,160 @@
+package route
+
+import (
+	"context"
+	"encoding/base64"
+	"fmt"
+	"net"
+	"net/http"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/adyzng/GoSymbols/restful/auth"
+
+	clog "gopkg.in/clog.v1"
+)
+
+// AuthNegotiate is windows integrated auth (SPNEGO: Kerberos or NTLM) of domain joined
+// clients, debuggers send domain credentials without prompt.
+const AuthNegotiate = "negotiate"
+
+const negotiateTimeout = time.Minute // unfinished handshakes are dropped after it
+
+// negotiation is an ongoing handshake, NTLM take two round trips on the same connection.
+// `mx` serialize the steps, the security context isn't safe for concurrent use.
+type negotiation struct {
+	mx     sync.Mutex
+	conn   *negotiateConn
+	closed bool
+	used   time.Time // guarded by negotiateMx
+}
+
+var (
+	negotiateMx  sync.Mutex
+	negotiations = make(map[interface{}]*negotiation) // connection (or remote address) => handshake
+)
+
+var errNegotiationClosed = fmt.Errorf("handshake expired")
+
+type connKey struct{}
+
+// ConnContext keep the connection in request context, set it to http.Server.ConnContext so
+// handshakes are kept per connection instead of per remote address.
+//
+func ConnContext(ctx context.Context, c net.Conn) context.Context {
+	return context.WithValue(ctx, connKey{}, c)
+}
+
+// ConnState drop the handshake of closed connection, set it to http.Server.ConnState.
+//
+func ConnState(c net.Conn, state http.ConnState) {
+	if state == http.StateClosed || state == http.StateHijacked {
+		dropNegotiation(c, nil)
+	}
+}
+
+// negotiationKey return the connection of request, or its remote address if the server
+// doesn't set ConnContext
+func negotiationKey(r *http.Request) interface{} {
+	if c, ok := r.Context().Value(connKey{}).(net.Conn); ok {
+		return c
+	}
+	return r.RemoteAddr
+}
+
+// dropNegotiation remove and close handshake of `key`, only if it's still `n` unless nil
+func dropNegotiation(key interface{}, n *negotiation) {
+	negotiateMx.Lock()
+	cur, ok := negotiations[key]
+	if ok = ok && (n == nil || cur == n); ok {
+		delete(negotiations, key)
+	}
+	negotiateMx.Unlock()
+	if ok {
+		cur.close()
+	}
+}
+
+// step take one step of the handshake, it fails once the handshake is closed
+func (n *negotiation) step(token []byte) ([]byte, *auth.Identity, error) {
+	n.mx.Lock()
+	defer n.mx.Unlock()
+	if n.closed {
+		return nil, nil, errNegotiationClosed
+	}
+	return n.conn.accept(token)
+}
+
+func (n *negotiation) close() {
+	n.mx.Lock()
+	defer n.mx.Unlock()
+	if !n.closed {
+		n.closed = true
+		n.conn.close()
+	}
+}
+
+// negotiateScheme return scheme and token of `Authorization: Negotiate|NTLM {base64}`
+func negotiateScheme(r *http.Request) (string, []byte) {
+	h := r.Header.Get("Authorization")
+	for _, scheme := range []string{"Negotiate", "NTLM"} {
+		if len(h) > len(scheme)+1 && strings.EqualFold(h[:len(scheme)+1], scheme+" ") {
+			token, err := base64.StdEncoding.DecodeString(strings.TrimSpace(h[len(scheme)+1:]))
+			if err != nil {
+				return "", nil
+			}
+			return scheme, token
+		}
+	}
+	return "", nil
+}
+
+// negotiate take one step of the handshake. Return the identity once authenticated, or
+// true if the challenge of next step is written to `w`.
+func negotiate(w http.ResponseWriter, r *http.Request) (*auth.Identity, bool) {
+	scheme, token := negotiateScheme(r)
+	if scheme == "" {
+		return nil, false
+	}
+
+	key := negotiationKey(r)
+	now := time.Now()
+	var expired []*negotiation
+	negotiateMx.Lock()
+	for k, n := range negotiations {
+		if now.Sub(n.used) > negotiateTimeout {
+			expired = append(expired, n)
+			delete(negotiations, k)
+		}
+	}
+	n, ok := negotiations[key]
+	if !ok {
+		n = &negotiation{conn: &negotiateConn{}}
+		negotiations[key] = n
+	}
+	n.used = now
+	negotiateMx.Unlock()
+	for _, e := range expired {
+		e.close()
+	}
+
+	out, id, err := n.step(token)
+	if err != nil || id != nil {
+		dropNegotiation(key, n)
+	}
+	if err != nil {
+		clog.Warn("[Auth] %s auth from %s failed: %v.", scheme, r.RemoteAddr, err)
+		return nil, false
+	}
+	if len(out) > 0 {
+		w.Header().Set("WWW-Authenticate", scheme+" "+base64.StdEncoding.EncodeToString(out))
+	}
+	if id == nil {
+		w.WriteHeader(http.StatusUnauthorized)
+		return nil, true
+	}
+	id.Method = AuthNegotiate
+	clog.Trace("[Auth] %s authenticated by %s.", id.User, scheme)
+	return id, false
+}
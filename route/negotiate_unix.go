@@ -0,0 +1,19 @@
+// +build !windows
+
+package route
+
+import (
+	"fmt"
+
+	"github.com/adyzng/GoSymbols/restful/auth"
+)
+
+// negotiateConn is not available without SSPI, put the service behind a proxy doing
+// integrated auth instead.
+type negotiateConn struct{}
+
+func (c *negotiateConn) accept(token []byte) ([]byte, *auth.Identity, error) {
+	return nil, nil, fmt.Errorf("negotiate auth is only supported on windows")
+}
+
+func (c *negotiateConn) close() {}
@@ -0,0 +1,191 @@
+package route
+
+import (
+	"fmt"
+	"sync"
+	"syscall"
+	"unsafe"
+
+	"github.com/adyzng/GoSymbols/restful/auth"
+)
+
+const (
+	secpkgCredInbound    = 1
+	securityNativeDrep   = 0x10
+	secbufferVersion     = 0
+	secbufferToken       = 2
+	ascReqAllocateMemory = 0x100
+	ascReqConnection     = 0x800
+	secpkgAttrNames      = 1
+	secEOk               = 0
+	secIContinueNeeded   = 0x00090312
+	tokenGroupsClass     = 2          // TOKEN_INFORMATION_CLASS TokenGroups
+	seGroupEnabled       = 0x00000004 // deny-only groups don't grant access
+)
+
+var (
+	secur32                       = syscall.NewLazyDLL("secur32.dll")
+	procAcquireCredentialsHandleW = secur32.NewProc("AcquireCredentialsHandleW")
+	procAcceptSecurityContext     = secur32.NewProc("AcceptSecurityContext")
+	procQueryContextAttributesW   = secur32.NewProc("QueryContextAttributesW")
+	procQuerySecurityContextToken = secur32.NewProc("QuerySecurityContextToken")
+	procDeleteSecurityContext     = secur32.NewProc("DeleteSecurityContext")
+	procFreeContextBuffer         = secur32.NewProc("FreeContextBuffer")
+)
+
+type secHandle struct {
+	lower, upper uintptr
+}
+
+type secBuffer struct {
+	size    uint32
+	typ     uint32
+	pointer *byte
+}
+
+type secBufferDesc struct {
+	version uint32
+	count   uint32
+	buffers *secBuffer
+}
+
+type tokenGroups struct {
+	count  uint32
+	groups [1]syscall.SIDAndAttributes
+}
+
+var (
+	credOnce sync.Once
+	cred     secHandle
+	credErr  error
+)
+
+// serverCred acquire inbound credential of the service account once, `Negotiate` package
+// pick Kerberos or fall back to NTLM.
+func serverCred() (*secHandle, error) {
+	credOnce.Do(func() {
+		pkg, _ := syscall.UTF16PtrFromString("Negotiate")
+		var expiry int64
+		r, _, _ := procAcquireCredentialsHandleW.Call(0, uintptr(unsafe.Pointer(pkg)), secpkgCredInbound,
+			0, 0, 0, 0, uintptr(unsafe.Pointer(&cred)), uintptr(unsafe.Pointer(&expiry)))
+		if r != secEOk {
+			credErr = fmt.Errorf("AcquireCredentialsHandle: 0x%08x", r)
+		}
+	})
+	return &cred, credErr
+}
+
+// negotiateConn is the SSPI security context of one handshake
+type negotiateConn struct {
+	ctx     secHandle
+	started bool
+}
+
+// accept feed client token to AcceptSecurityContext, return the token to send back, and the
+// identity once the handshake completes.
+func (c *negotiateConn) accept(token []byte) ([]byte, *auth.Identity, error) {
+	if len(token) == 0 {
+		return nil, nil, fmt.Errorf("empty token")
+	}
+	cr, err := serverCred()
+	if err != nil {
+		return nil, nil, err
+	}
+
+	in := secBuffer{size: uint32(len(token)), typ: secbufferToken, pointer: &token[0]}
+	inDesc := secBufferDesc{version: secbufferVersion, count: 1, buffers: &in}
+	out := secBuffer{typ: secbufferToken}
+	outDesc := secBufferDesc{version: secbufferVersion, count: 1, buffers: &out}
+
+	var (
+		ctx    uintptr
+		attrs  uint32
+		expiry int64
+	)
+	if c.started {
+		ctx = uintptr(unsafe.Pointer(&c.ctx))
+	}
+	r, _, _ := procAcceptSecurityContext.Call(uintptr(unsafe.Pointer(cr)), ctx, uintptr(unsafe.Pointer(&inDesc)),
+		ascReqAllocateMemory|ascReqConnection, securityNativeDrep, uintptr(unsafe.Pointer(&c.ctx)),
+		uintptr(unsafe.Pointer(&outDesc)), uintptr(unsafe.Pointer(&attrs)), uintptr(unsafe.Pointer(&expiry)))
+	var reply []byte
+	if out.pointer != nil {
+		reply = append(reply, (*[1 << 20]byte)(unsafe.Pointer(out.pointer))[:out.size:out.size]...)
+		procFreeContextBuffer.Call(uintptr(unsafe.Pointer(out.pointer)))
+	}
+
+	switch r {
+	case secIContinueNeeded:
+		c.started = true
+		return reply, nil, nil
+	case secEOk:
+		c.started = true
+	default:
+		return nil, nil, fmt.Errorf("AcceptSecurityContext: 0x%08x", r)
+	}
+
+	id, err := c.identity()
+	if err != nil {
+		return nil, nil, err
+	}
+	return reply, id, nil
+}
+
+// identity query user name and enabled groups of the authenticated client
+func (c *negotiateConn) identity() (*auth.Identity, error) {
+	var name *uint16
+	r, _, _ := procQueryContextAttributesW.Call(uintptr(unsafe.Pointer(&c.ctx)), secpkgAttrNames, uintptr(unsafe.Pointer(&name)))
+	if r != secEOk {
+		return nil, fmt.Errorf("QueryContextAttributes: 0x%08x", r)
+	}
+	id := &auth.Identity{User: utf16PtrToString(name)}
+	procFreeContextBuffer.Call(uintptr(unsafe.Pointer(name)))
+
+	var token syscall.Token
+	if r, _, _ = procQuerySecurityContextToken.Call(uintptr(unsafe.Pointer(&c.ctx)), uintptr(unsafe.Pointer(&token))); r != secEOk {
+		return nil, fmt.Errorf("QuerySecurityContextToken: 0x%08x", r)
+	}
+	defer token.Close()
+
+	var size uint32
+	syscall.GetTokenInformation(token, tokenGroupsClass, nil, 0, &size)
+	if size == 0 {
+		return id, nil
+	}
+	buf := make([]byte, size)
+	if err := syscall.GetTokenInformation(token, tokenGroupsClass, &buf[0], size, &size); err != nil {
+		return nil, fmt.Errorf("GetTokenInformation: %v", err)
+	}
+	tg := (*tokenGroups)(unsafe.Pointer(&buf[0]))
+	groups := (*[1 << 16]syscall.SIDAndAttributes)(unsafe.Pointer(&tg.groups[0]))[:tg.count:tg.count]
+	for _, g := range groups {
+		if g.Attributes&seGroupEnabled == 0 {
+			continue
+		}
+		account, domain, _, err := g.Sid.LookupAccount("")
+		if err != nil {
+			continue
+		}
+		if domain != "" {
+			account = domain + `\` + account
+		}
+		id.Groups = append(id.Groups, account)
+	}
+	return id, nil
+}
+
+// utf16PtrToString copy the zero terminated string allocated by SSPI
+func utf16PtrToString(p *uint16) string {
+	var s []uint16
+	for ptr := unsafe.Pointer(p); *(*uint16)(ptr) != 0; ptr = unsafe.Pointer(uintptr(ptr) + 2) {
+		s = append(s, *(*uint16)(ptr))
+	}
+	return syscall.UTF16ToString(s)
+}
+
+func (c *negotiateConn) close() {
+	if c.started {
+		procDeleteSecurityContext.Call(uintptr(unsafe.Pointer(&c.ctx)))
+		c.started = false
+	}
+}
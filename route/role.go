@@ -0,0 +1,39 @@
+package route
+
+import (
+	"net/http"
+
+	"github.com/adyzng/GoSymbols/config"
+	"github.com/adyzng/GoSymbols/restful"
+	"github.com/adyzng/GoSymbols/restful/auth"
+
+	clog "gopkg.in/clog.v1"
+)
+
+// RoleHandler refuse api requests whose identity isn't granted `role` by `[auth] ROLES`,
+// the identity is attached so handlers know the user. Nothing is checked without roles.
+//
+func RoleHandler(role string, h http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if !auth.RolesEnabled() || r.Method == "OPTIONS" {
+			h.ServeHTTP(w, r)
+			return
+		}
+		id := auth.Authenticate(r)
+		if id == nil {
+			clog.Warn("[Auth] Deny %s %s without credential, %s required.", r.Method, r.URL.Path, role)
+			w.Header().Add("WWW-Authenticate", `Basic realm="`+config.AppName+`"`)
+			resp := restful.RestResponse{ErrCodeMsg: restful.ErrLoginNeeded}
+			resp.WriteStatus(w, http.StatusUnauthorized)
+			return
+		}
+		if granted := auth.RoleOf(id); !auth.Grants(granted, role) {
+			clog.Warn("[Auth] Deny %s %s to %s (%s), %s required.", r.Method, r.URL.Path, id.User, granted, role)
+			resp := restful.RestResponse{ErrCodeMsg: restful.ErrUnauthorized}
+			resp.Message = role + " role required"
+			resp.WriteStatus(w, http.StatusForbidden)
+			return
+		}
+		h.ServeHTTP(w, auth.WithIdentity(r, id))
+	})
+}
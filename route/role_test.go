@@ -0,0 +1,51 @@
+package route
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/adyzng/GoSymbols/config"
+	"github.com/adyzng/GoSymbols/restful/auth"
+)
+
+func TestRoleHandler(t *testing.T) {
+	defer func(roles, users []string) { config.AuthRoles, config.AuthUsers = roles, users }(config.AuthRoles, config.AuthUsers)
+	// bcrypt of "password"
+	config.AuthUsers = []string{
+		"builder:$2a$04$BDzli4SpgwcFGU8GLyQNpesvynjQBfy/Z6A28Ka.WzWF7wbzK/OaW",
+		"reader:$2a$04$BDzli4SpgwcFGU8GLyQNpesvynjQBfy/Z6A28Ka.WzWF7wbzK/OaW",
+	}
+	config.AuthRoles = nil
+
+	var user string
+	h := RoleHandler(auth.RoleUploader, http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if id := auth.RequestIdentity(r); id != nil {
+			user = id.User
+		}
+	}))
+	serve := func(name string) int {
+		user = ""
+		r := httptest.NewRequest("POST", "/api/v1/branches/UDP/builds", nil)
+		if name != "" {
+			r.SetBasicAuth(name, "password")
+		}
+		w := httptest.NewRecorder()
+		h.ServeHTTP(w, r)
+		return w.Code
+	}
+	if code := serve(""); code != 200 {
+		t.Errorf("expect no check without roles, got %d", code)
+	}
+
+	config.AuthRoles = []string{"builder:uploader", "*:viewer"}
+	if code := serve(""); code != 401 {
+		t.Errorf("expect anonymous refused, got %d", code)
+	}
+	if code := serve("reader"); code != 403 {
+		t.Errorf("expect viewer forbidden, got %d", code)
+	}
+	if code := serve("builder"); code != 200 || user != "builder" {
+		t.Errorf("expect uploader served as builder, got %d %q", code, user)
+	}
+}
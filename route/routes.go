@@ -4,6 +4,7 @@ import (
 	"net/http"
 
 	"github.com/adyzng/GoSymbols/config"
+	"github.com/adyzng/GoSymbols/restful/auth"
 	"github.com/adyzng/GoSymbols/restful/v1"
 	"github.com/gorilla/mux"
 )
@@ -15,6 +16,7 @@ type Route struct {
 	Method  []string
 	Pattern string
 	Handler http.HandlerFunc
+	Role    string // role of `[auth] ROLES` required, empty for none
 }
 
 var resRoutes = []Route{
@@ -24,6 +26,24 @@ var resRoutes = []Route{
 		Pattern: "/",
 		Handler: IndexHandle,
 	},
+	{
+		Name:    "Permalink",
+		Method:  []string{"GET"},
+		Pattern: "/p/{id}",
+		Handler: PermalinkHandle,
+	},
+	{
+		Name:    "Ready",
+		Method:  []string{"GET"},
+		Pattern: "/readyz",
+		Handler: ReadyHandle,
+	},
+	{
+		Name:    "Metrics",
+		Method:  []string{"GET"},
+		Pattern: "/metrics",
+		Handler: MetricsHandle,
+	},
 }
 
 var apiRoutes = []Route{
@@ -32,24 +52,233 @@ var apiRoutes = []Route{
 		Method:  []string{"POST"},
 		Pattern: "/branches/create",
 		Handler: v1.CreateBranch,
+		Role:    auth.RoleAdmin,
 	},
 	{
 		Name:    "ModifyBranch",
 		Method:  []string{"POST"},
 		Pattern: "/branches/modify",
 		Handler: v1.ModifyBranch,
+		Role:    auth.RoleAdmin,
 	},
 	{
 		Name:    "ValidateBranch",
 		Method:  []string{"POST"},
 		Pattern: "/branches/check",
 		Handler: v1.ValidateBranch,
+		Role:    auth.RoleAdmin,
+	},
+	{
+		Name:    "DuplicateBranches",
+		Method:  []string{"GET"},
+		Pattern: "/branches/duplicates",
+		Handler: v1.RestDuplicateBranches,
+	},
+	{
+		Name:    "MergeBranch",
+		Method:  []string{"POST"},
+		Pattern: "/branches/merge",
+		Handler: v1.MergeBranch,
+		Role:    auth.RoleAdmin,
 	},
 	{
 		Name:    "DeleteBranch",
 		Method:  []string{"DELETE"},
 		Pattern: "/branches/{name}",
 		Handler: v1.DeleteBranch,
+		Role:    auth.RoleAdmin,
+	},
+	{
+		Name:    "TriggerBuild",
+		Method:  []string{"POST"},
+		Pattern: "/branches/{name}/trigger",
+		Handler: v1.TriggerBuild,
+		Role:    auth.RoleUploader,
+	},
+	{
+		Name:    "SupplementBuild",
+		Method:  []string{"POST"},
+		Pattern: "/branches/{name}/supplement",
+		Handler: v1.SupplementBuild,
+		Role:    auth.RoleUploader,
+	},
+	{
+		Name:    "StartBackfill",
+		Method:  []string{"POST"},
+		Pattern: "/branches/{name}/backfill",
+		Handler: v1.StartBackfill,
+		Role:    auth.RoleUploader,
+	},
+	{
+		Name:    "ServerBuilds",
+		Method:  []string{"GET"},
+		Pattern: "/branches/{name}/server-builds",
+		Handler: v1.RestServerBuilds,
+	},
+	{
+		Name:    "GetBackfill",
+		Method:  []string{"GET"},
+		Pattern: "/branches/{name}/backfill",
+		Handler: v1.GetBackfill,
+	},
+	{
+		Name:    "StopBackfill",
+		Method:  []string{"DELETE"},
+		Pattern: "/branches/{name}/backfill",
+		Handler: v1.StopBackfill,
+		Role:    auth.RoleUploader,
+	},
+	{
+		Name:    "StartRecompress",
+		Method:  []string{"POST"},
+		Pattern: "/branches/{name}/recompress",
+		Handler: v1.StartRecompress,
+		Role:    auth.RoleUploader,
+	},
+	{
+		Name:    "GetRecompress",
+		Method:  []string{"GET"},
+		Pattern: "/branches/{name}/recompress",
+		Handler: v1.GetRecompress,
+	},
+	{
+		Name:    "PauseRecompress",
+		Method:  []string{"POST"},
+		Pattern: "/branches/{name}/recompress/pause",
+		Handler: v1.PauseRecompress,
+		Role:    auth.RoleUploader,
+	},
+	{
+		Name:    "StopRecompress",
+		Method:  []string{"DELETE"},
+		Pattern: "/branches/{name}/recompress",
+		Handler: v1.StopRecompress,
+		Role:    auth.RoleUploader,
+	},
+	{
+		Name:    "DedupBranch",
+		Method:  []string{"POST"},
+		Pattern: "/branches/{name}/dedup",
+		Handler: v1.DedupBranch,
+		Role:    auth.RoleAdmin,
+	},
+	{
+		Name:    "GetDedupStats",
+		Method:  []string{"GET"},
+		Pattern: "/dedup",
+		Handler: v1.GetDedupStats,
+	},
+	{
+		Name:    "BeginCutover",
+		Method:  []string{"POST"},
+		Pattern: "/relocation/cutover",
+		Handler: v1.BeginCutover,
+		Role:    auth.RoleAdmin,
+	},
+	{
+		Name:    "GetCutover",
+		Method:  []string{"GET"},
+		Pattern: "/relocation/cutover",
+		Handler: v1.GetCutover,
+	},
+	{
+		Name:    "EndCutover",
+		Method:  []string{"DELETE"},
+		Pattern: "/relocation/cutover",
+		Handler: v1.EndCutover,
+		Role:    auth.RoleAdmin,
+	},
+	{
+		Name:    "GetStandby",
+		Method:  []string{"GET"},
+		Pattern: "/standby",
+		Handler: v1.RestStandby,
+	},
+	{
+		Name:    "PromoteStandby",
+		Method:  []string{"POST"},
+		Pattern: "/standby/promote",
+		Handler: v1.PromoteStandby,
+		Role:    auth.RoleAdmin,
+	},
+	{
+		Name:    "FenceStandby",
+		Method:  []string{"POST"},
+		Pattern: "/standby/fence",
+		Handler: v1.FenceStandby,
+		Role:    auth.RoleAdmin,
+	},
+	{
+		Name:    "GetSyncManifest",
+		Method:  []string{"GET"},
+		Pattern: "/branches/{name}/manifest",
+		Handler: v1.RestSyncManifest,
+	},
+	{
+		Name:    "GetStoreFile",
+		Method:  []string{"GET"},
+		Pattern: "/branches/{name}/file",
+		Handler: v1.RestStoreFile,
+	},
+	{
+		Name:    "GetChannels",
+		Method:  []string{"GET"},
+		Pattern: "/branches/{name}/channels",
+		Handler: v1.RestChannels,
+	},
+	{
+		Name:    "PurgeSymbols",
+		Method:  []string{"POST"},
+		Pattern: "/branches/{name}/purge",
+		Handler: v1.PurgeSymbols,
+		Role:    auth.RoleAdmin,
+	},
+	{
+		Name:    "GetRetention",
+		Method:  []string{"GET"},
+		Pattern: "/branches/{name}/retention",
+		Handler: v1.RestRetention,
+	},
+	{
+		Name:    "PruneBranch",
+		Method:  []string{"POST"},
+		Pattern: "/branches/{name}/retention",
+		Handler: v1.PruneBranch,
+		Role:    auth.RoleAdmin,
+	},
+	{
+		Name:    "VerifyBranch",
+		Method:  []string{"GET"},
+		Pattern: "/branches/{name}/verify",
+		Handler: v1.VerifyBranch,
+	},
+	{
+		Name:    "ReindexBranch",
+		Method:  []string{"POST"},
+		Pattern: "/branches/{name}/reindex",
+		Handler: v1.ReindexBranch,
+		Role:    auth.RoleAdmin,
+	},
+	{
+		Name:    "MigrateLayout",
+		Method:  []string{"POST"},
+		Pattern: "/branches/{name}/layout",
+		Handler: v1.MigrateLayout,
+		Role:    auth.RoleAdmin,
+	},
+	{
+		Name:    "SealBranch",
+		Method:  []string{"POST"},
+		Pattern: "/branches/{name}/seal",
+		Handler: v1.SealBranch,
+		Role:    auth.RoleAdmin,
+	},
+	{
+		Name:    "UnsealBranch",
+		Method:  []string{"DELETE"},
+		Pattern: "/branches/{name}/seal",
+		Handler: v1.UnsealBranch,
+		Role:    auth.RoleAdmin,
 	},
 	{
 		Name:    "GetBranchList",
@@ -70,10 +299,367 @@ var apiRoutes = []Route{
 		Handler: v1.RestSymbolList,
 	},
 	{
-		Name:    "DownloadSymbol",
+		Name:    "GetBuildSigning",
+		Method:  []string{"GET"},
+		Pattern: "/branches/{name}/{bid}/signing",
+		Handler: v1.RestBuildSigning,
+	},
+	{
+		Name:    "MarkRelease",
+		Method:  []string{"POST"},
+		Pattern: "/branches/{name}/{bid}/release",
+		Handler: v1.MarkRelease,
+		Role:    auth.RoleAdmin,
+	},
+	{
+		Name:    "SetBuildChannel",
+		Method:  []string{"POST"},
+		Pattern: "/branches/{name}/{bid}/channel",
+		Handler: v1.SetBuildChannel,
+		Role:    auth.RoleAdmin,
+	},
+	{
+		Name:    "PlaceHold",
+		Method:  []string{"POST", "DELETE"},
+		Pattern: "/branches/{name}/{bid}/hold",
+		Handler: v1.PlaceHold,
+		Role:    auth.RoleAdmin,
+	},
+	{
+		Name:    "LinkTickets",
+		Method:  []string{"PUT"},
+		Pattern: "/branches/{name}/{bid}/tickets",
+		Handler: v1.LinkTickets,
+		Role:    auth.RoleAdmin,
+	},
+	{
+		Name:    "TicketBuilds",
+		Method:  []string{"GET"},
+		Pattern: "/tickets/{key}/builds",
+		Handler: v1.TicketBuilds,
+	},
+	{
+		Name:    "GetSymbolHistory",
+		Method:  []string{"GET"},
+		Pattern: "/branches/{name}/{bid}/history",
+		Handler: v1.RestSymbolHistory,
+	},
+	{
+		Name:    "GetSymbolSources",
+		Method:  []string{"GET"},
+		Pattern: "/branches/{name}/sources/{hash}/{file}",
+		Handler: v1.RestSymbolSources,
+	},
+	{
+		Name:    "BuildByKey",
+		Method:  []string{"GET"},
+		Pattern: "/builds/{key}",
+		Handler: v1.RestBuildByKey,
+	},
+	// resource style api for tooling, mutations accept the zone credentials besides login
+	{
+		Name:    "ListBranchesV1",
+		Method:  []string{"GET"},
+		Pattern: "/v1/branches",
+		Handler: v1.RestBranchList,
+	},
+	{
+		Name:    "CreateBranchV1",
+		Method:  []string{"POST"},
+		Pattern: "/v1/branches",
+		Handler: v1.PostBranch,
+		Role:    auth.RoleAdmin,
+	},
+	{
+		Name:    "ImportBranchesV1",
+		Method:  []string{"POST"},
+		Pattern: "/v1/branches/import",
+		Handler: v1.ImportBranches,
+		Role:    auth.RoleAdmin,
+	},
+	{
+		Name:    "GetBranchV1",
+		Method:  []string{"GET"},
+		Pattern: "/v1/branches/{name}",
+		Handler: v1.RestBranch,
+	},
+	{
+		Name:    "ModifyBranchV1",
+		Method:  []string{"PUT"},
+		Pattern: "/v1/branches/{name}",
+		Handler: v1.PutBranch,
+		Role:    auth.RoleAdmin,
+	},
+	{
+		Name:    "DeleteBranchV1",
+		Method:  []string{"DELETE"},
+		Pattern: "/v1/branches/{name}",
+		Handler: v1.RemoveBranch,
+		Role:    auth.RoleAdmin,
+	},
+	{
+		Name:    "ListBuildsV1",
+		Method:  []string{"GET"},
+		Pattern: "/v1/branches/{name}/builds",
+		Handler: v1.RestBuildList,
+	},
+	{
+		Name:    "AddBuildV1",
+		Method:  []string{"POST"},
+		Pattern: "/v1/branches/{name}/builds",
+		Handler: v1.PostBuild,
+		Role:    auth.RoleUploader,
+	},
+	{
+		Name:    "CIWebhookV1",
+		Method:  []string{"POST"},
+		Pattern: "/v1/hooks",
+		Handler: v1.CIWebhook,
+	},
+	{
+		Name:    "GetBuildV1",
+		Method:  []string{"GET"},
+		Pattern: "/v1/branches/{name}/builds/{bid}",
+		Handler: v1.RestBuild,
+	},
+	{
+		Name:    "ListSymbolsV1",
+		Method:  []string{"GET"},
+		Pattern: "/v1/branches/{name}/builds/{bid}/symbols",
+		Handler: v1.RestSymbolList,
+	},
+	{
+		Name:    "UploadSymbolsV1",
+		Method:  []string{"POST"},
+		Pattern: "/v1/branches/{name}/builds/{version}/symbols",
+		Handler: v1.PostSymbols,
+		Role:    auth.RoleUploader,
+	},
+	{
+		Name:    "SearchSymbols",
+		Method:  []string{"GET"},
+		Pattern: "/symbols/search",
+		Handler: v1.SearchSymbols,
+	},
+	{
+		Name:    "GetSymbolCache",
+		Method:  []string{"GET"},
+		Pattern: "/symbols/cache",
+		Handler: v1.RestSymbolCache,
+	},
+	{
+		Name:    "WhoShips",
 		Method:  []string{"GET"},
+		Pattern: "/symbols/{name}/branches",
+		Handler: v1.WhoShips,
+	},
+	{
+		Name:    "SymbolsExist",
+		Method:  []string{"POST"},
+		Pattern: "/symbols/exists",
+		Handler: v1.SymbolsExist,
+		Role:    auth.RoleViewer,
+	},
+	{
+		Name:    "SymbolGaps",
+		Method:  []string{"POST"},
+		Pattern: "/symbols/gaps",
+		Handler: v1.SymbolGaps,
+		Role:    auth.RoleViewer,
+	},
+	{
+		Name:    "DownloadSymbol",
+		Method:  []string{"GET", "HEAD"},
 		Pattern: "/symbol/{branch}/{hash}/{name}",
-		Handler: v1.DownloadSymbol,
+		Handler: SiteHandler(v1.DownloadSymbol),
+	},
+	{
+		Name:    "DownloadBuildID",
+		Method:  []string{"GET", "HEAD"},
+		Pattern: "/buildid/{id}/{kind}",
+		Handler: v1.DownloadBuildID,
+	},
+	{
+		Name:    "DownloadBreakpad",
+		Method:  []string{"GET", "HEAD"},
+		Pattern: "/breakpad/{file}/{id}/{sym}",
+		Handler: v1.DownloadBreakpad,
+	},
+	{
+		Name:    "SymbolChecksum",
+		Method:  []string{"GET"},
+		Pattern: "/symbol/{branch}/{hash}/{name}/checksum",
+		Handler: v1.SymbolChecksum,
+	},
+	{
+		Name:    "CreatePermalink",
+		Method:  []string{"POST"},
+		Pattern: "/permalinks",
+		Handler: v1.CreatePermalink,
+		Role:    auth.RoleViewer,
+	},
+	{
+		Name:    "ResolvePermalink",
+		Method:  []string{"GET"},
+		Pattern: "/permalinks/{id}",
+		Handler: v1.ResolvePermalink,
+	},
+	{
+		Name:    "GetAlertList",
+		Method:  []string{"GET"},
+		Pattern: "/alerts",
+		Handler: v1.RestAlertList,
+	},
+	{
+		Name:    "GetAuditList",
+		Method:  []string{"GET"},
+		Pattern: "/audit",
+		Handler: v1.RestAuditList,
+	},
+	{
+		Name:    "GetEvents",
+		Method:  []string{"GET"},
+		Pattern: "/events",
+		Handler: v1.RestEvents,
+	},
+	{
+		Name:    "GetEventCursors",
+		Method:  []string{"GET"},
+		Pattern: "/events/cursors",
+		Handler: v1.RestEventCursors,
+	},
+	{
+		Name:    "RewindEventCursor",
+		Method:  []string{"POST"},
+		Pattern: "/events/cursors",
+		Handler: v1.RewindEventCursor,
+		Role:    auth.RoleAdmin,
+	},
+	{
+		Name:    "GetSchedule",
+		Method:  []string{"GET"},
+		Pattern: "/schedule",
+		Handler: v1.RestSchedule,
+	},
+	{
+		Name:    "GetQuarantine",
+		Method:  []string{"GET"},
+		Pattern: "/quarantine",
+		Handler: v1.RestQuarantine,
+	},
+	{
+		Name:    "GetActivity",
+		Method:  []string{"GET"},
+		Pattern: "/activity",
+		Handler: v1.RestActivity,
+	},
+	{
+		Name:    "GetSymbolHeatmap",
+		Method:  []string{"GET"},
+		Pattern: "/activity/heatmap",
+		Handler: v1.RestHeatmap,
+	},
+	{
+		Name:    "GetIngestTimings",
+		Method:  []string{"GET"},
+		Pattern: "/ingest/timings",
+		Handler: v1.RestIngestTimings,
+	},
+	{
+		Name:    "GetShadowReports",
+		Method:  []string{"GET"},
+		Pattern: "/ingest/shadow",
+		Handler: v1.RestShadowReports,
+	},
+	{
+		Name:    "GetIngestSLO",
+		Method:  []string{"GET"},
+		Pattern: "/ingest/slo",
+		Handler: v1.RestIngestSLO,
+	},
+	{
+		Name:    "GetIngestStatus",
+		Method:  []string{"GET"},
+		Pattern: "/ingest/status",
+		Handler: v1.RestIngestStatus,
+	},
+	{
+		Name:    "ListJobs",
+		Method:  []string{"GET"},
+		Pattern: "/jobs",
+		Handler: v1.RestJobs,
+	},
+	{
+		Name:    "GetJob",
+		Method:  []string{"GET"},
+		Pattern: "/jobs/{id}",
+		Handler: v1.RestJob,
+	},
+	{
+		Name:    "CancelJob",
+		Method:  []string{"DELETE"},
+		Pattern: "/jobs/{id}",
+		Handler: v1.CancelJob,
+		Role:    auth.RoleUploader,
+	},
+	{
+		Name:    "GetShareHealth",
+		Method:  []string{"GET"},
+		Pattern: "/shares",
+		Handler: v1.RestShareHealth,
+	},
+	{
+		Name:    "GetLegalHolds",
+		Method:  []string{"GET"},
+		Pattern: "/holds",
+		Handler: v1.RestLegalHolds,
+	},
+	{
+		Name:    "GetReport",
+		Method:  []string{"GET"},
+		Pattern: "/report",
+		Handler: v1.RestReport,
+	},
+	{
+		Name:    "GraphQL",
+		Method:  []string{"POST"},
+		Pattern: "/graphql",
+		Handler: v1.GraphQL,
+		Role:    auth.RoleViewer,
+	},
+	{
+		Name:    "TakeSnapshot",
+		Method:  []string{"POST"},
+		Pattern: "/snapshot",
+		Handler: v1.TakeSnapshot,
+		Role:    auth.RoleAdmin,
+	},
+	{
+		Name:    "ReleaseSnapshot",
+		Method:  []string{"DELETE"},
+		Pattern: "/snapshot",
+		Handler: v1.ReleaseSnapshot,
+		Role:    auth.RoleAdmin,
+	},
+	{
+		Name:    "MountArchive",
+		Method:  []string{"POST"},
+		Pattern: "/archives",
+		Handler: v1.MountArchive,
+		Role:    auth.RoleAdmin,
+	},
+	{
+		Name:    "UnmountArchive",
+		Method:  []string{"DELETE"},
+		Pattern: "/archives/{name}",
+		Handler: v1.UnmountArchive,
+		Role:    auth.RoleAdmin,
+	},
+	{
+		Name:    "GetFederationPeers",
+		Method:  []string{"GET"},
+		Pattern: "/federation/peers",
+		Handler: v1.RestFederationPeers,
 	},
 	{
 		Name:    "FetchTodayMessage",
@@ -137,7 +723,18 @@ func NewRouter() *mux.Router {
 
 	// restful api handler
 	for _, route := range apiRoutes {
-		logHandler := LogHandler(route.Handler, route.Name)
+		var handler http.Handler = route.Handler
+		if replicaRoutes[route.Name] {
+			handler = ReplicaHandler(handler)
+		}
+		if federatedRoutes[route.Name] {
+			handler = FederateHandler(handler)
+		}
+		handler = IdempotentHandler(handler)
+		if route.Role != "" {
+			handler = RoleHandler(route.Role, handler)
+		}
+		logHandler := LogHandler(CsrfHandler(handler), route.Name)
 		router.PathPrefix("/api/").
 			Methods(route.Method...).
 			Path(route.Pattern).
@@ -145,5 +742,19 @@ func NewRouter() *mux.Router {
 			Name(route.Name)
 	}
 
+	// symsrv protocol over all branches, eg: _NT_SYMBOL_PATH=srv*C:\Symbols*http://server/symbols
+	router.
+		Methods("GET", "HEAD").
+		Path("/symbols/{name}/{hash}/{file}").
+		Handler(LogHandler(http.HandlerFunc(v1.SymSrvSymbol), "SymSrvSymbol")).
+		Name("SymSrvSymbol")
+
+	// branches exposed as symstore shares, after api so a virtual directory never shadow it
+	router.
+		Methods("GET", "HEAD").
+		Path("/{dir}/{name}/{hash}/{file}").
+		Handler(LogHandler(http.HandlerFunc(v1.VirtualDirSymbol), "VirtualDirSymbol")).
+		Name("VirtualDirSymbol")
+
 	return router
 }
@@ -0,0 +1,91 @@
+package route
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/adyzng/GoSymbols/config"
+	"github.com/gorilla/mux"
+)
+
+func TestVirtualDirRoute(t *testing.T) {
+	router := NewRouter()
+	for path, expect := range map[string]string{
+		"/api/buildid/5f0a3c/executable":       "DownloadBuildID",
+		"/api/symbol/UDP/ABC1/foo.pdb":         "DownloadSymbol",
+		"/UDPMAIN/foo.pdb/ABC1/foo.pdb":        "VirtualDirSymbol",
+		"/symbols/foo.pdb/ABC1/foo.pd_":        "SymSrvSymbol",
+		"/static/js/app.js":                    "", // unnamed static route
+		"/UDPMAIN/foo.pdb/ABC1/foo.pdb/extra/": "",
+	} {
+		var m mux.RouteMatch
+		name := ""
+		if router.Match(httptest.NewRequest("GET", path, nil), &m) && m.Route != nil {
+			name = m.Route.GetName()
+		}
+		if name != expect {
+			t.Errorf("%s: expect route %q, got %q", path, expect, name)
+		}
+	}
+}
+
+func TestResourceRoutes(t *testing.T) {
+	router := NewRouter()
+	for _, c := range []struct{ method, path, expect string }{
+		{"GET", "/api/v1/branches", "ListBranchesV1"},
+		{"POST", "/api/v1/branches", "CreateBranchV1"},
+		{"PUT", "/api/v1/branches/UDP", "ModifyBranchV1"},
+		{"DELETE", "/api/v1/branches/UDP", "DeleteBranchV1"},
+		{"POST", "/api/v1/branches/UDP/builds", "AddBuildV1"},
+		{"GET", "/api/v1/branches/UDP/builds/0000000012", "GetBuildV1"},
+		{"GET", "/api/v1/branches/UDP/builds/0000000012/symbols", "ListSymbolsV1"},
+		{"GET", "/api/branches/UDP/0000000012", "GetSymbolList"},
+	} {
+		var m mux.RouteMatch
+		name := ""
+		if router.Match(httptest.NewRequest(c.method, c.path, nil), &m) && m.Route != nil {
+			name = m.Route.GetName()
+		}
+		if name != c.expect {
+			t.Errorf("%s %s: expect route %q, got %q", c.method, c.path, c.expect, name)
+		}
+	}
+}
+
+func TestResourceAuth(t *testing.T) {
+	defer func(admin, tokens []string) { config.AuthAdmin, config.AuthTokens = admin, tokens }(config.AuthAdmin, config.AuthTokens)
+	config.AuthAdmin, config.AuthTokens = []string{"token", "ip"}, []string{"7f3c9a2e"}
+	config.AuthAllowIPs = []string{"192.0.2.0/24"}
+	defer func() { config.AuthAllowIPs = nil }()
+	h := ZoneHandler(NewRouter())
+
+	// granted by network alone, but nobody to record as the user
+	w := httptest.NewRecorder()
+	h.ServeHTTP(w, httptest.NewRequest("POST", "/api/v1/branches", strings.NewReader("{")))
+	if w.Code != http.StatusUnauthorized {
+		t.Errorf("expect 401 without credential, got %d", w.Code)
+	}
+
+	w = httptest.NewRecorder()
+	h.ServeHTTP(w, httptest.NewRequest("POST", "/token/7f3c9a2e/api/v1/branches", strings.NewReader("{")))
+	if w.Code != http.StatusBadRequest {
+		t.Errorf("expect token accepted and body refused, got %d", w.Code)
+	}
+}
+
+func TestMutatingRoutesRole(t *testing.T) {
+	// these check the caller themselves: login, and CI webhooks by signature or uploader role
+	selfAuth := map[string]bool{"Authorize": true, "CIWebhookV1": true}
+	for _, route := range apiRoutes {
+		if route.Role != "" || selfAuth[route.Name] {
+			continue
+		}
+		for _, method := range route.Method {
+			if method != "GET" && method != "HEAD" {
+				t.Errorf("%s %s /api%s has no role", route.Name, method, route.Pattern)
+			}
+		}
+	}
+}
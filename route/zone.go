@@ -0,0 +1,190 @@
+package route
+
+import (
+	"crypto/subtle"
+	"net"
+	"net/http"
+	"strings"
+
+	"github.com/adyzng/GoSymbols/config"
+	"github.com/adyzng/GoSymbols/restful/auth"
+	"github.com/adyzng/GoSymbols/site"
+
+	clog "gopkg.in/clog.v1"
+)
+
+// Auth zones, each has its own policy in `[auth]`
+const (
+	ZoneSymbols = "symbols" // symbol downloads, debuggers can't login by oauth
+	ZoneBrowse  = "browse"  // GET api
+	ZoneAdmin   = "admin"   // mutating api
+)
+
+// Auth methods of zone policy, any of them grant access, see also AuthNegotiate
+const (
+	AuthAnonymous = "anonymous"
+	AuthSession   = "session" // logined by oauth, session cookie
+	AuthBasic     = "basic"   // `[auth] USERS` or LDAP_URL
+	AuthToken     = "token"   // `[auth] TOKENS`
+	AuthIP        = "ip"      // `[auth] ALLOW_IPS`
+)
+
+const tokenPrefix = "/token/"
+
+// authZone return zone of request, empty for pages and oauth which are never restricted.
+//
+func authZone(path, method string) string {
+	switch {
+	case strings.HasPrefix(path, "/api/auth/"):
+		return ""
+	case path == "/api/v1/hooks" && config.HookSecret != "":
+		return "" // CI systems sign by `[hooks] SECRET` instead
+	case strings.HasPrefix(path, "/api/symbol/"), strings.HasPrefix(path, "/api/buildid/"), strings.HasPrefix(path, "/symbols/"):
+		return ZoneSymbols
+	case strings.HasPrefix(path, "/api/"):
+		if method == "GET" || method == "HEAD" {
+			return ZoneBrowse
+		}
+		return ZoneAdmin
+	case strings.HasPrefix(path, "/static/"):
+		return ""
+	case path == "/metrics":
+		return ZoneBrowse
+	}
+	// `/{dir}/{name}/{hash}/{file}` of branches exposed as symstore share
+	if strings.Count(strings.Trim(path, "/"), "/") == 3 {
+		return ZoneSymbols
+	}
+	return ""
+}
+
+// zonePolicy return methods accepted by `zone`, empty for no restriction
+func zonePolicy(zone string) []string {
+	switch zone {
+	case ZoneSymbols:
+		return config.AuthSymbols
+	case ZoneBrowse:
+		return config.AuthBrowse
+	case ZoneAdmin:
+		return config.AuthAdmin
+	}
+	return nil
+}
+
+// stripToken remove `/token/{token}` from the front of path, debuggers can only be given a
+// base url, eg: srv*C:\Symbols*http://server/token/{token}/symbols
+func stripToken(r *http.Request) string {
+	if !strings.HasPrefix(r.URL.Path, tokenPrefix) {
+		return ""
+	}
+	rest := r.URL.Path[len(tokenPrefix):]
+	i := strings.Index(rest, "/")
+	if i <= 0 {
+		return ""
+	}
+	r.URL.Path = rest[i:]
+	r.URL.RawPath = ""
+	r.RequestURI = r.URL.RequestURI() // keep the token out of access log
+	return rest[:i]
+}
+
+// requestToken return token of request from path, query or bearer header
+func requestToken(r *http.Request, pathToken string) string {
+	if pathToken != "" {
+		return pathToken
+	}
+	if tok := r.URL.Query().Get("token"); tok != "" {
+		return tok
+	}
+	if h := r.Header.Get("Authorization"); strings.HasPrefix(h, "Bearer ") {
+		return strings.TrimSpace(h[len("Bearer "):])
+	}
+	return ""
+}
+
+func validToken(token string) bool {
+	if token == "" {
+		return false
+	}
+	ok := false
+	for _, t := range config.AuthTokens {
+		if t = strings.TrimSpace(t); t != "" && subtle.ConstantTimeCompare([]byte(t), []byte(token)) == 1 {
+			ok = true
+		}
+	}
+	return ok
+}
+
+func allowedIP(ip net.IP) bool {
+	if ip == nil {
+		return false
+	}
+	for _, cidr := range config.AuthAllowIPs {
+		if _, network, err := net.ParseCIDR(strings.TrimSpace(cidr)); err == nil && network.Contains(ip) {
+			return true
+		}
+	}
+	return false
+}
+
+// ZoneHandler check request against the policy of its zone in `[auth]`, so symbol downloads
+// can accept basic auth, token in url or client address which debuggers can give, while
+// the api keep requiring login. Zones without policy are left to the handlers.
+//
+func ZoneHandler(h http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		pathToken := stripToken(r)
+		zone := authZone(r.URL.Path, r.Method)
+		policy := zonePolicy(zone)
+		if len(policy) == 0 || r.Method == "OPTIONS" {
+			h.ServeHTTP(w, r)
+			return
+		}
+
+		var basic, integrated bool
+		for _, m := range policy {
+			var id *auth.Identity
+			switch m = strings.ToLower(strings.TrimSpace(m)); m {
+			case AuthAnonymous:
+				id = &auth.Identity{}
+			case AuthSession:
+				id = auth.SessionIdentity(r)
+			case AuthNegotiate:
+				integrated = true
+				var challenged bool
+				if id, challenged = negotiate(w, r); challenged {
+					return
+				}
+			case AuthBasic:
+				basic = true
+				id = auth.BasicIdentity(r)
+			case AuthToken:
+				if validToken(requestToken(r, pathToken)) {
+					id = &auth.Identity{}
+				}
+			case AuthIP:
+				if allowedIP(site.Get().ClientIP(r)) {
+					id = &auth.Identity{}
+				}
+			}
+			if id != nil {
+				if id.Method == "" {
+					id.Method = m
+				}
+				h.ServeHTTP(w, auth.WithIdentity(r, id))
+				return
+			}
+		}
+
+		clog.Warn("[Auth] Deny %s %s in zone %s from %s.", r.Method, r.URL.Path, zone, r.RemoteAddr)
+		// debuggers authenticate or prompt for credentials on the challenges
+		if integrated {
+			w.Header().Add("WWW-Authenticate", "Negotiate")
+			w.Header().Add("WWW-Authenticate", "NTLM")
+		}
+		if basic {
+			w.Header().Add("WWW-Authenticate", `Basic realm="`+config.AppName+`"`)
+		}
+		w.WriteHeader(http.StatusUnauthorized)
+	})
+}
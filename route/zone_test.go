@@ -0,0 +1,118 @@
+package route
+
+import (
+	"encoding/base64"
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/adyzng/GoSymbols/config"
+)
+
+func TestZoneHandler(t *testing.T) {
+	defer func(sym, admin, users, tokens, ips []string) {
+		config.AuthSymbols, config.AuthAdmin, config.AuthUsers, config.AuthTokens, config.AuthAllowIPs = sym, admin, users, tokens, ips
+	}(config.AuthSymbols, config.AuthAdmin, config.AuthUsers, config.AuthTokens, config.AuthAllowIPs)
+	config.AuthSymbols = []string{"basic", "token", "ip"}
+	config.AuthAdmin = []string{"ip"}
+	// bcrypt of "password"
+	config.AuthUsers = []string{"windbg:$2a$04$BDzli4SpgwcFGU8GLyQNpesvynjQBfy/Z6A28Ka.WzWF7wbzK/OaW"}
+	config.AuthTokens = []string{"s3cret"}
+	config.AuthAllowIPs = []string{"10.20.0.0/16"}
+
+	var served string
+	h := ZoneHandler(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) { served = r.URL.Path }))
+	cases := []struct {
+		path, remote, user, pass string
+		method                   string
+		code                     int
+		served                   string
+	}{
+		{"/symbols/foo.pdb/ABC1/foo.pdb", "192.168.1.1:1000", "", "", "GET", 401, ""},
+		{"/symbols/foo.pdb/ABC1/foo.pdb", "192.168.1.1:1000", "windbg", "password", "GET", 200, "/symbols/foo.pdb/ABC1/foo.pdb"},
+		{"/symbols/foo.pdb/ABC1/foo.pdb", "192.168.1.1:1000", "windbg", "wrong", "GET", 401, ""},
+		{"/token/s3cret/symbols/foo.pdb/ABC1/foo.pdb", "192.168.1.1:1000", "", "", "GET", 200, "/symbols/foo.pdb/ABC1/foo.pdb"},
+		{"/token/other/UDP/foo.pdb/ABC1/foo.pdb", "192.168.1.1:1000", "", "", "GET", 401, ""},
+		{"/api/symbol/UDP/ABC1/foo.pdb?token=s3cret", "192.168.1.1:1000", "", "", "GET", 200, "/api/symbol/UDP/ABC1/foo.pdb"},
+		{"/UDP/foo.pdb/ABC1/foo.pdb", "10.20.1.1:1000", "", "", "GET", 200, "/UDP/foo.pdb/ABC1/foo.pdb"},
+		{"/api/branches", "192.168.1.1:1000", "", "", "GET", 200, "/api/branches"},
+		{"/api/branches/UDP/seal", "192.168.1.1:1000", "", "", "POST", 401, ""},
+		{"/api/auth/login", "192.168.1.1:1000", "", "", "POST", 200, "/api/auth/login"},
+	}
+	for _, c := range cases {
+		served = ""
+		r := httptest.NewRequest(c.method, c.path, nil)
+		r.RemoteAddr = c.remote
+		if c.user != "" {
+			r.SetBasicAuth(c.user, c.pass)
+		}
+		w := httptest.NewRecorder()
+		h.ServeHTTP(w, r)
+		if w.Code != c.code || served != c.served {
+			t.Errorf("%s %s: expect %d %q, got %d %q", c.method, c.path, c.code, c.served, w.Code, served)
+		}
+		if w.Code == 401 && w.Header().Get("WWW-Authenticate") == "" && c.method == "GET" {
+			t.Errorf("%s: expect basic challenge", c.path)
+		}
+	}
+}
+
+func TestZoneNegotiate(t *testing.T) {
+	defer func(sym []string) { config.AuthSymbols = sym }(config.AuthSymbols)
+	config.AuthSymbols = []string{"negotiate"}
+
+	h := ZoneHandler(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {}))
+	r := httptest.NewRequest("GET", "/symbols/foo.pdb/ABC1/foo.pdb", nil)
+	w := httptest.NewRecorder()
+	h.ServeHTTP(w, r)
+	if w.Code != http.StatusUnauthorized || len(w.Header()["Www-Authenticate"]) != 2 {
+		t.Errorf("expect Negotiate and NTLM challenges, got %d %v", w.Code, w.Header())
+	}
+
+	scheme, token := negotiateScheme(func() *http.Request {
+		r := httptest.NewRequest("GET", "/symbols/", nil)
+		r.Header.Set("Authorization", "Negotiate TlRMTVNTUAABAAAA")
+		return r
+	}())
+	if scheme != "Negotiate" || string(token[:7]) != "NTLMSSP" {
+		t.Errorf("unexpected scheme %s token %q", scheme, token)
+	}
+}
+
+func TestNegotiations(t *testing.T) {
+	c, peer := net.Pipe()
+	defer c.Close()
+	defer peer.Close()
+
+	r := httptest.NewRequest("GET", "/symbols/", nil)
+	if negotiationKey(r) != r.RemoteAddr {
+		t.Errorf("expect remote address without connection")
+	}
+	r = r.WithContext(ConnContext(r.Context(), c))
+	if negotiationKey(r) != c {
+		t.Errorf("expect handshake kept per connection")
+	}
+
+	stale := &negotiation{conn: &negotiateConn{}, used: time.Now().Add(-2 * negotiateTimeout)}
+	open := &negotiation{conn: &negotiateConn{}, used: time.Now()}
+	negotiateMx.Lock()
+	negotiations["192.0.2.1:1234"], negotiations[c] = stale, open
+	negotiateMx.Unlock()
+
+	// abandoned handshakes expire, the one of closed connection is dropped
+	r = httptest.NewRequest("GET", "/symbols/", nil)
+	r.Header.Set("Authorization", "NTLM "+base64.StdEncoding.EncodeToString([]byte("bad")))
+	negotiate(httptest.NewRecorder(), r)
+	ConnState(c, http.StateClosed)
+	negotiateMx.Lock()
+	left := len(negotiations)
+	negotiateMx.Unlock()
+	if left != 0 || !stale.closed || !open.closed {
+		t.Errorf("expect handshakes dropped, %d left", left)
+	}
+	if _, _, err := open.step([]byte("x")); err != errNegotiationClosed {
+		t.Errorf("expect closed handshake refused, got %v", err)
+	}
+}
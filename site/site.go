@@ -0,0 +1,146 @@
+// Package site answer symbol downloads with a redirect to the replica nearest the client,
+// by a static mapping of client CIDRs to sites, so WAN downloads stay off the primary.
+//
+package site
+
+import (
+	"net"
+	"net/http"
+	"strings"
+	"sync"
+
+	"github.com/adyzng/GoSymbols/config"
+	log "gopkg.in/clog.v1"
+)
+
+// HeaderReplica mark requests sent by a replica reading through from the primary,
+// they are never redirected so a replica missing the file won't loop.
+const HeaderReplica = "X-GoSymbols-Replica"
+
+var (
+	router *Router
+	once   sync.Once
+)
+
+// Site is a group of client networks served by one replica
+//
+type Site struct {
+	Name    string   `json:"name"`
+	Replica string   `json:"replica"` // base url, eg: http://symbols-sh:8080
+	CIDRs   []string `json:"cidrs"`
+	nets    []*net.IPNet
+}
+
+// Router pick the site of client address
+//
+type Router struct {
+	sites          []*Site
+	trustForwarded bool
+}
+
+// Get return single instance of router with `[routing]` config.
+//
+func Get() *Router {
+	once.Do(func() {
+		router = New(config.RoutingSites, config.RoutingReplicas, config.RoutingTrustForwarded)
+	})
+	return router
+}
+
+// New parse `sites` as `{name}:{cidr}|{cidr}` and `replicas` as `{name}:{url}`. Sites
+// without replica or valid network are dropped.
+//
+func New(sites, replicas []string, trustForwarded bool) *Router {
+	urls := make(map[string]string, len(replicas))
+	for _, r := range replicas {
+		kv := strings.SplitN(strings.TrimSpace(r), ":", 2)
+		if len(kv) == 2 {
+			urls[strings.ToLower(kv[0])] = strings.TrimRight(strings.TrimSpace(kv[1]), "/")
+		}
+	}
+
+	rt := &Router{trustForwarded: trustForwarded}
+	for _, s := range sites {
+		kv := strings.SplitN(strings.TrimSpace(s), ":", 2)
+		if len(kv) != 2 {
+			continue
+		}
+		site := &Site{Name: kv[0], Replica: urls[strings.ToLower(kv[0])]}
+		if site.Replica == "" {
+			log.Warn("[Site] No replica for site %s.", site.Name)
+			continue
+		}
+		for _, cidr := range strings.Split(kv[1], "|") {
+			_, ipnet, err := net.ParseCIDR(strings.TrimSpace(cidr))
+			if err != nil {
+				log.Warn("[Site] Invalid network %s of site %s: %v.", cidr, site.Name, err)
+				continue
+			}
+			site.CIDRs = append(site.CIDRs, ipnet.String())
+			site.nets = append(site.nets, ipnet)
+		}
+		if len(site.nets) > 0 {
+			rt.sites = append(rt.sites, site)
+		}
+	}
+	return rt
+}
+
+// Enabled return true if any site configured.
+func (rt *Router) Enabled() bool {
+	return len(rt.sites) > 0
+}
+
+// Sites return configured sites
+func (rt *Router) Sites() []*Site {
+	return rt.sites
+}
+
+// ClientIP of request, the first address of X-Forwarded-For if it's trusted.
+func (rt *Router) ClientIP(r *http.Request) net.IP {
+	if rt.trustForwarded {
+		if fwd := r.Header.Get("X-Forwarded-For"); fwd != "" {
+			if ip := net.ParseIP(strings.TrimSpace(strings.Split(fwd, ",")[0])); ip != nil {
+				return ip
+			}
+		}
+	}
+	host, _, err := net.SplitHostPort(r.RemoteAddr)
+	if err != nil {
+		host = r.RemoteAddr
+	}
+	return net.ParseIP(host)
+}
+
+// Nearest return the site with the most specific network containing `ip`, nil if none.
+//
+func (rt *Router) Nearest(ip net.IP) *Site {
+	var (
+		found *Site
+		best  = -1
+	)
+	if ip == nil {
+		return nil
+	}
+	for _, site := range rt.sites {
+		for _, ipnet := range site.nets {
+			if ones, _ := ipnet.Mask.Size(); ipnet.Contains(ip) && ones > best {
+				found, best = site, ones
+			}
+		}
+	}
+	return found
+}
+
+// Redirect return the url on the nearest replica for request, empty if served locally.
+//
+func (rt *Router) Redirect(r *http.Request) string {
+	if !rt.Enabled() || r.Header.Get(HeaderReplica) != "" {
+		return ""
+	}
+	site := rt.Nearest(rt.ClientIP(r))
+	if site == nil {
+		return ""
+	}
+	return site.Replica + r.URL.RequestURI()
+}
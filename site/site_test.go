@@ -0,0 +1,50 @@
+package site
+
+import (
+	"net/http/httptest"
+	"testing"
+)
+
+func TestRedirect(t *testing.T) {
+	rt := New(
+		[]string{"sh:10.20.0.0/16|10.21.0.0/16", "lab:10.20.5.0/24", "us:10.30.0.0/16", "bad:nonsense", "eu:10.40.0.0/16"},
+		[]string{"sh:http://symbols-sh:8090/", "LAB:http://lab:8090", "us:http://symbols-us:8090"},
+		false,
+	)
+	if len(rt.Sites()) != 3 {
+		t.Fatalf("expect sites without replica or network dropped, got %d", len(rt.Sites()))
+	}
+
+	cases := map[string]string{
+		"10.21.3.4:50000": "http://symbols-sh:8090/api/symbol/UDP/ABC1/foo.pdb",
+		"10.20.5.9:50000": "http://lab:8090/api/symbol/UDP/ABC1/foo.pdb", // most specific wins
+		"10.30.0.1:50000": "http://symbols-us:8090/api/symbol/UDP/ABC1/foo.pdb",
+		"10.40.0.1:50000": "",
+		"10.99.0.1:50000": "",
+	}
+	for addr, expect := range cases {
+		r := httptest.NewRequest("GET", "/api/symbol/UDP/ABC1/foo.pdb", nil)
+		r.RemoteAddr = addr
+		if got := rt.Redirect(r); got != expect {
+			t.Errorf("client %s: expect %q, got %q", addr, expect, got)
+		}
+	}
+
+	r := httptest.NewRequest("GET", "/api/symbol/UDP/ABC1/foo.pdb", nil)
+	r.RemoteAddr = "10.21.3.4:50000"
+	r.Header.Set(HeaderReplica, "1")
+	if got := rt.Redirect(r); got != "" {
+		t.Fatalf("expect replica read through served locally, got %s", got)
+	}
+
+	r = httptest.NewRequest("GET", "/api/symbol/UDP/ABC1/foo.pdb", nil)
+	r.RemoteAddr = "192.168.0.1:50000"
+	r.Header.Set("X-Forwarded-For", "10.30.1.1, 192.168.0.1")
+	if got := rt.Redirect(r); got != "" {
+		t.Fatalf("expect forwarded address ignored, got %s", got)
+	}
+	rt.trustForwarded = true
+	if got := rt.Redirect(r); got != cases["10.30.0.1:50000"] {
+		t.Fatalf("expect trusted forwarded address routed to us, got %s", got)
+	}
+}
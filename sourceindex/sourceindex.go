@@ -0,0 +1,272 @@
+// Package sourceindex embed srcsrv streams into pdb files at ingest, so debuggers fetch the
+// sources of a build from the source server (Git or SVN web) over http instead of looking
+// for the paths of the build machine.
+//
+package sourceindex
+
+import (
+	"bytes"
+	"fmt"
+	"io/ioutil"
+	"net/url"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"strings"
+	"time"
+
+	"github.com/adyzng/GoSymbols/config"
+	"github.com/adyzng/GoSymbols/pdb"
+)
+
+var (
+	ErrURL         = fmt.Errorf("source server url must be http(s) with {path}")
+	ErrTranslation = fmt.Errorf("path translation must be {build path}={repository path}")
+)
+
+// Config of source indexing. `{branch}`, `{version}` and `{revision}` are replaced in URL
+// and Revision, `{path}` in URL is the source path under Roots with forward slashes, or
+// the path given by the first of Translations matching it.
+//
+type Config struct {
+	URL          string   `json:"url"`                    // eg: https://git.example.com/udp/raw/{revision}/{path}
+	Revision     string   `json:"revision,omitempty"`     // eg: release/{version}, default {version}, `revision` of build-info.json first
+	Roots        []string `json:"roots,omitempty"`        // source roots on build machine, eg: S:\src, files out of them are not indexed
+	Translations []string `json:"translations,omitempty"` // `{build path}={repository path}`, eg: D:\agent\_work\1\s=udp/src
+}
+
+// SourceFile is a source file compiled into a pdb, with its path in the repository
+//
+type SourceFile struct {
+	Path       string `json:"path"`                 // as recorded on the build machine
+	Translated string `json:"translated,omitempty"` // path in the repository, empty if out of Roots and Translations
+	URL        string `json:"url,omitempty"`        // on the source server
+}
+
+// Result of indexing an unzipped build
+//
+type Result struct {
+	PDBs    int      `json:"pdbs"`
+	Indexed int      `json:"indexed"` // pdbs with srcsrv stream written
+	Files   int      `json:"files"`   // source files mapped to the source server
+	Failed  []string `json:"failed,omitempty"`
+}
+
+// Default return the config of `[srcsrv]`, nil if no source server is configured.
+//
+func Default() *Config {
+	if config.SrcSrvURL == "" && len(config.SrcSrvTranslations) == 0 {
+		return nil
+	}
+	return &Config{
+		URL:          config.SrcSrvURL,
+		Revision:     config.SrcSrvRevision,
+		Roots:        config.SrcSrvRoots,
+		Translations: config.SrcSrvTranslations,
+	}
+}
+
+// Check validate config of a branch, nil for `[srcsrv]`. Url may be empty if only paths
+// are translated, then pdbs are not indexed.
+//
+func Check(c *Config) error {
+	if c == nil {
+		return nil
+	}
+	for _, t := range c.Translations {
+		if idx := strings.LastIndex(t, "="); idx < 1 {
+			return ErrTranslation
+		}
+	}
+	if c.URL == "" && len(c.Translations) > 0 {
+		return nil
+	}
+	u, err := url.Parse(c.URL)
+	if err != nil || (u.Scheme != "http" && u.Scheme != "https") || !strings.Contains(c.URL, "{path}") {
+		return ErrURL
+	}
+	return nil
+}
+
+// expand replace `{name}` of vars in template
+func expand(template string, vars map[string]string) string {
+	for k, v := range vars {
+		template = strings.Replace(template, "{"+k+"}", v, -1)
+	}
+	return template
+}
+
+// trimPrefix return `norm` under build path `prefix` with forward slashes, false if it's not
+func trimPrefix(norm, prefix string) (string, bool) {
+	prefix = strings.TrimRight(strings.Replace(strings.TrimSpace(prefix), "/", "\\", -1), "\\") + "\\"
+	if len(prefix) > 1 && len(norm) > len(prefix) && strings.EqualFold(norm[:len(prefix)], prefix) {
+		return strings.Replace(norm[len(prefix):], "\\", "/", -1), true
+	}
+	return "", false
+}
+
+// Translate return the repository path of source `src` recorded on the build machine, by
+// the first of Translations matching it, otherwise relative to the first root containing
+// it. False if it's out of all of them, eg: SDK headers.
+//
+func (c *Config) Translate(src string) (string, bool) {
+	norm := strings.Replace(src, "/", "\\", -1)
+	for _, t := range c.Translations {
+		idx := strings.LastIndex(t, "=")
+		if idx < 1 {
+			continue
+		}
+		if rest, ok := trimPrefix(norm, t[:idx]); ok {
+			to := strings.Trim(strings.Replace(strings.TrimSpace(t[idx+1:]), "\\", "/", -1), "/")
+			if to == "" {
+				return rest, true
+			}
+			return to + "/" + rest, true
+		}
+	}
+	for _, root := range c.Roots {
+		if rest, ok := trimPrefix(norm, root); ok {
+			return rest, true
+		}
+	}
+	return "", false
+}
+
+// relPath return translated `src` escaped for url, false if it's not translated
+func (c *Config) relPath(src string) (string, bool) {
+	rel, ok := c.Translate(src)
+	if !ok {
+		return "", false
+	}
+	parts := strings.Split(rel, "/")
+	for i, part := range parts {
+		parts[i] = url.PathEscape(part)
+	}
+	return strings.Join(parts, "/"), true
+}
+
+// revision expand Revision from vars, unless the build told its revision
+func (c *Config) revision(vars map[string]string) string {
+	if vars["revision"] != "" {
+		return vars["revision"]
+	}
+	rev := c.Revision
+	if rev == "" {
+		rev = "{version}"
+	}
+	return expand(rev, vars)
+}
+
+// Map translate `sources` of a pdb for browsing, with their url on the source server if
+// configured. Vars are as of Stream.
+//
+func (c *Config) Map(sources []string, vars map[string]string) []*SourceFile {
+	files := make([]*SourceFile, 0, len(sources))
+	target := ""
+	if c.URL != "" {
+		vars["revision"] = c.revision(vars)
+		target = expand(c.URL, vars)
+	}
+	for _, src := range sources {
+		f := &SourceFile{Path: src}
+		f.Translated, _ = c.Translate(src)
+		if rel, ok := c.relPath(src); ok && target != "" {
+			f.URL = strings.Replace(target, "{path}", rel, -1)
+		}
+		files = append(files, f)
+	}
+	return files
+}
+
+// Stream render srcsrv stream mapping `sources` to the source server, vars should hold
+// branch, version and revision. Return the number of mapped files, 0 with nil stream
+// if none of the sources is under Roots.
+//
+func (c *Config) Stream(sources []string, vars map[string]string) ([]byte, int) {
+	var files bytes.Buffer
+	n := 0
+	for _, src := range sources {
+		if rel, ok := c.relPath(src); ok {
+			fmt.Fprintf(&files, "%s*%s\r\n", src, rel)
+			n++
+		}
+	}
+	if n == 0 {
+		return nil, 0
+	}
+
+	target := strings.Replace(expand(c.URL, vars), "{path}", "%var2%", -1)
+	var buf bytes.Buffer
+	buf.WriteString("SRCSRV: ini ------------------------------------------------\r\n")
+	buf.WriteString("VERSION=2\r\n")
+	buf.WriteString("INDEXVERSION=2\r\n")
+	buf.WriteString("VERCTRL=http\r\n")
+	fmt.Fprintf(&buf, "DATETIME=%s\r\n", time.Now().Format(time.ANSIC))
+	buf.WriteString("SRCSRV: variables ------------------------------------------\r\n")
+	buf.WriteString("SRCSRVVERCTRL=http\r\n")
+	fmt.Fprintf(&buf, "SRCSRVTRG=%s\r\n", target)
+	buf.WriteString("SRCSRV: source files ---------------------------------------\r\n")
+	buf.Write(files.Bytes())
+	buf.WriteString("SRCSRV: end ------------------------------------------------\r\n")
+	return buf.Bytes(), n
+}
+
+// Writer embed srcsrv stream into pdb, replace it for tests or a native writer.
+var Writer = pdbStr
+
+// readSources list source files of pdb
+var readSources = pdb.Sources
+
+// pdbStr write stream by `pdbstr.exe -w -p:{pdb} -s:srcsrv -i:{stream file}`
+func pdbStr(fpath string, stream []byte) error {
+	tmp := fpath + ".srcsrv"
+	if err := ioutil.WriteFile(tmp, stream, 0644); err != nil {
+		return err
+	}
+	defer os.Remove(tmp)
+	out, err := exec.Command(config.PdbStrExe, "-w", "-p:"+fpath, "-s:srcsrv", "-i:"+tmp).CombinedOutput()
+	if err != nil {
+		return fmt.Errorf("%v: %s", err, bytes.TrimSpace(out))
+	}
+	return nil
+}
+
+// Index write srcsrv stream into every pdb under `dir`. The revision is expanded from
+// Revision unless vars already has it. Pdbs failed are listed in result, the others are
+// still indexed.
+//
+func Index(dir string, c *Config, vars map[string]string) (*Result, error) {
+	if err := Check(c); err != nil {
+		return nil, err
+	}
+	res := &Result{}
+	if c.URL == "" {
+		// paths translated for browsing only
+		return res, nil
+	}
+	vars["revision"] = c.revision(vars)
+
+	err := filepath.Walk(dir, func(fpath string, fi os.FileInfo, err error) error {
+		if err != nil || fi.IsDir() || !strings.EqualFold(filepath.Ext(fpath), ".pdb") {
+			return err
+		}
+		res.PDBs++
+		sources, err := readSources(fpath)
+		if err != nil {
+			// portable or stripped pdb
+			return nil
+		}
+		stream, n := c.Stream(sources, vars)
+		if n == 0 {
+			return nil
+		}
+		if err = Writer(fpath, stream); err != nil {
+			res.Failed = append(res.Failed, fmt.Sprintf("%s: %v", fi.Name(), err))
+			return nil
+		}
+		res.Indexed++
+		res.Files += n
+		return nil
+	})
+	return res, err
+}
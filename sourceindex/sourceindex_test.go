@@ -0,0 +1,130 @@
+package sourceindex
+
+import (
+	"fmt"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+func TestStream(t *testing.T) {
+	c := &Config{
+		URL:   "https://git.example.com/{branch}/raw/{revision}/{path}",
+		Roots: []string{`S:\src\`, "D:/build"},
+	}
+	stream, n := c.Stream([]string{
+		`S:\src\udp\main.cpp`,
+		`d:\build\util\my file.cpp`,
+		`C:\Program Files (x86)\Windows Kits\10\Include\windows.h`,
+	}, map[string]string{"branch": "UDP", "revision": "abc123"})
+	if n != 2 {
+		t.Fatalf("expect 2 files indexed, got %d", n)
+	}
+	for _, line := range []string{
+		"SRCSRVTRG=https://git.example.com/UDP/raw/abc123/%var2%\r\n",
+		`S:\src\udp\main.cpp*udp/main.cpp` + "\r\n",
+		`d:\build\util\my file.cpp*util/my%20file.cpp` + "\r\n",
+	} {
+		if !strings.Contains(string(stream), line) {
+			t.Errorf("expect %q in stream:\n%s", line, stream)
+		}
+	}
+	if strings.Contains(string(stream), "windows.h") {
+		t.Errorf("expect sources out of roots skipped")
+	}
+	if _, n = c.Stream([]string{`C:\other\a.cpp`}, nil); n != 0 {
+		t.Errorf("expect no stream out of roots")
+	}
+
+	for _, bad := range []*Config{{URL: "https://git/raw/{revision}"}, {URL: "git://git/{path}"}} {
+		if err := Check(bad); err != ErrURL {
+			t.Errorf("expect invalid url %s, got %v", bad.URL, err)
+		}
+	}
+}
+
+func TestIndex(t *testing.T) {
+	dir, err := ioutil.TempDir("", "srcsrv")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+	for _, name := range []string{"x64/udp.pdb", "x64/sdk.pdb", "x64/broken.pdb", "x64/udp.dll"} {
+		os.MkdirAll(filepath.Dir(filepath.Join(dir, name)), 0755)
+		ioutil.WriteFile(filepath.Join(dir, name), []byte(name), 0644)
+	}
+
+	defer func(r func(string) ([]string, error), w func(string, []byte) error) {
+		readSources, Writer = r, w
+	}(readSources, Writer)
+	readSources = func(fpath string) ([]string, error) {
+		switch filepath.Base(fpath) {
+		case "udp.pdb":
+			return []string{`S:\src\main.cpp`, `S:\src\util.cpp`}, nil
+		case "sdk.pdb":
+			return []string{`C:\sdk\crt.c`}, nil
+		}
+		return nil, fmt.Errorf("corrupted")
+	}
+	written := make(map[string]string)
+	Writer = func(fpath string, stream []byte) error {
+		written[filepath.Base(fpath)] = string(stream)
+		return nil
+	}
+
+	c := &Config{URL: "https://git/raw/{revision}/{path}", Revision: "release/{version}", Roots: []string{`S:\src`}}
+	res, err := Index(dir, c, map[string]string{"branch": "UDP", "version": "4175.2-538"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if res.PDBs != 3 || res.Indexed != 1 || res.Files != 2 || len(written) != 1 {
+		t.Fatalf("unexpected result %+v", res)
+	}
+	if !strings.Contains(written["udp.pdb"], "SRCSRVTRG=https://git/raw/release/4175.2-538/%var2%") {
+		t.Errorf("expect revision from template, got\n%s", written["udp.pdb"])
+	}
+
+	// revision of build-info.json first
+	Index(dir, c, map[string]string{"version": "4175.2-538", "revision": "abc123"})
+	if !strings.Contains(written["udp.pdb"], "/raw/abc123/") {
+		t.Errorf("expect given revision, got\n%s", written["udp.pdb"])
+	}
+}
+
+func TestTranslate(t *testing.T) {
+	c := &Config{
+		URL:          "https://git.example.com/raw/{revision}/{path}",
+		Roots:        []string{`S:\src`},
+		Translations: []string{`D:\agent\_work\1\s=udp/`, `s:\src\vendor=third_party`},
+	}
+	for src, expect := range map[string]string{
+		`D:\agent\_work\1\s\main.cpp`:       "udp/main.cpp",
+		`d:/agent/_work/1/s/util/a b.cpp`:   "udp/util/a b.cpp",
+		`S:\src\vendor\zlib\inflate.c`:      "third_party/zlib/inflate.c",
+		`S:\src\core\io.cpp`:                "core/io.cpp",
+		`C:\Program Files\sdk\windows.h`:    "",
+		`D:\agent\_work\1\sources\main.cpp`: "",
+	} {
+		if rel, ok := c.Translate(src); rel != expect || ok != (expect != "") {
+			t.Errorf("expect %s translated to %q, got %q", src, expect, rel)
+		}
+	}
+
+	files := c.Map([]string{`D:\agent\_work\1\s\util\a b.cpp`, `C:\sdk\crt.c`}, map[string]string{"version": "101"})
+	if files[0].URL != "https://git.example.com/raw/101/udp/util/a%20b.cpp" || files[1].Translated != "" || files[1].URL != "" {
+		t.Errorf("unexpected files %+v %+v", files[0], files[1])
+	}
+	stream, n := c.Stream([]string{`D:\agent\_work\1\s\main.cpp`}, map[string]string{"revision": "abc"})
+	if n != 1 || !strings.Contains(string(stream), `D:\agent\_work\1\s\main.cpp*udp/main.cpp`) {
+		t.Errorf("expect translated path in stream:\n%s", stream)
+	}
+
+	if err := Check(&Config{Translations: []string{`D:\s=udp`}}); err != nil {
+		t.Errorf("expect translations without url valid, got %v", err)
+	}
+	if err := Check(&Config{Translations: []string{`D:\s`}}); err != ErrTranslation {
+		t.Errorf("expect invalid translation, got %v", err)
+	}
+}
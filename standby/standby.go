@@ -0,0 +1,470 @@
+// Package standby keep a warm standby of another GoSymbols instance: branches and store
+// deltas of the primary are copied continuously, and the standby is read-only until it's
+// promoted. A promotion bump the epoch, and the instance with the lower epoch is fenced
+// read-only, so the pair never ingest into diverging stores at the same time.
+//
+package standby
+
+import (
+	"bytes"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"net/http"
+	"net/url"
+	"os"
+	"path/filepath"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/adyzng/GoSymbols/config"
+	"github.com/adyzng/GoSymbols/fault"
+	"github.com/adyzng/GoSymbols/federation"
+	"github.com/adyzng/GoSymbols/symbol"
+	log "gopkg.in/clog.v1"
+)
+
+// Roles of an instance
+const (
+	RolePrimary = "primary"
+	RoleStandby = "standby"
+	RoleFenced  = "fenced" // primary which lost the role to its promoted standby
+)
+
+const (
+	// HeaderToken carry `[standby] TOKEN` on requests between the pair
+	HeaderToken = "X-GoSymbols-Standby"
+
+	stateFile = "standby.json" // role and epoch in app path, they win over config once promoted
+	adminDir  = "000Admin"
+)
+
+var (
+	ErrDisabled = fmt.Errorf("standby is not configured")
+	ErrStale    = fmt.Errorf("epoch is not newer than the current one")
+
+	sb   *Standby
+	once sync.Once
+)
+
+// State of this instance in the pair
+//
+type State struct {
+	Role     string            `json:"role"`
+	Epoch    int64             `json:"epoch"` // bumped by each promotion, the higher epoch own the stores
+	Peer     string            `json:"peer"`
+	LastSync string            `json:"lastSync,omitempty"`
+	Files    int64             `json:"files,omitempty"`  // files copied from primary since start
+	Lag      map[string]string `json:"lag,omitempty"`    // branch => last transaction of primary not applied yet
+	Error    string            `json:"error,omitempty"`  // last sync or peer check error
+	Reason   string            `json:"reason,omitempty"` // why fenced
+}
+
+// Standby sync from, or watch, the peer instance
+//
+type Standby struct {
+	mx    sync.Mutex
+	state State
+	wake  chan struct{}
+	http  *http.Client
+}
+
+// Get return single instance of standby with `[standby]` config and saved state.
+//
+func Get() *Standby {
+	once.Do(func() {
+		sb = New(config.StandbyRole, config.StandbyPeer)
+		sb.load()
+	})
+	return sb
+}
+
+// New ...
+func New(role, peer string) *Standby {
+	return &Standby{
+		state: State{Role: role, Peer: peer},
+		wake:  make(chan struct{}, 1),
+		http: &http.Client{
+			Timeout:   time.Minute * 10,
+			Transport: fault.Transport(fault.Network, nil),
+		},
+	}
+}
+
+// Enabled return true if the instance is one of an standby pair.
+func (s *Standby) Enabled() bool {
+	return s.state.Peer != "" && s.state.Role != ""
+}
+
+// State return a copy of current state.
+//
+func (s *Standby) State() State {
+	s.mx.Lock()
+	defer s.mx.Unlock()
+	st := s.state
+	st.Lag = make(map[string]string, len(s.state.Lag))
+	for k, v := range s.state.Lag {
+		st.Lag[k] = v
+	}
+	return st
+}
+
+func (s *Standby) load() {
+	data, err := ioutil.ReadFile(filepath.Join(config.AppPath, stateFile))
+	if err != nil || !s.Enabled() {
+		return
+	}
+	var st State
+	if err = json.Unmarshal(data, &st); err != nil {
+		log.Warn("[Standby] Invalid state file: %v.", err)
+		return
+	}
+	s.state.Role, s.state.Epoch, s.state.Reason = st.Role, st.Epoch, st.Reason
+}
+
+// save persist role and epoch, must hold mx
+func (s *Standby) save() {
+	data, _ := json.Marshal(&State{Role: s.state.Role, Epoch: s.state.Epoch, Peer: s.state.Peer, Reason: s.state.Reason})
+	fpath := filepath.Join(config.AppPath, stateFile)
+	err := ioutil.WriteFile(fpath+".tmp", data, 0644)
+	if err == nil {
+		err = os.Rename(fpath+".tmp", fpath)
+	}
+	if err != nil {
+		log.Error(2, "[Standby] Save state failed: %v.", err)
+	}
+}
+
+// applyFence make stores read-only unless this instance is the primary
+func (s *Standby) applyFence() {
+	s.mx.Lock()
+	st := s.state
+	s.mx.Unlock()
+	switch st.Role {
+	case RoleStandby:
+		symbol.GetServer().SetFence("standby of " + st.Peer)
+	case RoleFenced:
+		symbol.GetServer().SetFence(st.Reason)
+	default:
+		symbol.GetServer().SetFence("")
+	}
+}
+
+// Run sync from the primary (standby) or watch for promotion of the standby (primary)
+// every `[standby] INTERVAL` seconds until done.
+//
+func (s *Standby) Run(done <-chan struct{}) {
+	if !s.Enabled() {
+		return
+	}
+	s.applyFence()
+	log.Info("[Standby] Run as %s of %s.", s.State().Role, s.state.Peer)
+	interval := time.Duration(config.StandbyInterval) * time.Second
+	for {
+		var err error
+		switch s.State().Role {
+		case RoleStandby:
+			err = s.Sync()
+		case RolePrimary:
+			err = s.checkPeer()
+		}
+		s.mx.Lock()
+		s.state.Error = ""
+		if err != nil {
+			s.state.Error = err.Error()
+		}
+		s.mx.Unlock()
+
+		select {
+		case <-done:
+			log.Info("[Standby] Standby stopped.")
+			return
+		case <-s.wake:
+		case <-time.After(interval):
+		}
+	}
+}
+
+// Promote make this instance the primary with a new epoch, the peer is fenced if reachable
+// and fence itself anyway when it's back and see the newer epoch.
+//
+func (s *Standby) Promote(user string) (State, error) {
+	if !s.Enabled() {
+		return State{}, ErrDisabled
+	}
+	s.mx.Lock()
+	s.state.Role = RolePrimary
+	s.state.Epoch++
+	s.state.Reason = ""
+	s.state.Lag = nil
+	s.save()
+	epoch := s.state.Epoch
+	s.mx.Unlock()
+	s.applyFence()
+	log.Warn("[Standby] Promoted to primary by %s, epoch %d.", user, epoch)
+
+	body, _ := json.Marshal(map[string]int64{"epoch": epoch})
+	if err := s.call("POST", "/api/standby/fence", body, nil); err != nil {
+		log.Warn("[Standby] Fence peer %s failed: %v, it fence itself when back.", s.state.Peer, err)
+	}
+	select {
+	case s.wake <- struct{}{}:
+	default:
+	}
+	return s.State(), nil
+}
+
+// Fence demote this instance if `epoch` of the promoted peer is newer.
+//
+func (s *Standby) Fence(epoch int64) error {
+	if !s.Enabled() {
+		return ErrDisabled
+	}
+	s.mx.Lock()
+	if epoch <= s.state.Epoch {
+		s.mx.Unlock()
+		return ErrStale
+	}
+	if s.state.Role == RolePrimary {
+		s.state.Role = RoleFenced
+		s.state.Reason = fmt.Sprintf("fenced by %s promoted at epoch %d", s.state.Peer, epoch)
+	}
+	s.state.Epoch = epoch
+	s.save()
+	s.mx.Unlock()
+	s.applyFence()
+	return nil
+}
+
+// checkPeer fence this primary if the peer was promoted meanwhile, eg: while this one was down
+func (s *Standby) checkPeer() error {
+	var peer State
+	if err := s.call("GET", "/api/standby", nil, &peer); err != nil {
+		return err
+	}
+	if peer.Role == RolePrimary && peer.Epoch > s.State().Epoch {
+		return s.Fence(peer.Epoch)
+	}
+	return nil
+}
+
+// restResponse is the envelope of peer api response
+type restResponse struct {
+	Code    int             `json:"code"`
+	Message string          `json:"message"`
+	Data    json.RawMessage `json:"data"`
+}
+
+func (s *Standby) request(method, path string, body []byte) (*http.Response, error) {
+	req, err := http.NewRequest(method, s.state.Peer+path, bytes.NewReader(body))
+	if err != nil {
+		return nil, err
+	}
+	req.Header.Set(HeaderToken, config.StandbyToken)
+	// branches federated by the peer aren't copied
+	req.Header.Set(federation.HeaderForwarded, "1")
+	if body != nil {
+		req.Header.Set("Content-Type", "application/json")
+	}
+	resp, err := s.http.Do(req)
+	if err != nil {
+		return nil, err
+	}
+	if resp.StatusCode != http.StatusOK {
+		resp.Body.Close()
+		return nil, fmt.Errorf("%s %s response %s", method, path, resp.Status)
+	}
+	return resp, nil
+}
+
+func (s *Standby) call(method, path string, body []byte, out interface{}) error {
+	resp, err := s.request(method, path, body)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+
+	var rr restResponse
+	if err = json.NewDecoder(resp.Body).Decode(&rr); err != nil {
+		return err
+	}
+	if rr.Code != 0 {
+		return fmt.Errorf("error %d: %s", rr.Code, rr.Message)
+	}
+	if out == nil {
+		return nil
+	}
+	return json.Unmarshal(rr.Data, out)
+}
+
+// storeName return the last segment of windows or unix store path of the primary
+func storeName(path string) string {
+	path = strings.TrimRight(path, "\\/")
+	if i := strings.LastIndexAny(path, "\\/"); i >= 0 {
+		return path[i+1:]
+	}
+	return path
+}
+
+// Sync copy branch list and store deltas of every branch from the primary.
+//
+func (s *Standby) Sync() error {
+	var bl struct {
+		Branchs []*symbol.Branch `json:"branchs"`
+	}
+	if err := s.call("GET", "/api/branches", nil, &bl); err != nil {
+		return err
+	}
+
+	ss := symbol.GetServer()
+	remote := make(map[string]bool)
+	lag := make(map[string]string)
+	var failed error
+	for _, rb := range bl.Branchs {
+		if rb.Server != "" || rb.Archive != "" {
+			continue
+		}
+		remote[strings.ToLower(rb.StoreName)] = true
+		b, last, err := s.syncBranch(rb)
+		if err != nil {
+			log.Warn("[Standby] Sync branch %s failed: %v.", rb.StoreName, err)
+			failed = err
+		}
+		if b == nil || b.GetLatestID() != last {
+			lag[rb.StoreName] = last
+		}
+	}
+
+	// branches deleted on primary, the store folder is kept
+	var deleted []string
+	ss.WalkBuilders(func(bu symbol.Builder) error {
+		if _, ok := bu.(*symbol.BrBuilder); ok && !remote[strings.ToLower(bu.Name())] {
+			deleted = append(deleted, bu.Name())
+		}
+		return nil
+	})
+	for _, name := range deleted {
+		ss.Delete(name)
+		log.Info("[Standby] Branch %s deleted on primary.", name)
+	}
+	if err := ss.SaveBranchs(""); err != nil {
+		log.Warn("[Standby] Save branches failed: %v.", err)
+	}
+
+	s.mx.Lock()
+	s.state.LastSync = time.Now().Format("2006-01-02 15:04:05")
+	s.state.Lag = lag
+	s.mx.Unlock()
+	return failed
+}
+
+// syncBranch create or update local branch `rb` of primary, and copy its store delta up to
+// the returned last transaction of primary
+func (s *Standby) syncBranch(rb *symbol.Branch) (*symbol.BrBuilder, string, error) {
+	ss := symbol.GetServer()
+	nb := *rb
+	nb.StorePath = filepath.Join(config.Destination, storeName(rb.StorePath))
+	nb.Sealed = nil
+	if err := os.MkdirAll(filepath.Join(nb.StorePath, adminDir), 0755); err != nil {
+		return nil, "", err
+	}
+
+	var bu symbol.Builder
+	if ss.Get(nb.StoreName) == nil {
+		bu = ss.Add(&nb)
+		log.Info("[Standby] Branch %s created from primary.", nb.StoreName)
+	} else {
+		bu = ss.Modify(&nb)
+	}
+	b, ok := bu.(*symbol.BrBuilder)
+	if !ok {
+		return nil, "", fmt.Errorf("branch %s not accepted", nb.StoreName)
+	}
+
+	var m symbol.SyncManifest
+	path := fmt.Sprintf("/api/branches/%s/manifest?hash=1&since=%s",
+		url.PathEscape(rb.StoreName), url.QueryEscape(b.GetLatestID()))
+	if err := s.call("GET", path, nil, &m); err != nil {
+		return b, "", err
+	}
+
+	copied := 0
+	for _, f := range m.Files {
+		// symbols of a transaction come before its admin files, stop at the first failure
+		// so lastid.txt is never ahead of the symbols copied
+		ok, err := s.syncFile(b, f)
+		if err != nil {
+			if copied > 0 {
+				b.Reload()
+			}
+			return b, m.LastID, err
+		}
+		if ok {
+			copied++
+		}
+	}
+	if copied > 0 {
+		s.mx.Lock()
+		s.state.Files += int64(copied)
+		s.mx.Unlock()
+		log.Info("[Standby] Copy %d files of branch %s up to %s.", copied, b.Name(), m.LastID)
+		return b, m.LastID, b.Reload()
+	}
+	return b, m.LastID, nil
+}
+
+func fileSHA256(fpath string) string {
+	fd, err := os.Open(fpath)
+	if err != nil {
+		return ""
+	}
+	defer fd.Close()
+	h := sha256.New()
+	io.Copy(h, fd)
+	return hex.EncodeToString(h.Sum(nil))
+}
+
+// syncFile copy file `f` of primary unless the local one has the same content
+func (s *Standby) syncFile(b *symbol.BrBuilder, f *symbol.ManifestFile) (bool, error) {
+	fpath, err := b.StoreFile(f.Path)
+	if err != nil {
+		return false, err
+	}
+	if st, err := os.Stat(fpath); err == nil && st.Size() == f.Size && (f.SHA256 == "" || fileSHA256(fpath) == f.SHA256) {
+		return false, nil
+	}
+
+	path := fmt.Sprintf("/api/branches/%s/file?path=%s", url.PathEscape(b.StoreName), url.QueryEscape(f.Path))
+	resp, err := s.request("GET", path, nil)
+	if err != nil {
+		return false, err
+	}
+	defer resp.Body.Close()
+
+	if err = os.MkdirAll(filepath.Dir(fpath), 0755); err != nil {
+		return false, err
+	}
+	tmp := fpath + ".sync"
+	fd, err := os.Create(tmp)
+	if err != nil {
+		return false, err
+	}
+	h := sha256.New()
+	_, err = io.Copy(io.MultiWriter(fd, h), resp.Body)
+	fd.Close()
+	if err == nil && f.SHA256 != "" && hex.EncodeToString(h.Sum(nil)) != f.SHA256 {
+		err = fmt.Errorf("checksum of %s mismatch", f.Path)
+	}
+	if err == nil {
+		err = os.Rename(tmp, fpath)
+	}
+	if err != nil {
+		os.Remove(tmp)
+		return false, err
+	}
+	return true, nil
+}
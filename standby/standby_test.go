@@ -0,0 +1,134 @@
+package standby
+
+import (
+	"context"
+	"encoding/json"
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/adyzng/GoSymbols/config"
+	"github.com/adyzng/GoSymbols/symbol"
+)
+
+// fakePrimary serve branch list, sync manifest and store files of branch `b`
+func fakePrimary(t *testing.T, b *symbol.BrBuilder, fenced *int64) *httptest.Server {
+	reply := func(w http.ResponseWriter, data interface{}) {
+		json.NewEncoder(w).Encode(map[string]interface{}{"code": 0, "data": data})
+	}
+	return httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.Header.Get(HeaderToken) != "secret" {
+			w.WriteHeader(http.StatusUnauthorized)
+			return
+		}
+		switch r.URL.Path {
+		case "/api/branches":
+			reply(w, map[string]interface{}{"branchs": []*symbol.Branch{b.GetBranch()}})
+		case "/api/branches/UDP/manifest":
+			m, err := b.SyncManifest(r.URL.Query().Get("since"), true)
+			if err != nil {
+				t.Error(err)
+			}
+			reply(w, m)
+		case "/api/branches/UDP/file":
+			fpath, _ := b.StoreFile(r.URL.Query().Get("path"))
+			http.ServeFile(w, r, fpath)
+		case "/api/standby/fence":
+			var req struct{ Epoch int64 }
+			json.NewDecoder(r.Body).Decode(&req)
+			*fenced = req.Epoch
+			reply(w, nil)
+		default:
+			w.WriteHeader(http.StatusNotFound)
+		}
+	}))
+}
+
+func TestStandby(t *testing.T) {
+	root, err := ioutil.TempDir("", "standby")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(root)
+	defer func(p, d, tk string) { config.AppPath, config.Destination, config.StandbyToken = p, d, tk }(
+		config.AppPath, config.Destination, config.StandbyToken)
+	config.AppPath, config.Destination, config.StandbyToken = root, filepath.Join(root, "standby"), "secret"
+
+	// primary store with one transaction
+	primary := filepath.Join(root, "primary", "UDP")
+	files := map[string]string{
+		"000Admin/0000000001":   "\"foo.pdb\\AAAA1\",\"S:\\000Unzip\\x64\\foo.pdb\"\r\n",
+		"000Admin/server.txt":   "0000000001,add,file,07/04/2017,14:44:14,\"UDP\",\"100\",\"\",\r\n",
+		"000Admin/lastid.txt":   "0000000001\r\n",
+		"foo.pdb/AAAA1/foo.pdb": "pdb",
+	}
+	for rel, data := range files {
+		fpath := filepath.Join(primary, filepath.FromSlash(rel))
+		os.MkdirAll(filepath.Dir(fpath), 0755)
+		ioutil.WriteFile(fpath, []byte(data), 0644)
+	}
+	os.MkdirAll(config.Destination, 0755)
+	pb := symbol.NewBranch2(&symbol.Branch{StoreName: "UDP", StorePath: primary, BuildPath: root}).(*symbol.BrBuilder)
+
+	var fenced int64
+	srv := fakePrimary(t, pb, &fenced)
+	defer srv.Close()
+
+	s := New(RoleStandby, srv.URL)
+	s.applyFence()
+	defer symbol.GetServer().SetFence("")
+	if err = s.Sync(); err != nil {
+		t.Fatal(err)
+	}
+	defer symbol.GetServer().Delete("UDP")
+
+	b, ok := symbol.GetServer().Get("UDP").(*symbol.BrBuilder)
+	if !ok || b.StorePath != filepath.Join(config.Destination, "UDP") {
+		t.Fatalf("expect branch created in standby store, got %+v", b)
+	}
+	if data, _ := ioutil.ReadFile(filepath.Join(b.StorePath, "foo.pdb", "AAAA1", "foo.pdb")); string(data) != "pdb" {
+		t.Errorf("symbol file not copied, got %q", data)
+	}
+	if st := s.State(); st.Files != 5 || len(st.Lag) != 0 || b.GetLatestID() != "0000000001" {
+		t.Errorf("unexpected state after sync %+v", st)
+	}
+	if err = b.AddBuild(context.Background(), "101"); err != symbol.ErrFenced {
+		t.Errorf("expect standby read-only, got %v", err)
+	}
+
+	// second transaction on primary, only the delta is copied
+	ioutil.WriteFile(filepath.Join(primary, "000Admin", "0000000002"), []byte("\"bar.pdb\\BBBB1\",\"x\"\r\n"), 0644)
+	ioutil.WriteFile(filepath.Join(primary, "000Admin", "lastid.txt"), []byte("0000000002\r\n"), 0644)
+	ioutil.WriteFile(filepath.Join(primary, "000Admin", "server.txt"), []byte(files["000Admin/server.txt"]+
+		"0000000002,add,file,07/05/2017,14:44:14,\"UDP\",\"101\",\"\",\r\n"), 0644)
+	os.MkdirAll(filepath.Join(primary, "bar.pdb", "BBBB1"), 0755)
+	ioutil.WriteFile(filepath.Join(primary, "bar.pdb", "BBBB1", "bar.pdb"), []byte("bar"), 0644)
+	pb.Reload()
+	if err = s.Sync(); err != nil {
+		t.Fatal(err)
+	}
+	if st := s.State(); st.Files != 10 || b.GetLatestID() != "0000000002" {
+		t.Errorf("expect delta copied, got %+v", st)
+	}
+	if n, err := b.ParseBuilds(context.Background(), nil); n != 2 || err != nil {
+		t.Errorf("expect builds reloaded, got %d (%v)", n, err)
+	}
+
+	// promotion fence the old primary with the new epoch
+	st, err := s.Promote("alice")
+	if err != nil || st.Role != RolePrimary || st.Epoch != 1 || fenced != 1 {
+		t.Fatalf("unexpected promotion %+v, fenced %d (%v)", st, fenced, err)
+	}
+	if symbol.GetServer().Fenced() != "" {
+		t.Errorf("expect promoted standby writable")
+	}
+	if err = s.Fence(1); err != ErrStale {
+		t.Errorf("expect same epoch ignored, got %v", err)
+	}
+	if err = s.Fence(2); err != nil || s.State().Role != RoleFenced || symbol.GetServer().Fenced() == "" {
+		t.Errorf("expect fenced by newer epoch, got %+v (%v)", s.State(), err)
+	}
+}
@@ -0,0 +1,257 @@
+package storage
+
+import (
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/xml"
+	"fmt"
+	"io"
+	"net/http"
+	"net/url"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+)
+
+const azureVersion = "2020-10-02"
+
+// Azure keep objects as block blobs in container of Azure Blob Storage, requests are
+// authorized by the shared key of storage account.
+//
+type Azure struct {
+	Account   string
+	Container string
+	Prefix    string // blob names of the store start with it, eg: UDP
+	Key       string // base64 shared key of account
+
+	endpoint string           // https://{account}.blob.core.windows.net if empty
+	now      func() time.Time // request time, time.Now if nil
+}
+
+func (a *Azure) check() error {
+	if a.Account == "" || a.Container == "" {
+		return fmt.Errorf("azure account and container required")
+	}
+	if a.Key == "" {
+		return ErrCreds
+	}
+	if _, err := base64.StdEncoding.DecodeString(a.Key); err != nil {
+		return fmt.Errorf("azure key is not base64: %v", err)
+	}
+	return nil
+}
+
+// String return url of the store.
+//
+func (a *Azure) String() string {
+	return "azblob://" + a.Account + "/" + a.Container + "/" + a.Prefix
+}
+
+// containerURL return url of the container
+func (a *Azure) containerURL() string {
+	endpoint := a.endpoint
+	if endpoint == "" {
+		endpoint = "https://" + a.Account + ".blob.core.windows.net"
+	}
+	return strings.TrimRight(endpoint, "/") + "/" + a.Container
+}
+
+// blobURL return url of blob `key`
+func (a *Azure) blobURL(key string) string {
+	return a.containerURL() + "/" + (&url.URL{Path: key}).EscapedPath()
+}
+
+// do sign and send request
+func (a *Azure) do(method, rawurl string, body io.Reader, size int64, header http.Header) (*http.Response, error) {
+	req, err := http.NewRequest(method, rawurl, body)
+	if err != nil {
+		return nil, err
+	}
+	if body != nil {
+		req.ContentLength = size
+	}
+	for k, v := range header {
+		req.Header[k] = v
+	}
+	if err = a.sign(req); err != nil {
+		return nil, err
+	}
+	return httpClient.Do(req)
+}
+
+// sign add shared key authorization
+func (a *Azure) sign(req *http.Request) error {
+	key, err := base64.StdEncoding.DecodeString(a.Key)
+	if err != nil {
+		return err
+	}
+	t := time.Now()
+	if a.now != nil {
+		t = a.now()
+	}
+	req.Header.Set("x-ms-date", t.UTC().Format(http.TimeFormat))
+	req.Header.Set("x-ms-version", azureVersion)
+
+	length := ""
+	if req.ContentLength > 0 {
+		length = strconv.FormatInt(req.ContentLength, 10)
+	}
+
+	// canonicalized headers, all x-ms-* lower cased and sorted
+	var msHeaders []string
+	for k := range req.Header {
+		if k = strings.ToLower(k); strings.HasPrefix(k, "x-ms-") {
+			msHeaders = append(msHeaders, k)
+		}
+	}
+	sort.Strings(msHeaders)
+	var canonical []string
+	for _, k := range msHeaders {
+		canonical = append(canonical, k+":"+strings.TrimSpace(req.Header.Get(k)))
+	}
+
+	// canonicalized resource, query parameters lower cased and sorted
+	resource := "/" + a.Account + req.URL.EscapedPath()
+	query := req.URL.Query()
+	params := make([]string, 0, len(query))
+	for k := range query {
+		params = append(params, k)
+	}
+	sort.Strings(params)
+	for _, k := range params {
+		vals := append([]string{}, query[k]...)
+		sort.Strings(vals)
+		resource += "\n" + strings.ToLower(k) + ":" + strings.Join(vals, ",")
+	}
+
+	toSign := strings.Join([]string{
+		req.Method,
+		req.Header.Get("Content-Encoding"),
+		req.Header.Get("Content-Language"),
+		length,
+		req.Header.Get("Content-MD5"),
+		req.Header.Get("Content-Type"),
+		"", // Date, x-ms-date is used
+		req.Header.Get("If-Modified-Since"),
+		req.Header.Get("If-Match"),
+		req.Header.Get("If-None-Match"),
+		req.Header.Get("If-Unmodified-Since"),
+		req.Header.Get("Range"),
+		strings.Join(canonical, "\n"),
+		resource,
+	}, "\n")
+
+	h := hmac.New(sha256.New, key)
+	h.Write([]byte(toSign))
+	req.Header.Set("Authorization", "SharedKey "+a.Account+":"+base64.StdEncoding.EncodeToString(h.Sum(nil)))
+	return nil
+}
+
+// Get blob `name`.
+//
+func (a *Azure) Get(name string) (io.ReadCloser, error) {
+	resp, err := a.do("GET", a.blobURL(join(a.Prefix, name)), nil, 0, nil)
+	if err != nil {
+		return nil, err
+	}
+	if resp.StatusCode != http.StatusOK {
+		defer resp.Body.Close()
+		return nil, statusError(resp)
+	}
+	return resp.Body, nil
+}
+
+// Put block blob `name`, single request up to 5000MB.
+//
+func (a *Azure) Put(name string, r io.Reader, size int64) error {
+	header := http.Header{"X-Ms-Blob-Type": {"BlockBlob"}}
+	resp, err := a.do("PUT", a.blobURL(join(a.Prefix, name)), r, size, header)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode != http.StatusCreated {
+		return statusError(resp)
+	}
+	return nil
+}
+
+// Stat blob `name` by HEAD request.
+//
+func (a *Azure) Stat(name string) (*Object, error) {
+	resp, err := a.do("HEAD", a.blobURL(join(a.Prefix, name)), nil, 0, nil)
+	if err != nil {
+		return nil, err
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode != http.StatusOK {
+		return nil, statusError(resp)
+	}
+	mtime, _ := http.ParseTime(resp.Header.Get("Last-Modified"))
+	return &Object{Name: name, Size: resp.ContentLength, ModTime: mtime}, nil
+}
+
+// blobList is the response of List Blobs
+type blobList struct {
+	Blobs []struct {
+		Name       string
+		Properties struct {
+			Size         int64  `xml:"Content-Length"`
+			LastModified string `xml:"Last-Modified"`
+		}
+	} `xml:"Blobs>Blob"`
+	NextMarker string
+}
+
+// List blobs of container, page by page.
+//
+func (a *Azure) List(prefix string) ([]*Object, error) {
+	var (
+		objs   []*Object
+		marker string
+	)
+	for {
+		query := url.Values{"restype": {"container"}, "comp": {"list"}, "prefix": {join(a.Prefix, prefix)}}
+		if marker != "" {
+			query.Set("marker", marker)
+		}
+		resp, err := a.do("GET", a.containerURL()+"?"+query.Encode(), nil, 0, nil)
+		if err != nil {
+			return nil, err
+		}
+		var result blobList
+		if resp.StatusCode != http.StatusOK {
+			err = statusError(resp)
+		} else {
+			err = xml.NewDecoder(resp.Body).Decode(&result)
+		}
+		resp.Body.Close()
+		if err != nil {
+			return nil, err
+		}
+		for _, blob := range result.Blobs {
+			mtime, _ := http.ParseTime(blob.Properties.LastModified)
+			objs = append(objs, &Object{Name: trimPrefix(a.Prefix, blob.Name), Size: blob.Properties.Size, ModTime: mtime})
+		}
+		if result.NextMarker == "" {
+			return objs, nil
+		}
+		marker = result.NextMarker
+	}
+}
+
+// Delete blob `name`.
+//
+func (a *Azure) Delete(name string) error {
+	resp, err := a.do("DELETE", a.blobURL(join(a.Prefix, name)), nil, 0, nil)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode != http.StatusAccepted && resp.StatusCode != http.StatusNotFound {
+		return statusError(resp)
+	}
+	return nil
+}
@@ -0,0 +1,53 @@
+package storage
+
+import (
+	"bufio"
+	"io"
+	"path"
+	"strings"
+
+	"github.com/adyzng/GoSymbols/encrypt"
+)
+
+// Encrypted return store `s` sealing the symbol files put to it with AES `key`, see package
+// encrypt. Admin files, file.ptr and refs.ptr are read by symstore.exe and symsrv so they're
+// kept plain, and content already sealed is stored as is. Get return the sealed content,
+// read it by encrypt.Open.
+//
+func Encrypted(s Store, key []byte) Store {
+	return &encrypted{Store: s, key: key}
+}
+
+type encrypted struct {
+	Store
+	key []byte
+}
+
+// sealed check if object `name` is sealed when put
+func sealed(name string) bool {
+	if strings.HasPrefix(strings.ToLower(name), "000admin/") {
+		return false
+	}
+	base := strings.ToLower(path.Base(name))
+	return base != "file.ptr" && base != "refs.ptr"
+}
+
+// Put seal `r` into object `name`, `size` is the plain size.
+//
+func (e *encrypted) Put(name string, r io.Reader, size int64) error {
+	br := bufio.NewReader(r)
+	if !sealed(name) || encrypt.IsSealed(br) {
+		return e.Store.Put(name, br, size)
+	}
+	if size >= 0 {
+		size = encrypt.SealedSize(size)
+	}
+	pr, pw := io.Pipe()
+	go func() {
+		pw.CloseWithError(encrypt.Encrypt(pw, br, e.key))
+	}()
+	err := e.Store.Put(name, pr, size)
+	// stop the writer if the store didn't read it all
+	pr.CloseWithError(err)
+	return err
+}
@@ -0,0 +1,108 @@
+package storage
+
+import (
+	"io"
+	"os"
+	"path/filepath"
+	"strings"
+)
+
+// Local keep objects as files under folder `Root`, the layout symstore.exe use.
+//
+type Local struct {
+	Root string
+}
+
+func (l *Local) path(name string) string {
+	return filepath.Join(l.Root, filepath.FromSlash(name))
+}
+
+// String return the root folder.
+//
+func (l *Local) String() string {
+	return l.Root
+}
+
+// Get open file `name`.
+//
+func (l *Local) Get(name string) (io.ReadCloser, error) {
+	return os.Open(l.path(name))
+}
+
+// Put write file `name` through a temp file, readers never see a partial file.
+//
+func (l *Local) Put(name string, r io.Reader, size int64) error {
+	fpath := l.path(name)
+	if err := os.MkdirAll(filepath.Dir(fpath), 0755); err != nil {
+		return err
+	}
+	tmp := fpath + ".tmp"
+	fd, err := os.Create(tmp)
+	if err != nil {
+		return err
+	}
+	if _, err = io.Copy(fd, r); err != nil {
+		fd.Close()
+		os.Remove(tmp)
+		return err
+	}
+	if err = fd.Close(); err != nil {
+		os.Remove(tmp)
+		return err
+	}
+	return os.Rename(tmp, fpath)
+}
+
+// Stat file `name`, folders don't exist as objects.
+//
+func (l *Local) Stat(name string) (*Object, error) {
+	st, err := os.Stat(l.path(name))
+	if err != nil {
+		return nil, err
+	}
+	if st.IsDir() {
+		return nil, os.ErrNotExist
+	}
+	return &Object{Name: name, Size: st.Size(), ModTime: st.ModTime()}, nil
+}
+
+// List walk files under root whose name start with `prefix`.
+//
+func (l *Local) List(prefix string) ([]*Object, error) {
+	// walk from the deepest folder of prefix
+	dir := l.Root
+	if i := strings.LastIndex(prefix, "/"); i >= 0 {
+		dir = l.path(prefix[:i])
+	}
+	var objs []*Object
+	err := filepath.Walk(dir, func(fpath string, info os.FileInfo, err error) error {
+		if err != nil {
+			if os.IsNotExist(err) && fpath == dir {
+				return filepath.SkipDir
+			}
+			return err
+		}
+		if info.IsDir() {
+			return nil
+		}
+		rel, err := filepath.Rel(l.Root, fpath)
+		if err != nil {
+			return err
+		}
+		name := filepath.ToSlash(rel)
+		if strings.HasPrefix(name, prefix) {
+			objs = append(objs, &Object{Name: name, Size: info.Size(), ModTime: info.ModTime()})
+		}
+		return nil
+	})
+	return objs, err
+}
+
+// Delete file `name`.
+//
+func (l *Local) Delete(name string) error {
+	if err := os.Remove(l.path(name)); err != nil && !os.IsNotExist(err) {
+		return err
+	}
+	return nil
+}
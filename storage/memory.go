@@ -0,0 +1,108 @@
+package storage
+
+import (
+	"bytes"
+	"io"
+	"io/ioutil"
+	"os"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+)
+
+// Memory keep objects in process memory, for tests and `[storage] MODE = memory`. Stores
+// opened by the same `mem://{name}` url share the objects until process exit.
+//
+type Memory struct {
+	name string
+	mx   sync.RWMutex
+	objs map[string]*memObject
+}
+
+type memObject struct {
+	data  []byte
+	mtime time.Time
+}
+
+// NewMemory create an empty memory store.
+//
+func NewMemory(name string) *Memory {
+	return &Memory{name: name, objs: make(map[string]*memObject)}
+}
+
+// String return url of the store.
+//
+func (m *Memory) String() string {
+	return "mem://" + m.name
+}
+
+// Get object `name`, reader of a copy.
+//
+func (m *Memory) Get(name string) (io.ReadCloser, error) {
+	m.mx.RLock()
+	defer m.mx.RUnlock()
+	obj, ok := m.objs[strings.TrimLeft(name, "/")]
+	if !ok {
+		return nil, os.ErrNotExist
+	}
+	return ioutil.NopCloser(bytes.NewReader(obj.data)), nil
+}
+
+// Put object `name`, the data is read before lock so readers never see a partial object.
+//
+func (m *Memory) Put(name string, r io.Reader, size int64) error {
+	data, err := ioutil.ReadAll(r)
+	if err != nil {
+		return err
+	}
+	m.mx.Lock()
+	defer m.mx.Unlock()
+	m.objs[strings.TrimLeft(name, "/")] = &memObject{data: data, mtime: time.Now()}
+	return nil
+}
+
+// Stat object `name`.
+//
+func (m *Memory) Stat(name string) (*Object, error) {
+	m.mx.RLock()
+	defer m.mx.RUnlock()
+	name = strings.TrimLeft(name, "/")
+	obj, ok := m.objs[name]
+	if !ok {
+		return nil, os.ErrNotExist
+	}
+	return &Object{Name: name, Size: int64(len(obj.data)), ModTime: obj.mtime}, nil
+}
+
+// List objects whose name start with `prefix`, ordered by name.
+//
+func (m *Memory) List(prefix string) ([]*Object, error) {
+	m.mx.RLock()
+	defer m.mx.RUnlock()
+	var objs []*Object
+	for name, obj := range m.objs {
+		if strings.HasPrefix(name, prefix) {
+			objs = append(objs, &Object{Name: name, Size: int64(len(obj.data)), ModTime: obj.mtime})
+		}
+	}
+	sort.Slice(objs, func(i, j int) bool { return objs[i].Name < objs[j].Name })
+	return objs, nil
+}
+
+// Delete object `name`.
+//
+func (m *Memory) Delete(name string) error {
+	m.mx.Lock()
+	defer m.mx.Unlock()
+	delete(m.objs, strings.TrimLeft(name, "/"))
+	return nil
+}
+
+// Reset remove all objects, tests start from an empty store.
+//
+func (m *Memory) Reset() {
+	m.mx.Lock()
+	defer m.mx.Unlock()
+	m.objs = make(map[string]*memObject)
+}
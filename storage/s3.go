@@ -0,0 +1,243 @@
+package storage
+
+import (
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/xml"
+	"fmt"
+	"io"
+	"net/http"
+	"net/url"
+	"os"
+	"sort"
+	"strings"
+	"time"
+)
+
+const (
+	amzDateFormat   = "20060102T150405Z"
+	unsignedPayload = "UNSIGNED-PAYLOAD"
+)
+
+// S3 keep objects in bucket of AWS S3 or S3 compatible storage (MinIO, GCS XML api), requests
+// are signed by signature version 4. Buckets are addressed by path, `{Endpoint}/{Bucket}/{key}`.
+//
+type S3 struct {
+	Endpoint  string // eg: https://s3.us-east-1.amazonaws.com
+	Region    string
+	Bucket    string
+	Prefix    string // keys of the store start with it, eg: symbols/UDP
+	AccessKey string
+	SecretKey string
+
+	now func() time.Time // request time, time.Now if nil
+}
+
+func (s *S3) check() error {
+	if s.Bucket == "" || s.Region == "" {
+		return fmt.Errorf("s3 bucket and region required")
+	}
+	if s.AccessKey == "" || s.SecretKey == "" {
+		return ErrCreds
+	}
+	return nil
+}
+
+// String return url of the store.
+//
+func (s *S3) String() string {
+	return "s3://" + s.Bucket + "/" + s.Prefix
+}
+
+// objectURL return url of `key`, each segment escaped once as the canonical uri
+func (s *S3) objectURL(key string) string {
+	segs := strings.Split(key, "/")
+	for i, seg := range segs {
+		segs[i] = uriEscape(seg)
+	}
+	return strings.TrimRight(s.Endpoint, "/") + "/" + s.Bucket + "/" + strings.Join(segs, "/")
+}
+
+// uriEscape escape all but unreserved chars, as signature version 4 require
+func uriEscape(s string) string {
+	return strings.Replace(url.QueryEscape(s), "+", "%20", -1)
+}
+
+// do sign and send request
+func (s *S3) do(method, rawurl string, body io.Reader, size int64) (*http.Response, error) {
+	req, err := http.NewRequest(method, rawurl, body)
+	if err != nil {
+		return nil, err
+	}
+	if body != nil {
+		req.ContentLength = size
+	}
+	s.sign(req)
+	return httpClient.Do(req)
+}
+
+// sign add signature version 4 authorization, payload is not signed so large files are
+// streamed, https protect it.
+func (s *S3) sign(req *http.Request) {
+	t := time.Now()
+	if s.now != nil {
+		t = s.now()
+	}
+	t = t.UTC()
+	date := t.Format(amzDateFormat)
+	req.Header.Set("X-Amz-Date", date)
+	req.Header.Set("X-Amz-Content-Sha256", unsignedPayload)
+
+	// canonical query, keys and values escaped and sorted
+	query := req.URL.Query()
+	keys := make([]string, 0, len(query))
+	for k := range query {
+		keys = append(keys, k)
+	}
+	sort.Strings(keys)
+	var cq []string
+	for _, k := range keys {
+		for _, v := range query[k] {
+			cq = append(cq, uriEscape(k)+"="+uriEscape(v))
+		}
+	}
+	req.URL.RawQuery = strings.Join(cq, "&")
+
+	signed := "host;x-amz-content-sha256;x-amz-date"
+	canonical := strings.Join([]string{
+		req.Method,
+		req.URL.EscapedPath(),
+		req.URL.RawQuery,
+		"host:" + req.URL.Host,
+		"x-amz-content-sha256:" + unsignedPayload,
+		"x-amz-date:" + date,
+		"",
+		signed,
+		unsignedPayload,
+	}, "\n")
+
+	scope := date[:8] + "/" + s.Region + "/s3/aws4_request"
+	sum := sha256.Sum256([]byte(canonical))
+	toSign := "AWS4-HMAC-SHA256\n" + date + "\n" + scope + "\n" + hex.EncodeToString(sum[:])
+
+	key := hmacSHA256([]byte("AWS4"+s.SecretKey), date[:8])
+	for _, part := range []string{s.Region, "s3", "aws4_request"} {
+		key = hmacSHA256(key, part)
+	}
+	req.Header.Set("Authorization", fmt.Sprintf("AWS4-HMAC-SHA256 Credential=%s/%s, SignedHeaders=%s, Signature=%s",
+		s.AccessKey, scope, signed, hex.EncodeToString(hmacSHA256(key, toSign))))
+}
+
+func hmacSHA256(key []byte, data string) []byte {
+	h := hmac.New(sha256.New, key)
+	h.Write([]byte(data))
+	return h.Sum(nil)
+}
+
+// Get object `name`.
+//
+func (s *S3) Get(name string) (io.ReadCloser, error) {
+	resp, err := s.do("GET", s.objectURL(join(s.Prefix, name)), nil, 0)
+	if err != nil {
+		return nil, err
+	}
+	if resp.StatusCode != http.StatusOK {
+		defer resp.Body.Close()
+		return nil, statusError(resp)
+	}
+	return resp.Body, nil
+}
+
+// Put object `name`, single request up to 5GB.
+//
+func (s *S3) Put(name string, r io.Reader, size int64) error {
+	resp, err := s.do("PUT", s.objectURL(join(s.Prefix, name)), r, size)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode != http.StatusOK {
+		return statusError(resp)
+	}
+	return nil
+}
+
+// Stat object `name` by HEAD request.
+//
+func (s *S3) Stat(name string) (*Object, error) {
+	resp, err := s.do("HEAD", s.objectURL(join(s.Prefix, name)), nil, 0)
+	if err != nil {
+		return nil, err
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode != http.StatusOK {
+		return nil, statusError(resp)
+	}
+	mtime, _ := http.ParseTime(resp.Header.Get("Last-Modified"))
+	return &Object{Name: name, Size: resp.ContentLength, ModTime: mtime}, nil
+}
+
+// listResult is the response of ListObjectsV2
+type listResult struct {
+	Contents []struct {
+		Key          string
+		Size         int64
+		LastModified time.Time
+	}
+	IsTruncated           bool
+	NextContinuationToken string
+}
+
+// List objects by ListObjectsV2, page by page.
+//
+func (s *S3) List(prefix string) ([]*Object, error) {
+	var (
+		objs  []*Object
+		token string
+	)
+	for {
+		query := url.Values{"list-type": {"2"}, "prefix": {join(s.Prefix, prefix)}}
+		if token != "" {
+			query.Set("continuation-token", token)
+		}
+		resp, err := s.do("GET", strings.TrimRight(s.Endpoint, "/")+"/"+s.Bucket+"?"+query.Encode(), nil, 0)
+		if err != nil {
+			return nil, err
+		}
+		var result listResult
+		if resp.StatusCode != http.StatusOK {
+			err = statusError(resp)
+		} else {
+			err = xml.NewDecoder(resp.Body).Decode(&result)
+		}
+		resp.Body.Close()
+		if err != nil {
+			if os.IsNotExist(err) {
+				err = fmt.Errorf("bucket %s not found", s.Bucket)
+			}
+			return nil, err
+		}
+		for _, c := range result.Contents {
+			objs = append(objs, &Object{Name: trimPrefix(s.Prefix, c.Key), Size: c.Size, ModTime: c.LastModified})
+		}
+		if !result.IsTruncated || result.NextContinuationToken == "" {
+			return objs, nil
+		}
+		token = result.NextContinuationToken
+	}
+}
+
+// Delete object `name`, S3 succeed even it doesn't exist.
+//
+func (s *S3) Delete(name string) error {
+	resp, err := s.do("DELETE", s.objectURL(join(s.Prefix, name)), nil, 0)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode != http.StatusNoContent && resp.StatusCode != http.StatusOK && resp.StatusCode != http.StatusNotFound {
+		return statusError(resp)
+	}
+	return nil
+}
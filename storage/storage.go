@@ -0,0 +1,170 @@
+// Package storage abstract where symbol stores are kept: the local disk, or object storage
+// (AWS S3, Azure Blob Storage, Google Cloud Storage). Object names are slash separated and
+// relative to the store root, eg: `000Admin/server.txt` or `foo.pdb/{hash}/foo.pdb`.
+//
+package storage
+
+import (
+	"fmt"
+	"io"
+	"net/http"
+	"net/url"
+	"os"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/adyzng/GoSymbols/config"
+)
+
+var (
+	ErrScheme = fmt.Errorf("unsupported storage url, expect file://, s3://, azblob://, gs:// or mem://")
+	ErrCreds  = fmt.Errorf("storage credentials missing, see [storage] of config.ini")
+)
+
+// Object is an stored file
+//
+type Object struct {
+	Name    string    `json:"name"`
+	Size    int64     `json:"size"`
+	ModTime time.Time `json:"modTime"`
+}
+
+// Store is the file operations of symbol stores. Missing objects are reported as
+// os.ErrNotExist, test it with os.IsNotExist.
+//
+type Store interface {
+	// String return the url of store, eg: s3://bucket/UDP
+	String() string
+	// Get open object `name` for reading
+	Get(name string) (io.ReadCloser, error)
+	// Put write object `name` of `size` bytes from `r`, replacing the exist one
+	Put(name string, r io.Reader, size int64) error
+	// Stat return size and modify time of object `name`
+	Stat(name string) (*Object, error)
+	// List return all objects whose name start with `prefix`, eg: `000Admin/`
+	List(prefix string) ([]*Object, error)
+	// Delete remove object `name`, missing object is not an error
+	Delete(name string) error
+}
+
+var httpClient = &http.Client{
+	Timeout: time.Minute * 30, // symbol files can be hundreds of MB
+}
+
+var (
+	storesMx sync.Mutex
+	stores   = make(map[string]Store)
+)
+
+// Open return the store at `rawurl`, stores are cached by url:
+//	D:\SymbolServer\UDP, file:///srv/symbols/UDP   local folder
+//	s3://{bucket}/{prefix}                       AWS S3, or S3 compatible at `[storage] S3_ENDPOINT`
+//	azblob://{account}/{container}/{prefix}      Azure Blob Storage
+//	gs://{bucket}/{prefix}                       Google Cloud Storage with HMAC keys
+//	mem://{name}                                 process memory, for tests
+//
+func Open(rawurl string) (Store, error) {
+	storesMx.Lock()
+	defer storesMx.Unlock()
+	if s, ok := stores[rawurl]; ok {
+		return s, nil
+	}
+	s, err := open(rawurl)
+	if err != nil {
+		return nil, err
+	}
+	stores[rawurl] = s
+	return s, nil
+}
+
+func open(rawurl string) (Store, error) {
+	if !strings.Contains(rawurl, "://") {
+		return &Local{Root: rawurl}, nil
+	}
+	u, err := url.Parse(rawurl)
+	if err != nil {
+		return nil, err
+	}
+	prefix := strings.Trim(u.Path, "/")
+	switch u.Scheme {
+	case "file":
+		return &Local{Root: u.Path}, nil
+	case "s3":
+		s := &S3{
+			Endpoint:  config.StorageS3Endpoint,
+			Region:    config.StorageS3Region,
+			Bucket:    u.Host,
+			Prefix:    prefix,
+			AccessKey: envOr(config.StorageS3AccessKey, "AWS_ACCESS_KEY_ID"),
+			SecretKey: envOr(config.StorageS3SecretKey, "AWS_SECRET_ACCESS_KEY"),
+		}
+		if s.Region == "" {
+			s.Region = envOr("", "AWS_REGION")
+		}
+		if s.Endpoint == "" {
+			s.Endpoint = "https://s3." + s.Region + ".amazonaws.com"
+		}
+		return s, s.check()
+	case "gs":
+		// XML api of GCS is S3 compatible with HMAC keys
+		s := &S3{
+			Endpoint:  "https://storage.googleapis.com",
+			Region:    "auto",
+			Bucket:    u.Host,
+			Prefix:    prefix,
+			AccessKey: config.StorageGCSAccessKey,
+			SecretKey: config.StorageGCSSecretKey,
+		}
+		return s, s.check()
+	case "azblob":
+		ss := strings.SplitN(prefix, "/", 2)
+		a := &Azure{
+			Account:   u.Host,
+			Container: ss[0],
+			Key:       envOr(config.StorageAzureKey, "AZURE_STORAGE_KEY"),
+		}
+		if len(ss) == 2 {
+			a.Prefix = ss[1]
+		}
+		return a, a.check()
+	case "mem":
+		return NewMemory(u.Host + u.Path), nil
+	}
+	return nil, ErrScheme
+}
+
+// envOr return `val`, or environment variable `env` if it's empty
+func envOr(val, env string) string {
+	if val == "" {
+		val = os.Getenv(env)
+	}
+	return val
+}
+
+// join prefix and object name to the full key
+func join(prefix, name string) string {
+	name = strings.TrimLeft(name, "/")
+	if prefix == "" {
+		return name
+	}
+	return prefix + "/" + name
+}
+
+// trimPrefix turn full key back to object name
+func trimPrefix(prefix, key string) string {
+	if prefix == "" {
+		return key
+	}
+	return strings.TrimPrefix(key, prefix+"/")
+}
+
+// statusError map failed http response to error, 404 is os.ErrNotExist
+func statusError(resp *http.Response) error {
+	if resp.StatusCode == http.StatusNotFound {
+		return os.ErrNotExist
+	}
+	body := make([]byte, 512)
+	n, _ := io.ReadFull(resp.Body, body)
+	return fmt.Errorf("%s %s: %s", resp.Request.Method, resp.Status, strings.TrimSpace(string(body[:n])))
+}
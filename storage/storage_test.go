@@ -0,0 +1,218 @@
+package storage
+
+import (
+	"bufio"
+	"bytes"
+	"encoding/base64"
+	"fmt"
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/adyzng/GoSymbols/encrypt"
+)
+
+func TestLocal(t *testing.T) {
+	root, err := ioutil.TempDir("", "storage")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(root)
+
+	l := &Local{Root: root}
+	for _, name := range []string{"000Admin/server.txt", "000Admin/0000000001", "foo.pdb/ABC1/foo.pdb"} {
+		if err := l.Put(name, strings.NewReader(name), int64(len(name))); err != nil {
+			t.Fatal(err)
+		}
+	}
+	objs, err := l.List("000Admin/")
+	if err != nil || len(objs) != 2 {
+		t.Fatalf("expect 2 admin files, got %d (%v)", len(objs), err)
+	}
+	if obj, err := l.Stat("foo.pdb/ABC1/foo.pdb"); err != nil || obj.Size != 20 {
+		t.Errorf("unexpected stat %+v (%v)", obj, err)
+	}
+	if _, err := l.Stat("foo.pdb"); !os.IsNotExist(err) {
+		t.Errorf("folder is not an object, got %v", err)
+	}
+	if objs, err := l.List("missing/"); err != nil || len(objs) != 0 {
+		t.Errorf("expect nothing under missing prefix, got %d (%v)", len(objs), err)
+	}
+	if err := l.Delete("foo.pdb/ABC1/foo.pdb"); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := l.Get("foo.pdb/ABC1/foo.pdb"); !os.IsNotExist(err) {
+		t.Errorf("expect deleted, got %v", err)
+	}
+	if err := l.Delete("foo.pdb/ABC1/foo.pdb"); err != nil {
+		t.Errorf("delete missing file: %v", err)
+	}
+}
+
+func TestS3(t *testing.T) {
+	objects := map[string]string{"/bucket/UDP/000Admin/server.txt": "0000000001"}
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		auth := r.Header.Get("Authorization")
+		if !strings.HasPrefix(auth, "AWS4-HMAC-SHA256 Credential=AKID/20180102/us-east-1/s3/aws4_request, ") {
+			w.WriteHeader(http.StatusForbidden)
+			return
+		}
+		switch {
+		case r.Method == "GET" && r.URL.Path == "/bucket":
+			if r.URL.Query().Get("prefix") != "UDP/000Admin/" {
+				t.Errorf("unexpected list prefix %q", r.URL.Query().Get("prefix"))
+			}
+			fmt.Fprint(w, `<ListBucketResult><Contents><Key>UDP/000Admin/server.txt</Key><Size>10</Size>`+
+				`<LastModified>2018-01-02T03:04:05.000Z</LastModified></Contents><IsTruncated>false</IsTruncated></ListBucketResult>`)
+		case r.Method == "PUT":
+			data, _ := ioutil.ReadAll(r.Body)
+			objects[r.URL.Path] = string(data)
+		case r.Method == "GET":
+			data, ok := objects[r.URL.Path]
+			if !ok {
+				w.WriteHeader(http.StatusNotFound)
+				return
+			}
+			fmt.Fprint(w, data)
+		}
+	}))
+	defer srv.Close()
+
+	s := &S3{
+		Endpoint:  srv.URL,
+		Region:    "us-east-1",
+		Bucket:    "bucket",
+		Prefix:    "UDP",
+		AccessKey: "AKID",
+		SecretKey: "secret",
+		now:       func() time.Time { return time.Date(2018, 1, 2, 3, 4, 5, 0, time.UTC) },
+	}
+	objs, err := s.List("000Admin/")
+	if err != nil || len(objs) != 1 || objs[0].Name != "000Admin/server.txt" || objs[0].Size != 10 {
+		t.Fatalf("unexpected list %v (%v)", objs, err)
+	}
+	if err = s.Put("foo.pdb/ABC1/foo.pdb", strings.NewReader("pdb"), 3); err != nil {
+		t.Fatal(err)
+	}
+	if objects["/bucket/UDP/foo.pdb/ABC1/foo.pdb"] != "pdb" {
+		t.Errorf("object not stored at path style key")
+	}
+	if _, err = s.Get("missing"); !os.IsNotExist(err) {
+		t.Errorf("expect not exist, got %v", err)
+	}
+}
+
+func TestAzureSign(t *testing.T) {
+	a := &Azure{
+		Account:   "acct",
+		Container: "stores",
+		Prefix:    "UDP",
+		Key:       base64.StdEncoding.EncodeToString([]byte("key")),
+		now:       func() time.Time { return time.Date(2018, 1, 2, 3, 4, 5, 0, time.UTC) },
+	}
+	if err := a.check(); err != nil {
+		t.Fatal(err)
+	}
+	req, _ := http.NewRequest("GET", a.containerURL()+"?restype=container&comp=list", nil)
+	if err := a.sign(req); err != nil {
+		t.Fatal(err)
+	}
+	if !strings.HasPrefix(req.Header.Get("Authorization"), "SharedKey acct:") {
+		t.Errorf("unexpected authorization %q", req.Header.Get("Authorization"))
+	}
+	if req.Header.Get("x-ms-date") != "Tue, 02 Jan 2018 03:04:05 GMT" {
+		t.Errorf("unexpected date %q", req.Header.Get("x-ms-date"))
+	}
+	if a.blobURL("UDP/foo bar.pdb") != "https://acct.blob.core.windows.net/stores/UDP/foo%20bar.pdb" {
+		t.Errorf("unexpected blob url %s", a.blobURL("UDP/foo bar.pdb"))
+	}
+}
+
+func TestOpen(t *testing.T) {
+	if s, err := Open("/srv/symbols/UDP"); err != nil || s.String() != "/srv/symbols/UDP" {
+		t.Errorf("expect local store, got %v (%v)", s, err)
+	}
+	if _, err := Open("ftp://host/UDP"); err != ErrScheme {
+		t.Errorf("expect ErrScheme, got %v", err)
+	}
+}
+
+func TestMemory(t *testing.T) {
+	s, err := Open("mem://test")
+	if err != nil {
+		t.Fatal(err)
+	}
+	m := s.(*Memory)
+	defer m.Reset()
+
+	m.Put("000Admin/lastid.txt", strings.NewReader("0000000001"), 10)
+	m.Put("foo.pdb/ABC1/foo.pdb", strings.NewReader("pdb"), 3)
+	if again, _ := Open("mem://test"); again != s {
+		t.Errorf("expect same store of same url")
+	}
+	if objs, _ := m.List("000Admin/"); len(objs) != 1 || objs[0].Size != 10 {
+		t.Errorf("unexpected list %v", objs)
+	}
+	rc, err := m.Get("foo.pdb/ABC1/foo.pdb")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if data, _ := ioutil.ReadAll(rc); string(data) != "pdb" {
+		t.Errorf("unexpected content %q", data)
+	}
+	m.Delete("foo.pdb/ABC1/foo.pdb")
+	if _, err := m.Stat("foo.pdb/ABC1/foo.pdb"); !os.IsNotExist(err) {
+		t.Errorf("expect deleted, got %v", err)
+	}
+}
+
+func TestEncrypted(t *testing.T) {
+	m := NewMemory("encrypted")
+	key := bytes.Repeat([]byte{7}, 32)
+	s := Encrypted(m, key)
+
+	plain := bytes.Repeat([]byte("pdb"), 100)
+	if err := s.Put("foo.pdb/ABC1/foo.pdb", bytes.NewReader(plain), int64(len(plain))); err != nil {
+		t.Fatal(err)
+	}
+	s.Put("foo.pdb/ABC1/refs.ptr", strings.NewReader("0000000001,file,1"), 17)
+	s.Put("000Admin/lastid.txt", strings.NewReader("0000000001"), 10)
+	if obj, err := s.Stat("foo.pdb/ABC1/foo.pdb"); err != nil || obj.Size != encrypt.SealedSize(int64(len(plain))) {
+		t.Fatalf("unexpected sealed object %+v (%v)", obj, err)
+	}
+	for name, want := range map[string]bool{"foo.pdb/ABC1/foo.pdb": true, "foo.pdb/ABC1/refs.ptr": false, "000Admin/lastid.txt": false} {
+		rc, _ := m.Get(name)
+		if got := encrypt.IsSealed(bufio.NewReader(rc)); got != want {
+			t.Errorf("expect %s sealed %v, got %v", name, want, got)
+		}
+	}
+
+	// sealed content is stored as is
+	rc, _ := m.Get("foo.pdb/ABC1/foo.pdb")
+	sealed, _ := ioutil.ReadAll(rc)
+	s.Put("bar.pdb/ABC1/bar.pdb", bytes.NewReader(sealed), int64(len(sealed)))
+	rc, _ = m.Get("bar.pdb/ABC1/bar.pdb")
+	if again, _ := ioutil.ReadAll(rc); !bytes.Equal(again, sealed) {
+		t.Fatal("expect sealed content kept")
+	}
+
+	fd, err := ioutil.TempFile("", "sealed")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.Remove(fd.Name())
+	fd.Write(sealed)
+	fd.Close()
+	f, err := encrypt.Open(fd.Name(), key)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer f.Close()
+	if data, _ := ioutil.ReadAll(f); !bytes.Equal(data, plain) {
+		t.Fatal("expect plain content decrypted")
+	}
+}
@@ -0,0 +1,74 @@
+package symbol
+
+import (
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"runtime"
+	"strings"
+	"sync"
+
+	log "gopkg.in/clog.v1"
+)
+
+const (
+	adminLockFile = "admin.lock" // 000Admin/admin.lock, locked while a transaction is written
+)
+
+var (
+	adminMx    sync.Mutex
+	adminLocks = make(map[string]*sync.Mutex) // store root => writers of this process
+)
+
+// lockAdmin serialize transactions written to store `root`, by branches sharing the store in
+// this process and by other GoSymbols processes through an OS file lock on 000Admin/admin.lock.
+// lastid.txt, server.txt and history.txt must only be updated while holding it, so that the
+// transaction IDs never interleave. Return the unlock function.
+//
+func lockAdmin(root string) (func(), error) {
+	key := filepath.Clean(root)
+	if runtime.GOOS == "windows" {
+		key = strings.ToLower(key)
+	}
+	adminMx.Lock()
+	mx, ok := adminLocks[key]
+	if !ok {
+		mx = &sync.Mutex{}
+		adminLocks[key] = mx
+	}
+	adminMx.Unlock()
+	mx.Lock()
+
+	dir := filepath.Join(root, adminDir)
+	if err := os.MkdirAll(dir, 0755); err != nil {
+		mx.Unlock()
+		return nil, err
+	}
+	fd, err := os.OpenFile(filepath.Join(dir, adminLockFile), os.O_RDWR|os.O_CREATE, 0644)
+	if err != nil {
+		mx.Unlock()
+		return nil, err
+	}
+	if err = lockFile(fd); err != nil {
+		fd.Close()
+		mx.Unlock()
+		return nil, err
+	}
+	return func() {
+		if err := unlockFile(fd); err != nil {
+			log.Warn("[Branch] Unlock %s failed: %v.", fd.Name(), err)
+		}
+		fd.Close()
+		mx.Unlock()
+	}, nil
+}
+
+// appendLine append `line` to admin file by rewriting it to a temp file and renaming it over,
+// readers never see a partial line. Caller hold lockAdmin.
+func appendLine(fpath, line string) error {
+	data, err := ioutil.ReadFile(fpath)
+	if err != nil && !os.IsNotExist(err) {
+		return err
+	}
+	return writeFileAtomic(fpath, append(data, line...))
+}
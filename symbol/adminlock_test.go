@@ -0,0 +1,56 @@
+package symbol
+
+import (
+	"fmt"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"sync"
+	"testing"
+)
+
+func TestLockAdmin(t *testing.T) {
+	root, err := ioutil.TempDir("", "adminlock")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(root)
+
+	// branches sharing the store allocate IDs concurrently
+	lastid := filepath.Join(root, adminDir, lastidTxt)
+	server := filepath.Join(root, adminDir, serverTxt)
+	var wg sync.WaitGroup
+	for i := 0; i < 8; i++ {
+		wg.Add(1)
+		go func(i int) {
+			defer wg.Done()
+			for j := 0; j < 10; j++ {
+				unlock, err := lockAdmin(root + string(filepath.Separator))
+				if err != nil {
+					t.Error(err)
+					return
+				}
+				data, _ := ioutil.ReadFile(lastid)
+				last, _ := strconv.Atoi(strings.TrimSpace(string(data)))
+				id := fmt.Sprintf("%010d", last+1)
+				appendLine(server, id+",add,file\r\n")
+				writeFileAtomic(lastid, []byte(id+"\r\n"))
+				unlock()
+			}
+		}(i)
+	}
+	wg.Wait()
+
+	data, _ := ioutil.ReadFile(server)
+	lines := strings.Split(strings.TrimSpace(string(data)), "\r\n")
+	if len(lines) != 80 {
+		t.Fatalf("expect 80 transactions, got %d", len(lines))
+	}
+	for i, line := range lines {
+		if expect := fmt.Sprintf("%010d,add,file", i+1); line != expect {
+			t.Fatalf("expect %s, got %s", expect, line)
+		}
+	}
+}
@@ -0,0 +1,17 @@
+// +build !windows
+
+package symbol
+
+import (
+	"os"
+	"syscall"
+)
+
+// lockFile take exclusive flock on `fd`, block until it's granted
+func lockFile(fd *os.File) error {
+	return syscall.Flock(int(fd.Fd()), syscall.LOCK_EX)
+}
+
+func unlockFile(fd *os.File) error {
+	return syscall.Flock(int(fd.Fd()), syscall.LOCK_UN)
+}
@@ -0,0 +1,37 @@
+package symbol
+
+import (
+	"os"
+	"syscall"
+	"unsafe"
+)
+
+const (
+	lockfileExclusiveLock = 0x2
+)
+
+var (
+	kernel32         = syscall.NewLazyDLL("kernel32.dll")
+	procLockFileEx   = kernel32.NewProc("LockFileEx")
+	procUnlockFileEx = kernel32.NewProc("UnlockFileEx")
+)
+
+// lockFile take exclusive LockFileEx on the whole `fd`, block until it's granted
+func lockFile(fd *os.File) error {
+	var ol syscall.Overlapped
+	r, _, err := procLockFileEx.Call(fd.Fd(), lockfileExclusiveLock, 0, 0xFFFFFFFF, 0xFFFFFFFF,
+		uintptr(unsafe.Pointer(&ol)))
+	if r == 0 {
+		return err
+	}
+	return nil
+}
+
+func unlockFile(fd *os.File) error {
+	var ol syscall.Overlapped
+	r, _, err := procUnlockFileEx.Call(fd.Fd(), 0, 0xFFFFFFFF, 0xFFFFFFFF, uintptr(unsafe.Pointer(&ol)))
+	if r == 0 {
+		return err
+	}
+	return nil
+}
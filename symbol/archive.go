@@ -0,0 +1,268 @@
+package symbol
+
+import (
+	"archive/zip"
+	"context"
+	"fmt"
+	"io"
+	"io/fs"
+	"os"
+	"path"
+	"path/filepath"
+	"strings"
+	"sync"
+
+	"github.com/adyzng/GoSymbols/config"
+	log "gopkg.in/clog.v1"
+)
+
+var (
+	ErrReadOnly       = fmt.Errorf("branch is read-only")
+	ErrInvalidArchive = fmt.Errorf("not an symbol store archive")
+	ErrArchivePath    = fmt.Errorf("archive not under the archive folder")
+)
+
+// under return true if `fpath` is `dir` or inside it
+func under(dir, fpath string) bool {
+	dir, err1 := filepath.Abs(dir)
+	fpath, err2 := filepath.Abs(fpath)
+	if err1 != nil || err2 != nil {
+		return false
+	}
+	rel, err := filepath.Rel(dir, fpath)
+	return err == nil && rel != ".." && !strings.HasPrefix(rel, ".."+string(filepath.Separator))
+}
+
+// mountPath return the mount folder of branch `storeName`, it must be one folder under
+// `config.ArchiveMountDir`, so unmount never remove anything else.
+func mountPath(storeName string) (string, error) {
+	if storeName == "" || storeName == "." || strings.Contains(storeName, "..") ||
+		strings.ContainsAny(storeName, "/\\:") {
+		return "", fmt.Errorf("invalid branch name %q", storeName)
+	}
+	dir := filepath.Join(config.ArchiveMountDir, storeName)
+	if !under(config.ArchiveMountDir, dir) {
+		return "", fmt.Errorf("invalid branch name %q", storeName)
+	}
+	return dir, nil
+}
+
+// archivePath resolve `archive` relative to `config.ArchiveDir`, any other file of server is refused.
+func archivePath(archive string) (string, error) {
+	if !filepath.IsAbs(archive) {
+		archive = filepath.Join(config.ArchiveDir, archive)
+	}
+	if !under(config.ArchiveDir, archive) {
+		return "", ErrArchivePath
+	}
+	return filepath.Clean(archive), nil
+}
+
+// ArchiveBuilder serve an exported branch archive (zip of the branch store folder) in read-only mode.
+// Builds and transactions are read from the archive through the store filesystem, the other
+// 000Admin files are extracted when mount, symbol files are extracted on first download,
+// and the mount folder is removed when unmount.
+//
+type ArchiveBuilder struct {
+	*BrBuilder
+	zr   *zip.ReadCloser
+	exMx sync.Mutex
+}
+
+// openArchive open the zip and extract the admin files into mount folder
+func openArchive(branch *Branch) (*ArchiveBuilder, error) {
+	mount, err := mountPath(branch.StoreName)
+	if err != nil {
+		return nil, err
+	}
+	zr, err := zip.OpenReader(branch.Archive)
+	if err != nil {
+		log.Error(2, "[Archive] Open archive %s failed: %v.", branch.Archive, err)
+		return nil, err
+	}
+
+	// the store may be placed under an top folder in archive
+	prefix := ""
+	found := false
+	for _, f := range zr.File {
+		name := strings.ToLower(strings.Replace(f.Name, "\\", "/", -1))
+		if strings.HasSuffix(name, "000admin/server.txt") {
+			prefix = name[:len(name)-len("000admin/server.txt")]
+			found = true
+			break
+		}
+	}
+	if !found {
+		zr.Close()
+		return nil, ErrInvalidArchive
+	}
+
+	nb := *branch
+	nb.StorePath = mount
+	nb.BuildPath = ""
+	a := &ArchiveBuilder{
+		BrBuilder: NewBranch2(&nb).(*BrBuilder),
+		zr:        zr,
+	}
+	files := make(foldFS, len(zr.File))
+	for _, f := range zr.File {
+		name := strings.ToLower(strings.Replace(f.Name, "\\", "/", -1))
+		if !strings.HasPrefix(name, prefix) || strings.HasSuffix(name, "/") {
+			continue
+		}
+		files[name[len(prefix):]] = f
+	}
+	a.SetFS(files)
+	for rel := range files {
+		if strings.HasPrefix(rel, strings.ToLower(adminDir)+"/") {
+			if err = a.extract(rel, filepath.Join(nb.StorePath, adminDir, path.Base(rel))); err != nil {
+				a.close()
+				return nil, err
+			}
+		}
+	}
+	if _, err = fs.Stat(files, index2Txt); err == nil {
+		a.Layout = LayoutTwoTier
+	}
+	return a, nil
+}
+
+// extract copy file `rel` of archive to `dest`
+func (a *ArchiveBuilder) extract(rel, dest string) error {
+	if err := os.MkdirAll(filepath.Dir(dest), 0755); err != nil {
+		return err
+	}
+	src, err := a.StoreFS().Open(rel)
+	if err != nil {
+		return err
+	}
+	defer src.Close()
+	st, err := src.Stat()
+	if err != nil {
+		return err
+	}
+
+	tmp := dest + ".tmp"
+	fd, err := os.OpenFile(tmp, os.O_WRONLY|os.O_CREATE|os.O_TRUNC, 0644)
+	if err != nil {
+		return err
+	}
+	if _, err = io.Copy(fd, src); err != nil {
+		fd.Close()
+		os.Remove(tmp)
+		return err
+	}
+	fd.Close()
+	os.Chtimes(tmp, st.ModTime(), st.ModTime())
+	return os.Rename(tmp, dest)
+}
+
+func (a *ArchiveBuilder) close() {
+	a.zr.Close()
+	if err := os.RemoveAll(a.StorePath); err != nil {
+		log.Warn("[Archive] Remove mount folder %s failed: %v.", a.StorePath, err)
+	}
+}
+
+// CanUpdate archive never update from build server.
+func (a *ArchiveBuilder) CanUpdate() bool {
+	return false
+}
+
+// SetSubpath is not allowed for archive.
+func (a *ArchiveBuilder) SetSubpath(buildserver, localstore string) error {
+	return ErrReadOnly
+}
+
+// AddBuild is not allowed for archive.
+func (a *ArchiveBuilder) AddBuild(ctx context.Context, buildVerion string) error {
+	return ErrReadOnly
+}
+
+// AddSupplement is not allowed for archive.
+func (a *ArchiveBuilder) AddSupplement(version string, files []string) (*Build, error) {
+	return nil, ErrReadOnly
+}
+
+// GetSymbolPath extract the symbol file from archive on first access.
+//
+func (a *ArchiveBuilder) GetSymbolPath(hash, name string) string {
+	fpath := a.BrBuilder.GetSymbolPath(hash, name)
+	if _, err := os.Stat(fpath); err == nil {
+		return fpath
+	}
+
+	rel := a.relPath(fpath)
+	if _, err := fs.Stat(a.StoreFS(), rel); err != nil || strings.Contains(name, "..") || strings.Contains(hash, "..") {
+		return fpath
+	}
+	a.exMx.Lock()
+	defer a.exMx.Unlock()
+	if _, err := os.Stat(fpath); err != nil {
+		if err = a.extract(rel, fpath); err != nil {
+			log.Error(2, "[Archive] Extract %s from %s failed: %v.", rel, a.Archive, err)
+		}
+	}
+	return fpath
+}
+
+// MountArchive serve an exported archive as read-only branch `storeName`, `archive` is
+// relative to `config.ArchiveDir` and must stay under it.
+//
+func (ss *sserver) MountArchive(storeName, archive string) (Builder, error) {
+	if storeName == "" {
+		return nil, ErrBranchNotInit
+	}
+	if ss.Get(storeName) != nil {
+		return nil, fmt.Errorf("branch %s already exist", storeName)
+	}
+	archive, err := archivePath(archive)
+	if err != nil {
+		return nil, err
+	}
+
+	a, err := openArchive(&Branch{
+		StoreName: storeName,
+		BuildName: storeName,
+		Archive:   archive,
+	})
+	if err != nil {
+		return nil, err
+	}
+	if _, err = a.ParseBuilds(context.Background(), nil); err != nil {
+		a.close()
+		return nil, err
+	}
+
+	ss.lck.Lock()
+	lower := strings.ToLower(storeName)
+	if _, ok := ss.builders[lower]; ok {
+		ss.lck.Unlock()
+		a.close()
+		return nil, fmt.Errorf("branch %s already exist", storeName)
+	}
+	ss.builders[lower] = a
+	ss.lck.Unlock()
+
+	log.Info("[Archive] Mount %s as branch %s, %d builds.", archive, storeName, a.BuildsCount)
+	return a, nil
+}
+
+// UnmountArchive remove the archive branch and its extracted files.
+//
+func (ss *sserver) UnmountArchive(storeName string) error {
+	lower := strings.ToLower(storeName)
+	ss.lck.Lock()
+	a, ok := ss.builders[lower].(*ArchiveBuilder)
+	if ok {
+		delete(ss.builders, lower)
+	}
+	ss.lck.Unlock()
+	if !ok {
+		return ErrBranchNotInit
+	}
+
+	a.close()
+	log.Info("[Archive] Unmount branch %s (%s).", storeName, a.Archive)
+	return nil
+}
@@ -0,0 +1,79 @@
+package symbol
+
+import (
+	"archive/zip"
+	"context"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/adyzng/GoSymbols/config"
+)
+
+func TestArchiveBuilder(t *testing.T) {
+	root, err := ioutil.TempDir("", "archive")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(root)
+
+	zpath := filepath.Join(root, "UDPv5.zip")
+	fd, _ := os.Create(zpath)
+	zw := zip.NewWriter(fd)
+	for name, data := range map[string]string{
+		"UDPv5/000Admin/server.txt":   "0000000001,add,file,07/04/2017,14:44:14,\"UDPv5\",\"100\",\"\",\r\n",
+		"UDPv5/000Admin/0000000001":   "\"foo.pdb\\AAAA1\",\"S:\\000Unzip\\x64\\foo.pdb\"\r\n",
+		"UDPv5/foo.pdb/AAAA1/foo.pdb": "pdb",
+	} {
+		w, _ := zw.Create(name)
+		w.Write([]byte(data))
+	}
+	zw.Close()
+	fd.Close()
+
+	saved := config.ArchiveMountDir
+	config.ArchiveMountDir = filepath.Join(root, "mounts")
+	defer func() { config.ArchiveMountDir = saved }()
+
+	a, err := openArchive(&Branch{StoreName: "UDPv5", Archive: zpath})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if total, err := a.ParseBuilds(context.Background(), nil); err != nil || total != 1 {
+		t.Fatalf("expect 1 build, got %d (%v)", total, err)
+	}
+	if total, _ := a.ParseSymbols("0000000001", nil); total != 1 {
+		t.Fatalf("expect 1 symbol, got %d", total)
+	}
+
+	fpath := a.GetSymbolPath("AAAA1", "foo.pdb")
+	if data, err := ioutil.ReadFile(fpath); err != nil || string(data) != "pdb" {
+		t.Fatalf("extract symbol failed: %q (%v)", data, err)
+	}
+	if a.CanUpdate() || a.AddBuild(context.Background(), "101") != ErrReadOnly {
+		t.Fatal("archive should be read-only")
+	}
+
+	a.close()
+	if _, err := os.Stat(a.StorePath); !os.IsNotExist(err) {
+		t.Fatalf("mount folder not removed: %v", err)
+	}
+
+	for _, name := range []string{"", ".", "..", "../UDPv5", "a/b", `a\b`, "C:"} {
+		if _, err := openArchive(&Branch{StoreName: name, Archive: zpath}); err == nil {
+			t.Errorf("expect branch name %q refused", name)
+		}
+	}
+	savedDir := config.ArchiveDir
+	config.ArchiveDir = filepath.Join(root, "archives")
+	defer func() { config.ArchiveDir = savedDir }()
+	for _, archive := range []string{zpath, "../UDPv5.zip", filepath.Join(config.ArchiveDir, "..", "UDPv5.zip")} {
+		if _, err := archivePath(archive); err != ErrArchivePath {
+			t.Errorf("expect archive %s refused, got %v", archive, err)
+		}
+	}
+	if p, err := archivePath("sub/UDPv5.zip"); err != nil || p != filepath.Join(config.ArchiveDir, "sub", "UDPv5.zip") {
+		t.Errorf("unexpected archive path %s (%v)", p, err)
+	}
+}
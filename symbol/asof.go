@@ -0,0 +1,163 @@
+package symbol
+
+import (
+	"bufio"
+	"fmt"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+	"time"
+
+	log "gopkg.in/clog.v1"
+)
+
+// StoreState is the logical content of an branch as of an past transaction or date
+//
+type StoreState struct {
+	AsOf   string   `json:"asOf"`
+	LastID string   `json:"lastID"` // last transaction applied
+	Builds []*Build `json:"builds"`
+	builds map[string]*Build
+}
+
+// parseAsOf accept transaction ID (eg: 0000000012) or date, a date without time means the end of that day.
+func parseAsOf(asOf string) (id, date string, err error) {
+	asOf = strings.TrimSpace(asOf)
+	if len(asOf) == 10 && strings.Trim(asOf, "0123456789") == "" {
+		return asOf, "", nil
+	}
+	for _, layout := range []string{TimeFormat, "2006-01-02T15:04:05", "2006-01-02"} {
+		t, e := time.ParseInLocation(layout, asOf, time.Local)
+		if e != nil {
+			continue
+		}
+		if layout == "2006-01-02" {
+			t = t.Add(24*time.Hour - time.Second)
+		}
+		return "", t.Format(TimeFormat), nil
+	}
+	return "", "", fmt.Errorf("invalid asOf %q, expect transaction ID or date", asOf)
+}
+
+// StateAsOf replay the transaction history (000Admin/history.txt, or server.txt if not exist)
+// until `asOf`, so builds deleted later are still listed and builds added later are not.
+//
+func (b *BrBuilder) StateAsOf(asOf string) (*StoreState, error) {
+	id, date, err := parseAsOf(asOf)
+	if err != nil {
+		return nil, err
+	}
+
+	fpath := filepath.Join(b.StorePath, adminDir, historyTxt)
+	fd, err := os.Open(fpath)
+	if os.IsNotExist(err) {
+		fpath = filepath.Join(b.StorePath, adminDir, serverTxt)
+		fd, err = os.Open(fpath)
+	}
+	if err != nil {
+		log.Error(2, "[Branch] Open file (%s) failed with %v.", fpath, err)
+		return nil, err
+	}
+	defer fd.Close()
+
+	state := &StoreState{
+		AsOf:   asOf,
+		builds: make(map[string]*Build),
+	}
+	channels := b.channelMarks()
+	scan := bufio.NewScanner(fd)
+	for scan.Scan() {
+		str := strings.Trim(scan.Text(), "\r\n")
+		ss := strings.Split(str, ",")
+		if len(ss) < 3 {
+			continue
+		}
+		if id != "" && ss[0] > id {
+			// transaction IDs are increasing in history
+			break
+		}
+
+		switch ss[1] {
+		case "add":
+			build := parseBuildLine(str)
+			if build == nil {
+				log.Warn("[Branch] Invalid line (%s) in %s.", str, fpath)
+				continue
+			}
+			if date != "" && build.Date > date {
+				return state.finish(), nil
+			}
+			b.scope(build)
+			build.Channel = b.channelOf(channels, build)
+			state.builds[build.ID] = build
+		case "del":
+			// 0000000005,del,0000000002
+			if date != "" {
+				// del line has no date, deleted at the time its transaction file was written
+				if when := b.transactionTime(ss[0]); when == "" || when > date {
+					return state.finish(), nil
+				}
+			}
+			delete(state.builds, ss[2])
+		default:
+			continue
+		}
+		state.LastID = ss[0]
+	}
+	return state.finish(), scan.Err()
+}
+
+// transactionTime return the time transaction `id` was written, empty if unknown.
+func (b *BrBuilder) transactionTime(id string) string {
+	st, err := os.Stat(filepath.Join(b.StorePath, adminDir, id))
+	if err != nil {
+		if st, err = os.Stat(b.purgeRecord(id)); err != nil {
+			return ""
+		}
+	}
+	return st.ModTime().Format(TimeFormat)
+}
+
+// finish link supplements and sort builds by transaction ID
+func (s *StoreState) finish() *StoreState {
+	s.Builds = make([]*Build, 0, len(s.builds))
+	for _, build := range s.builds {
+		s.Builds = append(s.Builds, build)
+	}
+	sort.Slice(s.Builds, func(i, j int) bool {
+		return s.Builds[i].ID < s.Builds[j].ID
+	})
+	for _, build := range s.Builds {
+		if parent, ok := s.builds[build.SupplementOf]; ok {
+			parent.Supplements = append(parent.Supplements, build.ID)
+		}
+	}
+	return s
+}
+
+// SymbolsAsOf return symbols of given build as they were at `asOf`, supplements
+// published later are not applied.
+//
+func (b *BrBuilder) SymbolsAsOf(asOf, buildID string) ([]*Symbol, error) {
+	state, err := b.StateAsOf(asOf)
+	if err != nil {
+		return nil, err
+	}
+	build, ok := state.builds[buildID]
+	if !ok {
+		return nil, ErrBuildNotExist
+	}
+	txs := []*Build{build}
+	for _, id := range build.Supplements {
+		txs = append(txs, state.builds[id])
+	}
+	all, err := b.parseChain(txs)
+	syms := make([]*Symbol, 0, len(all))
+	for _, sym := range all {
+		if sym.SupersededBy == "" {
+			syms = append(syms, sym)
+		}
+	}
+	return syms, err
+}
@@ -0,0 +1,75 @@
+package symbol
+
+import (
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+)
+
+func TestStateAsOf(t *testing.T) {
+	root, err := ioutil.TempDir("", "asof")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(root)
+
+	admin := filepath.Join(root, adminDir)
+	os.MkdirAll(admin, 0755)
+	ioutil.WriteFile(filepath.Join(admin, historyTxt), []byte(
+		"0000000001,add,file,10/20/2017,10:00:00,\"UDP\",\"100\",\"\",\r\n"+
+			"0000000002,add,file,10/21/2017,10:00:00,\"UDP\",\"101\",\"\",\r\n"+
+			"0000000003,add,file,10/22/2017,10:00:00,\"UDP\",\"100\",\"supplement:0000000001\",\r\n"+
+			"0000000004,del,0000000002\r\n"), 0644)
+	ioutil.WriteFile(filepath.Join(admin, "0000000001"), []byte(
+		"\"foo.pdb\\AAAA1\",\"S:\\000Unzip\\x64\\foo.pdb\"\r\n"), 0644)
+	ioutil.WriteFile(filepath.Join(admin, "0000000003"), []byte(
+		"\"foo.pdb\\AAAA2\",\"S:\\000Unzip\\x64\\foo.pdb\"\r\n"), 0644)
+
+	b := NewBranch2(&Branch{StoreName: "test", StorePath: root, BuildPath: root}).(*BrBuilder)
+
+	cases := []struct {
+		asOf   string
+		builds int
+		lastID string
+	}{
+		{"0000000002", 2, "0000000002"},
+		{"0000000004", 2, "0000000004"}, // 2 deleted, 3 is supplement
+		{"2017-10-21", 2, "0000000002"},
+		{"2017-10-20 09:00:00", 0, ""},
+	}
+	for _, c := range cases {
+		state, err := b.StateAsOf(c.asOf)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if len(state.Builds) != c.builds || state.LastID != c.lastID {
+			t.Errorf("as of %s: expect %d builds until %s, got %d until %s",
+				c.asOf, c.builds, c.lastID, len(state.Builds), state.LastID)
+		}
+	}
+
+	// deleted after the last add, so still listed until the purge time
+	purged := time.Date(2017, 10, 25, 10, 0, 0, 0, time.Local)
+	os.MkdirAll(filepath.Join(admin, purgeDir), 0755)
+	ioutil.WriteFile(b.purgeRecord("0000000004"), []byte("\"bar.pdb\\BBBB1\",\"\"\r\n"), 0644)
+	os.Chtimes(b.purgeRecord("0000000004"), purged, purged)
+	for asOf, builds := range map[string]int{"2017-10-24": 3, "2017-10-25 12:00:00": 2} {
+		if state, err := b.StateAsOf(asOf); err != nil || len(state.Builds) != builds {
+			t.Errorf("as of %s: expect %d builds, got %+v (%v)", asOf, builds, state, err)
+		}
+	}
+
+	syms, err := b.SymbolsAsOf("2017-10-21", "0000000001")
+	if err != nil || len(syms) != 1 || syms[0].Hash != "AAAA1" {
+		t.Fatalf("expect original symbol before supplement, got %v (%v)", syms, err)
+	}
+	syms, err = b.SymbolsAsOf("0000000003", "0000000001")
+	if err != nil || len(syms) != 1 || syms[0].Hash != "AAAA2" {
+		t.Fatalf("expect supplement symbol, got %v (%v)", syms, err)
+	}
+	if _, err = b.StateAsOf("yesterday"); err == nil {
+		t.Fatal("expect invalid asOf error")
+	}
+}
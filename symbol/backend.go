@@ -0,0 +1,254 @@
+package symbol
+
+import (
+	"fmt"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"sync"
+
+	"github.com/adyzng/GoSymbols/alert"
+	"github.com/adyzng/GoSymbols/config"
+	"github.com/adyzng/GoSymbols/storage"
+	log "gopkg.in/clog.v1"
+)
+
+// Branches with `Backend` keep the symbol store in object storage, StorePath is only a cache:
+// admin files are pulled when loaded, symbol files are fetched on first access, and
+// transactions are pushed before the ingest complete. In memory mode branches default to
+// an `mem://` backend and the branch list is kept in memory too.
+
+var (
+	fetchMx  sync.Mutex
+	fetching = make(map[string]chan struct{}) // cache path => closed when fetched
+)
+
+// memoryMode check if `[storage] MODE` keep branch list and stores in memory
+func memoryMode() bool {
+	return config.StorageMode == "memory"
+}
+
+// metadata return where the branch list symbols.json is kept, folder `path` on disk
+func metadata(path string) storage.Store {
+	if memoryMode() {
+		store, _ := storage.Open("mem://metadata")
+		return store
+	}
+	return &storage.Local{Root: path}
+}
+
+// CheckBackend validate storage url of an branch, empty for local store only.
+//
+func CheckBackend(rawurl string) error {
+	if rawurl == "" {
+		return nil
+	}
+	_, err := storage.Open(rawurl)
+	return err
+}
+
+// backend return the object store of branch, nil if not configured
+func (b *BrBuilder) backend() storage.Store {
+	if b.Backend == "" {
+		return nil
+	}
+	store, err := storage.Open(b.Backend)
+	if err != nil {
+		log.Error(2, "[Branch] Open backend %s of %s failed: %v.", b.Backend, b.Name(), err)
+		return nil
+	}
+	return store
+}
+
+// cache return the local store folder as storage.Store
+func (b *BrBuilder) cache() storage.Store {
+	return &storage.Local{Root: b.StorePath}
+}
+
+// download object `name` of backend into the cache
+func (b *BrBuilder) download(store storage.Store, name string) error {
+	rc, err := store.Get(name)
+	if err != nil {
+		return err
+	}
+	defer rc.Close()
+	return b.cache().Put(name, rc, -1)
+}
+
+// upload cached file `name` to backend, sealed if the branch is encrypted
+func (b *BrBuilder) upload(store storage.Store, name string) error {
+	store, err := b.sealedStore(store)
+	if err != nil {
+		return err
+	}
+	cache := b.cache()
+	obj, err := cache.Stat(name)
+	if err != nil {
+		return err
+	}
+	rc, err := cache.Get(name)
+	if err != nil {
+		return err
+	}
+	defer rc.Close()
+	return store.Put(name, rc, obj.Size)
+}
+
+// fetchBackend download cache file `fpath` from backend if missing, concurrent fetches of
+// the same file wait for the first one.
+func (b *BrBuilder) fetchBackend(fpath string) string {
+	if b.Backend == "" {
+		return fpath
+	}
+	if _, err := os.Stat(fpath); err == nil {
+		return fpath
+	}
+	rel, err := filepath.Rel(b.StorePath, fpath)
+	if err != nil || strings.HasPrefix(rel, "..") {
+		return fpath
+	}
+	store := b.backend()
+	if store == nil {
+		return fpath
+	}
+
+	fetchMx.Lock()
+	if ch, ok := fetching[fpath]; ok {
+		fetchMx.Unlock()
+		<-ch
+		return fpath
+	}
+	ch := make(chan struct{})
+	fetching[fpath] = ch
+	fetchMx.Unlock()
+	defer func() {
+		fetchMx.Lock()
+		delete(fetching, fpath)
+		close(ch)
+		fetchMx.Unlock()
+	}()
+
+	name := filepath.ToSlash(rel)
+	if err = b.download(store, name); err != nil && !os.IsNotExist(err) {
+		log.Error(2, "[Branch] Fetch %s from %s failed: %v.", name, store, err)
+	}
+	return fpath
+}
+
+// PullBackend download admin files of backend which are missing or stale in the cache,
+// return count of files downloaded.
+//
+func (b *BrBuilder) PullBackend() (int, error) {
+	store := b.backend()
+	if store == nil {
+		return 0, nil
+	}
+	objs, err := store.List(adminDir + "/")
+	if err != nil {
+		return 0, err
+	}
+
+	unlock, err := lockAdmin(b.StorePath)
+	if err != nil {
+		return 0, err
+	}
+	defer unlock()
+
+	total := 0
+	for _, obj := range objs {
+		if strings.HasSuffix(obj.Name, "/"+adminLockFile) {
+			continue
+		}
+		st, err := os.Stat(filepath.Join(b.StorePath, filepath.FromSlash(obj.Name)))
+		if err == nil && st.Size() == obj.Size && !obj.ModTime.After(st.ModTime()) {
+			continue
+		}
+		if err = b.download(store, obj.Name); err != nil {
+			return total, fmt.Errorf("pull %s: %v", obj.Name, err)
+		}
+		total++
+	}
+	if total > 0 {
+		log.Info("[Branch] Pull %d admin files of %s from %s.", total, b.Name(), store)
+	}
+	return total, nil
+}
+
+// PushBackend upload files of transactions after `since` which are missing in backend, then
+// admin files missing or stale in backend, lastid.txt always and the last so readers of
+// backend only see complete transactions. Return count of files uploaded.
+//
+func (b *BrBuilder) PushBackend(since string) (int, error) {
+	store := b.backend()
+	if store == nil {
+		return 0, nil
+	}
+	m, err := b.SyncManifest(since, false)
+	if err != nil {
+		return 0, err
+	}
+
+	total := 0
+	for _, mf := range m.Files {
+		if strings.HasPrefix(mf.Path, adminDir+"/") {
+			continue
+		}
+		if obj, err := store.Stat(mf.Path); err == nil && obj.Size == mf.Size {
+			continue
+		}
+		if err = b.upload(store, mf.Path); err != nil {
+			return total, fmt.Errorf("push %s: %v", mf.Path, err)
+		}
+		total++
+	}
+
+	// admin files change in place, upload those changed since pushed like PullBackend
+	fs, err := ioutil.ReadDir(filepath.Join(b.StorePath, adminDir))
+	if err != nil {
+		return total, err
+	}
+	objs, err := store.List(adminDir + "/")
+	if err != nil {
+		return total, err
+	}
+	pushed := make(map[string]*storage.Object, len(objs))
+	for _, obj := range objs {
+		pushed[obj.Name] = obj
+	}
+	names := make([]string, 0, len(fs))
+	for _, f := range fs {
+		if f.IsDir() || f.Name() == adminLockFile || f.Name() == lastidTxt || strings.HasSuffix(f.Name(), ".tmp") {
+			continue
+		}
+		if obj := pushed[adminDir+"/"+f.Name()]; obj != nil && obj.Size == f.Size() && !f.ModTime().After(obj.ModTime) {
+			continue
+		}
+		names = append(names, f.Name())
+	}
+	names = append(names, lastidTxt)
+	for _, name := range names {
+		if err = b.upload(store, adminDir+"/"+name); err != nil && !os.IsNotExist(err) {
+			return total, fmt.Errorf("push %s: %v", name, err)
+		}
+		total++
+	}
+	log.Info("[Branch] Push %d files of %s after %s to %s.", total, b.Name(), since, store)
+	return total, nil
+}
+
+// pushOrAlert push transactions from `firstID` to backend, alert if failed
+func (b *BrBuilder) pushOrAlert(firstID string) error {
+	if b.Backend == "" {
+		return nil
+	}
+	n, _ := strconv.Atoi(firstID)
+	since := fmt.Sprintf("%010d", n-1)
+	if _, err := b.PushBackend(since); err != nil {
+		log.Error(2, "[Branch] Push transaction %s of %s to %s failed: %v.", firstID, b.Name(), b.Backend, err)
+		alert.Raise(alert.KindBackendSync, b.Name(), "transaction %s not pushed to %s: %v.", firstID, b.Backend, err)
+		return err
+	}
+	return nil
+}
@@ -0,0 +1,95 @@
+package symbol
+
+import (
+	"context"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/adyzng/GoSymbols/config"
+)
+
+func TestBackend(t *testing.T) {
+	root, err := ioutil.TempDir("", "backend")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(root)
+	defer func(exe string) { config.SymStoreExe = exe }(config.SymStoreExe)
+	config.SymStoreExe = "native"
+
+	symbols, store, remote := filepath.Join(root, "symbols"), filepath.Join(root, "store"), filepath.Join(root, "remote")
+	os.MkdirAll(symbols, 0755)
+	ioutil.WriteFile(filepath.Join(symbols, "foo.dll"), fakePE(1), 0644)
+	if _, err = SymStore.Add(context.Background(), store, "UDP", "100", "comment", symbols); err != nil {
+		t.Fatal(err)
+	}
+
+	b := NewBranch2(&Branch{StoreName: "UDP", StorePath: store, BuildPath: root, Backend: "file://" + filepath.ToSlash(remote)}).(*BrBuilder)
+	if n, err := b.PushBackend(""); err != nil || n == 0 {
+		t.Fatalf("expect files pushed, got %d (%v)", n, err)
+	}
+	for _, rel := range []string{"foo.dll/59C0C5B3a3000/foo.dll", "000Admin/server.txt", "000Admin/lastid.txt"} {
+		if _, err := os.Stat(filepath.Join(remote, filepath.FromSlash(rel))); err != nil {
+			t.Errorf("expect %s in backend: %v", rel, err)
+		}
+	}
+
+	// only lastid.txt and admin files changed since are pushed again
+	if n, err := b.PushBackend("0000000001"); err != nil || n != 1 {
+		t.Errorf("expect lastid.txt pushed only, got %d (%v)", n, err)
+	}
+	appendLine(filepath.Join(store, adminDir, historyTxt), "0000000001,del\r\n")
+	if n, err := b.PushBackend("0000000001"); err != nil || n != 2 {
+		t.Errorf("expect changed history.txt pushed, got %d (%v)", n, err)
+	}
+
+	// a fresh cache pull admin files and fetch symbols on demand
+	cache := filepath.Join(root, "cache")
+	c := NewBranch2(&Branch{StoreName: "UDP", StorePath: cache, BuildPath: root, Backend: b.Backend}).(*BrBuilder)
+	if n, err := c.PullBackend(); err != nil || n < 3 {
+		t.Fatalf("expect admin files pulled, got %d (%v)", n, err)
+	}
+	if n, _ := c.PullBackend(); n != 0 {
+		t.Errorf("expect nothing pulled again, got %d", n)
+	}
+	if n, err := c.ParseBuilds(context.Background(), nil); n != 1 || err != nil {
+		t.Errorf("expect 1 build parsed, got %d (%v)", n, err)
+	}
+	fpath := c.GetSymbolPath("59C0C5B3a3000", "foo.dll")
+	if _, err := os.Stat(fpath); err != nil {
+		t.Errorf("expect symbol fetched into cache: %v", err)
+	}
+}
+
+func TestMemoryMode(t *testing.T) {
+	defer func(mode string) { config.StorageMode = mode }(config.StorageMode)
+	config.StorageMode = "memory"
+
+	root, err := ioutil.TempDir("", "memory")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(root)
+
+	b := NewBranch2(&Branch{StoreName: "UDP", StorePath: root, BuildPath: root}).(*BrBuilder)
+	if b.Backend != "mem://udp" {
+		t.Errorf("expect memory backend, got %q", b.Backend)
+	}
+
+	ss := &sserver{builders: map[string]Builder{"udp": b}}
+	if err := ss.SaveBranchs(root); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := os.Stat(filepath.Join(root, symConfig)); !os.IsNotExist(err) {
+		t.Errorf("expect branch list kept in memory, got %v", err)
+	}
+	loaded := &sserver{builders: make(map[string]Builder)}
+	if err := loaded.LoadBranchs(); err != nil {
+		t.Fatal(err)
+	}
+	if loaded.Get("UDP") == nil {
+		t.Errorf("expect branch loaded from memory")
+	}
+}
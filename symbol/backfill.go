@@ -0,0 +1,298 @@
+package symbol
+
+import (
+	"context"
+	"fmt"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/adyzng/GoSymbols/config"
+	log "gopkg.in/clog.v1"
+)
+
+const (
+	buildDirPrefix = "Build"
+)
+
+// ServerBuild is one build folder found on build server
+//
+type ServerBuild struct {
+	Version string `json:"version"`
+	Date    string `json:"date"`
+	Size    int64  `json:"size"`             // size of debug zip
+	ZipDate string `json:"zipDate"`          // modify time of debug zip
+	ID      string `json:"id,omitempty"`     // transaction of the build if ingested
+	Latest  bool   `json:"latest,omitempty"` // reported by latest build file of build server
+	mtime   time.Time
+}
+
+// BackfillOption control the historical re-ingest
+//
+type BackfillOption struct {
+	Limit    int `json:"limit"`    // max builds to ingest, 0 for all
+	Interval int `json:"interval"` // seconds to pause between two builds
+}
+
+// BackfillProgress report the state of an backfill task
+//
+type BackfillProgress struct {
+	Branch   string            `json:"branch"`
+	Total    int               `json:"total"`
+	Done     int               `json:"done"`
+	Failed   int               `json:"failed"`
+	Current  string            `json:"current"`
+	Started  string            `json:"started"`
+	Finished string            `json:"finished"`
+	Errors   map[string]string `json:"errors,omitempty"` // version => error
+	Running  bool              `json:"running"`
+}
+
+// backfillTask run missing builds one by one
+type backfillTask struct {
+	mx       sync.RWMutex
+	progress BackfillProgress
+	stop     chan struct{}
+	once     sync.Once
+}
+
+// ListServerBuilds enumerate `Build*` folders on build server which contain debug zip,
+// the result is sorted oldest first. Branches pulling from NuGet feed list versions of
+// their package instead.
+//
+func (b *BrBuilder) ListServerBuilds() ([]*ServerBuild, error) {
+	if b.fromFeed() {
+		return b.listPackages()
+	}
+	fs, err := ioutil.ReadDir(b.BuildPath)
+	if err != nil {
+		log.Error(2, "[Branch] Enum build path %s failed: %v.", b.BuildPath, err)
+		return nil, err
+	}
+
+	builds := make([]*ServerBuild, 0, len(fs))
+	for _, f := range fs {
+		if !f.IsDir() || !strings.HasPrefix(f.Name(), buildDirPrefix) {
+			continue
+		}
+		zip := filepath.Join(b.BuildPath, f.Name(), config.PDBZipFile)
+		st, err := os.Stat(zip)
+		if err != nil || st.IsDir() {
+			continue
+		}
+		builds = append(builds, &ServerBuild{
+			Version: strings.TrimPrefix(f.Name(), buildDirPrefix),
+			Date:    f.ModTime().Format(TimeFormat),
+			Size:    st.Size(),
+			ZipDate: st.ModTime().Format(TimeFormat),
+			mtime:   f.ModTime(),
+		})
+	}
+
+	sort.SliceStable(builds, func(i, j int) bool {
+		if !builds[i].mtime.Equal(builds[j].mtime) {
+			return builds[i].mtime.Before(builds[j].mtime)
+		}
+		return builds[i].Version < builds[j].Version
+	})
+	return builds, nil
+}
+
+// ServerBuilds list builds on build server like ListServerBuilds, with the transaction
+// of builds already ingested and the latest build reported by build server.
+//
+func (b *BrBuilder) ServerBuilds() ([]*ServerBuild, error) {
+	all, err := b.ListServerBuilds()
+	if err != nil {
+		return nil, err
+	}
+	if _, err = b.ParseBuilds(context.Background(), nil); err != nil && !os.IsNotExist(err) {
+		return nil, err
+	}
+
+	latest, _ := b.getLatestBuild(false)
+	for _, sb := range all {
+		if build := b.getBuild(sb.Version, ""); build != nil {
+			sb.ID = build.ID
+		}
+		sb.Latest = latest != "" && strings.EqualFold(sb.Version, latest)
+	}
+	return all, nil
+}
+
+// MissingBuilds return builds exist on build server but not in symbol store, oldest first.
+//
+func (b *BrBuilder) MissingBuilds() ([]*ServerBuild, error) {
+	all, err := b.ServerBuilds()
+	if err != nil {
+		return nil, err
+	}
+
+	missing := make([]*ServerBuild, 0, len(all))
+	for _, sb := range all {
+		if sb.ID == "" {
+			missing = append(missing, sb)
+		}
+	}
+	return missing, nil
+}
+
+// Backfill start re-ingest all missing builds of given branch in background.
+//
+func (ss *sserver) Backfill(storeName string, opt BackfillOption) (*BackfillProgress, error) {
+	bu := ss.Get(storeName)
+	if bu == nil {
+		return nil, ErrBranchNotInit
+	}
+	b, ok := bu.(*BrBuilder)
+	if !ok {
+		return nil, ErrBranchNotInit
+	}
+
+	// the task is registered before listing builds, so a concurrent call see it running
+	lower := strings.ToLower(storeName)
+	task := &backfillTask{
+		stop: make(chan struct{}),
+		progress: BackfillProgress{
+			Branch:  b.Name(),
+			Started: timestamp(now()),
+			Errors:  make(map[string]string),
+			Running: true,
+		},
+	}
+	ss.lck.Lock()
+	prev, ok := ss.backfills[lower]
+	if ok && prev.running() {
+		ss.lck.Unlock()
+		return nil, fmt.Errorf("backfill of %s is running", storeName)
+	}
+	ss.backfills[lower] = task
+	ss.lck.Unlock()
+
+	missing, err := b.MissingBuilds()
+	if err != nil {
+		ss.lck.Lock()
+		if prev != nil {
+			ss.backfills[lower] = prev
+		} else {
+			delete(ss.backfills, lower)
+		}
+		ss.lck.Unlock()
+		return nil, err
+	}
+	if opt.Limit > 0 && len(missing) > opt.Limit {
+		missing = missing[:opt.Limit]
+	}
+	task.mx.Lock()
+	task.progress.Total = len(missing)
+	task.mx.Unlock()
+
+	log.Info("[SS] Backfill %d builds for branch %s.", len(missing), b.Name())
+	go task.run(ss.queue, b, missing, time.Duration(opt.Interval)*time.Second)
+	return task.Progress(), nil
+}
+
+// BackfillProgress return progress of the last backfill task of given branch.
+//
+func (ss *sserver) BackfillProgress(storeName string) *BackfillProgress {
+	ss.lck.RLock()
+	defer ss.lck.RUnlock()
+	if t, ok := ss.backfills[strings.ToLower(storeName)]; ok {
+		return t.Progress()
+	}
+	return nil
+}
+
+// StopBackfill abort running backfill after current build.
+//
+func (ss *sserver) StopBackfill(storeName string) bool {
+	ss.lck.RLock()
+	defer ss.lck.RUnlock()
+	if t, ok := ss.backfills[strings.ToLower(storeName)]; ok && t.running() {
+		t.once.Do(func() { close(t.stop) })
+		return true
+	}
+	return false
+}
+
+// Progress return a copy of current progress
+func (t *backfillTask) Progress() *BackfillProgress {
+	t.mx.RLock()
+	defer t.mx.RUnlock()
+	p := t.progress
+	p.Errors = make(map[string]string, len(t.progress.Errors))
+	for k, v := range t.progress.Errors {
+		p.Errors[k] = v
+	}
+	return &p
+}
+
+func (t *backfillTask) running() bool {
+	t.mx.RLock()
+	defer t.mx.RUnlock()
+	return t.progress.Running
+}
+
+// run queue missing builds one by one at low priority, so regular ingests go first, and
+// wait each of them to finish
+func (t *backfillTask) run(q *jobQueue, b *BrBuilder, builds []*ServerBuild, interval time.Duration) {
+	defer func() {
+		t.mx.Lock()
+		t.progress.Running = false
+		t.progress.Current = ""
+		t.progress.Finished = timestamp(now())
+		done, failed := t.progress.Done, t.progress.Failed
+		t.mx.Unlock()
+		log.Info("[SS] Backfill branch %s complete: %d done, %d failed.", b.Name(), done, failed)
+	}()
+
+	for i, sb := range builds {
+		if i > 0 && interval > 0 {
+			select {
+			case <-t.stop:
+				return
+			case <-time.After(interval):
+			}
+		}
+		select {
+		case <-t.stop:
+			log.Warn("[SS] Backfill branch %s stopped.", b.Name())
+			return
+		default:
+		}
+
+		t.mx.Lock()
+		t.progress.Current = sb.Version
+		t.mx.Unlock()
+
+		job := q.push(b, sb.Version, PriorityLow)
+		if job == nil {
+			log.Warn("[SS] Backfill branch %s stopped: %v.", b.Name(), ErrQueueClosed)
+			return
+		}
+		var err error
+		switch job = q.wait(job.ID, t.stop); {
+		case job == nil:
+			err = ErrJobNotFound
+		case !job.Done():
+			// stopped while waiting, the queued job is left to the queue
+			log.Warn("[SS] Backfill branch %s stopped.", b.Name())
+			return
+		case job.Status != JobSucceeded:
+			err = fmt.Errorf("%s", job.Message)
+		}
+
+		t.mx.Lock()
+		if err != nil {
+			t.progress.Failed++
+			t.progress.Errors[sb.Version] = err.Error()
+		} else {
+			t.progress.Done++
+		}
+		t.mx.Unlock()
+	}
+}
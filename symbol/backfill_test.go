@@ -0,0 +1,112 @@
+package symbol
+
+import (
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/adyzng/GoSymbols/config"
+)
+
+func TestMissingBuilds(t *testing.T) {
+	root, err := ioutil.TempDir("", "backfill")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(root)
+
+	config.PDBZipFile = "debug.zip"
+	now := time.Now()
+	for i, ver := range []string{"4175.2-540", "4175.2-538", "4175.2-539"} {
+		dir := filepath.Join(root, "Build"+ver)
+		os.MkdirAll(dir, 0755)
+		ioutil.WriteFile(filepath.Join(dir, config.PDBZipFile), []byte("zip"), 0644)
+		os.Chtimes(dir, now, now.Add(time.Duration(i-3)*time.Hour))
+	}
+	os.MkdirAll(filepath.Join(root, "Build4175.2-541"), 0755) // no debug zip
+
+	b := NewBranch2(&Branch{
+		StoreName: "test",
+		BuildPath: root,
+		StorePath: filepath.Join(root, "store"),
+	}).(*BrBuilder)
+	b.addBuild(&Build{ID: "0000000001", Version: "4175.2-538"})
+
+	missing, err := b.MissingBuilds()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(missing) != 2 || missing[0].Version != "4175.2-540" || missing[1].Version != "4175.2-539" {
+		t.Fatalf("unexpected missing builds %+v", missing)
+	}
+
+	config.LatestBuildFile = "latestbuild.txt"
+	ioutil.WriteFile(filepath.Join(root, config.LatestBuildFile), []byte("4175.2-539\r\n"), 0644)
+	all, err := b.ServerBuilds()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(all) != 3 || all[0].ID != "" || all[1].ID != "0000000001" || !all[2].Latest || all[1].Latest {
+		t.Fatalf("unexpected server builds %+v", all)
+	}
+}
+
+func TestBackfillQueue(t *testing.T) {
+	root, err := ioutil.TempDir("", "backfill")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(root)
+
+	config.PDBZipFile = "debug.zip"
+	for _, ver := range []string{"100", "101"} {
+		dir := filepath.Join(root, "Build"+ver)
+		os.MkdirAll(dir, 0755)
+		ioutil.WriteFile(filepath.Join(dir, config.PDBZipFile), []byte("zip"), 0644)
+	}
+	b := NewBranch2(&Branch{StoreName: "test", BuildPath: root, StorePath: filepath.Join(root, "store")}).(*BrBuilder)
+	ss := &sserver{
+		builders:  map[string]Builder{"test": b},
+		backfills: make(map[string]*backfillTask),
+		queue:     newJobQueue(),
+	}
+	defer ss.queue.Stop()
+
+	// only one of concurrent calls start a backfill
+	started := make(chan error, 4)
+	for i := 0; i < cap(started); i++ {
+		go func() {
+			_, err := ss.Backfill("test", BackfillOption{})
+			started <- err
+		}()
+	}
+	ok := 0
+	for i := 0; i < cap(started); i++ {
+		if <-started == nil {
+			ok++
+		}
+	}
+	if ok != 1 {
+		t.Fatalf("expect one backfill started, got %d", ok)
+	}
+
+	// builds go through the ingest queue at low priority, one at a time
+	for i := 0; ss.queue.Len() == 0 && i < 100; i++ {
+		time.Sleep(10 * time.Millisecond)
+	}
+	jobs := ss.queue.Jobs()
+	if len(jobs) != 1 || jobs[0].version != "100" || jobs[0].priority != PriorityLow {
+		t.Fatalf("expect build 100 queued at low priority, got %d jobs", len(jobs))
+	}
+	if !ss.StopBackfill("test") {
+		t.Fatal("expect running backfill stopped")
+	}
+	for i := 0; ss.BackfillProgress("test").Running && i < 100; i++ {
+		time.Sleep(10 * time.Millisecond)
+	}
+	if p := ss.BackfillProgress("test"); p.Running || p.Total != 2 {
+		t.Errorf("unexpected progress %+v", p)
+	}
+}
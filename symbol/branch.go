@@ -2,17 +2,21 @@ package symbol
 
 import (
 	"bufio"
+	"context"
 	"encoding/gob"
 	"fmt"
 	"io"
+	"io/fs"
+	"io/ioutil"
 	"os"
-	"os/exec"
 	"path/filepath"
 	"strings"
 	"sync"
 	"time"
 
 	"github.com/adyzng/GoSymbols/config"
+	"github.com/adyzng/GoSymbols/fault"
+	"github.com/adyzng/GoSymbols/pdb"
 	"github.com/adyzng/GoSymbols/util"
 
 	log "gopkg.in/clog.v1"
@@ -26,6 +30,8 @@ const (
 	branchBin = "branch.bin" // current branch information generated by GoSymbols
 	d2dNative = "\\D2D\\Native"
 
+	txLineBytes = 48 // shortest line of transaction file, see SymbolsCost
+
 	ArchX86 = "x86"
 	ArchX64 = "x64"
 )
@@ -39,16 +45,22 @@ var (
 	ErrBranchNotInit       = fmt.Errorf("branch not initialized")
 	ErrBranchOnSymbolStore = fmt.Errorf("invalid branch on symbol store")
 	ErrBranchOnBuildServer = fmt.Errorf("invalid branch on build server")
+	ErrQueueClosed         = fmt.Errorf("ingest queue closed")
+	ErrNoSymbolStored      = fmt.Errorf("no symbol file stored")
 )
 
 // BrBuilder represent pdb release
 //
 type BrBuilder struct {
 	Branch
-	builds  map[string]*Build  // save all builds for current branch
-	symbols map[string]*Symbol // save symbols
-	symPath string             // path that unzip debug.zip to
-	mx      sync.RWMutex
+	builds    map[string]*Build // save all builds for current branch
+	symPath   string            // path that unzip debug.zip to
+	mx        sync.RWMutex
+	ingMx     sync.Mutex        // only one ingest at a time, they share `symPath`
+	sums      map[string]string // relative path => sha256, loaded on demand
+	sumMx     sync.Mutex
+	migrating int32 // moving folders to two-tier layout, see MigrateLayout
+	fsys      fs.FS // the store is read from, see SetFS
 }
 
 func init() {
@@ -64,16 +76,15 @@ func NewBranch(buildName, storeName string) Builder {
 	return NewBranch2(&Branch{
 		BuildName:  buildName,
 		StoreName:  storeName,
-		UpdateDate: time.Now().Format("2006-01-02 15:04:05"),
+		UpdateDate: timestamp(now()),
 	})
 }
 
 // NewBranch2 ...
 func NewBranch2(branch *Branch) Builder {
 	b := &BrBuilder{
-		Branch:  *branch,
-		builds:  make(map[string]*Build, 1),
-		symbols: make(map[string]*Symbol, 1),
+		Branch: *branch,
+		builds: make(map[string]*Build, 1),
 	}
 	if b.StorePath == "" {
 		b.StorePath = filepath.Join(config.Destination, b.StoreName)
@@ -81,6 +92,11 @@ func NewBranch2(branch *Branch) Builder {
 	if b.BuildPath == "" {
 		b.BuildPath = filepath.Join(config.BuildSource, b.BuildName, "Release")
 	}
+	if b.Backend == "" && memoryMode() {
+		b.Backend = "mem://" + strings.ToLower(b.StoreName)
+	}
+	b.detectLayout()
+	b.detectSeal()
 	return b
 }
 
@@ -108,8 +124,17 @@ func (b *BrBuilder) CanBrowse() bool {
 
 // CanUpdate check if current branch is valid on build server.
 func (b *BrBuilder) CanUpdate() bool {
-	fpath := filepath.Join(b.BuildPath, config.LatestBuildFile)
-	if st, _ := os.Stat(fpath); st != nil && !st.IsDir() {
+	if b.fromFeed() {
+		return b.Package != ""
+	}
+	fpath := b.BuildPath
+	if d, ok := b.detector().(*markerDetector); ok {
+		fpath = filepath.Join(b.BuildPath, d.file)
+		if st, _ := os.Stat(fpath); st != nil && !st.IsDir() {
+			return true
+		}
+	} else if st, _ := os.Stat(fpath); st != nil && st.IsDir() {
+		// other detectors find builds in the folder
 		return true
 	}
 	log.Trace("[Branch] Access build path %s failed.", fpath)
@@ -148,10 +173,15 @@ func (b *BrBuilder) SetSubpath(buildserver, localstore string) error {
 	return nil
 }
 
-// Persist will save branch information into 000Admin/branch.bin
+// Persist will save branch information into the metadata database, or 000Admin/branch.bin
+// if there is none.
 //
 func (b *BrBuilder) Persist() error {
-	fpath := filepath.Join(b.StorePath, adminDir, branchBin)
+	if db := openMeta(); db != nil {
+		log.Trace("[Branch] Save branch %+v.", b.Branch)
+		return db.putBranch(&b.Branch)
+	}
+	fpath := b.branchFile(branchBin)
 	fd, err := os.OpenFile(fpath, os.O_WRONLY|os.O_CREATE|os.O_TRUNC, 666)
 	if err != nil {
 		log.Error(2, "[Branch] Persist branch %s failed: %v.", b.Name(), err)
@@ -167,15 +197,32 @@ func (b *BrBuilder) Persist() error {
 //
 func (b *BrBuilder) Delete() error {
 	log.Info("[Branch] Delete branch %+v.", b.Branch)
-	fpath := filepath.Join(b.StorePath, adminDir, branchBin)
+	transactions.purge(b.StoreName)
+	if db := openMeta(); db != nil {
+		if err := db.deleteBranch(b.StoreName); err != nil {
+			return err
+		}
+	}
+	fpath := b.branchFile(branchBin)
 	err := os.Remove(fpath)
+	if os.IsNotExist(err) && openMeta() != nil {
+		return nil
+	}
 	return err
 }
 
-// Load will load branch information from 000Admin/branch.bin
+// Load will load branch information from the metadata database. Branch saved in
+// 000Admin/branch.bin before is moved into the database.
 //
 func (b *BrBuilder) Load() error {
-	fpath := filepath.Join(b.StorePath, adminDir, branchBin)
+	db := openMeta()
+	if db != nil {
+		if found, err := db.getBranch(context.Background(), b.StoreName, &b.Branch); found || err != nil {
+			return err
+		}
+	}
+
+	fpath := b.branchFile(branchBin)
 	fd, err := os.OpenFile(fpath, os.O_RDONLY, 666)
 	if err != nil {
 		//log.Error(2, "[Branch] Load branch %s failed: %v.", b.Name(), err)
@@ -183,12 +230,18 @@ func (b *BrBuilder) Load() error {
 	}
 
 	defer fd.Close()
-	return gob.NewDecoder(fd).Decode(&b.Branch)
+	if err = gob.NewDecoder(fd).Decode(&b.Branch); err != nil || db == nil {
+		return err
+	}
+	log.Info("[Branch] Move %s of %s into metadata database.", branchBin, b.Name())
+	return db.putBranch(&b.Branch)
 }
 
-// getSymbols copy pdb zip file to local temp path and return the path
+// getSymbols copy pdb zip file to local temp path and return the path, or the debug zip
+// uploaded by build agent. The copy is aborted when `ctx` is done or `[ingest] COPY_TIMEOUT`
+// is exceeded.
 //
-func (b *BrBuilder) getSymbols(buildver string) (string, error) {
+func (b *BrBuilder) getSymbols(ctx context.Context, buildver string) (string, error) {
 	var (
 		fs    *os.File
 		fd    *os.File
@@ -196,10 +249,17 @@ func (b *BrBuilder) getSymbols(buildver string) (string, error) {
 		bytes int64
 	)
 
-	fsrc := fmt.Sprintf("%s\\Build%s\\%s", b.BuildPath, buildver, config.PDBZipFile)
+	if fzip := b.uploaded(buildver); fzip != "" {
+		log.Info("[Branch] Use uploaded %s of build %s.", fzip, buildver)
+		return fzip, nil
+	}
+	if b.fromFeed() {
+		return b.getPackage(buildver)
+	}
+	fsrc := filepath.Join(b.BuildPath, "Build"+buildver, config.PDBZipFile)
 	fzip := filepath.Join(b.symPath, config.PDBZipFile)
 
-	fd, err = os.OpenFile(fzip, os.O_WRONLY|os.O_CREATE|os.O_TRUNC, os.ModeTemporary)
+	fd, err = os.OpenFile(fzip, os.O_WRONLY|os.O_CREATE|os.O_TRUNC, 0644)
 	if err != nil {
 		log.Error(2, "[Branch] create zip file %s failed: %v.", fzip, err)
 		return "", err
@@ -214,8 +274,14 @@ func (b *BrBuilder) getSymbols(buildver string) (string, error) {
 	defer fs.Close()
 
 	log.Info("[Branch] Copy %s to %s.", fsrc, fzip)
+	ctx, cancel := stageContext(ctx, config.CopyTimeout)
+	defer cancel()
 	start := time.Now()
-	bytes, err = io.Copy(fd, fs)
+	bytes, err = copyContext(ctx, fd, struct {
+		io.Reader
+		io.Closer
+	}{fault.Reader(fault.Fetch, fs), fs})
+	err = stageError(ctx, "copy", err)
 	log.Info("[Branch] Copy complete: Size = %d, Time = %s.", bytes, time.Since(start))
 
 	if err != nil {
@@ -228,13 +294,13 @@ func (b *BrBuilder) getSymbols(buildver string) (string, error) {
 // getLatestBuild return latest build no. on build server
 //
 func (b *BrBuilder) getLatestBuild(local bool) (string, error) {
-	fpath := ""
-	if local {
-		fpath = filepath.Join(b.StorePath, adminDir, config.LatestBuildFile)
-	} else {
-		fpath = filepath.Join(b.BuildPath, config.LatestBuildFile)
+	if !local && b.fromFeed() {
+		return b.feedLatest()
+	} else if !local {
+		return b.detector().Latest(b)
 	}
 
+	fpath := b.branchFile(config.LatestBuildFile)
 	fd, err := os.OpenFile(fpath, os.O_RDONLY, 666)
 	if err != nil {
 		return "", err
@@ -250,10 +316,9 @@ func (b *BrBuilder) getLatestBuild(local bool) (string, error) {
 // GetLatestID return the last symbol build id
 //
 func (b *BrBuilder) GetLatestID() string {
-	fpath := filepath.Join(b.StorePath, adminDir, lastidTxt)
-	fd, err := os.OpenFile(fpath, os.O_RDONLY, 666)
+	fd, err := b.StoreFS().Open(adminName(lastidTxt))
 	if err != nil {
-		log.Error(2, "[Branch] Read latest build (%s) failed with %v.", fpath, err)
+		log.Error(2, "[Branch] Read latest build of %s failed with %v.", b.Name(), err)
 		return ""
 	}
 
@@ -267,7 +332,7 @@ func (b *BrBuilder) GetLatestID() string {
 // updateLatestBuild update local latest build file
 //
 func (b *BrBuilder) updateLatestBuild(latest string) error {
-	fpath := filepath.Join(b.StorePath, adminDir, config.LatestBuildFile)
+	fpath := b.branchFile(config.LatestBuildFile)
 	fd, err := os.OpenFile(fpath, os.O_WRONLY|os.O_CREATE|os.O_TRUNC, 666)
 	if err != nil {
 		log.Error(2, "[Branch] Open local latest build (%s) failed with %v.", fpath, err)
@@ -283,51 +348,58 @@ func (b *BrBuilder) updateLatestBuild(latest string) error {
 }
 
 // addSymStore call symstore.exe to add symbols to symbol store.
+// `note` is appended to the transaction comment. symstore.exe is killed when `ctx` is done
+// or `[ingest] SYMSTORE_TIMEOUT` is exceeded.
 //
-func (b *BrBuilder) addSymStore(latestbuild, symbols string) (*Build, error) {
-	start := time.Now()
-	comment := start.Format("2006-01-02_15:04:05")
+func (b *BrBuilder) addSymStore(ctx context.Context, latestbuild, symbols, note string) (*Build, error) {
+	start := now()
+	comment := start.Format(commentFormat)
+	if note != "" {
+		comment += " " + note
+	}
 	log.Info("[Branch] Call symbol store command for build %s ...", latestbuild)
+	if err := b.prepareLayout(); err != nil {
+		log.Error(2, "[Branch] Prepare store layout of %s failed: %v.", b.Name(), err)
+		return nil, err
+	}
 
-	/*
-		"C:\Program Files (x86)\Windows Kits\8.1\Debuggers\x86\symstore.exe"
-			add
-			/r
-			/l
-			/f \\rmdm-bldvm-l902\CurrentRelease\UDP\UDPMAIN\Intermediate\B%BUILD_NUMBER%\debug\*.pdb
-			/s S:\SymbolServer\Titanium
-			/t Titanium
-			/v %BUILD_NUMBER%
-			/c %date:~-10%_%time:~0,8%
-	*/
-	cmd := exec.Command(config.SymStoreExe, "add", "/r",
-		"/f", symbols,
-		"/s", b.StorePath,
-		"/t", b.Name(),
-		"/v", latestbuild,
-		"/c", comment)
+	unlock, err := lockAdmin(b.StorePath)
+	if err != nil {
+		log.Error(2, "[Branch] Lock admin files of %s failed: %v.", b.StorePath, err)
+		return nil, err
+	}
+	defer unlock()
+	last, _ := ioutil.ReadFile(filepath.Join(b.StorePath, adminDir, lastidTxt))
 
 	var (
-		err    error
 		output []byte
 		done   = make(chan struct{}, 1)
 	)
+	ctx, cancel := stageContext(ctx, config.SymStoreTimeout)
+	defer cancel()
 	go func() {
-		output, err = cmd.CombinedOutput()
+		output, err = faultSymStore{SymStore}.Add(ctx, b.StorePath, b.Name(), latestbuild, comment, symbols)
 		done <- struct{}{}
 	}()
 
 	<-done
+	err = stageError(ctx, "symstore", err)
 	log.Info("[Branch] Symbol store output: %s.", string(output))
-	log.Info("[Branch] Symbol store complete: %s.", time.Since(start))
+	log.Info("[Branch] Symbol store complete: %s.", now().Sub(start))
 
 	if err != nil {
 		log.Info("[Branch] Symbol store command failed with %s.", err)
 		return nil, err
 	}
+	id := b.GetLatestID()
+	if id == strings.TrimSpace(string(last)) {
+		// no transaction is added without symbol files
+		log.Warn("[Branch] No symbol file of build %s stored.", latestbuild)
+		return nil, ErrNoSymbolStored
+	}
 	build := &Build{
-		ID:      b.GetLatestID(),
-		Date:    start.Format("2006-01-02 15:04:05"),
+		ID:      id,
+		Date:    timestamp(start),
 		Branch:  b.Name(),
 		Version: latestbuild,
 		Comment: comment,
@@ -340,7 +412,7 @@ func (b *BrBuilder) getBuild(version string, id string) *Build {
 	defer b.mx.RUnlock()
 	if version != "" {
 		for _, val := range b.builds {
-			if val.Version == version {
+			if val.Version == version && val.SupplementOf == "" {
 				return val
 			}
 		}
@@ -357,67 +429,211 @@ func (b *BrBuilder) addBuild(build *Build) {
 	b.mx.Lock()
 	defer b.mx.Unlock()
 
-	b.BuildsCount++
 	b.UpdateDate = build.Date
+	b.scope(build)
 	b.builds[build.ID] = build
+
+	if build.SupplementOf == "" {
+		b.BuildsCount++
+	} else if parent, ok := b.builds[build.SupplementOf]; ok {
+		parent.Supplements = append(parent.Supplements, build.ID)
+	}
 }
 
-// AddBuild add new version of pdb
+// AddBuild add new version of pdb, the ingest is aborted when `ctx` is done.
 //
-func (b *BrBuilder) AddBuild(buildVerion string) error {
+func (b *BrBuilder) AddBuild(ctx context.Context, buildVerion string) error {
+	return b.ingestBuild(ctx, buildVerion, nil)
+}
+
+// ingestBuild add build `buildVerion` like AddBuild, `progress` (if not nil) is called at
+// the start of each stage and stop the ingest on error.
+func (b *BrBuilder) ingestBuild(ctx context.Context, buildVerion string, progress func(version string, stage JobStage) error) (err error) {
+	if progress == nil {
+		progress = func(string, JobStage) error { return nil }
+	}
+	b.ingMx.Lock()
+	defer b.ingMx.Unlock()
+	if err := b.writable(); err != nil {
+		return err
+	}
+
 	latest := buildVerion
 	local, err := b.getLatestBuild(true)
 
 	if buildVerion == "" {
 		if latest, err = b.getLatestBuild(false); err != nil {
 			log.Error(2, "[Branch] Get server latest build failed: %v.", err)
-			return fmt.Errorf("invalid build server latestbuild.txt file")
+			return fmt.Errorf("latest build not found on build server: %v", err)
 		}
 		if latest == local {
 			log.Trace("[Branch] Branch %s already updated to latest %s.", b.Name(), latest)
 			return nil
 		}
 	}
-	if b.getBuild(latest, "") != nil {
+	resume := b.getBuild(latest, "")
+	if resume != nil && !resumable(resume) {
 		log.Warn("[Branch] Symbols for build %s already exist.", latest)
 		return nil
 	}
+	if err = b.checkWritable(); err != nil {
+		return err
+	}
 	log.Info("[Branch] Add symbols for build %s. Local: %s.", latest, local)
 
+	// store is modified from here (ingest status, unzip folder), block while snapshot is
+	// taken until the unzip folder is removed
+	defer beginWrite()()
+
+	in := b.startIngest(latest)
+	defer func() { in.finish(err) }()
+	defer func() { err = b.readOnly(in, err) }()
+	if err = in.move(StatusIngesting, ""); err != nil {
+		return err
+	}
+
 	b.symPath = filepath.Join(b.StorePath, unzipDir)
-	if err = os.MkdirAll(b.symPath, 666); err != nil {
+	if err = os.MkdirAll(b.symPath, 0755); err != nil {
 		log.Error(2, "[Branch] Create symbol path %s failed with %v.", b.symPath, err)
 		return err
 	}
 	defer os.RemoveAll(b.symPath)
 
 	var symbolZip string
-	if symbolZip, err = b.getSymbols(latest); err != nil {
+	built, measured := b.buildCompleted(latest)
+	clock := newStageClock()
+	if err = progress(latest, StageCopying); err != nil {
+		return err
+	}
+	if symbolZip, err = b.getSymbols(ctx, latest); err != nil {
 		log.Error(2, "[Branch] Get symbols failed: %v.", err)
 		return err
 	}
+	clock.lap(&clock.timing.Copy)
+	if fi, err := os.Stat(symbolZip); err == nil {
+		clock.timing.Bytes = fi.Size()
+	}
+	if err = progress(latest, StageUnzipping); err != nil {
+		return err
+	}
+	if err = ctx.Err(); err != nil {
+		return err
+	}
 	if err = util.Unzip(symbolZip, b.symPath); err != nil {
 		log.Error(2, "[Branch] Unzip symbols failed: %v.", err)
 		return err
 	}
+	renamed, err := b.applyRenames(b.symPath)
+	if err != nil {
+		log.Error(2, "[Branch] Rename symbols failed: %v.", err)
+		return err
+	}
+	if err = b.scanFiles(latest, b.symPath); err != nil {
+		return err
+	}
+	b.indexSources(latest, b.symPath)
+	validation, err := b.checkSymbols(latest, b.symPath)
+	if err != nil {
+		return err
+	}
+	clock.lap(&clock.timing.Unzip)
 
-	var build *Build
-	if build, err = b.addSymStore(latest, b.symPath); err != nil {
-		log.Error(2, "[Branch] Add to symbol store failed with %v.", err)
+	// the store may turn read-only while copying, don't start a transaction on it
+	if err = ctx.Err(); err != nil {
+		return err
+	}
+	if err = b.checkWritable(); err != nil {
 		return err
 	}
-	if err = b.updateLatestBuild(latest); err != nil {
+	if err = progress(latest, StageStoring); err != nil {
 		return err
 	}
 
-	b.addBuild(build)
+	if err = b.checkConflicts(latest, b.symPath); err != nil {
+		log.Error(2, "[Branch] Check symbol conflict failed: %v.", err)
+		return err
+	}
+
+	b.shadowIngest(ctx, latest, b.symPath)
+
+	parts, err := b.splitParts(b.symPath)
+	if err != nil {
+		log.Error(2, "[Branch] Split symbols failed: %v.", err)
+		return err
+	}
+	defer os.RemoveAll(filepath.Join(b.StorePath, splitDir))
+
+	build := resume
+	if build == nil {
+		if build, err = b.addSymStore(ctx, latest, b.symPath, partNote("", 1, len(parts))); err != nil {
+			log.Error(2, "[Branch] Add to symbol store failed with %v.", err)
+			return err
+		}
+		build.Part = parsePart(build.Comment)
+		b.notifyChannel(build)
+		b.addBuild(build)
+	} else if part := parsePart(partNote("", 1, len(parts))); build.Part != part {
+		return fmt.Errorf("build %s was added in parts %q, can't resume it in parts %q", latest, build.Part, part)
+	} else {
+		log.Info("[Branch] Resume ingest of build %s (%s) of %s.", latest, build.ID, b.Name())
+	}
+	in.add(build)
+	if err = b.publishParts(ctx, in, build, parts[1:], renamed); err != nil {
+		return err
+	}
+	if _, err = b.storeBinaries(build.ID, b.symPath); err != nil {
+		log.Error(2, "[Branch] Store ELF binaries failed: %v.", err)
+		return err
+	}
+	if _, err = b.storeBreakpad(build.ID, b.symPath); err != nil {
+		log.Warn("[Branch] Store breakpad symbols of %s failed: %v.", build.ID, err)
+	}
+	clock.lap(&clock.timing.SymStore)
+	if err = in.move(StatusVerifying, ""); err != nil {
+		return err
+	}
+	progress(latest, StageVerifying)
+
+	b.encryptOrAlert(build.ID)
+	b.signOrWarn(signAdd, build.ID)
+	if err = b.recordRenames(build.ID, renamed); err != nil {
+		log.Warn("[Branch] Record renames of %s failed: %v.", build.ID, err)
+	}
+	if err = b.linkTickets(build, latest); err != nil {
+		log.Warn("[Branch] Link tickets of %s failed: %v.", build.ID, err)
+	}
+	if err = b.recordValidation(build, validation); err != nil {
+		log.Warn("[Branch] Record validation of %s failed: %v.", build.ID, err)
+	}
+	if err = b.recordChecksums(build.ID); err != nil {
+		log.Warn("[Branch] Record checksums of %s failed: %v.", build.ID, err)
+	}
+	if _, err = b.recordSigning(build.ID, b.symPath); err != nil {
+		log.Warn("[Branch] Record signature status of %s failed: %v.", build.ID, err)
+	}
+	if err = b.pushOrAlert(build.ID); err != nil {
+		return err
+	}
+	clock.lap(&clock.timing.Metadata)
+	b.recordTimings(build, clock.done())
+	if err = in.move(StatusComplete, ""); err != nil {
+		return err
+	}
+	b.dropUpload(latest)
+	if measured {
+		b.recordLatency(build, built)
+	}
+	if buildVerion != "" && local != "" {
+		// explicit (maybe historical) build, keep the latest build marker
+		return nil
+	}
 	b.LatestBuild = latest
-	return nil
+	return b.updateLatestBuild(latest)
 }
 
-// ParseBuilds parse server.txt to get pdb history
+// ParseBuilds parse server.txt to get pdb history, stop with the error of `ctx` once done.
 //
-func (b *BrBuilder) ParseBuilds(handler func(b *Build) error) (int, error) {
+func (b *BrBuilder) ParseBuilds(ctx context.Context, handler func(b *Build) error) (int, error) {
 	if handler == nil {
 		handler = func(bd *Build) error {
 			//fmt.Println(bd)
@@ -428,6 +644,9 @@ func (b *BrBuilder) ParseBuilds(handler func(b *Build) error) (int, error) {
 	total := 0
 	if len(b.builds) != 0 {
 		for _, bd := range b.builds {
+			if err := ctx.Err(); err != nil {
+				return total, err
+			}
 			if err := handler(bd); err != nil {
 				log.Error(2, "[Branch] Parse build(%v) failed: %v.", bd, err)
 				return total, err
@@ -437,61 +656,86 @@ func (b *BrBuilder) ParseBuilds(handler func(b *Build) error) (int, error) {
 		return total, nil
 	}
 
-	txtPath := filepath.Join(b.StorePath, adminDir, serverTxt)
-	fc, err := os.OpenFile(txtPath, os.O_RDONLY, 666)
+	if err := ctx.Err(); err != nil {
+		return 0, err
+	}
+	builds, err := b.serverBuilds()
 	if err != nil {
-		log.Error(2, "[Branch] Open file (%s) failed with %v.", txtPath, err)
 		return 0, err
 	}
-	defer fc.Close()
 
 	// clean, will re-calculate it
 	b.BuildsCount = 0
-	r := bufio.NewReader(fc)
-	for {
-		str, err := r.ReadString('\n')
-		if err == io.EOF {
-			break
+	latest := ""
+	releases := b.releaseMarks()
+	timings := b.stageTimings()
+	holds := b.legalHolds()
+	statuses := b.buildStatuses()
+	channels := b.channelMarks()
+	latencies := b.latencies()
+	tickets := b.buildTickets()
+	validations := b.buildValidations()
+	for _, build := range builds {
+		build.Release = releases[build.ID]
+		build.Stages = timings[build.ID]
+		build.Hold = holds[build.ID]
+		build.Latency = latencies[build.ID]
+		build.Tickets = tickets[build.ID]
+		build.Validation = validations[build.ID]
+		build.Status = b.statusOf(statuses, build.ID)
+		build.Channel = b.channelOf(channels, build)
+
+		total++
+		b.addBuild(build)
+		if build.SupplementOf == "" && (latest == "" || b.CompareVersion(build.Version, latest) >= 0) {
+			// backfilled builds are added after newer ones
+			latest = build.Version
+			b.LatestBuild = latest
 		}
-		str = strings.Trim(str, "\r\n")
 
-		//         0   1    2          3        4          5            6                   7
-		//0000000001,add,file,07/04/2017,14:44:14,"UDPv6.5U2","4175.2-538","2017/7/4_14:44:14",
-		ss := strings.Split(str, ",")
-		if len(ss) < 8 {
-			log.Warn("[Branch] Invalid line (%s) in server.txt.", str)
+		if ctx.Err() != nil {
+			// keep loading, a partial list would be taken as all builds
 			continue
 		}
-
-		dateStr := ss[3] + " " + ss[4]
-		dateLoc, err := time.ParseInLocation("01/02/2006 15:04:05", dateStr, time.Local)
-		if err != nil {
-			log.Warn("[Branch] Parse date failed with %v.", err)
-		} else {
-			dateStr = dateLoc.Format("2006-01-02 15:04:05")
+		if err = handler(build); err != nil {
+			return total, err
 		}
+	}
 
-		build := &Build{
-			ID:      ss[0],
-			Date:    dateStr,
-			Branch:  strings.Trim(ss[5], "\""),
-			Version: strings.Trim(ss[6], "\""),
-			Comment: strings.Trim(ss[7], "\""),
-		}
+	return total, ctx.Err()
+}
 
-		total++
-		b.addBuild(build)
-		b.LatestBuild = build.Version
+// parseBuildLine parse an `add` line of server.txt or history.txt, nil if invalid
+func parseBuildLine(str string) *Build {
+	//         0   1    2          3        4          5            6                   7
+	//0000000001,add,file,07/04/2017,14:44:14,"UDPv6.5U2","4175.2-538","2017/7/4_14:44:14",
+	ss := strings.Split(str, ",")
+	if len(ss) < 8 {
+		return nil
+	}
 
-		if err = handler(build); err != nil {
-			return total, err
-		}
+	dateStr := ss[3] + " " + ss[4]
+	dateLoc, err := time.ParseInLocation("01/02/2006 15:04:05", dateStr, time.Local)
+	if err != nil {
+		log.Warn("[Branch] Parse date failed with %v.", err)
+	} else {
+		dateStr = dateLoc.Format(TimeFormat)
 	}
 
-	return total, nil
+	build := &Build{
+		ID:      ss[0],
+		Date:    dateStr,
+		Branch:  strings.Trim(ss[5], "\""),
+		Version: strings.Trim(ss[6], "\""),
+		Comment: strings.Trim(ss[7], "\""),
+	}
+	build.SupplementOf = parseSupplement(build.Comment)
+	build.Part = parsePart(build.Comment)
+	return build
 }
 
-// ParseSymbols parse 000000001(*) from pdb path
+// ParseSymbols parse 000000001(*) from pdb path. If the build has supplementary
+// transactions, the re-published symbols supersede the old ones.
 //
 func (b *BrBuilder) ParseSymbols(buildID string, handler func(sym *Symbol) error) (int, error) {
 	build := b.getBuild("", buildID)
@@ -499,21 +743,55 @@ func (b *BrBuilder) ParseSymbols(buildID string, handler func(sym *Symbol) error
 		log.Error(2, "[Branch] Build %s not exist for %s.", buildID, b.Name())
 		return 0, ErrBuildNotExist
 	}
-
-	idPath := filepath.Join(b.StorePath, adminDir, buildID)
-	fd, err := os.OpenFile(idPath, os.O_RDONLY, 666)
-	if err != nil {
-		log.Error(2, "[Branch] Open file (%s) failed with %v.", idPath, err)
-		return 0, err
-	}
-	defer fd.Close()
-
 	if handler == nil {
 		handler = func(sym *Symbol) error {
 			//fmt.Println(sym)
 			return nil
 		}
 	}
+	if len(build.Supplements) == 0 {
+		return b.parseTransaction(build, handler)
+	}
+
+	syms, err := b.symbolChain(build)
+	total := 0
+	for _, sym := range syms {
+		if sym.SupersededBy != "" {
+			continue
+		}
+		if err := handler(sym); err != nil {
+			return total, err
+		}
+		total++
+	}
+	return total, err
+}
+
+// SymbolsCost estimate the symbols of build `buildID` and its supplements from the size
+// of the transaction files, without reading them. At least 1.
+//
+func (b *BrBuilder) SymbolsCost(buildID string) int {
+	ids := []string{buildID}
+	if build := b.getBuild("", buildID); build != nil {
+		ids = append(ids, build.Supplements...)
+	}
+	cost := 1
+	for _, id := range ids {
+		if fi, err := fs.Stat(b.StoreFS(), adminName(id)); err == nil {
+			cost += int(fi.Size() / txLineBytes)
+		}
+	}
+	return cost
+}
+
+// parseTransaction parse symbols added by single transaction file 000Admin/{ID}
+//
+func (b *BrBuilder) parseTransaction(build *Build, handler func(sym *Symbol) error) (int, error) {
+	buildID := build.ID
+	entries, err := b.readTransaction(buildID)
+	if err != nil {
+		return 0, err
+	}
 	skipFn := func(name string) bool {
 		for _, v := range config.SymExcludeList {
 			if strings.ToLower(name) == v {
@@ -534,39 +812,20 @@ func (b *BrBuilder) ParseSymbols(buildID string, handler func(sym *Symbol) error
 	}
 
 	total := 0
-	r := bufio.NewReader(fd)
 	unqMap := make(map[string]*Symbol, 0)
+	originals := b.originalNames(buildID)
 
-	for {
-		str, err := r.ReadString('\n') //0D 0A
-		if err == io.EOF {
-			break
-		}
-		str = strings.Trim(str, "\r\n")
-
-		//
-		// "cbt_client.pdb\8E3868FEE1FA4AC8A42D0FACA65E0BE41","S:\script\temp\ExternalLib\RHAPdbfile\cbt_client.pdb"
-		ss := strings.Split(str, ",")
-		if len(ss) < 2 {
-			log.Warn("[Branch] Invalid line (%s) in %s.", str, buildID)
-			continue
-		}
-
-		pName := strings.Split(strings.Trim(ss[0], "\""), "\\")
-		if len(pName) != 2 {
-			// invalid format
-			continue
-		}
-		if skipFn(pName[0]) {
+	for _, e := range entries {
+		if skipFn(e.Name) {
 			// exclude list
 			continue
 		}
-		if _, ok := unqMap[pName[1]]; ok {
+		if _, ok := unqMap[e.Hash]; ok {
 			// deplicate symbol
 			continue
 		}
 
-		spath := strings.Trim(ss[1], "\"")
+		spath := e.Path
 		if idx := strings.Index(spath, unzipDir); idx != -1 {
 			spath = spath[idx+len(unzipDir):]
 		} else {
@@ -581,25 +840,49 @@ func (b *BrBuilder) ParseSymbols(buildID string, handler func(sym *Symbol) error
 		}
 
 		sym := &Symbol{
-			Name:    pName[0],
-			Hash:    pName[1],
-			Path:    spath,
-			Arch:    archDetect(spath),
-			Version: build.Version,
+			Name:        e.Name,
+			Hash:        e.Hash,
+			Path:        spath,
+			Arch:        archDetect(spath),
+			Version:     build.Version,
+			Transaction: build.ID,
+			Store:       b.StoreName,
+			BuildKey:    BuildKey(b.StoreName, build.ID),
+			Original:    originalOf(originals, spath, e.Name),
 		}
 		// download url: /api/symbol/{branch}/{hash}/{name}
-		sym.URL = fmt.Sprintf("/api/symbol/%s/%s/%s", b.StoreName, sym.Hash, sym.Name)
+		sym.URL = config.ExternalURL(fmt.Sprintf("/api/symbol/%s/%s/%s", b.StoreName, sym.Hash, sym.Name))
 		if err = handler(sym); err != nil {
 			return total, err
 		}
 		total++
 		unqMap[sym.Hash] = sym
 	}
-	return total, err
+	return total, nil
 }
 
 // GetSymbolPath return symbol's full path
 //
 func (b *BrBuilder) GetSymbolPath(hash, name string) string {
-	return filepath.Join(b.StorePath, name, hash, name)
+	fpath := b.symbolPath(hash, name)
+	if _, err := os.Stat(fpath); err != nil && b.refreshLayout() {
+		fpath = b.symbolPath(hash, name)
+	}
+	return fpath
+}
+
+// symbolPath return path of symbol in the current layout, see GetSymbolPath
+func (b *BrBuilder) symbolPath(hash, name string) string {
+	fpath := filepath.Join(b.symbolDir(name, hash), name)
+	if !pdb.IsCompressed(name) {
+		return b.fetchBackend(fpath)
+	}
+	// compressed file is in the folder of the uncompressed name, eg: foo.pdb/{hash}/foo.pd_
+	for _, orig := range pdb.UncompressedNames(name) {
+		alt := filepath.Join(b.symbolDir(orig, hash), name)
+		if _, err := os.Stat(b.fetchBackend(alt)); err == nil {
+			return alt
+		}
+	}
+	return b.fetchBackend(fpath)
 }
@@ -1,6 +1,7 @@
 package symbol
 
 import (
+	"context"
 	"fmt"
 	"testing"
 	"time"
@@ -10,7 +11,7 @@ func TestParseBuilds(t *testing.T) {
 	lastBuild := ""
 	builder := NewBranch("UDP_6_5_U2", "UDPv6.5U2")
 
-	total, err := builder.ParseBuilds(func(b *Build) error {
+	total, err := builder.ParseBuilds(context.Background(), func(b *Build) error {
 		fmt.Printf("%s: %+v \n", b.ID, b)
 		lastBuild = b.ID
 		return nil
@@ -34,7 +35,7 @@ func TestParseBuilds(t *testing.T) {
 
 func TestAddBuild(t *testing.T) {
 	builder := NewBranch("UDP_6_5_U2", "UDPv6.5U2")
-	if err := builder.AddBuild(""); err != nil {
+	if err := builder.AddBuild(context.Background(), ""); err != nil {
 		time.Sleep(time.Second)
 		t.Fatal(err)
 	}
@@ -0,0 +1,257 @@
+package symbol
+
+import (
+	"bufio"
+	"bytes"
+	"fmt"
+	"io"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"strings"
+
+	"github.com/adyzng/GoSymbols/config"
+	log "gopkg.in/clog.v1"
+)
+
+const (
+	breakpadDir = "000Breakpad"  // breakpad symbols parallel to the store, {file}/{id}/{name}.sym
+	breakpadTxt = "breakpad.txt" // breakpad symbols generated at ingest, `{date},{id},{file},{debugid}`
+)
+
+var (
+	ErrBreakpadModule = fmt.Errorf("invalid breakpad symbols, expect MODULE line")
+)
+
+// SymDumper convert a pdb to Breakpad text symbols written to `w`.
+//
+type SymDumper interface {
+	Dump(fpath string, w io.Writer) error
+}
+
+// BreakpadDumper is used by all branches when `[breakpad] DUMP_SYMS` is set, tests replace
+// it with a fake one.
+//
+var BreakpadDumper SymDumper = execDumpSyms{}
+
+// execDumpSyms call config.DumpSymsExe, symbols are on stdout
+type execDumpSyms struct{}
+
+func (execDumpSyms) Dump(fpath string, w io.Writer) error {
+	var stderr bytes.Buffer
+	cmd := exec.Command(config.DumpSymsExe, fpath)
+	cmd.Stdout, cmd.Stderr = w, &stderr
+	setPriority(cmd)
+	if err := cmd.Start(); err != nil {
+		return err
+	}
+	lowerIO(cmd.Process)
+	if err := cmd.Wait(); err != nil {
+		return fmt.Errorf("%v: %s", err, strings.TrimSpace(stderr.String()))
+	}
+	return nil
+}
+
+// BreakpadSym is a Breakpad symbol file generated from a pdb at ingest
+//
+type BreakpadSym struct {
+	Date    string `json:"date"`
+	ID      string `json:"id"`      // transaction of the build shipping the pdb
+	File    string `json:"file"`    // debug file, eg: foo.pdb
+	DebugID string `json:"debugId"` // guid and age, the same as the store hash of the pdb
+}
+
+// breakpadName return name of the .sym file of debug file `file`, eg: foo.pdb => foo.sym
+func breakpadName(file string) string {
+	if strings.EqualFold(filepath.Ext(file), ".pdb") {
+		file = file[:len(file)-len(".pdb")]
+	}
+	return file + ".sym"
+}
+
+// breakpadPath return path of symbols of debug file `file` with `debugID`
+func (b *BrBuilder) breakpadPath(file, debugID string) string {
+	return filepath.Join(b.StorePath, breakpadDir, file, debugID, breakpadName(file))
+}
+
+// pathElem check `s` is a single path element, not `.` or `..`
+func pathElem(s string) bool {
+	return s != "" && s != "." && s != ".." && !strings.ContainsAny(s, `/\:`)
+}
+
+// parseModule parse first line of Breakpad symbols, `MODULE {os} {arch} {debugid} {file}`
+func parseModule(line string) (file, debugID string, err error) {
+	ss := strings.Fields(line)
+	if len(ss) < 5 || ss[0] != "MODULE" {
+		return "", "", ErrBreakpadModule
+	}
+	return strings.Join(ss[4:], " "), strings.ToUpper(ss[3]), nil
+}
+
+// storeBreakpad dump pdbs under `symPath` to Breakpad symbols in 000Breakpad, for crash
+// reporting backends (Socorro, minidump-stackwalk). They're recorded against transaction
+// `id` so purge of the build removes them. A pdb which fails is skipped with a warning.
+func (b *BrBuilder) storeBreakpad(id, symPath string) (int, error) {
+	if config.DumpSymsExe == "" {
+		return 0, nil
+	}
+	root := filepath.Join(b.StorePath, breakpadDir)
+	if err := os.MkdirAll(root, 0755); err != nil {
+		return 0, err
+	}
+
+	var syms []*BreakpadSym
+	filepath.Walk(symPath, func(fpath string, fi os.FileInfo, err error) error {
+		if err != nil || fi.IsDir() || !strings.EqualFold(filepath.Ext(fi.Name()), ".pdb") {
+			return nil
+		}
+		sym, err := b.dumpBreakpad(id, fpath, root)
+		if err != nil {
+			log.Warn("[Branch] Dump breakpad symbols of %s failed: %v.", fpath, err)
+			return nil
+		}
+		syms = append(syms, sym)
+		return nil
+	})
+	if len(syms) == 0 {
+		return 0, nil
+	}
+
+	fd, err := os.OpenFile(b.branchFile(breakpadTxt), os.O_WRONLY|os.O_CREATE|os.O_APPEND, 0644)
+	if err != nil {
+		return 0, err
+	}
+	defer fd.Close()
+	w := bufio.NewWriter(fd)
+	for _, sym := range syms {
+		fmt.Fprintf(w, "%s,%s,%s,%s\r\n", sym.Date, sym.ID, sym.File, sym.DebugID)
+	}
+	log.Info("[Branch] Store %d breakpad symbols of transaction %s.", len(syms), id)
+	return len(syms), w.Flush()
+}
+
+// dumpBreakpad dump pdb `fpath` to a temp file in `root`, then move it under the debug file
+// and id read from its MODULE line
+func (b *BrBuilder) dumpBreakpad(id, fpath, root string) (*BreakpadSym, error) {
+	tmp := filepath.Join(root, filepath.Base(fpath)+".tmp")
+	defer os.Remove(tmp)
+	fd, err := os.Create(tmp)
+	if err != nil {
+		return nil, err
+	}
+	err = BreakpadDumper.Dump(fpath, fd)
+	if cerr := fd.Close(); err == nil {
+		err = cerr
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	if fd, err = os.Open(tmp); err != nil {
+		return nil, err
+	}
+	line, _ := bufio.NewReader(fd).ReadString('\n')
+	fd.Close()
+	file, debugID, err := parseModule(line)
+	if err != nil {
+		return nil, err
+	}
+	if !pathElem(file) || !pathElem(debugID) {
+		return nil, ErrBreakpadModule
+	}
+
+	dst := b.breakpadPath(file, debugID)
+	if err = os.MkdirAll(filepath.Dir(dst), 0755); err != nil {
+		return nil, err
+	}
+	if err = os.Rename(tmp, dst); err != nil {
+		return nil, err
+	}
+	return &BreakpadSym{Date: timestamp(now()), ID: id, File: file, DebugID: debugID}, nil
+}
+
+// BreakpadSyms return Breakpad symbols generated at ingest, oldest first.
+//
+func (b *BrBuilder) BreakpadSyms() ([]*BreakpadSym, error) {
+	fd, err := os.Open(b.branchFile(breakpadTxt))
+	if os.IsNotExist(err) {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+	defer fd.Close()
+
+	var syms []*BreakpadSym
+	scan := bufio.NewScanner(fd)
+	for scan.Scan() {
+		ss := strings.Split(strings.TrimSpace(scan.Text()), ",")
+		if len(ss) == 4 {
+			syms = append(syms, &BreakpadSym{Date: ss[0], ID: ss[1], File: ss[2], DebugID: ss[3]})
+		}
+	}
+	return syms, scan.Err()
+}
+
+// purgeBreakpad remove Breakpad symbols recorded only by transactions `ids`, the records
+// of `ids` are dropped from breakpad.txt.
+func (b *BrBuilder) purgeBreakpad(ids []string) error {
+	syms, err := b.BreakpadSyms()
+	if err != nil || len(syms) == 0 {
+		return err
+	}
+	purged := make(map[string]bool, len(ids))
+	for _, id := range ids {
+		purged[id] = true
+	}
+	var kept []*BreakpadSym
+	used := make(map[string]bool)
+	for _, sym := range syms {
+		if !purged[sym.ID] {
+			kept = append(kept, sym)
+			used[sym.File+"/"+sym.DebugID] = true
+		}
+	}
+	if len(kept) == len(syms) {
+		return nil
+	}
+	for _, sym := range syms {
+		if purged[sym.ID] && !used[sym.File+"/"+sym.DebugID] {
+			dir := filepath.Dir(b.breakpadPath(sym.File, sym.DebugID))
+			if err = os.RemoveAll(dir); err != nil {
+				log.Warn("[Branch] Remove breakpad symbols %s failed: %v.", dir, err)
+			}
+		}
+	}
+
+	var buf bytes.Buffer
+	for _, sym := range kept {
+		fmt.Fprintf(&buf, "%s,%s,%s,%s\r\n", sym.Date, sym.ID, sym.File, sym.DebugID)
+	}
+	return writeFileAtomic(b.branchFile(breakpadTxt), buf.Bytes())
+}
+
+// FindBreakpad search all branches for Breakpad symbols of debug file `file` with
+// `debugID`, in the layout of Breakpad symbol servers `{file}/{debugid}/{name}.sym`.
+// Return nil if not exist.
+//
+func (ss *sserver) FindBreakpad(file, debugID, name string) *SymbolFile {
+	debugID = strings.ToUpper(debugID)
+	if !pathElem(file) || !pathElem(debugID) || !strings.EqualFold(name, breakpadName(file)) {
+		return nil
+	}
+	var found *SymbolFile
+	ss.WalkBuilders(func(bu Builder) error {
+		b, ok := bu.(*BrBuilder)
+		if !ok {
+			return nil
+		}
+		fpath := b.breakpadPath(file, debugID)
+		if st, err := os.Stat(fpath); err == nil && !st.IsDir() {
+			found = &SymbolFile{Builder: b, Path: fpath, Info: st}
+			return errFound
+		}
+		return nil
+	})
+	return found
+}
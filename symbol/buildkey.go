@@ -0,0 +1,63 @@
+package symbol
+
+import (
+	"context"
+	"fmt"
+	"strings"
+)
+
+const (
+	buildKeySep = "@"
+)
+
+var (
+	ErrInvalidBuildKey = fmt.Errorf("invalid build key, expect {store}@{transaction id}")
+)
+
+// BuildKey return the key identify a build across branches, versions like `4175.2-538`
+// repeat in branches but transaction IDs are unique in one store, eg: UDPv6.5U2@0000000012.
+//
+func BuildKey(store, id string) string {
+	return store + buildKeySep + id
+}
+
+// ParseBuildKey split build key to store name and transaction ID.
+//
+func ParseBuildKey(key string) (store, id string, err error) {
+	idx := strings.LastIndex(key, buildKeySep)
+	if idx <= 0 {
+		return "", "", ErrInvalidBuildKey
+	}
+	store, id = key[:idx], key[idx+1:]
+	if len(id) != 10 || strings.Trim(id, "0123456789") != "" {
+		return "", "", ErrInvalidBuildKey
+	}
+	return store, id, nil
+}
+
+// scope set store name and key of build parsed from this branch
+func (b *BrBuilder) scope(build *Build) {
+	build.Store = b.StoreName
+	build.Key = BuildKey(b.StoreName, build.ID)
+}
+
+// FindBuild resolve build key to the branch and build.
+//
+func (ss *sserver) FindBuild(key string) (*BrBuilder, *Build, error) {
+	store, id, err := ParseBuildKey(key)
+	if err != nil {
+		return nil, nil, err
+	}
+	b, ok := ss.Get(store).(*BrBuilder)
+	if !ok {
+		return nil, nil, ErrBranchNotInit
+	}
+	if _, err = b.ParseBuilds(context.Background(), nil); err != nil {
+		return nil, nil, err
+	}
+	build := b.getBuild("", id)
+	if build == nil {
+		return nil, nil, ErrBuildNotExist
+	}
+	return b, build, nil
+}
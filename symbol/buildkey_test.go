@@ -0,0 +1,17 @@
+package symbol
+
+import (
+	"testing"
+)
+
+func TestBuildKey(t *testing.T) {
+	store, id, err := ParseBuildKey(BuildKey("UDP@lab", "0000000012"))
+	if err != nil || store != "UDP@lab" || id != "0000000012" {
+		t.Errorf("unexpected %s %s %v", store, id, err)
+	}
+	for _, key := range []string{"UDP", "@0000000012", "UDP@12", "UDP@00000000x2"} {
+		if _, _, err = ParseBuildKey(key); err != ErrInvalidBuildKey {
+			t.Errorf("expect %s invalid, got %v", key, err)
+		}
+	}
+}
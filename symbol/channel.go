@@ -0,0 +1,249 @@
+package symbol
+
+import (
+	"context"
+	"fmt"
+	"io/ioutil"
+	"path/filepath"
+	"regexp"
+	"sort"
+	"strings"
+	"sync"
+
+	"github.com/adyzng/GoSymbols/alert"
+	log "gopkg.in/clog.v1"
+)
+
+const (
+	channelsTxt = "channels.txt" // `{ID},{channel}` per line, channels tagged explicitly
+)
+
+var (
+	ErrChannel = fmt.Errorf("invalid channel, expect lower case letters, digits and dash")
+)
+
+var channelName = regexp.MustCompile(`^[a-z0-9][a-z0-9-]*$`)
+
+// Channel is a naming rule tagging builds of a branch, eg: nightly, beta or ga, with
+// its own retention and notification policy. Rules are tried in order, the first one whose
+// patterns match the version and comment wins, rule without pattern match all builds.
+//
+type Channel struct {
+	Name    string `json:"name"`
+	Version string `json:"version,omitempty"` // regexp the build version must match
+	Comment string `json:"comment,omitempty"` // regexp the transaction comment must match
+	Keep    int    `json:"keep,omitempty"`    // newest builds kept by retention, 0 leave it to the branch policy
+	Notify  bool   `json:"notify,omitempty"`  // deliver new builds of the channel to alert sinks
+}
+
+// ChannelSummary is the builds of one channel in a branch
+//
+type ChannelSummary struct {
+	*Channel
+	Builds  int      `json:"builds"`
+	Latest  string   `json:"latest,omitempty"`  // newest version
+	Expired []string `json:"expired,omitempty"` // transaction IDs beyond `Keep`
+}
+
+var (
+	patternMx sync.Mutex
+	patterns  = make(map[string]*regexp.Regexp)
+)
+
+// matchPattern check `s` against regexp `pattern`, empty or invalid pattern match nothing
+func matchPattern(pattern, s string) bool {
+	patternMx.Lock()
+	re, ok := patterns[pattern]
+	if !ok {
+		re, _ = regexp.Compile(pattern)
+		patterns[pattern] = re
+	}
+	patternMx.Unlock()
+	return re != nil && re.MatchString(s)
+}
+
+// CheckChannels validate channel rules of an branch.
+//
+func CheckChannels(channels []*Channel) error {
+	names := make(map[string]bool, len(channels))
+	for _, ch := range channels {
+		if !channelName.MatchString(ch.Name) || names[ch.Name] || ch.Keep < 0 {
+			return ErrChannel
+		}
+		names[ch.Name] = true
+		for _, p := range []string{ch.Version, ch.Comment} {
+			if _, err := regexp.Compile(p); err != nil {
+				return fmt.Errorf("channel %s: %v", ch.Name, err)
+			}
+		}
+	}
+	return nil
+}
+
+// match check if the build fall in the channel by naming rules
+func (ch *Channel) match(build *Build) bool {
+	if ch.Version != "" && !matchPattern(ch.Version, build.Version) {
+		return false
+	}
+	if ch.Comment != "" && !matchPattern(ch.Comment, build.Comment) {
+		return false
+	}
+	return true
+}
+
+// channel return the rule of channel `name`, nil if not configured
+func (b *Branch) channel(name string) *Channel {
+	for _, ch := range b.Channels {
+		if ch.Name == name {
+			return ch
+		}
+	}
+	return nil
+}
+
+// channelMarks read channels tagged explicitly from 000Admin/channels.txt
+func (b *BrBuilder) channelMarks() map[string]string {
+	marks := make(map[string]string)
+	data, err := ioutil.ReadFile(filepath.Join(b.StorePath, adminDir, channelsTxt))
+	if err != nil {
+		return marks
+	}
+	for _, line := range strings.Fields(string(data)) {
+		if ss := strings.SplitN(line, ",", 2); len(ss) == 2 {
+			marks[ss[0]] = ss[1]
+		}
+	}
+	return marks
+}
+
+// channelOf return channel of `build`, explicit tag win over naming rules. Supplementary
+// transactions belong to the channel of their parent.
+func (b *BrBuilder) channelOf(marks map[string]string, build *Build) string {
+	id := build.ID
+	if build.SupplementOf != "" {
+		id = build.SupplementOf
+	}
+	if ch, ok := marks[id]; ok {
+		return ch
+	}
+	for _, ch := range b.Channels {
+		if ch.match(build) {
+			return ch.Name
+		}
+	}
+	return ""
+}
+
+// SetChannel tag build `buildID` with `channel` explicitly, eg: promote a beta build to ga.
+// Empty channel remove the tag, the naming rules apply again.
+//
+func (b *BrBuilder) SetChannel(buildID, channel string) (*Build, error) {
+	if err := b.writable(); err != nil {
+		return nil, err
+	}
+	if channel != "" && !channelName.MatchString(channel) {
+		return nil, ErrChannel
+	}
+	build := b.getBuild("", buildID)
+	if build == nil || build.SupplementOf != "" {
+		return nil, ErrBuildNotExist
+	}
+
+	unlock, err := lockAdmin(b.StorePath)
+	if err != nil {
+		return nil, err
+	}
+	defer unlock()
+
+	marks := b.channelMarks()
+	if channel == "" {
+		delete(marks, build.ID)
+	} else {
+		marks[build.ID] = channel
+	}
+	lines := make([]string, 0, len(marks))
+	for id, ch := range marks {
+		lines = append(lines, id+","+ch)
+	}
+	sort.Strings(lines)
+	fpath := filepath.Join(b.StorePath, adminDir, channelsTxt)
+	if err = writeFileAtomic(fpath, []byte(strings.Join(lines, "\r\n"))); err != nil {
+		log.Error(2, "[Branch] Save channels of %s failed: %v.", b.Name(), err)
+		return nil, err
+	}
+
+	b.mx.Lock()
+	for _, bd := range b.builds {
+		if bd.ID == build.ID || bd.SupplementOf == build.ID {
+			bd.Channel = b.channelOf(marks, bd)
+		}
+	}
+	b.mx.Unlock()
+	log.Info("[Branch] Tag build %s (%s) of %s with channel %q.", build.Version, build.ID, b.Name(), channel)
+	return build, nil
+}
+
+// notifyChannel tag new `build` with its channel, and deliver it to alert sinks if the
+// channel ask for it.
+func (b *BrBuilder) notifyChannel(build *Build) {
+	build.Channel = b.channelOf(b.channelMarks(), build)
+	ch := b.channel(build.Channel)
+	if ch == nil || !ch.Notify || build.SupplementOf != "" {
+		return
+	}
+	alert.Deliver(&alert.Alert{
+		Kind:    alert.KindNewBuild,
+		Branch:  b.Name(),
+		Message: fmt.Sprintf("build %s (%s) published to channel %s.", build.Version, build.ID, ch.Name),
+	})
+}
+
+// ChannelSummaries summarize builds of each channel, builds beyond `Keep` of the channel are
+// listed as expired, held builds are never expired. Builds without channel are under "".
+//
+func (b *BrBuilder) ChannelSummaries() ([]*ChannelSummary, error) {
+	byChannel := make(map[string][]*Build)
+	if _, err := b.ParseBuilds(context.Background(), func(build *Build) error {
+		if build.SupplementOf == "" {
+			byChannel[build.Channel] = append(byChannel[build.Channel], build)
+		}
+		return nil
+	}); err != nil {
+		return nil, err
+	}
+
+	held, err := b.heldIDs()
+	if err != nil {
+		return nil, err
+	}
+	channels := append([]*Channel{}, b.Channels...)
+	var others []string
+	for name := range byChannel {
+		if b.channel(name) == nil {
+			others = append(others, name)
+		}
+	}
+	sort.Strings(others)
+	for _, name := range others {
+		// tagged explicitly or not matching any rule
+		channels = append(channels, &Channel{Name: name})
+	}
+	arr := make([]*ChannelSummary, 0, len(channels))
+	for _, ch := range channels {
+		builds := byChannel[ch.Name]
+		b.SortBuilds(builds)
+		sum := &ChannelSummary{Channel: ch, Builds: len(builds)}
+		if len(builds) > 0 {
+			sum.Latest = builds[len(builds)-1].Version
+		}
+		if ch.Keep > 0 {
+			for i := 0; i < len(builds)-ch.Keep; i++ {
+				if !held[builds[i].ID] {
+					sum.Expired = append(sum.Expired, builds[i].ID)
+				}
+			}
+		}
+		arr = append(arr, sum)
+	}
+	return arr, nil
+}
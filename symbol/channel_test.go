@@ -0,0 +1,64 @@
+package symbol
+
+import (
+	"context"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+func TestChannels(t *testing.T) {
+	root, err := ioutil.TempDir("", "channel")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(root)
+
+	admin := filepath.Join(root, adminDir)
+	os.MkdirAll(admin, 0755)
+	ioutil.WriteFile(filepath.Join(admin, serverTxt), []byte(
+		"0000000001,add,file,07/04/2017,14:44:14,\"UDP\",\"100\",\"nightly\",\r\n"+
+			"0000000002,add,file,07/05/2017,14:44:14,\"UDP\",\"101\",\"nightly\",\r\n"+
+			"0000000003,add,file,07/06/2017,14:44:14,\"UDP\",\"102\",\"nightly\",\r\n"+
+			"0000000004,add,file,07/07/2017,14:44:14,\"UDP\",\"102-beta1\",\"\",\r\n"+
+			"0000000005,add,file,07/08/2017,14:44:14,\"UDP\",\"102-beta1\",\"supplement:0000000004\",\r\n"), 0644)
+
+	channels := []*Channel{
+		{Name: "nightly", Comment: "^nightly$", Keep: 2},
+		{Name: "beta", Version: `-beta\d*$`},
+	}
+	if err = CheckChannels(append(channels, &Channel{Name: "Beta"})); err != ErrChannel {
+		t.Errorf("expect invalid channel name refused, got %v", err)
+	}
+	b := NewBranch2(&Branch{StoreName: "UDP", StorePath: root, BuildPath: root, Channels: channels}).(*BrBuilder)
+	if _, err = b.ParseBuilds(context.Background(), nil); err != nil {
+		t.Fatal(err)
+	}
+	for id, expect := range map[string]string{"0000000001": "nightly", "0000000004": "beta", "0000000005": "beta"} {
+		if build := b.getBuild("", id); build == nil || build.Channel != expect {
+			t.Errorf("expect build %s in channel %s, got %+v", id, expect, build)
+		}
+	}
+
+	sums, err := b.ChannelSummaries()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(sums) != 2 || sums[0].Builds != 3 || sums[0].Latest != "102" || len(sums[0].Expired) != 1 ||
+		sums[0].Expired[0] != "0000000001" || sums[1].Builds != 1 {
+		t.Errorf("unexpected channel summaries %+v %+v", sums[0], sums[1])
+	}
+
+	// promote the beta build, its supplement follow
+	if _, err = b.SetChannel("0000000004", "ga"); err != nil {
+		t.Fatal(err)
+	}
+	if b.getBuild("", "0000000005").Channel != "ga" {
+		t.Errorf("expect supplement follow its parent channel")
+	}
+	b.Reload()
+	if build := b.getBuild("", "0000000004"); build.Channel != "ga" || build.Field("channel") != "ga" {
+		t.Errorf("expect explicit channel kept after reload, got %+v", build)
+	}
+}
@@ -0,0 +1,127 @@
+package symbol
+
+import (
+	"bufio"
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+
+	log "gopkg.in/clog.v1"
+)
+
+const (
+	checksumTxt = "checksums.txt" // sha256 of stored files recorded at ingest, `{rel path},{sha256}`
+)
+
+// loadChecksums read 000Admin/checksums.txt once, caller hold `sumMx`
+func (b *BrBuilder) loadChecksums() {
+	if b.sums != nil {
+		return
+	}
+	b.sums = make(map[string]string)
+	fd, err := os.Open(filepath.Join(b.StorePath, adminDir, checksumTxt))
+	if err != nil {
+		return
+	}
+	defer fd.Close()
+	scan := bufio.NewScanner(fd)
+	for scan.Scan() {
+		ss := strings.Split(scan.Text(), ",")
+		if len(ss) == 2 {
+			b.sums[strings.ToLower(ss[0])] = ss[1]
+		}
+	}
+}
+
+// saveChecksums append new records to 000Admin/checksums.txt, caller hold `sumMx`
+func (b *BrBuilder) saveChecksums(records map[string]string) error {
+	fpath := filepath.Join(b.StorePath, adminDir, checksumTxt)
+	fd, err := os.OpenFile(fpath, os.O_WRONLY|os.O_CREATE|os.O_APPEND, 0644)
+	if err != nil {
+		return err
+	}
+	defer fd.Close()
+	w := bufio.NewWriter(fd)
+	for rel, sum := range records {
+		fmt.Fprintf(w, "%s,%s\r\n", rel, sum)
+	}
+	return w.Flush()
+}
+
+// relPath return slash separated path relative to store, empty if out of store
+func (b *BrBuilder) relPath(fpath string) string {
+	rel, err := filepath.Rel(b.StorePath, fpath)
+	if err != nil || strings.HasPrefix(rel, "..") {
+		return ""
+	}
+	return strings.ToLower(filepath.ToSlash(rel))
+}
+
+// Checksum return the sha256 of given stored file. It's recorded when the file is ingested,
+// files ingested before are hashed on first request and recorded.
+//
+func (b *BrBuilder) Checksum(fpath string) (string, error) {
+	rel := b.relPath(fpath)
+	if rel == "" {
+		return "", os.ErrNotExist
+	}
+
+	b.sumMx.Lock()
+	b.loadChecksums()
+	sum, ok := b.sums[rel]
+	b.sumMx.Unlock()
+	if ok {
+		return sum, nil
+	}
+
+	sum, err := fileSHA256(fpath)
+	if err != nil {
+		return "", err
+	}
+	b.sumMx.Lock()
+	defer b.sumMx.Unlock()
+	if _, ok := b.sums[rel]; !ok {
+		b.sums[rel] = sum
+		if err := b.saveChecksums(map[string]string{rel: sum}); err != nil {
+			log.Warn("[Branch] Save checksum of %s failed: %v.", rel, err)
+		}
+	}
+	return sum, nil
+}
+
+// recordChecksums hash all files added by transaction `id`, the later files win
+// since symstore overwrite the same key. Files are linked to the blob store if enabled.
+//
+func (b *BrBuilder) recordChecksums(id string) error {
+	keys, err := b.transactionKeys(id)
+	if err != nil {
+		return err
+	}
+
+	records := make(map[string]string, len(keys))
+	files := make(map[string]string, len(keys))
+	for _, key := range keys {
+		ss := strings.Split(key, "\\")
+		fpath := b.GetSymbolPath(ss[1], ss[0])
+		sum, err := fileSHA256(fpath)
+		if err != nil {
+			// compressed or file.ptr, hashed on request
+			continue
+		}
+		records[b.relPath(fpath)] = sum
+		files[fpath] = sum
+	}
+	if linked, saved := b.dedupFiles(files); linked > 0 {
+		log.Info("[Branch] Transaction %s link %d files to exist blobs, %d bytes saved.", id, linked, saved)
+	}
+
+	b.sumMx.Lock()
+	defer b.sumMx.Unlock()
+	b.loadChecksums()
+	for rel, sum := range records {
+		b.sums[rel] = sum
+	}
+	log.Trace("[Branch] Record %d checksums of transaction %s.", len(records), id)
+	return b.saveChecksums(records)
+}
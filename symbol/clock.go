@@ -0,0 +1,37 @@
+package symbol
+
+import (
+	"time"
+)
+
+const (
+	TimeFormat    = "2006-01-02 15:04:05" // Build.Date, UpdateDate and other timestamps of metadata
+	commentFormat = "2006-01-02_15:04:05" // transaction comment, symstore.exe split /c by space
+)
+
+// Clocker is the time source of branches and the scheduler.
+//
+type Clocker interface {
+	Now() time.Time
+}
+
+// Clock is used for timestamps written to metadata, schedules and expiry. Tests replace it
+// with symtest.Clock to get reproducible timestamps.
+//
+var Clock Clocker = systemClock{}
+
+type systemClock struct{}
+
+func (systemClock) Now() time.Time {
+	return time.Now()
+}
+
+// now return current time of Clock
+func now() time.Time {
+	return Clock.Now()
+}
+
+// timestamp format `t` in TimeFormat
+func timestamp(t time.Time) string {
+	return t.Format(TimeFormat)
+}
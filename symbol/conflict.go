@@ -0,0 +1,141 @@
+package symbol
+
+import (
+	"bytes"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"strings"
+
+	"github.com/adyzng/GoSymbols/alert"
+	"github.com/adyzng/GoSymbols/config"
+	"github.com/adyzng/GoSymbols/pdb"
+	log "gopkg.in/clog.v1"
+)
+
+// Policy for key conflict, when same {name, hash} exist in store with different content
+const (
+	ConflictReject    = "reject"    // fail the ingest
+	ConflictOverwrite = "overwrite" // replace the stored file
+	ConflictKeepBoth  = "keep-both" // keep stored file, store new one under the name keptName
+)
+
+var (
+	ErrSymbolConflict = fmt.Errorf("symbol key conflict with different content")
+)
+
+// conflictPolicy return branch policy or global default
+func (b *BrBuilder) conflictPolicy() string {
+	if b.ConflictPolicy != "" {
+		return strings.ToLower(b.ConflictPolicy)
+	}
+	return config.ConflictPolicy
+}
+
+// sameContent compare plain content of stored file `fa` with file `fb` byte by byte
+func (b *BrBuilder) sameContent(fa, fb string) (bool, error) {
+	ra, sa, err := b.OpenSymbol(fa)
+	if err != nil {
+		return false, err
+	}
+	defer ra.Close()
+	rb, err := os.Open(fb)
+	if err != nil {
+		return false, err
+	}
+	defer rb.Close()
+	sb, err := rb.Stat()
+	if err != nil {
+		return false, err
+	}
+	if sa != sb.Size() {
+		return false, nil
+	}
+
+	bufA, bufB := make([]byte, 64<<10), make([]byte, 64<<10)
+	for {
+		na, errA := io.ReadFull(ra, bufA)
+		nb, errB := io.ReadFull(rb, bufB)
+		if na != nb || !bytes.Equal(bufA[:na], bufB[:nb]) {
+			return false, nil
+		}
+		if errA == io.EOF || errA == io.ErrUnexpectedEOF {
+			return errB == io.EOF || errB == io.ErrUnexpectedEOF, nil
+		}
+		if errA != nil {
+			return false, errA
+		}
+		if errB != nil {
+			return false, errB
+		}
+	}
+}
+
+// checkConflicts compare every symbol file under `symPath` with the one already stored
+// by the same key, and apply the conflict policy on mismatch.
+//
+func (b *BrBuilder) checkConflicts(version, symPath string) error {
+	policy := b.conflictPolicy()
+	conflicts := 0
+	var held map[string]bool // keys of builds under legal hold, never overwritten
+
+	err := filepath.Walk(symPath, func(fpath string, info os.FileInfo, err error) error {
+		if err != nil || info.IsDir() || !pdb.IsSymbolFile(info.Name()) {
+			return nil
+		}
+		hash, err := pdb.Key(fpath)
+		if err != nil {
+			log.Trace("[Branch] Skip conflict check of %s: %v.", fpath, err)
+			return nil
+		}
+		stored := b.GetSymbolPath(hash, info.Name())
+		if _, err := os.Stat(stored); err != nil {
+			return nil
+		}
+		if same, err := b.sameContent(stored, fpath); err != nil || same {
+			return nil
+		}
+
+		conflicts++
+		apply := policy
+		if apply == ConflictOverwrite {
+			if held == nil {
+				// nil if holds can't be read, every file is kept then
+				held, _ = b.heldKeys()
+			}
+			if held == nil || held[strings.ToLower(info.Name()+"\\"+hash)] {
+				log.Warn("[Branch] Stored %s may be under legal hold, keep both.", stored)
+				apply = ConflictKeepBoth
+			}
+		}
+		alert.Raise(alert.KindSymbolConflict, b.Name(),
+			"build %s publish %s\\%s with content differ from stored file, policy %s.",
+			version, info.Name(), hash, apply)
+
+		switch apply {
+		case ConflictReject:
+			return ErrSymbolConflict
+		case ConflictKeepBoth:
+			// renamed in place, so the new file is in the transaction under its own key
+			dst := filepath.Join(filepath.Dir(fpath), keptName(info.Name(), version))
+			log.Warn("[Branch] Keep stored %s, store new one as %s\\%s.", stored, filepath.Base(dst), hash)
+			return os.Rename(fpath, dst)
+		default:
+			log.Warn("[Branch] Overwrite stored %s.", stored)
+		}
+		return nil
+	})
+
+	if conflicts > 0 {
+		log.Warn("[Branch] Build %s has %d conflict symbols.", version, conflicts)
+	}
+	return err
+}
+
+// keptName return the name the new file of a conflict is stored under with keep-both
+// policy, eg: foo.pdb of build 100 => foo_100.pdb
+func keptName(name, version string) string {
+	ext := filepath.Ext(name)
+	return strings.TrimSuffix(name, ext) + "_" + version + ext
+}
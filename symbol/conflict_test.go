@@ -0,0 +1,60 @@
+package symbol
+
+import (
+	"encoding/binary"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+func fakePE(tail byte) []byte {
+	file := make([]byte, 512)
+	copy(file, "MZ")
+	binary.LittleEndian.PutUint32(file[0x3C:], 0x80)
+	copy(file[0x80:], "PE\x00\x00")
+	binary.LittleEndian.PutUint32(file[0x80+8:], 0x59C0C5B3)
+	binary.LittleEndian.PutUint32(file[0x80+24+56:], 0xa3000)
+	binary.LittleEndian.PutUint16(file[0x80+24:], 0x10b) // PE32
+	binary.LittleEndian.PutUint32(file[0x80+24+92:], 16) // data directories, no certificate
+	file[511] = tail
+	return file
+}
+
+func TestCheckConflicts(t *testing.T) {
+	root, err := ioutil.TempDir("", "conflict")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(root)
+
+	stored := filepath.Join(root, "foo.dll", "59C0C5B3a3000", "foo.dll")
+	os.MkdirAll(filepath.Dir(stored), 0755)
+	ioutil.WriteFile(stored, fakePE(1), 0644)
+
+	symPath := filepath.Join(root, unzipDir)
+	os.MkdirAll(filepath.Join(symPath, "x64"), 0755)
+	ioutil.WriteFile(filepath.Join(symPath, "x64", "foo.dll"), fakePE(1), 0644)
+
+	b := NewBranch2(&Branch{StoreName: "test", StorePath: root, BuildPath: root}).(*BrBuilder)
+	b.ConflictPolicy = ConflictReject
+	if err := b.checkConflicts("100", symPath); err != nil {
+		t.Fatalf("same content should not conflict: %v", err)
+	}
+
+	ioutil.WriteFile(filepath.Join(symPath, "x64", "foo.dll"), fakePE(2), 0644)
+	if err := b.checkConflicts("100", symPath); err != ErrSymbolConflict {
+		t.Fatalf("expect conflict, got %v", err)
+	}
+
+	b.ConflictPolicy = ConflictKeepBoth
+	if err := b.checkConflicts("100", symPath); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := os.Stat(filepath.Join(symPath, "x64", "foo_100.dll")); err != nil {
+		t.Fatalf("expect new file stored under its own name: %v", err)
+	}
+	if _, err := os.Stat(filepath.Join(symPath, "x64", "foo.dll")); !os.IsNotExist(err) {
+		t.Fatalf("expect conflicting name left out of the transaction: %v", err)
+	}
+}
@@ -0,0 +1,56 @@
+package symbol
+
+import (
+	"context"
+	"fmt"
+	"io"
+	"time"
+)
+
+// ctxReader fail reads once its context is done
+type ctxReader struct {
+	ctx context.Context
+	r   io.Reader
+}
+
+func (c *ctxReader) Read(p []byte) (int, error) {
+	if err := c.ctx.Err(); err != nil {
+		return 0, err
+	}
+	return c.r.Read(p)
+}
+
+// copyContext copy `src` to `dst` until `ctx` is done. `src` is closed on cancellation, so
+// a read blocked on a hung network share return at once instead of blocking forever.
+func copyContext(ctx context.Context, dst io.Writer, src io.ReadCloser) (int64, error) {
+	done := make(chan struct{})
+	defer close(done)
+	go func() {
+		select {
+		case <-ctx.Done():
+			src.Close()
+		case <-done:
+		}
+	}()
+	n, err := io.Copy(dst, &ctxReader{ctx: ctx, r: src})
+	if ctx.Err() != nil {
+		err = ctx.Err()
+	}
+	return n, err
+}
+
+// stageContext bound `ctx` by the timeout of an ingest stage in seconds, 0 for none
+func stageContext(ctx context.Context, seconds int) (context.Context, context.CancelFunc) {
+	if seconds <= 0 {
+		return context.WithCancel(ctx)
+	}
+	return context.WithTimeout(ctx, time.Duration(seconds)*time.Second)
+}
+
+// stageError tell `err` of ingest `stage` was caused by its timeout
+func stageError(ctx context.Context, stage string, err error) error {
+	if err != nil && ctx.Err() == context.DeadlineExceeded {
+		return fmt.Errorf("%s timed out: %v", stage, err)
+	}
+	return err
+}
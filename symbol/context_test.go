@@ -0,0 +1,52 @@
+package symbol
+
+import (
+	"bytes"
+	"context"
+	"io"
+	"io/ioutil"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestCopyContext(t *testing.T) {
+	var buf bytes.Buffer
+	n, err := copyContext(context.Background(), &buf, ioutil.NopCloser(strings.NewReader("symbols")))
+	if err != nil || n != 7 || buf.String() != "symbols" {
+		t.Errorf("copy got %d %q (%v)", n, buf.String(), err)
+	}
+
+	// a read blocked forever, like a copy from a hung share
+	r, w := io.Pipe()
+	defer w.Close()
+	ctx, cancel := stageContext(context.Background(), 0)
+	done := make(chan error, 1)
+	go func() {
+		_, err := copyContext(ctx, &buf, r)
+		done <- err
+	}()
+	cancel()
+	select {
+	case err = <-done:
+		if err != context.Canceled {
+			t.Errorf("expect canceled, got %v", err)
+		}
+	case <-time.After(5 * time.Second):
+		t.Fatal("copy not aborted by cancel")
+	}
+}
+
+func TestStageTimeout(t *testing.T) {
+	r, w := io.Pipe()
+	defer w.Close()
+	ctx, cancel := context.WithTimeout(context.Background(), 50*time.Millisecond)
+	defer cancel()
+	_, err := copyContext(ctx, ioutil.Discard, r)
+	if err = stageError(ctx, "copy", err); err == nil || !strings.Contains(err.Error(), "copy timed out") {
+		t.Errorf("expect copy timed out, got %v", err)
+	}
+	if err = stageError(context.Background(), "copy", io.ErrUnexpectedEOF); err != io.ErrUnexpectedEOF {
+		t.Errorf("errors without timeout should be kept, got %v", err)
+	}
+}
@@ -0,0 +1,283 @@
+package symbol
+
+import (
+	"bufio"
+	"context"
+	"fmt"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+	"sync"
+
+	"github.com/adyzng/GoSymbols/audit"
+	"github.com/adyzng/GoSymbols/config"
+	log "gopkg.in/clog.v1"
+)
+
+const (
+	blobRefs = ".refs" // stored files linked to blob `{sha256}`, one path per line in `{sha256}.refs`
+)
+
+var (
+	ErrDedupDisabled = fmt.Errorf("dedup is disabled, set [ingest] DEDUP_DIR")
+)
+
+// blobMx serialize changes of blob references of all branches
+var blobMx sync.Mutex
+
+// DedupStats is the usage of the blob store shared by all branches
+//
+type DedupStats struct {
+	Blobs int   `json:"blobs"`
+	Refs  int   `json:"refs"`  // stored files linked to the blobs
+	Bytes int64 `json:"bytes"` // size of the blobs, each stored once
+	Saved int64 `json:"saved"` // bytes the stored files would take without links
+}
+
+// DedupReport is the result of linking files of a branch ingested before to the blob store
+//
+type DedupReport struct {
+	Branch string `json:"branch"`
+	Files  int    `json:"files"`
+	Linked int    `json:"linked"` // files replaced by a link to an exist blob
+	Saved  int64  `json:"saved"`
+}
+
+// blobPath return the blob of content `sum` in `[ingest] DEDUP_DIR`
+func blobPath(sum string) string {
+	return filepath.Join(config.DedupDir, sum[:2], sum)
+}
+
+// readRefs read paths linked to blob `sum`
+func readRefs(sum string) []string {
+	fd, err := os.Open(blobPath(sum) + blobRefs)
+	if err != nil {
+		return nil
+	}
+	defer fd.Close()
+	var refs []string
+	scan := bufio.NewScanner(fd)
+	for scan.Scan() {
+		if line := strings.TrimSpace(scan.Text()); line != "" {
+			refs = append(refs, line)
+		}
+	}
+	return refs
+}
+
+// writeRefs save paths linked to blob `sum`, the blob is removed with its last reference
+func writeRefs(sum string, refs []string) error {
+	if len(refs) == 0 {
+		os.Remove(blobPath(sum))
+		return os.Remove(blobPath(sum) + blobRefs)
+	}
+	sort.Strings(refs)
+	return writeFileAtomic(blobPath(sum)+blobRefs, []byte(strings.Join(refs, "\r\n")+"\r\n"))
+}
+
+// linkBlob store `fpath` of content `sum` once: it becomes the blob if there's none, or
+// is replaced by a hard link to the exist blob. Return bytes saved. Links across volumes
+// fail, the file is kept as is.
+func linkBlob(fpath, sum string) (int64, error) {
+	fi, err := os.Stat(fpath)
+	if err != nil {
+		return 0, err
+	}
+	blob := blobPath(sum)
+	blobMx.Lock()
+	defer blobMx.Unlock()
+
+	saved := int64(0)
+	bi, err := os.Stat(blob)
+	switch {
+	case os.IsNotExist(err):
+		if err = os.MkdirAll(filepath.Dir(blob), 0755); err != nil {
+			return 0, err
+		}
+		if err = os.Link(fpath, blob); err != nil {
+			return 0, err
+		}
+	case err != nil:
+		return 0, err
+	case !os.SameFile(fi, bi):
+		tmp := fpath + ".link"
+		if err = os.Link(blob, tmp); err != nil {
+			return 0, err
+		}
+		if err = os.Rename(tmp, fpath); err != nil {
+			os.Remove(tmp)
+			return 0, err
+		}
+		saved = fi.Size()
+	}
+
+	refs := readRefs(sum)
+	for _, ref := range refs {
+		if ref == fpath {
+			return saved, nil
+		}
+	}
+	return saved, writeRefs(sum, append(refs, fpath))
+}
+
+// releaseBlob drop reference of `fpath` to blob `sum` before the file is removed
+func releaseBlob(fpath, sum string) error {
+	blobMx.Lock()
+	defer blobMx.Unlock()
+	refs := readRefs(sum)
+	kept := refs[:0]
+	for _, ref := range refs {
+		if ref != fpath {
+			kept = append(kept, ref)
+		}
+	}
+	if len(kept) == len(refs) {
+		return nil
+	}
+	return writeRefs(sum, kept)
+}
+
+// dedupFiles link stored files of content `sums` to the blob store, fpath => sha256
+func (b *BrBuilder) dedupFiles(sums map[string]string) (int, int64) {
+	if config.DedupDir == "" || b.Backend != "" {
+		return 0, 0
+	}
+	linked, saved := 0, int64(0)
+	for fpath, sum := range sums {
+		n, err := linkBlob(fpath, sum)
+		if err != nil {
+			log.Warn("[Branch] Link %s to blob store failed: %v.", fpath, err)
+			continue
+		}
+		if n > 0 {
+			linked++
+			saved += n
+		}
+	}
+	return linked, saved
+}
+
+// releaseFile drop the blob reference of stored `fpath` about to be removed, caller hold
+// `sumMx`
+func (b *BrBuilder) releaseFile(fpath string) {
+	if config.DedupDir == "" {
+		return
+	}
+	b.loadChecksums()
+	sum, ok := b.sums[b.relPath(fpath)]
+	if !ok {
+		var err error
+		if sum, err = fileSHA256(fpath); err != nil {
+			return
+		}
+	}
+	if err := releaseBlob(fpath, sum); err != nil {
+		log.Warn("[Branch] Release blob of %s failed: %v.", fpath, err)
+	}
+}
+
+// releaseDir drop blob references of all files under symbol folder `dir`, caller hold `sumMx`
+func (b *BrBuilder) releaseDir(dir string) {
+	if config.DedupDir == "" {
+		return
+	}
+	filepath.Walk(dir, func(fpath string, fi os.FileInfo, err error) error {
+		if err == nil && !fi.IsDir() {
+			b.releaseFile(fpath)
+		}
+		return nil
+	})
+}
+
+// Dedup link files of all builds ingested before to the blob store, so identical files
+// of this and other branches are stored once.
+//
+func (b *BrBuilder) Dedup() (*DedupReport, error) {
+	report := &DedupReport{Branch: b.Name()}
+	if config.DedupDir == "" || b.Backend != "" {
+		return report, nil
+	}
+	if err := b.writable(); err != nil {
+		return nil, err
+	}
+	b.ingMx.Lock()
+	defer b.ingMx.Unlock()
+	if _, err := b.ParseBuilds(context.Background(), nil); err != nil {
+		return nil, err
+	}
+
+	b.mx.RLock()
+	ids := make([]string, 0, len(b.builds))
+	for id := range b.builds {
+		ids = append(ids, id)
+	}
+	b.mx.RUnlock()
+	sort.Strings(ids)
+
+	sums := make(map[string]string)
+	for _, id := range ids {
+		keys, err := b.transactionKeys(id)
+		if err != nil {
+			return nil, err
+		}
+		for _, key := range keys {
+			ss := strings.Split(key, "\\")
+			fpath := b.GetSymbolPath(ss[1], ss[0])
+			if _, ok := sums[fpath]; ok {
+				continue
+			}
+			if sum, err := b.Checksum(fpath); err == nil {
+				sums[fpath] = sum
+			}
+		}
+	}
+	report.Files = len(sums)
+	report.Linked, report.Saved = b.dedupFiles(sums)
+	log.Info("[Branch] Dedup %d files of %s, %d linked to exist blobs, %d bytes saved.",
+		report.Files, b.Name(), report.Linked, report.Saved)
+	return report, nil
+}
+
+// Dedup link stored files of given branch to the blob store, by `user`.
+//
+func (ss *sserver) Dedup(storeName, user string) (*DedupReport, error) {
+	if config.DedupDir == "" {
+		return nil, ErrDedupDisabled
+	}
+	b, ok := ss.Get(storeName).(*BrBuilder)
+	if !ok {
+		return nil, ErrBranchNotInit
+	}
+	report, err := b.Dedup()
+	if err != nil {
+		return nil, err
+	}
+	audit.Record(user, "dedup", b.Name(), "%d files, %d linked to exist blobs, %d bytes saved", report.Files, report.Linked, report.Saved)
+	return report, nil
+}
+
+// DedupStats return usage of the blob store, nil if `[ingest] DEDUP_DIR` is not set.
+//
+func (ss *sserver) DedupStats() (*DedupStats, error) {
+	if config.DedupDir == "" {
+		return nil, nil
+	}
+	stats := &DedupStats{}
+	blobMx.Lock()
+	defer blobMx.Unlock()
+	err := filepath.Walk(config.DedupDir, func(fpath string, fi os.FileInfo, err error) error {
+		if err != nil || fi.IsDir() || filepath.Ext(fpath) == blobRefs {
+			return err
+		}
+		refs := len(readRefs(filepath.Base(fpath)))
+		stats.Blobs++
+		stats.Refs += refs
+		stats.Bytes += fi.Size()
+		if refs > 1 {
+			stats.Saved += fi.Size() * int64(refs-1)
+		}
+		return nil
+	})
+	return stats, err
+}
@@ -0,0 +1,48 @@
+package symbol
+
+import (
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/adyzng/GoSymbols/config"
+)
+
+func TestLinkBlob(t *testing.T) {
+	root, err := ioutil.TempDir("", "dedup")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(root)
+	defer func(dir string) { config.DedupDir = dir }(config.DedupDir)
+	config.DedupDir = filepath.Join(root, "blobs")
+
+	sum := "9f86d081884c7d659a2feaa0c55ad015a3bf4f1b2b0b822cd15d6c15b0f00a08"
+	a, b := filepath.Join(root, "a.pdb"), filepath.Join(root, "b.pdb")
+	ioutil.WriteFile(a, []byte("test"), 0644)
+	ioutil.WriteFile(b, []byte("test"), 0644)
+	if saved, err := linkBlob(a, sum); err != nil || saved != 0 {
+		t.Fatalf("expect a.pdb become the blob, got %d (%v)", saved, err)
+	}
+	if saved, err := linkBlob(b, sum); err != nil || saved != 4 {
+		t.Fatalf("expect b.pdb linked to the blob, got %d (%v)", saved, err)
+	}
+	linkBlob(b, sum)
+	if refs := readRefs(sum); len(refs) != 2 {
+		t.Fatalf("expect 2 references, got %v", refs)
+	}
+
+	ss := &sserver{}
+	if stats, _ := ss.DedupStats(); stats == nil || stats.Blobs != 1 || stats.Refs != 2 || stats.Saved != 4 {
+		t.Errorf("unexpected stats %+v", stats)
+	}
+	releaseBlob(a, sum)
+	if _, err = os.Stat(blobPath(sum)); err != nil {
+		t.Errorf("expect blob kept for b.pdb: %v", err)
+	}
+	releaseBlob(b, sum)
+	if _, err = os.Stat(blobPath(sum)); !os.IsNotExist(err) {
+		t.Errorf("expect blob removed with the last reference: %v", err)
+	}
+}
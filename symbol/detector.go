@@ -0,0 +1,171 @@
+package symbol
+
+import (
+	"bufio"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"net/url"
+	"os"
+	"path/filepath"
+	"strings"
+	"time"
+
+	"github.com/adyzng/GoSymbols/config"
+)
+
+// Detectors of Branch.Detector, an http(s) url select the json endpoint
+const (
+	DetectMarker  = "marker"  // first line of latestbuild.txt, or `marker:{file}` relative to build path
+	DetectMTime   = "mtime"   // newest `Build*` folder with debug zip by modify time
+	DetectVersion = "version" // newest `Build*` folder with debug zip by version order
+)
+
+var (
+	ErrDetector = fmt.Errorf("invalid detector, expect marker[:{file}], mtime, version or http(s) url")
+)
+
+var detectClient = &http.Client{
+	Timeout: time.Second * 15,
+}
+
+// Detector find the latest build on build server of a branch, for build systems which
+// don't write latestbuild.txt.
+//
+type Detector interface {
+	Latest(b *BrBuilder) (string, error)
+}
+
+type markerDetector struct {
+	file string
+}
+
+type mtimeDetector struct{}
+
+type versionDetector struct{}
+
+// httpDetector get json from url, the version is the string at dotted `field`
+type httpDetector struct {
+	url   string
+	field string
+}
+
+// ParseDetector parse detector spec of a branch, empty for the marker file.
+//
+func ParseDetector(spec string) (Detector, error) {
+	spec = strings.TrimSpace(spec)
+	switch {
+	case spec == "" || spec == DetectMarker:
+		return &markerDetector{file: config.LatestBuildFile}, nil
+	case strings.HasPrefix(spec, DetectMarker+":"):
+		file := strings.TrimPrefix(spec, DetectMarker+":")
+		if file == "" || filepath.IsAbs(file) || strings.HasPrefix(filepath.Clean(file), "..") {
+			return nil, ErrDetector
+		}
+		return &markerDetector{file: file}, nil
+	case spec == DetectMTime:
+		return mtimeDetector{}, nil
+	case spec == DetectVersion:
+		return versionDetector{}, nil
+	}
+
+	u, err := url.Parse(spec)
+	if err != nil || (u.Scheme != "http" && u.Scheme != "https") || u.Host == "" {
+		return nil, ErrDetector
+	}
+	field := u.Fragment
+	if field == "" {
+		field = "version"
+	}
+	u.Fragment = ""
+	return &httpDetector{url: u.String(), field: field}, nil
+}
+
+// CheckDetector validate detector spec of an branch.
+//
+func CheckDetector(spec string) error {
+	_, err := ParseDetector(spec)
+	return err
+}
+
+// detector return the detector of branch, invalid spec fall back to the marker file
+func (b *BrBuilder) detector() Detector {
+	d, err := ParseDetector(b.Detector)
+	if err != nil {
+		d, _ = ParseDetector("")
+	}
+	return d
+}
+
+// Latest read first line of the marker file
+func (d *markerDetector) Latest(b *BrBuilder) (string, error) {
+	fd, err := os.Open(filepath.Join(b.BuildPath, d.file))
+	if err != nil {
+		return "", err
+	}
+	defer fd.Close()
+	str, _ := bufio.NewReader(fd).ReadString('\n')
+	return strings.Trim(str, " \r\n"), nil
+}
+
+// Latest return the folder modified last
+func (mtimeDetector) Latest(b *BrBuilder) (string, error) {
+	builds, err := b.ListServerBuilds()
+	if err != nil {
+		return "", err
+	}
+	if len(builds) == 0 {
+		return "", ErrBuildNotExist
+	}
+	return builds[len(builds)-1].Version, nil
+}
+
+// Latest return the folder with greatest version by Branch.CompareVersion
+func (versionDetector) Latest(b *BrBuilder) (string, error) {
+	builds, err := b.ListServerBuilds()
+	if err != nil {
+		return "", err
+	}
+	latest := ""
+	for _, sb := range builds {
+		if latest == "" || b.CompareVersion(sb.Version, latest) > 0 {
+			latest = sb.Version
+		}
+	}
+	if latest == "" {
+		return "", ErrBuildNotExist
+	}
+	return latest, nil
+}
+
+// Latest get the endpoint, eg: `{"version": "4175.2-538"}` or `{"build": {"number": "538"}}`
+// with field `build.number`
+func (d *httpDetector) Latest(b *BrBuilder) (string, error) {
+	resp, err := detectClient.Get(d.url)
+	if err != nil {
+		return "", err
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode != http.StatusOK {
+		return "", fmt.Errorf("latest build endpoint response %s", resp.Status)
+	}
+
+	var v interface{}
+	if err = json.NewDecoder(resp.Body).Decode(&v); err != nil {
+		return "", err
+	}
+	for _, key := range strings.Split(d.field, ".") {
+		obj, ok := v.(map[string]interface{})
+		if !ok {
+			return "", fmt.Errorf("no field %s in latest build response", d.field)
+		}
+		v = obj[key]
+	}
+	switch val := v.(type) {
+	case string:
+		return strings.TrimSpace(val), nil
+	case float64:
+		return fmt.Sprintf("%v", val), nil
+	}
+	return "", fmt.Errorf("no field %s in latest build response", d.field)
+}
@@ -0,0 +1,77 @@
+package symbol
+
+import (
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/adyzng/GoSymbols/config"
+)
+
+func TestDetector(t *testing.T) {
+	root, err := ioutil.TempDir("", "detector")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(root)
+
+	config.PDBZipFile = "debug.zip"
+	config.LatestBuildFile = "latestbuild.txt"
+	now := time.Now()
+	for i, ver := range []string{"4175.2-540", "4175.2-99", "4175.2-538"} {
+		dir := filepath.Join(root, "Build"+ver)
+		os.MkdirAll(dir, 0755)
+		ioutil.WriteFile(filepath.Join(dir, config.PDBZipFile), []byte("zip"), 0644)
+		os.Chtimes(dir, now, now.Add(time.Duration(i-3)*time.Hour))
+	}
+	os.MkdirAll(filepath.Join(root, "Build4175.2-541"), 0755) // no debug zip
+	ioutil.WriteFile(filepath.Join(root, "latest.txt"), []byte("4175.2-539\r\n"), 0644)
+
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Write([]byte(`{"build": {"number": 542, "name": "4175.2-542"}}`))
+	}))
+	defer srv.Close()
+
+	b := NewBranch2(&Branch{
+		StoreName: "test",
+		BuildPath: root,
+		StorePath: filepath.Join(root, "store"),
+	}).(*BrBuilder)
+
+	for spec, expect := range map[string]string{
+		"marker:latest.txt":             "4175.2-539",
+		"mtime":                         "4175.2-538",
+		"version":                       "4175.2-540",
+		srv.URL + "#build.name":         "4175.2-542",
+		srv.URL + "/job?x=1#build.name": "4175.2-542",
+		srv.URL + "#build.number":       "542",
+	} {
+		b.Detector = spec
+		if latest, err := b.getLatestBuild(false); err != nil || latest != expect {
+			t.Errorf("detector %s: expect %s, got %s (%v)", spec, expect, latest, err)
+		}
+	}
+
+	b.Detector = srv.URL
+	if _, err := b.getLatestBuild(false); err == nil {
+		t.Errorf("expect no version field in response")
+	}
+	b.Detector = ""
+	if b.CanUpdate() {
+		t.Errorf("expect no latestbuild.txt to update from")
+	}
+	b.Detector = "mtime"
+	if !b.CanUpdate() {
+		t.Errorf("expect build path to update from")
+	}
+
+	for _, spec := range []string{"newest", "marker:", "marker:../latest.txt", "ftp://ci/latest"} {
+		if err := CheckDetector(spec); err != ErrDetector {
+			t.Errorf("expect invalid detector %s, got %v", spec, err)
+		}
+	}
+}
@@ -0,0 +1,162 @@
+package symbol
+
+import (
+	"io"
+	"os"
+	"path/filepath"
+	"strings"
+
+	"github.com/adyzng/GoSymbols/alert"
+	"github.com/adyzng/GoSymbols/encrypt"
+	"github.com/adyzng/GoSymbols/pdb"
+	"github.com/adyzng/GoSymbols/storage"
+	log "gopkg.in/clog.v1"
+)
+
+// SymbolReader is the plain content of a stored symbol file
+//
+type SymbolReader interface {
+	io.ReadSeeker
+	io.Closer
+}
+
+// sealedStore return store `s` sealing the symbol files put to it by the branch key, `s`
+// itself if the branch isn't encrypted.
+func (b *BrBuilder) sealedStore(s storage.Store) (storage.Store, error) {
+	if !b.Encrypted {
+		return s, nil
+	}
+	key, err := encrypt.Keys.Key(b.Name())
+	if err != nil {
+		return nil, err
+	}
+	return storage.Encrypted(s, key), nil
+}
+
+// sealFile put plain file `fpath` of the store back through the sealed `store`. It's moved
+// aside first, the store replace it by rename which fails on an open file on Windows.
+func (b *BrBuilder) sealFile(store storage.Store, fpath string) error {
+	if encrypt.IsEncrypted(fpath) {
+		return nil
+	}
+	st, err := os.Stat(fpath)
+	if err != nil {
+		return err
+	}
+	rel, err := filepath.Rel(b.StorePath, fpath)
+	if err != nil {
+		return err
+	}
+	plain := fpath + ".plain"
+	if err = os.Rename(fpath, plain); err != nil {
+		return err
+	}
+	fd, err := os.Open(plain)
+	if err == nil {
+		err = store.Put(filepath.ToSlash(rel), fd, st.Size())
+		fd.Close()
+	}
+	if err != nil {
+		os.Rename(plain, fpath)
+		return err
+	}
+	os.Chtimes(fpath, st.ModTime(), st.ModTime())
+	return os.Remove(plain)
+}
+
+// encryptTransaction seal the symbol files referenced by transaction `id` in place through
+// the storage backend, with the binaries and Breakpad symbols stored with it, if the branch
+// is encrypted. Files shared with earlier transactions are already sealed and kept.
+func (b *BrBuilder) encryptTransaction(id string) error {
+	if !b.Encrypted {
+		return nil
+	}
+	store, err := b.sealedStore(b.cache())
+	if err != nil {
+		return err
+	}
+	lines, err := b.transactionLines(id)
+	if err != nil {
+		return err
+	}
+	var files []string
+	for _, line := range lines {
+		ss := strings.Split(strings.Trim(strings.Split(line, ",")[0], "\""), "\\")
+		if len(ss) != 2 {
+			continue
+		}
+		fpath := b.GetSymbolPath(ss[1], ss[0])
+		if _, err := os.Stat(fpath); err != nil {
+			// stored compressed, eg: foo.pd_ of foo.pdb
+			if cpath := b.GetSymbolPath(ss[1], pdb.CompressedName(ss[0])); cpath != fpath {
+				if _, cerr := os.Stat(cpath); cerr == nil {
+					fpath = cpath
+				}
+			}
+		}
+		files = append(files, fpath)
+	}
+	bins, err := b.Binaries()
+	if err != nil {
+		return err
+	}
+	for _, bin := range bins {
+		if bin.ID == id {
+			files = append(files, b.GetSymbolPath(bin.Key, bin.Name))
+		}
+	}
+	syms, err := b.BreakpadSyms()
+	if err != nil {
+		return err
+	}
+	for _, sym := range syms {
+		if sym.ID == id {
+			files = append(files, b.breakpadPath(sym.File, sym.DebugID))
+		}
+	}
+
+	for _, fpath := range files {
+		if err = b.sealFile(store, fpath); err != nil {
+			return err
+		}
+	}
+	log.Info("[Branch] Encrypt %d files of transaction %s.", len(files), id)
+	return nil
+}
+
+// encryptOrAlert seal transaction `id`. It's already in the store, so plain files left are
+// raised as alert instead of failing the ingest: they're still served to login user only,
+// and sealed when pushed to backend.
+func (b *BrBuilder) encryptOrAlert(id string) {
+	if err := b.encryptTransaction(id); err != nil {
+		log.Error(2, "[Branch] Encrypt transaction %s of %s failed: %v.", id, b.Name(), err)
+		alert.Raise(alert.KindEncryptFailed, b.Name(), "transaction %s left unencrypted: %v.", id, err)
+	}
+}
+
+// OpenSymbol open stored symbol file for reading its plain content and size. Encrypted
+// files are decrypted by the branch key.
+//
+func (b *BrBuilder) OpenSymbol(fpath string) (SymbolReader, int64, error) {
+	if encrypt.IsEncrypted(fpath) {
+		key, err := encrypt.Keys.Key(b.Name())
+		if err != nil {
+			return nil, 0, err
+		}
+		f, err := encrypt.Open(fpath, key)
+		if err != nil {
+			return nil, 0, err
+		}
+		return f, f.Size(), nil
+	}
+	fd, err := os.Open(fpath)
+	if err != nil {
+		return nil, 0, err
+	}
+	st, err := fd.Stat()
+	if err != nil {
+		fd.Close()
+		return nil, 0, err
+	}
+	return fd, st.Size(), nil
+}
@@ -0,0 +1,126 @@
+package symbol
+
+import (
+	"bufio"
+	"context"
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+
+	"github.com/adyzng/GoSymbols/pdb"
+	log "gopkg.in/clog.v1"
+)
+
+const (
+	failuresTxt = "failures.txt" // failed ingest jobs, `{date},{version},{error}`
+)
+
+// IngestFailure is one failed ingest job
+//
+type IngestFailure struct {
+	Date    string `json:"date"`
+	Version string `json:"version"`
+	Error   string `json:"error"`
+}
+
+// recordFailure append failed ingest of `version` to 000Admin/failures.txt
+func (b *BrBuilder) recordFailure(version string, err error) {
+	msg := strings.NewReplacer("\r", " ", "\n", " ").Replace(err.Error())
+	fpath := b.branchFile(failuresTxt)
+	fd, e := os.OpenFile(fpath, os.O_WRONLY|os.O_CREATE|os.O_APPEND, 0644)
+	if e != nil {
+		log.Warn("[Branch] Open %s failed: %v.", fpath, e)
+		return
+	}
+	defer fd.Close()
+	if version == "" {
+		version = "latest"
+	}
+	fmt.Fprintf(fd, "%s,%s,%s\r\n", timestamp(now()), version, msg)
+}
+
+// Failures return failed ingest jobs since `since` (2006-01-02 15:04:05), oldest first.
+//
+func (b *BrBuilder) Failures(since string) ([]*IngestFailure, error) {
+	fd, err := os.Open(b.branchFile(failuresTxt))
+	if os.IsNotExist(err) {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+	defer fd.Close()
+
+	var arr []*IngestFailure
+	scan := bufio.NewScanner(fd)
+	for scan.Scan() {
+		ss := strings.SplitN(strings.TrimSpace(scan.Text()), ",", 3)
+		if len(ss) != 3 || ss[0] < since {
+			continue
+		}
+		arr = append(arr, &IngestFailure{Date: ss[0], Version: ss[1], Error: ss[2]})
+	}
+	return arr, scan.Err()
+}
+
+// TransactionSize return count and total size of files added by transaction `id`. Symbols
+// already stored by an earlier transaction, file.ptr, refs.ptr and other files kept next to
+// the symbols are not counted.
+//
+func (b *BrBuilder) TransactionSize(id string) (int, int64, error) {
+	keys, err := b.transactionKeys(id)
+	if err != nil {
+		return 0, 0, err
+	}
+	stored := b.storedBefore(id)
+	count, total := 0, int64(0)
+	for _, key := range keys {
+		ss := strings.Split(key, "\\")
+		if stored(ss[0], ss[1]) {
+			continue
+		}
+		dir := b.symbolDir(ss[0], ss[1])
+		for _, name := range []string{ss[0], pdb.CompressedName(ss[0])} {
+			if fi, err := os.Stat(filepath.Join(dir, name)); err == nil && !fi.IsDir() {
+				count++
+				total += fi.Size()
+				break
+			}
+		}
+	}
+	return count, total, nil
+}
+
+// storedBefore return a check if symbol `name` with `hash` is added by a transaction before
+// `id`, from the hash index of the metadata database or the earlier transaction files.
+// Transactions of the builds are indexed once they are loaded.
+func (b *BrBuilder) storedBefore(id string) func(name, hash string) bool {
+	b.ParseBuilds(context.Background(), nil)
+	if db := openMeta(); db != nil {
+		return func(name, hash string) bool {
+			refs, _ := db.findHash(context.Background(), hash)
+			for _, ref := range refs {
+				if ref.branch == strings.ToLower(b.StoreName) && ref.id < id {
+					return true
+				}
+			}
+			return false
+		}
+	}
+
+	earlier := make(map[string]bool)
+	b.ParseBuilds(context.Background(), func(build *Build) error {
+		if build.ID >= id {
+			return nil
+		}
+		entries, _ := b.readTransaction(build.ID)
+		for _, e := range entries {
+			earlier[strings.ToLower(e.Name+"\\"+e.Hash)] = true
+		}
+		return nil
+	})
+	return func(name, hash string) bool {
+		return earlier[strings.ToLower(name+"\\"+hash)]
+	}
+}
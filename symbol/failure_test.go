@@ -0,0 +1,55 @@
+package symbol
+
+import (
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"sync"
+	"testing"
+
+	"github.com/adyzng/GoSymbols/config"
+)
+
+func TestTransactionSize(t *testing.T) {
+	root, err := ioutil.TempDir("", "txsize")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(root)
+	defer func() {
+		if metaStore != nil {
+			metaStore.close()
+		}
+		config.MetadataDB = ""
+		metaOnce, metaStore = sync.Once{}, nil
+	}()
+
+	admin := filepath.Join(root, adminDir)
+	os.MkdirAll(admin, 0755)
+	ioutil.WriteFile(filepath.Join(admin, "0000000001"), []byte(
+		"\"foo.pdb\\A1\",\"S:\\000Unzip\\x64\\foo.pdb\"\r\n"), 0644)
+	// foo.pdb is stored again, only bar.pd_ is added
+	ioutil.WriteFile(filepath.Join(admin, "0000000002"), []byte(
+		"\"foo.pdb\\A1\",\"S:\\000Unzip\\x64\\foo.pdb\"\r\n\"bar.pdb\\B1\",\"S:\\000Unzip\\x64\\bar.pdb\"\r\n"), 0644)
+	ioutil.WriteFile(filepath.Join(admin, serverTxt), []byte(
+		"0000000001,add,file,07/04/2017,14:44:14,\"test\",\"100\",\"\",\r\n"+
+			"0000000002,add,file,07/05/2017,14:44:14,\"test\",\"101\",\"\",\r\n"), 0644)
+	os.MkdirAll(filepath.Join(root, "foo.pdb", "A1"), 0755)
+	ioutil.WriteFile(filepath.Join(root, "foo.pdb", "A1", "foo.pdb"), make([]byte, 100), 0644)
+	ioutil.WriteFile(filepath.Join(root, "foo.pdb", "A1", "refs.ptr"), []byte("0000000001,file,1\r\n0000000002,file,1\r\n"), 0644)
+	os.MkdirAll(filepath.Join(root, "bar.pdb", "B1"), 0755)
+	ioutil.WriteFile(filepath.Join(root, "bar.pdb", "B1", "bar.pd_"), make([]byte, 30), 0644)
+
+	// from the earlier transaction files, then from the hash index
+	for _, db := range []string{"", filepath.Join(root, "gosymbols.db")} {
+		config.MetadataDB = db
+		metaOnce, metaStore = sync.Once{}, nil
+		b := NewBranch2(&Branch{StoreName: "test", StorePath: root, BuildPath: root}).(*BrBuilder)
+		if n, size, err := b.TransactionSize("0000000001"); err != nil || n != 1 || size != 100 {
+			t.Fatalf("expect 1 file of 100 bytes, got %d, %d (%v)", n, size, err)
+		}
+		if n, size, err := b.TransactionSize("0000000002"); err != nil || n != 1 || size != 30 {
+			t.Fatalf("expect 1 file of 30 bytes, got %d, %d (%v)", n, size, err)
+		}
+	}
+}
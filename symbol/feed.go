@@ -0,0 +1,53 @@
+package symbol
+
+import (
+	"os"
+	"path/filepath"
+	"strings"
+
+	"github.com/adyzng/GoSymbols/nuget"
+	log "gopkg.in/clog.v1"
+)
+
+// fromFeed check if the branch pull symbol packages from an NuGet feed, the versions of
+// its package are the builds and the package replace debug zip. Portable pdbs are stored
+// under their SSQP key `{name}/{guid}FFFFFFFF/{name}`.
+func (b *BrBuilder) fromFeed() bool {
+	return b.Feed != ""
+}
+
+// feedLatest return the latest version of branch package on feed
+func (b *BrBuilder) feedLatest() (string, error) {
+	return nuget.Open(b.Feed).Latest(b.Package)
+}
+
+// getPackage download symbol package of `version` as the debug zip to unzip
+func (b *BrBuilder) getPackage(version string) (string, error) {
+	fzip := filepath.Join(b.symPath, strings.ToLower(b.Package)+"."+version+".zip")
+	fd, err := os.OpenFile(fzip, os.O_WRONLY|os.O_CREATE|os.O_TRUNC, 0644)
+	if err != nil {
+		log.Error(2, "[Branch] create zip file %s failed: %v.", fzip, err)
+		return "", err
+	}
+	defer fd.Close()
+
+	if _, err = nuget.Open(b.Feed).Download(b.Package, version, fd); err != nil {
+		log.Error(2, "[Branch] Download %s %s from %s failed: %v.", b.Package, version, b.Feed, err)
+		return "", err
+	}
+	return fzip, nil
+}
+
+// listPackages list versions of branch package on feed as server builds, oldest first
+func (b *BrBuilder) listPackages() ([]*ServerBuild, error) {
+	versions, err := nuget.Open(b.Feed).Versions(b.Package)
+	if err != nil {
+		log.Error(2, "[Branch] List %s on %s failed: %v.", b.Package, b.Feed, err)
+		return nil, err
+	}
+	builds := make([]*ServerBuild, 0, len(versions))
+	for _, v := range versions {
+		builds = append(builds, &ServerBuild{Version: v})
+	}
+	return builds, nil
+}
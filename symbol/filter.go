@@ -0,0 +1,86 @@
+package symbol
+
+import (
+	"strconv"
+
+	"github.com/adyzng/GoSymbols/query"
+)
+
+// BuildFields is the filterable fields of build list
+var BuildFields = query.Schema{
+	"id":           query.String,
+	"key":          query.String,
+	"date":         query.Date,
+	"branch":       query.String,
+	"store":        query.String,
+	"version":      query.Version,
+	"comment":      query.String,
+	"supplementof": query.String,
+	"release":      query.Bool,
+	"status":       query.String,
+	"channel":      query.String,
+}
+
+// SymbolFields is the filterable fields of symbol list
+var SymbolFields = query.Schema{
+	"arch":         query.String,
+	"hash":         query.String,
+	"name":         query.String,
+	"path":         query.String,
+	"version":      query.Version,
+	"transaction":  query.String,
+	"supersededby": query.String,
+	"original":     query.String,
+}
+
+// Field return value of build field by lower case json name, used by query filter
+func (b *Build) Field(name string) string {
+	switch name {
+	case "id":
+		return b.ID
+	case "key":
+		return b.Key
+	case "date":
+		return b.Date
+	case "branch":
+		return b.Branch
+	case "store":
+		return b.Store
+	case "version":
+		return b.Version
+	case "comment":
+		return b.Comment
+	case "supplementof":
+		return b.SupplementOf
+	case "release":
+		return strconv.FormatBool(b.Release)
+	case "status":
+		return string(b.Status)
+	case "channel":
+		return b.Channel
+	}
+	return ""
+}
+
+// Field return value of symbol field by lower case json name, used by query filter
+func (s *Symbol) Field(name string) string {
+	switch name {
+	case "arch":
+		return s.Arch
+	case "hash":
+		return s.Hash
+	case "name":
+		return s.Name
+	case "path":
+		return s.Path
+	case "version":
+		return s.Version
+	case "transaction":
+		return s.Transaction
+	case "supersededby":
+		return s.SupersededBy
+	case "original":
+		return s.Original
+	}
+	return ""
+}
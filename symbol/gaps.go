@@ -0,0 +1,249 @@
+package symbol
+
+import (
+	"context"
+	"encoding/csv"
+	"fmt"
+	"io"
+	"path"
+	"sort"
+	"strings"
+
+	log "gopkg.in/clog.v1"
+)
+
+// Gap status of a requested key
+const (
+	GapFound       = "found"       // in store
+	GapOtherHash   = "other-hash"  // name is shipped but not this hash, the build is likely not ingested
+	GapQuarantined = "quarantined" // detected by scanner at ingest, kept out of store
+	GapUnknown     = "unknown"     // name never shipped by any branch
+)
+
+var (
+	ErrInvalidKeyList = fmt.Errorf("invalid symbol key list")
+)
+
+// SymbolKeyRef is one `{name, hash}` a debugger asked for
+//
+type SymbolKeyRef struct {
+	Name string `json:"name"`
+	Hash string `json:"hash"`
+}
+
+// GapEntry is the reconciliation of one requested key
+//
+type GapEntry struct {
+	Name   string          `json:"name"`
+	Hash   string          `json:"hash"`
+	Status string          `json:"status"`
+	Branch string          `json:"branch,omitempty"`
+	Builds []*ShippedBuild `json:"builds,omitempty"` // builds publishing the key, or the latest ones shipping the name
+	Hint   string          `json:"hint,omitempty"`
+}
+
+// GapReport reconcile keys a customer's debugger failed to resolve against the store
+//
+type GapReport struct {
+	Total    int            `json:"total"`
+	Found    int            `json:"found"`
+	Absent   int            `json:"absent"`
+	ByStatus map[string]int `json:"byStatus"`
+	Entries  []*GapEntry    `json:"entries"` // absent first, in request order
+}
+
+// ParseKeyList parse csv of `name,hash` rows, an optional header row is skipped. A single
+// column of symbol server path `name/hash/name` is also accepted.
+//
+func ParseKeyList(r io.Reader) ([]SymbolKeyRef, error) {
+	cr := csv.NewReader(r)
+	cr.FieldsPerRecord = -1
+	cr.TrimLeadingSpace = true
+
+	var keys []SymbolKeyRef
+	for row := 1; ; row++ {
+		rec, err := cr.Read()
+		if err == io.EOF {
+			break
+		}
+		if err != nil {
+			return nil, fmt.Errorf("%v: %v", ErrInvalidKeyList, err)
+		}
+		var key SymbolKeyRef
+		switch {
+		case len(rec) >= 2:
+			key = SymbolKeyRef{Name: strings.TrimSpace(rec[0]), Hash: strings.TrimSpace(rec[1])}
+		case len(rec) == 1 && strings.TrimSpace(rec[0]) == "":
+			continue
+		default:
+			key = parseKeyPath(rec[0])
+		}
+		if row == 1 && strings.EqualFold(key.Name, "name") {
+			continue
+		}
+		if key.Name == "" || key.Hash == "" {
+			return nil, fmt.Errorf("%v: row %d is not name,hash", ErrInvalidKeyList, row)
+		}
+		key.Hash = strings.ToUpper(key.Hash)
+		keys = append(keys, key)
+	}
+	return keys, nil
+}
+
+// parseKeyPath parse key from `{name}/{hash}` or symbol server path `[.../]{name}/{hash}/{file}`
+func parseKeyPath(p string) SymbolKeyRef {
+	ss := strings.Split(strings.Trim(strings.Replace(strings.TrimSpace(p), "\\", "/", -1), "/"), "/")
+	switch {
+	case len(ss) >= 3:
+		return SymbolKeyRef{Name: ss[len(ss)-3], Hash: ss[len(ss)-2]}
+	case len(ss) == 2:
+		return SymbolKeyRef{Name: ss[0], Hash: ss[1]}
+	}
+	return SymbolKeyRef{}
+}
+
+// shipIndex map `lower name` => `upper hash` => builds publishing it oldest first, only
+// names in `names` are indexed.
+func (b *BrBuilder) shipIndex(names map[string]bool) map[string]map[string][]*ShippedBuild {
+	var builds []*Build
+	b.ParseBuilds(context.Background(), func(build *Build) error {
+		builds = append(builds, build)
+		return nil
+	})
+	sort.Slice(builds, func(i, j int) bool {
+		return builds[i].ID < builds[j].ID
+	})
+
+	idx := make(map[string]map[string][]*ShippedBuild)
+	for _, build := range builds {
+		keys, err := b.transactionKeys(build.ID)
+		if err != nil {
+			log.Warn("[Branch] Read transaction %s of %s failed: %v.", build.ID, b.Name(), err)
+			continue
+		}
+		for _, key := range keys {
+			ss := strings.Split(key, "\\")
+			name, hash := strings.ToLower(ss[0]), strings.ToUpper(ss[1])
+			if !names[name] {
+				continue
+			}
+			if idx[name] == nil {
+				idx[name] = make(map[string][]*ShippedBuild)
+			}
+			idx[name][hash] = append(idx[name][hash], &ShippedBuild{
+				Key:     build.Key,
+				ID:      build.ID,
+				Version: build.Version,
+				Date:    build.Date,
+				Hash:    ss[1],
+			})
+		}
+	}
+	return idx
+}
+
+// branchIndex is the ship index and quarantined files of one branch
+type branchIndex struct {
+	name       string
+	ships      map[string]map[string][]*ShippedBuild
+	quarantine map[string]*QuarantinedFile // lower base name => latest quarantined
+}
+
+// ReconcileKeys report which of `keys` are in store and the builds publishing them, and why
+// the others are absent.
+//
+func (ss *sserver) ReconcileKeys(keys []SymbolKeyRef) *GapReport {
+	names := make(map[string]bool)
+	for _, key := range keys {
+		names[strings.ToLower(key.Name)] = true
+	}
+	var branches []*branchIndex
+	ss.WalkBuilders(func(bu Builder) error {
+		b, ok := bu.(*BrBuilder)
+		if !ok {
+			return nil
+		}
+		bi := &branchIndex{
+			name:       b.Name(),
+			ships:      b.shipIndex(names),
+			quarantine: make(map[string]*QuarantinedFile),
+		}
+		for _, q := range b.Quarantined() {
+			base := strings.ToLower(path.Base(q.Path))
+			if _, ok := bi.quarantine[base]; names[base] && !ok {
+				bi.quarantine[base] = q
+			}
+		}
+		branches = append(branches, bi)
+		return nil
+	})
+	sort.Slice(branches, func(i, j int) bool {
+		return branches[i].name < branches[j].name
+	})
+
+	rp := &GapReport{
+		Total:    len(keys),
+		ByStatus: make(map[string]int),
+		Entries:  make([]*GapEntry, 0, len(keys)),
+	}
+	for _, key := range keys {
+		e := reconcileKey(ss, branches, key)
+		rp.ByStatus[e.Status]++
+		if e.Status == GapFound {
+			rp.Found++
+		} else {
+			rp.Absent++
+		}
+		rp.Entries = append(rp.Entries, e)
+	}
+	sort.SliceStable(rp.Entries, func(i, j int) bool {
+		return rp.Entries[i].Status != GapFound && rp.Entries[j].Status == GapFound
+	})
+	log.Info("[SS] Reconcile %d keys, %d found, %d absent.", rp.Total, rp.Found, rp.Absent)
+	return rp
+}
+
+func reconcileKey(ss *sserver, branches []*branchIndex, key SymbolKeyRef) *GapEntry {
+	e := &GapEntry{Name: key.Name, Hash: strings.ToUpper(key.Hash)}
+	name := strings.ToLower(key.Name)
+	for _, bi := range branches {
+		if builds := bi.ships[name][e.Hash]; len(builds) > 0 {
+			e.Status, e.Branch, e.Builds = GapFound, bi.name, builds
+			return e
+		}
+	}
+	if f := ss.FindSymbol(key.Name, e.Hash); f != nil {
+		// in store without transaction, eg: served from a mounted archive
+		e.Status, e.Branch = GapFound, f.Builder.Name()
+		return e
+	}
+
+	// the latest build shipping another hash of the name
+	var latest *ShippedBuild
+	hashes := 0
+	for _, bi := range branches {
+		for _, builds := range bi.ships[name] {
+			hashes++
+			if last := builds[len(builds)-1]; latest == nil || last.Date > latest.Date {
+				latest, e.Branch = last, bi.name
+			}
+		}
+	}
+	if latest != nil {
+		e.Status = GapOtherHash
+		e.Builds = []*ShippedBuild{latest}
+		e.Hint = fmt.Sprintf("%d other hashes shipped, latest by build %s (%s) of %s; "+
+			"the customer may run a build not ingested", hashes, latest.Version, latest.Date, e.Branch)
+		return e
+	}
+	for _, bi := range branches {
+		if q, ok := bi.quarantine[name]; ok {
+			e.Status, e.Branch = GapQuarantined, bi.name
+			e.Hint = fmt.Sprintf("%s of build %s detected as %s at %s", q.Path, q.Version, q.Threat, q.Time)
+			return e
+		}
+	}
+	e.Status = GapUnknown
+	e.Hint = "never shipped by any branch, may be a third party or system module"
+	return e
+}
@@ -0,0 +1,59 @@
+package symbol
+
+import (
+	"encoding/json"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+func TestReconcileKeys(t *testing.T) {
+	keys, err := ParseKeyList(strings.NewReader("name,hash\r\nca_a.pdb,a1\r\n\r\n" +
+		"http://symbols/ca_a.pdb/A9/ca_a.pdb\r\nevil.pdb,E1\r\nntdll.pdb,N1\r\n"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(keys) != 4 || keys[0].Hash != "A1" || keys[1].Name != "ca_a.pdb" || keys[1].Hash != "A9" {
+		t.Fatalf("unexpected keys %+v", keys)
+	}
+	if _, err = ParseKeyList(strings.NewReader("ca_a.pdb\r\n")); err == nil {
+		t.Errorf("row without hash should fail")
+	}
+
+	root, err := ioutil.TempDir("", "gaps")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(root)
+	admin := filepath.Join(root, adminDir)
+	os.MkdirAll(admin, 0755)
+	ioutil.WriteFile(filepath.Join(admin, "0000000001"), []byte("\"ca_a.pdb\\A1\",\"S:\\000Unzip\\ca_a.pdb\"\r\n"), 0644)
+	ioutil.WriteFile(filepath.Join(admin, "0000000002"), []byte("\"ca_a.pdb\\A2\",\"S:\\000Unzip\\ca_a.pdb\"\r\n"), 0644)
+	ioutil.WriteFile(filepath.Join(admin, serverTxt), []byte(
+		`0000000001,add,file,07/04/2017,14:44:14,"test","100","",`+"\r\n"+
+			`0000000002,add,file,07/05/2017,14:44:14,"test","101","",`+"\r\n"), 0644)
+	os.MkdirAll(filepath.Join(root, quarantineStore), 0755)
+	data, _ := json.Marshal([]*QuarantinedFile{{Version: "102", Path: "x64/evil.pdb", Threat: "EICAR"}})
+	ioutil.WriteFile(filepath.Join(root, quarantineStore, "102.json"), data, 0644)
+
+	b := NewBranch2(&Branch{StoreName: "GapTest", StorePath: root, BuildPath: root}).(*BrBuilder)
+	ss := &sserver{builders: map[string]Builder{"gaptest": b}}
+	rp := ss.ReconcileKeys(keys)
+	if rp.Found != 1 || rp.Absent != 3 {
+		t.Fatalf("unexpected report %+v", rp)
+	}
+	expect := []string{GapOtherHash, GapQuarantined, GapUnknown, GapFound}
+	for i, e := range rp.Entries {
+		if e.Status != expect[i] {
+			t.Errorf("expect %s of %s\\%s, got %s", expect[i], e.Name, e.Hash, e.Status)
+		}
+	}
+	if e := rp.Entries[0]; len(e.Builds) != 1 || e.Builds[0].Version != "101" || e.Branch != "GapTest" {
+		t.Errorf("other hash should point to the latest build, got %+v", e)
+	}
+	if e := rp.Entries[3]; len(e.Builds) != 1 || e.Builds[0].Key != "GapTest@0000000001" {
+		t.Errorf("found key should map to its build, got %+v", e)
+	}
+}
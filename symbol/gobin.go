@@ -0,0 +1,196 @@
+package symbol
+
+import (
+	"bufio"
+	"bytes"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"strings"
+
+	"github.com/adyzng/GoSymbols/pdb"
+	log "gopkg.in/clog.v1"
+)
+
+const (
+	buildIDTxt = "buildids.txt" // unstripped ELF binaries stored at ingest, `{date},{id},{key},{name}`
+)
+
+// Binary is an unstripped ELF binary (eg: Go service) stored under its build id
+//
+type Binary struct {
+	Date string `json:"date"`
+	ID   string `json:"id"` // transaction of the build shipping it
+	Key  string `json:"key"`
+	Name string `json:"name"`
+}
+
+// storeBinaries copy unstripped ELF binaries under `symPath` into the store as
+// `{name}/{key}/{name}`, symstore.exe doesn't know them. They're recorded against
+// transaction `id` so purge of the build removes them.
+func (b *BrBuilder) storeBinaries(id, symPath string) (int, error) {
+	var bins []*Binary
+	err := filepath.Walk(symPath, func(fpath string, fi os.FileInfo, err error) error {
+		if err != nil || fi.IsDir() || pdb.IsSymbolFile(fi.Name()) {
+			return err
+		}
+		key, err := binaryKey(fpath)
+		if err != nil {
+			if err == pdb.ErrStripped || err == pdb.ErrNoBuildID {
+				log.Trace("[Branch] Skip ELF binary %s: %v.", fpath, err)
+			}
+			return nil
+		}
+		name := fi.Name()
+		dst := b.GetSymbolPath(key, name)
+		if _, err = os.Stat(dst); os.IsNotExist(err) {
+			if err = os.MkdirAll(filepath.Dir(dst), 0755); err != nil {
+				return err
+			}
+			if err = copyTo(fpath, dst); err != nil {
+				return err
+			}
+		}
+		bins = append(bins, &Binary{Date: timestamp(now()), ID: id, Key: key, Name: name})
+		return nil
+	})
+	if err != nil || len(bins) == 0 {
+		return 0, err
+	}
+
+	fd, err := os.OpenFile(b.branchFile(buildIDTxt), os.O_WRONLY|os.O_CREATE|os.O_APPEND, 0644)
+	if err != nil {
+		return 0, err
+	}
+	defer fd.Close()
+	w := bufio.NewWriter(fd)
+	for _, bin := range bins {
+		fmt.Fprintf(w, "%s,%s,%s,%s\r\n", bin.Date, bin.ID, bin.Key, bin.Name)
+	}
+	log.Info("[Branch] Store %d ELF binaries of transaction %s by build id.", len(bins), id)
+	return len(bins), w.Flush()
+}
+
+// binaryKey return the build id key of an ELF file, ErrUnknownFormat for other files
+func binaryKey(fpath string) (string, error) {
+	fd, err := os.Open(fpath)
+	if err != nil {
+		return "", err
+	}
+	defer fd.Close()
+	if !pdb.IsELF(fd) {
+		return "", pdb.ErrUnknownFormat
+	}
+	return pdb.ReadBuildID(fd)
+}
+
+// copyTo copy file `src` to `dst`
+func copyTo(src, dst string) error {
+	in, err := os.Open(src)
+	if err != nil {
+		return err
+	}
+	defer in.Close()
+	out, err := os.Create(dst)
+	if err != nil {
+		return err
+	}
+	if _, err = io.Copy(out, in); err != nil {
+		out.Close()
+		return err
+	}
+	return out.Close()
+}
+
+// Binaries return ELF binaries stored by build id, oldest first.
+//
+func (b *BrBuilder) Binaries() ([]*Binary, error) {
+	fd, err := os.Open(b.branchFile(buildIDTxt))
+	if os.IsNotExist(err) {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+	defer fd.Close()
+
+	var bins []*Binary
+	scan := bufio.NewScanner(fd)
+	for scan.Scan() {
+		ss := strings.Split(strings.TrimSpace(scan.Text()), ",")
+		if len(ss) == 4 {
+			bins = append(bins, &Binary{Date: ss[0], ID: ss[1], Key: ss[2], Name: ss[3]})
+		}
+	}
+	return bins, scan.Err()
+}
+
+// purgeBinaries remove binaries recorded only by transactions `ids`, the records of
+// `ids` are dropped from buildids.txt.
+func (b *BrBuilder) purgeBinaries(ids []string) error {
+	bins, err := b.Binaries()
+	if err != nil || len(bins) == 0 {
+		return err
+	}
+	purged := make(map[string]bool, len(ids))
+	for _, id := range ids {
+		purged[id] = true
+	}
+	var kept []*Binary
+	used := make(map[string]bool)
+	for _, bin := range bins {
+		if !purged[bin.ID] {
+			kept = append(kept, bin)
+			used[bin.Key+"/"+bin.Name] = true
+		}
+	}
+	if len(kept) == len(bins) {
+		return nil
+	}
+	for _, bin := range bins {
+		if purged[bin.ID] && !used[bin.Key+"/"+bin.Name] {
+			dir := filepath.Dir(b.GetSymbolPath(bin.Key, bin.Name))
+			if err = os.RemoveAll(dir); err != nil {
+				log.Warn("[Branch] Remove binary %s failed: %v.", dir, err)
+			}
+		}
+	}
+
+	var buf bytes.Buffer
+	for _, bin := range kept {
+		fmt.Fprintf(&buf, "%s,%s,%s,%s\r\n", bin.Date, bin.ID, bin.Key, bin.Name)
+	}
+	return writeFileAtomic(b.branchFile(buildIDTxt), buf.Bytes())
+}
+
+// FindBuildID search all branches for the binary of build id `id` (hex GNU build-id or Go
+// build id), return nil if not exist.
+//
+func (ss *sserver) FindBuildID(id string) *SymbolFile {
+	key := pdb.BuildIDKey(id)
+	var found *SymbolFile
+	ss.WalkBuilders(func(bu Builder) error {
+		b, ok := bu.(*BrBuilder)
+		if !ok {
+			return nil
+		}
+		bins, err := b.Binaries()
+		if err != nil {
+			log.Warn("[Branch] Read binaries of %s failed: %v.", b.Name(), err)
+			return nil
+		}
+		for i := len(bins) - 1; i >= 0; i-- {
+			if bins[i].Key != key {
+				continue
+			}
+			fpath := b.GetSymbolPath(key, bins[i].Name)
+			if st, err := os.Stat(fpath); err == nil && !st.IsDir() {
+				found = &SymbolFile{Builder: b, Path: fpath, Info: st}
+				return errFound
+			}
+		}
+		return nil
+	})
+	return found
+}
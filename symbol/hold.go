@@ -0,0 +1,235 @@
+package symbol
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+
+	"github.com/adyzng/GoSymbols/audit"
+	log "gopkg.in/clog.v1"
+)
+
+const (
+	holdsJSON = "holds.json" // legal holds in 000Admin, build ID => Hold
+)
+
+var (
+	ErrHoldNoReason = fmt.Errorf("legal hold reason required")
+	ErrHoldNotExist = fmt.Errorf("build is not under legal hold")
+	ErrHoldsInvalid = fmt.Errorf("legal holds are unreadable, destructive operations refused")
+)
+
+// Hold is a legal hold of one build and its supplements. Symbols of a held build are never
+// removed or overwritten by purge, conflict policy or any other destructive operation.
+//
+type Hold struct {
+	Branch  string `json:"branch"`
+	Build   string `json:"build"` // transaction ID
+	Version string `json:"version"`
+	Reason  string `json:"reason"`
+	Owner   string `json:"owner"` // who requested the hold, eg: legal contact
+	Date    string `json:"date"`
+	User    string `json:"user"` // who placed the hold
+}
+
+// readHolds read holds of the branch from 000Admin/holds.json, none if it doesn't exist.
+// ErrHoldsInvalid if it can't be read, callers removing or overwriting anything must stop.
+func (b *BrBuilder) readHolds() (map[string]*Hold, error) {
+	holds := make(map[string]*Hold)
+	data, err := ioutil.ReadFile(filepath.Join(b.StorePath, adminDir, holdsJSON))
+	if os.IsNotExist(err) {
+		return holds, nil
+	}
+	if err == nil {
+		err = json.Unmarshal(data, &holds)
+	}
+	if err != nil {
+		log.Error(2, "[Branch] Invalid %s of %s: %v.", holdsJSON, b.Name(), err)
+		return nil, ErrHoldsInvalid
+	}
+	return holds, nil
+}
+
+// legalHolds read holds of the branch for reporting, none if unreadable
+func (b *BrBuilder) legalHolds() map[string]*Hold {
+	holds, err := b.readHolds()
+	if err != nil {
+		return make(map[string]*Hold)
+	}
+	return holds
+}
+
+func (b *BrBuilder) saveHolds(holds map[string]*Hold) error {
+	data, _ := json.MarshalIndent(holds, "", "\t")
+	return writeFileAtomic(filepath.Join(b.StorePath, adminDir, holdsJSON), data)
+}
+
+// heldIDs return transaction IDs under hold, supplements of a held build included.
+// Any operation removing transactions or symbol files must skip them, and stop on error.
+func (b *BrBuilder) heldIDs() (map[string]bool, error) {
+	holds, err := b.readHolds()
+	if err != nil {
+		return nil, err
+	}
+	held := make(map[string]bool, len(holds))
+	if len(holds) == 0 {
+		return held, nil
+	}
+	for id := range holds {
+		held[id] = true
+	}
+	_, err = b.ParseBuilds(context.Background(), func(build *Build) error {
+		if holds[build.SupplementOf] != nil {
+			held[build.ID] = true
+		}
+		return nil
+	})
+	return held, err
+}
+
+// heldKeys return lower `name\hash` of all symbols referenced by held transactions, error if
+// one of them can't be read
+func (b *BrBuilder) heldKeys() (map[string]bool, error) {
+	held, err := b.heldIDs()
+	if err != nil {
+		return nil, err
+	}
+	keys := make(map[string]bool)
+	for id := range held {
+		lines, err := b.transactionLines(id)
+		if err != nil {
+			log.Warn("[Branch] Read held transaction %s failed: %v.", id, err)
+			return nil, err
+		}
+		for _, line := range lines {
+			keys[strings.ToLower(strings.Trim(strings.Split(line, ",")[0], "\""))] = true
+		}
+	}
+	return keys, nil
+}
+
+// PlaceHold put build `buildID` under legal hold, for `reason` requested by `owner`.
+// An exist hold of the build is replaced.
+//
+func (b *BrBuilder) PlaceHold(buildID, reason, owner, user string) (*Hold, error) {
+	if strings.TrimSpace(reason) == "" {
+		return nil, ErrHoldNoReason
+	}
+	build := b.getBuild("", padID(buildID))
+	if build == nil || build.SupplementOf != "" {
+		return nil, ErrBuildNotExist
+	}
+	if owner == "" {
+		owner = user
+	}
+
+	b.ingMx.Lock()
+	defer b.ingMx.Unlock()
+	holds, err := b.readHolds()
+	if err != nil {
+		return nil, err
+	}
+	hold := &Hold{
+		Branch:  b.Name(),
+		Build:   build.ID,
+		Version: build.Version,
+		Reason:  reason,
+		Owner:   owner,
+		Date:    timestamp(now()),
+		User:    user,
+	}
+	holds[build.ID] = hold
+	if err := b.saveHolds(holds); err != nil {
+		log.Error(2, "[Branch] Save legal holds of %s failed: %v.", b.Name(), err)
+		return nil, err
+	}
+	b.mx.Lock()
+	build.Hold = hold
+	b.mx.Unlock()
+
+	audit.Record(user, "hold", b.Name(), "build %s (%s) held for %s: %s", build.Version, build.ID, owner, reason)
+	log.Info("[Branch] Build %s (%s) of %s under legal hold by %s.", build.Version, build.ID, b.Name(), user)
+	return hold, nil
+}
+
+// ReleaseHold remove the legal hold of build `buildID`.
+//
+func (b *BrBuilder) ReleaseHold(buildID, user string) error {
+	b.ingMx.Lock()
+	defer b.ingMx.Unlock()
+
+	id := padID(buildID)
+	holds, err := b.readHolds()
+	if err != nil {
+		return err
+	}
+	hold, ok := holds[id]
+	if !ok {
+		return ErrHoldNotExist
+	}
+	delete(holds, id)
+	if err := b.saveHolds(holds); err != nil {
+		log.Error(2, "[Branch] Save legal holds of %s failed: %v.", b.Name(), err)
+		return err
+	}
+	if build := b.getBuild("", id); build != nil {
+		b.mx.Lock()
+		build.Hold = nil
+		b.mx.Unlock()
+	}
+
+	audit.Record(user, "release-hold", b.Name(), "build %s (%s) released, held by %s at %s: %s",
+		hold.Version, hold.Build, hold.User, hold.Date, hold.Reason)
+	log.Info("[Branch] Build %s (%s) of %s released from legal hold by %s.", hold.Version, id, b.Name(), user)
+	return nil
+}
+
+// mergeHolds copy legal holds of `src` into the branch with build IDs re-keyed by `ids`
+func (b *BrBuilder) mergeHolds(src *BrBuilder, ids map[string]string) error {
+	moved, err := src.readHolds()
+	if err != nil || len(moved) == 0 {
+		return err
+	}
+	holds, err := b.readHolds()
+	if err != nil {
+		return err
+	}
+	for id, hold := range moved {
+		nid, ok := ids[id]
+		if !ok {
+			continue
+		}
+		h := *hold
+		h.Branch, h.Build = b.Name(), nid
+		if _, exist := holds[nid]; !exist {
+			holds[nid] = &h
+		}
+	}
+	return b.saveHolds(holds)
+}
+
+// LegalHolds report all builds under legal hold of local branches.
+//
+func (ss *sserver) LegalHolds() []*Hold {
+	var arr []*Hold
+	ss.WalkBuilders(func(bu Builder) error {
+		if b, ok := bu.(*BrBuilder); ok {
+			for _, hold := range b.legalHolds() {
+				arr = append(arr, hold)
+			}
+		}
+		return nil
+	})
+	sort.Slice(arr, func(i, j int) bool {
+		if arr[i].Branch != arr[j].Branch {
+			return arr[i].Branch < arr[j].Branch
+		}
+		return arr[i].Build < arr[j].Build
+	})
+	return arr
+}
@@ -0,0 +1,99 @@
+package symbol
+
+import (
+	"context"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/adyzng/GoSymbols/config"
+)
+
+func TestLegalHold(t *testing.T) {
+	root, err := ioutil.TempDir("", "hold")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(root)
+	defer func(file string) { config.AuditFile = file }(config.AuditFile)
+	config.AuditFile = filepath.Join(root, "audit.log")
+
+	admin := filepath.Join(root, adminDir)
+	os.MkdirAll(admin, 0755)
+	server := ""
+	for i, key := range []string{"A1", "A2", "A3"} {
+		id := padID(string('1' + byte(i)))
+		fpath := filepath.Join(root, "ca_a.pdb", key, "ca_a.pdb")
+		os.MkdirAll(filepath.Dir(fpath), 0755)
+		ioutil.WriteFile(fpath, []byte(key), 0644)
+		ioutil.WriteFile(filepath.Join(admin, id), []byte("\"ca_a.pdb\\"+key+"\",\"S:\\000Unzip\\ca_a.pdb\"\r\n"), 0644)
+		server += id + ",add,file,07/04/2017,14:44:14,\"test\",\"" + key + "\",\"\",\r\n"
+	}
+	// transaction 3 is an supplement of 2
+	server = server[:len(server)-len("\"\",\r\n")] + "\"supplement:0000000002\",\r\n"
+	ioutil.WriteFile(filepath.Join(admin, serverTxt), []byte(server), 0644)
+	ioutil.WriteFile(filepath.Join(admin, lastidTxt), []byte("0000000003"), 0644)
+
+	b := NewBranch2(&Branch{StoreName: "HoldTest", StorePath: root, BuildPath: root}).(*BrBuilder)
+	b.ParseBuilds(context.Background(), nil)
+	if _, err = b.PlaceHold("2", " ", "", "test"); err != ErrHoldNoReason {
+		t.Fatalf("expect reason required, got %v", err)
+	}
+	if _, err = b.PlaceHold("3", "case 17", "", "test"); err != ErrBuildNotExist {
+		t.Fatalf("expect supplement can't be held, got %v", err)
+	}
+	hold, err := b.PlaceHold("2", "case 17", "legal", "test")
+	if err != nil || hold.Build != "0000000002" || hold.Version != "A2" || hold.Owner != "legal" {
+		t.Fatalf("unexpected hold %+v (%v)", hold, err)
+	}
+
+	plan, err := b.PlanPurge(PurgeOption{Patterns: []string{"ca_*.pdb"}})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(plan.Entries) != 1 || plan.Entries[0].Transaction != "0000000001" || len(plan.Held) != 2 {
+		t.Fatalf("expect held build and its supplement skipped, got %+v", plan)
+	}
+	if _, err = b.ExecutePurge(plan.Token, "test"); err != nil {
+		t.Fatal(err)
+	}
+	for _, key := range []string{"A2", "A3"} {
+		if _, err = os.Stat(filepath.Join(root, "ca_a.pdb", key)); err != nil {
+			t.Fatalf("held symbol %s removed: %v", key, err)
+		}
+	}
+
+	ss := &sserver{builders: map[string]Builder{"holdtest": b}}
+	if holds := ss.LegalHolds(); len(holds) != 1 || holds[0].Reason != "case 17" {
+		t.Fatalf("unexpected hold report %+v", holds)
+	}
+	if build := b.getBuild("A2", ""); build == nil || build.Hold == nil {
+		t.Fatal("expect hold loaded with builds")
+	}
+
+	// unreadable holds stop retention and purge instead of removing held builds
+	fpath := filepath.Join(admin, holdsJSON)
+	saved, _ := ioutil.ReadFile(fpath)
+	ioutil.WriteFile(fpath, saved[:len(saved)/2], 0644)
+	b.Retention = &Retention{KeepLast: 1}
+	if _, err = b.PlanRetention(); err != ErrHoldsInvalid {
+		t.Fatalf("expect retention refused, got %v", err)
+	}
+	if _, err = b.PlanPurge(PurgeOption{Patterns: []string{"*"}}); err != ErrHoldsInvalid {
+		t.Fatalf("expect purge refused, got %v", err)
+	}
+	if _, err = b.PlaceHold("2", "case 18", "", "test"); err != ErrHoldsInvalid {
+		t.Fatalf("expect exist holds never overwritten, got %v", err)
+	}
+	ioutil.WriteFile(fpath, saved, 0644)
+	if err = b.ReleaseHold("2", "test"); err != nil {
+		t.Fatal(err)
+	}
+	if err = b.ReleaseHold("2", "test"); err != ErrHoldNotExist {
+		t.Fatalf("expect hold released once, got %v", err)
+	}
+	if len(ss.LegalHolds()) != 0 {
+		t.Fatal("expect no hold left")
+	}
+}
@@ -0,0 +1,260 @@
+package symbol
+
+import (
+	"bufio"
+	"bytes"
+	"encoding/csv"
+	"fmt"
+	"io"
+	"strconv"
+	"strings"
+
+	"github.com/adyzng/GoSymbols/audit"
+	log "gopkg.in/clog.v1"
+)
+
+// Result of a row of branch import
+const (
+	ImportValid   = "valid"   // dry run, would be created
+	ImportCreated = "created" // added to the branch list
+	ImportExists  = "exists"  // branch of the store name already exist, left as is
+	ImportInvalid = "invalid"
+)
+
+var (
+	ErrImportHeader = fmt.Errorf("csv header need storeName column")
+	ErrBranchExists = fmt.Errorf("branch already exist")
+)
+
+// importColumns map normalized csv header to setter of the branch field
+var importColumns = map[string]func(b *Branch, v string) error{
+	"storename": func(b *Branch, v string) error { b.StoreName = v; return nil },
+	"buildname": func(b *Branch, v string) error { b.BuildName = v; return nil },
+	"buildpath": func(b *Branch, v string) error { b.BuildPath = v; return nil },
+	"storepath": func(b *Branch, v string) error { b.StorePath = v; return nil },
+	"schedule":  func(b *Branch, v string) error { b.Schedule = strings.ToLower(v); return nil },
+	"detector":  func(b *Branch, v string) error { b.Detector = v; return nil },
+	"retention": func(b *Branch, v string) (err error) {
+		b.Retention, err = ParseRetention(v)
+		return err
+	},
+	"priority": func(b *Branch, v string) (err error) {
+		b.Priority, err = ParsePriority(v)
+		if b.Priority == PriorityDefault {
+			b.Priority = PriorityNormal
+		}
+		return err
+	},
+}
+
+// ImportRow is one branch of an import and its result
+//
+type ImportRow struct {
+	Row     int     `json:"row"` // row in csv, the header is 1
+	Branch  *Branch `json:"branch,omitempty"`
+	Status  string  `json:"status"` // valid, created, exists or invalid
+	Message string  `json:"message,omitempty"`
+}
+
+// ImportReport is the result of each row of a branch import
+//
+type ImportReport struct {
+	DryRun  bool         `json:"dryRun"`
+	Rows    []*ImportRow `json:"rows"`
+	Valid   int          `json:"valid"` // dry run only
+	Created int          `json:"created"`
+	Exists  int          `json:"exists"`
+	Invalid int          `json:"invalid"`
+}
+
+// ParseRetention parse retention of a csv cell, `last=20;days=180;channels=ga|beta`.
+// Empty is no retention.
+//
+func ParseRetention(s string) (*Retention, error) {
+	if strings.TrimSpace(s) == "" {
+		return nil, nil
+	}
+	r := &Retention{}
+	for _, field := range strings.FieldsFunc(s, func(c rune) bool { return c == ';' || c == ' ' }) {
+		kv := strings.SplitN(field, "=", 2)
+		if len(kv) != 2 {
+			return nil, fmt.Errorf("invalid retention %s, expect eg: last=20;days=180;channels=ga", s)
+		}
+		var err error
+		switch strings.ToLower(kv[0]) {
+		case "last":
+			r.KeepLast, err = strconv.Atoi(kv[1])
+		case "days":
+			r.KeepDays, err = strconv.Atoi(kv[1])
+		case "channels":
+			r.KeepChannels = strings.Split(kv[1], "|")
+		default:
+			err = fmt.Errorf("unknown %s", kv[0])
+		}
+		if err != nil {
+			return nil, fmt.Errorf("invalid retention %s: %v", s, err)
+		}
+	}
+	return r, CheckRetention(r)
+}
+
+// ParseBranchCSV read branches to import from csv with a header row, eg:
+//
+//	storeName,buildPath,schedule,retention
+//	UDPv6.5U2,\\build\UDPv6.5U2\Release,auto,last=20;days=180
+//
+// Columns are storeName, buildName, buildPath, storePath, schedule, retention, priority
+// and detector in any order, case and spaces of the header are ignored. Excel saved csv
+// with `;` separator or utf-8 BOM is accepted. Rows failed to parse are invalid rows.
+//
+func ParseBranchCSV(r io.Reader) ([]*ImportRow, error) {
+	br := bufio.NewReader(r)
+	head, _ := br.Peek(4096)
+	head = bytes.TrimPrefix(head, []byte("\xef\xbb\xbf"))
+	if idx := bytes.IndexByte(head, '\n'); idx != -1 {
+		head = head[:idx]
+	}
+	if bom, _ := br.Peek(3); bytes.Equal(bom, []byte("\xef\xbb\xbf")) {
+		br.Discard(3)
+	}
+
+	cr := csv.NewReader(br)
+	cr.FieldsPerRecord = -1
+	cr.TrimLeadingSpace = true
+	if bytes.Count(head, []byte(";")) > bytes.Count(head, []byte(",")) {
+		cr.Comma = ';'
+	}
+	header, err := cr.Read()
+	if err != nil {
+		return nil, fmt.Errorf("read csv header failed: %v", err)
+	}
+	setters := make([]func(b *Branch, v string) error, len(header))
+	hasName := false
+	for i, col := range header {
+		name := strings.ToLower(strings.NewReplacer(" ", "", "_", "", "-", "").Replace(col))
+		if setters[i] = importColumns[name]; setters[i] == nil {
+			return nil, fmt.Errorf("unknown csv column %q", col)
+		}
+		hasName = hasName || name == "storename"
+	}
+	if !hasName {
+		return nil, ErrImportHeader
+	}
+
+	var rows []*ImportRow
+	for n := 2; ; n++ {
+		record, err := cr.Read()
+		if err == io.EOF {
+			break
+		}
+		row := &ImportRow{Row: n, Branch: &Branch{}}
+		if err != nil {
+			row.Status, row.Message = ImportInvalid, err.Error()
+			rows = append(rows, row)
+			continue
+		}
+		if strings.TrimSpace(strings.Join(record, "")) == "" {
+			continue
+		}
+		for i, v := range record {
+			if i >= len(setters) {
+				row.Status, row.Message = ImportInvalid, "more fields than header"
+				break
+			}
+			if err = setters[i](row.Branch, strings.TrimSpace(v)); err != nil {
+				row.Status, row.Message = ImportInvalid, fmt.Sprintf("%s: %v", header[i], err)
+				break
+			}
+		}
+		rows = append(rows, row)
+	}
+	return rows, nil
+}
+
+// ValidateBranch check branch `b` could be added, its settings and the build path or store
+// folder accessible. Nothing is changed. ErrBranchExists if the store name is taken.
+//
+func (ss *sserver) ValidateBranch(b *Branch) error {
+	if !pathElem(b.StoreName) {
+		return fmt.Errorf("invalid store name %q", b.StoreName)
+	}
+	if ss.Get(b.StoreName) != nil {
+		return ErrBranchExists
+	}
+	ss.lck.RLock()
+	err := ss.checkBranch(b)
+	ss.lck.RUnlock()
+	if err != nil {
+		return err
+	}
+
+	nb := *b
+	sharedDefaults(&nb)
+	br := NewBranch2(&nb)
+	if !br.CanUpdate() && !br.CanBrowse() {
+		return fmt.Errorf("neither build path %s nor store %s is accessable", br.GetBranch().BuildPath, br.GetBranch().StorePath)
+	}
+	return nil
+}
+
+// ImportBranches validate and add branches of `rows` one by one, invalid rows are reported
+// and skipped. With `dryRun` only validate them. Added branches with build path accessible
+// are triggered to ingest the latest build.
+//
+func (ss *sserver) ImportBranches(rows []*ImportRow, dryRun bool, user string) *ImportReport {
+	report := &ImportReport{DryRun: dryRun, Rows: rows}
+	seen := make(map[string]int)
+	for _, row := range rows {
+		if row.Status == ImportInvalid {
+			report.Invalid++
+			continue
+		}
+		lower := strings.ToLower(row.Branch.StoreName)
+		if n, ok := seen[lower]; ok {
+			row.Status, row.Message = ImportInvalid, fmt.Sprintf("duplicate of row %d", n)
+			report.Invalid++
+			continue
+		}
+		seen[lower] = row.Row
+
+		switch err := ss.ValidateBranch(row.Branch); {
+		case err == ErrBranchExists:
+			row.Status, row.Message = ImportExists, err.Error()
+			report.Exists++
+			continue
+		case err != nil:
+			row.Status, row.Message = ImportInvalid, err.Error()
+			report.Invalid++
+			continue
+		}
+		if dryRun {
+			row.Status = ImportValid
+			report.Valid++
+			continue
+		}
+
+		br := ss.Add(row.Branch)
+		if br == nil {
+			row.Status, row.Message = ImportInvalid, "branch not added"
+			report.Invalid++
+			continue
+		}
+		row.Status, row.Branch = ImportCreated, br.GetBranch()
+		report.Created++
+		if !br.CanUpdate() {
+			row.Message = fmt.Sprintf("build path not accessable (%s)", br.GetBranch().BuildPath)
+		} else if br.GetBranch().Schedule != ScheduleManual {
+			ss.Trigger(br.Name(), "", PriorityDefault)
+		}
+	}
+
+	if report.Created > 0 {
+		if err := ss.SaveBranchs(""); err != nil {
+			log.Warn("[SS] Save imported branches failed: %v.", err)
+		}
+		audit.Record(user, "import", "", "%d branches imported, %d exist, %d invalid", report.Created, report.Exists, report.Invalid)
+	}
+	log.Info("[SS] Import %d branches (dry run %v): %d created, %d exist, %d invalid.",
+		len(rows), dryRun, report.Created, report.Exists, report.Invalid)
+	return report
+}
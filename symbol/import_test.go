@@ -0,0 +1,100 @@
+package symbol
+
+import (
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/adyzng/GoSymbols/config"
+)
+
+func TestParseBranchCSV(t *testing.T) {
+	if _, err := ParseBranchCSV(strings.NewReader("buildPath,schedule\n")); err != ErrImportHeader {
+		t.Errorf("expect header without storeName refused, got %v", err)
+	}
+	if _, err := ParseBranchCSV(strings.NewReader("storeName,owner\n")); err == nil {
+		t.Errorf("expect unknown column refused")
+	}
+
+	// saved by Excel: utf-8 BOM, `;` separator and crlf
+	data := "\xef\xbb\xbfStore Name;Build Path;Schedule;Retention\r\n" +
+		"UDPv6.5;\\\\build\\UDPv6.5;Manual;last=20;days=180\r\n" +
+		";;;\r\n" +
+		"UDPv7;\\\\build\\UDPv7;auto;last=x\r\n" +
+		"\"UDPv8\";\\\\build\\UDPv8;;\"days=30;channels=ga|beta\"\r\n"
+	rows, err := ParseBranchCSV(strings.NewReader(data))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(rows) != 3 {
+		t.Fatalf("expect 3 rows without the empty one, got %d", len(rows))
+	}
+	if b := rows[0].Branch; rows[0].Row != 2 || b.StoreName != "UDPv6.5" || b.Schedule != ScheduleManual ||
+		b.Retention == nil || b.Retention.KeepLast != 20 {
+		t.Errorf("unexpected row %+v, branch %+v", rows[0], b)
+	}
+	if rows[1].Row != 4 || rows[1].Status != ImportInvalid {
+		t.Errorf("expect bad retention invalid, got %+v", rows[1])
+	}
+	if r := rows[2].Branch.Retention; rows[2].Status != "" || r == nil || r.KeepDays != 30 || len(r.KeepChannels) != 2 {
+		t.Errorf("unexpected row %+v", rows[2])
+	}
+}
+
+func TestImportBranches(t *testing.T) {
+	root, err := ioutil.TempDir("", "import")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(root)
+	defer func(app, file string) {
+		config.AppPath, config.AuditFile = app, file
+	}(config.AppPath, config.AuditFile)
+	config.AppPath = root
+	config.AuditFile = filepath.Join(root, "audit.log")
+
+	for _, name := range []string{"exist", "new", "other"} {
+		os.MkdirAll(filepath.Join(root, name, adminDir), 0755)
+	}
+	ss := &sserver{builders: map[string]Builder{
+		"exist": NewBranch2(&Branch{StoreName: "Exist", StorePath: filepath.Join(root, "exist")}),
+	}}
+	csv := "storeName,storePath,schedule\n" +
+		"exist," + filepath.Join(root, "exist") + ",manual\n" +
+		"New," + filepath.Join(root, "new") + ",manual\n" +
+		"new," + filepath.Join(root, "new") + ",manual\n" +
+		"Missing," + filepath.Join(root, "missing") + ",manual\n" +
+		"Other," + filepath.Join(root, "other") + ",daily\n" +
+		"../up," + filepath.Join(root, "other") + ",\n"
+	parse := func() []*ImportRow {
+		rows, err := ParseBranchCSV(strings.NewReader(csv))
+		if err != nil {
+			t.Fatal(err)
+		}
+		return rows
+	}
+
+	report := ss.ImportBranches(parse(), true, "test")
+	expect := []string{ImportExists, ImportValid, ImportInvalid, ImportInvalid, ImportInvalid, ImportInvalid}
+	for i, row := range report.Rows {
+		if row.Status != expect[i] {
+			t.Errorf("row %d: expect %s, got %s (%s)", row.Row, expect[i], row.Status, row.Message)
+		}
+	}
+	if report.Valid != 1 || report.Exists != 1 || report.Invalid != 4 || ss.Get("new") != nil {
+		t.Errorf("dry run changed branches or unexpected report %+v", report)
+	}
+
+	report = ss.ImportBranches(parse(), false, "test")
+	if report.Created != 1 || report.Rows[1].Status != ImportCreated || ss.Get("new") == nil {
+		t.Errorf("expect branch created, got %+v", report)
+	}
+	if ss.Get("new").GetBranch().Schedule != ScheduleManual {
+		t.Errorf("expect schedule imported")
+	}
+	if _, err = os.Stat(filepath.Join(root, symConfig)); err != nil {
+		t.Errorf("expect imported branches saved: %v", err)
+	}
+}
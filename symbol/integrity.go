@@ -0,0 +1,257 @@
+package symbol
+
+import (
+	"bufio"
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/hex"
+	"fmt"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+
+	"github.com/adyzng/GoSymbols/config"
+	"github.com/adyzng/GoSymbols/event"
+	log "gopkg.in/clog.v1"
+)
+
+const (
+	integrityTxt = "integrity.txt" // chained hmac of admin metadata, `{ID},{kind},{line sha256},{file sha256},{hmac}`
+
+	signAdd   = "add"   // transaction listed in server.txt
+	signPurge = "purge" // purge transaction, only recorded in 000Admin/purge/{ID}
+)
+
+var (
+	ErrNoIntegrityKey = fmt.Errorf("integrity key not configured")
+)
+
+// signRecord is one line of 000Admin/integrity.txt, the latest record of a transaction win
+type signRecord struct {
+	ID       string
+	Kind     string
+	LineSum  string // sha256 of the line in server.txt
+	FileSum  string // sha256 of transaction file 000Admin/{ID}, see signedFile
+	MAC      string // hmac of previous MAC and fields above
+	previous string
+}
+
+func (r *signRecord) mac(key []byte) string {
+	h := hmac.New(sha256.New, key)
+	fmt.Fprintf(h, "%s|%s|%s|%s|%s", r.previous, r.ID, r.Kind, r.LineSum, r.FileSum)
+	return hex.EncodeToString(h.Sum(nil))
+}
+
+// VerifyReport is the result of checking admin files against integrity.txt
+//
+type VerifyReport struct {
+	Branch   string   `json:"branch"`
+	Signed   int      `json:"signed"`             // transactions with valid record
+	Unsigned []string `json:"unsigned,omitempty"` // transactions added before signing enabled
+	Tampered []string `json:"tampered,omitempty"` // `{ID}: reason`
+	Chain    string   `json:"chain,omitempty"`    // first broken record of integrity.txt, empty if intact
+}
+
+// OK check if nothing is tampered
+func (r *VerifyReport) OK() bool {
+	return len(r.Tampered) == 0 && r.Chain == ""
+}
+
+// integrityKey read hex key from `[integrity] KEY_FILE`, nil if signing not enabled
+func integrityKey() ([]byte, error) {
+	fpath := config.IntegrityKeyFile
+	if fpath == "" {
+		return nil, ErrNoIntegrityKey
+	}
+	if !filepath.IsAbs(fpath) {
+		fpath = filepath.Join(config.AppPath, fpath)
+	}
+	data, err := ioutil.ReadFile(fpath)
+	if err != nil {
+		return nil, err
+	}
+	key, err := hex.DecodeString(strings.TrimSpace(string(data)))
+	if err != nil || len(key) < 16 {
+		return nil, fmt.Errorf("invalid integrity key in %s", fpath)
+	}
+	return key, nil
+}
+
+// serverLines read server.txt lines by transaction ID, only lines of the branch's own
+// builds in shared store.
+func (b *BrBuilder) serverLines() (map[string]string, error) {
+	lines, err := b.transactionLines(serverTxt)
+	if err != nil && !os.IsNotExist(err) {
+		return nil, err
+	}
+	byID := make(map[string]string, len(lines))
+	for _, line := range lines {
+		if b.Shared {
+			if build := parseBuildLine(line); build == nil || !b.ownBuild(build) {
+				continue
+			}
+		}
+		byID[strings.Split(line, ",")[0]] = line
+	}
+	return byID, nil
+}
+
+func sha256Hex(s string) string {
+	sum := sha256.Sum256([]byte(s))
+	return hex.EncodeToString(sum[:])
+}
+
+// signedFile return the transaction file signed by record of `kind`
+func (b *BrBuilder) signedFile(kind, id string) string {
+	if kind == signPurge {
+		return b.purgeRecord(id)
+	}
+	return filepath.Join(b.StorePath, adminDir, id)
+}
+
+// signRecords read integrity.txt of the branch in order
+func (b *BrBuilder) signRecords() ([]*signRecord, error) {
+	lines, err := b.transactionLines(b.branchName(integrityTxt))
+	if err != nil {
+		if os.IsNotExist(err) {
+			err = nil
+		}
+		return nil, err
+	}
+	records := make([]*signRecord, 0, len(lines))
+	for _, line := range lines {
+		ss := strings.Split(line, ",")
+		if len(ss) != 5 {
+			// never match, break the chain
+			records = append(records, &signRecord{ID: ss[0]})
+			continue
+		}
+		records = append(records, &signRecord{ID: ss[0], Kind: ss[1], LineSum: ss[2], FileSum: ss[3], MAC: ss[4]})
+	}
+	return records, nil
+}
+
+// signTransactions append records of transactions `ids` of `kind` to integrity.txt of the
+// branch, chained to the last record. Nothing is done without integrity key. Caller hold `ingMx`.
+func (b *BrBuilder) signTransactions(kind string, ids ...string) error {
+	key, err := integrityKey()
+	if err == ErrNoIntegrityKey {
+		return nil
+	} else if err != nil {
+		return err
+	}
+	records, err := b.signRecords()
+	if err != nil {
+		return err
+	}
+	previous := ""
+	if len(records) > 0 {
+		previous = records[len(records)-1].MAC
+	}
+	lines, err := b.serverLines()
+	if err != nil {
+		return err
+	}
+
+	fd, err := os.OpenFile(b.branchFile(integrityTxt), os.O_WRONLY|os.O_CREATE|os.O_APPEND, 0644)
+	if err != nil {
+		return err
+	}
+	defer fd.Close()
+	w := bufio.NewWriter(fd)
+	for _, id := range ids {
+		r := &signRecord{ID: id, Kind: kind, previous: previous}
+		if kind == signAdd {
+			r.LineSum = sha256Hex(lines[id])
+		}
+		if r.FileSum, err = fileSHA256(b.signedFile(kind, id)); err != nil {
+			return err
+		}
+		r.MAC = r.mac(key)
+		previous = r.MAC
+		fmt.Fprintf(w, "%s,%s,%s,%s,%s\r\n", r.ID, r.Kind, r.LineSum, r.FileSum, r.MAC)
+	}
+	log.Trace("[Branch] Sign %d transactions of %s.", len(ids), b.Name())
+	return w.Flush()
+}
+
+// signOrWarn sign transactions, failure is logged since the store is already changed
+func (b *BrBuilder) signOrWarn(kind string, ids ...string) {
+	if err := b.signTransactions(kind, ids...); err != nil {
+		log.Error(2, "[Branch] Sign transactions %v of %s failed: %v.", ids, b.Name(), err)
+	}
+}
+
+// Verify check server.txt, history deletions and transaction files against the chained
+// records of integrity.txt, so changes made out of GoSymbols are detected.
+//
+func (b *BrBuilder) Verify() (*VerifyReport, error) {
+	key, err := integrityKey()
+	if err != nil {
+		return nil, err
+	}
+	b.ingMx.Lock()
+	defer b.ingMx.Unlock()
+
+	report := &VerifyReport{Branch: b.Name()}
+	records, err := b.signRecords()
+	if err != nil {
+		return nil, err
+	}
+	latest := make(map[string]*signRecord, len(records))
+	previous := ""
+	for i, r := range records {
+		r.previous = previous
+		if !hmac.Equal([]byte(r.mac(key)), []byte(r.MAC)) && report.Chain == "" {
+			report.Chain = fmt.Sprintf("record %d of transaction %s", i+1, r.ID)
+		}
+		previous = r.MAC
+		latest[r.ID] = r
+	}
+
+	lines, err := b.serverLines()
+	if err != nil {
+		return nil, err
+	}
+	history, _ := b.transactionLines(historyTxt)
+	deleted := make(map[string]bool)
+	for _, line := range history {
+		if ss := strings.Split(line, ","); len(ss) >= 3 && ss[1] == "del" {
+			deleted[ss[2]] = true
+		}
+	}
+
+	for id, line := range lines {
+		r := latest[id]
+		switch {
+		case r == nil:
+			report.Unsigned = append(report.Unsigned, id)
+		case r.Kind != signAdd || r.LineSum != sha256Hex(line):
+			report.Tampered = append(report.Tampered, id+": server.txt line changed")
+		}
+	}
+	for id, r := range latest {
+		if r.Kind == signAdd && lines[id] == "" && !deleted[id] {
+			report.Tampered = append(report.Tampered, id+": removed from server.txt")
+			continue
+		}
+		sum, err := fileSHA256(b.signedFile(r.Kind, id))
+		switch {
+		case err != nil:
+			report.Tampered = append(report.Tampered, id+": transaction file missing")
+		case sum != r.FileSum:
+			report.Tampered = append(report.Tampered, id+": transaction file changed")
+		default:
+			report.Signed++
+		}
+	}
+	sort.Strings(report.Unsigned)
+	sort.Strings(report.Tampered)
+	if !report.OK() {
+		log.Warn("[Branch] Verify %s: %d tampered, chain %q.", b.Name(), len(report.Tampered), report.Chain)
+		b.publish(event.KindVerifyFailed, "", nil, fmt.Sprintf("%d tampered, chain %q", len(report.Tampered), report.Chain))
+	}
+	return report, nil
+}
@@ -0,0 +1,223 @@
+package symbol
+
+import (
+	"container/heap"
+	"fmt"
+	"sort"
+	"strings"
+
+	log "gopkg.in/clog.v1"
+)
+
+const (
+	jobHistory = 500 // finished jobs kept in memory for the jobs api
+)
+
+var (
+	ErrJobNotFound = fmt.Errorf("job not found")
+	ErrJobFinished = fmt.Errorf("job already finished")
+	ErrJobCanceled = fmt.Errorf("ingest job canceled")
+	ErrJobUncancel = fmt.Errorf("job is storing symbols and can't be canceled")
+)
+
+// JobStatus is the state of an ingest job in the queue
+//
+type JobStatus string
+
+// An ingest job is queued until a worker runs it, and may be queued again if its store
+// turns read-only:
+//
+//	queued => running => succeeded | failed | canceled
+//	queued => canceled
+//
+const (
+	JobQueued    JobStatus = "queued"
+	JobRunning   JobStatus = "running"
+	JobSucceeded JobStatus = "succeeded"
+	JobFailed    JobStatus = "failed"
+	JobCanceled  JobStatus = "canceled"
+)
+
+// JobStage is the progress of a running ingest job
+//
+type JobStage string
+
+const (
+	StageCopying   JobStage = "copying"   // copy debug zip from build server
+	StageUnzipping JobStage = "unzipping" // extract and scan symbols
+	StageStoring   JobStage = "storing"   // symstore.exe, the store is modified from here
+	StageVerifying JobStage = "verifying" // checksums, signature status and build records
+)
+
+// Job is an ingest job of one build, tracked from queued to finished.
+//
+type Job struct {
+	ID       string    `json:"id"`
+	Branch   string    `json:"branch"`
+	Version  string    `json:"version"` // empty for the latest build until it's resolved
+	Priority Priority  `json:"priority"`
+	Status   JobStatus `json:"status"`
+	Stage    JobStage  `json:"stage,omitempty"`
+	Message  string    `json:"message,omitempty"`
+	Queued   string    `json:"queued"`
+	Started  string    `json:"started,omitempty"`
+	Finished string    `json:"finished,omitempty"`
+}
+
+// Done check if the job is finished.
+//
+func (j *Job) Done() bool {
+	return j.Status == JobSucceeded || j.Status == JobFailed || j.Status == JobCanceled
+}
+
+// snapshot copy job info, caller hold `mx` of the queue
+func (job *ingestJob) snapshot() *Job {
+	info := *job.info
+	return &info
+}
+
+// track register a new job, caller hold `mx`
+func (q *jobQueue) track(job *ingestJob) {
+	job.info = &Job{
+		ID:       randomID(5),
+		Branch:   job.builder.Name(),
+		Version:  job.version,
+		Priority: job.priority,
+		Status:   JobQueued,
+		Queued:   timestamp(now()),
+	}
+	job.finished = make(chan struct{})
+	q.jobs[job.info.ID] = job
+}
+
+// start mark job running, caller hold `mx`
+func (q *jobQueue) start(job *ingestJob) {
+	job.info.Status, job.info.Stage, job.info.Message = JobRunning, "", ""
+	job.info.Started = timestamp(now())
+}
+
+// progress move running `job` to `stage` of building `version`. ErrJobCanceled if it's
+// canceled, which is only allowed before the store is modified.
+func (q *jobQueue) progress(job *ingestJob, version string, stage JobStage) error {
+	q.mx.Lock()
+	defer q.mx.Unlock()
+	if job.cancel {
+		return ErrJobCanceled
+	}
+	job.info.Version, job.info.Stage = version, stage
+	return nil
+}
+
+// finish record result of `job`, it's queued again if paused for a read-only store.
+func (q *jobQueue) finish(job *ingestJob, err error) {
+	q.mx.Lock()
+	defer q.mx.Unlock()
+	info := job.info
+	switch {
+	case q.queued[job.key()] == job:
+		info.Status, info.Stage, info.Message = JobQueued, "", err.Error()
+		return
+	case err == nil:
+		info.Status = JobSucceeded
+	case err == ErrJobCanceled:
+		info.Status, info.Message = JobCanceled, err.Error()
+	default:
+		info.Status, info.Message = JobFailed, err.Error()
+	}
+	info.Finished = timestamp(now())
+	q.retire(job)
+}
+
+// retire keep finished `job` in history, the oldest are dropped. Caller hold `mx`.
+func (q *jobQueue) retire(job *ingestJob) {
+	close(job.finished)
+	q.history = append(q.history, job.info.ID)
+	if len(q.history) > jobHistory {
+		delete(q.jobs, q.history[0])
+		q.history = q.history[1:]
+	}
+}
+
+// wait block until job `id` is finished or `stop` is closed, return its last state. Nil
+// if the job is not tracked.
+func (q *jobQueue) wait(id string, stop <-chan struct{}) *Job {
+	q.mx.Lock()
+	job, ok := q.jobs[id]
+	q.mx.Unlock()
+	if !ok {
+		return nil
+	}
+	select {
+	case <-job.finished:
+	case <-stop:
+	}
+	q.mx.Lock()
+	defer q.mx.Unlock()
+	return job.snapshot()
+}
+
+// Job return ingest job `id`, nil if not exist.
+//
+func (q *jobQueue) Job(id string) *Job {
+	q.mx.Lock()
+	defer q.mx.Unlock()
+	if job, ok := q.jobs[id]; ok {
+		return job.snapshot()
+	}
+	return nil
+}
+
+// List return jobs of `branch` with `status` if not empty, unfinished first and then the
+// newest.
+//
+func (q *jobQueue) List(branch string, status JobStatus) []*Job {
+	q.mx.Lock()
+	arr := make([]*Job, 0, len(q.jobs))
+	for _, job := range q.jobs {
+		if branch != "" && !strings.EqualFold(branch, job.info.Branch) {
+			continue
+		}
+		if status == "" || job.info.Status == status {
+			arr = append(arr, job.snapshot())
+		}
+	}
+	q.mx.Unlock()
+	sort.Slice(arr, func(i, j int) bool {
+		if arr[i].Done() != arr[j].Done() {
+			return !arr[i].Done()
+		}
+		return arr[i].Queued > arr[j].Queued
+	})
+	return arr
+}
+
+// Cancel remove queued job `id`, or stop running one before it modifies the store. A
+// running job is aborted, even in the middle of copying, the returned job is still running.
+//
+func (q *jobQueue) Cancel(id string) (*Job, error) {
+	q.mx.Lock()
+	defer q.mx.Unlock()
+	job, ok := q.jobs[id]
+	if !ok {
+		return nil, ErrJobNotFound
+	}
+	switch info := job.info; {
+	case info.Done():
+		return job.snapshot(), ErrJobFinished
+	case info.Status == JobRunning && (info.Stage == StageStoring || info.Stage == StageVerifying):
+		return job.snapshot(), ErrJobUncancel
+	case info.Status == JobRunning:
+		job.cancel = true
+		if job.abort != nil {
+			job.abort()
+		}
+	default:
+		heap.Remove(&q.pending, job.index)
+		delete(q.queued, job.key())
+		info.Status, info.Message = JobCanceled, ErrJobCanceled.Error()
+		info.Finished = timestamp(now())
+		q.retire(job)
+	}
+	log.Info("[Queue] Cancel job %s of %s.", id, job.key())
+	return job.snapshot(), nil
+}
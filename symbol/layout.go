@@ -0,0 +1,263 @@
+package symbol
+
+import (
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"strings"
+	"sync/atomic"
+	"time"
+
+	"github.com/adyzng/GoSymbols/config"
+	log "gopkg.in/clog.v1"
+)
+
+const (
+	index2Txt    = "index2.txt"    // symstore.exe store files under `{2 chars}/{name}/{hash}/` if it exist in store root
+	migratingTxt = "migrating.txt" // exist in 000Admin while MigrateLayout is moving folders
+
+	LayoutFlat    = 1 // {name}/{hash}/{name}, default of symstore.exe
+	LayoutTwoTier = 2 // {na}/{name}/{hash}/{name}, for huge stores
+)
+
+// MigrateReport is the result of converting a store to two-tier layout
+//
+type MigrateReport struct {
+	Branch   string   `json:"branch"`
+	Moved    int      `json:"moved"`             // symbol folders moved under their tier folder
+	Skipped  []string `json:"skipped,omitempty"` // top level folders not look like symbol folder
+	DryRun   bool     `json:"dryRun"`
+	Duration string   `json:"duration,omitempty"`
+}
+
+// tierDir return the tier folder of symbol file `name`, the first 2 chars
+func tierDir(name string) string {
+	if len(name) < 2 {
+		return name
+	}
+	return name[:2]
+}
+
+// twoTier check if symbols are stored in two-tier layout
+func (b *BrBuilder) twoTier() bool {
+	return b.Layout == LayoutTwoTier
+}
+
+// symbolDir return the folder of symbol `name` with `hash`, it hold the file,
+// compressed file, file.ptr and refs.ptr
+func (b *BrBuilder) symbolDir(name, hash string) string {
+	if b.twoTier() {
+		dir := filepath.Join(b.StorePath, tierDir(name), name, hash)
+		if atomic.LoadInt32(&b.migrating) == 0 {
+			return dir
+		}
+		// not moved yet while migrating
+		if _, err := os.Stat(dir); err != nil {
+			return filepath.Join(b.StorePath, name, hash)
+		}
+		return dir
+	}
+	return filepath.Join(b.StorePath, name, hash)
+}
+
+// symbolRel return slash separated folder of symbol relative to store
+func (b *BrBuilder) symbolRel(name, hash string) string {
+	if b.twoTier() {
+		return tierDir(name) + "/" + name + "/" + hash
+	}
+	return name + "/" + hash
+}
+
+// detectLayout adopt the layout actually used by an existing store, index2.txt win over
+// the saved branch config since the store may be converted by symstore.exe or other tools.
+// A store left by an interrupted migration hold both layouts, symbols are looked up in both.
+func (b *BrBuilder) detectLayout() {
+	layout, migrating := b.storeLayout()
+	switch {
+	case migrating:
+		log.Warn("[Branch] Migration of %s to two-tier layout not finished, run `migrate-layout` again.", b.Name())
+	case layout == LayoutTwoTier && b.Layout != LayoutTwoTier:
+		log.Info("[Branch] Detect %s in %s, use two-tier layout.", index2Txt, b.Name())
+	}
+	if layout != 0 {
+		b.Layout = layout
+	}
+	if migrating {
+		atomic.StoreInt32(&b.migrating, 1)
+	} else {
+		atomic.StoreInt32(&b.migrating, 0)
+	}
+}
+
+// storeLayout return the layout used by files of the store, 0 for a new store, and
+// whether a migration is not finished.
+func (b *BrBuilder) storeLayout() (int, bool) {
+	if _, err := os.Stat(filepath.Join(b.StorePath, adminDir, migratingTxt)); err == nil {
+		return LayoutTwoTier, true
+	}
+	if _, err := os.Stat(filepath.Join(b.StorePath, index2Txt)); err == nil {
+		return LayoutTwoTier, false
+	}
+	if _, err := os.Stat(filepath.Join(b.StorePath, adminDir, lastidTxt)); err == nil {
+		return LayoutFlat, false
+	}
+	return 0, false
+}
+
+// refreshLayout detect the layout again once a symbol is not found, the store may be
+// migrated by another process, eg: `migrate-layout` or symstore.exe. True if changed.
+func (b *BrBuilder) refreshLayout() bool {
+	layout, migrating := b.storeLayout()
+	if layout == 0 || (layout == b.Layout && migrating == (atomic.LoadInt32(&b.migrating) == 1)) {
+		return false
+	}
+	b.mx.Lock()
+	b.detectLayout()
+	b.mx.Unlock()
+	log.Info("[Branch] Layout of %s changed by another process, reload it.", b.Name())
+	return true
+}
+
+// prepareLayout decide layout of an empty store before the first transaction is added,
+// by config.StoreLayout, and create index2.txt so symstore.exe use the same layout.
+func (b *BrBuilder) prepareLayout() error {
+	if b.Layout == 0 {
+		if _, err := os.Stat(filepath.Join(b.StorePath, adminDir, lastidTxt)); err == nil {
+			// existing store, keep what symstore.exe already used
+			b.Layout = LayoutFlat
+		} else {
+			b.Layout = config.StoreLayout
+		}
+	}
+	if !b.twoTier() {
+		return nil
+	}
+	fpath := filepath.Join(b.StorePath, index2Txt)
+	if _, err := os.Stat(fpath); err == nil {
+		return nil
+	}
+	log.Info("[Branch] Create %s for two-tier layout of %s.", index2Txt, b.Name())
+	return ioutil.WriteFile(fpath, nil, 0644)
+}
+
+// isSpecialDir check top level folders which are not symbol folders
+func isSpecialDir(name string) bool {
+	return strings.HasPrefix(name, "000")
+}
+
+// MigrateLayout convert a flat store to two-tier layout in place. Each top level
+// symbol folder is renamed into its tier folder, checksums.txt is rewritten with
+// the new paths, and index2.txt is created after all folders are moved. This process
+// keeps serving symbols from both layouts during migration, other processes serving
+// the store detect the layout again when a symbol is not found. An interrupted
+// migration can be run again.
+//
+func (b *BrBuilder) MigrateLayout(dryRun bool) (*MigrateReport, error) {
+	b.ingMx.Lock()
+	defer b.ingMx.Unlock()
+	if err := b.writable(); err != nil {
+		return nil, err
+	}
+
+	report := &MigrateReport{Branch: b.Name(), DryRun: dryRun}
+	if b.twoTier() && atomic.LoadInt32(&b.migrating) == 0 {
+		log.Info("[Branch] Branch %s already in two-tier layout.", b.Name())
+		return report, nil
+	}
+	fs, err := ioutil.ReadDir(b.StorePath)
+	if err != nil {
+		return nil, err
+	}
+
+	var names []string
+	for _, f := range fs {
+		switch {
+		case !f.IsDir():
+		case isSpecialDir(f.Name()):
+		case len(f.Name()) <= 2:
+			// tier folder of an interrupted migration, symbol names always have extension
+		case strings.IndexByte(f.Name(), '.') == -1:
+			report.Skipped = append(report.Skipped, f.Name())
+		default:
+			names = append(names, f.Name())
+		}
+	}
+	if dryRun {
+		report.Moved = len(names)
+		return report, nil
+	}
+
+	defer beginWrite()()
+	start := time.Now()
+	marker := filepath.Join(b.StorePath, adminDir, migratingTxt)
+	if err = ioutil.WriteFile(marker, []byte(start.Format(TimeFormat)), 0644); err != nil {
+		return nil, err
+	}
+	b.mx.Lock()
+	b.Layout = LayoutTwoTier
+	b.mx.Unlock()
+	// keep looking up both layouts until all folders moved
+	atomic.StoreInt32(&b.migrating, 1)
+
+	for _, name := range names {
+		tier := filepath.Join(b.StorePath, tierDir(name))
+		if err = os.MkdirAll(tier, 0755); err != nil {
+			return report, err
+		}
+		if err = os.Rename(filepath.Join(b.StorePath, name), filepath.Join(tier, name)); err != nil {
+			log.Error(2, "[Branch] Move %s into %s failed: %v.", name, tier, err)
+			return report, err
+		}
+		report.Moved++
+	}
+	if err = b.migrateChecksums(); err != nil {
+		return report, err
+	}
+	if err = b.prepareLayout(); err != nil {
+		return report, err
+	}
+	os.Remove(marker)
+	atomic.StoreInt32(&b.migrating, 0)
+	report.Duration = time.Since(start).String()
+	log.Info("[Branch] Migrate %s to two-tier layout, %d folders moved in %s.", b.Name(), report.Moved, report.Duration)
+	return report, b.Persist()
+}
+
+// MigrateLayout convert store of branch `storeName` to two-tier layout in the server
+// process, see BrBuilder.MigrateLayout. Branches are saved with the new layout.
+//
+func (ss *sserver) MigrateLayout(storeName string, dryRun bool) (*MigrateReport, error) {
+	b, ok := ss.Get(storeName).(*BrBuilder)
+	if !ok {
+		return nil, ErrBranchNotInit
+	}
+	report, err := b.MigrateLayout(dryRun)
+	if err != nil || dryRun {
+		return report, err
+	}
+	return report, ss.SaveBranchs("")
+}
+
+// migrateChecksums prefix tier folder to the relative paths in checksums.txt
+func (b *BrBuilder) migrateChecksums() error {
+	b.sumMx.Lock()
+	defer b.sumMx.Unlock()
+	b.sums = nil
+	b.loadChecksums()
+	if len(b.sums) == 0 {
+		return nil
+	}
+
+	sums := make(map[string]string, len(b.sums))
+	var buf []byte
+	for rel, sum := range b.sums {
+		ss := strings.Split(rel, "/")
+		if len(ss[0]) > 2 && !isSpecialDir(ss[0]) {
+			rel = tierDir(ss[0]) + "/" + rel
+		}
+		sums[rel] = sum
+		buf = append(buf, rel+","+sum+"\r\n"...)
+	}
+	b.sums = sums
+	return writeFileAtomic(filepath.Join(b.StorePath, adminDir, checksumTxt), buf)
+}
@@ -0,0 +1,117 @@
+package symbol
+
+import (
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+func TestMigrateLayout(t *testing.T) {
+	root, err := ioutil.TempDir("", "layout")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(root)
+
+	admin := filepath.Join(root, adminDir)
+	os.MkdirAll(admin, 0755)
+	ioutil.WriteFile(filepath.Join(admin, "0000000001"), []byte(
+		"\"foo.pdb\\AAAA1\",\"S:\\000Unzip\\x64\\foo.pdb\"\r\n"+
+			"\"bar.dll\\BBBB1\",\"S:\\000Unzip\\x64\\bar.dll\"\r\n"), 0644)
+	ioutil.WriteFile(filepath.Join(admin, serverTxt), []byte(
+		"0000000001,add,file,07/04/2017,14:44:14,\"test\",\"100\",\"\",\r\n"), 0644)
+	ioutil.WriteFile(filepath.Join(admin, lastidTxt), []byte("0000000001"), 0644)
+	for _, rel := range []string{"foo.pdb/AAAA1/foo.pdb", "bar.dll/BBBB1/bar.dll"} {
+		fpath := filepath.Join(root, filepath.FromSlash(rel))
+		os.MkdirAll(filepath.Dir(fpath), 0755)
+		ioutil.WriteFile(fpath, []byte(rel), 0644)
+	}
+
+	b := NewBranch2(&Branch{StoreName: "test", StorePath: root, BuildPath: root}).(*BrBuilder)
+	// another process serving the same store, eg: the server while the cli migrates
+	other := NewBranch2(&Branch{StoreName: "test", StorePath: root, BuildPath: root}).(*BrBuilder)
+	if err = b.recordChecksums("0000000001"); err != nil {
+		t.Fatal(err)
+	}
+	if report, err := b.MigrateLayout(true); err != nil || report.Moved != 2 {
+		t.Fatalf("expect 2 folders to move, got %+v (%v)", report, err)
+	}
+	if _, err = os.Stat(filepath.Join(root, "foo.pdb")); err != nil {
+		t.Fatal("dry run should not move folders")
+	}
+
+	report, err := b.MigrateLayout(false)
+	if err != nil || report.Moved != 2 {
+		t.Fatalf("expect 2 folders moved, got %+v (%v)", report, err)
+	}
+	if _, err = os.Stat(filepath.Join(root, index2Txt)); err != nil {
+		t.Fatalf("expect %s created: %v", index2Txt, err)
+	}
+	fpath := b.GetSymbolPath("AAAA1", "foo.pdb")
+	if fpath != filepath.Join(root, "fo", "foo.pdb", "AAAA1", "foo.pdb") {
+		t.Fatalf("unexpected two-tier path %s", fpath)
+	}
+	if _, err = os.Stat(fpath); err != nil {
+		t.Fatal(err)
+	}
+	if got := other.GetSymbolPath("AAAA1", "foo.pdb"); got != fpath || !other.twoTier() {
+		t.Fatalf("expect layout detected again on miss, got %s", got)
+	}
+
+	// checksums follow the moved files
+	b.sums = nil
+	sum, _ := fileSHA256(fpath)
+	b.sumMx.Lock()
+	b.loadChecksums()
+	got := b.sums[b.relPath(fpath)]
+	b.sumMx.Unlock()
+	if got != sum {
+		t.Fatalf("expect checksum of %s migrated, got %q", b.relPath(fpath), got)
+	}
+	if _, size, _ := b.TransactionSize("0000000001"); size == 0 {
+		t.Fatal("expect transaction size from two-tier folders")
+	}
+
+	if report, err = b.MigrateLayout(false); err != nil || report.Moved != 0 {
+		t.Fatalf("expect nothing to migrate again, got %+v (%v)", report, err)
+	}
+}
+
+func TestDetectLayout(t *testing.T) {
+	root, err := ioutil.TempDir("", "layout")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(root)
+
+	admin := filepath.Join(root, adminDir)
+	os.MkdirAll(admin, 0755)
+	ioutil.WriteFile(filepath.Join(admin, lastidTxt), []byte("0000000001"), 0644)
+	branch := &Branch{StoreName: "test", StorePath: root, BuildPath: root, Layout: LayoutTwoTier}
+	if b := NewBranch2(branch).(*BrBuilder); b.Layout != LayoutFlat {
+		t.Fatalf("expect flat layout without %s, got %d", index2Txt, b.Layout)
+	}
+
+	ioutil.WriteFile(filepath.Join(root, index2Txt), nil, 0644)
+	branch.Layout = 0
+	b := NewBranch2(branch).(*BrBuilder)
+	if b.Layout != LayoutTwoTier || b.GetSymbolPath("AAAA1", "foo.pdb") != filepath.Join(root, "fo", "foo.pdb", "AAAA1", "foo.pdb") {
+		t.Fatalf("expect two-tier layout detected, got %d", b.Layout)
+	}
+
+	// interrupted migration, folders not moved yet are still served
+	os.Remove(filepath.Join(root, index2Txt))
+	ioutil.WriteFile(filepath.Join(admin, migratingTxt), nil, 0644)
+	os.MkdirAll(filepath.Join(root, "bar.pdb", "BBBB1"), 0755)
+	b = NewBranch2(branch).(*BrBuilder)
+	if fpath := b.GetSymbolPath("BBBB1", "bar.pdb"); fpath != filepath.Join(root, "bar.pdb", "BBBB1", "bar.pdb") {
+		t.Fatalf("expect flat folder served while migrating, got %s", fpath)
+	}
+	if report, err := b.MigrateLayout(false); err != nil || report.Moved != 1 {
+		t.Fatalf("expect migration resumed, got %+v (%v)", report, err)
+	}
+	if _, err = os.Stat(filepath.Join(admin, migratingTxt)); !os.IsNotExist(err) {
+		t.Fatal("expect migration marker removed")
+	}
+}
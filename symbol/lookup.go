@@ -0,0 +1,83 @@
+package symbol
+
+import (
+	"fmt"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"strings"
+)
+
+// SymbolFile is an symbol file found in the store by key
+//
+type SymbolFile struct {
+	Builder Builder
+	Path    string
+	Info    os.FileInfo
+}
+
+// ETag of the stored file, content is addressed by hash so it only change when re-published.
+func (f *SymbolFile) ETag(hash string) string {
+	return fmt.Sprintf("\"%s-%x-%x\"", hash, f.Info.Size(), f.Info.ModTime().Unix())
+}
+
+// FindSymbol search all branches for given {name, hash}, return nil if not exist.
+//
+func (ss *sserver) FindSymbol(name, hash string) *SymbolFile {
+	// branches holding the hash by the metadata database first
+	refs, _ := ss.FindHash(hash)
+	for _, ref := range refs {
+		if b := ss.Get(ref.Branch); b != nil && strings.EqualFold(ref.Name, name) {
+			fpath := b.GetSymbolPath(hash, name)
+			if st, err := os.Stat(fpath); err == nil && !st.IsDir() {
+				return &SymbolFile{Builder: b, Path: fpath, Info: st}
+			}
+		}
+	}
+
+	var found *SymbolFile
+	ss.WalkBuilders(func(b Builder) error {
+		fpath := b.GetSymbolPath(hash, name)
+		if st, err := os.Stat(fpath); err == nil && !st.IsDir() {
+			found = &SymbolFile{
+				Builder: b,
+				Path:    fpath,
+				Info:    st,
+			}
+			return errFound
+		}
+		return nil
+	})
+	return found
+}
+
+var (
+	ErrPointer = fmt.Errorf("invalid file.ptr, expect PATH: or MSG:")
+
+	errFound = fmt.Errorf("found")
+)
+
+// ReadPointer parse file.ptr written by `symstore.exe add /p`, it hold either the path of
+// the file kept out of store `PATH:\\server\share\foo.pdb`, or a message for the debugger
+// `MSG:text`.
+//
+func ReadPointer(fpath string) (target, msg string, err error) {
+	data, err := ioutil.ReadFile(fpath)
+	if err != nil {
+		return "", "", err
+	}
+	ptr := strings.TrimSpace(string(data))
+	switch {
+	case strings.HasPrefix(strings.ToUpper(ptr), "PATH:"):
+		return ptr[len("PATH:"):], "", nil
+	case strings.HasPrefix(strings.ToUpper(ptr), "MSG:"):
+		return "", ptr[len("MSG:"):], nil
+	}
+	return "", "", ErrPointer
+}
+
+// PointerPath return path of file.ptr of symbol `name` with `hash` in branch `b`.
+//
+func PointerPath(b Builder, hash, name string) string {
+	return filepath.Join(filepath.Dir(b.GetSymbolPath(hash, name)), filePtr)
+}
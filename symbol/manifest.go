@@ -0,0 +1,159 @@
+package symbol
+
+import (
+	"bufio"
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"io"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+
+	log "gopkg.in/clog.v1"
+)
+
+const (
+	historyTxt = "history.txt" // transaction history generated by symstore.exe
+)
+
+// ManifestFile is one file to replicate, path is relative to the branch store
+//
+type ManifestFile struct {
+	Path        string `json:"path"`
+	Size        int64  `json:"size"`
+	SHA256      string `json:"sha256,omitempty"`
+	Transaction string `json:"transaction,omitempty"`
+	Version     string `json:"version,omitempty"`  // build version of the transaction
+	BuildKey    string `json:"buildKey,omitempty"` // unique key of the transaction, see BuildKey
+}
+
+// SyncManifest list files added after transaction `Since`, until `LastID`.
+//
+type SyncManifest struct {
+	Branch string          `json:"branch"`
+	Store  string          `json:"store"`
+	Since  string          `json:"since"`
+	LastID string          `json:"lastID"`
+	Files  []*ManifestFile `json:"files"`
+}
+
+// transactionKeys read `name\hash` keys from transaction file 000Admin/{ID}
+func (b *BrBuilder) transactionKeys(id string) ([]string, error) {
+	fd, err := b.StoreFS().Open(adminName(id))
+	if err != nil {
+		return nil, err
+	}
+	defer fd.Close()
+
+	var keys []string
+	scan := bufio.NewScanner(fd)
+	for scan.Scan() {
+		ss := strings.Split(scan.Text(), ",")
+		key := strings.Trim(ss[0], "\"")
+		if strings.Count(key, "\\") != 1 {
+			continue
+		}
+		keys = append(keys, key)
+	}
+	return keys, scan.Err()
+}
+
+func fileSHA256(fpath string) (string, error) {
+	fd, err := os.Open(fpath)
+	if err != nil {
+		return "", err
+	}
+	defer fd.Close()
+	h := sha256.New()
+	if _, err = io.Copy(h, fd); err != nil {
+		return "", err
+	}
+	return hex.EncodeToString(h.Sum(nil)), nil
+}
+
+// SyncManifest list all files added by transactions after `since` (empty for all),
+// include the admin files, so replication only copy the delta.
+//
+func (b *BrBuilder) SyncManifest(since string, withHash bool) (*SyncManifest, error) {
+	if _, err := b.ParseBuilds(context.Background(), nil); err != nil {
+		return nil, err
+	}
+
+	var ids []string
+	b.mx.RLock()
+	for id := range b.builds {
+		if id > since {
+			ids = append(ids, id)
+		}
+	}
+	b.mx.RUnlock()
+	sort.Strings(ids)
+
+	m := &SyncManifest{
+		Branch: b.Name(),
+		Store:  b.StoreName,
+		Since:  since,
+		LastID: b.GetLatestID(),
+		Files:  make([]*ManifestFile, 0, len(ids)*8),
+	}
+	seen := make(map[string]bool)
+	add := func(rel, tx string) {
+		if seen[rel] {
+			return
+		}
+		fpath := filepath.Join(b.StorePath, filepath.FromSlash(rel))
+		st, err := os.Stat(fpath)
+		if err != nil || st.IsDir() {
+			return
+		}
+		seen[rel] = true
+		mf := &ManifestFile{
+			Path:        rel,
+			Size:        st.Size(),
+			Transaction: tx,
+		}
+		if tx != "" {
+			mf.BuildKey = BuildKey(b.StoreName, tx)
+			if build := b.getBuild("", tx); build != nil {
+				mf.Version = build.Version
+			}
+		}
+		if withHash {
+			// admin files change in place, symbol files use the checksum recorded at ingest
+			hash := b.Checksum
+			if strings.HasPrefix(rel, adminDir+"/") {
+				hash = fileSHA256
+			}
+			if mf.SHA256, err = hash(fpath); err != nil {
+				log.Warn("[Branch] Hash file %s failed: %v.", fpath, err)
+			}
+		}
+		m.Files = append(m.Files, mf)
+	}
+
+	for _, id := range ids {
+		keys, err := b.transactionKeys(id)
+		if err != nil {
+			log.Warn("[Branch] Read transaction %s failed: %v.", id, err)
+			continue
+		}
+		for _, key := range keys {
+			// name/hash/ may hold the file, compressed file, file.ptr and refs.ptr
+			ss := strings.Split(key, "\\")
+			dir := b.symbolRel(ss[0], ss[1])
+			fs, _ := ioutil.ReadDir(b.symbolDir(ss[0], ss[1]))
+			for _, f := range fs {
+				add(dir+"/"+f.Name(), id)
+			}
+		}
+		add(adminDir+"/"+id, id)
+	}
+	for _, name := range []string{serverTxt, historyTxt, lastidTxt, checksumTxt, b.branchName(integrityTxt)} {
+		add(adminDir+"/"+name, "")
+	}
+	add(index2Txt, "")
+	return m, nil
+}
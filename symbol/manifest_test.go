@@ -0,0 +1,82 @@
+package symbol
+
+import (
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+func TestSyncManifest(t *testing.T) {
+	root, err := ioutil.TempDir("", "manifest")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(root)
+
+	admin := filepath.Join(root, adminDir)
+	os.MkdirAll(admin, 0755)
+	ioutil.WriteFile(filepath.Join(admin, "0000000001"), []byte(
+		"\"foo.pdb\\AAAA1\",\"S:\\000Unzip\\x64\\foo.pdb\"\r\n"), 0644)
+	ioutil.WriteFile(filepath.Join(admin, "0000000002"), []byte(
+		"\"bar.pdb\\BBBB1\",\"S:\\000Unzip\\x64\\bar.pdb\"\r\n"), 0644)
+	ioutil.WriteFile(filepath.Join(admin, lastidTxt), []byte("0000000002"), 0644)
+	ioutil.WriteFile(filepath.Join(admin, serverTxt), []byte("x"), 0644)
+	for _, p := range []string{"foo.pdb/AAAA1/foo.pdb", "bar.pdb/BBBB1/bar.pd_"} {
+		fpath := filepath.Join(root, filepath.FromSlash(p))
+		os.MkdirAll(filepath.Dir(fpath), 0755)
+		ioutil.WriteFile(fpath, []byte("abc"), 0644)
+	}
+
+	b := NewBranch2(&Branch{StoreName: "test", StorePath: root, BuildPath: root}).(*BrBuilder)
+	b.addBuild(&Build{ID: "0000000001", Version: "100"})
+	b.addBuild(&Build{ID: "0000000002", Version: "101"})
+
+	m, err := b.SyncManifest("0000000001", true)
+	if err != nil {
+		t.Fatal(err)
+	}
+	files := make(map[string]*ManifestFile)
+	for _, f := range m.Files {
+		files[f.Path] = f
+	}
+	if len(files) != 5 || m.LastID != "0000000002" {
+		t.Fatalf("unexpected manifest %+v", m)
+	}
+	f := files["bar.pdb/BBBB1/bar.pd_"]
+	if f == nil || f.Size != 3 || f.Transaction != "0000000002" ||
+		f.SHA256 != "ba7816bf8f01cfea414140de5dae2223b00361a396177a9cb410ff61f20015ad" {
+		t.Fatalf("unexpected file %+v", f)
+	}
+	if files["000Admin/0000000002"] == nil || files["000Admin/server.txt"] == nil {
+		t.Fatalf("missing admin files %v", files)
+	}
+}
+
+func TestChecksumRecorded(t *testing.T) {
+	root, err := ioutil.TempDir("", "checksum")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(root)
+
+	os.MkdirAll(filepath.Join(root, adminDir), 0755)
+	ioutil.WriteFile(filepath.Join(root, adminDir, "0000000001"), []byte(
+		"\"foo.pdb\\AAAA1\",\"S:\\000Unzip\\x64\\foo.pdb\"\r\n"), 0644)
+	fpath := filepath.Join(root, "foo.pdb", "AAAA1", "foo.pdb")
+	os.MkdirAll(filepath.Dir(fpath), 0755)
+	ioutil.WriteFile(fpath, []byte("abc"), 0644)
+
+	b := NewBranch2(&Branch{StoreName: "test", StorePath: root, BuildPath: root}).(*BrBuilder)
+	if err := b.recordChecksums("0000000001"); err != nil {
+		t.Fatal(err)
+	}
+
+	// later corruption on disk is detected against the recorded checksum
+	ioutil.WriteFile(fpath, []byte("abd"), 0644)
+	b2 := NewBranch2(&Branch{StoreName: "test", StorePath: root, BuildPath: root}).(*BrBuilder)
+	sum, err := b2.Checksum(fpath)
+	if err != nil || sum != "ba7816bf8f01cfea414140de5dae2223b00361a396177a9cb410ff61f20015ad" {
+		t.Fatalf("expect recorded checksum, got %s (%v)", sum, err)
+	}
+}
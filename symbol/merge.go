@@ -0,0 +1,590 @@
+package symbol
+
+import (
+	"context"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+	"time"
+
+	"github.com/adyzng/GoSymbols/audit"
+	log "gopkg.in/clog.v1"
+)
+
+const (
+	mergingDir = "merging"  // symbol folders staged by MergeBranch in 000Admin, removed once merged
+	refsPtr    = "refs.ptr" // transactions referencing files of a symbol folder, `{ID},{file|ptr},...`
+)
+
+var (
+	ErrMergeSelf     = fmt.Errorf("can't merge branch into itself")
+	ErrMergeConflict = fmt.Errorf("builds of the same version differ in both branches")
+)
+
+// DuplicateGroup is local branches whose build sources are the same folder
+//
+type DuplicateGroup struct {
+	BuildPath string   `json:"buildPath"`
+	Branches  []string `json:"branches"`
+}
+
+// MergeReport is the result of merging branch `From` into `Into`. Duplicates are versions
+// with the same symbols in both branches, Conflicts the versions with different symbols.
+//
+type MergeReport struct {
+	From         string            `json:"from"`
+	Into         string            `json:"into"`
+	Builds       int               `json:"builds"`      // builds added to target
+	Supplements  int               `json:"supplements"` // supplementary transactions added to target
+	Folders      int               `json:"folders"`     // symbol folders copied
+	Duplicates   []string          `json:"duplicates,omitempty"`
+	Conflicts    []*MergeConflict  `json:"conflicts,omitempty"`
+	Transactions map[string]string `json:"transactions"` // source ID => target ID
+	DryRun       bool              `json:"dryRun"`
+}
+
+// MergeConflict is a build version in both branches referencing different symbols
+//
+type MergeConflict struct {
+	Version string `json:"version"`
+	From    string `json:"from"` // build ID in source branch
+	Into    string `json:"into"` // build ID in target branch
+}
+
+// FindDuplicates group local branches by build path, only groups with more than one
+// branch are returned.
+//
+func (ss *sserver) FindDuplicates() []*DuplicateGroup {
+	groups := make(map[string]*DuplicateGroup)
+	ss.WalkBuilders(func(bu Builder) error {
+		br := bu.GetBranch()
+		if br.BuildPath == "" || br.Archive != "" {
+			return nil
+		}
+		key := strings.ToLower(filepath.Clean(br.BuildPath))
+		g, ok := groups[key]
+		if !ok {
+			g = &DuplicateGroup{BuildPath: br.BuildPath}
+			groups[key] = g
+		}
+		g.Branches = append(g.Branches, br.StoreName)
+		return nil
+	})
+
+	var arr []*DuplicateGroup
+	for _, g := range groups {
+		if len(g.Branches) > 1 {
+			sort.Strings(g.Branches)
+			arr = append(arr, g)
+		}
+	}
+	sort.Slice(arr, func(i, j int) bool {
+		return arr[i].Branches[0] < arr[j].Branches[0]
+	})
+	return arr
+}
+
+// MergeBranch consolidate builds of branch `from` into branch `into`. Each transaction of
+// `from` is re-keyed after the last ID of `into`. Builds whose version already exist in
+// `into` with the same symbols are duplicates, their supplements are attached to the
+// existing build. A version with different symbols in both branches is a conflict, nothing
+// is merged until one of them is removed. The merge is staged first and moved into the store
+// at once, undone on failure. Branch `from` is removed from the server, its store folder is
+// kept on disk.
+//
+func (ss *sserver) MergeBranch(from, into, user string, dryRun bool) (*MergeReport, error) {
+	src, ok1 := ss.Get(from).(*BrBuilder)
+	dst, ok2 := ss.Get(into).(*BrBuilder)
+	if !ok1 || !ok2 {
+		return nil, ErrBranchNotInit
+	}
+	if src == dst {
+		return nil, ErrMergeSelf
+	}
+
+	// lock in name order, so two merges in opposite directions never deadlock
+	first, second := src, dst
+	if strings.ToLower(dst.Name()) < strings.ToLower(src.Name()) {
+		first, second = dst, src
+	}
+	first.ingMx.Lock()
+	defer first.ingMx.Unlock()
+	second.ingMx.Lock()
+	defer second.ingMx.Unlock()
+	if src.Sealed != nil || dst.Sealed != nil {
+		return nil, ErrSealed
+	}
+
+	if _, err := src.ParseBuilds(context.Background(), nil); err != nil {
+		return nil, err
+	}
+	if _, err := dst.ParseBuilds(context.Background(), nil); err != nil {
+		return nil, err
+	}
+
+	src.mx.RLock()
+	builds := make([]*Build, 0, len(src.builds))
+	for _, build := range src.builds {
+		builds = append(builds, build)
+	}
+	src.mx.RUnlock()
+	sort.Slice(builds, func(i, j int) bool {
+		return builds[i].ID < builds[j].ID
+	})
+
+	report := &MergeReport{
+		From:         src.Name(),
+		Into:         dst.Name(),
+		Transactions: make(map[string]string),
+		DryRun:       dryRun,
+	}
+	unlock, err := lockAdmin(dst.StorePath)
+	if err != nil {
+		return report, err
+	}
+	defer unlock()
+	var last uint64
+	fmt.Sscanf(dst.GetLatestID(), "%d", &last)
+	var added []*Build
+	for _, build := range builds {
+		if build.SupplementOf == "" {
+			if exist := dst.getBuild(build.Version, ""); exist != nil {
+				report.Transactions[build.ID] = exist.ID
+				if sameSymbols(src, build.ID, dst, exist.ID) {
+					report.Duplicates = append(report.Duplicates, build.Version)
+				} else {
+					report.Conflicts = append(report.Conflicts, &MergeConflict{
+						Version: build.Version,
+						From:    build.ID,
+						Into:    exist.ID,
+					})
+				}
+				continue
+			}
+			report.Builds++
+		} else {
+			report.Supplements++
+		}
+		last++
+		report.Transactions[build.ID] = fmt.Sprintf("%010d", last)
+		added = append(added, build)
+	}
+	if len(report.Conflicts) != 0 && !dryRun {
+		log.Warn("[Branch] Merge %s into %s refused, %d versions conflict.", src.Name(), dst.Name(), len(report.Conflicts))
+		return report, ErrMergeConflict
+	}
+	if dryRun || len(added) == 0 {
+		return report, nil
+	}
+
+	defer beginWrite()()
+	if err := dst.prepareLayout(); err != nil {
+		return report, err
+	}
+	stage, err := dst.stageMerge(src, added, report.Transactions)
+	if stage != nil {
+		defer os.RemoveAll(stage.root)
+	}
+	if err != nil {
+		log.Error(2, "[Branch] Stage merge of %s into %s failed: %v.", src.Name(), dst.Name(), err)
+		return report, err
+	}
+	report.Folders = len(stage.dirs)
+	if err = stage.commit(src, report.Transactions); err != nil {
+		log.Error(2, "[Branch] Merge %s into %s failed, rollback: %v.", src.Name(), dst.Name(), err)
+		stage.rollback()
+		return report, err
+	}
+
+	ids := make([]string, 0, len(added))
+	for _, build := range added {
+		ids = append(ids, report.Transactions[build.ID])
+	}
+	dst.signOrWarn(signAdd, ids...)
+	dst.mx.Lock()
+	dst.builds = make(map[string]*Build)
+	dst.mx.Unlock()
+	if _, err := dst.ParseBuilds(context.Background(), nil); err != nil {
+		return report, err
+	}
+	for _, id := range ids {
+		if err := dst.recordChecksums(id); err != nil {
+			log.Warn("[Branch] Record checksums of %s failed: %v.", id, err)
+		}
+	}
+
+	ss.Delete(src.Name())
+	if err := ss.SaveBranchs(""); err != nil {
+		log.Warn("[Branch] Save branches failed: %v.", err)
+	}
+	audit.Record(user, "merge", dst.Name(), "merge %d builds and %d supplements of %s (%s), %d duplicates",
+		report.Builds, report.Supplements, src.Name(), src.StorePath, len(report.Duplicates))
+	log.Info("[Branch] Merge %s into %s: %d builds, %d supplements, %d folders.",
+		src.Name(), dst.Name(), report.Builds, report.Supplements, report.Folders)
+	return report, nil
+}
+
+// sameSymbols check transaction `id` of `b` and `other` of `o` reference the same symbol files
+func sameSymbols(b *BrBuilder, id string, o *BrBuilder, other string) bool {
+	keys, err := b.transactionKeys(id)
+	if err != nil {
+		return false
+	}
+	others, err := o.transactionKeys(other)
+	if err != nil || len(keys) != len(others) {
+		return false
+	}
+	set := make(map[string]bool, len(keys))
+	for _, key := range keys {
+		set[strings.ToLower(key)] = true
+	}
+	for _, key := range others {
+		if !set[strings.ToLower(key)] {
+			return false
+		}
+	}
+	return true
+}
+
+// mergeStage is a merge prepared in 000Admin/merging, moved into the store by commit.
+// Every change commit made to the store is undone by rollback.
+type mergeStage struct {
+	dst     *BrBuilder
+	root    string                       // 000Admin/merging
+	dirs    map[string]string            // staged folder => symbol folder in store
+	refs    map[string][]byte            // refs.ptr in store => content with merged transactions
+	txs     map[string][]byte            // new transaction ID => transaction file
+	renames map[string]map[string]string // new transaction ID => renamed files
+	records string                       // lines appended to server.txt and history.txt
+	last    string                       // new lastid.txt
+	saved   map[string][]byte            // store file => content before commit
+	created map[string]bool              // store files not exist before commit
+	moved   []string                     // symbol folders moved into store
+}
+
+// stageMerge copy the symbol folders of `added` transactions of `src` not in the branch into
+// 000Admin/merging, and prepare their admin records re-keyed by `ids`. The store isn't changed.
+// Caller hold `ingMx` of both branches and lockAdmin.
+func (b *BrBuilder) stageMerge(src *BrBuilder, added []*Build, ids map[string]string) (*mergeStage, error) {
+	s := &mergeStage{
+		dst:     b,
+		root:    filepath.Join(b.StorePath, adminDir, mergingDir),
+		dirs:    make(map[string]string),
+		refs:    make(map[string][]byte),
+		txs:     make(map[string][]byte),
+		renames: make(map[string]map[string]string),
+		saved:   make(map[string][]byte),
+		created: make(map[string]bool),
+	}
+	// left by a merge interrupted before
+	if err := os.RemoveAll(s.root); err != nil {
+		return nil, err
+	}
+
+	staged := make(map[string]bool)
+	var records []string
+	for _, build := range added {
+		id := ids[build.ID]
+		lines, err := src.transactionLines(build.ID)
+		if err != nil {
+			return s, err
+		}
+		for _, line := range lines {
+			key := strings.Trim(strings.Split(line, ",")[0], "\"")
+			ss := strings.Split(key, "\\")
+			if len(ss) != 2 {
+				continue
+			}
+			dir := b.symbolDir(ss[0], ss[1])
+			if staged[dir] {
+				continue
+			}
+			staged[dir] = true
+			from := src.symbolDir(ss[0], ss[1])
+			if _, err := os.Stat(dir); err == nil {
+				// shared with a transaction of the branch, only its references are merged
+				refs, err := mergeRefs(dir, from, ids)
+				if err != nil {
+					return s, err
+				}
+				if refs != nil {
+					s.refs[filepath.Join(dir, refsPtr)] = refs
+				}
+				continue
+			}
+			tmp := filepath.Join(s.root, ss[0], ss[1])
+			if err = src.copyDir(from, tmp, ids); err != nil {
+				return s, err
+			}
+			s.dirs[tmp] = dir
+		}
+
+		s.txs[id] = []byte(strings.Join(lines, "\r\n") + "\r\n")
+		s.renames[id] = src.originalNames(build.ID)
+		comment := build.Comment
+		if build.SupplementOf != "" {
+			comment = strings.Replace(comment, supplementTag+build.SupplementOf, supplementTag+ids[build.SupplementOf], 1)
+		}
+		date, err := time.ParseInLocation(TimeFormat, build.Date, time.Local)
+		if err != nil {
+			date = now()
+		}
+		// 0000000001,add,file,07/04/2017,14:44:14,"UDPv6.5U2","4175.2-538","2017/7/4_14:44:14",
+		records = append(records, fmt.Sprintf("%s,add,file,%s,%s,\"%s\",\"%s\",\"%s\",\r\n",
+			id, date.Format("01/02/2006"), date.Format("15:04:05"), b.Name(), build.Version, comment))
+		s.last = id
+	}
+	s.records = strings.Join(records, "")
+	return s, nil
+}
+
+// save keep content of store file `fpath` before commit change it
+func (s *mergeStage) save(fpath string) error {
+	if _, ok := s.saved[fpath]; ok || s.created[fpath] {
+		return nil
+	}
+	data, err := ioutil.ReadFile(fpath)
+	if os.IsNotExist(err) {
+		s.created[fpath] = true
+		return nil
+	}
+	if err != nil {
+		return err
+	}
+	s.saved[fpath] = data
+	return nil
+}
+
+// commit move the staged merge into the store. Caller call rollback on failure.
+func (s *mergeStage) commit(src *BrBuilder, ids map[string]string) error {
+	b := s.dst
+	admin := filepath.Join(b.StorePath, adminDir)
+	files := []string{b.branchFile(ticketsJSON), b.branchFile(validationJSON), b.branchFile(releaseTxt)}
+	for _, name := range []string{serverTxt, historyTxt, lastidTxt, holdsJSON, renamesTxt} {
+		files = append(files, filepath.Join(admin, name))
+	}
+	for id := range s.txs {
+		files = append(files, filepath.Join(admin, id))
+	}
+	for fpath := range s.refs {
+		files = append(files, fpath)
+	}
+	for _, fpath := range files {
+		if err := s.save(fpath); err != nil {
+			return err
+		}
+	}
+
+	for tmp, dir := range s.dirs {
+		if err := os.MkdirAll(filepath.Dir(dir), 0755); err != nil {
+			return err
+		}
+		if err := os.Rename(tmp, dir); err != nil {
+			return err
+		}
+		s.moved = append(s.moved, dir)
+	}
+	for fpath, data := range s.refs {
+		if err := writeFileAtomic(fpath, data); err != nil {
+			return err
+		}
+	}
+	newIDs := make([]string, 0, len(s.txs))
+	for id, data := range s.txs {
+		if err := writeFileAtomic(filepath.Join(admin, id), data); err != nil {
+			return err
+		}
+		newIDs = append(newIDs, id)
+	}
+	sort.Strings(newIDs)
+	for _, name := range []string{serverTxt, historyTxt} {
+		if err := appendLine(filepath.Join(admin, name), s.records); err != nil {
+			return err
+		}
+	}
+	if err := writeFileAtomic(filepath.Join(admin, lastidTxt), []byte(s.last+"\r\n")); err != nil {
+		return err
+	}
+
+	releases := src.releaseMarks()
+	marks := make(map[string]bool)
+	for _, id := range newIDs {
+		if err := b.encryptTransaction(id); err != nil {
+			return fmt.Errorf("encrypt transaction %s: %v", id, err)
+		}
+		if err := b.recordRenames(id, s.renames[id]); err != nil {
+			return err
+		}
+	}
+	for old, id := range ids {
+		if releases[old] && s.txs[id] != nil {
+			marks[id] = true
+		}
+	}
+	if err := b.mergeReleaseMarks(marks); err != nil {
+		return err
+	}
+	if err := b.mergeHolds(src, ids); err != nil {
+		return err
+	}
+	if err := b.mergeTickets(src, ids); err != nil {
+		return err
+	}
+	return b.mergeValidations(src, ids)
+}
+
+// rollback undo the changes commit made to the store
+func (s *mergeStage) rollback() {
+	for _, dir := range s.moved {
+		if err := os.RemoveAll(dir); err != nil {
+			log.Warn("[Branch] Rollback merged folder %s failed: %v.", dir, err)
+		}
+		// name folder, and the tier folder of two-tier layout, left empty
+		for p := filepath.Dir(dir); p != s.dst.StorePath; p = filepath.Dir(p) {
+			if os.Remove(p) != nil {
+				break
+			}
+		}
+	}
+	for fpath := range s.created {
+		if err := os.Remove(fpath); err != nil && !os.IsNotExist(err) {
+			log.Warn("[Branch] Rollback %s failed: %v.", fpath, err)
+		}
+	}
+	for fpath, data := range s.saved {
+		if err := writeFileAtomic(fpath, data); err != nil {
+			log.Warn("[Branch] Rollback %s failed: %v.", fpath, err)
+		}
+	}
+}
+
+// mergeReleaseMarks add build IDs `marks` to release.txt
+func (b *BrBuilder) mergeReleaseMarks(marks map[string]bool) error {
+	if len(marks) == 0 {
+		return nil
+	}
+	for id := range b.releaseMarks() {
+		marks[id] = true
+	}
+	ids := make([]string, 0, len(marks))
+	for id := range marks {
+		ids = append(ids, id)
+	}
+	sort.Strings(ids)
+	return writeFileAtomic(b.branchFile(releaseTxt), []byte(strings.Join(ids, "\r\n")))
+}
+
+// remapRefs return lines of refs.ptr `data` whose transaction is in `ids`, re-keyed by it
+func remapRefs(data []byte, ids map[string]string) []string {
+	var lines []string
+	for _, line := range strings.Split(string(data), "\n") {
+		line = strings.TrimSpace(line)
+		ss := strings.SplitN(line, ",", 2)
+		if len(ss) != 2 {
+			continue
+		}
+		if id, ok := ids[ss[0]]; ok {
+			lines = append(lines, id+","+ss[1])
+		}
+	}
+	return lines
+}
+
+// mergeRefs return refs.ptr of symbol folder `dir` with the references of source folder
+// `from` re-keyed by `ids` appended, nil if nothing to add.
+func mergeRefs(dir, from string, ids map[string]string) ([]byte, error) {
+	data, err := ioutil.ReadFile(filepath.Join(from, refsPtr))
+	if os.IsNotExist(err) {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+	moved := remapRefs(data, ids)
+	if len(moved) == 0 {
+		return nil, nil
+	}
+
+	exist, err := ioutil.ReadFile(filepath.Join(dir, refsPtr))
+	if err != nil && !os.IsNotExist(err) {
+		return nil, err
+	}
+	var lines []string
+	seen := make(map[string]bool)
+	for _, line := range strings.Split(string(exist), "\n") {
+		if line = strings.TrimSpace(line); line != "" {
+			lines = append(lines, line)
+			seen[strings.SplitN(line, ",", 2)[0]] = true
+		}
+	}
+	added := false
+	for _, line := range moved {
+		if id := strings.SplitN(line, ",", 2)[0]; !seen[id] {
+			seen[id] = true
+			lines = append(lines, line)
+			added = true
+		}
+	}
+	if !added {
+		return nil, nil
+	}
+	return []byte(strings.Join(lines, "\r\n") + "\r\n"), nil
+}
+
+// copyDir copy plain content of files in store folder `src` into new folder `dst`, not
+// recursive. Transactions referenced by refs.ptr are re-keyed by `ids`.
+func (b *BrBuilder) copyDir(src, dst string, ids map[string]string) error {
+	fs, err := ioutil.ReadDir(src)
+	if err != nil {
+		return err
+	}
+	if err = os.MkdirAll(dst, 0755); err != nil {
+		return err
+	}
+	for _, f := range fs {
+		if f.IsDir() {
+			continue
+		}
+		if strings.EqualFold(f.Name(), refsPtr) {
+			data, err := ioutil.ReadFile(filepath.Join(src, f.Name()))
+			if err != nil {
+				return err
+			}
+			lines := remapRefs(data, ids)
+			if err = writeFileAtomic(filepath.Join(dst, refsPtr), []byte(strings.Join(lines, "\r\n")+"\r\n")); err != nil {
+				return err
+			}
+			continue
+		}
+		if err = b.copyFile(filepath.Join(src, f.Name()), filepath.Join(dst, f.Name())); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+func (b *BrBuilder) copyFile(src, dst string) error {
+	fs, _, err := b.OpenSymbol(src)
+	if err != nil {
+		return err
+	}
+	defer fs.Close()
+	tmp := dst + ".tmp"
+	fd, err := os.Create(tmp)
+	if err != nil {
+		return err
+	}
+	if _, err = io.Copy(fd, fs); err != nil {
+		fd.Close()
+		os.Remove(tmp)
+		return err
+	}
+	if err = fd.Close(); err != nil {
+		return err
+	}
+	return os.Rename(tmp, dst)
+}
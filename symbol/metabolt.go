@@ -0,0 +1,399 @@
+package symbol
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"strconv"
+	"strings"
+	"time"
+
+	bolt "go.etcd.io/bbolt"
+	log "gopkg.in/clog.v1"
+)
+
+// Buckets of the bbolt metadata database `[base] METADATA_DB`.
+var (
+	bucketMeta         = []byte("meta")         // schema => version
+	bucketBranches     = []byte("branches")     // {branch} => json Branch, was 000Admin/branch.bin
+	bucketBuilds       = []byte("builds")       // {branch}/{id} => json Build parsed from server.txt
+	bucketTransactions = []byte("transactions") // {branch}/{id} => json txRecord parsed from 000Admin/{id}
+	bucketHashes       = []byte("hashes")       // {hash}/{branch}/{id} => name, symbols by hash across branches
+	bucketNames        = []byte("names")        // {name}/{branch}/{id} => empty, transactions by symbol name, see SearchSymbols
+
+	keySchema = []byte("schema")
+	keyStamp  = []byte("stamp") // stamp of server.txt in builds of a branch
+)
+
+// metaMigrations upgrade the metadata database, schema version N is reached by running
+// metaMigrations[N-1]. Append only.
+var metaMigrations = []func(tx *bolt.Tx) error{
+	// 1: branches, builds, transactions and hash index
+	func(tx *bolt.Tx) error {
+		for _, name := range [][]byte{bucketBranches, bucketBuilds, bucketTransactions, bucketHashes} {
+			if _, err := tx.CreateBucketIfNotExists(name); err != nil {
+				return err
+			}
+		}
+		return nil
+	},
+	// 2: name index of the transactions already parsed
+	func(tx *bolt.Tx) error {
+		names, err := tx.CreateBucketIfNotExists(bucketNames)
+		if err != nil {
+			return err
+		}
+		return tx.Bucket(bucketTransactions).ForEach(func(branch, v []byte) error {
+			txs := tx.Bucket(bucketTransactions).Bucket(branch)
+			if txs == nil {
+				return nil
+			}
+			return txs.ForEach(func(id, data []byte) error {
+				var rec txRecord
+				if err := json.Unmarshal(data, &rec); err != nil {
+					return nil
+				}
+				for _, e := range rec.Entries {
+					if err := names.Put(nameKey(e.Name, string(branch), string(id)), []byte{}); err != nil {
+						return err
+					}
+				}
+				return nil
+			})
+		})
+	},
+}
+
+// boltMeta is the metadata database embedded in a bbolt file, there is no replica of it
+type boltMeta struct {
+	db *bolt.DB
+}
+
+// openBolt open the bbolt database at `fpath` and migrate its schema
+func openBolt(fpath string) (*boltMeta, error) {
+	db, err := bolt.Open(fpath, 0644, &bolt.Options{Timeout: time.Second * 10})
+	if err != nil {
+		return nil, err
+	}
+	if err = migrateMeta(db); err != nil {
+		db.Close()
+		return nil, err
+	}
+	return &boltMeta{db: db}, nil
+}
+
+// migrateMeta run the migrations newer than schema version of the database
+func migrateMeta(db *bolt.DB) error {
+	return db.Update(func(tx *bolt.Tx) error {
+		meta, err := tx.CreateBucketIfNotExists(bucketMeta)
+		if err != nil {
+			return err
+		}
+		version, _ := strconv.Atoi(string(meta.Get(keySchema)))
+		if version > len(metaMigrations) {
+			return fmt.Errorf("schema version %d is newer than %d of this server", version, len(metaMigrations))
+		}
+		for ; version < len(metaMigrations); version++ {
+			if err = metaMigrations[version](tx); err != nil {
+				return fmt.Errorf("migration %d: %v", version+1, err)
+			}
+			log.Info("[Meta] Metadata schema migrated to %d.", version+1)
+		}
+		return meta.Put(keySchema, []byte(strconv.Itoa(version)))
+	})
+}
+
+// metaKey of branch in all buckets
+func metaKey(name string) []byte {
+	return []byte(strings.ToLower(name))
+}
+
+// hashKey of symbol in hash index, `{hash}/{branch}/{id}`
+func hashKey(hash, branch, id string) []byte {
+	return []byte(strings.ToLower(hash) + "/" + strings.ToLower(branch) + "/" + id)
+}
+
+// nameKey of symbol in name index, `{name}/{branch}/{id}`
+func nameKey(name, branch, id string) []byte {
+	return []byte(strings.ToLower(name) + "/" + strings.ToLower(branch) + "/" + id)
+}
+
+// hasKey check `key` is in bucket, values of the name index are empty
+func hasKey(bkt *bolt.Bucket, key []byte) bool {
+	k, _ := bkt.Cursor().Seek(key)
+	return bytes.Equal(k, key)
+}
+
+func (m *boltMeta) close() error {
+	return m.db.Close()
+}
+
+func (m *boltMeta) getBranch(ctx context.Context, name string, br *Branch) (bool, error) {
+	found := false
+	err := m.db.View(func(tx *bolt.Tx) error {
+		data := tx.Bucket(bucketBranches).Get(metaKey(name))
+		if data == nil {
+			return nil
+		}
+		found = true
+		return json.Unmarshal(data, br)
+	})
+	return found, err
+}
+
+func (m *boltMeta) putBranch(br *Branch) error {
+	data, err := json.Marshal(br)
+	if err != nil {
+		return err
+	}
+	return m.db.Update(func(tx *bolt.Tx) error {
+		return tx.Bucket(bucketBranches).Put(metaKey(br.StoreName), data)
+	})
+}
+
+func (m *boltMeta) deleteBranch(name string) error {
+	return m.db.Update(func(tx *bolt.Tx) error {
+		if err := tx.Bucket(bucketBranches).Delete(metaKey(name)); err != nil {
+			return err
+		}
+		return dropParsed(tx, name)
+	})
+}
+
+func (m *boltMeta) dropParsed(name string) error {
+	return m.db.Update(func(tx *bolt.Tx) error {
+		return dropParsed(tx, name)
+	})
+}
+
+// dropParsed remove builds, transactions and hashes of branch
+func dropParsed(tx *bolt.Tx, name string) error {
+	key := metaKey(name)
+	if txs := tx.Bucket(bucketTransactions).Bucket(key); txs != nil {
+		var ids []string
+		txs.ForEach(func(k, v []byte) error {
+			ids = append(ids, string(k))
+			return nil
+		})
+		for _, id := range ids {
+			if err := dropTransaction(tx, name, id); err != nil {
+				return err
+			}
+		}
+		tx.Bucket(bucketTransactions).DeleteBucket(key)
+	}
+	if tx.Bucket(bucketBuilds).Bucket(key) != nil {
+		return tx.Bucket(bucketBuilds).DeleteBucket(key)
+	}
+	return nil
+}
+
+// builds scan the builds bucket of branch from `from` to `to`, keys are the fixed width IDs
+func (m *boltMeta) builds(ctx context.Context, name, stamp, from, to string) ([]*Build, bool, error) {
+	var builds []*Build
+	found := false
+	err := m.db.View(func(tx *bolt.Tx) error {
+		bkt := tx.Bucket(bucketBuilds).Bucket(metaKey(name))
+		if bkt == nil || string(bkt.Get(keyStamp)) != stamp {
+			return nil
+		}
+		found = true
+		c := bkt.Cursor()
+		k, v := c.First()
+		if from != "" {
+			k, v = c.Seek([]byte(from))
+		}
+		for ; k != nil && (to == "" || string(k) <= to); k, v = c.Next() {
+			if bytes.Equal(k, keyStamp) {
+				continue
+			}
+			build := &Build{}
+			if err := json.Unmarshal(v, build); err != nil {
+				return err
+			}
+			builds = append(builds, build)
+		}
+		return nil
+	})
+	if err != nil {
+		return nil, false, err
+	}
+	return builds, found, nil
+}
+
+func (m *boltMeta) putBuilds(name, stamp string, builds []*Build) error {
+	return m.db.Update(func(tx *bolt.Tx) error {
+		key := metaKey(name)
+		if tx.Bucket(bucketBuilds).Bucket(key) != nil {
+			if err := tx.Bucket(bucketBuilds).DeleteBucket(key); err != nil {
+				return err
+			}
+		}
+		bkt, err := tx.Bucket(bucketBuilds).CreateBucket(key)
+		if err != nil {
+			return err
+		}
+		ids := make(map[string]bool, len(builds))
+		for _, build := range builds {
+			data, err := json.Marshal(build)
+			if err != nil {
+				return err
+			}
+			if err = bkt.Put([]byte(build.ID), data); err != nil {
+				return err
+			}
+			ids[build.ID] = true
+		}
+		if err = bkt.Put(keyStamp, []byte(stamp)); err != nil {
+			return err
+		}
+
+		txs := tx.Bucket(bucketTransactions).Bucket(key)
+		if txs == nil {
+			return nil
+		}
+		var stale []string
+		txs.ForEach(func(k, v []byte) error {
+			if !ids[string(k)] {
+				stale = append(stale, string(k))
+			}
+			return nil
+		})
+		for _, id := range stale {
+			if err = dropTransaction(tx, name, id); err != nil {
+				return err
+			}
+		}
+		return nil
+	})
+}
+
+func (m *boltMeta) transaction(ctx context.Context, name, id, stamp string) ([]*txEntry, bool, error) {
+	var rec txRecord
+	found := false
+	err := m.db.View(func(tx *bolt.Tx) error {
+		txs := tx.Bucket(bucketTransactions).Bucket(metaKey(name))
+		if txs == nil {
+			return nil
+		}
+		data := txs.Get([]byte(id))
+		if data == nil {
+			return nil
+		}
+		if err := json.Unmarshal(data, &rec); err != nil {
+			return err
+		}
+		found = rec.Stamp == stamp
+		return nil
+	})
+	if err != nil {
+		return nil, false, err
+	}
+	return rec.Entries, found, nil
+}
+
+func (m *boltMeta) putTransaction(name, id, stamp string, entries []*txEntry) error {
+	data, err := json.Marshal(&txRecord{Stamp: stamp, Entries: entries})
+	if err != nil {
+		return err
+	}
+	return m.db.Update(func(tx *bolt.Tx) error {
+		if err := dropTransaction(tx, name, id); err != nil {
+			return err
+		}
+		txs, err := tx.Bucket(bucketTransactions).CreateBucketIfNotExists(metaKey(name))
+		if err != nil {
+			return err
+		}
+		if err = txs.Put([]byte(id), data); err != nil {
+			return err
+		}
+		hashes, names := tx.Bucket(bucketHashes), tx.Bucket(bucketNames)
+		for _, e := range entries {
+			if err = hashes.Put(hashKey(e.Hash, name, id), []byte(e.Name)); err != nil {
+				return err
+			}
+			if err = names.Put(nameKey(e.Name, name, id), []byte{}); err != nil {
+				return err
+			}
+		}
+		return nil
+	})
+}
+
+// dropTransaction remove transaction `id` of branch and its hashes
+func dropTransaction(tx *bolt.Tx, name, id string) error {
+	txs := tx.Bucket(bucketTransactions).Bucket(metaKey(name))
+	if txs == nil {
+		return nil
+	}
+	data := txs.Get([]byte(id))
+	if data == nil {
+		return nil
+	}
+	var rec txRecord
+	if err := json.Unmarshal(data, &rec); err == nil {
+		hashes, names := tx.Bucket(bucketHashes), tx.Bucket(bucketNames)
+		for _, e := range rec.Entries {
+			if err = hashes.Delete(hashKey(e.Hash, name, id)); err != nil {
+				return err
+			}
+			if err = names.Delete(nameKey(e.Name, name, id)); err != nil {
+				return err
+			}
+		}
+	}
+	return txs.Delete([]byte(id))
+}
+
+func (m *boltMeta) hasSymbol(ctx context.Context, name, id, field, value string) (has, known bool, err error) {
+	err = m.db.View(func(tx *bolt.Tx) error {
+		txs := tx.Bucket(bucketTransactions).Bucket(metaKey(name))
+		if txs == nil || txs.Get([]byte(id)) == nil {
+			return nil
+		}
+		switch field {
+		case "name":
+			has, known = hasKey(tx.Bucket(bucketNames), nameKey(value, name, id)), true
+		case "hash":
+			has, known = hasKey(tx.Bucket(bucketHashes), hashKey(value, name, id)), true
+		}
+		return nil
+	})
+	return has, known, err
+}
+
+func (m *boltMeta) findHash(ctx context.Context, hash string) ([]*metaRef, error) {
+	var refs []*metaRef
+	prefix := []byte(strings.ToLower(hash) + "/")
+	err := m.db.View(func(tx *bolt.Tx) error {
+		c := tx.Bucket(bucketHashes).Cursor()
+		for k, v := c.Seek(prefix); k != nil && bytes.HasPrefix(k, prefix); k, v = c.Next() {
+			parts := strings.SplitN(string(k[len(prefix):]), "/", 2)
+			if len(parts) != 2 {
+				continue
+			}
+			refs = append(refs, &metaRef{branch: parts[0], id: parts[1], name: string(v)})
+		}
+		return nil
+	})
+	return refs, err
+}
+
+func (m *boltMeta) findNames(ctx context.Context, prefix string) ([]*metaRef, error) {
+	var refs []*metaRef
+	seek := []byte(strings.ToLower(prefix))
+	err := m.db.View(func(tx *bolt.Tx) error {
+		c := tx.Bucket(bucketNames).Cursor()
+		for k, _ := c.Seek(seek); k != nil && bytes.HasPrefix(k, seek); k, _ = c.Next() {
+			parts := strings.SplitN(string(k), "/", 3)
+			if len(parts) != 3 {
+				continue
+			}
+			refs = append(refs, &metaRef{branch: parts[1], id: parts[2], name: parts[0]})
+		}
+		return nil
+	})
+	return refs, err
+}
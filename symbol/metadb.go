@@ -0,0 +1,322 @@
+package symbol
+
+import (
+	"bufio"
+	"context"
+	"fmt"
+	"io"
+	"io/fs"
+	"path/filepath"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/adyzng/GoSymbols/config"
+	"github.com/adyzng/GoSymbols/metastore"
+	log "gopkg.in/clog.v1"
+)
+
+var (
+	ErrMetaDisabled = fmt.Errorf("metadata database is disabled")
+)
+
+// metaBackend keep what is parsed from admin files, the bbolt database `[base] METADATA_DB`
+// or the SQL database `[metadata] DSN` shared by servers. The admin files written by
+// symstore.exe stay the source of truth, what is parsed from them is kept with the stamp of
+// the file and only parsed again once the file changed. Reads of `ctx` marked by
+// WithReplica may be served by a read replica.
+type metaBackend interface {
+	getBranch(ctx context.Context, name string, br *Branch) (bool, error)
+	putBranch(br *Branch) error
+	deleteBranch(name string) error
+	dropParsed(name string) error // builds, transactions and symbols of branch, the branch is kept
+
+	// builds of branch parsed from server.txt with `stamp` whose IDs are in the inclusive
+	// range [from, to], empty bound is open. False if saved of another stamp.
+	builds(ctx context.Context, name, stamp, from, to string) ([]*Build, bool, error)
+	// putBuilds replace builds of branch, transactions of builds no longer there are dropped
+	putBuilds(name, stamp string, builds []*Build) error
+	// transaction `id` of branch parsed from the file with `stamp`, false if not saved
+	transaction(ctx context.Context, name, id, stamp string) ([]*txEntry, bool, error)
+	// putTransaction save transaction `id` of branch and index its symbols by name and hash
+	putTransaction(name, id, stamp string, entries []*txEntry) error
+
+	// hasSymbol check transaction `id` of branch has a symbol whose `field`, name or hash,
+	// is `value`, known is false if the transaction isn't indexed
+	hasSymbol(ctx context.Context, name, id, field, value string) (has, known bool, err error)
+	// findHash return transactions of all branches holding symbols of `hash`
+	findHash(ctx context.Context, hash string) ([]*metaRef, error)
+	// findNames return transactions of all branches holding symbols whose name starts with
+	// `prefix`, ordered by name
+	findNames(ctx context.Context, prefix string) ([]*metaRef, error)
+	close() error
+}
+
+// metaRef is a transaction holding symbol `name` in the index, branch is lower case
+type metaRef struct {
+	branch string
+	id     string
+	name   string
+}
+
+var (
+	metaOnce  sync.Once
+	metaStore metaBackend
+)
+
+// WithReplica mark `ctx` of a heavy list request, its metadata reads may be served by a
+// replica of `[metadata] READ_DSN` lagging behind by up to `[metadata] MAX_LAG` seconds.
+//
+func WithReplica(ctx context.Context) context.Context {
+	return metastore.WithReplica(ctx)
+}
+
+// ReplicaLag return how far behind the primary metadata read for `ctx` of WithReplica may
+// be, false if it was all read from the primary.
+//
+func ReplicaLag(ctx context.Context) (time.Duration, bool) {
+	return metastore.ReplicaLag(ctx)
+}
+
+// txEntry is a line of transaction file, `"{name}\{hash}","{path}"`
+type txEntry struct {
+	Name string `json:"n"`
+	Hash string `json:"h"`
+	Path string `json:"p"`
+}
+
+// txRecord is a parsed transaction file
+type txRecord struct {
+	Stamp   string     `json:"stamp"`
+	Entries []*txEntry `json:"entries"`
+}
+
+// SymbolRef is a symbol indexed by hash in the metadata database
+//
+type SymbolRef struct {
+	Branch string `json:"branch"`
+	Build  string `json:"build"` // transaction ID
+	Name   string `json:"name"`
+	Hash   string `json:"hash"`
+}
+
+// metaPath return path of the metadata database, empty if disabled
+func metaPath() string {
+	switch {
+	case config.MetadataDB == "" || memoryMode():
+		return ""
+	case filepath.IsAbs(config.MetadataDB):
+		return config.MetadataDB
+	}
+	return filepath.Join(config.AppPath, config.MetadataDB)
+}
+
+// openMeta return the metadata database, the SQL database of `[metadata] DSN` if set,
+// nil if disabled or it can't be opened, the admin files are parsed on every load then.
+func openMeta() metaBackend {
+	metaOnce.Do(func() {
+		if config.MetadataDSN != "" && !memoryMode() {
+			m, err := openSQL()
+			if err != nil {
+				// DSN is not logged, it may hold the password
+				log.Error(2, "[Meta] Open %s metadata database failed: %v.", config.MetadataDriver, err)
+				return
+			}
+			metaStore = m
+			return
+		}
+		fpath := metaPath()
+		if fpath == "" {
+			return
+		}
+		m, err := openBolt(fpath)
+		if err != nil {
+			log.Error(2, "[Meta] Open metadata database %s failed: %v.", fpath, err)
+			return
+		}
+		metaStore = m
+	})
+	return metaStore
+}
+
+// fsStamp identify content of admin file `name` of store filesystem by size and modify
+// time, empty if not exist
+func fsStamp(fsys fs.FS, name string) string {
+	st, err := fs.Stat(fsys, name)
+	if err != nil {
+		return ""
+	}
+	return fmt.Sprintf("%d-%d", st.Size(), st.ModTime().UnixNano())
+}
+
+// FindHash return symbols with `hash` in all branches from the metadata database, without
+// parsing any admin file. Transactions are indexed once parsed, builds are parsed at
+// startup. ErrMetaDisabled if there is no metadata database.
+//
+func (ss *sserver) FindHash(hash string) ([]*SymbolRef, error) {
+	db := openMeta()
+	if db == nil {
+		return nil, ErrMetaDisabled
+	}
+	refs, err := db.findHash(context.Background(), hash)
+	if err != nil {
+		return nil, err
+	}
+
+	// the index is keyed by lower case, report the branch name as configured
+	var found []*SymbolRef
+	for _, ref := range refs {
+		if b := ss.Get(ref.branch); b != nil {
+			found = append(found, &SymbolRef{Branch: b.Name(), Build: ref.id, Name: ref.name, Hash: hash})
+		}
+	}
+	return found, nil
+}
+
+// serverBuilds return builds of the branch in server.txt as parsed, from the metadata
+// database if server.txt didn't change since it was saved.
+func (b *BrBuilder) serverBuilds() ([]*Build, error) {
+	fsys := b.StoreFS()
+	db, stamp := openMeta(), fsStamp(fsys, adminName(serverTxt))
+	if db != nil && stamp != "" {
+		builds, ok, err := db.builds(context.Background(), b.StoreName, stamp, "", "")
+		if ok {
+			return builds, nil
+		} else if err != nil {
+			log.Warn("[Meta] Read builds of %s failed: %v.", b.Name(), err)
+		}
+	}
+
+	if err := b.checkAdminFile(serverTxt, validServerLine); err != nil {
+		log.Error(2, "[Branch] Check %s of %s failed: %v.", serverTxt, b.Name(), err)
+		return nil, err
+	}
+	fc, err := fsys.Open(adminName(serverTxt))
+	if err != nil {
+		log.Error(2, "[Branch] Open %s of %s failed with %v.", serverTxt, b.Name(), err)
+		return nil, err
+	}
+	defer fc.Close()
+
+	var builds []*Build
+	r := bufio.NewReader(fc)
+	for {
+		str, err := r.ReadString('\n')
+		if err == io.EOF && str == "" {
+			break
+		} else if err == io.EOF {
+			log.Warn("[Branch] Last line (%s) of server.txt is truncated.", str)
+		}
+		str = strings.Trim(str, "\r\n")
+
+		build := parseBuildLine(str)
+		if build == nil {
+			log.Warn("[Branch] Invalid line (%s) in server.txt.", str)
+			continue
+		}
+		if !b.ownBuild(build) {
+			// other branch in shared store
+			continue
+		}
+		builds = append(builds, build)
+	}
+
+	if db != nil && stamp != "" {
+		if err = db.putBuilds(b.StoreName, stamp, builds); err != nil {
+			log.Warn("[Meta] Save builds of %s failed: %v.", b.Name(), err)
+			return builds, nil
+		}
+		b.indexTransactions(db, builds)
+	}
+	return builds, nil
+}
+
+// indexTransactions parse transactions of builds not in the metadata database yet, so
+// FindHash knows their symbols. Only the first load of a store parse them all.
+func (b *BrBuilder) indexTransactions(db metaBackend, builds []*Build) {
+	total, fsys := 0, b.StoreFS()
+	for _, build := range builds {
+		stamp := fsStamp(fsys, adminName(build.ID))
+		if _, ok, _ := db.transaction(context.Background(), b.StoreName, build.ID, stamp); ok {
+			continue
+		}
+		if _, err := b.parseTransactionFile(build.ID, stamp); err == nil {
+			total++
+		}
+	}
+	if total != 0 {
+		log.Info("[Meta] Index %d transactions of %s.", total, b.Name())
+	}
+}
+
+// readTransaction return lines of transaction file 000Admin/{id}, from the cache of
+// recently read transactions or the metadata database if the file didn't change since.
+func (b *BrBuilder) readTransaction(id string) ([]*txEntry, error) {
+	stamp := fsStamp(b.StoreFS(), adminName(id))
+	if entries, ok := transactions.get(b.StoreName, id, stamp); ok {
+		return entries, nil
+	}
+	entries, err := b.parseTransactionFile(id, stamp)
+	if err == nil {
+		transactions.put(b.StoreName, id, stamp, entries)
+	}
+	return entries, err
+}
+
+// parseTransactionFile read transaction `id` from the metadata database, or parse the
+// file of store filesystem and save it into the database.
+func (b *BrBuilder) parseTransactionFile(id, stamp string) ([]*txEntry, error) {
+	db := openMeta()
+	if db != nil && stamp != "" {
+		entries, ok, err := db.transaction(context.Background(), b.StoreName, id, stamp)
+		if ok {
+			return entries, nil
+		} else if err != nil {
+			log.Warn("[Meta] Read transaction %s of %s failed: %v.", id, b.Name(), err)
+		}
+	}
+
+	if err := b.checkAdminFile(id, validTransactionLine); err != nil {
+		log.Error(2, "[Branch] Check transaction %s of %s failed: %v.", id, b.Name(), err)
+		return nil, err
+	}
+	fd, err := b.StoreFS().Open(adminName(id))
+	if err != nil {
+		log.Error(2, "[Branch] Open transaction %s of %s failed with %v.", id, b.Name(), err)
+		return nil, err
+	}
+	defer fd.Close()
+
+	var entries []*txEntry
+	r := bufio.NewReader(fd)
+	for {
+		str, err := r.ReadString('\n') //0D 0A
+		if err == io.EOF && str == "" {
+			break
+		} else if err == io.EOF {
+			log.Warn("[Branch] Last line (%s) of %s is truncated.", str, id)
+		}
+		str = strings.Trim(str, "\r\n")
+
+		//
+		// "cbt_client.pdb\8E3868FEE1FA4AC8A42D0FACA65E0BE41","S:\script\temp\ExternalLib\RHAPdbfile\cbt_client.pdb"
+		ss := strings.Split(str, ",")
+		if len(ss) < 2 {
+			log.Warn("[Branch] Invalid line (%s) in %s.", str, id)
+			continue
+		}
+		pName := strings.Split(strings.Trim(ss[0], "\""), "\\")
+		if len(pName) != 2 {
+			// invalid format
+			continue
+		}
+		entries = append(entries, &txEntry{Name: pName[0], Hash: pName[1], Path: strings.Trim(ss[1], "\"")})
+	}
+
+	if db != nil && stamp != "" {
+		if err = db.putTransaction(b.StoreName, id, stamp, entries); err != nil {
+			log.Warn("[Meta] Save transaction %s of %s failed: %v.", id, b.Name(), err)
+		}
+	}
+	return entries, nil
+}
@@ -0,0 +1,147 @@
+package symbol
+
+import (
+	"context"
+	"encoding/gob"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/adyzng/GoSymbols/config"
+	bolt "go.etcd.io/bbolt"
+)
+
+func TestMetadataDB(t *testing.T) {
+	root, err := ioutil.TempDir("", "metadb")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(root)
+	config.MetadataDB = filepath.Join(root, "gosymbols.db")
+	metaOnce, metaStore = sync.Once{}, nil
+	defer func() {
+		if metaStore != nil {
+			metaStore.close()
+		}
+		config.MetadataDB = ""
+		metaOnce, metaStore = sync.Once{}, nil
+	}()
+	testMetadata(t, root)
+
+	db := openMeta().(*boltMeta).db
+	db.View(func(tx *bolt.Tx) error {
+		if v := string(tx.Bucket(bucketMeta).Get(keySchema)); v != "2" {
+			t.Errorf("expect schema 2, got %s", v)
+		}
+		return nil
+	})
+}
+
+// TestMetadataSQL run against the database of METASTORE_DRIVER and METASTORE_DSN, see
+// package metastore.
+func TestMetadataSQL(t *testing.T) {
+	if os.Getenv("METASTORE_DSN") == "" {
+		t.Skip("METASTORE_DSN not set")
+	}
+	root, err := ioutil.TempDir("", "metasql")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(root)
+	config.MetadataDriver, config.MetadataDSN = os.Getenv("METASTORE_DRIVER"), os.Getenv("METASTORE_DSN")
+	metaOnce, metaStore = sync.Once{}, nil
+	defer func() {
+		if metaStore != nil {
+			metaStore.close()
+		}
+		config.MetadataDriver, config.MetadataDSN = "", ""
+		metaOnce, metaStore = sync.Once{}, nil
+	}()
+	if _, ok := openMeta().(*sqlMeta); !ok {
+		t.Fatal("expect SQL metadata database")
+	}
+	testMetadata(t, root)
+}
+
+// testMetadata parse builds and transactions of a store into the metadata database and
+// read them back, then move branch.bin into it
+func testMetadata(t *testing.T, root string) {
+	var err error
+	admin := filepath.Join(root, "store", adminDir)
+	os.MkdirAll(admin, 0755)
+	ioutil.WriteFile(filepath.Join(admin, "0000000001"), []byte("\"foo.pdb\\F1\",\"S:\\000Unzip\\x64\\foo.pdb\"\r\n"), 0644)
+	ioutil.WriteFile(filepath.Join(admin, "0000000002"), []byte("\"bar.pdb\\B1\",\"S:\\000Unzip\\x64\\bar.pdb\"\r\n"), 0644)
+	server := filepath.Join(admin, serverTxt)
+	ioutil.WriteFile(server, []byte(
+		"0000000001,add,file,07/04/2017,14:44:14,\"UDP\",\"4175.2-538\",\"\",\r\n"+
+			"0000000002,add,file,07/05/2017,14:44:14,\"UDP\",\"4175.2-539\",\"\",\r\n"), 0644)
+
+	b := NewBranch2(&Branch{StoreName: "UDP", StorePath: filepath.Join(root, "store")}).(*BrBuilder)
+	ss := &sserver{builders: map[string]Builder{"udp": b}}
+	if n, err := b.ParseBuilds(context.Background(), nil); err != nil || n != 2 {
+		t.Fatalf("expect 2 builds, got %d (%v)", n, err)
+	}
+	if refs, err := ss.FindHash("f1"); err != nil || len(refs) != 1 || refs[0].Branch != "UDP" || refs[0].Build != "0000000001" || refs[0].Name != "foo.pdb" {
+		t.Fatalf("unexpected refs of F1: %+v (%v)", refs, err)
+	}
+	if names, err := ss.SymbolNames(context.Background(), "udp", "B*.pdb"); err != nil || len(names) != 1 || names[0] != "bar.pdb" {
+		t.Fatalf("unexpected names %v (%v)", names, err)
+	}
+
+	// admin files are not parsed again while size and modify time are unchanged
+	tx1 := filepath.Join(admin, "0000000001")
+	st, _ := os.Stat(tx1)
+	ioutil.WriteFile(tx1, []byte("\"foo.pdb\\F9\",\"S:\\000Unzip\\x64\\foo.pdb\"\r\n"), 0644)
+	os.Chtimes(tx1, st.ModTime(), st.ModTime())
+	b.builds = make(map[string]*Build)
+	if n, _ := b.ParseBuilds(context.Background(), nil); n != 2 {
+		t.Errorf("expect 2 builds from database, got %d", n)
+	}
+	b.ParseSymbols("0000000001", func(sym *Symbol) error {
+		if sym.Hash != "F1" {
+			t.Errorf("expect symbol from database, got %s", sym.Hash)
+		}
+		return nil
+	})
+
+	// server.txt changed, the dropped build leave the hash index
+	ioutil.WriteFile(server, []byte("0000000002,add,file,07/05/2017,14:44:14,\"UDP\",\"4175.2-539\",\"\",\r\n"), 0644)
+	os.Chtimes(server, time.Now(), time.Now().Add(time.Hour))
+	b.builds = make(map[string]*Build)
+	if n, _ := b.ParseBuilds(context.Background(), nil); n != 1 {
+		t.Errorf("expect 1 build after server.txt changed, got %d", n)
+	}
+	if refs, _ := ss.FindHash("F1"); len(refs) != 0 {
+		t.Errorf("expect F1 dropped, got %+v", refs)
+	}
+	if f := ss.FindSymbol("bar.pdb", "B1"); f != nil {
+		t.Errorf("expect no file of B1 in store, got %s", f.Path)
+	}
+
+	// branch.bin is moved into the database on load
+	fd, _ := os.Create(b.branchFile(branchBin))
+	gob.NewEncoder(fd).Encode(&Branch{StoreName: "UDP", LatestBuild: "4175.2-539"})
+	fd.Close()
+	loaded := NewBranch2(&Branch{StoreName: "UDP", StorePath: filepath.Join(root, "store")}).(*BrBuilder)
+	if err = loaded.Load(); err != nil || loaded.LatestBuild != "4175.2-539" {
+		t.Fatalf("load branch.bin failed: %v", err)
+	}
+	os.Remove(b.branchFile(branchBin))
+	loaded.LatestBuild = "4175.2-540"
+	if err = loaded.Persist(); err != nil {
+		t.Fatal(err)
+	}
+	again := NewBranch2(&Branch{StoreName: "udp", StorePath: filepath.Join(root, "store")}).(*BrBuilder)
+	if err = again.Load(); err != nil || again.LatestBuild != "4175.2-540" {
+		t.Errorf("expect branch from database, got %s (%v)", again.LatestBuild, err)
+	}
+	if err = again.Delete(); err != nil {
+		t.Fatal(err)
+	}
+	if refs, _ := ss.FindHash("B1"); len(refs) != 0 {
+		t.Errorf("expect hashes of deleted branch dropped, got %+v", refs)
+	}
+}
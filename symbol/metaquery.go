@@ -0,0 +1,180 @@
+package symbol
+
+import (
+	"context"
+
+	"github.com/adyzng/GoSymbols/query"
+)
+
+// metaBuildFields are the build fields saved in the metadata database, the columns of
+// server.txt. Status, channel and release marks are matched on the loaded builds.
+var metaBuildFields = map[string]bool{
+	"id":           true,
+	"date":         true,
+	"branch":       true,
+	"version":      true,
+	"comment":      true,
+	"supplementof": true,
+}
+
+// indexed check all fields of expression are in `fields`
+func indexed(e query.Expr, fields map[string]bool) bool {
+	for _, f := range query.Fields(e) {
+		if !fields[f] {
+			return false
+		}
+	}
+	return true
+}
+
+// matchAll check build or symbol field getter `get` matches every expression
+func matchAll(exprs []query.Expr, get func(field string) string) bool {
+	for _, e := range exprs {
+		if !e.Match(get) {
+			return false
+		}
+	}
+	return true
+}
+
+// idRange return the inclusive range of transaction IDs the conditions can match, empty
+// bound is open. IDs are fixed width, so they are ordered as strings.
+func idRange(conds []query.Expr) (from, to string) {
+	for _, e := range conds {
+		c, ok := e.(*query.Cond)
+		if !ok || c.Field != "id" {
+			continue
+		}
+		switch c.Op {
+		case "=":
+			if c.Value > from {
+				from = c.Value
+			}
+			if to == "" || c.Value < to {
+				to = c.Value
+			}
+		case ">", ">=":
+			if c.Value > from {
+				from = c.Value
+			}
+		case "<", "<=":
+			if to == "" || c.Value < to {
+				to = c.Value
+			}
+		}
+	}
+	return
+}
+
+// QueryBuilds return builds of the branch matching `filter`, all builds if nil. Conditions
+// on the columns of server.txt are evaluated by a range scan of the metadata database, or
+// its replica for `ctx` of WithReplica, the rest on the loaded builds. Without metadata
+// database every build is matched.
+//
+func (b *BrBuilder) QueryBuilds(ctx context.Context, filter query.Expr) ([]*Build, error) {
+	if _, err := b.ParseBuilds(ctx, nil); err != nil {
+		return nil, err
+	}
+
+	var conds, rest []query.Expr
+	for _, e := range query.Conjuncts(filter) {
+		if indexed(e, metaBuildFields) {
+			conds = append(conds, e)
+		} else {
+			rest = append(rest, e)
+		}
+	}
+	ids, ok := b.metaQueryBuilds(ctx, conds)
+	if !ok && openMeta() != nil {
+		// server.txt changed since saved or the replica is behind, eg: a build was just
+		// added, the primary database has it once parsed again
+		if _, err := b.serverBuilds(); err == nil {
+			ids, ok = b.metaQueryBuilds(context.Background(), conds)
+		}
+	}
+
+	var builds []*Build
+	if !ok {
+		_, err := b.ParseBuilds(ctx, func(build *Build) error {
+			if filter == nil || filter.Match(build.Field) {
+				builds = append(builds, build)
+			}
+			return nil
+		})
+		return builds, err
+	}
+	for _, id := range ids {
+		if build := b.getBuild("", id); build != nil && matchAll(rest, build.Field) {
+			builds = append(builds, build)
+		}
+	}
+	return builds, nil
+}
+
+// metaQueryBuilds return IDs of builds saved in the metadata database matching all `conds`,
+// false if the database is disabled or behind server.txt.
+func (b *BrBuilder) metaQueryBuilds(ctx context.Context, conds []query.Expr) ([]string, bool) {
+	db, stamp := openMeta(), fsStamp(b.StoreFS(), adminName(serverTxt))
+	if db == nil || stamp == "" {
+		return nil, false
+	}
+	from, to := idRange(conds)
+	builds, found, err := db.builds(ctx, b.StoreName, stamp, from, to)
+	if err != nil || !found {
+		return nil, false
+	}
+	ids := make([]string, 0, len(builds))
+	for _, build := range builds {
+		if matchAll(conds, build.Field) {
+			ids = append(ids, build.ID)
+		}
+	}
+	return ids, true
+}
+
+// QuerySymbols return symbols of build `buildID` matching `filter`, all symbols if nil.
+// `name=` and `hash=` conditions are looked up in the indexes of the metadata database, or
+// its replica for `ctx` of WithReplica, first. The transaction is not read when one of them
+// isn't there.
+//
+func (b *BrBuilder) QuerySymbols(ctx context.Context, buildID string, filter query.Expr) ([]*Symbol, error) {
+	build := b.getBuild("", buildID)
+	if build == nil {
+		return nil, ErrBuildNotExist
+	}
+	if len(build.Supplements) == 0 && !b.metaHasSymbols(ctx, buildID, query.Conjuncts(filter)) {
+		return nil, nil
+	}
+
+	var syms []*Symbol
+	_, err := b.ParseSymbols(buildID, func(sym *Symbol) error {
+		if filter == nil || filter.Match(sym.Field) {
+			syms = append(syms, sym)
+		}
+		return nil
+	})
+	return syms, err
+}
+
+// metaHasSymbols check the name and hash indexes have transaction `id` for every `name=` and
+// `hash=` condition. True if not known, eg: the transaction isn't indexed yet. Lines are
+// only ever removed from transaction files, so a name or hash not indexed is not there.
+func (b *BrBuilder) metaHasSymbols(ctx context.Context, id string, conds []query.Expr) bool {
+	db := openMeta()
+	if db == nil {
+		return true
+	}
+	for _, e := range conds {
+		c, ok := e.(*query.Cond)
+		if !ok || c.Op != "=" || (c.Field != "name" && c.Field != "hash") {
+			continue
+		}
+		has, known, err := db.hasSymbol(ctx, b.StoreName, id, c.Field, c.Value)
+		if err != nil || !known {
+			return true
+		} else if !has {
+			return false
+		}
+	}
+	return true
+}
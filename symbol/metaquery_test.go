@@ -0,0 +1,83 @@
+package symbol
+
+import (
+	"context"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"sync"
+	"testing"
+
+	"github.com/adyzng/GoSymbols/config"
+	"github.com/adyzng/GoSymbols/query"
+)
+
+func TestMetaQuery(t *testing.T) {
+	root, err := ioutil.TempDir("", "metaquery")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(root)
+	config.MetadataDB = filepath.Join(root, "gosymbols.db")
+	metaOnce, metaStore = sync.Once{}, nil
+	defer func() {
+		if metaStore != nil {
+			metaStore.close()
+		}
+		config.MetadataDB = ""
+		metaOnce, metaStore = sync.Once{}, nil
+	}()
+
+	admin := filepath.Join(root, "store", adminDir)
+	os.MkdirAll(admin, 0755)
+	server := ""
+	for i, ver := range []string{"4175.2-538", "4175.2-539", "4175.2-540"} {
+		id := "000000000" + string(rune('1'+i))
+		ioutil.WriteFile(filepath.Join(admin, id), []byte("\"foo.pdb\\F"+id+"\",\"S:\\000Unzip\\x64\\foo.pdb\"\r\n"), 0644)
+		server += id + ",add,file,07/04/2017,14:44:14,\"UDP\",\"" + ver + "\",\"\",\r\n"
+	}
+	ioutil.WriteFile(filepath.Join(admin, serverTxt), []byte(server), 0644)
+	b := NewBranch2(&Branch{StoreName: "UDP", StorePath: filepath.Join(root, "store")}).(*BrBuilder)
+
+	cases := []struct {
+		expr string
+		ids  []string
+	}{
+		{"", []string{"0000000001", "0000000002", "0000000003"}},
+		{"id>=0000000002 AND version<4175.2-540", []string{"0000000002"}},
+		{"id=0000000003 AND release=false", []string{"0000000003"}},
+		{"id<0000000002 OR version>=4175.2-540", []string{"0000000001", "0000000003"}},
+		{"release=true", nil},
+	}
+	for _, c := range cases {
+		filter, err := query.Parse(c.expr, BuildFields)
+		if err != nil {
+			t.Fatal(err)
+		}
+		builds, err := b.QueryBuilds(context.Background(), filter)
+		if err != nil {
+			t.Fatal(err)
+		}
+		var ids []string
+		for _, build := range builds {
+			ids = append(ids, build.ID)
+		}
+		if len(ids) != len(c.ids) || (len(ids) != 0 && (ids[0] != c.ids[0] || ids[len(ids)-1] != c.ids[len(c.ids)-1])) {
+			t.Errorf("%q: expect %v, got %v", c.expr, c.ids, ids)
+		}
+	}
+	if _, ok := b.metaQueryBuilds(context.Background(), nil); !ok {
+		t.Fatal("expect builds queried from metadata database")
+	}
+
+	// name not in the index, the transaction file is not read
+	os.Remove(filepath.Join(admin, "0000000001"))
+	filter, _ := query.Parse("name=bar.pdb", SymbolFields)
+	if syms, err := b.QuerySymbols(context.Background(), "0000000001", filter); err != nil || len(syms) != 0 {
+		t.Fatalf("expect no symbol from index, got %d (%v)", len(syms), err)
+	}
+	filter, _ = query.Parse("name=foo.pdb AND arch=x64", SymbolFields)
+	if syms, err := b.QuerySymbols(context.Background(), "0000000002", filter); err != nil || len(syms) != 1 || syms[0].Hash != "F0000000002" {
+		t.Fatalf("unexpected symbols %v (%v)", syms, err)
+	}
+}
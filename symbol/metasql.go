@@ -0,0 +1,133 @@
+package symbol
+
+import (
+	"context"
+	"encoding/json"
+	"time"
+
+	"github.com/adyzng/GoSymbols/config"
+	"github.com/adyzng/GoSymbols/metastore"
+)
+
+// sqlMeta is the metadata database `[metadata] DSN` shared by the servers of a deployment,
+// reads of requests marked by WithReplica go to the replicas of `[metadata] READ_DSN`.
+type sqlMeta struct {
+	s *metastore.Store
+}
+
+// openSQL connect the database of `[metadata]`
+func openSQL() (*sqlMeta, error) {
+	s, err := metastore.Open(metastore.Options{
+		Driver:   config.MetadataDriver,
+		DSN:      config.MetadataDSN,
+		Replicas: config.MetadataReadDSN,
+		MaxLag:   time.Duration(config.MetadataMaxLag) * time.Second,
+	})
+	if err != nil {
+		return nil, err
+	}
+	return &sqlMeta{s: s}, nil
+}
+
+func (m *sqlMeta) close() error {
+	return m.s.Close()
+}
+
+func (m *sqlMeta) getBranch(ctx context.Context, name string, br *Branch) (bool, error) {
+	data, err := m.s.Branch(ctx, name)
+	if err != nil || data == nil {
+		return false, err
+	}
+	return true, json.Unmarshal(data, br)
+}
+
+func (m *sqlMeta) putBranch(br *Branch) error {
+	data, err := json.Marshal(br)
+	if err != nil {
+		return err
+	}
+	return m.s.PutBranch(br.StoreName, data)
+}
+
+func (m *sqlMeta) deleteBranch(name string) error {
+	return m.s.DeleteBranch(name)
+}
+
+func (m *sqlMeta) dropParsed(name string) error {
+	return m.s.DropParsed(name)
+}
+
+func (m *sqlMeta) builds(ctx context.Context, name, stamp, from, to string) ([]*Build, bool, error) {
+	recs, found, err := m.s.Builds(ctx, name, stamp, from, to)
+	if err != nil || !found {
+		return nil, false, err
+	}
+	builds := make([]*Build, 0, len(recs))
+	for _, rec := range recs {
+		build := &Build{}
+		if err = json.Unmarshal(rec.Data, build); err != nil {
+			return nil, false, err
+		}
+		builds = append(builds, build)
+	}
+	return builds, true, nil
+}
+
+func (m *sqlMeta) putBuilds(name, stamp string, builds []*Build) error {
+	recs := make([]*metastore.Record, 0, len(builds))
+	for _, build := range builds {
+		data, err := json.Marshal(build)
+		if err != nil {
+			return err
+		}
+		recs = append(recs, &metastore.Record{ID: build.ID, Data: data})
+	}
+	return m.s.PutBuilds(name, stamp, recs)
+}
+
+func (m *sqlMeta) transaction(ctx context.Context, name, id, stamp string) ([]*txEntry, bool, error) {
+	data, found, err := m.s.Transaction(ctx, name, id, stamp)
+	if err != nil || !found {
+		return nil, false, err
+	}
+	var entries []*txEntry
+	if err = json.Unmarshal(data, &entries); err != nil {
+		return nil, false, err
+	}
+	return entries, true, nil
+}
+
+func (m *sqlMeta) putTransaction(name, id, stamp string, entries []*txEntry) error {
+	data, err := json.Marshal(entries)
+	if err != nil {
+		return err
+	}
+	syms := make([]*metastore.Symbol, 0, len(entries))
+	for _, e := range entries {
+		syms = append(syms, &metastore.Symbol{Name: e.Name, Hash: e.Hash})
+	}
+	return m.s.PutTransaction(name, id, stamp, data, syms)
+}
+
+func (m *sqlMeta) hasSymbol(ctx context.Context, name, id, field, value string) (has, known bool, err error) {
+	return m.s.HasSymbol(ctx, name, id, field, value)
+}
+
+func (m *sqlMeta) findHash(ctx context.Context, hash string) ([]*metaRef, error) {
+	return toMetaRefs(m.s.FindHash(ctx, hash))
+}
+
+func (m *sqlMeta) findNames(ctx context.Context, prefix string) ([]*metaRef, error) {
+	return toMetaRefs(m.s.FindNames(ctx, prefix))
+}
+
+func toMetaRefs(arr []*metastore.Ref, err error) ([]*metaRef, error) {
+	if err != nil {
+		return nil, err
+	}
+	refs := make([]*metaRef, 0, len(arr))
+	for _, ref := range arr {
+		refs = append(refs, &metaRef{branch: ref.Branch, id: ref.ID, name: ref.Name})
+	}
+	return refs, nil
+}
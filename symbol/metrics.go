@@ -0,0 +1,112 @@
+package symbol
+
+import (
+	"os"
+	"path/filepath"
+	"sync"
+	"time"
+
+	"github.com/adyzng/GoSymbols/config"
+	"github.com/adyzng/GoSymbols/metrics"
+	log "gopkg.in/clog.v1"
+)
+
+// storeUsage is the disk usage of stores, walking them is too slow for every scrape
+var storeUsage struct {
+	sync.Mutex
+	bytes   map[string]int64
+	updated time.Time
+	running bool
+}
+
+func init() {
+	metrics.OnScrape(scrapeStores)
+}
+
+// scrapeStores set store gauges of all branches, disk usage is refreshed in background
+// once older than `[metrics] DISK_INTERVAL`, the previous one is exposed meanwhile.
+func scrapeStores() {
+	ss := symSvr
+	if ss == nil {
+		return
+	}
+	stores := make(map[string]string)
+	metrics.StoreBuilds.Reset()
+	ss.WalkBuilders(func(bu Builder) error {
+		b, ok := bu.(*BrBuilder)
+		if !ok || b.Server != "" {
+			return nil
+		}
+		stores[b.Name()] = b.StorePath
+		metrics.StoreBuilds.Set(float64(b.BuildsCount), b.Name())
+		return nil
+	})
+
+	storeUsage.Lock()
+	defer storeUsage.Unlock()
+	metrics.StoreBytes.Reset()
+	for name := range stores {
+		if n, ok := storeUsage.bytes[name]; ok {
+			metrics.StoreBytes.Set(float64(n), name)
+		}
+	}
+	if storeUsage.running || time.Since(storeUsage.updated) < time.Duration(config.MetricsDiskInterval)*time.Second {
+		return
+	}
+	storeUsage.running = true
+	go func() {
+		usage := make(map[string]int64, len(stores))
+		for name, root := range stores {
+			usage[name] = diskUsage(root)
+		}
+		storeUsage.Lock()
+		storeUsage.bytes, storeUsage.updated, storeUsage.running = usage, time.Now(), false
+		storeUsage.Unlock()
+	}()
+}
+
+// diskUsage return total size of files under `root`
+func diskUsage(root string) int64 {
+	var n int64
+	err := filepath.Walk(root, func(path string, fi os.FileInfo, err error) error {
+		if err == nil && !fi.IsDir() {
+			n += fi.Size()
+		}
+		return nil
+	})
+	if err != nil {
+		log.Warn("[Metrics] Walk store %s failed: %v.", root, err)
+	}
+	return n
+}
+
+// observeIngest count the ingest of `in` finished in status `to`.
+func observeIngest(in *ingest, to BuildStatus) {
+	name := in.b.Name()
+	switch to {
+	case StatusComplete:
+		metrics.BuildsIngested.Inc(name)
+		metrics.LastIngest.Set(float64(now().Unix()), name)
+		files := 0
+		for _, build := range in.builds {
+			if keys, err := in.b.transactionKeys(build.ID); err == nil {
+				files += len(keys)
+			}
+		}
+		metrics.SymbolsStored.Add(float64(files), name)
+	case StatusFailed:
+		metrics.IngestFailures.Inc(name)
+	}
+}
+
+// observeStages add ingest stage durations to the stage histogram.
+func observeStages(t *StageTimings) {
+	for stage, ms := range map[string]int64{
+		"copy":     t.Copy,
+		"unzip":    t.Unzip,
+		"symstore": t.SymStore,
+		"metadata": t.Metadata,
+	} {
+		metrics.IngestStage.Observe(float64(ms)/1000, stage)
+	}
+}
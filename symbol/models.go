@@ -1,36 +1,87 @@
 package symbol
 
+import (
+	"context"
+
+	"github.com/adyzng/GoSymbols/query"
+	"github.com/adyzng/GoSymbols/sourceindex"
+)
+
 // Branch ... information
 //
 type Branch struct {
-	BuildName   string `json:"buildName"`
-	StoreName   string `json:"storeName"`
-	BuildPath   string `json:"buildPath"`
-	StorePath   string `json:"storePath"`
-	UpdateDate  string `json:"updateDate"`
-	LatestBuild string `json:"latestBuild"`
-	BuildsCount int    `json:"buildsCount"`
+	ID          string   `json:"id,omitempty"` // internal ID, stable across rename and migration
+	BuildName   string   `json:"buildName"`
+	StoreName   string   `json:"storeName"`
+	BuildPath   string   `json:"buildPath"`
+	StorePath   string   `json:"storePath"`
+	UpdateDate  string   `json:"updateDate"`
+	LatestBuild string   `json:"latestBuild"`
+	BuildsCount int      `json:"buildsCount"`
+	Priority    Priority `json:"priority"` // default priority of ingest jobs
+
+	ConflictPolicy string `json:"conflictPolicy,omitempty"` // override config.ConflictPolicy
+	Server         string `json:"server,omitempty"`         // peer which hold the branch in federation mode, empty for local
+	Archive        string `json:"archive,omitempty"`        // exported archive mounted as read-only branch
+	Layout         int    `json:"layout,omitempty"`         // LayoutFlat or LayoutTwoTier, decided by the first ingest
+	Encrypted      bool   `json:"encrypted,omitempty"`      // symbol files are sealed by the branch key, see package encrypt
+	Shared         bool   `json:"shared,omitempty"`         // store root shared with other branches, builds attributed by product
+	Feed           string `json:"feed,omitempty"`           // NuGet v3 feed to pull symbol packages from instead of build server
+	Package        string `json:"package,omitempty"`        // package ID on Feed, its versions are the builds
+	VirtualDir     string `json:"virtualDir,omitempty"`     // also serve the branch as an symstore share at `/{VirtualDir}/`
+	VersionFormat  string `json:"versionFormat,omitempty"`  // regexp with numeric capture groups to order versions, see ParseVersion
+	Backend        string `json:"backend,omitempty"`        // object storage url holding the store, StorePath is its cache, see storage.Open
+	Detector       string `json:"detector,omitempty"`       // how the latest build is found on build server, see ParseDetector
+	SLO            int    `json:"slo,omitempty"`            // minutes from build completion to symbols available, 0 not tracked
+	Schedule       string `json:"schedule,omitempty"`       // ScheduleAuto or ScheduleManual, empty for auto
+
+	Channels  []*Channel `json:"channels,omitempty"`  // rules tagging builds with nightly, beta, ga...
+	Retention *Retention `json:"retention,omitempty"` // prune old builds on schedule, see BrBuilder.Prune
+
+	SourceIndex *sourceindex.Config `json:"sourceIndex,omitempty"` // srcsrv stream embedded in pdbs at ingest, override `[srcsrv]`
+
+	Renames []RenameRule `json:"renames,omitempty"` // normalize published file names at ingest
+	Sealed  *Seal        `json:"sealed,omitempty"`  // immutable branch, see BrBuilder.Seal
 }
 
 // Build ... analyze from server.txt
 //
 type Build struct {
-	ID      string `json:"id"`
-	Date    string `json:"date"`
-	Branch  string `json:"branch"`
-	Version string `json:"version"`
-	Comment string `json:"comment"`
+	ID           string        `json:"id"`
+	Key          string        `json:"key"` // `{store}@{id}`, unique across branches, see BuildKey
+	Date         string        `json:"date"`
+	Branch       string        `json:"branch"`
+	Store        string        `json:"store"` // store name of the branch holding the build
+	Version      string        `json:"version"`
+	Comment      string        `json:"comment"`
+	SupplementOf string        `json:"supplementOf,omitempty"` // parent build ID of an supplementary transaction
+	Supplements  []string      `json:"supplements,omitempty"`  // supplementary transaction IDs
+	Release      bool          `json:"release,omitempty"`      // marked as release, unsigned binaries block it
+	Stages       *StageTimings `json:"stages,omitempty"`       // ingest stage durations, nil for builds added before
+	Hold         *Hold         `json:"hold,omitempty"`         // legal hold, nil if not held
+	Part         string        `json:"part,omitempty"`         // `{n}/{total}` of an ingest split into transactions
+	Channel      string        `json:"channel,omitempty"`      // eg: nightly, beta or ga, see Branch.Channels
+	Latency      *Latency      `json:"latency,omitempty"`      // time from build completion to symbols available
+	Tickets      []string      `json:"tickets,omitempty"`      // Jira issue keys linked to the build
+	Validation   *Validation   `json:"validation,omitempty"`   // pdb validation before symstore, nil if disabled
+	Status       BuildStatus   `json:"status"`                 // lifecycle state, see BuildStatus
 }
 
 // Symbol represent each symbol file's detail
 //
 type Symbol struct {
-	Arch    string `json:"arch"` // x64 or x86
-	Hash    string `json:"hash"`
-	Name    string `json:"name"`
-	Path    string `json:"path"`
-	URL     string `json:"url"`
-	Version string `json:"version"`
+	Arch         string `json:"arch"` // x64 or x86
+	Hash         string `json:"hash"`
+	Name         string `json:"name"`
+	Path         string `json:"path"`
+	URL          string `json:"url"`
+	Version      string `json:"version"`
+	Transaction  string `json:"transaction,omitempty"`  // transaction ID which add the symbol
+	Store        string `json:"store,omitempty"`        // store name of the branch holding the symbol
+	BuildKey     string `json:"buildKey,omitempty"`     // unique key of the transaction, see BuildKey
+	SupersededBy string `json:"supersededBy,omitempty"` // transaction ID which re-publish the symbol
+	ReplacedAt   string `json:"replacedAt,omitempty"`   // date of the superseding transaction
+	Original     string `json:"original,omitempty"`     // published file name before rename rules
 }
 
 // Builder interface
@@ -51,7 +102,11 @@ type Builder interface {
 
 	// Add an given build pdb to symbol server.
 	// if `buildVersion` is empty, it will try to add the latest build on build server if exist.
-	AddBuild(buildVerion string) error
+	// The ingest is aborted when `ctx` is done.
+	AddBuild(ctx context.Context, buildVerion string) error
+
+	// AddSupplement add only the pdbs matching `files` of an exist build as supplementary transaction.
+	AddSupplement(version string, files []string) (*Build, error)
 
 	// GetSymbolPath get given symbol file full path on symbol server.
 	// The path can be used to serve download.
@@ -59,9 +114,20 @@ type Builder interface {
 
 	// ParseBuilds parse all version of builds that already in the symbol server of curent branch.
 	//
-	ParseBuilds(handler func(b *Build) error) (int, error)
+	ParseBuilds(ctx context.Context, handler func(b *Build) error) (int, error)
 
 	// ParseSymbols parse all the symbols of given build vesrion
 	//
 	ParseSymbols(buildID string, handler func(sym *Symbol) error) (int, error)
+
+	// QueryBuilds return builds matching `filter` (all if nil), see query.Parse.
+	//
+	QueryBuilds(ctx context.Context, filter query.Expr) ([]*Build, error)
+
+	// QuerySymbols return symbols of given build matching `filter` (all if nil).
+	//
+	QuerySymbols(ctx context.Context, buildID string, filter query.Expr) ([]*Symbol, error)
+
+	// GetLatestID return the last transaction ID of the store.
+	GetLatestID() string
 }
@@ -0,0 +1,194 @@
+package symbol
+
+import (
+	"context"
+	"fmt"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+
+	"github.com/adyzng/GoSymbols/config"
+	"github.com/adyzng/GoSymbols/pdb"
+	log "gopkg.in/clog.v1"
+)
+
+const pingmeTxt = "pingme.txt" // created by symstore.exe in store root, symsrv probe it
+
+// nativeSymStore write store and admin files the same way as `symstore.exe add /r`, so
+// stores can be fed on hosts without the Windows Debugging Tools, eg: linux containers.
+type nativeSymStore struct{}
+
+// native check if `[base] SYMSTORE_EXE` ask for the built-in store writer
+func native() bool {
+	return config.SymStoreExe == "" || strings.EqualFold(config.SymStoreExe, "native")
+}
+
+// autoSymStore call symstore.exe if configured, or nativeSymStore
+type autoSymStore struct{}
+
+func (autoSymStore) Add(ctx context.Context, store, product, version, comment, symbols string) ([]byte, error) {
+	if native() {
+		return nativeSymStore{}.Add(ctx, store, product, version, comment, symbols)
+	}
+	return execSymStore{}.Add(ctx, store, product, version, comment, symbols)
+}
+
+func (nativeSymStore) Add(ctx context.Context, store, product, version, comment, symbols string) ([]byte, error) {
+	// fields are quoted in server.txt without escaping, like symstore.exe
+	for _, field := range []string{product, version, comment} {
+		if strings.ContainsAny(field, "\"\r\n") {
+			return nil, fmt.Errorf("invalid quote or line break in %q", field)
+		}
+	}
+	defer acquireSymStore()()
+
+	admin := filepath.Join(store, adminDir)
+	if err := os.MkdirAll(admin, 0755); err != nil {
+		return nil, err
+	}
+	_, err := os.Stat(filepath.Join(store, index2Txt))
+	twoTier := err == nil
+
+	var (
+		lines  []string
+		failed int
+	)
+	err = filepath.Walk(symbols, func(fpath string, info os.FileInfo, err error) error {
+		if err != nil || info.IsDir() || !pdb.IsSymbolFile(info.Name()) {
+			return err
+		}
+		if err = ctx.Err(); err != nil {
+			return err
+		}
+		key, err := pdb.Key(fpath)
+		if err != nil {
+			// symstore.exe skip unknown files and count them as errors
+			log.Warn("[Branch] Skip %s: %v.", fpath, err)
+			failed++
+			return nil
+		}
+		name := info.Name()
+		dir := filepath.Join(store, name, key)
+		if twoTier {
+			dir = filepath.Join(store, tierDir(name), name, key)
+		}
+		if err = os.MkdirAll(dir, 0755); err != nil {
+			return err
+		}
+		if config.Compress {
+			err = storeCompressed(ctx, fpath, filepath.Join(dir, name))
+		} else {
+			err = storeFile(ctx, fpath, filepath.Join(dir, name))
+		}
+		if err != nil {
+			return err
+		}
+		lines = append(lines, fmt.Sprintf("\"%s\\%s\",\"%s\"\r\n", name, key, strings.Replace(fpath, "/", "\\", -1)))
+		return nil
+	})
+	if err != nil {
+		return nil, err
+	}
+	if len(lines) == 0 {
+		// symstore.exe add no transaction without files stored
+		return []byte(fmt.Sprintf("SYMSTORE: Number of files stored = 0\nSYMSTORE: Number of errors = %d", failed)), nil
+	}
+	last, _ := ioutil.ReadFile(filepath.Join(admin, lastidTxt))
+	n, _ := strconv.Atoi(strings.TrimSpace(string(last)))
+	id := fmt.Sprintf("%010d", n+1)
+	if err = writeFileAtomic(filepath.Join(admin, id), []byte(strings.Join(lines, ""))); err != nil {
+		return nil, err
+	}
+
+	t := now()
+	record := fmt.Sprintf("%s,add,file,%s,%s,\"%s\",\"%s\",\"%s\",\r\n",
+		id, t.Format("01/02/2006"), t.Format("15:04:05"), product, version, comment)
+	for _, name := range []string{serverTxt, historyTxt} {
+		if err = appendLine(filepath.Join(admin, name), record); err != nil {
+			return nil, err
+		}
+	}
+	// lastid.txt is written last, readers only see complete transactions
+	if err = writeFileAtomic(filepath.Join(admin, lastidTxt), []byte(id)); err != nil {
+		return nil, err
+	}
+	if _, err = os.Stat(filepath.Join(store, pingmeTxt)); os.IsNotExist(err) {
+		ioutil.WriteFile(filepath.Join(store, pingmeTxt), nil, 0644)
+	}
+	return []byte(fmt.Sprintf("SYMSTORE: Number of files stored = %d\nSYMSTORE: Number of errors = %d",
+		len(lines), failed)), nil
+}
+
+// storeFile copy symbol file `src` to `dst` through a temp file, so symsrv clients never
+// download a partial file.
+func storeFile(ctx context.Context, src, dst string) error {
+	in, err := os.Open(src)
+	if err != nil {
+		return err
+	}
+	defer in.Close()
+
+	tmp := dst + ".tmp"
+	out, err := os.Create(tmp)
+	if err != nil {
+		return err
+	}
+	if _, err = copyContext(ctx, out, in); err != nil {
+		out.Close()
+		os.Remove(tmp)
+		return err
+	}
+	if err = out.Close(); err != nil {
+		os.Remove(tmp)
+		return err
+	}
+	return os.Rename(tmp, dst)
+}
+
+// storeCompressed store symbol file `src` as the cab file of `dst`, eg: foo.pdb => foo.pd_.
+// Files over 2GB don't fit in a cab file written natively, they are stored as is.
+func storeCompressed(ctx context.Context, src, dst string) error {
+	if err := ctx.Err(); err != nil {
+		return err
+	}
+	cab := filepath.Join(filepath.Dir(dst), pdb.CompressedName(filepath.Base(dst)))
+	tmp := cab + ".tmp"
+	err := SymCompressor.Compress(src, tmp)
+	if err == pdb.ErrCabTooLarge {
+		os.Remove(tmp)
+		return storeFile(ctx, src, dst)
+	}
+	if err == nil {
+		err = os.Rename(tmp, cab)
+	}
+	if err != nil {
+		os.Remove(tmp)
+	}
+	return err
+}
+
+// nativeCab write MSZIP cab files without makecab.exe
+type nativeCab struct{}
+
+func (nativeCab) Compress(src, dst string) error {
+	in, err := os.Open(src)
+	if err != nil {
+		return err
+	}
+	defer in.Close()
+	st, err := in.Stat()
+	if err != nil {
+		return err
+	}
+	out, err := os.Create(dst)
+	if err != nil {
+		return err
+	}
+	if err = pdb.WriteCab(out, filepath.Base(src), st.ModTime(), in); err != nil {
+		out.Close()
+		return err
+	}
+	return out.Close()
+}
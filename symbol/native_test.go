@@ -0,0 +1,115 @@
+package symbol
+
+import (
+	"bytes"
+	"context"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/adyzng/GoSymbols/config"
+	"github.com/adyzng/GoSymbols/pdb"
+)
+
+func TestNativeSymStore(t *testing.T) {
+	root, err := ioutil.TempDir("", "native")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(root)
+	defer func(exe string) { config.SymStoreExe = exe }(config.SymStoreExe)
+	config.SymStoreExe = "native"
+
+	symbols, store := filepath.Join(root, "symbols"), filepath.Join(root, "store")
+	os.MkdirAll(filepath.Join(symbols, "x64"), 0755)
+	ioutil.WriteFile(filepath.Join(symbols, "foo.dll"), fakePE(1), 0644)
+	ioutil.WriteFile(filepath.Join(symbols, "x64", "bar.exe"), fakePE(2), 0644)
+	ioutil.WriteFile(filepath.Join(symbols, "broken.pdb"), []byte("not a pdb"), 0644)
+	ioutil.WriteFile(filepath.Join(symbols, "readme.txt"), []byte("ignored"), 0644)
+
+	output, err := SymStore.Add(context.Background(), store, "UDP", "100", "comment", symbols)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !strings.Contains(string(output), "stored = 2") || !strings.Contains(string(output), "errors = 1") {
+		t.Errorf("unexpected output %q", output)
+	}
+	for _, rel := range []string{"foo.dll/59C0C5B3a3000/foo.dll", "bar.exe/59C0C5B3a3000/bar.exe", pingmeTxt} {
+		if _, err := os.Stat(filepath.Join(store, filepath.FromSlash(rel))); err != nil {
+			t.Errorf("expect %s in store: %v", rel, err)
+		}
+	}
+
+	// second transaction into a two-tier store
+	ioutil.WriteFile(filepath.Join(store, index2Txt), nil, 0644)
+	os.Remove(filepath.Join(symbols, "x64", "bar.exe"))
+	if _, err = SymStore.Add(context.Background(), store, "UDP", "101", "comment", symbols); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := os.Stat(filepath.Join(store, "fo", "foo.dll", "59C0C5B3a3000", "foo.dll")); err != nil {
+		t.Errorf("expect two-tier layout: %v", err)
+	}
+	if data, _ := ioutil.ReadFile(filepath.Join(store, adminDir, lastidTxt)); string(data) != "0000000002" {
+		t.Errorf("unexpected lastid %q", data)
+	}
+	if data, _ := ioutil.ReadFile(filepath.Join(store, adminDir, "0000000002")); !strings.HasPrefix(string(data), "\"foo.dll\\59C0C5B3a3000\",") {
+		t.Errorf("unexpected transaction %q", data)
+	}
+
+	// no transaction without files stored, quotes would break server.txt
+	empty := filepath.Join(root, "empty")
+	os.MkdirAll(empty, 0755)
+	if output, err = SymStore.Add(context.Background(), store, "UDP", "102", "comment", empty); err != nil || !strings.Contains(string(output), "stored = 0") {
+		t.Errorf("unexpected output %q (%v)", output, err)
+	}
+	if _, err = SymStore.Add(context.Background(), store, "UDP", "103", `say "hi"`, symbols); err == nil {
+		t.Errorf("expect comment with quotes refused")
+	}
+	if data, _ := ioutil.ReadFile(filepath.Join(store, adminDir, lastidTxt)); string(data) != "0000000002" {
+		t.Errorf("expect no transaction added, got lastid %q", data)
+	}
+
+	b := NewBranch2(&Branch{StoreName: "UDP", StorePath: store, BuildPath: root}).(*BrBuilder)
+	if n, err := b.ParseBuilds(context.Background(), nil); n != 2 || err != nil {
+		t.Errorf("expect 2 builds parsed, got %d (%v)", n, err)
+	}
+}
+
+func TestNativeCompress(t *testing.T) {
+	root, err := ioutil.TempDir("", "compress")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(root)
+	defer func(exe, cab string, compress bool) {
+		config.SymStoreExe, config.MakeCabExe, config.Compress = exe, cab, compress
+	}(config.SymStoreExe, config.MakeCabExe, config.Compress)
+	config.SymStoreExe, config.MakeCabExe, config.Compress = "native", "", true
+
+	symbols, store := filepath.Join(root, "symbols"), filepath.Join(root, "store")
+	os.MkdirAll(symbols, 0755)
+	ioutil.WriteFile(filepath.Join(symbols, "foo.dll"), fakePE(1), 0644)
+	if _, err = SymStore.Add(context.Background(), store, "UDP", "100", "comment", symbols); err != nil {
+		t.Fatal(err)
+	}
+	dir := filepath.Join(store, "foo.dll", "59C0C5B3a3000")
+	if _, err = os.Stat(filepath.Join(dir, "foo.dll")); !os.IsNotExist(err) {
+		t.Errorf("expect only the compressed file stored: %v", err)
+	}
+
+	b := NewBranch2(&Branch{StoreName: "UDP", StorePath: store}).(*BrBuilder)
+	fd, err := os.Open(b.GetSymbolPath("59C0C5B3a3000", "foo.dl_"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer fd.Close()
+	cab, err := pdb.OpenCab(fd)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if data, _ := ioutil.ReadAll(cab); cab.Name != "foo.dll" || !bytes.Equal(data, fakePE(1)) {
+		t.Errorf("unexpected cab file %s of %d bytes", cab.Name, len(data))
+	}
+}
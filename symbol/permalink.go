@@ -0,0 +1,257 @@
+package symbol
+
+import (
+	"context"
+	"crypto/rand"
+	"encoding/base32"
+	"encoding/json"
+	"fmt"
+	"io/ioutil"
+	"net/url"
+	"os"
+	"path/filepath"
+	"strings"
+	"sync"
+
+	"github.com/adyzng/GoSymbols/config"
+	log "gopkg.in/clog.v1"
+)
+
+const (
+	permalinkFile = "permalinks.json" // under config.Destination, moved together with the store
+	maxPermalinks = 100000            // links are never removed, so their count is capped
+)
+
+// Permalink target kinds
+const (
+	LinkBuild  = "build"
+	LinkSymbol = "symbol"
+	LinkSearch = "search" // symbols of build filtered by `query`
+)
+
+var (
+	ErrLinkNotExist = fmt.Errorf("permalink not exist")
+	ErrLinkTarget   = fmt.Errorf("permalink target not exist")
+	ErrTooManyLinks = fmt.Errorf("more than %d permalinks", maxPermalinks)
+)
+
+// Permalink is an stable reference to build, symbol or search result. Branch is referred
+// by its internal ID, so the link still resolve after the branch is renamed or moved.
+//
+type Permalink struct {
+	ID       string `json:"id"`
+	Kind     string `json:"kind"`
+	BranchID string `json:"branchID"`
+	Branch   string `json:"branch"` // branch name when created, used if branch ID is lost
+	Build    string `json:"build,omitempty"`
+	Name     string `json:"name,omitempty"`
+	Hash     string `json:"hash,omitempty"`
+	Query    string `json:"query,omitempty"`
+	Created  string `json:"created"`
+	Creator  string `json:"creator,omitempty"`
+}
+
+// linkStore keep all permalinks in memory, saved on change
+type linkStore struct {
+	mx     sync.RWMutex
+	loaded bool
+	links  map[string]*Permalink
+}
+
+func randomID(n int) string {
+	buf := make([]byte, n)
+	rand.Read(buf)
+	return strings.ToLower(base32.StdEncoding.WithPadding(base32.NoPadding).EncodeToString(buf))
+}
+
+func (ls *linkStore) load() {
+	if ls.loaded {
+		return
+	}
+	ls.loaded = true
+	ls.links = make(map[string]*Permalink)
+	data, err := ioutil.ReadFile(filepath.Join(config.Destination, permalinkFile))
+	if err != nil {
+		if !os.IsNotExist(err) {
+			log.Error(2, "[Link] Load permalinks failed: %v.", err)
+		}
+		return
+	}
+	var links []*Permalink
+	if err = json.Unmarshal(data, &links); err != nil {
+		log.Error(2, "[Link] Decode permalinks failed: %v.", err)
+		return
+	}
+	for _, l := range links {
+		ls.links[l.ID] = l
+	}
+}
+
+func (ls *linkStore) save() error {
+	links := make([]*Permalink, 0, len(ls.links))
+	for _, l := range ls.links {
+		links = append(links, l)
+	}
+	data, _ := json.MarshalIndent(links, "", "\t")
+	return writeFileAtomic(filepath.Join(config.Destination, permalinkFile), data)
+}
+
+// branchID return the internal ID of branch, generated and persisted on first use
+func (ss *sserver) branchID(b Builder) string {
+	br := b.GetBranch()
+	ss.lck.Lock()
+	id, created := br.ID, false
+	if id == "" {
+		br.ID = randomID(10)
+		id, created = br.ID, true
+	}
+	ss.lck.Unlock()
+
+	if created {
+		if bb, ok := b.(*BrBuilder); ok {
+			bb.Persist()
+		}
+		ss.SaveBranchs("")
+	}
+	return id
+}
+
+// findBranch lookup branch by internal ID first, then by name
+func (ss *sserver) findBranch(id, name string) Builder {
+	var found Builder
+	if id != "" {
+		ss.WalkBuilders(func(b Builder) error {
+			if b.GetBranch().ID == id {
+				found = b
+				return errFound
+			}
+			return nil
+		})
+	}
+	if found == nil {
+		found = ss.Get(name)
+	}
+	return found
+}
+
+func hasBuild(b Builder, id string) bool {
+	found := false
+	b.ParseBuilds(context.Background(), func(bd *Build) error {
+		if bd.ID == id {
+			found = true
+			return errFound
+		}
+		return nil
+	})
+	return found
+}
+
+// CreatePermalink validate the target and return its permalink, exist one is reused.
+//
+func (ss *sserver) CreatePermalink(link *Permalink) (*Permalink, error) {
+	b := ss.Get(link.Branch)
+	if b == nil {
+		return nil, ErrBranchNotInit
+	}
+	switch link.Kind {
+	case LinkBuild, LinkSearch:
+		if !hasBuild(b, link.Build) {
+			return nil, ErrBuildNotExist
+		}
+	case LinkSymbol:
+		if link.Name == "" || link.Hash == "" {
+			return nil, ErrLinkTarget
+		}
+		if _, err := os.Stat(b.GetSymbolPath(link.Hash, link.Name)); err != nil {
+			return nil, ErrLinkTarget
+		}
+	default:
+		return nil, fmt.Errorf("unknown permalink kind %q", link.Kind)
+	}
+
+	nl := *link
+	nl.Branch = b.Name()
+	if nl.Kind == LinkSymbol {
+		nl.Build = ""
+	}
+	if nl.Kind != LinkSearch {
+		nl.Query = ""
+	} else if filter, err := url.ParseQuery(nl.Query); err == nil {
+		// the link is pinned to its branch and build, equal filters share one link
+		filter.Del("branch")
+		filter.Del("build")
+		nl.Query = filter.Encode()
+	} else {
+		return nil, fmt.Errorf("invalid permalink query: %v", err)
+	}
+	if nl.Kind != LinkSymbol {
+		nl.Name, nl.Hash = "", ""
+	}
+	nl.BranchID = ss.branchID(b)
+
+	ls := ss.links
+	ls.mx.Lock()
+	defer ls.mx.Unlock()
+	ls.load()
+	for _, l := range ls.links {
+		if l.Kind == nl.Kind && l.BranchID == nl.BranchID && l.Build == nl.Build &&
+			strings.EqualFold(l.Name, nl.Name) && strings.EqualFold(l.Hash, nl.Hash) && l.Query == nl.Query {
+			return l, nil
+		}
+	}
+
+	if len(ls.links) >= maxPermalinks {
+		return nil, ErrTooManyLinks
+	}
+	nl.ID = randomID(5)
+	for ls.links[nl.ID] != nil {
+		nl.ID = randomID(5)
+	}
+	nl.Created = timestamp(now())
+	ls.links[nl.ID] = &nl
+	if err := ls.save(); err != nil {
+		delete(ls.links, nl.ID)
+		log.Error(2, "[Link] Save permalinks failed: %v.", err)
+		return nil, err
+	}
+	log.Info("[Link] Create permalink %s => %s %s %s%s.", nl.ID, nl.Kind, nl.Branch, nl.Build, nl.Name)
+	return &nl, nil
+}
+
+// ResolvePermalink return the link with current branch name, and the url to open it.
+//
+func (ss *sserver) ResolvePermalink(id string) (*Permalink, string, error) {
+	ls := ss.links
+	ls.mx.Lock()
+	ls.load()
+	link, ok := ls.links[strings.ToLower(id)]
+	ls.mx.Unlock()
+	if !ok {
+		return nil, "", ErrLinkNotExist
+	}
+
+	b := ss.findBranch(link.BranchID, link.Branch)
+	if b == nil {
+		return nil, "", ErrLinkTarget
+	}
+	resolved := *link
+	resolved.Branch = b.Name()
+
+	q := url.Values{}
+	switch link.Kind {
+	case LinkSymbol:
+		return &resolved, config.URL(fmt.Sprintf("/api/symbol/%s/%s/%s",
+			url.PathEscape(resolved.Branch), url.PathEscape(link.Hash), url.PathEscape(link.Name))), nil
+	case LinkSearch:
+		if filter, err := url.ParseQuery(link.Query); err == nil {
+			q = filter
+		}
+	}
+	if !hasBuild(b, link.Build) {
+		return &resolved, "", ErrLinkTarget
+	}
+	// set last, stored filters never override the pinned branch and build
+	q.Set("branch", resolved.Branch)
+	q.Set("build", link.Build)
+	return &resolved, config.URL("/#/symbols?" + q.Encode()), nil
+}
@@ -0,0 +1,72 @@
+package symbol
+
+import (
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/adyzng/GoSymbols/config"
+)
+
+func TestPermalinkRename(t *testing.T) {
+	root, err := ioutil.TempDir("", "permalink")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(root)
+
+	config.Destination = root
+	config.AppPath = root
+	store := filepath.Join(root, "UDPv6.5")
+	os.MkdirAll(filepath.Join(store, adminDir), 0755)
+	os.MkdirAll(filepath.Join(store, "foo.pdb", "AAAA1"), 0755)
+	ioutil.WriteFile(filepath.Join(store, "foo.pdb", "AAAA1", "foo.pdb"), []byte("pdb"), 0644)
+
+	b := NewBranch2(&Branch{StoreName: "UDPv6.5", StorePath: store, BuildPath: store}).(*BrBuilder)
+	b.addBuild(&Build{ID: "0000000001", Version: "100"})
+	ss := &sserver{
+		builders: map[string]Builder{"udpv6.5": b},
+		links:    &linkStore{},
+	}
+
+	link, err := ss.CreatePermalink(&Permalink{Kind: LinkSearch, Branch: "udpv6.5", Build: "0000000001", Query: "type=name&q=foo"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	again, _ := ss.CreatePermalink(&Permalink{Kind: LinkSearch, Branch: "UDPv6.5", Build: "0000000001", Query: "q=foo&type=name&branch=Other"})
+	if again.ID != link.ID {
+		t.Fatalf("expect same link reused, got %s and %s", link.ID, again.ID)
+	}
+	sym, err := ss.CreatePermalink(&Permalink{Kind: LinkSymbol, Branch: "UDPv6.5", Name: "foo.pdb", Hash: "AAAA1"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, err = ss.CreatePermalink(&Permalink{Kind: LinkBuild, Branch: "UDPv6.5", Build: "0000000009"}); err != ErrBuildNotExist {
+		t.Fatalf("expect build not exist, got %v", err)
+	}
+
+	// rename branch, links follow the branch ID
+	delete(ss.builders, "udpv6.5")
+	b.StoreName = "UDPv6.5-Archived"
+	ss.builders["udpv6.5-archived"] = b
+	ss.links = &linkStore{}
+
+	_, target, err := ss.ResolvePermalink(link.ID)
+	if err != nil || !strings.HasPrefix(target, "/#/symbols?") || !strings.Contains(target, "branch=UDPv6.5-Archived") ||
+		!strings.Contains(target, "q=foo") {
+		t.Fatalf("unexpected target %s (%v)", target, err)
+	}
+	_, target, err = ss.ResolvePermalink(sym.ID)
+	if err != nil || target != "/api/symbol/UDPv6.5-Archived/AAAA1/foo.pdb" {
+		t.Fatalf("unexpected target %s (%v)", target, err)
+	}
+	ss.links.links[link.ID].Query = "q=foo&branch=Other&build=0000000009"
+	if _, target, _ = ss.ResolvePermalink(link.ID); strings.Contains(target, "Other") || strings.Contains(target, "0000000009") {
+		t.Fatalf("stored filter override the pinned branch: %s", target)
+	}
+	if _, _, err = ss.ResolvePermalink("nothing"); err != ErrLinkNotExist {
+		t.Fatalf("expect link not exist, got %v", err)
+	}
+}
@@ -0,0 +1,85 @@
+package symbol
+
+import (
+	"encoding/json"
+	"fmt"
+	"reflect"
+	"sort"
+	"strings"
+)
+
+var (
+	ErrBranchUnusable = fmt.Errorf("neither build path nor store path of branch is accessible")
+)
+
+// BranchChange is one setting of a branch changed by modify
+//
+type BranchChange struct {
+	Field string      `json:"field"` // json name, eg: retention
+	From  interface{} `json:"from,omitempty"`
+	To    interface{} `json:"to,omitempty"`
+}
+
+// ModifyPreview is the change set of modifying a branch, computed without applying it
+//
+type ModifyPreview struct {
+	Branch    string          `json:"branch"`
+	Changes   []*BranchChange `json:"changes"`
+	Retention *RetentionPlan  `json:"retention,omitempty"` // builds the new retention would prune, if it changed
+}
+
+// branchFields return json fields of branch `b`
+func branchFields(b *Branch) map[string]interface{} {
+	fields := make(map[string]interface{})
+	data, _ := json.Marshal(b)
+	json.Unmarshal(data, &fields)
+	return fields
+}
+
+// PreviewModify return what Modify of `branch` would change, the branch is left untouched.
+//
+func (ss *sserver) PreviewModify(branch *Branch) (*ModifyPreview, error) {
+	ss.lck.RLock()
+	defer ss.lck.RUnlock()
+
+	b, ok := ss.builders[strings.ToLower(branch.StoreName)].(*BrBuilder)
+	if !ok {
+		return nil, ErrBranchNotInit
+	}
+	if err := ss.checkBranch(branch); err != nil {
+		return nil, err
+	}
+	nb := NewBranch2(branch)
+	if !nb.CanUpdate() && !nb.CanBrowse() {
+		return nil, ErrBranchUnusable
+	}
+
+	cur := b.GetBranch()
+	next := *cur
+	applyBranch(&next, nb.GetBranch())
+	from, to := branchFields(cur), branchFields(&next)
+	preview := &ModifyPreview{Branch: b.Name(), Changes: []*BranchChange{}}
+	for field := range to {
+		if _, ok := from[field]; !ok {
+			from[field] = nil
+		}
+	}
+	for field, v := range from {
+		if !reflect.DeepEqual(v, to[field]) {
+			preview.Changes = append(preview.Changes, &BranchChange{Field: field, From: v, To: to[field]})
+		}
+	}
+	sort.Slice(preview.Changes, func(i, j int) bool {
+		return preview.Changes[i].Field < preview.Changes[j].Field
+	})
+
+	// channels with `keep` prune too, plan by a builder with the new settings
+	if !reflect.DeepEqual(cur.Retention, next.Retention) || !reflect.DeepEqual(cur.Channels, next.Channels) {
+		plan, err := NewBranch2(&next).(*BrBuilder).PlanRetention()
+		if err != nil {
+			return nil, err
+		}
+		preview.Retention = plan
+	}
+	return preview, nil
+}
@@ -0,0 +1,55 @@
+package symbol
+
+import (
+	"os/exec"
+	"runtime"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/adyzng/GoSymbols/config"
+)
+
+func TestSymStoreSlots(t *testing.T) {
+	symstoreOnce.Do(func() {})
+	defer func(sem chan struct{}) { symstoreSem = sem }(symstoreSem)
+	symstoreSem = make(chan struct{}, 1)
+
+	release := acquireSymStore()
+	acquired := make(chan struct{})
+	go func() {
+		defer acquireSymStore()()
+		close(acquired)
+	}()
+	select {
+	case <-acquired:
+		t.Fatal("expect second symstore.exe wait for the slot")
+	case <-time.After(50 * time.Millisecond):
+	}
+	release()
+	select {
+	case <-acquired:
+	case <-time.After(time.Second):
+		t.Fatal("expect second symstore.exe run after release")
+	}
+}
+
+func TestRunNice(t *testing.T) {
+	if runtime.GOOS == "windows" {
+		t.Skip("nice is unix only")
+	}
+	defer func(p string) { config.SymStorePriority = p }(config.SymStorePriority)
+	config.SymStorePriority = "below-normal"
+
+	out, err := runNice(exec.Command("sh", "-c", "echo out; echo err >&2; sleep 0.2; nice"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	lines := strings.Fields(string(out))
+	if len(lines) != 3 || lines[0] != "out" || lines[1] != "err" {
+		t.Fatalf("unexpected output %q", out)
+	}
+	if lines[2] != "10" {
+		t.Skipf("renice not permitted, niceness %s", lines[2])
+	}
+}
@@ -0,0 +1,32 @@
+// +build !windows
+
+package symbol
+
+import (
+	"os"
+	"os/exec"
+	"syscall"
+
+	"github.com/adyzng/GoSymbols/config"
+	log "gopkg.in/clog.v1"
+)
+
+// setPriority is done by lowerIO after start on unix
+func setPriority(cmd *exec.Cmd) {}
+
+// lowerIO renice started process `p` by `[ingest] SYMSTORE_PRIORITY`, io scheduling
+// follow the cpu niceness by default
+func lowerIO(p *os.Process) {
+	var nice int
+	switch config.SymStorePriority {
+	case "idle":
+		nice = 19
+	case "below-normal":
+		nice = 10
+	default:
+		return
+	}
+	if err := syscall.Setpriority(syscall.PRIO_PROCESS, p.Pid, nice); err != nil {
+		log.Trace("[Branch] Renice process %d failed: %v.", p.Pid, err)
+	}
+}
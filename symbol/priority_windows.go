@@ -0,0 +1,64 @@
+package symbol
+
+import (
+	"os"
+	"os/exec"
+	"syscall"
+	"unsafe"
+
+	"github.com/adyzng/GoSymbols/config"
+	log "gopkg.in/clog.v1"
+)
+
+const (
+	idlePriorityClass        = 0x00000040
+	belowNormalPriorityClass = 0x00004000
+	processSetInformation    = 0x0200
+	processIoPriority        = 33 // PROCESS_INFORMATION_CLASS of NtSetInformationProcess
+	ioPriorityVeryLow        = 0
+	ioPriorityLow            = 1
+)
+
+var (
+	procNtSetInformationProcess = syscall.NewLazyDLL("ntdll.dll").NewProc("NtSetInformationProcess")
+)
+
+// setPriority start `cmd` in the priority class of `[ingest] SYMSTORE_PRIORITY`
+func setPriority(cmd *exec.Cmd) {
+	var class uint32
+	switch config.SymStorePriority {
+	case "idle":
+		class = idlePriorityClass
+	case "below-normal":
+		class = belowNormalPriorityClass
+	default:
+		return
+	}
+	if cmd.SysProcAttr == nil {
+		cmd.SysProcAttr = &syscall.SysProcAttr{}
+	}
+	cmd.SysProcAttr.CreationFlags |= class
+}
+
+// lowerIO set io priority of started process `p`, it can't be given at creation
+func lowerIO(p *os.Process) {
+	prio := uint32(ioPriorityLow)
+	switch config.SymStorePriority {
+	case "idle":
+		prio = ioPriorityVeryLow
+	case "below-normal":
+	default:
+		return
+	}
+	h, err := syscall.OpenProcess(processSetInformation, false, uint32(p.Pid))
+	if err != nil {
+		log.Trace("[Branch] Open process %d failed: %v.", p.Pid, err)
+		return
+	}
+	defer syscall.CloseHandle(h)
+	r, _, _ := procNtSetInformationProcess.Call(uintptr(h), processIoPriority,
+		uintptr(unsafe.Pointer(&prio)), unsafe.Sizeof(prio))
+	if r != 0 {
+		log.Trace("[Branch] Set io priority of process %d failed: 0x%x.", p.Pid, r)
+	}
+}
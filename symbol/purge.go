@@ -0,0 +1,400 @@
+package symbol
+
+import (
+	"bufio"
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"fmt"
+	"os"
+	"path/filepath"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/adyzng/GoSymbols/audit"
+	log "gopkg.in/clog.v1"
+)
+
+const (
+	purgeTokenTTL = time.Minute * 10
+	purgeDir      = "purge" // 000Admin/purge/{ID}, references removed by purge, apart from the transaction files
+)
+
+var (
+	ErrPurgeNoPattern    = fmt.Errorf("purge pattern required")
+	ErrPurgeInvalidToken = fmt.Errorf("purge token invalid or expired")
+	ErrPurgeChanged      = fmt.Errorf("store changed since preview, please preview again")
+)
+
+// PurgeOption select symbols to purge, file names matching any of `Patterns`
+// in transactions between `From` and `To` (both inclusive, empty for unbounded).
+//
+type PurgeOption struct {
+	Patterns []string `json:"patterns"`
+	From     string   `json:"from,omitempty"`
+	To       string   `json:"to,omitempty"`
+}
+
+// PurgeEntry is one symbol reference to remove. Shared file is still referenced by
+// other transactions, only the reference is removed and the file is kept.
+//
+type PurgeEntry struct {
+	Name        string `json:"name"`
+	Hash        string `json:"hash"`
+	Transaction string `json:"transaction"`
+	Shared      bool   `json:"shared,omitempty"`
+	line        string // original line in transaction file
+}
+
+// PurgePlan is the preview of a purge, execute it with `Token` before `Expires`.
+//
+type PurgePlan struct {
+	Token       string        `json:"token"`
+	Branch      string        `json:"branch"`
+	Option      PurgeOption   `json:"option"`
+	Entries     []*PurgeEntry `json:"entries"`
+	Emptied     []string      `json:"emptied"`        // transactions left without symbols, removed from server.txt
+	Held        []string      `json:"held,omitempty"` // transactions in range kept by legal hold
+	Transaction string        `json:"transaction,omitempty"`
+	Expires     string        `json:"expires,omitempty"`
+	fingerprint string
+	expireTime  time.Time
+}
+
+var (
+	purgeMx    sync.Mutex
+	purgePlans = make(map[string]*PurgePlan)
+)
+
+// padID pad numeric transaction ID to 10 digits as symstore does
+func padID(id string) string {
+	id = strings.TrimSpace(id)
+	if n, err := strconv.ParseUint(id, 10, 64); err == nil {
+		return fmt.Sprintf("%010d", n)
+	}
+	return id
+}
+
+// PlanPurge list all symbols matching `opt` without touching the store. The returned
+// token is required by ExecutePurge and expires in 10 minutes.
+//
+func (b *BrBuilder) PlanPurge(opt PurgeOption) (*PurgePlan, error) {
+	plan, err := b.planPurge(opt)
+	if err != nil {
+		return nil, err
+	}
+
+	plan.Token = randomID(15)
+	plan.expireTime = now().Add(purgeTokenTTL)
+	plan.Expires = plan.expireTime.Format(TimeFormat)
+
+	purgeMx.Lock()
+	defer purgeMx.Unlock()
+	for token, p := range purgePlans {
+		if now().After(p.expireTime) {
+			delete(purgePlans, token)
+		}
+	}
+	purgePlans[plan.Token] = plan
+	log.Info("[Branch] Purge preview %s of %s: %d symbols in %d transactions.",
+		plan.Token, b.Name(), len(plan.Entries), len(plan.Emptied))
+	return plan, nil
+}
+
+func (b *BrBuilder) planPurge(opt PurgeOption) (*PurgePlan, error) {
+	if err := b.writable(); err != nil {
+		return nil, err
+	}
+	match := fileMatcher(opt.Patterns)
+	if len(strings.TrimSpace(strings.Join(opt.Patterns, ""))) == 0 {
+		return nil, ErrPurgeNoPattern
+	}
+	opt.From, opt.To = padID(opt.From), padID(opt.To)
+	if _, err := b.ParseBuilds(context.Background(), nil); err != nil {
+		return nil, err
+	}
+
+	b.mx.RLock()
+	ids := make([]string, 0, len(b.builds))
+	for id := range b.builds {
+		ids = append(ids, id)
+	}
+	b.mx.RUnlock()
+	sort.Strings(ids)
+
+	plan := &PurgePlan{
+		Branch: b.Name(),
+		Option: opt,
+	}
+	others, err := b.foreignKeys() // keys referenced out of the purge
+	if err != nil {
+		return nil, err
+	}
+	held, err := b.heldIDs()
+	if err != nil {
+		return nil, err
+	}
+	for _, id := range ids {
+		selected := (opt.From == "" || id >= opt.From) && (opt.To == "" || id <= opt.To)
+		if selected && held[id] {
+			plan.Held = append(plan.Held, id)
+			selected = false
+		}
+		lines, err := b.transactionLines(id)
+		if err != nil {
+			log.Warn("[Branch] Read transaction %s failed: %v.", id, err)
+			continue
+		}
+
+		kept := 0
+		for _, line := range lines {
+			key := strings.Trim(strings.Split(line, ",")[0], "\"")
+			ss := strings.Split(key, "\\")
+			if len(ss) != 2 {
+				continue
+			}
+			if selected && match(ss[0]) {
+				plan.Entries = append(plan.Entries, &PurgeEntry{
+					Name:        ss[0],
+					Hash:        ss[1],
+					Transaction: id,
+					line:        line,
+				})
+				continue
+			}
+			others[strings.ToLower(key)] = true
+			kept++
+		}
+		if selected && kept == 0 && len(plan.Entries) > 0 &&
+			plan.Entries[len(plan.Entries)-1].Transaction == id {
+			plan.Emptied = append(plan.Emptied, id)
+		}
+	}
+
+	h := sha256.New()
+	for _, e := range plan.Entries {
+		e.Shared = others[strings.ToLower(e.Name+"\\"+e.Hash)]
+		fmt.Fprintf(h, "%s|%s|%v\n", e.Transaction, e.line, e.Shared)
+	}
+	fmt.Fprintf(h, "%v\n%v\n", plan.Emptied, plan.Held)
+	plan.fingerprint = hex.EncodeToString(h.Sum(nil))
+	return plan, nil
+}
+
+// transactionLines read all non empty lines of transaction file 000Admin/{ID}
+func (b *BrBuilder) transactionLines(id string) ([]string, error) {
+	fd, err := b.StoreFS().Open(adminName(id))
+	if err != nil {
+		return nil, err
+	}
+	defer fd.Close()
+
+	var lines []string
+	scan := bufio.NewScanner(fd)
+	for scan.Scan() {
+		if line := strings.TrimRight(scan.Text(), "\r\n"); line != "" {
+			lines = append(lines, line)
+		}
+	}
+	return lines, scan.Err()
+}
+
+// ExecutePurge remove the symbols previewed by PlanPurge. The removed references are
+// written to a new transaction, transactions left empty are recorded as `del` in history.txt.
+// Every removed symbol is recorded in audit log as `user`.
+//
+func (b *BrBuilder) ExecutePurge(token, user string) (*PurgePlan, error) {
+	purgeMx.Lock()
+	preview, ok := purgePlans[token]
+	if ok {
+		delete(purgePlans, token)
+	}
+	purgeMx.Unlock()
+	if !ok || preview.Branch != b.Name() || now().After(preview.expireTime) {
+		return nil, ErrPurgeInvalidToken
+	}
+
+	b.ingMx.Lock()
+	defer b.ingMx.Unlock()
+	defer beginWrite()()
+
+	plan, err := b.planPurge(preview.Option)
+	if err != nil {
+		return nil, err
+	}
+	if plan.fingerprint != preview.fingerprint {
+		log.Warn("[Branch] Purge %s of %s changed since preview.", token, b.Name())
+		return nil, ErrPurgeChanged
+	}
+	plan.Token = token
+	if len(plan.Entries) == 0 {
+		return plan, nil
+	}
+
+	unlock, err := lockAdmin(b.StorePath)
+	if err != nil {
+		return nil, err
+	}
+	defer unlock()
+	last, _ := strconv.ParseUint(b.GetLatestID(), 10, 64)
+	plan.Transaction = fmt.Sprintf("%010d", last+1)
+	var emptied []*Build
+	for _, id := range plan.Emptied {
+		if build := b.getBuild("", id); build != nil {
+			emptied = append(emptied, build)
+		}
+	}
+	if err = b.writePurge(plan); err != nil {
+		log.Error(2, "[Branch] Purge %s of %s failed: %v.", token, b.Name(), err)
+		return nil, err
+	}
+	if err = b.markDeleted(emptied, "purged"); err != nil {
+		log.Warn("[Branch] Save status of purged builds failed: %v.", err)
+	}
+	if err = b.purgeBinaries(plan.Emptied); err != nil {
+		log.Warn("[Branch] Purge binaries of emptied builds failed: %v.", err)
+	}
+	if err = b.purgeBreakpad(plan.Emptied); err != nil {
+		log.Warn("[Branch] Purge breakpad symbols of emptied builds failed: %v.", err)
+	}
+
+	for _, e := range plan.Entries {
+		audit.Record(user, "purge", b.Name(), "%s\\%s of transaction %s by %s (shared: %v)",
+			e.Name, e.Hash, e.Transaction, plan.Transaction, e.Shared)
+	}
+	for _, id := range plan.Emptied {
+		audit.Record(user, "purge", b.Name(), "transaction %s deleted by %s", id, plan.Transaction)
+	}
+	log.Info("[Branch] Purge %d symbols of %s in transaction %s.", len(plan.Entries), b.Name(), plan.Transaction)
+	return plan, nil
+}
+
+// writePurge apply the plan to store, caller hold `ingMx`
+func (b *BrBuilder) writePurge(plan *PurgePlan) error {
+	admin := filepath.Join(b.StorePath, adminDir)
+	removed := make(map[string]map[string]bool)
+	var record []string
+	for _, e := range plan.Entries {
+		if removed[e.Transaction] == nil {
+			removed[e.Transaction] = make(map[string]bool)
+		}
+		removed[e.Transaction][e.line] = true
+		record = append(record, e.line)
+	}
+
+	// the purge record first, so the removed references are never lost. It's not an added
+	// transaction, Repair and reindex must not take it for a build.
+	if err := os.MkdirAll(filepath.Join(admin, purgeDir), 0755); err != nil {
+		return err
+	}
+	if err := writeFileAtomic(b.purgeRecord(plan.Transaction),
+		[]byte(strings.Join(record, "\r\n")+"\r\n")); err != nil {
+		return err
+	}
+	if err := writeFileAtomic(filepath.Join(admin, lastidTxt), []byte(plan.Transaction+"\r\n")); err != nil {
+		return err
+	}
+
+	emptied := make(map[string]bool, len(plan.Emptied))
+	for _, id := range plan.Emptied {
+		emptied[id] = true
+	}
+	var changed []string
+	for id, lines := range removed {
+		if emptied[id] {
+			// keep the file as symstore does for deleted transactions, history replay need it
+			continue
+		}
+		all, err := b.transactionLines(id)
+		if err != nil {
+			return err
+		}
+		kept := make([]string, 0, len(all))
+		for _, line := range all {
+			if !lines[line] {
+				kept = append(kept, line)
+			}
+		}
+		if err = writeFileAtomic(filepath.Join(admin, id), []byte(strings.Join(kept, "\r\n")+"\r\n")); err != nil {
+			return err
+		}
+		changed = append(changed, id)
+	}
+
+	if len(plan.Emptied) > 0 {
+		if err := b.dropTransactions(plan.Transaction, emptied); err != nil {
+			return err
+		}
+	}
+
+	sort.Strings(changed)
+	b.signOrWarn(signPurge, plan.Transaction)
+	b.signOrWarn(signAdd, changed...)
+
+	b.sumMx.Lock()
+	for _, e := range plan.Entries {
+		if e.Shared {
+			continue
+		}
+		b.removeSymbol(e.Name, e.Hash)
+	}
+	b.sumMx.Unlock()
+
+	// reload builds from server.txt
+	b.mx.Lock()
+	b.builds = make(map[string]*Build)
+	b.mx.Unlock()
+	_, err := b.ParseBuilds(context.Background(), nil)
+	return err
+}
+
+// purgeRecord return the path of the references removed by purge transaction `id`
+func (b *BrBuilder) purgeRecord(id string) string {
+	return filepath.Join(b.StorePath, adminDir, purgeDir, id)
+}
+
+// removeSymbol remove directory of symbol `name\hash`, its checksum and blob references,
+// caller hold `sumMx`
+func (b *BrBuilder) removeSymbol(name, hash string) {
+	dir := b.symbolDir(name, hash)
+	b.releaseDir(dir)
+	if err := os.RemoveAll(dir); err != nil {
+		log.Warn("[Branch] Remove %s failed: %v.", dir, err)
+	}
+	os.Remove(filepath.Dir(dir)) // only if empty
+	if b.twoTier() {
+		os.Remove(filepath.Dir(filepath.Dir(dir)))
+	}
+	if b.sums != nil {
+		delete(b.sums, b.relPath(b.GetSymbolPath(hash, name)))
+	}
+}
+
+// dropTransactions remove `emptied` transactions from server.txt and record them
+// as deleted by transaction `id` in history.txt
+func (b *BrBuilder) dropTransactions(id string, emptied map[string]bool) error {
+	admin := filepath.Join(b.StorePath, adminDir)
+	var del []string
+	for tid := range emptied {
+		// 0000000005,del,0000000002
+		del = append(del, fmt.Sprintf("%s,del,%s\r\n", id, tid))
+	}
+	if err := appendLine(filepath.Join(admin, historyTxt), strings.Join(del, "")); err != nil {
+		return err
+	}
+
+	lines, err := b.transactionLines(serverTxt)
+	if err != nil {
+		return err
+	}
+	kept := make([]string, 0, len(lines))
+	for _, line := range lines {
+		if !emptied[strings.Split(line, ",")[0]] {
+			kept = append(kept, line)
+		}
+	}
+	return writeFileAtomic(filepath.Join(admin, serverTxt), []byte(strings.Join(kept, "\r\n")+"\r\n"))
+}
@@ -0,0 +1,112 @@
+package symbol
+
+import (
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/adyzng/GoSymbols/audit"
+	"github.com/adyzng/GoSymbols/config"
+)
+
+func TestPurge(t *testing.T) {
+	root, err := ioutil.TempDir("", "purge")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(root)
+	config.AuditFile = filepath.Join(root, "audit.log")
+
+	admin := filepath.Join(root, adminDir)
+	os.MkdirAll(admin, 0755)
+	trans := map[string][]string{
+		"0000000001": {"ca_a.pdb\\A1", "foo.pdb\\F1"},
+		"0000000002": {"ca_a.pdb\\A2"},
+		"0000000003": {"ca_a.pdb\\A1", "bar.pdb\\B1"},
+	}
+	server := ""
+	for id, keys := range trans {
+		data := ""
+		for _, key := range keys {
+			name := strings.Split(key, "\\")[0]
+			data += "\"" + key + "\",\"S:\\000Unzip\\x64\\" + name + "\"\r\n"
+			fpath := filepath.Join(root, name, strings.Split(key, "\\")[1], name)
+			os.MkdirAll(filepath.Dir(fpath), 0755)
+			ioutil.WriteFile(fpath, []byte(key), 0644)
+		}
+		ioutil.WriteFile(filepath.Join(admin, id), []byte(data), 0644)
+	}
+	for _, id := range []string{"0000000001", "0000000002", "0000000003"} {
+		server += id + ",add,file,07/04/2017,14:44:14,\"test\",\"" + id[8:] + "\",\"\",\r\n"
+	}
+	ioutil.WriteFile(filepath.Join(admin, serverTxt), []byte(server), 0644)
+	ioutil.WriteFile(filepath.Join(admin, lastidTxt), []byte("0000000003"), 0644)
+
+	b := NewBranch2(&Branch{StoreName: "test", StorePath: root, BuildPath: root}).(*BrBuilder)
+	if _, err := b.PlanPurge(PurgeOption{}); err != ErrPurgeNoPattern {
+		t.Fatalf("expect pattern required, got %v", err)
+	}
+	plan, err := b.PlanPurge(PurgeOption{Patterns: []string{"CA_*.pdb"}, From: "2", To: "3"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(plan.Entries) != 2 || len(plan.Emptied) != 1 || plan.Emptied[0] != "0000000002" {
+		t.Fatalf("unexpected plan %+v", plan)
+	}
+	if _, err := os.Stat(filepath.Join(root, "ca_a.pdb", "A2")); err != nil {
+		t.Fatal("dry run should not remove anything")
+	}
+	if _, err := b.ExecutePurge("invalid", "tester"); err != ErrPurgeInvalidToken {
+		t.Fatalf("expect invalid token, got %v", err)
+	}
+
+	done, err := b.ExecutePurge(plan.Token, "tester")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if done.Transaction != "0000000004" || b.GetLatestID() != "0000000004" {
+		t.Fatalf("unexpected purge transaction %s", done.Transaction)
+	}
+	if _, err := os.Stat(filepath.Join(root, "ca_a.pdb", "A2")); !os.IsNotExist(err) {
+		t.Fatal("purged symbol should be removed")
+	}
+	if _, err := os.Stat(filepath.Join(root, "ca_a.pdb", "A1", "ca_a.pdb")); err != nil {
+		t.Fatal("symbol referenced by other transaction should be kept")
+	}
+	if keys, _ := b.transactionKeys("0000000003"); len(keys) != 1 || keys[0] != "bar.pdb\\B1" {
+		t.Fatalf("unexpected transaction keys %v", keys)
+	}
+	if b.getBuild("", "0000000002") != nil || b.BuildsCount != 2 {
+		t.Fatalf("emptied build should be removed, %d builds", b.BuildsCount)
+	}
+	if _, err := os.Stat(b.purgeRecord("0000000004")); err != nil {
+		t.Fatalf("purge record not written: %v", err)
+	}
+	if _, err := os.Stat(filepath.Join(admin, "0000000004")); !os.IsNotExist(err) {
+		t.Fatal("purge record should not be an transaction file")
+	}
+	history, _ := ioutil.ReadFile(filepath.Join(admin, historyTxt))
+	if !strings.Contains(string(history), "0000000004,del,0000000002") {
+		t.Fatalf("unexpected history %q", history)
+	}
+	if entries, _ := audit.Recent(0, "test"); len(entries) != 3 || entries[0].User != "tester" {
+		t.Fatalf("expect 3 audit entries, got %v", entries)
+	}
+	if _, err := b.ExecutePurge(plan.Token, "tester"); err != ErrPurgeInvalidToken {
+		t.Fatalf("token should be used only once, got %v", err)
+	}
+
+	// repair keep the purge transaction ID, but never turns it into a build
+	report, err := b.Repair()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if report.Builds != 2 || len(report.Synthesized) != 0 || report.LastID != "0000000004" {
+		t.Fatalf("unexpected repair report %+v", report)
+	}
+	if b.BuildsCount != 2 || b.getBuild("", "0000000004") != nil {
+		t.Fatalf("purge should not be repaired as build, %d builds", b.BuildsCount)
+	}
+}
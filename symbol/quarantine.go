@@ -0,0 +1,297 @@
+package symbol
+
+import (
+	"bufio"
+	"context"
+	"fmt"
+	"io/fs"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/adyzng/GoSymbols/alert"
+	"github.com/adyzng/GoSymbols/config"
+	log "gopkg.in/clog.v1"
+)
+
+const (
+	quarantineDir = "quarantine" // copies of malformed admin files, under 000Admin
+)
+
+var (
+	ErrMalformedFile = fmt.Errorf("malformed admin file, quarantined until repaired")
+)
+
+var (
+	quarantineMx sync.Mutex
+	quarantined  = make(map[string]string) // file path => size and mod time already quarantined
+
+	checkedMx sync.Mutex
+	checked   = make(map[string]adminCheck) // store path|name => last check of admin file
+)
+
+// adminCheck is the result of checkAdminFile for a size and mod time of the file
+type adminCheck struct {
+	size  int64
+	mtime time.Time
+	err   error
+}
+
+// validServerLine check an `add` line of server.txt
+func validServerLine(line string) bool {
+	return parseBuildLine(line) != nil
+}
+
+// validTransactionLine check a `"name\hash","source path"` line of transaction file
+func validTransactionLine(line string) bool {
+	ss := strings.Split(line, ",")
+	return len(ss) >= 2 && strings.Count(strings.Trim(ss[0], "\""), "\\") == 1
+}
+
+// checkAdminFile validate every line of admin file `name` in strict parse mode.
+// Malformed or truncated (no line end) file is copied to 000Admin/quarantine and alerted.
+// The result is kept until the size or mod time of the file change.
+//
+func (b *BrBuilder) checkAdminFile(name string, valid func(line string) bool) error {
+	if config.ParseMode != "strict" {
+		return nil
+	}
+	fi, err := fs.Stat(b.StoreFS(), adminName(name))
+	if err != nil {
+		return err
+	}
+	key := strings.ToLower(b.StorePath) + "|" + name
+	checkedMx.Lock()
+	last, ok := checked[key]
+	checkedMx.Unlock()
+	if ok && last.size == fi.Size() && last.mtime.Equal(fi.ModTime()) {
+		return last.err
+	}
+
+	err = b.validateAdminFile(name, valid)
+	if err == nil || err == ErrMalformedFile {
+		checkedMx.Lock()
+		checked[key] = adminCheck{size: fi.Size(), mtime: fi.ModTime(), err: err}
+		checkedMx.Unlock()
+	}
+	return err
+}
+
+// validateAdminFile read and validate admin file `name`, see checkAdminFile
+func (b *BrBuilder) validateAdminFile(name string, valid func(line string) bool) error {
+	data, err := fs.ReadFile(b.StoreFS(), adminName(name))
+	if err != nil {
+		return err
+	}
+
+	reason := ""
+	if len(data) > 0 && data[len(data)-1] != '\n' {
+		reason = "truncated, no line end"
+	}
+	for no, line := range strings.Split(string(data), "\n") {
+		if line = strings.TrimRight(line, "\r"); line != "" && !valid(line) {
+			reason = fmt.Sprintf("invalid line %d: %s", no+1, line)
+			break
+		}
+	}
+	if reason == "" {
+		return nil
+	}
+	b.quarantine(name, data, reason)
+	return ErrMalformedFile
+}
+
+// quarantine keep a copy of malformed admin file and raise alert, once for the same content
+func (b *BrBuilder) quarantine(name string, data []byte, reason string) {
+	fpath := filepath.Join(b.StorePath, adminDir, name)
+	stamp := strconv.Itoa(len(data))
+	if fi, err := os.Stat(fpath); err == nil {
+		stamp += "@" + fi.ModTime().String()
+	}
+
+	quarantineMx.Lock()
+	defer quarantineMx.Unlock()
+	if quarantined[fpath] == stamp {
+		return
+	}
+	quarantined[fpath] = stamp
+
+	dest := b.quarantineCopy(name, data)
+	alert.Raise(alert.KindMalformedAdmin, b.Name(),
+		"%s is malformed (%s), quarantined as %s, run `repair` to rebuild it", name, reason, dest)
+}
+
+// quarantineCopy write `data` of admin file `name` to 000Admin/quarantine, return the copy path
+func (b *BrBuilder) quarantineCopy(name string, data []byte) string {
+	dir := filepath.Join(b.StorePath, adminDir, quarantineDir)
+	dest := filepath.Join(dir, name+"."+now().Format("20060102150405"))
+	if err := os.MkdirAll(dir, 0755); err != nil {
+		log.Error(2, "[Branch] Create quarantine folder %s failed: %v.", dir, err)
+	} else if err = ioutil.WriteFile(dest, data, 0644); err != nil {
+		log.Error(2, "[Branch] Quarantine %s failed: %v.", name, err)
+	}
+	return dest
+}
+
+// RepairReport is the result of rebuilding admin files of a branch
+//
+type RepairReport struct {
+	Branch      string         `json:"branch"`
+	Builds      int            `json:"builds"`                // lines written to server.txt
+	Recovered   []string       `json:"recovered,omitempty"`   // transactions with add line found in server.txt or history.txt
+	Synthesized []string       `json:"synthesized,omitempty"` // transactions without add line, version unknown
+	Cleaned     map[string]int `json:"cleaned,omitempty"`     // transaction => invalid lines dropped
+	LastID      string         `json:"lastID"`
+}
+
+// Repair reconstruct server.txt and lastid.txt from the per-transaction files, the build
+// information is taken from the valid lines of server.txt and history.txt. Invalid lines of
+// transaction files are dropped. Originals are quarantined before rewritten.
+//
+func (b *BrBuilder) Repair() (*RepairReport, error) {
+	b.ingMx.Lock()
+	defer b.ingMx.Unlock()
+	if err := b.writable(); err != nil {
+		return nil, err
+	}
+	defer beginWrite()()
+	unlock, err := lockAdmin(b.StorePath)
+	if err != nil {
+		return nil, err
+	}
+	defer unlock()
+
+	admin := filepath.Join(b.StorePath, adminDir)
+	infos, err := ioutil.ReadDir(admin)
+	if err != nil {
+		return nil, err
+	}
+
+	// build lines known by history and current server.txt, later wins
+	lines := make(map[string]string)
+	deleted := make(map[string]bool)
+	for _, name := range []string{historyTxt, serverTxt} {
+		all, _ := b.transactionLines(name)
+		for _, line := range all {
+			ss := strings.Split(line, ",")
+			switch {
+			case len(ss) >= 3 && ss[1] == "del":
+				deleted[ss[2]] = true
+				delete(lines, ss[2])
+			case validServerLine(line):
+				lines[ss[0]] = line
+				delete(deleted, ss[0])
+			}
+		}
+	}
+
+	report := &RepairReport{
+		Branch:  b.Name(),
+		Cleaned: make(map[string]int),
+	}
+	var (
+		server []string
+		lastID uint64
+	)
+	for _, fi := range infos {
+		id := fi.Name()
+		n, err := strconv.ParseUint(id, 10, 64)
+		if fi.IsDir() || len(id) != 10 || err != nil {
+			continue
+		}
+		if n > lastID {
+			lastID = n
+		}
+		if dropped, err := b.cleanTransaction(id); err != nil {
+			return nil, err
+		} else if dropped > 0 {
+			report.Cleaned[id] = dropped
+		}
+		if deleted[id] {
+			continue
+		}
+
+		line, ok := lines[id]
+		if ok {
+			report.Recovered = append(report.Recovered, id)
+		} else {
+			// 0000000001,add,file,07/04/2017,14:44:14,"UDPv6.5U2","","repaired",
+			line = fmt.Sprintf("%s,add,file,%s,\"%s\",\"\",\"repaired\",", id,
+				fi.ModTime().Format("01/02/2006,15:04:05"), b.Name())
+			report.Synthesized = append(report.Synthesized, id)
+		}
+		server = append(server, line)
+	}
+	if n, _ := strconv.ParseUint(b.GetLatestID(), 10, 64); n > lastID {
+		lastID = n
+	}
+	// purge records take transaction IDs too, but never build lines
+	purged, _ := ioutil.ReadDir(filepath.Join(admin, purgeDir))
+	for _, fi := range purged {
+		if n, err := strconv.ParseUint(fi.Name(), 10, 64); err == nil && n > lastID {
+			lastID = n
+		}
+	}
+	sort.Strings(server)
+	report.Builds = len(server)
+	report.LastID = fmt.Sprintf("%010d", lastID)
+
+	if data, err := ioutil.ReadFile(filepath.Join(admin, serverTxt)); err == nil {
+		b.quarantineCopy(serverTxt, data)
+	}
+	data := strings.Join(server, "\r\n")
+	if len(server) > 0 {
+		data += "\r\n"
+	}
+	if err = writeFileAtomic(filepath.Join(admin, serverTxt), []byte(data)); err != nil {
+		return nil, err
+	}
+	if err = writeFileAtomic(filepath.Join(admin, lastidTxt), []byte(report.LastID+"\r\n")); err != nil {
+		return nil, err
+	}
+	log.Info("[Branch] Repair %s: %d builds, %d synthesized, last ID %s.",
+		b.Name(), report.Builds, len(report.Synthesized), report.LastID)
+
+	b.mx.Lock()
+	b.builds = make(map[string]*Build)
+	b.mx.Unlock()
+	_, err = b.ParseBuilds(context.Background(), nil)
+	return report, err
+}
+
+// cleanTransaction drop invalid lines of transaction file, return the dropped count
+func (b *BrBuilder) cleanTransaction(id string) (int, error) {
+	fpath := filepath.Join(b.StorePath, adminDir, id)
+	data, err := ioutil.ReadFile(fpath)
+	if err != nil {
+		return 0, err
+	}
+
+	var kept []string
+	dropped := 0
+	scan := bufio.NewScanner(strings.NewReader(string(data)))
+	for scan.Scan() {
+		line := strings.TrimRight(scan.Text(), "\r")
+		if line == "" {
+			continue
+		}
+		if !validTransactionLine(line) {
+			dropped++
+			continue
+		}
+		kept = append(kept, line)
+	}
+	truncated := len(data) > 0 && data[len(data)-1] != '\n'
+	if dropped == 0 && !truncated {
+		return 0, nil
+	}
+
+	b.quarantineCopy(id, data)
+	log.Warn("[Branch] Drop %d invalid lines of transaction %s.", dropped, id)
+	return dropped, writeFileAtomic(fpath, []byte(strings.Join(kept, "\r\n")+"\r\n"))
+}
@@ -0,0 +1,91 @@
+package symbol
+
+import (
+	"context"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/adyzng/GoSymbols/config"
+)
+
+func TestQuarantineRepair(t *testing.T) {
+	root, err := ioutil.TempDir("", "quarantine")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(root)
+	defer func(mode string) { config.ParseMode = mode }(config.ParseMode)
+	config.ParseMode = "strict"
+
+	admin := filepath.Join(root, adminDir)
+	os.MkdirAll(admin, 0755)
+	ioutil.WriteFile(filepath.Join(admin, "0000000001"), []byte(
+		"\"foo.pdb\\AAAA1\",\"S:\\000Unzip\\x64\\foo.pdb\"\r\n"), 0644)
+	ioutil.WriteFile(filepath.Join(admin, "0000000002"), []byte(
+		"\"bar.pdb\\BBBB1\",\"S:\\000Unzip\\x64\\bar.pdb\"\r\ngarbage\r\n"), 0644)
+	ioutil.WriteFile(filepath.Join(admin, "0000000003"), []byte(
+		"\"baz.pdb\\CCCC1\",\"S:\\000Unzip\\x64\\baz.pdb\"\r\n"), 0644)
+	// truncated while writing the second line
+	ioutil.WriteFile(filepath.Join(admin, serverTxt), []byte(
+		"0000000001,add,file,07/04/2017,14:44:14,\"test\",\"100\",\"\",\r\n"+
+			"0000000002,add,file,07/05/2017,14:44:14,\"test\",\"101\",\"\",\r\n0000000003,add,fi"), 0644)
+	ioutil.WriteFile(filepath.Join(admin, lastidTxt), []byte("0000000002"), 0644)
+
+	b := NewBranch2(&Branch{StoreName: "test", StorePath: root, BuildPath: root}).(*BrBuilder)
+	if _, err := b.ParseBuilds(context.Background(), nil); err != ErrMalformedFile {
+		t.Fatalf("expect malformed server.txt, got %v", err)
+	}
+	copies, _ := ioutil.ReadDir(filepath.Join(admin, quarantineDir))
+	if len(copies) != 1 {
+		t.Fatalf("expect server.txt quarantined, got %d files", len(copies))
+	}
+
+	report, err := b.Repair()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if report.Builds != 3 || len(report.Synthesized) != 1 || report.Synthesized[0] != "0000000003" ||
+		report.Cleaned["0000000002"] != 1 || report.LastID != "0000000003" {
+		t.Fatalf("unexpected repair report %+v", report)
+	}
+	if b.BuildsCount != 3 || b.getBuild("101", "") == nil {
+		t.Fatalf("expect builds reloaded, got %d", b.BuildsCount)
+	}
+	if n, err := b.ParseSymbols("0000000002", nil); err != nil || n != 1 {
+		t.Fatalf("expect cleaned transaction parsed, got %d (%v)", n, err)
+	}
+}
+
+func TestCheckAdminFileCached(t *testing.T) {
+	root, err := ioutil.TempDir("", "quarantine")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(root)
+	defer func(mode string) { config.ParseMode = mode }(config.ParseMode)
+	config.ParseMode = "strict"
+
+	admin := filepath.Join(root, adminDir)
+	os.MkdirAll(admin, 0755)
+	fpath := filepath.Join(admin, "0000000001")
+	ioutil.WriteFile(fpath, []byte("\"foo.pdb\\AAAA1\",\"S:\\000Unzip\\x64\\foo.pdb\"\r\n"), 0644)
+	fi, _ := os.Stat(fpath)
+
+	b := NewBranch2(&Branch{StoreName: "test", StorePath: root, BuildPath: root}).(*BrBuilder)
+	if err := b.checkAdminFile("0000000001", validTransactionLine); err != nil {
+		t.Fatal(err)
+	}
+	// same size and mod time, not read again
+	ioutil.WriteFile(fpath, []byte("garbage garbage garbage garbage garbage!!\r\n"), 0644)
+	os.Chtimes(fpath, fi.ModTime(), fi.ModTime())
+	if err := b.checkAdminFile("0000000001", validTransactionLine); err != nil {
+		t.Fatalf("expect cached result, got %v", err)
+	}
+	os.Chtimes(fpath, fi.ModTime(), fi.ModTime().Add(time.Second))
+	if err := b.checkAdminFile("0000000001", validTransactionLine); err != ErrMalformedFile {
+		t.Fatalf("expect malformed once changed, got %v", err)
+	}
+}
@@ -0,0 +1,352 @@
+package symbol
+
+import (
+	"container/heap"
+	"context"
+	"encoding/json"
+	"fmt"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+
+	log "gopkg.in/clog.v1"
+)
+
+// Priority of an ingest job, higher priority jobs run first.
+//
+type Priority int
+
+const (
+	PriorityLow    Priority = -1
+	PriorityNormal Priority = 0 // zero value, so branches saved before keep normal priority
+	PriorityHigh   Priority = 1
+	PriorityHotfix Priority = 2
+
+	// PriorityDefault use the branch default priority
+	PriorityDefault Priority = -128
+)
+
+var priorityNames = map[Priority]string{
+	PriorityLow:    "low",
+	PriorityNormal: "normal",
+	PriorityHigh:   "high",
+	PriorityHotfix: "hotfix",
+}
+
+// String return the name of priority
+func (p Priority) String() string {
+	if name, ok := priorityNames[p]; ok {
+		return name
+	}
+	return "default"
+}
+
+// ParsePriority parse priority from name or number, empty string is `PriorityDefault`.
+//
+func ParsePriority(s string) (Priority, error) {
+	s = strings.ToLower(strings.TrimSpace(s))
+	if s == "" || s == "default" {
+		return PriorityDefault, nil
+	}
+	for p, name := range priorityNames {
+		if s == name {
+			return p, nil
+		}
+	}
+	if n, err := strconv.Atoi(s); err == nil && n >= int(PriorityLow) && n <= int(PriorityHotfix) {
+		return Priority(n), nil
+	}
+	return PriorityDefault, fmt.Errorf("unknown priority %q", s)
+}
+
+// MarshalJSON encode priority as name
+func (p Priority) MarshalJSON() ([]byte, error) {
+	return json.Marshal(p.String())
+}
+
+// UnmarshalJSON accept both name and number
+func (p *Priority) UnmarshalJSON(data []byte) error {
+	s := strings.Trim(string(data), "\"")
+	v, err := ParsePriority(s)
+	if err != nil {
+		return err
+	}
+	*p = v
+	return nil
+}
+
+// ingestJob is one queued AddBuild request
+//
+type ingestJob struct {
+	builder  Builder
+	version  string
+	priority Priority
+	seq      uint64 // keep FIFO order within same priority
+	index    int
+	info     *Job               // status of the job, see Job
+	finished chan struct{}      // closed once the job is finished, see wait
+	cancel   bool               // cancel asked while running, stop at next stage
+	abort    context.CancelFunc // abort the running ingest, eg: a copy hung on the build share
+}
+
+func (j *ingestJob) key() string {
+	return strings.ToLower(j.builder.Name()) + "|" + j.version
+}
+
+// jobHeap order jobs by priority, then by enqueue sequence
+type jobHeap []*ingestJob
+
+func (h jobHeap) Len() int { return len(h) }
+func (h jobHeap) Less(i, j int) bool {
+	if h[i].priority != h[j].priority {
+		return h[i].priority > h[j].priority
+	}
+	return h[i].seq < h[j].seq
+}
+func (h jobHeap) Swap(i, j int) {
+	h[i], h[j] = h[j], h[i]
+	h[i].index = i
+	h[j].index = j
+}
+func (h *jobHeap) Push(x interface{}) {
+	job := x.(*ingestJob)
+	job.index = len(*h)
+	*h = append(*h, job)
+}
+func (h *jobHeap) Pop() interface{} {
+	old := *h
+	n := len(old)
+	job := old[n-1]
+	old[n-1] = nil
+	job.index = -1
+	*h = old[:n-1]
+	return job
+}
+
+// jobQueue is the ingest worker pool. Queued jobs are ordered by priority,
+// running jobs are never interrupted, and each branch ingest one build at a time.
+//
+type jobQueue struct {
+	mx      sync.Mutex
+	cond    *sync.Cond
+	pending jobHeap
+	queued  map[string]*ingestJob // branch|version => queued job
+	running map[string]bool       // branches being ingested
+	jobs    map[string]*ingestJob // job ID => job, unfinished and the latest finished
+	history []string              // IDs of finished jobs, oldest first
+	seq     uint64
+	closed  bool
+	paused  string // read-only store jobs wait for, see pause
+	frozen  bool   // relocation cutover, see freeze
+	wg      sync.WaitGroup
+}
+
+func newJobQueue() *jobQueue {
+	q := &jobQueue{
+		queued:  make(map[string]*ingestJob),
+		running: make(map[string]bool),
+		jobs:    make(map[string]*ingestJob),
+	}
+	q.cond = sync.NewCond(&q.mx)
+	return q
+}
+
+// Start run `workers` goroutines to consume the queue.
+//
+func (q *jobQueue) Start(workers int) {
+	if workers <= 0 {
+		workers = 1
+	}
+	log.Info("[Queue] Start %d ingest workers.", workers)
+	for i := 0; i < workers; i++ {
+		q.wg.Add(1)
+		go q.work()
+	}
+}
+
+// Stop wait the running jobs finish, queued jobs are dropped.
+//
+func (q *jobQueue) Stop() {
+	q.mx.Lock()
+	q.closed = true
+	dropped := len(q.pending)
+	for _, job := range q.pending {
+		job.info.Status, job.info.Message = JobCanceled, ErrQueueClosed.Error()
+		close(job.finished)
+	}
+	q.cond.Broadcast()
+	q.mx.Unlock()
+
+	q.wg.Wait()
+	if dropped > 0 {
+		log.Warn("[Queue] Drop %d queued jobs.", dropped)
+	}
+}
+
+// Push add an ingest job. If the same build is already queued, its priority is raised
+// when needed. Jobs with higher priority are placed ahead of all queued lower ones.
+//
+func (q *jobQueue) Push(b Builder, version string, prio Priority) bool {
+	return q.push(b, version, prio) != nil
+}
+
+// push add an ingest job like Push, return the job or the queued one of the same build.
+// Nil if the queue is closed.
+func (q *jobQueue) push(b Builder, version string, prio Priority) *Job {
+	if prio == PriorityDefault {
+		prio = b.GetBranch().Priority
+	}
+	if prio == PriorityDefault {
+		// branch priority not set, eg: "priority": "default" in branch.bin
+		prio = PriorityNormal
+	}
+
+	q.mx.Lock()
+	defer q.mx.Unlock()
+	if q.closed {
+		return nil
+	}
+
+	job := &ingestJob{
+		builder:  b,
+		version:  version,
+		priority: prio,
+	}
+	if exist, ok := q.queued[job.key()]; ok {
+		if exist.priority < prio {
+			log.Info("[Queue] Raise job %s priority %s => %s.", exist.key(), exist.priority, prio)
+			exist.priority = prio
+			exist.info.Priority = prio
+			heap.Fix(&q.pending, exist.index)
+		}
+		return exist.snapshot()
+	}
+
+	preempted := 0
+	for _, p := range q.pending {
+		if p.priority < prio {
+			preempted++
+		}
+	}
+	if preempted > 0 {
+		log.Info("[Queue] Job %s (%s) preempts %d queued jobs.", job.key(), prio, preempted)
+	}
+
+	q.seq++
+	job.seq = q.seq
+	heap.Push(&q.pending, job)
+	q.queued[job.key()] = job
+	q.track(job)
+	q.cond.Signal()
+	return job.snapshot()
+}
+
+// Len return the count of queued jobs.
+func (q *jobQueue) Len() int {
+	q.mx.Lock()
+	defer q.mx.Unlock()
+	return len(q.pending)
+}
+
+// Jobs return queued jobs, the next to run first.
+func (q *jobQueue) Jobs() []*ingestJob {
+	q.mx.Lock()
+	arr := append([]*ingestJob{}, q.pending...)
+	q.mx.Unlock()
+	sort.Slice(arr, func(i, j int) bool {
+		return jobHeap(arr).Less(i, j)
+	})
+	return arr
+}
+
+// next block until a runnable job is available, return nil if closed.
+func (q *jobQueue) next() *ingestJob {
+	q.mx.Lock()
+	defer q.mx.Unlock()
+
+	for {
+		if q.closed {
+			return nil
+		}
+		if q.paused != "" || q.frozen || fenced() != "" {
+			q.cond.Wait()
+			continue
+		}
+		var skipped []*ingestJob
+		var job *ingestJob
+		for q.pending.Len() > 0 {
+			j := heap.Pop(&q.pending).(*ingestJob)
+			if q.running[strings.ToLower(j.builder.Name())] {
+				skipped = append(skipped, j)
+				continue
+			}
+			job = j
+			break
+		}
+		for _, j := range skipped {
+			heap.Push(&q.pending, j)
+		}
+		if job != nil {
+			delete(q.queued, job.key())
+			q.running[strings.ToLower(job.builder.Name())] = true
+			q.start(job)
+			return job
+		}
+		q.cond.Wait()
+	}
+}
+
+func (q *jobQueue) done(job *ingestJob) {
+	q.mx.Lock()
+	delete(q.running, strings.ToLower(job.builder.Name()))
+	q.cond.Broadcast()
+	q.mx.Unlock()
+}
+
+func (q *jobQueue) work() {
+	defer q.wg.Done()
+	for {
+		job := q.next()
+		if job == nil {
+			return
+		}
+		log.Trace("[Queue] Run job %s (%s).", job.key(), job.priority)
+		err := q.run(job)
+		if err == ErrJobCanceled {
+			log.Info("[Queue] Job %s canceled.", job.key())
+		} else if err != nil {
+			log.Error(2, "[Queue] Job %s failed: %v.", job.key(), err)
+			if b, ok := job.builder.(*BrBuilder); ok {
+				b.recordFailure(job.version, err)
+			}
+			if ro, ok := err.(*ReadOnlyError); ok {
+				q.pause(job, ro)
+			}
+		}
+		q.finish(job, err)
+		q.done(job)
+	}
+}
+
+// run ingest the build of `job`, branches report progress of each stage to it
+func (q *jobQueue) run(job *ingestJob) error {
+	ctx, abort := context.WithCancel(context.Background())
+	defer abort()
+	q.mx.Lock()
+	job.abort = abort
+	q.mx.Unlock()
+
+	var err error
+	if b, ok := job.builder.(*BrBuilder); ok {
+		err = b.ingestBuild(ctx, job.version, func(version string, stage JobStage) error {
+			return q.progress(job, version, stage)
+		})
+	} else {
+		err = job.builder.AddBuild(ctx, job.version)
+	}
+	if err != nil && ctx.Err() == context.Canceled {
+		return ErrJobCanceled
+	}
+	return err
+}
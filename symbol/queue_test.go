@@ -0,0 +1,162 @@
+package symbol
+
+import (
+	"context"
+	"sync"
+	"testing"
+	"time"
+)
+
+type fakeBuilder struct {
+	BrBuilder
+	mx    *sync.Mutex
+	order *[]string
+}
+
+func (f *fakeBuilder) AddBuild(ctx context.Context, version string) error {
+	f.mx.Lock()
+	defer f.mx.Unlock()
+	*f.order = append(*f.order, f.Name()+":"+version)
+	return nil
+}
+
+func TestJobQueuePriority(t *testing.T) {
+	var (
+		mx    sync.Mutex
+		order []string
+	)
+	newFake := func(name string, prio Priority) *fakeBuilder {
+		return &fakeBuilder{
+			BrBuilder: BrBuilder{Branch: Branch{StoreName: name, Priority: prio}},
+			mx:        &mx,
+			order:     &order,
+		}
+	}
+
+	nightly := newFake("nightly", PriorityLow)
+	main := newFake("main", PriorityNormal)
+	hotfix := newFake("hotfix", PriorityNormal)
+
+	q := newJobQueue()
+	q.Push(nightly, "1", PriorityDefault)
+	q.Push(main, "2", PriorityDefault)
+	q.Push(hotfix, "3", PriorityHotfix)
+	q.Push(nightly, "1", PriorityHigh) // raise queued job
+
+	if q.Len() != 3 {
+		t.Fatalf("expect 3 queued jobs, got %d", q.Len())
+	}
+
+	q.Start(1)
+	for q.Len() > 0 {
+		time.Sleep(time.Millisecond)
+	}
+	q.Stop()
+
+	expect := []string{"hotfix:3", "nightly:1", "main:2"}
+	if len(order) != len(expect) {
+		t.Fatalf("expect %v, got %v", expect, order)
+	}
+	for i := range expect {
+		if order[i] != expect[i] {
+			t.Fatalf("expect %v, got %v", expect, order)
+		}
+	}
+}
+
+func TestJobQueueUnsetPriority(t *testing.T) {
+	var (
+		mx    sync.Mutex
+		order []string
+	)
+	low := &fakeBuilder{BrBuilder: BrBuilder{Branch: Branch{StoreName: "low", Priority: PriorityLow}}, mx: &mx, order: &order}
+	unset := &fakeBuilder{BrBuilder: BrBuilder{Branch: Branch{StoreName: "unset", Priority: PriorityDefault}}, mx: &mx, order: &order}
+
+	q := newJobQueue()
+	q.Push(low, "1", PriorityDefault)
+	job := q.push(unset, "2", PriorityDefault)
+	if job.Priority != PriorityNormal {
+		t.Errorf("expect normal priority of branch without one, got %s", job.Priority)
+	}
+
+	q.Start(1)
+	for q.Len() > 0 {
+		time.Sleep(time.Millisecond)
+	}
+	q.Stop()
+	if len(order) != 2 || order[0] != "unset:2" {
+		t.Errorf("branch without priority should run before low ones, got %v", order)
+	}
+}
+
+func TestParsePriority(t *testing.T) {
+	cases := map[string]Priority{
+		"":       PriorityDefault,
+		"hotfix": PriorityHotfix,
+		"Low":    PriorityLow,
+		"1":      PriorityHigh,
+	}
+	for s, expect := range cases {
+		if p, err := ParsePriority(s); err != nil || p != expect {
+			t.Errorf("parse %q: expect %s, got %s (%v)", s, expect, p, err)
+		}
+	}
+	if _, err := ParsePriority("urgent"); err == nil {
+		t.Error("expect error for unknown priority")
+	}
+}
+
+func TestJobCancel(t *testing.T) {
+	var (
+		mx    sync.Mutex
+		order []string
+	)
+	main := &fakeBuilder{BrBuilder: BrBuilder{Branch: Branch{StoreName: "main"}}, mx: &mx, order: &order}
+	q := newJobQueue()
+	j1 := q.push(main, "1", PriorityDefault)
+	j2 := q.push(main, "2", PriorityDefault)
+	if j1 == nil || j2 == nil || j1.Status != JobQueued || q.push(main, "1", PriorityHigh).ID != j1.ID {
+		t.Fatalf("expect queued jobs, got %+v %+v", j1, j2)
+	}
+
+	// queued job is removed
+	if job, err := q.Cancel(j2.ID); err != nil || job.Status != JobCanceled || q.Len() != 1 {
+		t.Fatalf("expect job 2 canceled, got %+v %v", job, err)
+	}
+	if _, err := q.Cancel(j2.ID); err != ErrJobFinished {
+		t.Errorf("expect finished job, got %v", err)
+	}
+
+	// running job stops before the store is modified
+	job := q.next()
+	if err := q.progress(job, "1", StageUnzipping); err != nil {
+		t.Fatal(err)
+	}
+	if info, err := q.Cancel(j1.ID); err != nil || info.Status != JobRunning || info.Stage != StageUnzipping {
+		t.Fatalf("expect running job canceling, got %+v %v", info, err)
+	}
+	err := q.progress(job, "1", StageStoring)
+	if err != ErrJobCanceled {
+		t.Fatalf("expect job canceled, got %v", err)
+	}
+	q.finish(job, err)
+	q.done(job)
+	if info := q.Job(j1.ID); info.Status != JobCanceled || info.Finished == "" {
+		t.Errorf("expect job 1 canceled, got %+v", info)
+	}
+
+	// storing job can't be canceled
+	j3 := q.push(main, "3", PriorityDefault)
+	job = q.next()
+	q.progress(job, "3", StageStoring)
+	if _, err := q.Cancel(j3.ID); err != ErrJobUncancel {
+		t.Errorf("expect storing job not canceled, got %v", err)
+	}
+	q.finish(job, nil)
+	q.done(job)
+
+	jobs := q.List("MAIN", "")
+	if len(jobs) != 3 || q.List("", JobSucceeded)[0].ID != j3.ID || len(order) != 0 {
+		t.Errorf("unexpected jobs %+v", jobs)
+	}
+}
@@ -0,0 +1,158 @@
+package symbol
+
+import (
+	"container/heap"
+	"fmt"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"strings"
+	"syscall"
+	"time"
+
+	"github.com/adyzng/GoSymbols/alert"
+	"github.com/adyzng/GoSymbols/config"
+	log "gopkg.in/clog.v1"
+)
+
+const (
+	writeProbeFile = "writable.probe" // created and removed in 000Admin to check the store accept writes
+)
+
+var (
+	// WriteProbe check store `path` accept writes, replaced in tests to flip a store read-only
+	WriteProbe = probeWritable
+)
+
+// ReadOnlyError is an ingest stopped as the store refuse writes, eg: NAS snapshot or failover.
+//
+type ReadOnlyError struct {
+	Path string   // store root
+	IDs  []string // transactions added before the store turned read-only, left partial
+	Err  error
+}
+
+func (e *ReadOnlyError) Error() string {
+	if len(e.IDs) > 0 {
+		return fmt.Sprintf("store %s is read-only, transactions %s left partial: %v",
+			e.Path, strings.Join(e.IDs, ","), e.Err)
+	}
+	return fmt.Sprintf("store %s is read-only: %v", e.Path, e.Err)
+}
+
+// isReadOnly check if `err` is of the classes meaning the store refuse writes as a whole
+func isReadOnly(err error) bool {
+	switch e := err.(type) {
+	case *ReadOnlyError:
+		return true
+	case *os.PathError:
+		err = e.Err
+	case *os.LinkError:
+		err = e.Err
+	case *os.SyscallError:
+		err = e.Err
+	}
+	if errno, ok := err.(syscall.Errno); ok {
+		for _, ro := range readOnlyErrnos {
+			if errno == ro {
+				return true
+			}
+		}
+	}
+	return false
+}
+
+// probeWritable create and remove a file in 000Admin of store `path`
+func probeWritable(path string) error {
+	fpath := filepath.Join(path, adminDir, writeProbeFile)
+	if err := ioutil.WriteFile(fpath, []byte(timestamp(now())), 0644); err != nil {
+		return err
+	}
+	return os.Remove(fpath)
+}
+
+// checkWritable return ReadOnlyError if the store refuse writes, other probe errors
+// (eg: 000Admin not created yet) are left to the ingest itself.
+func (b *BrBuilder) checkWritable() error {
+	if err := WriteProbe(b.StorePath); err != nil && isReadOnly(err) {
+		return &ReadOnlyError{Path: b.StorePath, Err: err}
+	}
+	return nil
+}
+
+// readOnly wrap failure `err` of ingest `in` as ReadOnlyError if the store refuse writes.
+// The error itself may be opaque (eg: symstore.exe output), so the store is probed too.
+func (b *BrBuilder) readOnly(in *ingest, err error) error {
+	if err == nil {
+		return nil
+	}
+	ro, ok := err.(*ReadOnlyError)
+	if !ok {
+		if !isReadOnly(err) {
+			if perr := WriteProbe(b.StorePath); perr == nil || !isReadOnly(perr) {
+				return err
+			}
+		}
+		ro = &ReadOnlyError{Path: b.StorePath, Err: err}
+	}
+	for _, build := range in.builds {
+		ro.IDs = append(ro.IDs, build.ID)
+	}
+	return ro
+}
+
+// pause stop handing out jobs as the store of `job` turned read-only. The job is retried
+// first once the store is writable again, unless it left partial transactions which need
+// to be purged by hand.
+func (q *jobQueue) pause(job *ingestJob, e *ReadOnlyError) {
+	q.mx.Lock()
+	defer q.mx.Unlock()
+	if q.closed {
+		return
+	}
+	if _, ok := q.queued[job.key()]; !ok && len(e.IDs) == 0 {
+		// keep its sequence, so it's ahead of jobs queued since
+		heap.Push(&q.pending, job)
+		q.queued[job.key()] = job
+	}
+	if q.paused != "" {
+		return
+	}
+	q.paused = e.Path
+	log.Warn("[Queue] Pause ingest, %v.", e)
+	alert.Raise(alert.KindStoreReadOnly, job.builder.Name(), "%v. Ingest paused until it's writable.", e)
+	go q.watch(e.Path)
+}
+
+// Paused return the read-only store the queue is paused for, empty if running.
+func (q *jobQueue) Paused() string {
+	q.mx.Lock()
+	defer q.mx.Unlock()
+	return q.paused
+}
+
+// watch probe store `path` every `[ingest] READONLY_PROBE` seconds, resume the queue
+// when it accept writes again.
+func (q *jobQueue) watch(path string) {
+	interval := time.Duration(config.ReadOnlyProbe) * time.Second
+	if interval <= 0 {
+		interval = 30 * time.Second
+	}
+	for {
+		time.Sleep(interval)
+		q.mx.Lock()
+		closed := q.closed
+		q.mx.Unlock()
+		if closed {
+			return
+		}
+		if err := WriteProbe(path); err == nil || !isReadOnly(err) {
+			break
+		}
+	}
+	q.mx.Lock()
+	q.paused = ""
+	q.cond.Broadcast()
+	q.mx.Unlock()
+	log.Info("[Queue] Store %s is writable again, resume ingest.", path)
+}
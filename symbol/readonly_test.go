@@ -0,0 +1,82 @@
+package symbol
+
+import (
+	"context"
+	"fmt"
+	"os"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/adyzng/GoSymbols/alert"
+	"github.com/adyzng/GoSymbols/config"
+)
+
+type roBuilder struct {
+	BrBuilder
+	ro   *int32 // store read-only while set
+	done chan string
+}
+
+func (f *roBuilder) AddBuild(ctx context.Context, version string) error {
+	if atomic.LoadInt32(f.ro) == 1 {
+		return &ReadOnlyError{Path: f.StorePath, Err: fmt.Errorf("symstore.exe failed")}
+	}
+	f.done <- version
+	return nil
+}
+
+func TestReadOnlyPause(t *testing.T) {
+	erofs := &os.PathError{Op: "open", Path: "S:\\000Admin\\server.txt", Err: readOnlyErrnos[0]}
+	if !isReadOnly(erofs) || isReadOnly(os.ErrNotExist) || isReadOnly(fmt.Errorf("opaque")) {
+		t.Fatal("unexpected read-only classification")
+	}
+
+	var ro int32 = 1
+	defer func(probe func(string) error, interval int) {
+		WriteProbe, config.ReadOnlyProbe = probe, interval
+	}(WriteProbe, config.ReadOnlyProbe)
+	WriteProbe = func(path string) error {
+		if atomic.LoadInt32(&ro) == 1 {
+			return erofs
+		}
+		return nil
+	}
+	config.ReadOnlyProbe = 1
+
+	b := &BrBuilder{Branch: Branch{StoreName: "UDP", StorePath: "S:"}}
+	in := b.startIngest("100")
+	in.builds = []*Build{{ID: "0000000007"}}
+	err := b.readOnly(in, fmt.Errorf("symstore.exe exit 1"))
+	if e, ok := err.(*ReadOnlyError); !ok || len(e.IDs) != 1 {
+		t.Fatalf("opaque failure on read-only store should be ReadOnlyError with partial ids, got %v", err)
+	}
+
+	f := &roBuilder{BrBuilder: BrBuilder{Branch: b.Branch}, ro: &ro, done: make(chan string, 1)}
+	q := newJobQueue()
+	q.Push(f, "100", PriorityNormal)
+	q.Start(1)
+	defer q.Stop()
+	for i := 0; q.Paused() == "" && i < 1000; i++ {
+		time.Sleep(time.Millisecond)
+	}
+	if q.Paused() != "S:" || q.Len() != 1 {
+		t.Fatalf("expect queue paused with the job requeued, got %q (%d jobs)", q.Paused(), q.Len())
+	}
+	if a := alert.Recent(1); len(a) != 1 || a[0].Kind != alert.KindStoreReadOnly {
+		t.Errorf("expect read-only alert, got %+v", a)
+	}
+
+	atomic.StoreInt32(&ro, 0)
+	select {
+	case v := <-f.done:
+		if v != "100" {
+			t.Errorf("expect build 100 resumed, got %s", v)
+		}
+	case <-time.After(5 * time.Second):
+		t.Fatal("ingest not resumed after store is writable")
+	}
+	if q.Paused() != "" {
+		t.Errorf("expect queue resumed")
+	}
+}
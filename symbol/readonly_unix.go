@@ -0,0 +1,9 @@
+// +build !windows
+
+package symbol
+
+import "syscall"
+
+// readOnlyErrnos mean the store refuse writes as a whole, eg: NFS export or volume
+// remounted read-only by snapshot or failover
+var readOnlyErrnos = []syscall.Errno{syscall.EROFS, syscall.EACCES, syscall.EPERM}
@@ -0,0 +1,11 @@
+package symbol
+
+import "syscall"
+
+// readOnlyErrnos mean the store refuse writes as a whole, eg: SMB share flipped
+// read-only by NAS snapshot or failover
+var readOnlyErrnos = []syscall.Errno{
+	syscall.ERROR_ACCESS_DENIED,
+	syscall.Errno(19), // ERROR_WRITE_PROTECT
+	syscall.Errno(65), // ERROR_NETWORK_ACCESS_DENIED
+}
@@ -0,0 +1,377 @@
+package symbol
+
+import (
+	"context"
+	"fmt"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/adyzng/GoSymbols/activity"
+	"github.com/adyzng/GoSymbols/config"
+	"github.com/adyzng/GoSymbols/encrypt"
+	"github.com/adyzng/GoSymbols/pdb"
+	log "gopkg.in/clog.v1"
+)
+
+const (
+	filePtr = "file.ptr" // symstore.exe pointer to a file kept out of store
+)
+
+var (
+	ErrRecompressRunning = fmt.Errorf("recompression of the branch is running")
+)
+
+// RecompressOption control the migration of stored builds to compressed files
+//
+type RecompressOption struct {
+	Limit int `json:"limit"` // max builds to migrate, 0 for all
+	Rate  int `json:"rate"`  // MB read per second, 0 for `[compress] RATE`
+}
+
+// RecompressProgress report the state of an recompression task
+//
+type RecompressProgress struct {
+	Branch   string            `json:"branch"`
+	Total    int               `json:"total"`   // builds to migrate
+	Done     int               `json:"done"`    // builds migrated
+	Files    int               `json:"files"`   // files compressed
+	Skipped  int               `json:"skipped"` // already compressed, file.ptr or encrypted files
+	Failed   int               `json:"failed"`
+	Bytes    int64             `json:"bytes"` // uncompressed bytes read
+	Saved    int64             `json:"saved"` // bytes saved in store
+	Current  string            `json:"current"`
+	Started  string            `json:"started"`
+	Finished string            `json:"finished"`
+	Errors   map[string]string `json:"errors,omitempty"` // `name\hash` => error
+	Running  bool              `json:"running"`
+	Paused   bool              `json:"paused"`
+}
+
+// recompressTask compress stored files build by build, least downloaded and oldest first
+type recompressTask struct {
+	mx       sync.Mutex
+	cond     *sync.Cond
+	progress RecompressProgress
+	stop     chan struct{}
+	once     sync.Once
+}
+
+// downloadCounts return downloads of `{hash}/{name}` (lower case) of the branch in usage
+// recorded by package activity, empty if activity is disabled.
+func (b *BrBuilder) downloadCounts() map[string]int64 {
+	counts := make(map[string]int64)
+	if config.ActivityDir == "" {
+		return counts
+	}
+	to := now()
+	from := to.AddDate(0, 0, -config.ActivityRetentionDays)
+	prefix := strings.ToLower(b.Name()) + "/"
+	for _, u := range activity.Hourly(from, to.Add(time.Hour)) {
+		for obj, n := range u.Objects {
+			if obj = strings.ToLower(obj); strings.HasPrefix(obj, prefix) {
+				counts[obj[len(prefix):]] += n
+			}
+		}
+	}
+	return counts
+}
+
+// recompressOrder return builds of the branch least downloaded first, then oldest first
+func (b *BrBuilder) recompressOrder() ([]*Build, error) {
+	var builds []*Build
+	if _, err := b.ParseBuilds(context.Background(), func(build *Build) error {
+		builds = append(builds, build)
+		return nil
+	}); err != nil {
+		return nil, err
+	}
+	counts := b.downloadCounts()
+	hits := make(map[string]int64, len(builds))
+	for _, build := range builds {
+		keys, err := b.transactionKeys(build.ID)
+		if err != nil {
+			return nil, err
+		}
+		for _, key := range keys {
+			ss := strings.Split(strings.ToLower(key), "\\")
+			hits[build.ID] += counts[ss[1]+"/"+ss[0]]
+		}
+	}
+	sort.SliceStable(builds, func(i, j int) bool {
+		if hits[builds[i].ID] != hits[builds[j].ID] {
+			return hits[builds[i].ID] < hits[builds[j].ID]
+		}
+		return builds[i].ID < builds[j].ID
+	})
+	return builds, nil
+}
+
+// compressFile replace stored file `name` `hash` by its compressed file, return bytes read
+// and saved. Missing (already compressed), file.ptr and encrypted files are skipped.
+func (b *BrBuilder) compressFile(name, hash string) (read, saved int64, skipped bool, err error) {
+	dir := b.symbolDir(name, hash)
+	src := filepath.Join(dir, name)
+	st, err := os.Stat(src)
+	if err != nil || st.IsDir() {
+		return 0, 0, true, nil
+	}
+	if _, err = os.Stat(filepath.Join(dir, filePtr)); err == nil || encrypt.IsEncrypted(src) {
+		return 0, 0, true, nil
+	}
+
+	dst := filepath.Join(dir, pdb.CompressedName(name))
+	tmp := dst + ".tmp"
+	if err = SymCompressor.Compress(src, tmp); err != nil {
+		os.Remove(tmp)
+		return 0, 0, false, err
+	}
+	cst, err := os.Stat(tmp)
+	if err == nil {
+		err = os.Rename(tmp, dst)
+	}
+	if err != nil {
+		os.Remove(tmp)
+		return 0, 0, false, err
+	}
+	b.sumMx.Lock()
+	b.releaseFile(src)
+	b.sumMx.Unlock()
+	if err = os.Remove(src); err != nil {
+		return st.Size(), 0, false, err
+	}
+
+	b.sumMx.Lock()
+	if b.sums != nil {
+		// compressed file is hashed on request
+		delete(b.sums, b.relPath(src))
+	}
+	b.sumMx.Unlock()
+	return st.Size(), st.Size() - cst.Size(), false, nil
+}
+
+// recompressBuild compress all files of transaction `build`, block ingest of the branch
+// and snapshots meanwhile.
+func (b *BrBuilder) recompressBuild(t *recompressTask, build *Build, rate int64) error {
+	keys, err := b.transactionKeys(build.ID)
+	if err != nil {
+		return err
+	}
+	b.ingMx.Lock()
+	defer b.ingMx.Unlock()
+	defer beginWrite()()
+
+	for _, key := range keys {
+		if !t.wait() {
+			return nil
+		}
+		ss := strings.Split(key, "\\")
+		start := now()
+		read, saved, skipped, err := b.compressFile(ss[0], ss[1])
+
+		t.mx.Lock()
+		switch {
+		case err != nil:
+			t.progress.Failed++
+			t.progress.Errors[key] = err.Error()
+			log.Warn("[Branch] Compress %s of %s failed: %v.", key, b.Name(), err)
+		case skipped:
+			t.progress.Skipped++
+		default:
+			t.progress.Files++
+			t.progress.Bytes += read
+			t.progress.Saved += saved
+		}
+		t.mx.Unlock()
+
+		// rate limit by bytes read
+		if rate > 0 && read > 0 {
+			if d := time.Duration(read*int64(time.Second)/rate) - now().Sub(start); d > 0 {
+				select {
+				case <-t.stop:
+					return nil
+				case <-time.After(d):
+				}
+			}
+		}
+	}
+	return nil
+}
+
+// Recompress start migrating stored builds of given branch to compressed files in
+// background, least downloaded and oldest builds first.
+//
+func (ss *sserver) Recompress(storeName string, opt RecompressOption) (*RecompressProgress, error) {
+	bu := ss.Get(storeName)
+	if bu == nil {
+		return nil, ErrBranchNotInit
+	}
+	b, ok := bu.(*BrBuilder)
+	if !ok {
+		return nil, ErrBranchNotInit
+	}
+	if err := b.writable(); err != nil {
+		return nil, err
+	}
+
+	lower := strings.ToLower(storeName)
+	ss.lck.Lock()
+	if t, ok := ss.recompress[lower]; ok && t.running() {
+		ss.lck.Unlock()
+		return nil, ErrRecompressRunning
+	}
+	ss.lck.Unlock()
+
+	builds, err := b.recompressOrder()
+	if err != nil {
+		return nil, err
+	}
+	if opt.Limit > 0 && len(builds) > opt.Limit {
+		builds = builds[:opt.Limit]
+	}
+	if opt.Rate <= 0 {
+		opt.Rate = config.RecompressRate
+	}
+
+	task := &recompressTask{
+		stop: make(chan struct{}),
+		progress: RecompressProgress{
+			Branch:  b.Name(),
+			Total:   len(builds),
+			Started: timestamp(now()),
+			Errors:  make(map[string]string),
+			Running: true,
+		},
+	}
+	task.cond = sync.NewCond(&task.mx)
+	ss.lck.Lock()
+	if ss.recompress == nil {
+		ss.recompress = make(map[string]*recompressTask)
+	}
+	ss.recompress[lower] = task
+	ss.lck.Unlock()
+
+	log.Info("[SS] Recompress %d builds of branch %s at %d MB/s.", len(builds), b.Name(), opt.Rate)
+	go task.run(b, builds, int64(opt.Rate)<<20)
+	return task.Progress(), nil
+}
+
+// RecompressProgress return progress of the last recompression task of given branch.
+//
+func (ss *sserver) RecompressProgress(storeName string) *RecompressProgress {
+	ss.lck.RLock()
+	defer ss.lck.RUnlock()
+	if t, ok := ss.recompress[strings.ToLower(storeName)]; ok {
+		return t.Progress()
+	}
+	return nil
+}
+
+// PauseRecompress pause or resume running recompression after current file.
+//
+func (ss *sserver) PauseRecompress(storeName string, pause bool) bool {
+	ss.lck.RLock()
+	t, ok := ss.recompress[strings.ToLower(storeName)]
+	ss.lck.RUnlock()
+	if !ok || !t.running() {
+		return false
+	}
+	t.mx.Lock()
+	t.progress.Paused = pause
+	t.cond.Broadcast()
+	t.mx.Unlock()
+	log.Info("[SS] Recompression of %s paused: %v.", storeName, pause)
+	return true
+}
+
+// StopRecompress abort running recompression after current file, it can be started again
+// and skip files already compressed.
+//
+func (ss *sserver) StopRecompress(storeName string) bool {
+	ss.lck.RLock()
+	t, ok := ss.recompress[strings.ToLower(storeName)]
+	ss.lck.RUnlock()
+	if !ok || !t.running() {
+		return false
+	}
+	t.once.Do(func() {
+		close(t.stop)
+		t.mx.Lock()
+		t.cond.Broadcast()
+		t.mx.Unlock()
+	})
+	return true
+}
+
+// Progress return a copy of current progress
+func (t *recompressTask) Progress() *RecompressProgress {
+	t.mx.Lock()
+	defer t.mx.Unlock()
+	p := t.progress
+	p.Errors = make(map[string]string, len(t.progress.Errors))
+	for k, v := range t.progress.Errors {
+		p.Errors[k] = v
+	}
+	return &p
+}
+
+func (t *recompressTask) running() bool {
+	t.mx.Lock()
+	defer t.mx.Unlock()
+	return t.progress.Running
+}
+
+// wait block while paused, return false if stopped
+func (t *recompressTask) wait() bool {
+	t.mx.Lock()
+	defer t.mx.Unlock()
+	for {
+		select {
+		case <-t.stop:
+			return false
+		default:
+		}
+		if !t.progress.Paused {
+			return true
+		}
+		t.cond.Wait()
+	}
+}
+
+func (t *recompressTask) run(b *BrBuilder, builds []*Build, rate int64) {
+	defer func() {
+		t.mx.Lock()
+		t.progress.Running = false
+		t.progress.Paused = false
+		t.progress.Current = ""
+		t.progress.Finished = timestamp(now())
+		p := t.progress
+		t.mx.Unlock()
+		log.Info("[SS] Recompress branch %s complete: %d builds, %d files, %d bytes saved, %d failed.",
+			b.Name(), p.Done, p.Files, p.Saved, p.Failed)
+	}()
+
+	for _, build := range builds {
+		if !t.wait() {
+			log.Warn("[SS] Recompression of branch %s stopped.", b.Name())
+			return
+		}
+		t.mx.Lock()
+		t.progress.Current = build.Key
+		t.mx.Unlock()
+
+		if err := b.recompressBuild(t, build, rate); err != nil {
+			t.mx.Lock()
+			t.progress.Failed++
+			t.progress.Errors[build.ID] = err.Error()
+			t.mx.Unlock()
+			continue
+		}
+		t.mx.Lock()
+		t.progress.Done++
+		t.mx.Unlock()
+	}
+}
@@ -0,0 +1,96 @@
+package symbol
+
+import (
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+)
+
+// fakeCab write the first byte of src as the compressed file
+type fakeCab struct {
+	files chan string
+}
+
+func (f fakeCab) Compress(src, dst string) error {
+	if f.files != nil {
+		f.files <- filepath.Base(src)
+	}
+	data, err := ioutil.ReadFile(src)
+	if err != nil {
+		return err
+	}
+	return ioutil.WriteFile(dst, data[:1], 0644)
+}
+
+func TestRecompress(t *testing.T) {
+	root, err := ioutil.TempDir("", "recompress")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(root)
+
+	admin := filepath.Join(root, adminDir)
+	os.MkdirAll(admin, 0755)
+	ioutil.WriteFile(filepath.Join(admin, "0000000002"), []byte(
+		"\"bar.pdb\\BBBB1\",\"S:\\000Unzip\\x64\\bar.pdb\"\r\n"+
+			"\"ptr.pdb\\CCCC1\",\"S:\\000Unzip\\x64\\ptr.pdb\"\r\n"), 0644)
+	ioutil.WriteFile(filepath.Join(admin, "0000000001"), []byte(
+		"\"foo.pdb\\AAAA1\",\"S:\\000Unzip\\x64\\foo.pdb\"\r\n"), 0644)
+	for _, p := range []string{"foo.pdb/AAAA1/foo.pdb", "bar.pdb/BBBB1/bar.pdb", "ptr.pdb/CCCC1/file.ptr"} {
+		fpath := filepath.Join(root, filepath.FromSlash(p))
+		os.MkdirAll(filepath.Dir(fpath), 0755)
+		ioutil.WriteFile(fpath, []byte("abcd"), 0644)
+	}
+
+	b := NewBranch2(&Branch{StoreName: "test", StorePath: root, BuildPath: root}).(*BrBuilder)
+	b.addBuild(&Build{ID: "0000000002", Version: "101"})
+	b.addBuild(&Build{ID: "0000000001", Version: "100"})
+	if _, err = b.Checksum(filepath.Join(root, "foo.pdb", "AAAA1", "foo.pdb")); err != nil {
+		t.Fatal(err)
+	}
+
+	files := make(chan string)
+	defer func(c Compressor) { SymCompressor = c }(SymCompressor)
+	SymCompressor = fakeCab{files: files}
+
+	ss := &sserver{builders: map[string]Builder{"test": b}}
+	if _, err = ss.Recompress("test", RecompressOption{}); err != nil {
+		t.Fatal(err)
+	}
+	if _, err = ss.Recompress("test", RecompressOption{}); err != ErrRecompressRunning {
+		t.Fatalf("expect recompress running, got %v", err)
+	}
+
+	// oldest build first, pause before the next file
+	if f := <-files; f != "foo.pdb" {
+		t.Fatalf("expect foo.pdb of oldest build first, got %s", f)
+	}
+	ss.PauseRecompress("test", true)
+	time.Sleep(50 * time.Millisecond)
+	if p := ss.RecompressProgress("test"); !p.Paused || p.Files != 1 {
+		t.Fatalf("expect paused after first file, got %+v", p)
+	}
+	ss.PauseRecompress("test", false)
+	if f := <-files; f != "bar.pdb" {
+		t.Fatalf("expect bar.pdb, got %s", f)
+	}
+	for i := 0; ss.RecompressProgress("test").Running && i < 1000; i++ {
+		time.Sleep(time.Millisecond)
+	}
+
+	p := ss.RecompressProgress("test")
+	if p.Running || p.Done != 2 || p.Files != 2 || p.Skipped != 1 || p.Failed != 0 || p.Saved != 6 {
+		t.Fatalf("unexpected progress %+v", p)
+	}
+	if _, err = os.Stat(filepath.Join(root, "foo.pdb", "AAAA1", "foo.pdb")); !os.IsNotExist(err) {
+		t.Errorf("expect original file removed, got %v", err)
+	}
+	if fpath := b.GetSymbolPath("AAAA1", "foo.pd_"); fpath != filepath.Join(root, "foo.pdb", "AAAA1", "foo.pd_") {
+		t.Errorf("unexpected compressed path %s", fpath)
+	}
+	if sum, _ := b.Checksum(filepath.Join(root, "foo.pdb", "AAAA1", "foo.pd_")); sum != "ca978112ca1bbdcafac231b39a23dc4da786eff8147c4e72b9807785afee48bb" {
+		t.Errorf("unexpected checksum of compressed file %s", sum)
+	}
+}
@@ -0,0 +1,140 @@
+package symbol
+
+import (
+	"context"
+	"io/fs"
+	"os"
+	"sort"
+	"strconv"
+	"strings"
+
+	log "gopkg.in/clog.v1"
+)
+
+const (
+	maxReindexMissing = 1000 // symbols listed in ReindexReport.Missing, the rest are only counted
+)
+
+// ReindexReport is the result of rebuilding the metadata of a branch from its store
+//
+type ReindexReport struct {
+	Branch       string   `json:"branch"`
+	Date         string   `json:"date"`
+	Builds       int      `json:"builds"`       // builds recovered from server.txt
+	Transactions int      `json:"transactions"` // transaction files parsed and indexed
+	Symbols      int      `json:"symbols"`      // `name\hash` keys of the transactions
+	LatestBuild  string   `json:"latestBuild"`
+	LastID       string   `json:"lastID"`
+	Layout       int      `json:"layout"`
+	Unreadable   []string `json:"unreadable,omitempty"` // transactions of server.txt which can't be parsed
+	Missing      []string `json:"missing,omitempty"`    // `name\hash` of transactions not found in the store tree
+	MissingTotal int      `json:"missingTotal"`         // Missing is cut at 1000
+	Orphans      []string `json:"orphans,omitempty"`    // transaction files neither in server.txt nor deleted
+}
+
+// Reindex rebuild what is known of the branch purely from its 000Admin files and the store
+// tree, for a lost branch.bin or a metadata database restored from an older backup. Parsed
+// builds and transactions are dropped and parsed again, and the branch is saved.
+//
+func (b *BrBuilder) Reindex() (*ReindexReport, error) {
+	b.ingMx.Lock()
+	defer b.ingMx.Unlock()
+
+	if _, err := fs.Stat(b.StoreFS(), adminName(serverTxt)); err != nil {
+		return nil, err
+	}
+	transactions.purge(b.StoreName)
+	if db := openMeta(); db != nil {
+		if err := db.dropParsed(b.StoreName); err != nil {
+			return nil, err
+		}
+	}
+
+	b.detectLayout()
+	b.mx.Lock()
+	b.builds = make(map[string]*Build)
+	b.mx.Unlock()
+	if _, err := b.ParseBuilds(context.Background(), nil); err != nil {
+		return nil, err
+	}
+
+	report := &ReindexReport{
+		Branch:      b.Name(),
+		Date:        timestamp(now()),
+		Builds:      b.BuildsCount,
+		LatestBuild: b.LatestBuild,
+		LastID:      b.GetLatestID(),
+		Layout:      b.Layout,
+	}
+	b.mx.RLock()
+	ids := make([]string, 0, len(b.builds))
+	for id := range b.builds {
+		ids = append(ids, id)
+	}
+	b.mx.RUnlock()
+	sort.Strings(ids)
+
+	for _, id := range ids {
+		entries, err := b.readTransaction(id)
+		if err != nil {
+			report.Unreadable = append(report.Unreadable, id)
+			continue
+		}
+		report.Transactions++
+		for _, e := range entries {
+			report.Symbols++
+			if b.Backend != "" {
+				// the store tree is only a cache of the backend
+				continue
+			}
+			if _, err = os.Stat(b.symbolDir(e.Name, e.Hash)); err != nil {
+				if report.MissingTotal++; len(report.Missing) < maxReindexMissing {
+					report.Missing = append(report.Missing, e.Name+"\\"+e.Hash)
+				}
+			}
+		}
+	}
+	report.Orphans = b.orphanTransactions()
+
+	if err := b.Persist(); err != nil {
+		return report, err
+	}
+	log.Info("[Branch] Reindex %s: %d builds, %d transactions, %d symbols, %d unreadable, %d missing, %d orphans.",
+		b.Name(), report.Builds, report.Transactions, report.Symbols, len(report.Unreadable),
+		report.MissingTotal, len(report.Orphans))
+	return report, nil
+}
+
+// orphanTransactions return transaction files of 000Admin which are neither in server.txt
+// nor deleted in history.txt
+func (b *BrBuilder) orphanTransactions() []string {
+	known := make(map[string]bool)
+	for _, name := range []string{serverTxt, historyTxt} {
+		lines, _ := b.transactionLines(name)
+		for _, line := range lines {
+			ss := strings.Split(line, ",")
+			switch {
+			case len(ss) >= 3 && ss[1] == "del":
+				known[ss[2]] = true
+			default:
+				known[ss[0]] = true
+			}
+		}
+	}
+
+	infos, err := fs.ReadDir(b.StoreFS(), adminDir)
+	if err != nil {
+		return nil
+	}
+	var orphans []string
+	for _, fi := range infos {
+		id := fi.Name()
+		if _, err := strconv.ParseUint(id, 10, 64); fi.IsDir() || len(id) != 10 || err != nil {
+			continue
+		}
+		if !known[id] {
+			orphans = append(orphans, id)
+		}
+	}
+	return orphans
+}
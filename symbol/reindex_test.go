@@ -0,0 +1,62 @@
+package symbol
+
+import (
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+func TestReindex(t *testing.T) {
+	root, err := ioutil.TempDir("", "reindex")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(root)
+
+	admin := filepath.Join(root, adminDir)
+	os.MkdirAll(admin, 0755)
+	for name, data := range map[string]string{
+		serverTxt: "0000000001,add,file,07/04/2017,14:44:14,\"UDPv5\",\"100\",\"\",\r\n" +
+			"0000000003,add,file,07/05/2017,14:44:14,\"UDPv5\",\"102\",\"\",\r\n",
+		historyTxt: "0000000002,add,file,07/04/2017,15:44:14,\"UDPv5\",\"101\",\"\",\r\n" +
+			"0000000004,del,0000000002\r\n",
+		lastidTxt:    "0000000005\r\n",
+		"0000000001": "\"foo.pdb\\AAAA1\",\"S:\\000Unzip\\x64\\foo.pdb\"\r\n",
+		"0000000002": "\"foo.pdb\\BBBB1\",\"S:\\000Unzip\\x64\\foo.pdb\"\r\n",
+		"0000000003": "\"foo.pdb\\CCCC1\",\"S:\\000Unzip\\x64\\foo.pdb\"\r\n\"bar.exe\\DDDD1\",\"S:\\000Unzip\\x64\\bar.exe\"\r\n",
+		"0000000005": "\"baz.dll\\EEEE1\",\"S:\\000Unzip\\x64\\baz.dll\"\r\n",
+	} {
+		ioutil.WriteFile(filepath.Join(admin, name), []byte(data), 0644)
+	}
+	for _, key := range []string{"foo.pdb/AAAA1", "foo.pdb/CCCC1"} {
+		os.MkdirAll(filepath.Join(root, filepath.FromSlash(key)), 0755)
+	}
+
+	// branch.bin lost, nothing known but the store
+	b := NewBranch2(&Branch{StoreName: "UDPv5", StorePath: root}).(*BrBuilder)
+	report, err := b.Reindex()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if report.Builds != 2 || report.Transactions != 2 || report.Symbols != 3 {
+		t.Errorf("expect 2 builds, 2 transactions and 3 symbols, got %+v", report)
+	}
+	if report.LatestBuild != "102" || report.LastID != "0000000005" || b.BuildsCount != 2 {
+		t.Errorf("unexpected latest build %s, last id %s", report.LatestBuild, report.LastID)
+	}
+	if report.MissingTotal != 1 || len(report.Missing) != 1 || report.Missing[0] != "bar.exe\\DDDD1" {
+		t.Errorf("expect bar.exe missing, got %v", report.Missing)
+	}
+	if len(report.Orphans) != 1 || report.Orphans[0] != "0000000005" {
+		t.Errorf("expect orphan 0000000005, got %v", report.Orphans)
+	}
+	if _, err = os.Stat(filepath.Join(admin, branchBin)); err != nil {
+		t.Errorf("branch not saved: %v", err)
+	}
+
+	os.Remove(filepath.Join(admin, serverTxt))
+	if _, err = b.Reindex(); !os.IsNotExist(err) {
+		t.Errorf("expect not exist without server.txt, got %v", err)
+	}
+}
@@ -0,0 +1,226 @@
+package symbol
+
+import (
+	"fmt"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+	"sync"
+
+	"github.com/adyzng/GoSymbols/audit"
+	"github.com/adyzng/GoSymbols/config"
+	log "gopkg.in/clog.v1"
+)
+
+var (
+	ErrCutover     = fmt.Errorf("store relocation in progress, store is read-only")
+	ErrNoCutover   = fmt.Errorf("no store relocation in progress")
+	ErrUnreachable = fmt.Errorf("relocated store unreachable")
+)
+
+// Cutover is the read-only window of an store relocation: ingest is paused and changes of
+// stores are refused, so the store copied to the new server stays complete.
+//
+type Cutover struct {
+	Since string `json:"since"`
+	User  string `json:"user"`
+	To    string `json:"to,omitempty"` // new store root being copied to
+}
+
+// RelocateReport is the result of moving store root `From` to `To`
+//
+type RelocateReport struct {
+	From        string   `json:"from"`
+	To          string   `json:"to"`
+	DryRun      bool     `json:"dryRun"`
+	Branches    []string `json:"branches"`              // branches whose store moved
+	Pointers    int      `json:"pointers"`              // file.ptr rewritten
+	Unreachable []string `json:"unreachable,omitempty"` // branches without 000Admin at new path
+	Destination string   `json:"destination,omitempty"` // new `[base] DESTINATION` to configure
+}
+
+var (
+	cutoverMx sync.RWMutex
+	cutover   *Cutover
+)
+
+// inCutover return the running relocation cutover, nil if none
+func inCutover() *Cutover {
+	cutoverMx.RLock()
+	defer cutoverMx.RUnlock()
+	return cutover
+}
+
+// BeginCutover start the read-only window before stores are copied to new root `to`.
+//
+func (ss *sserver) BeginCutover(user, to string) (*Cutover, error) {
+	cutoverMx.Lock()
+	if cutover != nil {
+		cutoverMx.Unlock()
+		return cutover, ErrCutover
+	}
+	cutover = &Cutover{Since: timestamp(now()), User: user, To: to}
+	c := cutover
+	cutoverMx.Unlock()
+
+	if ss.queue != nil {
+		ss.queue.freeze(true)
+	}
+	audit.Record(user, "cutover", "", "stores read-only for relocation to %s", to)
+	log.Warn("[SS] Stores read-only for relocation to %s by %s.", to, user)
+	return c, nil
+}
+
+// EndCutover make stores writable again and resume ingest.
+//
+func (ss *sserver) EndCutover(user string) error {
+	cutoverMx.Lock()
+	if cutover == nil {
+		cutoverMx.Unlock()
+		return ErrNoCutover
+	}
+	cutover = nil
+	cutoverMx.Unlock()
+
+	if ss.queue != nil {
+		ss.queue.freeze(false)
+	}
+	audit.Record(user, "cutover", "", "stores writable again")
+	log.Info("[SS] Relocation cutover ended by %s.", user)
+	return nil
+}
+
+// Cutover return the running relocation cutover, nil if none.
+//
+func (ss *sserver) Cutover() *Cutover {
+	return inCutover()
+}
+
+// freeze hold or release jobs of the queue for relocation cutover
+func (q *jobQueue) freeze(frozen bool) {
+	q.mx.Lock()
+	q.frozen = frozen
+	q.cond.Broadcast()
+	q.mx.Unlock()
+}
+
+// relocatePath replace root `from` of `path` with `to`, the match is case insensitive
+// as store paths are windows paths.
+func relocatePath(path, from, to string) (string, bool) {
+	if len(path) < len(from) || !strings.EqualFold(path[:len(from)], from) {
+		return path, false
+	}
+	rest := path[len(from):]
+	if rest != "" && rest[0] != '\\' && rest[0] != '/' {
+		return path, false
+	}
+	return to + rest, true
+}
+
+// relocatePointers rewrite file.ptr under store `root` pointing to `from`, return the
+// count of (dry run: to be) rewritten pointers.
+func relocatePointers(root, from, to string, dryRun bool) (int, error) {
+	count := 0
+	err := filepath.Walk(root, func(fpath string, info os.FileInfo, err error) error {
+		if err != nil {
+			return err
+		}
+		if info.IsDir() {
+			if info.Name() == adminDir {
+				return filepath.SkipDir
+			}
+			return nil
+		}
+		if !strings.EqualFold(info.Name(), filePtr) {
+			return nil
+		}
+		data, err := ioutil.ReadFile(fpath)
+		if err != nil {
+			return err
+		}
+		ptr, ok := relocatePath(strings.TrimSpace(string(data)), from, to)
+		if !ok {
+			return nil
+		}
+		count++
+		if dryRun {
+			return nil
+		}
+		return writeFileAtomic(fpath, []byte(ptr))
+	})
+	return count, err
+}
+
+// Relocate move store root `from` to `to`, eg: from `D:\SymbolServer` to
+// `\\symbols2\SymbolServer` after the stores are copied. Store path of branches under
+// `from` and file.ptr pointing to it are rewritten, branch.bin is saved to the new store.
+// Nothing is changed if any new store is unreachable, unless `force`. The caller save
+// branches, and the stores are expected not to change meanwhile (see BeginCutover).
+//
+func (ss *sserver) Relocate(from, to string, dryRun, force bool) (*RelocateReport, error) {
+	from = strings.TrimRight(from, "\\/")
+	to = strings.TrimRight(to, "\\/")
+	if from == "" || to == "" || strings.EqualFold(from, to) {
+		return nil, fmt.Errorf("invalid relocation from %q to %q", from, to)
+	}
+
+	ss.lck.Lock()
+	defer ss.lck.Unlock()
+
+	report := &RelocateReport{From: from, To: to, DryRun: dryRun}
+	moved := make(map[*BrBuilder]string)
+	for _, bu := range ss.builders {
+		b, ok := bu.(*BrBuilder)
+		if !ok {
+			continue
+		}
+		npath, ok := relocatePath(b.StorePath, from, to)
+		if !ok {
+			continue
+		}
+		moved[b] = npath
+		report.Branches = append(report.Branches, b.Name())
+		if st, err := os.Stat(filepath.Join(npath, adminDir)); err != nil || !st.IsDir() {
+			report.Unreachable = append(report.Unreachable, b.Name())
+		}
+	}
+	sort.Strings(report.Branches)
+	sort.Strings(report.Unreachable)
+	if dest, ok := relocatePath(strings.TrimRight(config.Destination, "\\/"), from, to); ok {
+		report.Destination = dest
+	}
+	if len(report.Unreachable) > 0 && !force {
+		log.Warn("[SS] Relocate to %s refused, unreachable branches: %v.", to, report.Unreachable)
+		return report, ErrUnreachable
+	}
+
+	// shared stores are walked once
+	walked := make(map[string]bool)
+	for b, npath := range moved {
+		if !walked[strings.ToLower(npath)] {
+			walked[strings.ToLower(npath)] = true
+			n, err := relocatePointers(npath, from, to, dryRun)
+			report.Pointers += n
+			if err != nil && !os.IsNotExist(err) {
+				log.Error(2, "[SS] Relocate file.ptr of %s failed: %v.", npath, err)
+				return report, err
+			}
+		}
+		if dryRun {
+			continue
+		}
+		b.StorePath = npath
+		b.detectLayout()
+		if err := b.Persist(); err != nil && !force {
+			return report, err
+		}
+		log.Info("[SS] Branch %s relocated to %s.", b.Name(), npath)
+	}
+	if !dryRun {
+		audit.Record("cli", "relocate", "", "store root %s relocated to %s, %d branches, %d file.ptr",
+			from, to, len(report.Branches), report.Pointers)
+	}
+	return report, nil
+}
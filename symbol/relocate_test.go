@@ -0,0 +1,70 @@
+package symbol
+
+import (
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+func TestRelocate(t *testing.T) {
+	if p, ok := relocatePath(`d:\symbolserver\UDP`, `D:\SymbolServer`, `\\sym2\Symbols`); !ok || p != `\\sym2\Symbols\UDP` {
+		t.Errorf("unexpected relocated path %s", p)
+	}
+	if _, ok := relocatePath(`D:\SymbolServer2\UDP`, `D:\SymbolServer`, `\\sym2\Symbols`); ok {
+		t.Errorf("expect sibling folder not relocated")
+	}
+
+	root, err := ioutil.TempDir("", "relocate")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(root)
+
+	from, to := filepath.Join(root, "old"), filepath.Join(root, "new")
+	ptr := filepath.Join(to, "UDP", "big.pdb", "AAAA1", filePtr)
+	os.MkdirAll(filepath.Join(to, "UDP", adminDir), 0755)
+	os.MkdirAll(filepath.Dir(ptr), 0755)
+	ioutil.WriteFile(ptr, []byte(filepath.Join(from, "Archive", "big.pdb")+"\r\n"), 0644)
+
+	udp := NewBranch2(&Branch{StoreName: "UDP", StorePath: filepath.Join(from, "UDP"), BuildPath: root}).(*BrBuilder)
+	arc := NewBranch2(&Branch{StoreName: "ARC", StorePath: filepath.Join(from, "ARC"), BuildPath: root}).(*BrBuilder)
+	other := NewBranch2(&Branch{StoreName: "Other", StorePath: filepath.Join(root, "other"), BuildPath: root}).(*BrBuilder)
+	ss := &sserver{builders: map[string]Builder{"udp": udp, "arc": arc, "other": other}}
+
+	report, err := ss.Relocate(from, to, false, false)
+	if err != ErrUnreachable || len(report.Unreachable) != 1 || report.Unreachable[0] != "ARC" {
+		t.Fatalf("expect ARC unreachable, got %v %+v", err, report)
+	}
+	if udp.StorePath != filepath.Join(from, "UDP") {
+		t.Fatalf("nothing should change if unreachable, got %s", udp.StorePath)
+	}
+
+	delete(ss.builders, "arc")
+	if report, err = ss.Relocate(from, to, true, false); err != nil || report.Pointers != 1 {
+		t.Fatalf("unexpected dry run %v %+v", err, report)
+	}
+	if report, err = ss.Relocate(from+string(filepath.Separator), to, false, false); err != nil {
+		t.Fatal(err)
+	}
+	if len(report.Branches) != 1 || udp.StorePath != filepath.Join(to, "UDP") || other.StorePath != filepath.Join(root, "other") {
+		t.Fatalf("unexpected relocation %+v", report)
+	}
+	if data, _ := ioutil.ReadFile(ptr); string(data) != filepath.Join(to, "Archive", "big.pdb") {
+		t.Errorf("unexpected file.ptr %s", data)
+	}
+	loaded := &BrBuilder{Branch: Branch{StoreName: "UDP", StorePath: udp.StorePath}}
+	if err = loaded.Load(); err != nil || loaded.StorePath != udp.StorePath {
+		t.Errorf("expect branch.bin saved in new store, got %v %s", err, loaded.StorePath)
+	}
+
+	if _, err = ss.BeginCutover("alice", to); err != nil {
+		t.Fatal(err)
+	}
+	if err = udp.writable(); err != ErrCutover {
+		t.Errorf("expect store read-only during cutover, got %v", err)
+	}
+	if err = ss.EndCutover("alice"); err != nil || udp.writable() != nil {
+		t.Errorf("expect store writable after cutover, got %v", err)
+	}
+}
@@ -0,0 +1,123 @@
+package symbol
+
+import (
+	"bufio"
+	"fmt"
+	"os"
+	"path/filepath"
+	"regexp"
+	"strings"
+
+	"github.com/adyzng/GoSymbols/pdb"
+	log "gopkg.in/clog.v1"
+)
+
+const (
+	renamesTxt = "renames.txt" // symbol files renamed at ingest, `{ID},{path under 000Unzip},{original name}`
+)
+
+// RenameRule normalize published symbol file names before they are added to store,
+// eg: {Pattern: `^(.+)_\d+\.pdb$`, Replace: "$1.pdb"} turn foo_4175.pdb into foo.pdb.
+//
+type RenameRule struct {
+	Pattern string `json:"pattern"` // regexp matching the whole file name, case insensitive
+	Replace string `json:"replace"` // replacement, $1 refer to sub match
+}
+
+// applyRenames rename symbol files under `dir` by branch rename rules, the first
+// matching rule win. Return lower slash path of new file relative to `dir` => original
+// name, files of the same new name in different folders keep their own original.
+func (b *BrBuilder) applyRenames(dir string) (map[string]string, error) {
+	renamed := make(map[string]string)
+	if len(b.Renames) == 0 {
+		return renamed, nil
+	}
+	rules := make([]*regexp.Regexp, len(b.Renames))
+	for i, r := range b.Renames {
+		re, err := regexp.Compile("(?i)" + r.Pattern)
+		if err != nil {
+			return nil, fmt.Errorf("invalid rename rule %q: %v", r.Pattern, err)
+		}
+		rules[i] = re
+	}
+
+	err := filepath.Walk(dir, func(fpath string, info os.FileInfo, err error) error {
+		if err != nil || info.IsDir() || !pdb.IsSymbolFile(info.Name()) {
+			return nil
+		}
+		name := info.Name()
+		for i, re := range rules {
+			if !re.MatchString(name) {
+				continue
+			}
+			newName := re.ReplaceAllString(name, b.Renames[i].Replace)
+			if newName == name || newName == "" || strings.ContainsAny(newName, "/\\") {
+				break
+			}
+			dst := filepath.Join(filepath.Dir(fpath), newName)
+			if _, err := os.Stat(dst); err == nil {
+				log.Warn("[Branch] Skip rename %s, %s already exist.", fpath, newName)
+				break
+			}
+			if err := os.Rename(fpath, dst); err != nil {
+				return err
+			}
+			log.Trace("[Branch] Rename %s to %s.", name, newName)
+			rel, _ := filepath.Rel(dir, dst)
+			renamed[strings.ToLower(filepath.ToSlash(rel))] = name
+			break
+		}
+		return nil
+	})
+	if len(renamed) != 0 {
+		log.Info("[Branch] Rename %d symbol files of %s by rules.", len(renamed), b.Name())
+	}
+	return renamed, err
+}
+
+// recordRenames append renamed files of transaction `id` to 000Admin/renames.txt
+func (b *BrBuilder) recordRenames(id string, renamed map[string]string) error {
+	if len(renamed) == 0 {
+		return nil
+	}
+	fpath := filepath.Join(b.StorePath, adminDir, renamesTxt)
+	fd, err := os.OpenFile(fpath, os.O_WRONLY|os.O_CREATE|os.O_APPEND, 0644)
+	if err != nil {
+		return err
+	}
+	defer fd.Close()
+	w := bufio.NewWriter(fd)
+	for name, original := range renamed {
+		fmt.Fprintf(w, "%s,%s,%s\r\n", id, name, original)
+	}
+	return w.Flush()
+}
+
+// originalNames return lower path relative to 000Unzip => original name of transaction
+// `id`, renames recorded before are keyed by lower new name. See originalOf.
+func (b *BrBuilder) originalNames(id string) map[string]string {
+	names := make(map[string]string)
+	fd, err := os.Open(filepath.Join(b.StorePath, adminDir, renamesTxt))
+	if err != nil {
+		return names
+	}
+	defer fd.Close()
+	scan := bufio.NewScanner(fd)
+	for scan.Scan() {
+		ss := strings.Split(strings.TrimSpace(scan.Text()), ",")
+		if len(ss) == 3 && ss[0] == id {
+			names[strings.ToLower(ss[1])] = ss[2]
+		}
+	}
+	return names
+}
+
+// originalOf return original name of symbol `name` at `spath` relative to 000Unzip, from
+// the renames of its transaction. Empty if not renamed.
+func originalOf(originals map[string]string, spath, name string) string {
+	rel := strings.ToLower(strings.Trim(strings.Replace(spath, "\\", "/", -1), "/"))
+	if original, ok := originals[rel]; ok {
+		return original
+	}
+	return originals[strings.ToLower(name)]
+}
@@ -0,0 +1,293 @@
+package symbol
+
+import (
+	"context"
+	"fmt"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/adyzng/GoSymbols/audit"
+	log "gopkg.in/clog.v1"
+)
+
+const (
+	retentionUser = "retention" // audit user of scheduled pruning
+)
+
+var (
+	ErrRetention = fmt.Errorf("invalid retention, expect non-negative keepLast and keepDays")
+)
+
+// Retention is the automatic pruning policy of a branch. A build is pruned once it's beyond
+// the newest `KeepLast` builds and older than `KeepDays`, a policy with only one of them set
+// prune by it alone. Builds of channels with `keep` are pruned by the channel instead.
+//
+type Retention struct {
+	KeepLast     int      `json:"keepLast,omitempty"`     // newest builds kept, 0 no limit by count
+	KeepDays     int      `json:"keepDays,omitempty"`     // builds newer than days kept, 0 no limit by age
+	KeepChannels []string `json:"keepChannels,omitempty"` // builds of these channels are never pruned, eg: ga
+}
+
+// RetentionPlan is the builds of a branch expired by its retention policies. The newest
+// build, builds marked release, held or still ingesting are never pruned.
+//
+type RetentionPlan struct {
+	Branch      string            `json:"branch"`
+	Pruned      []*Build          `json:"pruned"`              // oldest first, supplements go with their build
+	Protected   map[string]string `json:"protected,omitempty"` // expired build ID => why it's kept
+	Transaction string            `json:"transaction,omitempty"`
+	Symbols     int               `json:"symbols,omitempty"` // symbol files removed, shared ones are kept
+}
+
+// CheckRetention validate retention policy of an branch, nil for no policy.
+//
+func CheckRetention(r *Retention) error {
+	if r == nil {
+		return nil
+	}
+	if r.KeepLast < 0 || r.KeepDays < 0 {
+		return ErrRetention
+	}
+	for _, name := range r.KeepChannels {
+		if !channelName.MatchString(name) {
+			return ErrChannel
+		}
+	}
+	return nil
+}
+
+// expire check if build with `newer` builds after it is expired, `oldest` is the date
+// builds must be newer than
+func (r *Retention) expire(build *Build, newer int, oldest time.Time) bool {
+	if r.KeepLast == 0 && r.KeepDays == 0 {
+		return false
+	}
+	if r.KeepLast > 0 && newer < r.KeepLast {
+		return false
+	}
+	if r.KeepDays > 0 {
+		date, err := time.ParseInLocation(TimeFormat, build.Date, time.Local)
+		if err != nil || !date.Before(oldest) {
+			return false
+		}
+	}
+	return true
+}
+
+func (r *Retention) keepChannel(channel string) bool {
+	for _, name := range r.KeepChannels {
+		if channel != "" && name == channel {
+			return true
+		}
+	}
+	return false
+}
+
+// PlanRetention list builds the retention policies would prune without touching the store.
+//
+func (b *BrBuilder) PlanRetention() (*RetentionPlan, error) {
+	var builds []*Build
+	if _, err := b.ParseBuilds(context.Background(), func(build *Build) error {
+		if build.SupplementOf == "" {
+			builds = append(builds, build)
+		}
+		return nil
+	}); err != nil {
+		return nil, err
+	}
+	b.SortBuilds(builds)
+
+	policy := b.Retention
+	if policy == nil {
+		policy = &Retention{}
+	}
+	plan := &RetentionPlan{
+		Branch:    b.Name(),
+		Protected: make(map[string]string),
+	}
+	held, err := b.heldIDs()
+	if err != nil {
+		return nil, err
+	}
+	oldest := now().AddDate(0, 0, -policy.KeepDays)
+	counts := make(map[string]int) // channel => newer builds of it
+	var pruned []*Build
+	for i := len(builds) - 1; i >= 0; i-- {
+		build := builds[i]
+		var expired bool
+		if ch := b.channel(build.Channel); ch != nil && ch.Keep > 0 {
+			expired = counts[build.Channel] >= ch.Keep
+		} else {
+			expired = policy.expire(build, len(builds)-1-i, oldest)
+		}
+		counts[build.Channel]++
+		if !expired {
+			continue
+		}
+
+		switch {
+		case i == len(builds)-1:
+			plan.Protected[build.ID] = "latest"
+		case held[build.ID]:
+			plan.Protected[build.ID] = "hold"
+		case build.Release:
+			plan.Protected[build.ID] = "release"
+		case policy.keepChannel(build.Channel):
+			plan.Protected[build.ID] = "channel " + build.Channel
+		case !build.Status.Done():
+			plan.Protected[build.ID] = string(build.Status)
+		default:
+			pruned = append(pruned, build)
+		}
+	}
+	for i := len(pruned) - 1; i >= 0; i-- {
+		plan.Pruned = append(plan.Pruned, pruned[i])
+	}
+	return plan, nil
+}
+
+// Prune delete builds expired by the retention policies with their supplements as symstore
+// `del` does: the transactions are dropped from server.txt and recorded as deleted by a new
+// transaction in history.txt, then symbol files no longer referenced are removed. Every
+// pruned build is recorded in audit log as `user`.
+//
+func (b *BrBuilder) Prune(user string) (*RetentionPlan, error) {
+	b.ingMx.Lock()
+	defer b.ingMx.Unlock()
+	if err := b.writable(); err != nil {
+		return nil, err
+	}
+	defer beginWrite()()
+
+	plan, err := b.PlanRetention()
+	if err != nil || len(plan.Pruned) == 0 {
+		return plan, err
+	}
+	unlock, err := lockAdmin(b.StorePath)
+	if err != nil {
+		return nil, err
+	}
+	defer unlock()
+
+	dropped := make(map[string]bool)
+	var deleted []*Build
+	for _, build := range plan.Pruned {
+		dropped[build.ID] = true
+		deleted = append(deleted, build)
+		for _, id := range build.Supplements {
+			if sup := b.getBuild("", id); sup != nil {
+				dropped[id] = true
+				deleted = append(deleted, sup)
+			}
+		}
+	}
+
+	// files referenced by kept transactions or other branches of shared store stay
+	used, err := b.foreignKeys()
+	if err != nil {
+		return nil, err
+	}
+	b.mx.RLock()
+	ids := make([]string, 0, len(b.builds))
+	for id := range b.builds {
+		ids = append(ids, id)
+	}
+	b.mx.RUnlock()
+	var removed []string
+	for _, pass := range []bool{false, true} {
+		for _, id := range ids {
+			if dropped[id] != pass {
+				continue
+			}
+			keys, err := b.transactionKeys(id)
+			if err != nil {
+				return nil, err
+			}
+			for _, key := range keys {
+				lower := strings.ToLower(key)
+				if !pass {
+					used[lower] = true
+				} else if !used[lower] {
+					used[lower] = true
+					removed = append(removed, key)
+				}
+			}
+		}
+	}
+
+	last, _ := strconv.ParseUint(b.GetLatestID(), 10, 64)
+	plan.Transaction = fmt.Sprintf("%010d", last+1)
+	if err = writeFileAtomic(filepath.Join(b.StorePath, adminDir, lastidTxt), []byte(plan.Transaction+"\r\n")); err != nil {
+		return nil, err
+	}
+	if err = b.dropTransactions(plan.Transaction, dropped); err != nil {
+		log.Error(2, "[Branch] Prune builds of %s failed: %v.", b.Name(), err)
+		return nil, err
+	}
+
+	// server.txt is updated, swap the builds so no reader see a partial map
+	b.mx.Lock()
+	builds := make(map[string]*Build, len(b.builds))
+	for id, build := range b.builds {
+		if !dropped[id] {
+			builds[id] = build
+		}
+	}
+	b.builds = builds
+	b.BuildsCount -= len(plan.Pruned)
+	b.mx.Unlock()
+
+	b.sumMx.Lock()
+	for _, key := range removed {
+		ss := strings.Split(key, "\\")
+		b.removeSymbol(ss[0], ss[1])
+	}
+	b.sumMx.Unlock()
+	plan.Symbols = len(removed)
+
+	if err = b.markDeleted(deleted, "retention"); err != nil {
+		log.Warn("[Branch] Save status of pruned builds failed: %v.", err)
+	}
+	var purged []string
+	for id := range dropped {
+		purged = append(purged, id)
+	}
+	if err = b.purgeBinaries(purged); err != nil {
+		log.Warn("[Branch] Purge binaries of pruned builds failed: %v.", err)
+	}
+	if err = b.purgeBreakpad(purged); err != nil {
+		log.Warn("[Branch] Purge breakpad symbols of pruned builds failed: %v.", err)
+	}
+
+	for _, build := range plan.Pruned {
+		audit.Record(user, "prune", b.Name(), "build %s (%s) deleted by %s", build.Version, build.ID, plan.Transaction)
+	}
+	log.Info("[Branch] Prune %d builds of %s in transaction %s, %d symbols removed.",
+		len(plan.Pruned), b.Name(), plan.Transaction, plan.Symbols)
+	return plan, nil
+}
+
+// pruneBranches apply retention policies of local branches having one, return count of
+// builds pruned.
+func (ss *sserver) pruneBranches() int {
+	var arr []*BrBuilder
+	ss.WalkBuilders(func(bu Builder) error {
+		if b, ok := bu.(*BrBuilder); ok && b.Retention != nil && b.Sealed == nil && b.Archive == "" {
+			arr = append(arr, b)
+		}
+		return nil
+	})
+
+	total := 0
+	for _, b := range arr {
+		plan, err := b.Prune(retentionUser)
+		if err != nil {
+			log.Warn("[SS] Prune branch %s failed: %v.", b.Name(), err)
+			continue
+		}
+		total += len(plan.Pruned)
+	}
+	return total
+}
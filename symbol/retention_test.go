@@ -0,0 +1,104 @@
+package symbol
+
+import (
+	"context"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/adyzng/GoSymbols/config"
+)
+
+func TestPrune(t *testing.T) {
+	root, err := ioutil.TempDir("", "retention")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(root)
+	config.AuditFile = filepath.Join(root, "audit.log")
+
+	admin := filepath.Join(root, adminDir)
+	os.MkdirAll(admin, 0755)
+	trans := []struct {
+		id, version, comment string
+		keys                 []string
+	}{
+		{"0000000001", "101", "", []string{"a.pdb\\A1"}},
+		{"0000000002", "102", "", []string{"a.pdb\\A2", "foo.pdb\\F1"}},
+		{"0000000003", "103", "", []string{"a.pdb\\A3"}},
+		{"0000000004", "104", "", []string{"a.pdb\\A4", "foo.pdb\\F1"}},
+		{"0000000005", "105", "", []string{"a.pdb\\A5"}},
+		{"0000000006", "102", "supplement:0000000002", []string{"b.pdb\\B2"}},
+	}
+	server := ""
+	for _, tr := range trans {
+		data := ""
+		for _, key := range tr.keys {
+			ss := strings.Split(key, "\\")
+			data += "\"" + key + "\",\"S:\\000Unzip\\x64\\" + ss[0] + "\"\r\n"
+			fpath := filepath.Join(root, ss[0], ss[1], ss[0])
+			os.MkdirAll(filepath.Dir(fpath), 0755)
+			ioutil.WriteFile(fpath, []byte(key), 0644)
+		}
+		ioutil.WriteFile(filepath.Join(admin, tr.id), []byte(data), 0644)
+		server += tr.id + ",add,file,07/04/2017,14:44:14,\"test\",\"" + tr.version + "\",\"" + tr.comment + "\",\r\n"
+	}
+	ioutil.WriteFile(filepath.Join(admin, serverTxt), []byte(server), 0644)
+	ioutil.WriteFile(filepath.Join(admin, lastidTxt), []byte("0000000006"), 0644)
+	ioutil.WriteFile(filepath.Join(admin, releaseTxt), []byte("0000000001\r\n"), 0644)
+
+	b := NewBranch2(&Branch{StoreName: "test", StorePath: root, BuildPath: root}).(*BrBuilder)
+	if plan, err := b.Prune("tester"); err != nil || len(plan.Pruned) != 0 {
+		t.Fatalf("expect nothing pruned without policy, got %v (%v)", plan, err)
+	}
+
+	policy := &Retention{KeepLast: 2, KeepDays: 30}
+	ss := &sserver{builders: map[string]Builder{"test": b}}
+	pv, err := ss.PreviewModify(&Branch{StoreName: "test", StorePath: root, BuildPath: root, Retention: policy})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(pv.Changes) != 1 || pv.Changes[0].Field != "retention" || pv.Retention == nil ||
+		len(pv.Retention.Pruned) != 2 || b.Retention != nil {
+		t.Fatalf("expect retention change previewed without applying it, got %+v", pv)
+	}
+
+	b.Retention = policy
+	plan, err := b.PlanRetention()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(plan.Pruned) != 2 || plan.Pruned[0].ID != "0000000002" || plan.Protected["0000000001"] != "release" {
+		t.Fatalf("unexpected plan %+v", plan)
+	}
+
+	done, err := b.Prune("tester")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if done.Transaction != "0000000007" || b.GetLatestID() != "0000000007" || done.Symbols != 3 {
+		t.Fatalf("unexpected prune %+v", done)
+	}
+	for _, dir := range []string{"a.pdb/A2", "a.pdb/A3", "b.pdb"} {
+		if _, err := os.Stat(filepath.Join(root, filepath.FromSlash(dir))); !os.IsNotExist(err) {
+			t.Errorf("expect %s removed", dir)
+		}
+	}
+	if _, err := os.Stat(filepath.Join(root, "foo.pdb", "F1", "foo.pdb")); err != nil {
+		t.Errorf("symbol referenced by kept build should be kept")
+	}
+	history, _ := ioutil.ReadFile(filepath.Join(admin, historyTxt))
+	for _, id := range []string{"0000000002", "0000000003", "0000000006"} {
+		if !strings.Contains(string(history), "0000000007,del,"+id) {
+			t.Errorf("expect del of %s in history: %s", id, history)
+		}
+	}
+	if n, _ := b.ParseBuilds(context.Background(), nil); n != 3 || b.BuildsCount != 3 || b.getBuild("", "0000000006") != nil {
+		t.Errorf("expect 3 builds left, got %d (%d)", n, b.BuildsCount)
+	}
+	if lines, _ := b.transactionLines(serverTxt); len(lines) != 3 {
+		t.Errorf("expect 3 lines left in server.txt, got %v", lines)
+	}
+}
@@ -0,0 +1,343 @@
+package symbol
+
+import (
+	"bufio"
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"net"
+	"net/textproto"
+	"net/url"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"sort"
+	"strings"
+	"time"
+
+	"github.com/adyzng/GoSymbols/alert"
+	"github.com/adyzng/GoSymbols/config"
+	log "gopkg.in/clog.v1"
+)
+
+const (
+	quarantineStore = "000Quarantine" // detected files of ingested builds, {version}/{path} and {version}.json
+)
+
+var (
+	ErrScanFailed = fmt.Errorf("scanner failed, ingest aborted")
+)
+
+// Scanner scan one file before it enter the store, return the threat name if detected.
+//
+type Scanner interface {
+	Scan(fpath string) (threat string, err error)
+}
+
+// FileScanner is used by all branches to scan ingested files, tests replace it with a fake one.
+//
+var FileScanner Scanner = configScanner{}
+
+// configScanner scan by `[scan] MODE`
+type configScanner struct{}
+
+func (configScanner) Scan(fpath string) (string, error) {
+	timeout := time.Duration(config.ScanTimeout) * time.Second
+	switch config.ScanMode {
+	case "exec":
+		return execScan(config.ScanCommand, config.ScanDetected, fpath, timeout)
+	case "icap":
+		return icapScan(config.ScanICAP, fpath, timeout)
+	}
+	return "", nil
+}
+
+// splitCommand split command line by spaces, double quoted parts are kept together
+func splitCommand(cmdline string) []string {
+	var (
+		args   []string
+		cur    []rune
+		quoted bool
+		inArg  bool
+	)
+	for _, c := range cmdline {
+		switch {
+		case c == '"':
+			quoted, inArg = !quoted, true
+		case (c == ' ' || c == '\t') && !quoted:
+			if inArg {
+				args = append(args, string(cur))
+				cur, inArg = cur[:0], false
+			}
+		default:
+			cur, inArg = append(cur, c), true
+		}
+	}
+	if inArg {
+		args = append(args, string(cur))
+	}
+	return args
+}
+
+// execScan run scanner command on `fpath`, exit code 0 is clean, codes in `detected` mean
+// detected with the last output line as threat, others are errors.
+//
+func execScan(cmdline string, detected []int, fpath string, timeout time.Duration) (string, error) {
+	args := splitCommand(cmdline)
+	if len(args) == 0 {
+		return "", fmt.Errorf("scan command is not configured")
+	}
+	replaced := false
+	for i := range args {
+		if strings.Contains(args[i], "{file}") {
+			args[i] = strings.Replace(args[i], "{file}", fpath, -1)
+			replaced = true
+		}
+	}
+	if !replaced {
+		args = append(args, fpath)
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), timeout)
+	defer cancel()
+	out, err := exec.CommandContext(ctx, args[0], args[1:]...).CombinedOutput()
+	if err == nil {
+		return "", nil
+	}
+	if ctx.Err() != nil {
+		return "", fmt.Errorf("scan %s timeout", fpath)
+	}
+	exitErr, ok := err.(*exec.ExitError)
+	if !ok {
+		return "", err
+	}
+	code := -1
+	if status, ok := exitErr.Sys().(interface{ ExitStatus() int }); ok {
+		code = status.ExitStatus()
+	}
+	lines := strings.Split(strings.TrimSpace(string(out)), "\n")
+	last := strings.TrimSpace(lines[len(lines)-1])
+	for _, c := range detected {
+		if c == code {
+			if last == "" {
+				last = fmt.Sprintf("detected, exit code %d", code)
+			}
+			return last, nil
+		}
+	}
+	return "", fmt.Errorf("scanner exit code %d: %s", code, last)
+}
+
+// icapScan send `fpath` to icap service in a RESPMOD request, 204 is clean, 200 is detected
+// with threat taken from X-Infection-Found, X-Violations-Found or X-Virus-ID.
+//
+func icapScan(service, fpath string, timeout time.Duration) (string, error) {
+	u, err := url.Parse(service)
+	if err != nil || u.Scheme != "icap" || u.Host == "" {
+		return "", fmt.Errorf("invalid icap service %s", service)
+	}
+	host := u.Host
+	if u.Port() == "" {
+		host += ":1344"
+	}
+	fd, err := os.Open(fpath)
+	if err != nil {
+		return "", err
+	}
+	defer fd.Close()
+
+	conn, err := net.DialTimeout("tcp", host, timeout)
+	if err != nil {
+		return "", err
+	}
+	defer conn.Close()
+	conn.SetDeadline(time.Now().Add(timeout))
+
+	resHdr := "HTTP/1.1 200 OK\r\nContent-Type: application/octet-stream\r\n\r\n"
+	w := bufio.NewWriter(conn)
+	fmt.Fprintf(w, "RESPMOD %s ICAP/1.0\r\nHost: %s\r\nAllow: 204\r\nEncapsulated: res-hdr=0, res-body=%d\r\n\r\n%s",
+		service, u.Host, len(resHdr), resHdr)
+	buf := make([]byte, 64<<10)
+	for {
+		n, err := fd.Read(buf)
+		if n > 0 {
+			fmt.Fprintf(w, "%x\r\n", n)
+			w.Write(buf[:n])
+			w.WriteString("\r\n")
+		}
+		if err == io.EOF {
+			break
+		}
+		if err != nil {
+			return "", err
+		}
+	}
+	w.WriteString("0\r\n\r\n")
+	if err = w.Flush(); err != nil {
+		return "", err
+	}
+
+	tp := textproto.NewReader(bufio.NewReader(conn))
+	status, err := tp.ReadLine()
+	if err != nil {
+		return "", err
+	}
+	header, err := tp.ReadMIMEHeader()
+	if err != nil && err != io.EOF {
+		return "", err
+	}
+	ss := strings.SplitN(status, " ", 3)
+	if len(ss) < 2 || !strings.HasPrefix(ss[0], "ICAP/") {
+		return "", fmt.Errorf("invalid icap response %s", status)
+	}
+	switch ss[1] {
+	case "204":
+		return "", nil
+	case "200":
+		for _, key := range []string{"X-Infection-Found", "X-Violations-Found", "X-Virus-Id"} {
+			if v := header.Get(key); v != "" {
+				return icapThreat(v), nil
+			}
+		}
+		// content modified by the service, eg: replaced with a block page
+		return "modified by icap service", nil
+	}
+	return "", fmt.Errorf("icap service response %s", status)
+}
+
+// icapThreat take `Threat=` of `Type=0; Resolution=2; Threat=EICAR;`, or the whole value
+func icapThreat(v string) string {
+	for _, part := range strings.Split(v, ";") {
+		if kv := strings.SplitN(strings.TrimSpace(part), "=", 2); len(kv) == 2 && strings.EqualFold(kv[0], "Threat") {
+			return kv[1]
+		}
+	}
+	return strings.TrimSpace(v)
+}
+
+// QuarantinedFile is a file detected by the scanner at ingest, moved out of the build
+//
+type QuarantinedFile struct {
+	Branch  string `json:"branch"`
+	Version string `json:"version"`
+	Path    string `json:"path"` // relative path in debug zip
+	Size    int64  `json:"size"`
+	Threat  string `json:"threat"`
+	Scanner string `json:"scanner"`
+	Time    string `json:"time"`
+}
+
+// scanFiles scan every file under `symPath` to be ingested as build `version`. Detected
+// files are moved to 000Quarantine and alerted, so they never enter the store. Scanner
+// errors fail the ingest unless `[scan] FAIL_OPEN`.
+//
+func (b *BrBuilder) scanFiles(version, symPath string) error {
+	if config.ScanMode == "" {
+		return nil
+	}
+	var found []*QuarantinedFile
+	scanned := 0
+	err := filepath.Walk(symPath, func(fpath string, info os.FileInfo, err error) error {
+		if err != nil || info.IsDir() {
+			return err
+		}
+		scanned++
+		threat, err := FileScanner.Scan(fpath)
+		if err != nil {
+			if config.ScanFailOpen {
+				log.Warn("[Branch] Scan %s failed, ingest anyway: %v.", fpath, err)
+				return nil
+			}
+			log.Error(2, "[Branch] Scan %s failed: %v.", fpath, err)
+			return ErrScanFailed
+		}
+		if threat == "" {
+			return nil
+		}
+
+		rel, _ := filepath.Rel(symPath, fpath)
+		dst := filepath.Join(b.StorePath, quarantineStore, version, rel)
+		if err := os.MkdirAll(filepath.Dir(dst), 0755); err != nil {
+			return err
+		}
+		if err := os.Rename(fpath, dst); err != nil {
+			return err
+		}
+		q := &QuarantinedFile{
+			Branch:  b.Name(),
+			Version: version,
+			Path:    filepath.ToSlash(rel),
+			Size:    info.Size(),
+			Threat:  threat,
+			Scanner: config.ScanMode,
+			Time:    timestamp(now()),
+		}
+		found = append(found, q)
+		log.Warn("[Branch] Detect %s in %s of build %s, quarantined.", threat, q.Path, version)
+		alert.Raise(alert.KindMalwareDetected, b.Name(),
+			"build %s publish %s detected as %s, quarantined under %s.", version, q.Path, threat, quarantineStore)
+		return nil
+	})
+	log.Info("[Branch] Scan %d files of build %s, %d quarantined.", scanned, version, len(found))
+	if len(found) > 0 {
+		if e := b.recordQuarantine(version, found); e != nil {
+			log.Error(2, "[Branch] Record quarantine of %s failed: %v.", version, e)
+		}
+	}
+	return err
+}
+
+// recordQuarantine append detected files to 000Quarantine/{version}.json
+func (b *BrBuilder) recordQuarantine(version string, found []*QuarantinedFile) error {
+	fpath := filepath.Join(b.StorePath, quarantineStore, version+".json")
+	var all []*QuarantinedFile
+	if data, err := ioutil.ReadFile(fpath); err == nil {
+		json.Unmarshal(data, &all)
+	}
+	data, _ := json.MarshalIndent(append(all, found...), "", "\t")
+	return writeFileAtomic(fpath, data)
+}
+
+// Quarantined return files quarantined by the scanner, latest first.
+//
+func (b *BrBuilder) Quarantined() []*QuarantinedFile {
+	var all []*QuarantinedFile
+	files, _ := filepath.Glob(filepath.Join(b.StorePath, quarantineStore, "*.json"))
+	for _, fpath := range files {
+		data, err := ioutil.ReadFile(fpath)
+		if err != nil {
+			continue
+		}
+		var arr []*QuarantinedFile
+		if err = json.Unmarshal(data, &arr); err != nil {
+			log.Warn("[Branch] Invalid quarantine file %s: %v.", fpath, err)
+			continue
+		}
+		all = append(all, arr...)
+	}
+	sort.SliceStable(all, func(i, j int) bool {
+		return all[i].Time > all[j].Time
+	})
+	return all
+}
+
+// Quarantined return files quarantined of all branches (or the given branch), latest first.
+//
+func (ss *sserver) Quarantined(branch string) []*QuarantinedFile {
+	all := make([]*QuarantinedFile, 0)
+	ss.WalkBuilders(func(bu Builder) error {
+		if branch != "" && !strings.EqualFold(branch, bu.Name()) {
+			return nil
+		}
+		if b, ok := bu.(*BrBuilder); ok {
+			all = append(all, b.Quarantined()...)
+		}
+		return nil
+	})
+	sort.SliceStable(all, func(i, j int) bool {
+		return all[i].Time > all[j].Time
+	})
+	return all
+}
@@ -0,0 +1,131 @@
+package symbol
+
+import (
+	"bufio"
+	"errors"
+	"io/ioutil"
+	"net"
+	"net/textproto"
+	"os"
+	"path/filepath"
+	"reflect"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/adyzng/GoSymbols/config"
+)
+
+type fakeScanner map[string]string // file name => threat, `error` to fail
+
+func (f fakeScanner) Scan(fpath string) (string, error) {
+	threat := f[filepath.Base(fpath)]
+	if threat == "error" {
+		return "", errors.New("scanner down")
+	}
+	return threat, nil
+}
+
+func TestScanFiles(t *testing.T) {
+	root, err := ioutil.TempDir("", "scan")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(root)
+
+	symPath := filepath.Join(root, unzipDir)
+	os.MkdirAll(filepath.Join(symPath, "x64"), 0755)
+	ioutil.WriteFile(filepath.Join(symPath, "x64", "foo.dll"), []byte("bad"), 0644)
+	ioutil.WriteFile(filepath.Join(symPath, "x64", "foo.pdb"), []byte("good"), 0644)
+
+	mode, scanner := config.ScanMode, FileScanner
+	defer func() { config.ScanMode, FileScanner = mode, scanner }()
+	config.ScanMode = "exec"
+	FileScanner = fakeScanner{"foo.dll": "EICAR"}
+
+	b := NewBranch2(&Branch{StoreName: "test", StorePath: root, BuildPath: root}).(*BrBuilder)
+	if err := b.scanFiles("100", symPath); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := os.Stat(filepath.Join(symPath, "x64", "foo.dll")); !os.IsNotExist(err) {
+		t.Fatalf("expect detected file moved out of build")
+	}
+	if _, err := os.Stat(filepath.Join(root, quarantineStore, "100", "x64", "foo.dll")); err != nil {
+		t.Fatalf("expect detected file quarantined: %v", err)
+	}
+	qs := b.Quarantined()
+	if len(qs) != 1 || qs[0].Path != "x64/foo.dll" || qs[0].Threat != "EICAR" || qs[0].Version != "100" {
+		t.Fatalf("unexpected quarantined %+v", qs)
+	}
+
+	FileScanner = fakeScanner{"foo.pdb": "error"}
+	if err := b.scanFiles("101", symPath); err != ErrScanFailed {
+		t.Fatalf("expect scan failed, got %v", err)
+	}
+	config.ScanFailOpen = true
+	defer func() { config.ScanFailOpen = false }()
+	if err := b.scanFiles("101", symPath); err != nil {
+		t.Fatalf("expect fail open, got %v", err)
+	}
+}
+
+func TestSplitCommand(t *testing.T) {
+	args := splitCommand(`"C:\Program Files\clam\clamscan.exe" --no-summary  {file}`)
+	expect := []string{`C:\Program Files\clam\clamscan.exe`, "--no-summary", "{file}"}
+	if !reflect.DeepEqual(args, expect) {
+		t.Errorf("expect %q, got %q", expect, args)
+	}
+}
+
+func TestICAPScan(t *testing.T) {
+	ln, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer ln.Close()
+	go func() {
+		for {
+			conn, err := ln.Accept()
+			if err != nil {
+				return
+			}
+			tp := textproto.NewReader(bufio.NewReader(conn))
+			tp.ReadLine()
+			tp.ReadMIMEHeader() // icap header
+			tp.ReadLine()       // encapsulated http status
+			tp.ReadMIMEHeader() // encapsulated http header
+			var body []string
+			for {
+				size, _ := tp.ReadLine()
+				if size == "0" || size == "" {
+					break
+				}
+				line, _ := tp.ReadLine()
+				body = append(body, line)
+			}
+			if strings.Contains(strings.Join(body, ""), "EICAR") {
+				conn.Write([]byte("ICAP/1.0 200 OK\r\nX-Infection-Found: Type=0; Resolution=2; Threat=Eicar-Test;\r\nEncapsulated: null-body=0\r\n\r\n"))
+			} else {
+				conn.Write([]byte("ICAP/1.0 204 No Content\r\nEncapsulated: null-body=0\r\n\r\n"))
+			}
+			conn.Close()
+		}
+	}()
+
+	root, err := ioutil.TempDir("", "icap")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(root)
+	clean, bad := filepath.Join(root, "clean.pdb"), filepath.Join(root, "bad.dll")
+	ioutil.WriteFile(clean, []byte("just symbols"), 0644)
+	ioutil.WriteFile(bad, []byte("X5O!P%@AP EICAR"), 0644)
+
+	service := "icap://" + ln.Addr().String() + "/avscan"
+	if threat, err := icapScan(service, clean, time.Second*5); err != nil || threat != "" {
+		t.Errorf("expect clean, got %q %v", threat, err)
+	}
+	if threat, err := icapScan(service, bad, time.Second*5); err != nil || threat != "Eicar-Test" {
+		t.Errorf("expect Eicar-Test, got %q %v", threat, err)
+	}
+}
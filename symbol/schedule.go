@@ -0,0 +1,335 @@
+package symbol
+
+import (
+	"fmt"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/adyzng/GoSymbols/config"
+	log "gopkg.in/clog.v1"
+)
+
+const (
+	estimateBuilds = 5 // latest builds averaged to estimate ingest duration
+)
+
+// Schedule of a branch
+const (
+	ScheduleAuto   = "auto"   // polled every update cycle, the default
+	ScheduleManual = "manual" // only ingested when triggered
+)
+
+// CheckSchedule validate schedule of an branch.
+//
+func CheckSchedule(schedule string) error {
+	if schedule != "" && schedule != ScheduleAuto && schedule != ScheduleManual {
+		return fmt.Errorf("invalid schedule %s, expect auto or manual", schedule)
+	}
+	return nil
+}
+
+var weekdays = map[string]time.Weekday{
+	"sun": time.Sunday, "mon": time.Monday, "tue": time.Tuesday, "wed": time.Wednesday,
+	"thu": time.Thursday, "fri": time.Friday, "sat": time.Saturday,
+}
+
+// Blackout is a daily window, scheduled updates falling in it are deferred to its end
+//
+type Blackout struct {
+	Spec  string
+	Days  []time.Weekday // days the window start, empty for every day
+	Start int            // minutes from midnight
+	End   int            // minutes from midnight, not after Start if the window span midnight
+}
+
+// parseBlackout parse `{days} HH:MM-HH:MM`, days is `*` or weekdays separated by `|`, eg:
+// `Sat|Sun 00:00-24:00` or `* 23:00-02:00`. Days may be omitted for every day.
+func parseBlackout(spec string) (*Blackout, error) {
+	w := &Blackout{Spec: strings.TrimSpace(spec)}
+	fields := strings.Fields(w.Spec)
+	if len(fields) == 2 {
+		if fields[0] != "*" {
+			for _, d := range strings.Split(fields[0], "|") {
+				day, ok := weekdays[strings.ToLower(d)]
+				if !ok {
+					return nil, fmt.Errorf("invalid weekday %s in blackout %s", d, spec)
+				}
+				w.Days = append(w.Days, day)
+			}
+		}
+		fields = fields[1:]
+	}
+	if len(fields) != 1 {
+		return nil, fmt.Errorf("invalid blackout %s", spec)
+	}
+	var h1, m1, h2, m2 int
+	if n, _ := fmt.Sscanf(fields[0], "%d:%d-%d:%d", &h1, &m1, &h2, &m2); n != 4 ||
+		h1 < 0 || h1 > 23 || h2 < 0 || h2 > 24 || m1 < 0 || m1 > 59 || m2 < 0 || m2 > 59 || (h2 == 24 && m2 != 0) {
+		return nil, fmt.Errorf("invalid blackout time %s", spec)
+	}
+	w.Start, w.End = h1*60+m1, h2*60+m2
+	return w, nil
+}
+
+// blackouts parse `[schedule] BLACKOUT`, invalid windows are ignored.
+func blackouts() []*Blackout {
+	var arr []*Blackout
+	for _, spec := range config.ScheduleBlackouts {
+		if strings.TrimSpace(spec) == "" {
+			continue
+		}
+		w, err := parseBlackout(spec)
+		if err != nil {
+			log.Warn("[SS] %v.", err)
+			continue
+		}
+		arr = append(arr, w)
+	}
+	return arr
+}
+
+func (w *Blackout) onDay(day time.Weekday) bool {
+	if len(w.Days) == 0 {
+		return true
+	}
+	for _, d := range w.Days {
+		if d == day {
+			return true
+		}
+	}
+	return false
+}
+
+// contains check if `t` is in the window started today or yesterday, return end of the window.
+func (w *Blackout) contains(t time.Time) (time.Time, bool) {
+	for _, back := range []int{0, -1} {
+		day := time.Date(t.Year(), t.Month(), t.Day()+back, 0, 0, 0, 0, t.Location())
+		if !w.onDay(day.Weekday()) {
+			continue
+		}
+		start := day.Add(time.Duration(w.Start) * time.Minute)
+		end := day.Add(time.Duration(w.End) * time.Minute)
+		if w.End <= w.Start {
+			end = end.Add(time.Hour * 24)
+		}
+		if !t.Before(start) && t.Before(end) {
+			return end, true
+		}
+	}
+	return t, false
+}
+
+// applyBlackouts defer `t` to the end of windows containing it, return if it's deferred.
+func applyBlackouts(t time.Time, wins []*Blackout) (time.Time, bool) {
+	deferred := false
+	// windows may chain, bounded in case they cover the whole week
+	for i := 0; i < 7*len(wins); i++ {
+		moved := false
+		for _, w := range wins {
+			if end, ok := w.contains(t); ok {
+				t, moved, deferred = end, true, true
+			}
+		}
+		if !moved {
+			break
+		}
+	}
+	return t, deferred
+}
+
+// updateInterval return the scheduled update cycle of all branches, `[schedule] INTERVAL`
+func updateInterval() time.Duration {
+	if config.ScheduleInterval <= 0 {
+		return time.Hour * 2
+	}
+	return time.Minute * time.Duration(config.ScheduleInterval)
+}
+
+// nextUpdate return time of the next scheduled update cycle after the one at `last`.
+func nextUpdate(last time.Time) time.Time {
+	next, _ := applyBlackouts(last.Add(updateInterval()), blackouts())
+	return next
+}
+
+// ScheduledRun is one planned update of a branch
+//
+type ScheduledRun struct {
+	Time     string `json:"time"`
+	Deferred bool   `json:"deferred,omitempty"` // moved to the end of a blackout window
+}
+
+// BranchSchedule is the planned updates of one branch
+//
+type BranchSchedule struct {
+	Branch   string          `json:"branch"`
+	Runs     []*ScheduledRun `json:"runs,omitempty"`
+	Estimate int64           `json:"estimate"`          // ms, average ingest duration of latest builds
+	Skipped  string          `json:"skipped,omitempty"` // why the scheduler doesn't update the branch
+}
+
+// Schedule is the plan of upcoming update cycles
+//
+type Schedule struct {
+	Interval  string            `json:"interval"`
+	Blackouts []string          `json:"blackouts"`
+	Next      string            `json:"next"`
+	Branches  []*BranchSchedule `json:"branches"`
+}
+
+// Schedule return next `n` scheduled updates of all branches (or the given branch), with
+// blackout windows applied. An update only ingest the build if there is new one on build server,
+// the estimate is the load if it does.
+//
+func (ss *sserver) Schedule(branch string, n int) *Schedule {
+	if n <= 0 {
+		n = 10
+	}
+	wins := blackouts()
+	sc := &Schedule{
+		Interval:  updateInterval().String(),
+		Blackouts: make([]string, 0, len(wins)),
+	}
+	for _, w := range wins {
+		sc.Blackouts = append(sc.Blackouts, w.Spec)
+	}
+
+	ss.lck.RLock()
+	next := ss.next
+	ss.lck.RUnlock()
+	deferred := false
+	if next.IsZero() {
+		// scheduler not started, the first cycle run on start
+		next, deferred = applyBlackouts(now(), wins)
+	}
+	sc.Next = next.Format(TimeFormat)
+
+	runs := make([]*ScheduledRun, 0, n)
+	for len(runs) < n {
+		runs = append(runs, &ScheduledRun{Time: next.Format(TimeFormat), Deferred: deferred})
+		next, deferred = applyBlackouts(next.Add(updateInterval()), wins)
+	}
+
+	ss.WalkBuilders(func(bu Builder) error {
+		if branch != "" && !strings.EqualFold(branch, bu.Name()) {
+			return nil
+		}
+		bs := &BranchSchedule{Branch: bu.Name()}
+		if bu.GetBranch().Sealed != nil {
+			bs.Skipped = "sealed"
+		} else if bu.GetBranch().Schedule == ScheduleManual {
+			bs.Skipped = "manual"
+		} else {
+			bs.Runs = runs
+		}
+		if b, ok := bu.(*BrBuilder); ok {
+			bs.Estimate = b.estimateIngest()
+		}
+		sc.Branches = append(sc.Branches, bs)
+		return nil
+	})
+	sort.Slice(sc.Branches, func(i, j int) bool {
+		return sc.Branches[i].Branch < sc.Branches[j].Branch
+	})
+	return sc
+}
+
+// estimateIngest average total duration of the latest timed builds
+func (b *BrBuilder) estimateIngest() int64 {
+	timings := b.stageTimings()
+	var ids []string
+	for id := range timings {
+		ids = append(ids, id)
+	}
+	sort.Sort(sort.Reverse(sort.StringSlice(ids)))
+	if len(ids) > estimateBuilds {
+		ids = ids[:estimateBuilds]
+	}
+	if len(ids) == 0 {
+		return 0
+	}
+	var total int64
+	for _, id := range ids {
+		total += timings[id].Total
+	}
+	return total / int64(len(ids))
+}
+
+// hasNewBuild check if latestbuild.txt (or the feed) of build server has a build not in store.
+func (b *BrBuilder) hasNewBuild() (string, bool) {
+	latest, err := b.getLatestBuild(false)
+	if err != nil || latest == "" {
+		log.Trace("[SS] Read latest build of %s failed: %v.", b.Name(), err)
+		return "", false
+	}
+	if local, _ := b.getLatestBuild(true); latest == local {
+		return latest, false
+	}
+	return latest, b.getBuild(latest, "") == nil
+}
+
+// pollBranches check build share of all branches with at most config.SchedulePollers at a
+// time, so one slow share doesn't hold the cycle, and queue the ones having a new build.
+// Return count of branches queued.
+func (ss *sserver) pollBranches(done <-chan struct{}) int {
+	var arr []Builder
+	ss.WalkBuilders(func(bu Builder) error {
+		arr = append(arr, bu)
+		return nil
+	})
+
+	pollers := config.SchedulePollers
+	if pollers <= 0 {
+		pollers = 1
+	}
+	var (
+		wg     sync.WaitGroup
+		mx     sync.Mutex
+		queued int
+	)
+	sem := make(chan struct{}, pollers)
+LOOP:
+	for _, bu := range arr {
+		select {
+		case <-done:
+			break LOOP
+		case sem <- struct{}{}:
+		}
+
+		wg.Add(1)
+		go func(bu Builder) {
+			defer func() {
+				<-sem
+				wg.Done()
+			}()
+			if bu.GetBranch().Sealed != nil {
+				log.Trace("[SS] Skip sealed branch %s.", bu.Name())
+				return
+			}
+			if bu.GetBranch().Schedule == ScheduleManual {
+				log.Trace("[SS] Skip manual branch %s.", bu.Name())
+				return
+			}
+			if !ss.checkShare(bu) {
+				log.Trace("[SS] Can't update branch %s.", bu.Name())
+				return
+			}
+			if b, ok := bu.(*BrBuilder); ok {
+				latest, ok := b.hasNewBuild()
+				if !ok {
+					log.Trace("[SS] Branch %s already updated to %s.", bu.Name(), latest)
+					return
+				}
+				log.Trace("[SS] Trigger branch %s new build %s.", bu.Name(), latest)
+			}
+			if ss.queue.Push(bu, "", PriorityDefault) {
+				mx.Lock()
+				queued++
+				mx.Unlock()
+			}
+		}(bu)
+	}
+	wg.Wait()
+	return queued
+}
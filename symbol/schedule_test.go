@@ -0,0 +1,91 @@
+package symbol
+
+import (
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/adyzng/GoSymbols/config"
+)
+
+func TestApplyBlackouts(t *testing.T) {
+	var wins []*Blackout
+	for _, spec := range []string{"Sat|Sun 00:00-24:00", "* 23:00-02:00", "12:00-13:00"} {
+		w, err := parseBlackout(spec)
+		if err != nil {
+			t.Fatal(err)
+		}
+		wins = append(wins, w)
+	}
+	for _, spec := range []string{"Xyz 01:00-02:00", "* 25:00-26:00", "01:00", "* 01:00-24:30"} {
+		if _, err := parseBlackout(spec); err == nil {
+			t.Errorf("expect %s invalid", spec)
+		}
+	}
+
+	at := func(s string) time.Time {
+		tm, _ := time.ParseInLocation(TimeFormat, s, time.Local)
+		return tm
+	}
+	// 2026-10-16 is Friday
+	cases := []struct {
+		t, expect string
+		deferred  bool
+	}{
+		{"2026-10-16 10:00:00", "2026-10-16 10:00:00", false},
+		{"2026-10-16 12:30:00", "2026-10-16 13:00:00", true},
+		{"2026-10-15 23:30:00", "2026-10-16 02:00:00", true},
+		{"2026-10-16 01:00:00", "2026-10-16 02:00:00", true},
+		// Friday night window run into the weekend, then Sunday night window
+		{"2026-10-16 23:30:00", "2026-10-19 02:00:00", true},
+	}
+	for _, c := range cases {
+		got, deferred := applyBlackouts(at(c.t), wins)
+		if got.Format(TimeFormat) != c.expect || deferred != c.deferred {
+			t.Errorf("%s: expect %s (%v), got %s (%v)", c.t, c.expect, c.deferred, got.Format(TimeFormat), deferred)
+		}
+	}
+}
+
+func TestPollBranches(t *testing.T) {
+	root, err := ioutil.TempDir("", "poll")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(root)
+	defer func(latest string, pollers int) {
+		config.LatestBuildFile, config.SchedulePollers = latest, pollers
+	}(config.LatestBuildFile, config.SchedulePollers)
+	config.LatestBuildFile, config.SchedulePollers = "latestbuild.txt", 2
+
+	newBranch := func(name, server, local string) Builder {
+		share, store := filepath.Join(root, name, "share"), filepath.Join(root, name, "store")
+		os.MkdirAll(share, 0755)
+		os.MkdirAll(filepath.Join(store, adminDir), 0755)
+		if server != "" {
+			ioutil.WriteFile(filepath.Join(share, config.LatestBuildFile), []byte(server+"\r\n"), 0644)
+		}
+		ioutil.WriteFile(filepath.Join(store, adminDir, config.LatestBuildFile), []byte(local), 0644)
+		return NewBranch2(&Branch{StoreName: name, BuildPath: share, StorePath: store})
+	}
+	sealed := newBranch("sealed", "5", "4")
+	sealed.GetBranch().Sealed = &Seal{}
+	ss := &sserver{
+		builders: map[string]Builder{
+			"new":     newBranch("new", "101", "100"),
+			"updated": newBranch("updated", "100", "100"),
+			"down":    newBranch("down", "", "100"),
+			"sealed":  sealed,
+		},
+		queue:  newJobQueue(),
+		shares: &shareMonitor{health: make(map[string]*ShareHealth)},
+	}
+	if n := ss.pollBranches(nil); n != 1 {
+		t.Errorf("expect 1 branch queued, got %d", n)
+	}
+	if jobs := ss.queue.Jobs(); len(jobs) != 1 || jobs[0].builder.Name() != "new" {
+		t.Errorf("expect branch new queued, got %v", jobs)
+	}
+}
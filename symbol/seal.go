@@ -0,0 +1,146 @@
+package symbol
+
+import (
+	"encoding/json"
+	"fmt"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+
+	"github.com/adyzng/GoSymbols/audit"
+	log "gopkg.in/clog.v1"
+)
+
+const (
+	sealedTxt = "sealed.txt" // seal record in 000Admin, the branch is immutable while it exist
+)
+
+var (
+	ErrSealed    = fmt.Errorf("branch is sealed")
+	ErrNotSealed = fmt.Errorf("branch is not sealed")
+)
+
+// Seal is the record of an immutable branch, eg: symbols of a shipped product under legal hold.
+//
+type Seal struct {
+	Date     string `json:"date"`
+	User     string `json:"user"`
+	Reason   string `json:"reason,omitempty"`
+	ReadOnly bool   `json:"readOnly,omitempty"` // store files are set read-only on disk
+}
+
+// writable return ErrSealed if nothing can be added to or removed from the branch, or
+// ErrCutover while stores are being relocated, or ErrFenced on an standby instance
+func (b *BrBuilder) writable() error {
+	if b.Sealed != nil {
+		return ErrSealed
+	}
+	if inCutover() != nil {
+		return ErrCutover
+	}
+	if fenced() != "" {
+		return ErrFenced
+	}
+	return nil
+}
+
+// detectSeal load the seal record of store, the record in store win over the saved branch
+// config since the store may be copied or restored without it.
+func (b *BrBuilder) detectSeal() {
+	data, err := ioutil.ReadFile(b.branchFile(sealedTxt))
+	if err != nil {
+		if b.Sealed != nil {
+			log.Warn("[Branch] Seal record of %s missing in store, keep it sealed.", b.Name())
+		}
+		return
+	}
+	seal := &Seal{}
+	if err = json.Unmarshal(data, seal); err != nil {
+		log.Warn("[Branch] Invalid seal record of %s: %v.", b.Name(), err)
+		seal.Reason = "invalid seal record"
+	}
+	b.Sealed = seal
+}
+
+// Seal mark the branch immutable: ingest, purge, merge and other changes of store are
+// refused with ErrSealed until Unseal. With `readOnly` all files of store are also set
+// read-only on disk, so symstore.exe or manual deletion can't touch them either.
+//
+func (b *BrBuilder) Seal(user, reason string, readOnly bool) (*Seal, error) {
+	b.ingMx.Lock()
+	defer b.ingMx.Unlock()
+	if err := b.writable(); err != nil {
+		return b.Sealed, err
+	}
+	if readOnly && b.Shared {
+		// files on disk belong to other branches too
+		return nil, ErrSharedStore
+	}
+	defer beginWrite()()
+
+	seal := &Seal{
+		Date:     timestamp(now()),
+		User:     user,
+		Reason:   reason,
+		ReadOnly: readOnly,
+	}
+	data, _ := json.Marshal(seal)
+	if err := writeFileAtomic(b.branchFile(sealedTxt), data); err != nil {
+		log.Error(2, "[Branch] Write seal record of %s failed: %v.", b.Name(), err)
+		return nil, err
+	}
+	b.Sealed = seal
+	b.Persist()
+
+	if readOnly {
+		if err := setStoreMode(b.StorePath, false); err != nil {
+			log.Warn("[Branch] Set %s read-only failed: %v.", b.StorePath, err)
+		}
+	}
+	audit.Record(user, "seal", b.Name(), "sealed (read-only: %v): %s", readOnly, reason)
+	log.Info("[Branch] Branch %s sealed by %s.", b.Name(), user)
+	return seal, nil
+}
+
+// Unseal make the branch writable again, files set read-only by Seal are restored.
+//
+func (b *BrBuilder) Unseal(user string) error {
+	b.ingMx.Lock()
+	defer b.ingMx.Unlock()
+	seal := b.Sealed
+	if seal == nil {
+		return ErrNotSealed
+	}
+	defer beginWrite()()
+
+	if seal.ReadOnly {
+		if err := setStoreMode(b.StorePath, true); err != nil {
+			log.Error(2, "[Branch] Set %s writable failed: %v.", b.StorePath, err)
+			return err
+		}
+	}
+	fpath := b.branchFile(sealedTxt)
+	if err := os.Remove(fpath); err != nil && !os.IsNotExist(err) {
+		return err
+	}
+	b.Sealed = nil
+	b.Persist()
+
+	audit.Record(user, "unseal", b.Name(), "unsealed, sealed by %s at %s", seal.User, seal.Date)
+	log.Info("[Branch] Branch %s unsealed by %s.", b.Name(), user)
+	return nil
+}
+
+// setStoreMode remove (or restore) write permission of all files and folders under `root`
+func setStoreMode(root string, writable bool) error {
+	return filepath.Walk(root, func(fpath string, fi os.FileInfo, err error) error {
+		if err != nil {
+			return err
+		}
+		mode := fi.Mode().Perm() &^ 0222
+		if writable {
+			mode |= 0200
+		}
+		return os.Chmod(fpath, mode)
+	})
+}
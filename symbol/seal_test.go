@@ -0,0 +1,64 @@
+package symbol
+
+import (
+	"context"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/adyzng/GoSymbols/config"
+)
+
+func TestSealBranch(t *testing.T) {
+	root, err := ioutil.TempDir("", "seal")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(root)
+	defer func(app string) { config.AppPath = app }(config.AppPath)
+	config.AppPath = root
+
+	store := filepath.Join(root, "store")
+	os.MkdirAll(filepath.Join(store, adminDir), 0755)
+	os.MkdirAll(filepath.Join(store, "foo.pdb", "ABC1"), 0755)
+	ioutil.WriteFile(filepath.Join(store, "foo.pdb", "ABC1", "foo.pdb"), []byte("pdb"), 0644)
+	b := NewBranch2(&Branch{StoreName: "SealTest", StorePath: store, BuildPath: root}).(*BrBuilder)
+
+	if _, err = b.Seal("test", "legal hold", true); err != nil {
+		t.Fatal(err)
+	}
+	if _, err = b.Seal("test", "again", false); err != ErrSealed {
+		t.Fatalf("expect sealed twice refused, got %v", err)
+	}
+	if err = b.AddBuild(context.Background(), "100"); err != ErrSealed {
+		t.Fatalf("expect ingest refused, got %v", err)
+	}
+	if _, err = b.PlanPurge(PurgeOption{Patterns: []string{"*"}}); err != ErrSealed {
+		t.Fatalf("expect purge refused, got %v", err)
+	}
+	fi, _ := os.Stat(filepath.Join(store, "foo.pdb", "ABC1", "foo.pdb"))
+	if fi == nil || fi.Mode().Perm()&0222 != 0 {
+		t.Fatalf("expect symbol file read-only, got %v", fi)
+	}
+
+	// seal record in store survive lost branch config
+	nb := NewBranch2(&Branch{StoreName: "SealTest", StorePath: store, BuildPath: root}).(*BrBuilder)
+	if nb.Sealed == nil || nb.Sealed.Reason != "legal hold" || !nb.Sealed.ReadOnly {
+		t.Fatalf("expect seal detected from store, got %+v", nb.Sealed)
+	}
+
+	if err = nb.Unseal("test"); err != nil {
+		t.Fatal(err)
+	}
+	if err = nb.Unseal("test"); err != ErrNotSealed {
+		t.Fatalf("expect unseal twice refused, got %v", err)
+	}
+	fi, _ = os.Stat(filepath.Join(store, "foo.pdb", "ABC1", "foo.pdb"))
+	if fi == nil || fi.Mode().Perm()&0200 == 0 {
+		t.Fatalf("expect symbol file writable, got %v", fi)
+	}
+	if nb = NewBranch2(&Branch{StoreName: "SealTest", StorePath: store}).(*BrBuilder); nb.Sealed != nil {
+		t.Fatal("expect seal record removed")
+	}
+}
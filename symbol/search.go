@@ -0,0 +1,216 @@
+package symbol
+
+import (
+	"context"
+	"fmt"
+	"path"
+	"sort"
+	"strings"
+
+	log "gopkg.in/clog.v1"
+)
+
+const (
+	searchLimit    = 100  // symbols returned by default
+	searchMaxLimit = 1000 // symbols returned at most
+)
+
+var (
+	ErrSearchQuery = fmt.Errorf("search need name or hash")
+)
+
+// SymbolQuery search symbols across branches. Name and Version are case insensitive
+// patterns, `*` matches any, eg: `vddk*.pdb`.
+//
+type SymbolQuery struct {
+	Name    string `json:"name"`
+	Hash    string `json:"hash"`
+	Arch    string `json:"arch"`    // x64 or x86
+	Version string `json:"version"` // build version
+	Branch  string `json:"branch"`
+	Limit   int    `json:"limit"` // default 100, at most 1000
+
+	Allow func(branch string) bool `json:"-"` // branches the caller may see, nil for all
+}
+
+// SymbolResult is the symbols matched by SymbolQuery, the newest build first
+//
+type SymbolResult struct {
+	Total   int       `json:"total"` // all matched, more than Symbols if limited
+	Symbols []*Symbol `json:"symbols"`
+}
+
+// match check symbol against the filters of query
+func (q *SymbolQuery) match(sym *Symbol) bool {
+	if q.Hash != "" && !strings.EqualFold(q.Hash, sym.Hash) {
+		return false
+	}
+	if q.Arch != "" && !strings.EqualFold(q.Arch, sym.Arch) {
+		return false
+	}
+	return globMatch(q.Name, sym.Name) && globMatch(q.Version, sym.Version)
+}
+
+// globMatch match `s` by case insensitive `pattern`, empty pattern match all
+func globMatch(pattern, s string) bool {
+	if pattern == "" {
+		return true
+	}
+	ok, err := path.Match(strings.ToLower(pattern), strings.ToLower(s))
+	return err == nil && ok
+}
+
+// candidate is a transaction which may hold symbols of the query
+type candidate struct {
+	branch string // lower case as in the index
+	id     string
+}
+
+// searchIndex return transactions holding the name or hash of query from the metadata
+// database. Name pattern with a literal prefix seek to it, otherwise all names are scanned.
+func searchIndex(ctx context.Context, q *SymbolQuery) ([]candidate, error) {
+	db := openMeta()
+	if db == nil {
+		return nil, ErrMetaDisabled
+	}
+	var refs []*metaRef
+	var err error
+	if q.Hash != "" {
+		refs, err = db.findHash(ctx, q.Hash)
+	} else {
+		refs, err = db.findNames(ctx, literalPrefix(q.Name))
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	seen := make(map[candidate]bool)
+	var cands []candidate
+	for _, ref := range refs {
+		c := candidate{branch: ref.branch, id: ref.id}
+		if !globMatch(q.Name, ref.name) || (q.Branch != "" && !strings.EqualFold(q.Branch, c.branch)) || seen[c] {
+			continue
+		}
+		seen[c] = true
+		cands = append(cands, c)
+	}
+	return cands, nil
+}
+
+// literalPrefix return lower case `pattern` up to its first wildcard
+func literalPrefix(pattern string) string {
+	pattern = strings.ToLower(pattern)
+	if idx := strings.IndexAny(pattern, "*?[\\"); idx != -1 {
+		pattern = pattern[:idx]
+	}
+	return pattern
+}
+
+// SearchSymbols find symbols by name, hash, arch and version across all branches. The
+// transactions holding them are found by the index of the metadata database, or its replica
+// for `ctx` of WithReplica, so only those are read. Without the database every build of
+// every branch is read.
+//
+func (ss *sserver) SearchSymbols(ctx context.Context, q *SymbolQuery) (*SymbolResult, error) {
+	if q.Name == "" && q.Hash == "" {
+		return nil, ErrSearchQuery
+	}
+	if _, err := path.Match(q.Name, ""); err != nil {
+		return nil, fmt.Errorf("invalid name pattern %s: %v", q.Name, err)
+	}
+	if _, err := path.Match(q.Version, ""); err != nil {
+		return nil, fmt.Errorf("invalid version pattern %s: %v", q.Version, err)
+	}
+	limit := q.Limit
+	if limit <= 0 {
+		limit = searchLimit
+	} else if limit > searchMaxLimit {
+		limit = searchMaxLimit
+	}
+
+	var cands []candidate
+	if openMeta() != nil {
+		var err error
+		if cands, err = searchIndex(ctx, q); err != nil {
+			return nil, err
+		}
+	} else {
+		ss.WalkBuilders(func(bu Builder) error {
+			if q.Branch != "" && !strings.EqualFold(q.Branch, bu.Name()) {
+				return nil
+			}
+			bu.ParseBuilds(ctx, func(build *Build) error {
+				cands = append(cands, candidate{branch: strings.ToLower(bu.Name()), id: build.ID})
+				return nil
+			})
+			return nil
+		})
+	}
+
+	var syms []*Symbol
+	dates := make(map[*Symbol]string)
+	for _, c := range cands {
+		b, ok := ss.Get(c.branch).(*BrBuilder)
+		if !ok || (q.Allow != nil && !q.Allow(b.Name())) {
+			continue
+		}
+		build := b.getBuild("", c.id)
+		if build == nil || !globMatch(q.Version, build.Version) {
+			continue
+		}
+		if _, err := b.parseTransaction(build, func(sym *Symbol) error {
+			if q.match(sym) {
+				syms = append(syms, sym)
+				dates[sym] = build.Date
+			}
+			return nil
+		}); err != nil {
+			log.Warn("[SS] Search transaction %s of %s failed: %v.", c.id, b.Name(), err)
+		}
+	}
+
+	sort.Slice(syms, func(i, j int) bool {
+		if di, dj := dates[syms[i]], dates[syms[j]]; di != dj {
+			return di > dj
+		}
+		if syms[i].Store != syms[j].Store {
+			return syms[i].Store < syms[j].Store
+		}
+		return syms[i].Name < syms[j].Name
+	})
+	res := &SymbolResult{Total: len(syms), Symbols: syms}
+	if len(syms) > limit {
+		res.Symbols = syms[:limit]
+	}
+	return res, nil
+}
+
+// SymbolNames return distinct symbol names (lower case) in the metadata database, or its
+// replica for `ctx` of WithReplica, matching case insensitive `pattern`, of `branch` if not
+// empty. ErrMetaDisabled without the database.
+//
+func (ss *sserver) SymbolNames(ctx context.Context, branch, pattern string) ([]string, error) {
+	if _, err := path.Match(pattern, ""); err != nil {
+		return nil, fmt.Errorf("invalid name pattern %s: %v", pattern, err)
+	}
+	db := openMeta()
+	if db == nil {
+		return nil, ErrMetaDisabled
+	}
+	refs, err := db.findNames(ctx, literalPrefix(pattern))
+	if err != nil {
+		return nil, err
+	}
+	var names []string
+	last := ""
+	for _, ref := range refs {
+		if ref.name == last || !globMatch(pattern, ref.name) {
+			continue
+		}
+		if branch == "" || strings.EqualFold(branch, ref.branch) {
+			last = ref.name
+			names = append(names, ref.name)
+		}
+	}
+	return names, nil
+}
@@ -0,0 +1,105 @@
+package symbol
+
+import (
+	"context"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"sync"
+	"testing"
+
+	"github.com/adyzng/GoSymbols/config"
+)
+
+func TestSearchSymbols(t *testing.T) {
+	root, err := ioutil.TempDir("", "search")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(root)
+	defer func() {
+		if metaStore != nil {
+			metaStore.close()
+		}
+		config.MetadataDB = ""
+		metaOnce, metaStore = sync.Once{}, nil
+	}()
+
+	store := func(name string, trans map[string]string, server string) *BrBuilder {
+		admin := filepath.Join(root, name, adminDir)
+		os.MkdirAll(admin, 0755)
+		for id, data := range trans {
+			ioutil.WriteFile(filepath.Join(admin, id), []byte(data), 0644)
+		}
+		ioutil.WriteFile(filepath.Join(admin, serverTxt), []byte(server), 0644)
+		return NewBranch2(&Branch{StoreName: name, StorePath: filepath.Join(root, name)}).(*BrBuilder)
+	}
+
+	for _, dbPath := range []string{filepath.Join(root, "gosymbols.db"), ""} {
+		config.MetadataDB = dbPath
+		metaOnce, metaStore = sync.Once{}, nil
+		udp := store("UDP", map[string]string{
+			"0000000001": "\"vddk.pdb\\A1\",\"S:\\000Unzip\\x64\\vddk.pdb\"\r\n\"foo.pdb\\F1\",\"S:\\000Unzip\\x64\\foo.pdb\"\r\n",
+			"0000000002": "\"vddk.pdb\\A2\",\"S:\\000Unzip\\x86\\vddk.pdb\"\r\n",
+		}, "0000000001,add,file,07/04/2017,14:44:14,\"UDP\",\"4175.2-538\",\"\",\r\n"+
+			"0000000002,add,file,07/05/2017,14:44:14,\"UDP\",\"4175.2-539\",\"\",\r\n")
+		ucp := store("UCP", map[string]string{
+			"0000000001": "\"vddkwrapper.pdb\\A1\",\"S:\\000Unzip\\x64\\vddkwrapper.pdb\"\r\n",
+		}, "0000000001,add,file,07/06/2017,14:44:14,\"UCP\",\"100\",\"\",\r\n")
+		ss := &sserver{builders: map[string]Builder{"udp": udp, "ucp": ucp}}
+		udp.ParseBuilds(context.Background(), nil)
+		ucp.ParseBuilds(context.Background(), nil)
+
+		for _, tc := range []struct {
+			q    SymbolQuery
+			want []string // store/name/hash, newest first
+		}{
+			{SymbolQuery{Name: "VDDK.pdb"}, []string{"UDP/vddk.pdb/A2", "UDP/vddk.pdb/A1"}},
+			{SymbolQuery{Name: "vddk*"}, []string{"UCP/vddkwrapper.pdb/A1", "UDP/vddk.pdb/A2", "UDP/vddk.pdb/A1"}},
+			{SymbolQuery{Hash: "a1"}, []string{"UCP/vddkwrapper.pdb/A1", "UDP/vddk.pdb/A1"}},
+			{SymbolQuery{Hash: "A1", Branch: "udp"}, []string{"UDP/vddk.pdb/A1"}},
+			{SymbolQuery{Name: "*.pdb", Arch: ArchX86}, []string{"UDP/vddk.pdb/A2"}},
+			{SymbolQuery{Name: "*", Version: "4175.2-*", Limit: 1}, []string{"UDP/vddk.pdb/A2"}},
+			{SymbolQuery{Name: "bar.pdb"}, nil},
+		} {
+			res, err := ss.SearchSymbols(context.Background(), &tc.q)
+			if err != nil {
+				t.Fatalf("search %+v failed: %v", tc.q, err)
+			}
+			var got []string
+			for _, sym := range res.Symbols {
+				got = append(got, sym.Store+"/"+sym.Name+"/"+sym.Hash)
+			}
+			if len(got) != len(tc.want) {
+				t.Errorf("db %q, search %+v: expect %v, got %v", dbPath, tc.q, tc.want, got)
+				continue
+			}
+			for i := range got {
+				if got[i] != tc.want[i] {
+					t.Errorf("db %q, search %+v: expect %v, got %v", dbPath, tc.q, tc.want, got)
+					break
+				}
+			}
+		}
+		if res, _ := ss.SearchSymbols(context.Background(), &SymbolQuery{Name: "*", Limit: 1}); res.Total != 4 {
+			t.Errorf("expect total of all matched, got %d", res.Total)
+		}
+		if _, err = ss.SearchSymbols(context.Background(), &SymbolQuery{Arch: ArchX64}); err != ErrSearchQuery {
+			t.Errorf("expect name or hash required, got %v", err)
+		}
+
+		names, err := ss.SymbolNames(context.Background(), "", "VDDK*")
+		if dbPath == "" {
+			if err != ErrMetaDisabled {
+				t.Errorf("expect names need database, got %v", err)
+			}
+			continue
+		}
+		if err != nil || len(names) != 2 || names[0] != "vddk.pdb" || names[1] != "vddkwrapper.pdb" {
+			t.Errorf("expect names of vddk in all branches, got %v %v", names, err)
+		}
+		if names, _ = ss.SymbolNames(context.Background(), "UDP", "*"); len(names) != 2 || names[0] != "foo.pdb" {
+			t.Errorf("expect names of UDP, got %v", names)
+		}
+	}
+}
@@ -1,7 +1,9 @@
 package symbol
 
 import (
+	"bytes"
 	"encoding/json"
+	"fmt"
 	"io/ioutil"
 	"os"
 	"path/filepath"
@@ -10,6 +12,7 @@ import (
 	"time"
 
 	"github.com/adyzng/GoSymbols/config"
+	"github.com/adyzng/GoSymbols/sourceindex"
 	log "gopkg.in/clog.v1"
 )
 
@@ -25,8 +28,15 @@ const (
 // sserver ...
 //
 type sserver struct {
-	lck      sync.RWMutex
-	builders map[string]Builder
+	lck        sync.RWMutex
+	builders   map[string]Builder
+	queue      *jobQueue
+	backfills  map[string]*backfillTask
+	recompress map[string]*recompressTask
+	links      *linkStore
+	warm       *warmup
+	shares     *shareMonitor
+	next       time.Time // next scheduled update cycle
 }
 
 // GetServer return single instance of sserver
@@ -34,7 +44,16 @@ type sserver struct {
 func GetServer() *sserver {
 	once.Do(func() {
 		symSvr = &sserver{
-			builders: make(map[string]Builder, 1),
+			builders:   make(map[string]Builder, 1),
+			queue:      newJobQueue(),
+			backfills:  make(map[string]*backfillTask),
+			recompress: make(map[string]*recompressTask),
+			links:      &linkStore{},
+			warm:       newWarmup(),
+			shares:     &shareMonitor{health: make(map[string]*ShareHealth)},
+		}
+		if memoryMode() {
+			return
 		}
 		if st, err := os.Stat(config.Destination); err != nil || st == nil {
 			log.Error(2, "[SS] Access destination %s error: %s.", config.Destination, err)
@@ -59,6 +78,13 @@ func (ss *sserver) ScanStore(path string) error {
 			if !f.IsDir() {
 				continue
 			}
+			if config.SharedStore != "" && strings.EqualFold(f.Name(), config.SharedStore) {
+				for _, b := range sharedBranches(filepath.Join(path, f.Name())) {
+					ss.builders[strings.ToLower(b.Name())] = b
+					log.Info("[SS] Load branch %s in shared store.", b.Name())
+				}
+				continue
+			}
 			b := NewBranch(f.Name(), f.Name())
 			if b.CanBrowse() || b.CanUpdate() {
 				ss.builders[strings.ToLower(f.Name())] = b
@@ -76,19 +102,76 @@ func (ss *sserver) Modify(branch *Branch) Builder {
 
 	lower := strings.ToLower(branch.StoreName)
 	if b, ok := ss.builders[lower]; ok {
+		if err := ss.checkBranch(branch); err != nil {
+			log.Warn("[SS] Branch %s: %v.", branch.StoreName, err)
+			return nil
+		}
 		nb := NewBranch2(branch)
 		if nb.CanUpdate() || nb.CanBrowse() {
-			b1, b2 := b.GetBranch(), nb.GetBranch()
-			b1.BuildName = b2.BuildName
-			b1.StoreName = b2.StoreName
-			b1.BuildPath = b2.BuildPath
-			b1.StorePath = b2.StorePath
+			applyBranch(b.GetBranch(), nb.GetBranch())
 			return b
 		}
 	}
 	return nil
 }
 
+// applyBranch copy settings of `b2` modified by user to `b1`
+func applyBranch(b1, b2 *Branch) {
+	b1.BuildName = b2.BuildName
+	b1.StoreName = b2.StoreName
+	b1.BuildPath = b2.BuildPath
+	b1.StorePath = b2.StorePath
+	b1.Priority = b2.Priority
+	b1.ConflictPolicy = b2.ConflictPolicy
+	b1.Layout = b2.Layout
+	b1.Renames = b2.Renames
+	b1.Encrypted = b2.Encrypted
+	b1.Shared = b2.Shared
+	b1.Feed = b2.Feed
+	b1.Package = b2.Package
+	b1.VirtualDir = b2.VirtualDir
+	b1.VersionFormat = b2.VersionFormat
+	b1.Channels = b2.Channels
+	b1.Backend = b2.Backend
+	b1.Retention = b2.Retention
+	b1.Detector = b2.Detector
+	b1.SLO = b2.SLO
+	b1.Schedule = b2.Schedule
+	b1.SourceIndex = b2.SourceIndex
+}
+
+// checkBranch validate settings of branch `b`, caller hold `lck`
+func (ss *sserver) checkBranch(b *Branch) error {
+	if err := ss.checkVirtualDir(b); err != nil {
+		return fmt.Errorf("virtual directory %s: %v", b.VirtualDir, err)
+	}
+	if err := CheckVersionFormat(b.VersionFormat); err != nil {
+		return fmt.Errorf("version format %s: %v", b.VersionFormat, err)
+	}
+	if err := CheckChannels(b.Channels); err != nil {
+		return fmt.Errorf("channels: %v", err)
+	}
+	if err := CheckRetention(b.Retention); err != nil {
+		return fmt.Errorf("retention: %v", err)
+	}
+	if b.SLO < 0 {
+		return fmt.Errorf("negative slo %d minutes", b.SLO)
+	}
+	if err := CheckSchedule(b.Schedule); err != nil {
+		return err
+	}
+	if err := sourceindex.Check(b.SourceIndex); err != nil {
+		return fmt.Errorf("source index: %v", err)
+	}
+	if err := CheckDetector(b.Detector); err != nil {
+		return fmt.Errorf("detector %s: %v", b.Detector, err)
+	}
+	if err := CheckBackend(b.Backend); err != nil {
+		return fmt.Errorf("backend %s: %v", b.Backend, err)
+	}
+	return nil
+}
+
 // Get reture given branch,  if not exist return nil
 func (ss *sserver) Get(storeName string) Builder {
 	ss.lck.RLock()
@@ -110,6 +193,11 @@ func (ss *sserver) Add(b *Branch) Builder {
 	}
 
 	// new one
+	if err := ss.checkBranch(b); err != nil {
+		log.Warn("[SS] Branch %s: %v.", b.StoreName, err)
+		return nil
+	}
+	sharedDefaults(b)
 	br := NewBranch2(b)
 	if br.CanBrowse() || br.CanUpdate() {
 		ss.builders[strings.ToLower(b.StoreName)] = br
@@ -149,14 +237,59 @@ func (ss *sserver) WalkBuilders(handler func(branch Builder) error) error {
 	return err
 }
 
+// Trigger enqueue an ingest job for given branch. Empty `version` means the latest build,
+// `PriorityDefault` means the branch default priority.
+//
+func (ss *sserver) Trigger(storeName, version string, prio Priority) error {
+	_, err := ss.Enqueue(storeName, version, prio)
+	return err
+}
+
+// Enqueue add an ingest job like Trigger, and return the job to follow its progress. The
+// job already queued for the same build is returned if any.
+//
+func (ss *sserver) Enqueue(storeName, version string, prio Priority) (*Job, error) {
+	b := ss.Get(storeName)
+	if b == nil {
+		return nil, ErrBranchNotInit
+	}
+	job := ss.queue.push(b, version, prio)
+	if job == nil {
+		return nil, ErrQueueClosed
+	}
+	log.Info("[SS] Trigger branch %s build %s (%s), job %s.", b.Name(), version, prio, job.ID)
+	return job, nil
+}
+
+// Jobs return ingest jobs of all branches (or the given branch) filtered by `status` if
+// not empty, unfinished first and then the newest. Jobs are kept in memory, the latest
+// finished ones only.
+//
+func (ss *sserver) Jobs(branch string, status JobStatus) []*Job {
+	return ss.queue.List(branch, status)
+}
+
+// GetJob return ingest job `id`, nil if not exist.
+//
+func (ss *sserver) GetJob(id string) *Job {
+	return ss.queue.Job(id)
+}
+
+// CancelJob cancel ingest job `id`, see jobQueue.Cancel.
+//
+func (ss *sserver) CancelJob(id string) (*Job, error) {
+	return ss.queue.Cancel(id)
+}
+
 // LoadBranchs scan local symbol store for exist branchs.
 func (ss *sserver) LoadBranchs() error {
-	fpath := filepath.Join(config.AppPath, symConfig)
-	fd, err := os.OpenFile(fpath, os.O_RDONLY, 666)
+	meta := metadata(config.AppPath)
+	fd, err := meta.Get(symConfig)
 	if err != nil {
-		log.Error(2, "[SS] Read symbols config file %s failed: %v.", fpath, err)
+		log.Error(2, "[SS] Read symbols config file %s of %s failed: %v.", symConfig, meta, err)
 		return err
 	}
+	defer fd.Close()
 
 	var arr []*Branch
 	if err := json.NewDecoder(fd).Decode(&arr); err != nil {
@@ -167,6 +300,16 @@ func (ss *sserver) LoadBranchs() error {
 	defer ss.lck.Unlock()
 
 	for _, b := range arr {
+		if b.Archive != "" {
+			a, err := openArchive(b)
+			if err != nil {
+				log.Error(2, "[SS] Mount archive %s failed: %v.", b.Archive, err)
+				continue
+			}
+			ss.builders[strings.ToLower(b.StoreName)] = a
+			log.Info("[SS] Mount archive branch %s", b.StoreName)
+			continue
+		}
 		ss.builders[strings.ToLower(b.StoreName)] = NewBranch2(b)
 		log.Info("[SS] Load branch %s", b.StoreName)
 	}
@@ -179,86 +322,74 @@ func (ss *sserver) SaveBranchs(path string) error {
 		path = config.AppPath
 	}
 
-	fpath := filepath.Join(path, symConfig)
-	fd, err := os.OpenFile(fpath, os.O_WRONLY|os.O_CREATE|os.O_TRUNC, 666)
-	if err != nil {
-		log.Error(2, "[SS] Open file %s failed: %v.", fpath, err)
-		return err
-	}
-
 	ss.lck.Lock()
-	defer func() {
-		fd.Close()
-		ss.lck.Unlock()
-	}()
+	defer ss.lck.Unlock()
 
 	arr := make([]*Branch, 0, len(ss.builders))
 	for _, b := range ss.builders {
 		arr = append(arr, b.GetBranch())
 	}
 
-	enc := json.NewEncoder(fd)
+	var buf bytes.Buffer
+	enc := json.NewEncoder(&buf)
 	enc.SetIndent("", "\t")
-	return enc.Encode(arr)
+	if err := enc.Encode(arr); err != nil {
+		return err
+	}
+	meta := metadata(path)
+	if err := meta.Put(symConfig, &buf, int64(buf.Len())); err != nil {
+		log.Error(2, "[SS] Save file %s to %s failed: %v.", symConfig, meta, err)
+		return err
+	}
+	return nil
 }
 
 // Run ...
 func (ss *sserver) Run(done <-chan struct{}) {
-	var wg sync.WaitGroup
 	log.Info("[SS] Symbol server start ...")
 
-	ticker := time.NewTicker(time.Hour * 2)
-	defer ticker.Stop()
-
 	if err := ss.LoadBranchs(); err != nil {
 		log.Error(2, "[SS] Load branchs failed: %v.", err)
 		return
 	}
 
-	ss.WalkBuilders(func(bu Builder) error {
-		wg.Add(1)
-		log.Info("[SS] Parse branch %s.", bu.Name())
-		go func() {
-			defer wg.Done()
-			bu.ParseBuilds(nil)
-		}()
-		return nil
-	})
-	wg.Wait()
+	ss.warmUp(done)
+	ss.queue.Start(config.IngestWorkers)
 
+	// the first cycle run on start, unless in blackout window
+	next, _ := applyBlackouts(now(), blackouts())
 LOOP:
 	for {
-		ss.WalkBuilders(func(bu Builder) error {
-			if bu.CanUpdate() {
-				go func() {
-					wg.Add(1)
-					defer wg.Done()
-					log.Trace("[SS] Trigger branch %s.", bu.Name())
-					bu.AddBuild("")
-				}()
-			} else {
-				log.Trace("[SS] Can't update branch %s.", bu.Name())
+		ss.lck.Lock()
+		ss.next = next
+		ss.lck.Unlock()
+		if wait := next.Sub(now()); wait > 0 {
+			log.Info("[SS] Next update at %s.", next.Format(TimeFormat))
+			select {
+			case <-done:
+				log.Warn("[SS] Receive stop signal.")
+				break LOOP
+			case <-time.After(wait):
 			}
-			return nil
-		})
+		}
 
-		if err := ss.SaveBranchs(""); err != nil {
-			log.Error(2, "[SS] Save branchs list failed: %v.", err)
+		if n := ss.pollBranches(done); n > 0 {
+			log.Info("[SS] Queue %d branches with new builds.", n)
+		}
+		if n := ss.pruneBranches(); n > 0 {
+			log.Info("[SS] Prune %d builds by retention.", n)
 		}
 
-		select {
-		case <-done:
-			log.Warn("[SS] Receive stop signal.")
-			break LOOP
-		case <-ticker.C:
-			wg.Wait()
-			break
+		if err := ss.SaveBranchs(""); err != nil {
+			log.Error(2, "[SS] Save branchs list failed: %v.", err)
 		}
+		next = nextUpdate(now())
 	}
+	ss.queue.Stop()
+
 	if err := ss.SaveBranchs(""); err != nil {
 		log.Error(2, "[SS] Save branchs list failed: %v.", err)
 	}
 
-	wg.Wait()
 	log.Info("[SS] Symbol server stop.")
 }
@@ -22,7 +22,7 @@ func TestLoadBranch(t *testing.T) {
 
 func TestAddBranch(t *testing.T) {
 	bn, sn := "UDP_6_5_U2", "UDPv6.5U2"
-	builder := GetServer().Add(bn, sn)
+	builder := GetServer().Add(&Branch{BuildName: bn, StoreName: sn})
 
 	if builder != nil {
 		fmt.Printf("Add branch: %+v.\n", builder)
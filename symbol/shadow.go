@@ -0,0 +1,233 @@
+package symbol
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+
+	"github.com/adyzng/GoSymbols/alert"
+	"github.com/adyzng/GoSymbols/config"
+	log "gopkg.in/clog.v1"
+)
+
+const (
+	shadowJSON = "shadow.json" // shadow ingest reports in 000Admin, version => ShadowReport
+)
+
+// ShadowTool is the symstore.exe run by shadow ingests against the native writer. Tests
+// replace it with a fake one.
+//
+var ShadowTool SymStorer = execSymStore{}
+
+// ShadowReport compare the stores written by symstore.exe and the native writer from the
+// same build. Keys are `name\hash` of the transaction, files are paths relative to store.
+//
+type ShadowReport struct {
+	Branch  string   `json:"branch"`
+	Version string   `json:"version"`
+	Date    string   `json:"date"`
+	Keys    int      `json:"keys"`              // keys added by symstore.exe
+	Files   int      `json:"files"`             // files stored by symstore.exe
+	Missing []string `json:"missing,omitempty"` // keys and files of symstore.exe the native writer didn't add
+	Extra   []string `json:"extra,omitempty"`   // keys and files only added by the native writer
+	Differ  []string `json:"differ,omitempty"`  // files stored by both with different size
+	Error   string   `json:"error,omitempty"`   // either writer failed, nothing compared
+}
+
+// Match check if the native writer give the same store as symstore.exe.
+//
+func (r *ShadowReport) Match() bool {
+	return r.Error == "" && len(r.Missing) == 0 && len(r.Extra) == 0 && len(r.Differ) == 0
+}
+
+// stagingKeys return the keys of the only transaction of staging store `dir`, lower case
+func stagingKeys(dir string) (map[string]bool, error) {
+	stage := &BrBuilder{Branch: Branch{StorePath: dir}}
+	keys, err := stage.transactionKeys(stage.GetLatestID())
+	if err != nil {
+		return nil, err
+	}
+	set := make(map[string]bool, len(keys))
+	for _, key := range keys {
+		set[strings.ToLower(key)] = true
+	}
+	return set, nil
+}
+
+// stagingFiles return the size of symbol files in staging store `dir` by lower case path
+func stagingFiles(dir string) (map[string]int64, error) {
+	files := make(map[string]int64)
+	err := filepath.Walk(dir, func(fpath string, fi os.FileInfo, err error) error {
+		if err != nil {
+			return err
+		}
+		rel, _ := filepath.Rel(dir, fpath)
+		rel = strings.ToLower(filepath.ToSlash(rel))
+		switch {
+		case fi.IsDir() && rel == strings.ToLower(adminDir):
+			return filepath.SkipDir
+		case fi.IsDir(), rel == pingmeTxt, rel == index2Txt:
+			return nil
+		}
+		files[rel] = fi.Size()
+		return nil
+	})
+	return files, err
+}
+
+// diffSets add `a` not in `b` to missing, `b` not in `a` to extra
+func diffSets(a, b map[string]bool, report *ShadowReport) {
+	for k := range a {
+		if !b[k] {
+			report.Missing = append(report.Missing, k)
+		}
+	}
+	for k := range b {
+		if !a[k] {
+			report.Extra = append(report.Extra, k)
+		}
+	}
+}
+
+// compareStaging diff staging store `tool` written by symstore.exe with `native`
+func compareStaging(tool, native string, report *ShadowReport) error {
+	toolKeys, err := stagingKeys(tool)
+	if err != nil {
+		return err
+	}
+	nativeKeys, err := stagingKeys(native)
+	if err != nil {
+		return err
+	}
+	report.Keys = len(toolKeys)
+	diffSets(toolKeys, nativeKeys, report)
+
+	toolFiles, err := stagingFiles(tool)
+	if err != nil {
+		return err
+	}
+	nativeFiles, err := stagingFiles(native)
+	if err != nil {
+		return err
+	}
+	report.Files = len(toolFiles)
+	toolSet, nativeSet := make(map[string]bool), make(map[string]bool)
+	for rel, size := range toolFiles {
+		toolSet[rel] = true
+		if n, ok := nativeFiles[rel]; ok && n != size {
+			report.Differ = append(report.Differ, fmt.Sprintf("%s (%d, native %d bytes)", rel, size, n))
+		}
+	}
+	for rel := range nativeFiles {
+		nativeSet[rel] = true
+	}
+	diffSets(toolSet, nativeSet, report)
+
+	sort.Strings(report.Missing)
+	sort.Strings(report.Extra)
+	sort.Strings(report.Differ)
+	return nil
+}
+
+// shadowIngest add `symbols` of build `version` to two staging stores under `[ingest]
+// SHADOW_DIR`, by symstore.exe and by the native writer, and record how they differ.
+// The branch store is not touched, staging stores are kept for inspection if they differ.
+func (b *BrBuilder) shadowIngest(ctx context.Context, version, symbols string) *ShadowReport {
+	if config.ShadowDir == "" {
+		return nil
+	}
+	if _, ok := ShadowTool.(execSymStore); ok && native() {
+		log.Warn("[Shadow] SYMSTORE_EXE not set, nothing to compare the native writer with.")
+		return nil
+	}
+	report := &ShadowReport{Branch: b.Name(), Version: version, Date: timestamp(now())}
+	root := filepath.Join(config.ShadowDir, b.StoreName)
+	toolDir, nativeDir := filepath.Join(root, "symstore"), filepath.Join(root, "native")
+	os.RemoveAll(root)
+
+	_, err := os.Stat(filepath.Join(b.StorePath, index2Txt))
+	twoTier := err == nil
+	comment := "shadow " + timestamp(now())
+	for _, stage := range []struct {
+		dir    string
+		writer SymStorer
+	}{{toolDir, ShadowTool}, {nativeDir, nativeSymStore{}}} {
+		if err = os.MkdirAll(stage.dir, 0755); err != nil {
+			break
+		}
+		if twoTier {
+			// same layout as the branch store
+			ioutil.WriteFile(filepath.Join(stage.dir, index2Txt), nil, 0644)
+		}
+		if _, err = stage.writer.Add(ctx, stage.dir, b.Name(), version, comment, symbols); err != nil {
+			err = fmt.Errorf("%s: %v", filepath.Base(stage.dir), err)
+			break
+		}
+	}
+	if err == nil {
+		err = compareStaging(toolDir, nativeDir, report)
+	}
+	if err != nil {
+		report.Error = err.Error()
+	}
+
+	if report.Match() {
+		os.RemoveAll(root)
+		log.Info("[Shadow] Build %s of %s match, %d keys and %d files.", version, b.Name(), report.Keys, report.Files)
+	} else {
+		log.Warn("[Shadow] Build %s of %s differ: %d missing, %d extra, %d size mismatch. %s",
+			version, b.Name(), len(report.Missing), len(report.Extra), len(report.Differ), report.Error)
+		alert.Raise(alert.KindShadowMismatch, b.Name(),
+			"native ingest of build %s differ from symstore.exe: %d missing, %d extra, %d size mismatch. %s",
+			version, len(report.Missing), len(report.Extra), len(report.Differ), report.Error)
+	}
+
+	reports := b.shadowReports()
+	reports[version] = report
+	data, _ := json.MarshalIndent(reports, "", "\t")
+	if err = writeFileAtomic(b.branchFile(shadowJSON), data); err != nil {
+		log.Warn("[Shadow] Save report of %s failed: %v.", b.Name(), err)
+	}
+	return report
+}
+
+// shadowReports read 000Admin/shadow.json, version => report
+func (b *BrBuilder) shadowReports() map[string]*ShadowReport {
+	reports := make(map[string]*ShadowReport)
+	data, err := ioutil.ReadFile(b.branchFile(shadowJSON))
+	if err != nil {
+		return reports
+	}
+	if err = json.Unmarshal(data, &reports); err != nil {
+		log.Error(2, "[Branch] Invalid %s of %s: %v.", shadowJSON, b.Name(), err)
+	}
+	return reports
+}
+
+// ShadowReports return shadow ingest reports of all branches (or the given branch), newest
+// first. `mismatch` only return the ones which differ.
+//
+func (ss *sserver) ShadowReports(branch string, mismatch bool) []*ShadowReport {
+	var arr []*ShadowReport
+	ss.WalkBuilders(func(bu Builder) error {
+		b, ok := bu.(*BrBuilder)
+		if !ok || (branch != "" && !strings.EqualFold(branch, b.Name())) {
+			return nil
+		}
+		for _, r := range b.shadowReports() {
+			if !mismatch || !r.Match() {
+				arr = append(arr, r)
+			}
+		}
+		return nil
+	})
+	sort.Slice(arr, func(i, j int) bool {
+		return arr[i].Date > arr[j].Date
+	})
+	return arr
+}
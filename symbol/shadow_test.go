@@ -0,0 +1,76 @@
+package symbol
+
+import (
+	"context"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/adyzng/GoSymbols/config"
+)
+
+// skewedTool write the store natively, then truncate bar.exe and drop foo.dll
+type skewedTool struct{}
+
+func (skewedTool) Add(ctx context.Context, store, product, version, comment, symbols string) ([]byte, error) {
+	output, err := nativeSymStore{}.Add(ctx, store, product, version, comment, symbols)
+	if err != nil {
+		return nil, err
+	}
+	ioutil.WriteFile(filepath.Join(store, "bar.exe", "59C0C5B3a3000", "bar.exe"), []byte("truncated"), 0644)
+	os.RemoveAll(filepath.Join(store, "foo.dll"))
+	return output, nil
+}
+
+func TestShadowIngest(t *testing.T) {
+	root, err := ioutil.TempDir("", "shadow")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(root)
+	defer func(dir string, tool SymStorer) {
+		config.ShadowDir, ShadowTool = dir, tool
+	}(config.ShadowDir, ShadowTool)
+	config.ShadowDir = filepath.Join(root, "shadow")
+
+	symbols, store := filepath.Join(root, "symbols"), filepath.Join(root, "store")
+	os.MkdirAll(symbols, 0755)
+	os.MkdirAll(filepath.Join(store, adminDir), 0755)
+	ioutil.WriteFile(filepath.Join(symbols, "foo.dll"), fakePE(1), 0644)
+	ioutil.WriteFile(filepath.Join(symbols, "bar.exe"), fakePE(2), 0644)
+	b := NewBranch2(&Branch{StoreName: "UDP", StorePath: store, BuildPath: root}).(*BrBuilder)
+
+	ShadowTool = nativeSymStore{}
+	report := b.shadowIngest(context.Background(), "100", symbols)
+	if report == nil || !report.Match() || report.Keys != 2 || report.Files != 2 {
+		t.Fatalf("expect 2 keys and files matched, got %+v", report)
+	}
+	if _, err := os.Stat(filepath.Join(config.ShadowDir, "UDP")); !os.IsNotExist(err) {
+		t.Errorf("staging stores should be removed when matched: %v", err)
+	}
+	if _, err := os.Stat(filepath.Join(store, "foo.dll")); !os.IsNotExist(err) {
+		t.Errorf("branch store should not be touched: %v", err)
+	}
+
+	ShadowTool = skewedTool{}
+	report = b.shadowIngest(context.Background(), "101", symbols)
+	if report.Match() {
+		t.Fatalf("expect mismatch, got %+v", report)
+	}
+	// the key stay in the transaction of the skewed tool, only the file is gone
+	if len(report.Extra) != 1 || report.Extra[0] != "foo.dll/59c0c5b3a3000/foo.dll" {
+		t.Errorf("unexpected extra %v", report.Extra)
+	}
+	if len(report.Missing) != 0 || len(report.Differ) != 1 {
+		t.Errorf("expect bar.exe differ only, got missing %v, differ %v", report.Missing, report.Differ)
+	}
+	if _, err := os.Stat(filepath.Join(config.ShadowDir, "UDP", "native")); err != nil {
+		t.Errorf("staging stores should be kept when differ: %v", err)
+	}
+
+	reports := b.shadowReports()
+	if len(reports) != 2 || !reports["100"].Match() || reports["101"].Match() {
+		t.Errorf("unexpected saved reports %+v", reports)
+	}
+}
@@ -0,0 +1,117 @@
+package symbol
+
+import (
+	"sort"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/adyzng/GoSymbols/alert"
+	"github.com/adyzng/GoSymbols/config"
+	"github.com/adyzng/GoSymbols/fault"
+	log "gopkg.in/clog.v1"
+)
+
+// ShareHealth is the reachability and read latency of the build share of one branch,
+// checked every update cycle.
+//
+type ShareHealth struct {
+	Branch    string `json:"branch"`
+	Path      string `json:"path"`
+	Reachable bool   `json:"reachable"`
+	Latency   int64  `json:"latency"`  // ms to read latestbuild.txt
+	Failures  int    `json:"failures"` // consecutive unreachable cycles
+	Slow      bool   `json:"slow"`     // latency over config.ShareLatencyLimit
+	LastOK    string `json:"lastOK,omitempty"`
+	LastCheck string `json:"lastCheck"`
+	Error     string `json:"error,omitempty"`
+}
+
+// shareMonitor keep the latest health of all build shares
+type shareMonitor struct {
+	mx     sync.Mutex
+	health map[string]*ShareHealth // lower branch name => health
+}
+
+// probeShare read latestbuild.txt from build share, return latency
+func (b *BrBuilder) probeShare() (time.Duration, error) {
+	start := time.Now()
+	if err := fault.Check(fault.Fetch); err != nil {
+		return time.Since(start), err
+	}
+	_, err := b.getLatestBuild(false)
+	return time.Since(start), err
+}
+
+// checkShare probe the build share of branch and update its health. Alert once when
+// the share is unreachable for config.ShareDownCycles cycles in a row, or become slower
+// than config.ShareLatencyLimit, these are not ingest failures of the branch.
+// Return true if the share is reachable.
+//
+func (ss *sserver) checkShare(bu Builder) bool {
+	b, ok := bu.(*BrBuilder)
+	if !ok || b.BuildPath == "" {
+		return bu.CanUpdate()
+	}
+	latency, err := b.probeShare()
+	now := timestamp(now())
+
+	m := ss.shares
+	m.mx.Lock()
+	defer m.mx.Unlock()
+	key := strings.ToLower(b.Name())
+	h, ok := m.health[key]
+	if !ok {
+		h = &ShareHealth{Branch: b.Name()}
+		m.health[key] = h
+	}
+	h.Path = b.BuildPath
+	h.LastCheck = now
+	h.Latency = int64(latency / time.Millisecond)
+
+	if err != nil {
+		h.Reachable = false
+		h.Error = err.Error()
+		h.Failures++
+		log.Warn("[SS] Build share of %s unreachable (%d cycles): %v.", b.Name(), h.Failures, err)
+		if h.Failures == config.ShareDownCycles {
+			alert.Raise(alert.KindShareUnreachable, b.Name(),
+				"build share %s unreachable for %d cycles: %v.", b.BuildPath, h.Failures, err)
+		}
+		return false
+	}
+
+	if h.Failures >= config.ShareDownCycles {
+		log.Info("[SS] Build share of %s is back after %d cycles.", b.Name(), h.Failures)
+	}
+	h.Reachable = true
+	h.Error = ""
+	h.Failures = 0
+	h.LastOK = now
+
+	slow := config.ShareLatencyLimit > 0 && h.Latency > int64(config.ShareLatencyLimit)
+	if slow && !h.Slow {
+		alert.Raise(alert.KindShareSlow, b.Name(),
+			"build share %s read latency %dms over limit %dms.", b.BuildPath, h.Latency, config.ShareLatencyLimit)
+	}
+	h.Slow = slow
+	return true
+}
+
+// ShareHealth return health of build shares of all branches checked, sorted by branch.
+//
+func (ss *sserver) ShareHealth() []*ShareHealth {
+	m := ss.shares
+	m.mx.Lock()
+	defer m.mx.Unlock()
+
+	arr := make([]*ShareHealth, 0, len(m.health))
+	for _, h := range m.health {
+		c := *h
+		arr = append(arr, &c)
+	}
+	sort.Slice(arr, func(i, j int) bool {
+		return arr[i].Branch < arr[j].Branch
+	})
+	return arr
+}
@@ -0,0 +1,65 @@
+package symbol
+
+import (
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/adyzng/GoSymbols/alert"
+	"github.com/adyzng/GoSymbols/config"
+)
+
+func countAlerts(kind, branch string) int {
+	n := 0
+	for _, a := range alert.Recent(0) {
+		if a.Kind == kind && a.Branch == branch {
+			n++
+		}
+	}
+	return n
+}
+
+func TestCheckShare(t *testing.T) {
+	root, err := ioutil.TempDir("", "share")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(root)
+	defer func(cycles, limit int, file string) {
+		config.ShareDownCycles, config.ShareLatencyLimit, config.LatestBuildFile = cycles, limit, file
+		config.FaultTargets, config.FaultLatency = nil, 0
+	}(config.ShareDownCycles, config.ShareLatencyLimit, config.LatestBuildFile)
+	config.ShareDownCycles, config.ShareLatencyLimit, config.LatestBuildFile = 2, 0, "latestbuild.txt"
+
+	ss := &sserver{builders: make(map[string]Builder), shares: &shareMonitor{health: make(map[string]*ShareHealth)}}
+	b := NewBranch2(&Branch{StoreName: "ShareTest", StorePath: root, BuildPath: root})
+	for i := 0; i < 3; i++ {
+		if ss.checkShare(b) {
+			t.Fatal("expect share unreachable without latestbuild.txt")
+		}
+	}
+	h := ss.ShareHealth()
+	if len(h) != 1 || h[0].Failures != 3 || h[0].Reachable {
+		t.Fatalf("unexpected share health %+v", h[0])
+	}
+	if n := countAlerts(alert.KindShareUnreachable, "ShareTest"); n != 1 {
+		t.Fatalf("expect alert once after %d cycles, got %d", config.ShareDownCycles, n)
+	}
+
+	ioutil.WriteFile(filepath.Join(root, config.LatestBuildFile), []byte("100"), 0644)
+	if !ss.checkShare(b) {
+		t.Fatal("expect share reachable")
+	}
+	if h = ss.ShareHealth(); h[0].Failures != 0 || h[0].LastOK == "" || h[0].Error != "" {
+		t.Fatalf("expect health reset, got %+v", h[0])
+	}
+
+	// slow share, injected latency over the soft limit
+	config.FaultTargets, config.FaultLatency, config.ShareLatencyLimit = []string{"fetch"}, 20, 5
+	ss.checkShare(b)
+	ss.checkShare(b)
+	if h = ss.ShareHealth(); !h[0].Slow || countAlerts(alert.KindShareSlow, "ShareTest") != 1 {
+		t.Fatalf("expect slow share alerted once, got %+v", h[0])
+	}
+}
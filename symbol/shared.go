@@ -0,0 +1,104 @@
+package symbol
+
+import (
+	"fmt"
+	"path/filepath"
+	"sort"
+	"strings"
+
+	"github.com/adyzng/GoSymbols/config"
+	log "gopkg.in/clog.v1"
+)
+
+var (
+	ErrSharedStore = fmt.Errorf("store root is shared with other branches")
+)
+
+// sharedDefaults put new branch without store path into the shared store `[base] SHARED_STORE`.
+func sharedDefaults(br *Branch) {
+	if br.StorePath == "" && config.SharedStore != "" {
+		br.StorePath = filepath.Join(config.Destination, config.SharedStore)
+		br.Shared = true
+	}
+}
+
+// branchName return name of admin file owned by the branch, eg: branch.bin or sealed.txt.
+// Files of branches sharing the store root are prefixed by the branch name.
+func (b *BrBuilder) branchName(name string) string {
+	if b.Shared {
+		return b.StoreName + "." + name
+	}
+	return name
+}
+
+// branchFile return path of admin file `branchName(name)`
+func (b *BrBuilder) branchFile(name string) string {
+	return filepath.Join(b.StorePath, adminDir, b.branchName(name))
+}
+
+// ownBuild check if a build of server.txt belong to the branch, the product given to
+// symstore.exe tell branches sharing the store root apart.
+func (b *BrBuilder) ownBuild(build *Build) bool {
+	return !b.Shared || strings.EqualFold(build.Branch, b.StoreName)
+}
+
+// foreignKeys return `name\hash` (lower case) referenced by builds of other branches in the
+// shared store, such files must never be removed with the branch's own references.
+func (b *BrBuilder) foreignKeys() (map[string]bool, error) {
+	keys := make(map[string]bool)
+	if !b.Shared {
+		return keys, nil
+	}
+	lines, err := b.transactionLines(serverTxt)
+	if err != nil {
+		return nil, err
+	}
+	for _, line := range lines {
+		build := parseBuildLine(line)
+		if build == nil || b.ownBuild(build) {
+			continue
+		}
+		tx, err := b.transactionKeys(build.ID)
+		if err != nil {
+			log.Warn("[Branch] Read transaction %s of shared store %s failed: %v.", build.ID, b.StorePath, err)
+			continue
+		}
+		for _, key := range tx {
+			keys[strings.ToLower(key)] = true
+		}
+	}
+	return keys, nil
+}
+
+// sharedBranches return a branch for each product recorded in server.txt of shared store `root`.
+func sharedBranches(root string) []Builder {
+	probe := &BrBuilder{Branch: Branch{StorePath: root}}
+	lines, err := probe.transactionLines(serverTxt)
+	if err != nil {
+		log.Warn("[SS] Read shared store %s failed: %v.", root, err)
+		return nil
+	}
+	products := make(map[string]string)
+	for _, line := range lines {
+		if build := parseBuildLine(line); build != nil && build.Branch != "" {
+			products[strings.ToLower(build.Branch)] = build.Branch
+		}
+	}
+	names := make([]string, 0, len(products))
+	for _, name := range products {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+
+	arr := make([]Builder, 0, len(names))
+	for _, name := range names {
+		arr = append(arr, NewBranch2(&Branch{
+			BuildName:  name,
+			StoreName:  name,
+			StorePath:  root,
+			Shared:     true,
+			UpdateDate: timestamp(now()),
+		}))
+	}
+	return arr
+}
@@ -0,0 +1,113 @@
+package symbol
+
+import (
+	"context"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/adyzng/GoSymbols/config"
+)
+
+func TestSharedStore(t *testing.T) {
+	root, err := ioutil.TempDir("", "shared")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(root)
+
+	admin := filepath.Join(root, adminDir)
+	os.MkdirAll(admin, 0755)
+	ioutil.WriteFile(filepath.Join(admin, serverTxt), []byte(
+		"0000000001,add,file,07/04/2017,14:44:10,\"Main\",\"100\",\"c\",\r\n"+
+			"0000000002,add,file,07/04/2017,14:44:11,\"Dev\",\"200\",\"c\",\r\n"+
+			"0000000003,add,file,07/04/2017,14:44:12,\"Main\",\"101\",\"c\",\r\n"), 0644)
+	ioutil.WriteFile(filepath.Join(admin, "0000000001"), []byte("\"a.pdb\\A1\",\"x\"\r\n\"c.pdb\\C1\",\"x\"\r\n"), 0644)
+	ioutil.WriteFile(filepath.Join(admin, "0000000002"), []byte("\"a.pdb\\A1\",\"x\"\r\n\"b.pdb\\B1\",\"x\"\r\n"), 0644)
+	ioutil.WriteFile(filepath.Join(admin, "0000000003"), []byte("\"c.pdb\\C2\",\"x\"\r\n"), 0644)
+
+	branches := sharedBranches(root)
+	if len(branches) != 2 || branches[0].Name() != "Dev" || branches[1].Name() != "Main" {
+		t.Fatalf("expect branches Dev and Main, got %v", branches)
+	}
+	b := branches[1].(*BrBuilder)
+	if n, err := b.ParseBuilds(context.Background(), nil); err != nil || n != 2 {
+		t.Fatalf("expect 2 builds of Main, got %d %v", n, err)
+	}
+	if b.getBuild("200", "") != nil {
+		t.Errorf("build of Dev should not be attributed to Main")
+	}
+	if fpath := b.branchFile(sealedTxt); filepath.Base(fpath) != "Main.sealed.txt" {
+		t.Errorf("unexpected branch file %s", fpath)
+	}
+
+	plan, err := b.planPurge(PurgeOption{Patterns: []string{"*.pdb"}})
+	if err != nil {
+		t.Fatal(err)
+	}
+	shared := make(map[string]bool)
+	for _, e := range plan.Entries {
+		shared[e.Name+"\\"+e.Hash] = e.Shared
+	}
+	if len(plan.Entries) != 3 || !shared["a.pdb\\A1"] || shared["c.pdb\\C1"] || shared["c.pdb\\C2"] {
+		t.Errorf("expect a.pdb shared with Dev only, got %v", shared)
+	}
+	if _, err := b.Seal("admin", "test", true); err != ErrSharedStore {
+		t.Errorf("expect read-only seal refused, got %v", err)
+	}
+}
+
+func TestSharedAdminFiles(t *testing.T) {
+	root, err := ioutil.TempDir("", "shared")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(root)
+
+	admin := filepath.Join(root, adminDir)
+	os.MkdirAll(admin, 0755)
+	ioutil.WriteFile(filepath.Join(root, "integrity.key"), []byte("00112233445566778899aabbccddeeff"), 0600)
+	saved := config.IntegrityKeyFile
+	config.IntegrityKeyFile = filepath.Join(root, "integrity.key")
+	defer func() { config.IntegrityKeyFile = saved }()
+
+	ioutil.WriteFile(filepath.Join(admin, serverTxt), []byte(
+		"0000000001,add,file,07/04/2017,14:44:10,\"Main\",\"100\",\"c\",\r\n"+
+			"0000000002,add,file,07/04/2017,14:44:11,\"Dev\",\"200\",\"c\",\r\n"), 0644)
+	ioutil.WriteFile(filepath.Join(admin, "0000000001"), []byte("\"a.pdb\\A1\",\"x\"\r\n"), 0644)
+	ioutil.WriteFile(filepath.Join(admin, "0000000002"), []byte("\"b.pdb\\B1\",\"x\"\r\n"), 0644)
+
+	branches := make(map[string]*BrBuilder)
+	for id, name := range map[string]string{"0000000001": "Main", "0000000002": "Dev"} {
+		b := NewBranch2(&Branch{StoreName: name, StorePath: root, Shared: true}).(*BrBuilder)
+		b.addBuild(&Build{ID: id, Version: name, Branch: name})
+		if _, err = b.MarkRelease(id, true); err != nil {
+			t.Fatal(err)
+		}
+		b.ingMx.Lock()
+		err = b.signTransactions(signAdd, id)
+		b.ingMx.Unlock()
+		if err != nil {
+			t.Fatal(err)
+		}
+		branches[id] = b
+	}
+
+	// neither branch erases the release marks or breaks the chain of the other
+	for id, b := range branches {
+		if marks := b.releaseMarks(); len(marks) != 1 || !marks[id] {
+			t.Errorf("unexpected release marks of %s: %v", b.Name(), marks)
+		}
+		report, err := b.Verify()
+		if err != nil {
+			t.Fatal(err)
+		}
+		if !report.OK() || len(report.Unsigned) != 0 {
+			t.Errorf("unexpected report of %s: %+v", b.Name(), report)
+		}
+	}
+	if _, err = os.Stat(filepath.Join(admin, releaseTxt)); !os.IsNotExist(err) {
+		t.Errorf("expect no release.txt shared by the branches, got %v", err)
+	}
+}
@@ -0,0 +1,106 @@
+package symbol
+
+import (
+	"context"
+	"sort"
+	"strings"
+
+	log "gopkg.in/clog.v1"
+)
+
+// ShippedBuild is one build shipping a symbol
+//
+type ShippedBuild struct {
+	Key     string `json:"key"`
+	ID      string `json:"id"`
+	Version string `json:"version"`
+	Date    string `json:"date"`
+	Hash    string `json:"hash"`
+}
+
+// Shipment is the builds of one branch shipping a symbol
+//
+type Shipment struct {
+	Branch    string          `json:"branch"`
+	Name      string          `json:"name"`
+	FirstSeen *ShippedBuild   `json:"firstSeen"`
+	LastSeen  *ShippedBuild   `json:"lastSeen"`
+	Hashes    int             `json:"hashes"` // distinct hashes shipped
+	Builds    []*ShippedBuild `json:"builds"` // oldest first
+}
+
+// Shipment return builds of this branch which ship symbol `name`, nil if none. Only builds
+// still in store are known, purged transactions are gone with their files.
+//
+func (b *BrBuilder) Shipment(name string) (*Shipment, error) {
+	var builds []*Build
+	if _, err := b.ParseBuilds(context.Background(), func(build *Build) error {
+		builds = append(builds, build)
+		return nil
+	}); err != nil {
+		return nil, err
+	}
+	sort.Slice(builds, func(i, j int) bool {
+		return builds[i].ID < builds[j].ID
+	})
+
+	var sp *Shipment
+	hashes := make(map[string]bool)
+	for _, build := range builds {
+		keys, err := b.transactionKeys(build.ID)
+		if err != nil {
+			log.Warn("[Branch] Read transaction %s of %s failed: %v.", build.ID, b.Name(), err)
+			continue
+		}
+		for _, key := range keys {
+			ss := strings.Split(key, "\\")
+			if !strings.EqualFold(ss[0], name) {
+				continue
+			}
+			if sp == nil {
+				sp = &Shipment{Branch: b.Name(), Name: ss[0]}
+			}
+			sp.Builds = append(sp.Builds, &ShippedBuild{
+				Key:     build.Key,
+				ID:      build.ID,
+				Version: build.Version,
+				Date:    build.Date,
+				Hash:    ss[1],
+			})
+			hashes[strings.ToUpper(ss[1])] = true
+			break
+		}
+	}
+	if sp == nil {
+		return nil, nil
+	}
+	sp.FirstSeen, sp.LastSeen = sp.Builds[0], sp.Builds[len(sp.Builds)-1]
+	sp.Hashes = len(hashes)
+	return sp, nil
+}
+
+// WhoShips return every branch shipping symbol `name`, the latest shipped first.
+//
+func (ss *sserver) WhoShips(name string) []*Shipment {
+	var arr []*Shipment
+	ss.WalkBuilders(func(bu Builder) error {
+		b, ok := bu.(*BrBuilder)
+		if !ok {
+			return nil
+		}
+		sp, err := b.Shipment(name)
+		if err != nil {
+			log.Warn("[SS] Lookup %s in %s failed: %v.", name, b.Name(), err)
+		} else if sp != nil {
+			arr = append(arr, sp)
+		}
+		return nil
+	})
+	sort.Slice(arr, func(i, j int) bool {
+		if arr[i].LastSeen.Date != arr[j].LastSeen.Date {
+			return arr[i].LastSeen.Date > arr[j].LastSeen.Date
+		}
+		return arr[i].Branch < arr[j].Branch
+	})
+	return arr
+}
@@ -0,0 +1,45 @@
+package symbol
+
+import (
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+func TestShipment(t *testing.T) {
+	root, err := ioutil.TempDir("", "ships")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(root)
+
+	admin := filepath.Join(root, adminDir)
+	os.MkdirAll(admin, 0755)
+	server := ""
+	txs := [][]string{{"ca_a.pdb\\A1", "ca_b.pdb\\B1"}, {"ca_b.pdb\\B1"}, {"CA_A.pdb\\A2"}}
+	for i, keys := range txs {
+		id := padID(string('1' + byte(i)))
+		lines := ""
+		for _, key := range keys {
+			lines += "\"" + key + "\",\"S:\\000Unzip\\x.pdb\"\r\n"
+		}
+		ioutil.WriteFile(filepath.Join(admin, id), []byte(lines), 0644)
+		server += id + ",add,file,07/04/2017,14:44:1" + string('0'+byte(i)) + ",\"test\",\"4175.2-53" + string('0'+byte(i)) + "\",\"\",\r\n"
+	}
+	ioutil.WriteFile(filepath.Join(admin, serverTxt), []byte(server), 0644)
+
+	b := NewBranch2(&Branch{StoreName: "ShipTest", StorePath: root, BuildPath: root}).(*BrBuilder)
+	sp, err := b.Shipment("ca_a.pdb")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if sp == nil || len(sp.Builds) != 2 || sp.Hashes != 2 ||
+		sp.FirstSeen.Version != "4175.2-530" || sp.LastSeen.Version != "4175.2-532" ||
+		sp.LastSeen.Key != "ShipTest@0000000003" {
+		t.Fatalf("unexpected shipment %+v", sp)
+	}
+	if sp, _ = b.Shipment("ca_c.pdb"); sp != nil {
+		t.Errorf("expect not shipped, got %+v", sp)
+	}
+}
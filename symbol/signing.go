@@ -0,0 +1,260 @@
+package symbol
+
+import (
+	"encoding/json"
+	"io/ioutil"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"sort"
+	"strings"
+
+	"github.com/adyzng/GoSymbols/alert"
+	"github.com/adyzng/GoSymbols/config"
+	"github.com/adyzng/GoSymbols/pdb"
+	log "gopkg.in/clog.v1"
+)
+
+const (
+	signingDir = "signing"     // 000Admin/signing/{ID}.json, signature status of binaries per transaction
+	releaseTxt = "release.txt" // IDs of builds marked as release, one per line
+)
+
+// BinarySign is the signature status of one binary published by a transaction
+//
+type BinarySign struct {
+	Name        string `json:"name"`
+	Path        string `json:"path"` // relative path in debug zip
+	Transaction string `json:"transaction"`
+	pdb.SignInfo
+}
+
+// Blocker check if the binary can't be shipped in a release build
+func (s *BinarySign) Blocker() bool {
+	return s.Status == pdb.SignUnsigned || s.Status == pdb.SignInvalid
+}
+
+// signToolBatch is the max count of files verified by one signtool run, keep the command
+// line under the limit of Windows
+const signToolBatch = 64
+
+// verifySigned run `signtool verify /pa` on the signed binaries if configured, `signs` is
+// keyed by file path. Binaries are verified in batches instead of one process per file.
+func verifySigned(signs map[string]*pdb.SignInfo) {
+	if config.SignTool == "" {
+		return
+	}
+	var files []string
+	for fpath, info := range signs {
+		if info.Status == pdb.SignSigned {
+			files = append(files, fpath)
+		}
+	}
+	sort.Strings(files)
+	for len(files) > 0 {
+		n := len(files)
+		if n > signToolBatch {
+			n = signToolBatch
+		}
+		batch := files[:n]
+		files = files[n:]
+
+		out, err := exec.Command(config.SignTool, append([]string{"verify", "/pa"}, batch...)...).CombinedOutput()
+		verified, errs := parseSignTool(string(out))
+		for _, fpath := range batch {
+			info := signs[fpath]
+			key := strings.ToLower(filepath.Clean(fpath))
+			switch {
+			case verified[key]:
+				info.Status = pdb.SignValid
+			case errs[key] != "":
+				info.Status, info.Error = pdb.SignInvalid, errs[key]
+			case err != nil:
+				info.Status, info.Error = pdb.SignInvalid, err.Error()
+			default:
+				log.Warn("[Branch] Signtool reported nothing of %s.", fpath)
+			}
+		}
+	}
+}
+
+// parseSignTool read the result of each file from the output of `signtool verify`:
+//	File: C:\foo.dll
+//	SignTool Error: A certificate chain processed, but terminated in a root ...
+//	Successfully verified: C:\bar.dll
+// Paths are cleaned and lower cased.
+func parseSignTool(out string) (verified map[string]bool, errs map[string]string) {
+	verified, errs = make(map[string]bool), make(map[string]string)
+	file := ""
+	for _, line := range strings.Split(out, "\n") {
+		line = strings.TrimSpace(line)
+		switch {
+		case strings.HasPrefix(line, "File: "):
+			file = strings.ToLower(filepath.Clean(strings.TrimSpace(line[len("File: "):])))
+		case strings.HasPrefix(line, "Successfully verified: "):
+			verified[strings.ToLower(filepath.Clean(strings.TrimSpace(line[len("Successfully verified: "):])))] = true
+		case strings.HasPrefix(line, "SignTool Error: ") && file != "":
+			if errs[file] == "" {
+				errs[file] = line[len("SignTool Error: "):]
+			}
+		}
+	}
+	return verified, errs
+}
+
+// recordSigning capture the signature status of all binaries in `symPath` for transaction `id`.
+//
+func (b *BrBuilder) recordSigning(id, symPath string) ([]*BinarySign, error) {
+	var signs []*BinarySign
+	infos := make(map[string]*pdb.SignInfo)
+	filepath.Walk(symPath, func(fpath string, fi os.FileInfo, err error) error {
+		if err != nil || fi.IsDir() || !pdb.IsBinary(fi.Name()) {
+			return nil
+		}
+		fd, err := os.Open(fpath)
+		if err != nil {
+			return nil
+		}
+		info, err := pdb.ReadSignInfo(fd)
+		fd.Close()
+		if err != nil {
+			// not an PE file, symstore will skip it too
+			return nil
+		}
+		rel, _ := filepath.Rel(symPath, fpath)
+		sign := &BinarySign{
+			Name:        fi.Name(),
+			Path:        filepath.ToSlash(rel),
+			Transaction: id,
+			SignInfo:    *info,
+		}
+		infos[fpath] = &sign.SignInfo
+		signs = append(signs, sign)
+		return nil
+	})
+	verifySigned(infos)
+	sort.Slice(signs, func(i, j int) bool {
+		return signs[i].Path < signs[j].Path
+	})
+
+	dir := filepath.Join(b.StorePath, adminDir, signingDir)
+	if err := os.MkdirAll(dir, 0755); err != nil {
+		return signs, err
+	}
+	data, _ := json.MarshalIndent(signs, "", "\t")
+	if err := writeFileAtomic(filepath.Join(dir, id+".json"), data); err != nil {
+		return signs, err
+	}
+
+	blockers := 0
+	for _, s := range signs {
+		if s.Blocker() {
+			blockers++
+		}
+	}
+	log.Info("[Branch] Record signature of %d binaries in %s, %d unsigned or invalid.", len(signs), id, blockers)
+	return signs, nil
+}
+
+// Signing return signature status of binaries published by given build and its supplements.
+//
+func (b *BrBuilder) Signing(buildID string) ([]*BinarySign, error) {
+	build := b.getBuild("", buildID)
+	if build == nil {
+		return nil, ErrBuildNotExist
+	}
+
+	var all []*BinarySign
+	for _, id := range append([]string{build.ID}, build.Supplements...) {
+		data, err := ioutil.ReadFile(filepath.Join(b.StorePath, adminDir, signingDir, id+".json"))
+		if os.IsNotExist(err) {
+			continue
+		}
+		if err != nil {
+			return all, err
+		}
+		var signs []*BinarySign
+		if err = json.Unmarshal(data, &signs); err != nil {
+			return all, err
+		}
+		all = append(all, signs...)
+	}
+	return all, nil
+}
+
+// releaseMarks read IDs of release builds from release.txt of the branch. Shared store marked
+// before release.txt was kept per branch falls back to 000Admin/release.txt.
+func (b *BrBuilder) releaseMarks() map[string]bool {
+	marks := make(map[string]bool)
+	data, err := ioutil.ReadFile(b.branchFile(releaseTxt))
+	if os.IsNotExist(err) && b.Shared {
+		data, err = ioutil.ReadFile(filepath.Join(b.StorePath, adminDir, releaseTxt))
+	}
+	if err != nil {
+		return marks
+	}
+	for _, id := range strings.Fields(string(data)) {
+		marks[id] = true
+	}
+	return marks
+}
+
+// MarkRelease mark or unmark build as release. Unsigned or invalid binaries of a release build
+// are returned and raised as alert, since they block shipping.
+//
+func (b *BrBuilder) MarkRelease(buildID string, release bool) ([]*BinarySign, error) {
+	if err := b.writable(); err != nil {
+		return nil, err
+	}
+	build := b.getBuild("", buildID)
+	if build == nil || build.SupplementOf != "" {
+		return nil, ErrBuildNotExist
+	}
+
+	unlock, err := lockAdmin(b.StorePath)
+	if err != nil {
+		return nil, err
+	}
+	b.mx.Lock()
+	build.Release = release
+	var ids []string
+	for id, bd := range b.builds {
+		if bd.Release {
+			ids = append(ids, id)
+		}
+	}
+	b.mx.Unlock()
+	sort.Strings(ids)
+
+	err = writeFileAtomic(b.branchFile(releaseTxt), []byte(strings.Join(ids, "\r\n")))
+	unlock()
+	if err != nil {
+		log.Error(2, "[Branch] Save release marks failed: %v.", err)
+		return nil, err
+	}
+	log.Info("[Branch] Mark build %s (%s) of %s release: %v.", build.Version, build.ID, b.Name(), release)
+	if !release {
+		return nil, nil
+	}
+	return b.checkRelease(build)
+}
+
+// checkRelease return blocker binaries of release build and raise alert
+func (b *BrBuilder) checkRelease(build *Build) ([]*BinarySign, error) {
+	signs, err := b.Signing(build.ID)
+	if err != nil {
+		return nil, err
+	}
+	var blockers []*BinarySign
+	for _, s := range signs {
+		if s.Blocker() {
+			blockers = append(blockers, s)
+		}
+	}
+	if len(blockers) > 0 {
+		alert.Raise(alert.KindUnsignedRelease, b.Name(),
+			"release build %s has %d unsigned or invalid binaries, eg: %s (%s)",
+			build.Version, len(blockers), blockers[0].Path, blockers[0].Status)
+	}
+	return blockers, nil
+}
@@ -0,0 +1,64 @@
+package symbol
+
+import (
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/adyzng/GoSymbols/pdb"
+)
+
+func TestReleaseSigning(t *testing.T) {
+	root, err := ioutil.TempDir("", "signing")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(root)
+
+	symPath := filepath.Join(root, unzipDir)
+	os.MkdirAll(filepath.Join(symPath, "x64"), 0755)
+	os.MkdirAll(filepath.Join(root, adminDir), 0755)
+	ioutil.WriteFile(filepath.Join(symPath, "x64", "foo.dll"), fakePE(0), 0644)
+	ioutil.WriteFile(filepath.Join(symPath, "x64", "foo.pdb"), []byte("pdb"), 0644)
+
+	b := NewBranch2(&Branch{StoreName: "test", StorePath: root, BuildPath: root}).(*BrBuilder)
+	b.addBuild(&Build{ID: "0000000001", Version: "100"})
+	signs, err := b.recordSigning("0000000001", symPath)
+	if err != nil || len(signs) != 1 || signs[0].Status != pdb.SignUnsigned || signs[0].Path != "x64/foo.dll" {
+		t.Fatalf("unexpected signing %+v (%v)", signs, err)
+	}
+
+	blockers, err := b.MarkRelease("0000000001", true)
+	if err != nil || len(blockers) != 1 {
+		t.Fatalf("expect 1 blocker, got %d (%v)", len(blockers), err)
+	}
+	if marks := b.releaseMarks(); !marks["0000000001"] {
+		t.Fatalf("release mark not saved: %v", marks)
+	}
+	if _, err = b.MarkRelease("0000000002", true); err != ErrBuildNotExist {
+		t.Fatalf("expect build not exist, got %v", err)
+	}
+}
+
+func TestParseSignTool(t *testing.T) {
+	out := "File: C:\\Unzip\\x64\\foo.dll\r\n" +
+		"Index  Algorithm  Timestamp\r\n" +
+		"SignTool Error: A certificate chain processed, but terminated in a root\r\n" +
+		"        certificate which is not trusted by the trust provider.\r\n" +
+		"\r\n" +
+		"File: C:\\Unzip\\x64\\bar.dll\r\n" +
+		"Successfully verified: C:\\Unzip\\x64\\bar.dll\r\n" +
+		"\r\n" +
+		"Number of files successfully Verified: 1\r\n" +
+		"Number of errors: 1\r\n"
+	verified, errs := parseSignTool(out)
+	foo, bar := strings.ToLower(filepath.Clean(`C:\Unzip\x64\foo.dll`)), strings.ToLower(filepath.Clean(`C:\Unzip\x64\bar.dll`))
+	if !verified[bar] || verified[foo] || len(verified) != 1 {
+		t.Errorf("unexpected verified files %v", verified)
+	}
+	if !strings.HasPrefix(errs[foo], "A certificate chain processed") || errs[bar] != "" {
+		t.Errorf("unexpected errors %v", errs)
+	}
+}
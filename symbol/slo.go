@@ -0,0 +1,208 @@
+package symbol
+
+import (
+	"bufio"
+	"context"
+	"encoding/json"
+	"fmt"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+
+	log "gopkg.in/clog.v1"
+)
+
+const (
+	latencyTxt    = "latency.txt"     // time from build completion to symbols available, `{ID},{built},{available}` in unix seconds
+	buildInfoJSON = "build-info.json" // optional in build folder, `{"completed": "2017-07-04T14:44:14Z", "revision": "..."}`
+)
+
+// Latency is the time from build completion on build server to symbols available
+//
+type Latency struct {
+	Built     string `json:"built"`     // build completion, from build-info.json or mtime of the build folder
+	Available string `json:"available"` // ingest complete
+	Minutes   int    `json:"minutes"`
+	Violated  bool   `json:"violated,omitempty"` // over the SLO of the branch
+}
+
+// SLOStatus summarize ingest latency of a branch against its SLO
+//
+type SLOStatus struct {
+	Branch     string   `json:"branch"`
+	SLO        int      `json:"slo"`        // minutes, 0 if not set
+	Measured   int      `json:"measured"`   // builds with known completion time
+	Violations int      `json:"violations"` // builds over SLO
+	P50        int      `json:"p50"`        // minutes
+	P95        int      `json:"p95"`
+	Max        int      `json:"max"`
+	Violated   []*Build `json:"violated,omitempty"`
+}
+
+// buildInfo is build-info.json in build folder, for build systems which know better than
+// the folder
+type buildInfo struct {
+	Completed time.Time `json:"completed"`
+	Revision  string    `json:"revision"` // source revision, see indexSources
+	Tickets   []string  `json:"tickets"`  // Jira issue keys, see linkTickets
+	Changes   string    `json:"changes"`  // change log, issue keys of `[jira] PROJECTS` in it are linked
+}
+
+// readBuildInfo return build-info.json of build `version`, empty if not exist
+func (b *BrBuilder) readBuildInfo(version string) *buildInfo {
+	info := &buildInfo{}
+	if b.fromFeed() {
+		return info
+	}
+	data, err := ioutil.ReadFile(filepath.Join(b.BuildPath, buildDirPrefix+version, buildInfoJSON))
+	if err != nil {
+		return info
+	}
+	if err = json.Unmarshal(data, info); err != nil {
+		log.Warn("[Branch] Invalid %s of build %s: %v.", buildInfoJSON, version, err)
+		return &buildInfo{}
+	}
+	return info
+}
+
+// buildCompleted return when build `version` completed on build server, from
+// build-info.json in the build folder, or modify time of the folder. False for builds
+// pulled from feed.
+func (b *BrBuilder) buildCompleted(version string) (time.Time, bool) {
+	if b.fromFeed() {
+		return time.Time{}, false
+	}
+	if info := b.readBuildInfo(version); !info.Completed.IsZero() {
+		return info.Completed, true
+	}
+	st, err := os.Stat(filepath.Join(b.BuildPath, buildDirPrefix+version))
+	if err != nil {
+		return time.Time{}, false
+	}
+	return st.ModTime(), true
+}
+
+// newLatency of build completed at `built` and available at `available`
+func (b *BrBuilder) newLatency(built, available time.Time) *Latency {
+	lat := &Latency{
+		Built:     timestamp(built.Local()),
+		Available: timestamp(available.Local()),
+		Minutes:   int(available.Sub(built) / time.Minute),
+	}
+	if lat.Minutes < 0 {
+		// clock of build server ahead
+		lat.Minutes = 0
+	}
+	lat.Violated = b.SLO > 0 && lat.Minutes > b.SLO
+	return lat
+}
+
+// recordLatency attach latency to build and append it to 000Admin/latency.txt
+func (b *BrBuilder) recordLatency(build *Build, built time.Time) {
+	available := now()
+	lat := b.newLatency(built, available)
+	b.mx.Lock()
+	build.Latency = lat
+	b.mx.Unlock()
+
+	fpath := b.branchFile(latencyTxt)
+	fd, err := os.OpenFile(fpath, os.O_WRONLY|os.O_CREATE|os.O_APPEND, 0644)
+	if err != nil {
+		log.Warn("[Branch] Open %s failed: %v.", fpath, err)
+		return
+	}
+	defer fd.Close()
+	fmt.Fprintf(fd, "%s,%d,%d\r\n", build.ID, built.Unix(), available.Unix())
+	if lat.Violated {
+		log.Warn("[Branch] Build %s of %s available %d minutes after built, over SLO %d minutes.",
+			build.Version, b.Name(), lat.Minutes, b.SLO)
+	}
+}
+
+// latencies read 000Admin/latency.txt, transaction ID => latency
+func (b *BrBuilder) latencies() map[string]*Latency {
+	lats := make(map[string]*Latency)
+	fd, err := os.Open(b.branchFile(latencyTxt))
+	if err != nil {
+		return lats
+	}
+	defer fd.Close()
+
+	scan := bufio.NewScanner(fd)
+	for scan.Scan() {
+		ss := strings.Split(strings.TrimSpace(scan.Text()), ",")
+		if len(ss) != 3 {
+			continue
+		}
+		built, err1 := strconv.ParseInt(ss[1], 10, 64)
+		available, err2 := strconv.ParseInt(ss[2], 10, 64)
+		if err1 != nil || err2 != nil {
+			continue
+		}
+		lats[ss[0]] = b.newLatency(time.Unix(built, 0), time.Unix(available, 0))
+	}
+	return lats
+}
+
+// SLOStatus summarize latency of builds ingested in [from, to), dates in TimeFormat.
+//
+func (b *BrBuilder) SLOStatus(from, to string) *SLOStatus {
+	st := &SLOStatus{Branch: b.Name(), SLO: b.SLO}
+	var minutes []int
+	b.ParseBuilds(context.Background(), func(build *Build) error {
+		if build.Latency == nil || build.Date < from || (to != "" && build.Date >= to) {
+			return nil
+		}
+		minutes = append(minutes, build.Latency.Minutes)
+		if build.Latency.Violated {
+			st.Violations++
+			st.Violated = append(st.Violated, build)
+		}
+		return nil
+	})
+	sort.Slice(st.Violated, func(i, j int) bool {
+		return st.Violated[i].Date > st.Violated[j].Date
+	})
+
+	st.Measured = len(minutes)
+	if st.Measured == 0 {
+		return st
+	}
+	sort.Ints(minutes)
+	st.P50 = minutes[(st.Measured-1)*50/100]
+	st.P95 = minutes[(st.Measured-1)*95/100]
+	st.Max = minutes[st.Measured-1]
+	return st
+}
+
+// SLOReport return latency of all branches (or the given branch) since `from`, branches
+// without SLO or measured builds are left out unless asked by name.
+//
+func (ss *sserver) SLOReport(branch string, from time.Time) []*SLOStatus {
+	var arr []*SLOStatus
+	ss.WalkBuilders(func(bu Builder) error {
+		if branch != "" && !strings.EqualFold(branch, bu.Name()) {
+			return nil
+		}
+		b, ok := bu.(*BrBuilder)
+		if !ok {
+			return nil
+		}
+		st := b.SLOStatus(timestamp(from), "")
+		if branch != "" || st.SLO > 0 || st.Measured > 0 {
+			arr = append(arr, st)
+		}
+		return nil
+	})
+	sort.Slice(arr, func(i, j int) bool {
+		if arr[i].Violations != arr[j].Violations {
+			return arr[i].Violations > arr[j].Violations
+		}
+		return arr[i].Branch < arr[j].Branch
+	})
+	return arr
+}
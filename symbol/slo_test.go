@@ -0,0 +1,68 @@
+package symbol
+
+import (
+	"fmt"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+)
+
+type fixedClock time.Time
+
+func (c fixedClock) Now() time.Time {
+	return time.Time(c)
+}
+
+func TestSLOStatus(t *testing.T) {
+	root, err := ioutil.TempDir("", "slo")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(root)
+	os.MkdirAll(filepath.Join(root, "store", adminDir), 0755)
+
+	b := NewBranch2(&Branch{
+		StoreName: "test",
+		BuildPath: root,
+		StorePath: filepath.Join(root, "store"),
+		SLO:       30,
+	}).(*BrBuilder)
+
+	// build-info.json first, then modify time of the build folder
+	built := time.Date(2017, 7, 4, 14, 0, 0, 0, time.UTC)
+	os.MkdirAll(filepath.Join(root, "Build538"), 0755)
+	ioutil.WriteFile(filepath.Join(root, "Build538", buildInfoJSON), []byte(`{"completed": "2017-07-04T14:00:00Z"}`), 0644)
+	os.MkdirAll(filepath.Join(root, "Build539"), 0755)
+	os.Chtimes(filepath.Join(root, "Build539"), built, built.Add(time.Hour))
+	if ts, ok := b.buildCompleted("538"); !ok || !ts.Equal(built) {
+		t.Errorf("expect completion from %s, got %v", buildInfoJSON, ts)
+	}
+	if ts, ok := b.buildCompleted("539"); !ok || !ts.Equal(built.Add(time.Hour)) {
+		t.Errorf("expect completion from folder mtime, got %v", ts)
+	}
+	if _, ok := b.buildCompleted("540"); ok {
+		t.Errorf("expect no completion of missing build")
+	}
+
+	defer func(c Clocker) { Clock = c }(Clock)
+	for i, minutes := range []int{10, 20, 45, 90} {
+		build := &Build{ID: fmt.Sprintf("%010d", i+1), Version: fmt.Sprint(538 + i), Date: "2017-07-05 00:00:00"}
+		b.addBuild(build)
+		Clock = fixedClock(built.Add(time.Duration(minutes) * time.Minute))
+		b.recordLatency(build, built)
+	}
+	lats := b.latencies()
+	if len(lats) != 4 || lats["0000000003"].Minutes != 45 || !lats["0000000003"].Violated || lats["0000000002"].Violated {
+		t.Fatalf("unexpected latencies %+v", lats)
+	}
+
+	st := b.SLOStatus("2017-07-01 00:00:00", "")
+	if st.Measured != 4 || st.Violations != 2 || st.P50 != 20 || st.Max != 90 || len(st.Violated) != 2 {
+		t.Errorf("unexpected slo status %+v", st)
+	}
+	if st = b.SLOStatus("2017-07-06 00:00:00", ""); st.Measured != 0 {
+		t.Errorf("expect no builds measured after 07-06, got %+v", st)
+	}
+}
@@ -0,0 +1,181 @@
+package symbol
+
+import (
+	"encoding/json"
+	"fmt"
+	"os"
+	"path/filepath"
+	"sync"
+	"time"
+
+	"github.com/adyzng/GoSymbols/config"
+	"github.com/adyzng/GoSymbols/fault"
+	log "gopkg.in/clog.v1"
+)
+
+const (
+	snapshotDir  = "000Snapshot"
+	snapshotJSON = "snapshot.json" // latest marker in config.Destination
+	maxHold      = time.Minute * 30
+)
+
+var (
+	// writeGate is hold shared by every store write, snapshot hold it exclusively.
+	writeGate sync.RWMutex
+
+	ErrSnapshotHeld = fmt.Errorf("snapshot already hold the store")
+)
+
+// beginWrite block while snapshot is taken, return the func to end write.
+func beginWrite() func() {
+	writeGate.RLock()
+	return writeGate.RUnlock
+}
+
+// SnapshotBranch is the consistent point of one branch
+//
+type SnapshotBranch struct {
+	Name      string `json:"name"`
+	StorePath string `json:"storePath"`
+	LastID    string `json:"lastID"` // last transaction no. in lastid.txt
+	Builds    int    `json:"builds"`
+}
+
+// SnapshotMarker is the point-in-time-consistent checkpoint of the whole store.
+// Since server.txt and transactions are append only, a backup is restored by dropping
+// the transactions newer than `LastID` of each branch.
+//
+type SnapshotMarker struct {
+	ID        string            `json:"id"`
+	Date      string            `json:"date"`
+	HoldUntil string            `json:"holdUntil,omitempty"` // writes are frozen until
+	Branches  []*SnapshotBranch `json:"branches"`
+}
+
+// snapshotHold keep the write gate during hold
+type snapshotHold struct {
+	mx      sync.Mutex
+	release chan struct{}
+}
+
+var hold snapshotHold
+
+// Snapshot quiesce all store writes, persist metadata and write an snapshot marker.
+// If `holdFor` > 0 writes stay frozen until `ReleaseSnapshot` or timeout, so volume level
+// backup can be taken, otherwise writes resume once the marker is written.
+//
+func (ss *sserver) Snapshot(holdFor time.Duration) (*SnapshotMarker, error) {
+	hold.mx.Lock()
+	defer hold.mx.Unlock()
+	if hold.release != nil {
+		return nil, ErrSnapshotHeld
+	}
+	if holdFor > maxHold {
+		holdFor = maxHold
+	}
+
+	start := time.Now()
+	writeGate.Lock()
+	log.Info("[SS] Store writes quiesced in %s.", time.Since(start))
+
+	marker, err := ss.writeMarker(holdFor)
+	if err != nil || holdFor <= 0 {
+		writeGate.Unlock()
+		return marker, err
+	}
+
+	release := make(chan struct{})
+	hold.release = release
+	go func() {
+		select {
+		case <-release:
+			// cleared by ReleaseSnapshot
+		case <-time.After(holdFor):
+			log.Warn("[SS] Snapshot %s hold timeout.", marker.ID)
+			hold.mx.Lock()
+			if hold.release == release {
+				hold.release = nil
+			}
+			hold.mx.Unlock()
+		}
+		writeGate.Unlock()
+		log.Info("[SS] Snapshot %s released, store writes resumed.", marker.ID)
+	}()
+	return marker, nil
+}
+
+// ReleaseSnapshot resume store writes frozen by `Snapshot`.
+//
+func (ss *sserver) ReleaseSnapshot() bool {
+	hold.mx.Lock()
+	defer hold.mx.Unlock()
+	if hold.release == nil {
+		return false
+	}
+	close(hold.release)
+	hold.release = nil
+	return true
+}
+
+// writeMarker must be called with write gate hold
+func (ss *sserver) writeMarker(holdFor time.Duration) (*SnapshotMarker, error) {
+	t := now()
+	marker := &SnapshotMarker{
+		ID:   t.Format("20060102-150405"),
+		Date: timestamp(t),
+	}
+	if holdFor > 0 {
+		marker.HoldUntil = timestamp(t.Add(holdFor))
+	}
+
+	ss.WalkBuilders(func(bu Builder) error {
+		br := bu.GetBranch()
+		sb := &SnapshotBranch{
+			Name:      bu.Name(),
+			StorePath: br.StorePath,
+			Builds:    br.BuildsCount,
+		}
+		if b, ok := bu.(*BrBuilder); ok {
+			sb.LastID = b.GetLatestID()
+			if err := b.Persist(); err != nil {
+				log.Warn("[SS] Persist branch %s failed: %v.", b.Name(), err)
+			}
+		}
+		marker.Branches = append(marker.Branches, sb)
+		return nil
+	})
+	if err := ss.SaveBranchs(""); err != nil {
+		log.Warn("[SS] Save branchs list failed: %v.", err)
+	}
+
+	data, err := json.MarshalIndent(marker, "", "\t")
+	if err != nil {
+		return nil, err
+	}
+	dir := filepath.Join(config.Destination, snapshotDir)
+	if err = os.MkdirAll(dir, 666); err != nil {
+		log.Error(2, "[SS] Create snapshot folder %s failed: %v.", dir, err)
+		return nil, err
+	}
+	for _, fpath := range []string{
+		filepath.Join(dir, marker.ID+".json"),
+		filepath.Join(config.Destination, snapshotJSON),
+	} {
+		if err = writeFileAtomic(fpath, data); err != nil {
+			log.Error(2, "[SS] Write snapshot marker %s failed: %v.", fpath, err)
+			return nil, err
+		}
+	}
+	log.Info("[SS] Snapshot %s of %d branches.", marker.ID, len(marker.Branches))
+	return marker, nil
+}
+
+// writeFileAtomic write to temp file then rename, so reader never see partial content.
+func writeFileAtomic(fpath string, data []byte) error {
+	tmp := fpath + ".tmp"
+	if err := fault.WriteFile(fault.Storage, tmp, data, 0644); err != nil {
+		os.Remove(tmp)
+		return err
+	}
+	return os.Rename(tmp, fpath)
+}
@@ -0,0 +1,54 @@
+package symbol
+
+import (
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/adyzng/GoSymbols/config"
+)
+
+func TestSnapshotHold(t *testing.T) {
+	root, err := ioutil.TempDir("", "snapshot")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(root)
+
+	config.Destination = root
+	config.AppPath = root
+	ss := &sserver{builders: make(map[string]Builder)}
+
+	marker, err := ss.Snapshot(time.Minute)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, err := os.Stat(filepath.Join(root, snapshotDir, marker.ID+".json")); err != nil {
+		t.Fatalf("marker not written: %v", err)
+	}
+	if _, err := ss.Snapshot(0); err != ErrSnapshotHeld {
+		t.Fatalf("expect snapshot held, got %v", err)
+	}
+
+	written := make(chan struct{})
+	go func() {
+		defer beginWrite()()
+		close(written)
+	}()
+	select {
+	case <-written:
+		t.Fatal("write should be blocked during snapshot hold")
+	case <-time.After(time.Millisecond * 50):
+	}
+
+	if !ss.ReleaseSnapshot() {
+		t.Fatal("release snapshot failed")
+	}
+	select {
+	case <-written:
+	case <-time.After(time.Second):
+		t.Fatal("write should resume after release")
+	}
+}
@@ -0,0 +1,143 @@
+package symbol
+
+import (
+	"context"
+	"fmt"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+
+	"github.com/adyzng/GoSymbols/config"
+	"github.com/adyzng/GoSymbols/pdb"
+	log "gopkg.in/clog.v1"
+)
+
+const (
+	// partTag is written into the transaction comment of split ingest, eg: `part:2/3`
+	partTag  = "part:"
+	splitDir = "000Split" // {n}/000Unzip/{path}, files of part n while a split ingest run
+)
+
+// parsePart return `{n}/{total}` recorded in transaction comment
+func parsePart(comment string) string {
+	idx := strings.Index(comment, partTag)
+	if idx == -1 {
+		return ""
+	}
+	part := comment[idx+len(partTag):]
+	if end := strings.IndexAny(part, " ,"); end != -1 {
+		part = part[:end]
+	}
+	return part
+}
+
+// splitParts move symbol files under `symPath` beyond `[ingest] SPLIT_FILES` into folders
+// of 000Split, so each is added by one symstore transaction. Return folders of all parts,
+// the first is `symPath` itself which keep the first files and everything else.
+//
+func (b *BrBuilder) splitParts(symPath string) ([]string, error) {
+	dirs := []string{symPath}
+	if config.SplitFiles <= 0 {
+		return dirs, nil
+	}
+	var files []string
+	filepath.Walk(symPath, func(fpath string, fi os.FileInfo, err error) error {
+		if err == nil && !fi.IsDir() && pdb.IsSymbolFile(fi.Name()) {
+			files = append(files, fpath)
+		}
+		return nil
+	})
+	if len(files) <= config.SplitFiles {
+		return dirs, nil
+	}
+	sort.Strings(files)
+
+	root := filepath.Join(b.StorePath, splitDir)
+	os.RemoveAll(root)
+	for i := config.SplitFiles; i < len(files); i++ {
+		n := i/config.SplitFiles + 1
+		// keep 000Unzip in the path, transaction records path relative to it
+		dir := filepath.Join(root, fmt.Sprint(n), unzipDir)
+		if n > len(dirs) {
+			dirs = append(dirs, dir)
+		}
+		rel, _ := filepath.Rel(symPath, files[i])
+		dst := filepath.Join(dir, rel)
+		if err := os.MkdirAll(filepath.Dir(dst), 0755); err != nil {
+			return nil, err
+		}
+		if err := os.Rename(files[i], dst); err != nil {
+			return nil, err
+		}
+	}
+	log.Info("[Branch] Split %d symbols of %s into %d transactions.", len(files), b.Name(), len(dirs))
+	return dirs, nil
+}
+
+// partNote return comment note of part `n` of `total`, empty if the ingest isn't split
+func partNote(parent string, n, total int) string {
+	if total <= 1 {
+		return ""
+	}
+	note := fmt.Sprintf("%s%d/%d", partTag, n, total)
+	if parent != "" {
+		note = supplementTag + parent + " " + note
+	}
+	return note
+}
+
+// resumable check if ingest of `build` failed or was interrupted, eg: a split ingest stopped
+// after some of its parts were added. Ingesting the version again resume it.
+func resumable(build *Build) bool {
+	return build.Status == StatusFailed || !build.Status.Done()
+}
+
+// publishParts add the rest parts of split ingest as supplementary transactions of `build`,
+// so they are one logical build. `dirs` are the folders of part 2 to the last, parts already
+// added by the failed ingest `build` resume are kept.
+//
+func (b *BrBuilder) publishParts(ctx context.Context, in *ingest, build *Build, dirs []string, renamed map[string]string) error {
+	stored := make(map[string]*Build)
+	b.mx.RLock()
+	for _, id := range build.Supplements {
+		if part, ok := b.builds[id]; ok && part.Part != "" {
+			stored[part.Part] = part
+		}
+	}
+	b.mx.RUnlock()
+
+	total := len(dirs) + 1
+	for i, dir := range dirs {
+		note := partNote(build.ID, i+2, total)
+		if part := stored[parsePart(note)]; part != nil {
+			in.add(part)
+			continue
+		}
+		part, err := b.addSymStore(ctx, build.Version, dir, note)
+		if err != nil {
+			log.Error(2, "[Branch] Add part %d/%d of %s failed: %v.", i+2, total, build.Version, err)
+			return err
+		}
+		part.SupplementOf = build.ID
+		part.Part = parsePart(part.Comment)
+		part.Channel = build.Channel
+		b.addBuild(part)
+		in.add(part)
+		b.encryptOrAlert(part.ID)
+		b.signOrWarn(signAdd, part.ID)
+		if err = b.recordRenames(part.ID, renamed); err != nil {
+			log.Warn("[Branch] Record renames of %s failed: %v.", part.ID, err)
+		}
+		if err = b.recordChecksums(part.ID); err != nil {
+			log.Warn("[Branch] Record checksums of %s failed: %v.", part.ID, err)
+		}
+		if _, err = b.recordSigning(part.ID, dir); err != nil {
+			log.Warn("[Branch] Record signature status of %s failed: %v.", part.ID, err)
+		}
+		if _, err = b.storeBreakpad(part.ID, dir); err != nil {
+			log.Warn("[Branch] Store breakpad symbols of %s failed: %v.", part.ID, err)
+		}
+	}
+	return nil
+}
@@ -0,0 +1,124 @@
+package symbol
+
+import (
+	"archive/zip"
+	"bytes"
+	"context"
+	"fmt"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/adyzng/GoSymbols/config"
+	"github.com/adyzng/GoSymbols/fault"
+)
+
+func TestSplitParts(t *testing.T) {
+	root, err := ioutil.TempDir("", "split")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(root)
+
+	symPath := filepath.Join(root, unzipDir)
+	os.MkdirAll(filepath.Join(symPath, "x64"), 0755)
+	for i := 0; i < 5; i++ {
+		ioutil.WriteFile(filepath.Join(symPath, "x64", fmt.Sprintf("f%d.pdb", i)), []byte("pdb"), 0644)
+	}
+	ioutil.WriteFile(filepath.Join(symPath, "readme.txt"), []byte("txt"), 0644)
+
+	limit := config.SplitFiles
+	defer func() { config.SplitFiles = limit }()
+	config.SplitFiles = 2
+
+	b := NewBranch2(&Branch{StoreName: "test", StorePath: root, BuildPath: root}).(*BrBuilder)
+	dirs, err := b.splitParts(symPath)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(dirs) != 3 || dirs[0] != symPath {
+		t.Fatalf("expect 3 parts, got %v", dirs)
+	}
+	for i, expect := range map[int][]string{0: {"f0.pdb", "f1.pdb"}, 1: {"f2.pdb", "f3.pdb"}, 2: {"f4.pdb"}} {
+		fs, _ := ioutil.ReadDir(filepath.Join(dirs[i], "x64"))
+		if len(fs) != len(expect) || fs[0].Name() != expect[0] {
+			t.Errorf("unexpected files of part %d: %v", i+1, fs)
+		}
+	}
+	if _, err := os.Stat(filepath.Join(symPath, "readme.txt")); err != nil {
+		t.Errorf("other files should stay in the first part: %v", err)
+	}
+
+	note := partNote("0000000007", 2, 3)
+	build := parseBuildLine(`0000000008,add,file,07/04/2017,14:44:14,"test","100","2017-07-04_14:44:14 ` + note + `",`)
+	if build == nil || build.SupplementOf != "0000000007" || build.Part != "2/3" {
+		t.Errorf("unexpected part build %+v", build)
+	}
+	if partNote("", 1, 1) != "" {
+		t.Errorf("ingest not split should have no note")
+	}
+}
+
+// failSymStore fail the `fail`th transaction added
+type failSymStore struct {
+	fail, calls int
+}
+
+func (f *failSymStore) Add(ctx context.Context, store, product, version, comment, symbols string) ([]byte, error) {
+	if f.calls++; f.calls == f.fail {
+		return nil, fault.ErrInjected
+	}
+	return nativeSymStore{}.Add(ctx, store, product, version, comment, symbols)
+}
+
+func TestResumeSplit(t *testing.T) {
+	root, err := ioutil.TempDir("", "split")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(root)
+	defer func(limit int, dir, latest string, s SymStorer) {
+		config.SplitFiles, config.UploadDir, config.LatestBuildFile, SymStore = limit, dir, latest, s
+	}(config.SplitFiles, config.UploadDir, config.LatestBuildFile, SymStore)
+	config.SplitFiles, config.UploadDir, config.LatestBuildFile = 1, filepath.Join(root, "uploads"), "latest.txt"
+
+	buf := &bytes.Buffer{}
+	zw := zip.NewWriter(buf)
+	for i, name := range []string{"a.dll", "b.dll", "c.dll"} {
+		w, _ := zw.Create("x64/" + name)
+		w.Write(fakePE(byte(i)))
+	}
+	zw.Close()
+
+	b := NewBranch2(&Branch{StoreName: "test", StorePath: filepath.Join(root, "store")}).(*BrBuilder)
+	os.MkdirAll(filepath.Join(b.StorePath, adminDir), 0755)
+	b.AppendUpload("100", 0, bytes.NewReader(buf.Bytes()))
+	if _, err = b.FinishUpload("100"); err != nil {
+		t.Fatal(err)
+	}
+
+	// the second part fail, the first part is left in the store
+	SymStore = &failSymStore{fail: 2}
+	if err = b.AddBuild(context.Background(), "100"); err != fault.ErrInjected {
+		t.Fatalf("expect injected failure, got %v", err)
+	}
+	build := b.getBuild("100", "")
+	if build == nil || build.Status != StatusFailed {
+		t.Fatalf("expect failed first part, got %+v", build)
+	}
+
+	// the retry add the rest parts to the same build
+	if err = b.AddBuild(context.Background(), "100"); err != nil {
+		t.Fatal(err)
+	}
+	if b.getBuild("100", "") != build || build.Status != StatusComplete || len(build.Supplements) != 2 {
+		t.Fatalf("expect build resumed with 2 parts, got %+v", build)
+	}
+	if id := b.GetLatestID(); id != "0000000003" {
+		t.Errorf("expect 3 transactions, got %s", id)
+	}
+	if err = b.AddBuild(context.Background(), "100"); err != nil || b.GetLatestID() != "0000000003" {
+		t.Errorf("complete build should not be added again (%v)", err)
+	}
+}
@@ -0,0 +1,111 @@
+package symbol
+
+import (
+	"bytes"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"strings"
+
+	"github.com/adyzng/GoSymbols/pdb"
+	"github.com/adyzng/GoSymbols/sourceindex"
+	log "gopkg.in/clog.v1"
+)
+
+var (
+	ErrNotPDB = fmt.Errorf("not a pdb")
+)
+
+// SourceList is the source files compiled into a stored pdb, translated to repository paths
+//
+type SourceList struct {
+	Branch  string                    `json:"branch"`
+	Name    string                    `json:"name"`
+	Hash    string                    `json:"hash"`
+	Version string                    `json:"version,omitempty"` // build the source server revision is taken from
+	Files   []*sourceindex.SourceFile `json:"files"`
+}
+
+// sourceConfig return source index config of the branch, `[srcsrv]` if it has none
+func (b *BrBuilder) sourceConfig() *sourceindex.Config {
+	if b.SourceIndex != nil {
+		return b.SourceIndex
+	}
+	return sourceindex.Default()
+}
+
+// indexSources embed srcsrv streams into pdbs of build `version` unzipped at `dir`, if the
+// branch or `[srcsrv]` configure a source server. Symbols are still published when it
+// fails, debuggers only miss the sources.
+func (b *BrBuilder) indexSources(version, dir string) {
+	cfg := b.sourceConfig()
+	if cfg == nil || cfg.URL == "" {
+		return
+	}
+	vars := map[string]string{
+		"branch":   b.StoreName,
+		"version":  version,
+		"revision": b.readBuildInfo(version).Revision,
+	}
+	res, err := sourceindex.Index(dir, cfg, vars)
+	if err != nil {
+		log.Warn("[Branch] Source index build %s of %s failed: %v.", version, b.Name(), err)
+		return
+	}
+	for _, failed := range res.Failed {
+		log.Warn("[Branch] Source index of build %s failed: %s.", version, failed)
+	}
+	log.Info("[Branch] Source index build %s of %s at revision %s: %d of %d pdbs, %d files.",
+		version, b.Name(), vars["revision"], res.Indexed, res.PDBs, res.Files)
+}
+
+// Sources list source files of stored pdb `hash`/`name` with the build paths translated
+// by the source index of the branch, and their url on the source server. The revision is
+// of build `version`, or the first build shipping the pdb, urls are left out if unknown.
+//
+func (b *BrBuilder) Sources(hash, name, version string) (*SourceList, error) {
+	if !strings.EqualFold(name[strings.LastIndex(name, ".")+1:], "pdb") {
+		return nil, ErrNotPDB
+	}
+	fd, _, err := b.OpenSymbol(b.GetSymbolPath(hash, name))
+	if err != nil {
+		return nil, err
+	}
+	defer fd.Close()
+	ra, ok := fd.(io.ReaderAt)
+	if !ok {
+		data, err := ioutil.ReadAll(fd)
+		if err != nil {
+			return nil, err
+		}
+		ra = bytes.NewReader(data)
+	}
+	sources, err := pdb.ReadSources(ra)
+	if err != nil {
+		return nil, err
+	}
+
+	list := &SourceList{Branch: b.Name(), Name: name, Hash: hash, Version: version}
+	if list.Version == "" {
+		if sp, _ := b.Shipment(name); sp != nil {
+			for _, build := range sp.Builds {
+				if strings.EqualFold(build.Hash, hash) {
+					list.Version = build.Version
+					break
+				}
+			}
+		}
+	}
+	cfg := sourceindex.Config{}
+	if c := b.sourceConfig(); c != nil {
+		cfg = *c
+	}
+	vars := map[string]string{"branch": b.StoreName, "version": list.Version}
+	if list.Version == "" {
+		cfg.URL = ""
+	} else {
+		vars["revision"] = b.readBuildInfo(list.Version).Revision
+	}
+	list.Files = cfg.Map(sources, vars)
+	return list, nil
+}
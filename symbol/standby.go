@@ -0,0 +1,92 @@
+package symbol
+
+import (
+	"context"
+	"fmt"
+	"path/filepath"
+	"strings"
+	"sync"
+
+	log "gopkg.in/clog.v1"
+)
+
+var (
+	ErrFenced    = fmt.Errorf("instance is standby or fenced, store is read-only")
+	ErrStorePath = fmt.Errorf("invalid path in store")
+)
+
+var (
+	fenceMx sync.RWMutex
+	fence   string // why stores of this instance are read-only, see SetFence
+)
+
+// fenced return why this instance must not write stores, empty if it may
+func fenced() string {
+	fenceMx.RLock()
+	defer fenceMx.RUnlock()
+	return fence
+}
+
+// SetFence make all stores of this instance read-only for `reason`, eg: it's the standby
+// of another instance, or it lost the primary role. Ingest is paused meanwhile. Empty
+// `reason` lift the fence.
+//
+func (ss *sserver) SetFence(reason string) {
+	fenceMx.Lock()
+	changed := fence != reason
+	fence = reason
+	fenceMx.Unlock()
+	if !changed {
+		return
+	}
+
+	if ss.queue != nil {
+		ss.queue.mx.Lock()
+		ss.queue.cond.Broadcast()
+		ss.queue.mx.Unlock()
+	}
+	if reason != "" {
+		log.Warn("[SS] Stores read-only: %s.", reason)
+	} else {
+		log.Info("[SS] Stores writable again.")
+	}
+}
+
+// Fenced return why stores of this instance are read-only, empty if writable.
+//
+func (ss *sserver) Fenced() string {
+	return fenced()
+}
+
+// StoreFile return full path of `rel` (slash separated, as listed by SyncManifest) in store,
+// ErrStorePath if it's outside of store.
+//
+func (b *BrBuilder) StoreFile(rel string) (string, error) {
+	rel = filepath.FromSlash(rel)
+	if rel == "" || filepath.IsAbs(rel) || filepath.VolumeName(rel) != "" {
+		return "", ErrStorePath
+	}
+	for _, seg := range strings.Split(filepath.ToSlash(rel), "/") {
+		if seg == "" || seg == "." || seg == ".." {
+			return "", ErrStorePath
+		}
+	}
+	return filepath.Join(b.StorePath, rel), nil
+}
+
+// Reload drop cached builds and checksums, and parse them again from store, eg: after
+// admin files are replicated from another instance.
+//
+func (b *BrBuilder) Reload() error {
+	b.sumMx.Lock()
+	b.sums = nil
+	b.sumMx.Unlock()
+
+	b.mx.Lock()
+	b.builds = make(map[string]*Build)
+	b.mx.Unlock()
+	transactions.purge(b.StoreName)
+	b.detectLayout()
+	_, err := b.ParseBuilds(context.Background(), nil)
+	return err
+}
@@ -0,0 +1,312 @@
+package symbol
+
+import (
+	"bufio"
+	"fmt"
+	"os"
+	"sort"
+	"strings"
+
+	"github.com/adyzng/GoSymbols/event"
+	log "gopkg.in/clog.v1"
+)
+
+// BuildStatus is the lifecycle state of a build
+//
+type BuildStatus string
+
+// Build lifecycle, a build may fail until it's complete:
+//
+//	pending => ingesting => verifying => complete => archived => deleted
+//	failed => deleted
+//
+const (
+	StatusPending   BuildStatus = "pending"   // queued, nothing copied yet
+	StatusIngesting BuildStatus = "ingesting" // copying, scanning and adding to symbol store
+	StatusVerifying BuildStatus = "verifying" // in store, recording checksums and signature status
+	StatusComplete  BuildStatus = "complete"
+	StatusFailed    BuildStatus = "failed"
+	StatusDeleted   BuildStatus = "deleted"  // purged from store
+	StatusArchived  BuildStatus = "archived" // served from a mounted archive
+)
+
+const (
+	statusTxt = "status.txt" // ingest lifecycle, `{date},{version},{status},{id|id},{message}`
+)
+
+var (
+	ErrInvalidTransition = fmt.Errorf("invalid build status transition")
+)
+
+var statusMoves = map[BuildStatus][]BuildStatus{
+	StatusPending:   {StatusIngesting, StatusFailed},
+	StatusIngesting: {StatusVerifying, StatusFailed},
+	StatusVerifying: {StatusComplete, StatusFailed},
+	StatusComplete:  {StatusArchived, StatusDeleted},
+	StatusFailed:    {StatusDeleted},
+	StatusArchived:  {StatusDeleted},
+}
+
+// CanMove check if the lifecycle allow moving from `s` to `to`.
+//
+func (s BuildStatus) CanMove(to BuildStatus) bool {
+	for _, st := range statusMoves[s] {
+		if st == to {
+			return true
+		}
+	}
+	return false
+}
+
+// Done check if no more ingest work happen in this status.
+//
+func (s BuildStatus) Done() bool {
+	return s != StatusPending && s != StatusIngesting && s != StatusVerifying
+}
+
+// IngestStatus is the latest lifecycle record of one build version
+//
+type IngestStatus struct {
+	Branch  string      `json:"branch"`
+	Version string      `json:"version"`
+	Status  BuildStatus `json:"status"`
+	IDs     []string    `json:"ids,omitempty"` // transactions added by the ingest
+	Date    string      `json:"date,omitempty"`
+	Message string      `json:"message,omitempty"`
+}
+
+// ingest track lifecycle of one ingest job, every transaction it adds share its status
+type ingest struct {
+	b       *BrBuilder
+	version string
+	status  BuildStatus
+	builds  []*Build
+}
+
+// startIngest begin the lifecycle of ingesting `version`, it's pending until moved.
+func (b *BrBuilder) startIngest(version string) *ingest {
+	return &ingest{b: b, version: version, status: StatusPending}
+}
+
+// move the ingest and its transactions to status `to`, and persist it.
+func (in *ingest) move(to BuildStatus, msg string) error {
+	if !in.status.CanMove(to) {
+		log.Warn("[Branch] Build %s of %s can't move from %s to %s.", in.version, in.b.Name(), in.status, to)
+		return ErrInvalidTransition
+	}
+	from := in.status
+	in.status = to
+	for _, build := range in.builds {
+		build.Status = to
+	}
+	if err := in.save(msg); err != nil {
+		return err
+	}
+	observeIngest(in, to)
+	switch {
+	case to == StatusComplete:
+		in.b.publish(event.KindIngestComplete, in.version, in.builds, "")
+	case to == StatusFailed && from == StatusVerifying:
+		in.b.publish(event.KindVerifyFailed, in.version, in.builds, msg)
+	}
+	return nil
+}
+
+// add attach transaction `build` to the ingest, it's persisted so an interrupted ingest
+// is never taken as complete.
+func (in *ingest) add(build *Build) {
+	build.Status = in.status
+	in.builds = append(in.builds, build)
+	if err := in.save(""); err != nil {
+		log.Warn("[Branch] Save status of %s failed: %v.", build.ID, err)
+	}
+}
+
+// finish fail the ingest if `err` is not nil and it's not done yet.
+func (in *ingest) finish(err error) {
+	if err != nil && !in.status.Done() {
+		in.move(StatusFailed, err.Error())
+	}
+}
+
+func (in *ingest) save(msg string) error {
+	ids := make([]string, 0, len(in.builds))
+	for _, build := range in.builds {
+		ids = append(ids, build.ID)
+	}
+	return in.b.appendStatus(in.version, in.status, ids, msg)
+}
+
+// appendStatus append one lifecycle record to 000Admin/status.txt
+func (b *BrBuilder) appendStatus(version string, status BuildStatus, ids []string, msg string) error {
+	msg = strings.NewReplacer("\r", " ", "\n", " ").Replace(msg)
+	fd, err := os.OpenFile(b.branchFile(statusTxt), os.O_WRONLY|os.O_CREATE|os.O_APPEND, 0644)
+	if err != nil {
+		return err
+	}
+	defer fd.Close()
+	_, err = fmt.Fprintf(fd, "%s,%s,%s,%s,%s\r\n", timestamp(now()), version, status, strings.Join(ids, "|"), msg)
+	return err
+}
+
+// statusRecords read 000Admin/status.txt, oldest first
+func (b *BrBuilder) statusRecords() []*IngestStatus {
+	fd, err := os.Open(b.branchFile(statusTxt))
+	if err != nil {
+		return nil
+	}
+	defer fd.Close()
+
+	var arr []*IngestStatus
+	scan := bufio.NewScanner(fd)
+	for scan.Scan() {
+		ss := strings.SplitN(strings.TrimSpace(scan.Text()), ",", 5)
+		if len(ss) != 5 {
+			continue
+		}
+		st := &IngestStatus{
+			Branch:  b.Name(),
+			Date:    ss[0],
+			Version: ss[1],
+			Status:  BuildStatus(ss[2]),
+			Message: ss[4],
+		}
+		if ss[3] != "" {
+			st.IDs = strings.Split(ss[3], "|")
+		}
+		arr = append(arr, st)
+	}
+	return arr
+}
+
+// buildStatuses return the latest status of each transaction
+func (b *BrBuilder) buildStatuses() map[string]BuildStatus {
+	statuses := make(map[string]BuildStatus)
+	for _, st := range b.statusRecords() {
+		for _, id := range st.IDs {
+			statuses[id] = st.Status
+		}
+	}
+	return statuses
+}
+
+// statusOf return status of transaction `id`. Transactions without record are added before
+// the lifecycle is tracked, and are complete.
+func (b *BrBuilder) statusOf(statuses map[string]BuildStatus, id string) BuildStatus {
+	st, ok := statuses[id]
+	if !ok {
+		st = StatusComplete
+	}
+	if b.Archive != "" && st == StatusComplete {
+		st = StatusArchived
+	}
+	return st
+}
+
+// markDeleted record transactions of `builds` emptied by purge or pruned by retention as
+// deleted with `message`, the ones not allowed to be deleted are warned and skipped.
+func (b *BrBuilder) markDeleted(builds []*Build, message string) error {
+	statuses := b.buildStatuses()
+	versions := make(map[string][]string)
+	var deleted []*Build
+	for _, build := range builds {
+		if st := b.statusOf(statuses, build.ID); !st.CanMove(StatusDeleted) {
+			log.Warn("[Branch] Build %s of %s can't move from %s to %s.", build.ID, b.Name(), st, StatusDeleted)
+			continue
+		}
+		versions[build.Version] = append(versions[build.Version], build.ID)
+		deleted = append(deleted, build)
+	}
+	for version, ids := range versions {
+		sort.Strings(ids)
+		if err := b.appendStatus(version, StatusDeleted, ids, message); err != nil {
+			return err
+		}
+	}
+	for _, build := range deleted {
+		b.publish(event.KindBuildDeleted, build.Version, []*Build{build}, message)
+	}
+	return nil
+}
+
+// publish journal store event `kind` of transactions `builds` for the event buses, the first
+// one is the build and others are its supplements or parts.
+func (b *BrBuilder) publish(kind, version string, builds []*Build, msg string) {
+	e := &event.Event{
+		Time:    timestamp(now()),
+		Kind:    kind,
+		Branch:  b.Name(),
+		Version: version,
+		Message: msg,
+	}
+	if len(builds) > 0 {
+		e.Build, e.Tickets = builds[0].ID, builds[0].Tickets
+	}
+	if err := event.Publish(e); err != nil && err != event.ErrDisabled {
+		log.Warn("[Branch] Publish %s event of %s failed: %v.", kind, b.Name(), err)
+	}
+}
+
+// IngestStatus return the latest lifecycle record of each build version, newest first.
+//
+func (b *BrBuilder) IngestStatus() []*IngestStatus {
+	latest := make(map[string]*IngestStatus)
+	for _, st := range b.statusRecords() {
+		latest[st.Version] = st
+	}
+	arr := make([]*IngestStatus, 0, len(latest))
+	for _, st := range latest {
+		arr = append(arr, st)
+	}
+	sort.SliceStable(arr, func(i, j int) bool {
+		return arr[i].Date > arr[j].Date
+	})
+	return arr
+}
+
+// IngestStatus return lifecycle of builds of all branches (or the given branch) filtered
+// by `status` if not empty, queued jobs first and then the newest.
+//
+func (ss *sserver) IngestStatus(branch string, status BuildStatus) []*IngestStatus {
+	arr := make([]*IngestStatus, 0)
+	if status == "" || status == StatusPending {
+		paused, frozen, fence := ss.queue.Paused(), inCutover() != nil, fenced()
+		for _, job := range ss.queue.Jobs() {
+			if branch != "" && !strings.EqualFold(branch, job.builder.Name()) {
+				continue
+			}
+			version := job.version
+			if version == "" {
+				version = "latest"
+			}
+			st := &IngestStatus{Branch: job.builder.Name(), Version: version, Status: StatusPending}
+			if fence != "" {
+				st.Message = "paused, " + fence
+			} else if frozen {
+				st.Message = "paused, stores are being relocated"
+			} else if paused != "" {
+				st.Message = "paused, store " + paused + " is read-only"
+			}
+			arr = append(arr, st)
+		}
+	}
+
+	var records []*IngestStatus
+	ss.WalkBuilders(func(bu Builder) error {
+		if branch != "" && !strings.EqualFold(branch, bu.Name()) {
+			return nil
+		}
+		if b, ok := bu.(*BrBuilder); ok {
+			for _, st := range b.IngestStatus() {
+				if status == "" || st.Status == status {
+					records = append(records, st)
+				}
+			}
+		}
+		return nil
+	})
+	sort.SliceStable(records, func(i, j int) bool {
+		return records[i].Date > records[j].Date
+	})
+	return append(arr, records...)
+}
@@ -0,0 +1,66 @@
+package symbol
+
+import (
+	"context"
+	"fmt"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+func TestBuildStatus(t *testing.T) {
+	root, err := ioutil.TempDir("", "status")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(root)
+	os.MkdirAll(filepath.Join(root, adminDir), 0755)
+	ioutil.WriteFile(filepath.Join(root, adminDir, serverTxt), []byte(
+		`0000000001,add,file,07/04/2017,14:44:14,"test","100","2017-07-04_14:44:14",`+"\r\n"+
+			`0000000002,add,file,07/05/2017,14:44:14,"test","101","2017-07-05_14:44:14",`+"\r\n"), 0644)
+
+	b := NewBranch2(&Branch{StoreName: "test", StorePath: root, BuildPath: root}).(*BrBuilder)
+	ok := b.startIngest("101")
+	if err = ok.move(StatusVerifying, ""); err != ErrInvalidTransition {
+		t.Errorf("pending can't skip ingesting, got %v", err)
+	}
+	ok.move(StatusIngesting, "")
+	ok.add(&Build{ID: "0000000002", Version: "101"})
+	ok.move(StatusVerifying, "")
+
+	bad := b.startIngest("102")
+	bad.move(StatusIngesting, "")
+	bad.finish(fmt.Errorf("copy failed"))
+	bad.finish(fmt.Errorf("twice"))
+
+	statuses := make(map[string]BuildStatus)
+	b.ParseBuilds(context.Background(), func(build *Build) error {
+		statuses[build.ID] = build.Status
+		return nil
+	})
+	if statuses["0000000001"] != StatusComplete || statuses["0000000002"] != StatusVerifying {
+		t.Errorf("interrupted ingest should stay verifying, got %v", statuses)
+	}
+
+	ok.move(StatusComplete, "")
+	if err = b.markDeleted([]*Build{{ID: "0000000001", Version: "100"}}, "purged"); err != nil {
+		t.Fatal(err)
+	}
+	expect := map[string]BuildStatus{"100": StatusDeleted, "101": StatusComplete, "102": StatusFailed}
+	arr := b.IngestStatus()
+	if len(arr) != len(expect) {
+		t.Fatalf("expect %d versions, got %d", len(expect), len(arr))
+	}
+	for _, st := range arr {
+		if st.Status != expect[st.Version] {
+			t.Errorf("expect %s of %s, got %s", expect[st.Version], st.Version, st.Status)
+		}
+		if st.Version == "102" && st.Message != "copy failed" {
+			t.Errorf("unexpected failure message %q", st.Message)
+		}
+	}
+	if StatusDeleted.CanMove(StatusComplete) || !StatusFailed.CanMove(StatusDeleted) {
+		t.Errorf("unexpected transitions")
+	}
+}
@@ -0,0 +1,64 @@
+package symbol
+
+import (
+	"archive/zip"
+	"io"
+	"io/fs"
+	"os"
+	"strings"
+
+	"github.com/adyzng/GoSymbols/fault"
+)
+
+// StoreFS return the filesystem the store of branch is read from, rooted at the store
+// folder. It is the store folder itself unless another one is set by `SetFS`. Storage
+// faults are injected to it, see package fault.
+//
+func (b *BrBuilder) StoreFS() fs.FS {
+	if b.fsys != nil {
+		return fault.FS(fault.Storage, b.fsys)
+	}
+	return fault.FS(fault.Storage, os.DirFS(b.StorePath))
+}
+
+// SetFS read the store from `fsys` instead of the store folder, such as a zip archive,
+// testdata fixtures or a remote backed filesystem. Nil restore the store folder.
+// Only read paths use it, writes always go to the store folder.
+//
+func (b *BrBuilder) SetFS(fsys fs.FS) {
+	b.fsys = fsys
+}
+
+// adminName return slash separated name of admin file in store filesystem
+func adminName(name string) string {
+	return adminDir + "/" + name
+}
+
+// foldFS serve the files of a zip archive by lower case path relative to the store,
+// the same store may be zipped with different case than symstore.exe written it.
+type foldFS map[string]*zip.File
+
+// zipEntry is an opened file of foldFS
+type zipEntry struct {
+	io.ReadCloser
+	f *zip.File
+}
+
+func (e *zipEntry) Stat() (fs.FileInfo, error) {
+	return e.f.FileInfo(), nil
+}
+
+func (z foldFS) Open(name string) (fs.File, error) {
+	if !fs.ValidPath(name) {
+		return nil, &fs.PathError{Op: "open", Path: name, Err: fs.ErrInvalid}
+	}
+	f, ok := z[strings.ToLower(name)]
+	if !ok {
+		return nil, &fs.PathError{Op: "open", Path: name, Err: fs.ErrNotExist}
+	}
+	rc, err := f.Open()
+	if err != nil {
+		return nil, &fs.PathError{Op: "open", Path: name, Err: err}
+	}
+	return &zipEntry{ReadCloser: rc, f: f}, nil
+}
@@ -0,0 +1,46 @@
+package symbol
+
+import (
+	"context"
+	"io/ioutil"
+	"os"
+	"testing"
+	"testing/fstest"
+)
+
+func TestStoreFS(t *testing.T) {
+	root, err := ioutil.TempDir("", "storefs")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(root)
+
+	b := NewBranch2(&Branch{StoreName: "UDPv5", StorePath: root}).(*BrBuilder)
+	b.SetFS(fstest.MapFS{
+		"000Admin/lastid.txt": {Data: []byte("0000000002\r\n")},
+		"000Admin/server.txt": {Data: []byte("0000000001,add,file,07/04/2017,14:44:14,\"UDPv5\",\"100\",\"\",\r\n" +
+			"0000000002,add,file,07/05/2017,14:44:14,\"UDPv5\",\"101\",\"\",\r\n")},
+		"000Admin/0000000001": {Data: []byte("\"foo.pdb\\AAAA1\",\"S:\\000Unzip\\x64\\foo.pdb\"\r\n")},
+		"000Admin/0000000002": {Data: []byte("\"foo.pdb\\BBBB1\",\"S:\\000Unzip\\x64\\foo.pdb\"\r\n" +
+			"\"bar.exe\\CCCC1\",\"S:\\000Unzip\\x64\\bar.exe\"\r\n")},
+	})
+
+	if total, err := b.ParseBuilds(context.Background(), nil); err != nil || total != 2 {
+		t.Fatalf("expect 2 builds, got %d (%v)", total, err)
+	}
+	if b.LatestBuild != "101" || b.GetLatestID() != "0000000002" {
+		t.Errorf("unexpected latest build %s, id %s", b.LatestBuild, b.GetLatestID())
+	}
+	if total, err := b.ParseSymbols("0000000002", nil); err != nil || total != 2 {
+		t.Errorf("expect 2 symbols, got %d (%v)", total, err)
+	}
+	if keys, err := b.transactionKeys("0000000001"); err != nil || len(keys) != 1 || keys[0] != "foo.pdb\\AAAA1" {
+		t.Errorf("unexpected keys %v (%v)", keys, err)
+	}
+
+	// the store folder is empty
+	b.SetFS(nil)
+	if _, err := b.transactionKeys("0000000001"); !os.IsNotExist(err) {
+		t.Errorf("expect not exist from store folder, got %v", err)
+	}
+}
@@ -0,0 +1,79 @@
+package symbol
+
+import (
+	"sort"
+	"strings"
+
+	log "gopkg.in/clog.v1"
+)
+
+// supersedeKey identify the same pdb across transactions of one build
+func supersedeKey(sym *Symbol) string {
+	return strings.ToLower(sym.Name) + "|" + strings.ToLower(sym.Path)
+}
+
+// symbolChain parse the build and all its supplementary transactions in order,
+// symbols re-published by later transactions are marked superseded.
+//
+func (b *BrBuilder) symbolChain(build *Build) ([]*Symbol, error) {
+	txs := []*Build{build}
+	for _, id := range build.Supplements {
+		if sup := b.getBuild("", id); sup != nil {
+			txs = append(txs, sup)
+		}
+	}
+	return b.parseChain(txs)
+}
+
+// parseChain parse the transactions of one build, first is the build itself
+// and the rest are its supplements.
+func (b *BrBuilder) parseChain(txs []*Build) ([]*Symbol, error) {
+	sort.SliceStable(txs[1:], func(i, j int) bool {
+		return txs[1+i].ID < txs[1+j].ID
+	})
+
+	var (
+		all    []*Symbol
+		latest = make(map[string]*Symbol)
+	)
+	for _, tx := range txs {
+		_, err := b.parseTransaction(tx, func(sym *Symbol) error {
+			key := supersedeKey(sym)
+			if old, ok := latest[key]; ok {
+				old.SupersededBy = tx.ID
+				old.ReplacedAt = tx.Date
+				log.Trace("[Branch] Symbol %s %s superseded by %s (%s).",
+					old.Name, old.Hash, sym.Hash, tx.ID)
+			}
+			latest[key] = sym
+			all = append(all, sym)
+			return nil
+		})
+		if err != nil {
+			return all, err
+		}
+	}
+	return all, nil
+}
+
+// SymbolHistory return all symbols ever published for given build, include the superseded ones.
+//
+func (b *BrBuilder) SymbolHistory(buildID string) ([]*Symbol, error) {
+	build := b.getBuild("", buildID)
+	if build == nil {
+		return nil, ErrBuildNotExist
+	}
+	if build.SupplementOf != "" {
+		if parent := b.getBuild("", build.SupplementOf); parent != nil {
+			build = parent
+		}
+	}
+	return b.symbolChain(build)
+}
+
+// Reingest re-publish all pdbs of an exist build, the new files supersede the old ones.
+//
+func (b *BrBuilder) Reingest(version string) (*Build, error) {
+	log.Info("[Branch] Force re-ingest build %s of %s.", version, b.Name())
+	return b.AddSupplement(version, []string{"*"})
+}
@@ -0,0 +1,48 @@
+package symbol
+
+import (
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+func TestSymbolChain(t *testing.T) {
+	root, err := ioutil.TempDir("", "supersede")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(root)
+
+	admin := filepath.Join(root, adminDir)
+	os.MkdirAll(admin, 0755)
+	ioutil.WriteFile(filepath.Join(admin, "0000000001"), []byte(
+		"\"foo.pdb\\AAAA1\",\"S:\\000Unzip\\x64\\foo.pdb\"\r\n"+
+			"\"bar.pdb\\BBBB1\",\"S:\\000Unzip\\x64\\bar.pdb\"\r\n"), 0644)
+	ioutil.WriteFile(filepath.Join(admin, "0000000002"), []byte(
+		"\"foo.pdb\\AAAA2\",\"S:\\000Unzip\\x64\\foo.pdb\"\r\n"), 0644)
+
+	b := NewBranch2(&Branch{StoreName: "test", StorePath: root, BuildPath: root}).(*BrBuilder)
+	b.addBuild(&Build{ID: "0000000001", Version: "100"})
+	b.addBuild(&Build{ID: "0000000002", Version: "100", SupplementOf: "0000000001", Date: "2017-10-22 05:16:24"})
+
+	current := make(map[string]string)
+	total, err := b.ParseSymbols("0000000001", func(sym *Symbol) error {
+		current[sym.Name] = sym.Hash
+		return nil
+	})
+	if err != nil || total != 2 {
+		t.Fatalf("expect 2 symbols, got %d (%v)", total, err)
+	}
+	if current["foo.pdb"] != "AAAA2" || current["bar.pdb"] != "BBBB1" {
+		t.Fatalf("unexpected current symbols %v", current)
+	}
+
+	history, err := b.SymbolHistory("0000000002")
+	if err != nil || len(history) != 3 {
+		t.Fatalf("expect 3 history symbols, got %d (%v)", len(history), err)
+	}
+	if history[0].Hash != "AAAA1" || history[0].SupersededBy != "0000000002" {
+		t.Fatalf("expect foo.pdb AAAA1 superseded, got %+v", history[0])
+	}
+}
@@ -0,0 +1,189 @@
+package symbol
+
+import (
+	"context"
+	"fmt"
+	"os"
+	"path"
+	"path/filepath"
+	"strings"
+
+	"github.com/adyzng/GoSymbols/util"
+	log "gopkg.in/clog.v1"
+)
+
+const (
+	// supplementTag is written into the transaction comment, eg: `supplement:0000000012`
+	supplementTag = "supplement:"
+)
+
+var (
+	ErrNoSymbolMatched = fmt.Errorf("no symbol matched")
+)
+
+// parseSupplement return the parent build ID recorded in transaction comment
+func parseSupplement(comment string) string {
+	idx := strings.Index(comment, supplementTag)
+	if idx == -1 {
+		return ""
+	}
+	id := comment[idx+len(supplementTag):]
+	if end := strings.IndexAny(id, " ,"); end != -1 {
+		id = id[:end]
+	}
+	return id
+}
+
+// fileMatcher return filter that match file in zip with any of the patterns.
+// Pattern with path separator match the full path, otherwise the base name. Case insensitive.
+//
+func fileMatcher(patterns []string) func(name string) bool {
+	lower := make([]string, 0, len(patterns))
+	for _, p := range patterns {
+		if p = strings.TrimSpace(p); p != "" {
+			lower = append(lower, strings.ToLower(strings.Replace(p, "\\", "/", -1)))
+		}
+	}
+	return func(name string) bool {
+		name = strings.ToLower(strings.Replace(name, "\\", "/", -1))
+		base := path.Base(name)
+		for _, p := range lower {
+			target := base
+			if strings.Contains(p, "/") {
+				target = strings.TrimPrefix(name, "/")
+				p = strings.TrimPrefix(p, "/")
+			}
+			if ok, _ := path.Match(p, target); ok {
+				return true
+			}
+		}
+		return false
+	}
+}
+
+// AddSupplement add only the pdbs matching `files` (name list or glob) from the debug zip of
+// an exist build, as an supplementary transaction of that build.
+//
+func (b *BrBuilder) AddSupplement(version string, files []string) (_ *Build, err error) {
+	b.ingMx.Lock()
+	defer b.ingMx.Unlock()
+	if err := b.writable(); err != nil {
+		return nil, err
+	}
+
+	parent := b.getBuild(version, "")
+	if parent == nil {
+		log.Warn("[Branch] Supplement build %s not exist in %s.", version, b.Name())
+		return nil, ErrBuildNotExist
+	}
+	if len(files) == 0 {
+		return nil, ErrNoSymbolMatched
+	}
+
+	in := b.startIngest(version)
+	defer func() { in.finish(err) }()
+	if err = in.move(StatusIngesting, ""); err != nil {
+		return nil, err
+	}
+
+	b.symPath = filepath.Join(b.StorePath, unzipDir)
+	if err = os.MkdirAll(b.symPath, 0755); err != nil {
+		log.Error(2, "[Branch] Create symbol path %s failed with %v.", b.symPath, err)
+		return nil, err
+	}
+	defer os.RemoveAll(b.symPath)
+
+	clock := newStageClock()
+	symbolZip, err := b.getSymbols(context.Background(), version)
+	if err != nil {
+		log.Error(2, "[Branch] Get symbols failed: %v.", err)
+		return nil, err
+	}
+	clock.lap(&clock.timing.Copy)
+	if fi, err := os.Stat(symbolZip); err == nil {
+		clock.timing.Bytes = fi.Size()
+	}
+
+	matched := 0
+	match := fileMatcher(files)
+	err = util.UnzipFilter(symbolZip, b.symPath, func(name string) bool {
+		if match(name) {
+			matched++
+			return true
+		}
+		return false
+	})
+	os.Remove(symbolZip)
+	if err != nil {
+		log.Error(2, "[Branch] Unzip symbols failed: %v.", err)
+		return nil, err
+	}
+	if matched == 0 {
+		log.Warn("[Branch] No symbol matched %v in build %s.", files, version)
+		return nil, ErrNoSymbolMatched
+	}
+	renamed, err := b.applyRenames(b.symPath)
+	if err != nil {
+		log.Error(2, "[Branch] Rename symbols failed: %v.", err)
+		return nil, err
+	}
+	if err = b.scanFiles(version, b.symPath); err != nil {
+		return nil, err
+	}
+	validation, err := b.checkSymbols(version, b.symPath)
+	if err != nil {
+		return nil, err
+	}
+	clock.lap(&clock.timing.Unzip)
+
+	defer beginWrite()()
+	if err = b.checkConflicts(version, b.symPath); err != nil {
+		log.Error(2, "[Branch] Check symbol conflict failed: %v.", err)
+		return nil, err
+	}
+
+	log.Info("[Branch] Supplement %d symbols to build %s (%s).", matched, version, parent.ID)
+	build, err := b.addSymStore(context.Background(), version, b.symPath, supplementTag+parent.ID)
+	if err != nil {
+		log.Error(2, "[Branch] Add to symbol store failed with %v.", err)
+		return nil, err
+	}
+	clock.lap(&clock.timing.SymStore)
+
+	build.SupplementOf = parent.ID
+	build.Channel = parent.Channel
+	b.addBuild(build)
+	in.add(build)
+	if err = in.move(StatusVerifying, ""); err != nil {
+		return nil, err
+	}
+	b.encryptOrAlert(build.ID)
+	b.signOrWarn(signAdd, build.ID)
+	if err = b.recordRenames(build.ID, renamed); err != nil {
+		log.Warn("[Branch] Record renames of %s failed: %v.", build.ID, err)
+	}
+	if err = b.recordValidation(build, validation); err != nil {
+		log.Warn("[Branch] Record validation of %s failed: %v.", build.ID, err)
+	}
+	if err = b.recordChecksums(build.ID); err != nil {
+		log.Warn("[Branch] Record checksums of %s failed: %v.", build.ID, err)
+	}
+	if _, err = b.recordSigning(build.ID, b.symPath); err != nil {
+		log.Warn("[Branch] Record signature status of %s failed: %v.", build.ID, err)
+	}
+	if _, err = b.storeBreakpad(build.ID, b.symPath); err != nil {
+		log.Warn("[Branch] Store breakpad symbols of %s failed: %v.", build.ID, err)
+	}
+	if parent.Release {
+		b.checkRelease(parent)
+	}
+	if err = b.pushOrAlert(build.ID); err != nil {
+		return nil, err
+	}
+	clock.lap(&clock.timing.Metadata)
+	b.recordTimings(build, clock.done())
+	if err = in.move(StatusComplete, ""); err != nil {
+		return nil, err
+	}
+	return build, nil
+}
@@ -0,0 +1,28 @@
+package symbol
+
+import "testing"
+
+func TestFileMatcher(t *testing.T) {
+	match := fileMatcher([]string{"ca_*.pdb", "x64\\Native\\foo.pdb"})
+	cases := map[string]bool{
+		"D2D/Native/ca_agent.pdb": true,
+		"CA_Client.PDB":           true,
+		"x64/Native/foo.pdb":      true,
+		"x86/Native/foo.pdb":      false,
+		"bar.pdb":                 false,
+	}
+	for name, expect := range cases {
+		if match(name) != expect {
+			t.Errorf("match %s: expect %v", name, expect)
+		}
+	}
+}
+
+func TestParseSupplement(t *testing.T) {
+	if id := parseSupplement("2017-10-22_05:16:23 supplement:0000000012"); id != "0000000012" {
+		t.Errorf("unexpected parent id %q", id)
+	}
+	if id := parseSupplement("2017-10-22_05:16:23"); id != "" {
+		t.Errorf("unexpected parent id %q", id)
+	}
+}
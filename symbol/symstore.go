@@ -0,0 +1,144 @@
+package symbol
+
+import (
+	"bytes"
+	"context"
+	"fmt"
+	"os/exec"
+	"strings"
+	"sync"
+
+	"github.com/adyzng/GoSymbols/config"
+	"github.com/adyzng/GoSymbols/fault"
+	log "gopkg.in/clog.v1"
+)
+
+// SymStorer add all symbol files under `symbols` to `store` as one transaction,
+// the same as `symstore.exe add /r`. The new transaction ID is written to lastid.txt.
+// It stop when `ctx` is done, symstore.exe is killed.
+//
+type SymStorer interface {
+	Add(ctx context.Context, store, product, version, comment, symbols string) ([]byte, error)
+}
+
+// SymStore is used by all branches to add transactions, it call symstore.exe or write the
+// store natively depend on `[base] SYMSTORE_EXE`. Tests replace it with the fake one in
+// package symtest to run the ingest pipeline without symstore.exe.
+//
+var SymStore SymStorer = autoSymStore{}
+
+// faultSymStore inject faults of symstore and storage targets before the transaction is
+// added by the wrapped SymStorer, see package fault.
+type faultSymStore struct {
+	SymStorer
+}
+
+func (f faultSymStore) Add(ctx context.Context, store, product, version, comment, symbols string) ([]byte, error) {
+	if err := fault.Check(fault.SymStore); err != nil {
+		return nil, err
+	}
+	if err := fault.Check(fault.Storage); err != nil {
+		return nil, err
+	}
+	return f.SymStorer.Add(ctx, store, product, version, comment, symbols)
+}
+
+// execSymStore call config.SymStoreExe
+type execSymStore struct{}
+
+func (execSymStore) Add(ctx context.Context, store, product, version, comment, symbols string) ([]byte, error) {
+	/*
+		"C:\Program Files (x86)\Windows Kits\8.1\Debuggers\x86\symstore.exe"
+			add
+			/r
+			/l
+			/f \\rmdm-bldvm-l902\CurrentRelease\UDP\UDPMAIN\Intermediate\B%BUILD_NUMBER%\debug\*.pdb
+			/s S:\SymbolServer\Titanium
+			/t Titanium
+			/v %BUILD_NUMBER%
+			/c %date:~-10%_%time:~0,8%
+	*/
+	args := []string{"add", "/r",
+		"/f", symbols,
+		"/s", store,
+		"/t", product,
+		"/v", version,
+		"/c", comment}
+	if config.Compress {
+		args = append(args, "/compress")
+	}
+	cmd := exec.CommandContext(ctx, config.SymStoreExe, args...)
+	defer acquireSymStore()()
+	return runNice(cmd)
+}
+
+var (
+	symstoreOnce sync.Once
+	symstoreSem  chan struct{} // nil for unlimited
+)
+
+// acquireSymStore wait for one of `[ingest] SYMSTORE_PROCS` slots, return the release func
+func acquireSymStore() func() {
+	symstoreOnce.Do(func() {
+		if config.SymStoreProcs > 0 {
+			symstoreSem = make(chan struct{}, config.SymStoreProcs)
+		}
+	})
+	if symstoreSem == nil {
+		return func() {}
+	}
+	select {
+	case symstoreSem <- struct{}{}:
+	default:
+		log.Trace("[Branch] Wait for symstore.exe slot, %d running.", cap(symstoreSem))
+		symstoreSem <- struct{}{}
+	}
+	return func() { <-symstoreSem }
+}
+
+// runNice run `cmd` at `[ingest] SYMSTORE_PRIORITY`, so ingest bursts don't starve
+// interactive sessions on the server. Return combined output.
+func runNice(cmd *exec.Cmd) ([]byte, error) {
+	var out bytes.Buffer
+	cmd.Stdout, cmd.Stderr = &out, &out
+	setPriority(cmd)
+	if err := cmd.Start(); err != nil {
+		return nil, err
+	}
+	lowerIO(cmd.Process)
+	err := cmd.Wait()
+	return out.Bytes(), err
+}
+
+// Compressor compress file `src` to cab file `dst`, the same as `symstore.exe add /compress`.
+//
+type Compressor interface {
+	Compress(src, dst string) error
+}
+
+// SymCompressor is used by the recompression migration and the native writer with
+// `[ingest] COMPRESS`, it call makecab.exe or write MSZIP cab files natively depend on
+// `[ingest] MAKECAB_EXE`. Tests replace it with a fake one.
+//
+var SymCompressor Compressor = autoCompressor{}
+
+// autoCompressor call makecab.exe if configured, or nativeCab
+type autoCompressor struct{}
+
+func (autoCompressor) Compress(src, dst string) error {
+	if config.MakeCabExe == "" || strings.EqualFold(config.MakeCabExe, "native") {
+		return nativeCab{}.Compress(src, dst)
+	}
+	return execMakeCab{}.Compress(src, dst)
+}
+
+// execMakeCab call config.MakeCabExe
+type execMakeCab struct{}
+
+func (execMakeCab) Compress(src, dst string) error {
+	output, err := runNice(exec.Command(config.MakeCabExe, src, dst))
+	if err != nil {
+		return fmt.Errorf("%v: %s", err, output)
+	}
+	return nil
+}
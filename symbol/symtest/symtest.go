@@ -0,0 +1,446 @@
+// Package symtest provide a fake build server share and a fake symstore, so the whole
+// ingest pipeline of BrBuilder can be tested on any OS without symstore.exe.
+//
+package symtest
+
+import (
+	"archive/zip"
+	"bytes"
+	"context"
+	"encoding/binary"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/adyzng/GoSymbols/config"
+	"github.com/adyzng/GoSymbols/pdb"
+	"github.com/adyzng/GoSymbols/symbol"
+)
+
+const (
+	adminDir  = "000Admin"
+	index2Txt = "index2.txt"
+)
+
+var (
+	msfMagic = []byte("Microsoft C/C++ MSF 7.00\r\n\x1aDS\x00\x00\x00")
+)
+
+// PDB build a minimal MSF 7.0 pdb with given signature, `seed` is appended as payload
+// so files with the same key can have different content.
+//
+func PDB(guid [16]byte, age uint32, seed string) []byte {
+	const bs = 512
+	file := make([]byte, bs*5, bs*5+len(seed))
+	le := binary.LittleEndian
+
+	copy(file, msfMagic)
+	sb := file[len(msfMagic):]
+	le.PutUint32(sb[0:], bs)  // block size
+	le.PutUint32(sb[4:], 1)   // free block map
+	le.PutUint32(sb[8:], 5)   // num blocks
+	le.PutUint32(sb[12:], 36) // directory bytes
+	le.PutUint32(sb[20:], 1)  // block map addr
+
+	le.PutUint32(file[bs:], 2) // directory at block 2
+
+	dir := file[bs*2:]
+	le.PutUint32(dir[0:], 4)           // 4 streams
+	le.PutUint32(dir[8:], 28)          // pdb info
+	le.PutUint32(dir[12:], 0xFFFFFFFF) // nil stream
+	le.PutUint32(dir[16:], 12)         // dbi
+	le.PutUint32(dir[20:], 3)          // pdb info block
+	le.PutUint32(dir[24:], 4)          // dbi block
+
+	info := file[bs*3:]
+	le.PutUint32(info[0:], 20000404)
+	le.PutUint32(info[8:], age)
+	copy(info[12:], guid[:])
+
+	dbi := file[bs*4:]
+	le.PutUint32(dbi[8:], age)
+	return append(file, seed...)
+}
+
+// PE build a minimal PE image with given TimeDateStamp and SizeOfImage.
+//
+func PE(stamp, size uint32, seed string) []byte {
+	file := make([]byte, 512, 512+len(seed))
+	le := binary.LittleEndian
+	copy(file, "MZ")
+	le.PutUint32(file[0x3C:], 0x80)
+	copy(file[0x80:], "PE\x00\x00")
+	le.PutUint32(file[0x80+8:], stamp)
+	le.PutUint32(file[0x80+24+56:], size)
+	return append(file, seed...)
+}
+
+// BinaryOf build a minimal PE32 image built with the pdb `guid` and `age`, its RSDS
+// CodeView record name the pdb as `pdbPath`.
+//
+func BinaryOf(guid [16]byte, age uint32, pdbPath, seed string) []byte {
+	file := make([]byte, 0x400, 0x400+len(seed))
+	le := binary.LittleEndian
+	copy(file, "MZ")
+	le.PutUint32(file[0x3C:], 0x80)
+	copy(file[0x80:], "PE\x00\x00")
+	le.PutUint16(file[0x84:], 0x14c) // i386
+	le.PutUint16(file[0x86:], 1)     // sections
+	le.PutUint16(file[0x94:], 224)   // optional header size
+
+	opt := file[0x98:]
+	le.PutUint16(opt, 0x10b)
+	le.PutUint32(opt[92:], 16)
+	le.PutUint32(opt[96+6*8:], 0x1000) // debug directory
+	le.PutUint32(opt[96+6*8+4:], 28)
+
+	sec := file[0x98+224:]
+	copy(sec, ".rdata")
+	le.PutUint32(sec[8:], 0x200)
+	le.PutUint32(sec[12:], 0x1000)
+	le.PutUint32(sec[16:], 0x200)
+	le.PutUint32(sec[20:], 0x200)
+
+	entry := file[0x200:]
+	le.PutUint32(entry[12:], 2) // codeview
+	le.PutUint32(entry[16:], uint32(24+len(pdbPath)+1))
+	le.PutUint32(entry[24:], 0x200+28)
+	cv := entry[28:]
+	copy(cv, "RSDS")
+	copy(cv[4:], guid[:])
+	le.PutUint32(cv[20:], age)
+	copy(cv[24:], pdbPath)
+	return append(file, seed...)
+}
+
+// PortablePDB build a minimal .NET portable pdb whose #Pdb stream hold `guid` as pdb id.
+//
+func PortablePDB(guid [16]byte, seed string) []byte {
+	le := binary.LittleEndian
+	file := make([]byte, 68, 68+len(seed))
+	copy(file, "BSJB")
+	le.PutUint16(file[4:], 1)
+	le.PutUint16(file[6:], 1)
+	le.PutUint32(file[12:], 12) // version length
+	copy(file[16:], "PDB v1.0")
+	le.PutUint16(file[30:], 1)  // streams
+	le.PutUint32(file[32:], 48) // #Pdb offset
+	le.PutUint32(file[36:], 20) // #Pdb size
+	copy(file[40:], "#Pdb")     // zero terminated, padded to 8 bytes
+	copy(file[48:], guid[:])
+	return append(file, seed...)
+}
+
+// ELF build a minimal 64 bits ELF binary holding GNU build-id `gnuID` and Go build id `goID`
+// notes (skipped if empty), with a .gopclntab section unless `stripped`.
+//
+func ELF(gnuID []byte, goID string, stripped bool, seed string) []byte {
+	le := binary.LittleEndian
+	note := func(name string, typ uint32, desc []byte) []byte {
+		pad := func(n int) int { return (n + 3) &^ 3 }
+		buf := make([]byte, 12+pad(len(name)+1)+pad(len(desc)))
+		le.PutUint32(buf[0:], uint32(len(name)+1))
+		le.PutUint32(buf[4:], uint32(len(desc)))
+		le.PutUint32(buf[8:], typ)
+		copy(buf[12:], name)
+		copy(buf[12+pad(len(name)+1):], desc)
+		return buf
+	}
+	type section struct {
+		name string
+		typ  uint32
+		data []byte
+	}
+	secs := []section{{}}
+	if len(gnuID) > 0 {
+		secs = append(secs, section{".note.gnu.build-id", 7, note("GNU", 3, gnuID)})
+	}
+	if goID != "" {
+		secs = append(secs, section{".note.go.buildid", 7, note("Go", 4, []byte(goID))})
+	}
+	if !stripped {
+		secs = append(secs, section{".gopclntab", 1, []byte(seed)})
+	}
+	shstr := []byte{0}
+	names := make([]int, len(secs)+1)
+	for i, sec := range secs[1:] {
+		names[i+1] = len(shstr)
+		shstr = append(append(shstr, sec.name...), 0)
+	}
+	names[len(secs)] = len(shstr)
+	shstr = append(append(shstr, ".shstrtab"...), 0)
+	secs = append(secs, section{".shstrtab", 3, shstr})
+
+	file := make([]byte, 64)
+	offsets := make([]int, len(secs))
+	for i, sec := range secs {
+		offsets[i] = len(file)
+		file = append(file, sec.data...)
+	}
+	shoff := (len(file) + 7) &^ 7
+	file = append(file, make([]byte, shoff-len(file)+64*len(secs))...)
+	copy(file, "\x7fELF\x02\x01\x01")
+	le.PutUint16(file[16:], 2)  // executable
+	le.PutUint16(file[18:], 62) // x86-64
+	le.PutUint32(file[20:], 1)
+	le.PutUint64(file[40:], uint64(shoff))
+	le.PutUint16(file[52:], 64) // header size
+	le.PutUint16(file[58:], 64) // section header size
+	le.PutUint16(file[60:], uint16(len(secs)))
+	le.PutUint16(file[62:], uint16(len(secs)-1))
+	for i, sec := range secs {
+		sh := file[shoff+64*i:]
+		le.PutUint32(sh[0:], uint32(names[i]))
+		le.PutUint32(sh[4:], sec.typ)
+		le.PutUint64(sh[24:], uint64(offsets[i]))
+		le.PutUint64(sh[32:], uint64(len(sec.data)))
+		le.PutUint64(sh[48:], 1)
+	}
+	return file
+}
+
+// GUID return an deterministic guid from `n`, handy to make distinct pdbs.
+//
+func GUID(n int) [16]byte {
+	var g [16]byte
+	binary.LittleEndian.PutUint64(g[:8], uint64(n))
+	binary.LittleEndian.PutUint64(g[8:], uint64(n)*0x9E3779B97F4A7C15)
+	return g
+}
+
+// BuildShare is a fake build server folder of one branch, laid out as
+//	{Root}/Build{version}/debug.zip
+//	{Root}/latestbuild.txt
+//
+type BuildShare struct {
+	Root string
+}
+
+// NewBuildShare create the share folder of branch `name` under `root`, the
+// returned Root is the BuildPath of the branch.
+//
+func NewBuildShare(root, name string) (*BuildShare, error) {
+	s := &BuildShare{Root: filepath.Join(root, name, "Release")}
+	return s, os.MkdirAll(s.Root, 0755)
+}
+
+// Publish write debug zip of build `version` holding `files` (relative path => content),
+// and mark it as the latest build.
+//
+func (s *BuildShare) Publish(version string, files map[string][]byte) error {
+	dir := filepath.Join(s.Root, "Build"+version)
+	if err := os.MkdirAll(dir, 0755); err != nil {
+		return err
+	}
+	var buf bytes.Buffer
+	zw := zip.NewWriter(&buf)
+	for name, data := range files {
+		w, err := zw.Create(name)
+		if err != nil {
+			return err
+		}
+		if _, err = w.Write(data); err != nil {
+			return err
+		}
+	}
+	if err := zw.Close(); err != nil {
+		return err
+	}
+	if err := ioutil.WriteFile(filepath.Join(dir, config.PDBZipFile), buf.Bytes(), 0644); err != nil {
+		return err
+	}
+	return ioutil.WriteFile(filepath.Join(s.Root, config.LatestBuildFile), []byte(version+"\r\n"), 0644)
+}
+
+// SymStore is a fake symstore.exe writing the same store and admin files: symbol
+// folders (two-tier if index2.txt exist), 000Admin/{id}, server.txt, history.txt and lastid.txt.
+//
+type SymStore struct {
+	Now  func() time.Time // transaction time, symbol.Clock if nil
+	Fail error            // returned by next Add if not nil
+	Adds int              // transactions added
+	mx   sync.Mutex
+}
+
+// Install replace symbol.SymStore with `s`, return func to restore the original.
+//
+func (s *SymStore) Install() func() {
+	old := symbol.SymStore
+	symbol.SymStore = s
+	return func() { symbol.SymStore = old }
+}
+
+// Add implement symbol.SymStorer.
+//
+func (s *SymStore) Add(ctx context.Context, store, product, version, comment, symbols string) ([]byte, error) {
+	s.mx.Lock()
+	defer s.mx.Unlock()
+	if err := s.Fail; err != nil {
+		s.Fail = nil
+		return []byte("SYMSTORE ERROR: " + err.Error()), err
+	}
+	if err := ctx.Err(); err != nil {
+		return nil, err
+	}
+
+	admin := filepath.Join(store, adminDir)
+	if err := os.MkdirAll(admin, 0755); err != nil {
+		return nil, err
+	}
+	_, err := os.Stat(filepath.Join(store, index2Txt))
+	twoTier := err == nil
+
+	var lines []string
+	err = filepath.Walk(symbols, func(fpath string, info os.FileInfo, err error) error {
+		if err != nil || info.IsDir() || !pdb.IsSymbolFile(info.Name()) {
+			return err
+		}
+		key, err := pdb.Key(fpath)
+		if err != nil {
+			// symstore.exe skip unknown files too
+			return nil
+		}
+		name := info.Name()
+		dir := filepath.Join(store, name, key)
+		if twoTier {
+			dir = filepath.Join(store, name[:2], name, key)
+		}
+		if err = os.MkdirAll(dir, 0755); err != nil {
+			return err
+		}
+		if config.Compress {
+			// as `symstore add /compress`, only foo.pd_ is stored
+			err = compressFile(fpath, filepath.Join(dir, pdb.CompressedName(name)))
+		} else {
+			err = copyFile(fpath, filepath.Join(dir, name))
+		}
+		if err != nil {
+			return err
+		}
+		lines = append(lines, fmt.Sprintf("\"%s\\%s\",\"%s\"\r\n", name, key, strings.Replace(fpath, "/", "\\", -1)))
+		return nil
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	last, _ := ioutil.ReadFile(filepath.Join(admin, "lastid.txt"))
+	n, _ := strconv.Atoi(strings.TrimSpace(string(last)))
+	id := fmt.Sprintf("%010d", n+1)
+	if err = ioutil.WriteFile(filepath.Join(admin, id), []byte(strings.Join(lines, "")), 0644); err != nil {
+		return nil, err
+	}
+
+	now := symbol.Clock.Now()
+	if s.Now != nil {
+		now = s.Now()
+	}
+	record := fmt.Sprintf("%s,add,file,%s,%s,\"%s\",\"%s\",\"%s\",\r\n",
+		id, now.Format("01/02/2006"), now.Format("15:04:05"), product, version, comment)
+	for _, name := range []string{"server.txt", "history.txt"} {
+		if err = appendFile(filepath.Join(admin, name), record); err != nil {
+			return nil, err
+		}
+	}
+	if err = ioutil.WriteFile(filepath.Join(admin, "lastid.txt"), []byte(id), 0644); err != nil {
+		return nil, err
+	}
+	s.Adds++
+	return []byte(fmt.Sprintf("SYMSTORE: Number of files stored = %d\nSYMSTORE: Number of errors = 0", len(lines))), nil
+}
+
+// Clock is a manual clock for symbol.Clock, time only move by Set or Add.
+//
+type Clock struct {
+	mx sync.Mutex
+	t  time.Time
+}
+
+// NewClock return clock stopped at `t`.
+//
+func NewClock(t time.Time) *Clock {
+	return &Clock{t: t}
+}
+
+// Install replace symbol.Clock with `c`, return func to restore the original.
+//
+func (c *Clock) Install() func() {
+	old := symbol.Clock
+	symbol.Clock = c
+	return func() { symbol.Clock = old }
+}
+
+// Now implement symbol.Clocker.
+//
+func (c *Clock) Now() time.Time {
+	c.mx.Lock()
+	defer c.mx.Unlock()
+	return c.t
+}
+
+// Set the clock to `t`.
+//
+func (c *Clock) Set(t time.Time) {
+	c.mx.Lock()
+	c.t = t
+	c.mx.Unlock()
+}
+
+// Add move the clock by `d`, return the new time.
+//
+func (c *Clock) Add(d time.Duration) time.Time {
+	c.mx.Lock()
+	defer c.mx.Unlock()
+	c.t = c.t.Add(d)
+	return c.t
+}
+
+func copyFile(src, dst string) error {
+	fs, err := os.Open(src)
+	if err != nil {
+		return err
+	}
+	defer fs.Close()
+	fd, err := os.Create(dst)
+	if err != nil {
+		return err
+	}
+	if _, err = io.Copy(fd, fs); err != nil {
+		fd.Close()
+		return err
+	}
+	return fd.Close()
+}
+
+func compressFile(src, dst string) error {
+	fs, err := os.Open(src)
+	if err != nil {
+		return err
+	}
+	defer fs.Close()
+	fd, err := os.Create(dst)
+	if err != nil {
+		return err
+	}
+	if err = pdb.WriteCab(fd, filepath.Base(src), time.Now(), fs); err != nil {
+		fd.Close()
+		return err
+	}
+	return fd.Close()
+}
+
+func appendFile(fpath, line string) error {
+	fd, err := os.OpenFile(fpath, os.O_WRONLY|os.O_CREATE|os.O_APPEND, 0644)
+	if err != nil {
+		return err
+	}
+	defer fd.Close()
+	_, err = fd.WriteString(line)
+	return err
+}
@@ -0,0 +1,911 @@
+package symtest
+
+import (
+	"archive/zip"
+	"bytes"
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/adyzng/GoSymbols/alert"
+	"github.com/adyzng/GoSymbols/config"
+	"github.com/adyzng/GoSymbols/encrypt"
+	"github.com/adyzng/GoSymbols/pdb"
+	"github.com/adyzng/GoSymbols/symbol"
+)
+
+func setup(t *testing.T) (string, func()) {
+	root, err := ioutil.TempDir("", "symtest")
+	if err != nil {
+		t.Fatal(err)
+	}
+	zip, latest, layout := config.PDBZipFile, config.LatestBuildFile, config.StoreLayout
+	config.PDBZipFile, config.LatestBuildFile, config.StoreLayout = "debug.zip", "latestbuild.txt", 1
+	restore := (&SymStore{}).Install()
+	return root, func() {
+		restore()
+		config.PDBZipFile, config.LatestBuildFile, config.StoreLayout = zip, latest, layout
+		os.RemoveAll(root)
+	}
+}
+
+func newBranch(t *testing.T, root, name string) (*symbol.BrBuilder, *BuildShare) {
+	share, err := NewBuildShare(filepath.Join(root, "share"), name)
+	if err != nil {
+		t.Fatal(err)
+	}
+	store := filepath.Join(root, "store", name)
+	os.MkdirAll(filepath.Join(store, adminDir), 0755)
+	b := symbol.NewBranch2(&symbol.Branch{
+		BuildName: name,
+		StoreName: name,
+		BuildPath: share.Root,
+		StorePath: store,
+	}).(*symbol.BrBuilder)
+	return b, share
+}
+
+func TestIngestPipeline(t *testing.T) {
+	root, cleanup := setup(t)
+	defer cleanup()
+	b, share := newBranch(t, root, "UDP")
+
+	err := share.Publish("100", map[string][]byte{
+		"x64/foo.pdb":   PDB(GUID(1), 1, "foo"),
+		"x64/foo.dll":   PE(0x59C0C5B3, 0xa3000, "foo"),
+		"x86/bar.pdb":   PDB(GUID(2), 1, "bar"),
+		"doc/readme.md": []byte("not a symbol"),
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err = b.AddBuild(context.Background(), ""); err != nil {
+		t.Fatal(err)
+	}
+	if b.LatestBuild != "100" || b.BuildsCount != 1 {
+		t.Fatalf("expect build 100 ingested, got %s (%d builds)", b.LatestBuild, b.BuildsCount)
+	}
+
+	id := b.GetLatestID()
+	var syms []*symbol.Symbol
+	if _, err = b.ParseSymbols(id, func(sym *symbol.Symbol) error {
+		syms = append(syms, sym)
+		return nil
+	}); err != nil || len(syms) != 3 {
+		t.Fatalf("expect 3 symbols in %s, got %d (%v)", id, len(syms), err)
+	}
+	for _, sym := range syms {
+		if _, err = os.Stat(b.GetSymbolPath(sym.Hash, sym.Name)); err != nil {
+			t.Fatalf("symbol %s not stored: %v", sym.Name, err)
+		}
+		if sym.Name == "bar.pdb" && sym.Arch != symbol.ArchX86 {
+			t.Fatalf("expect x86 bar.pdb, got %s", sym.Arch)
+		}
+	}
+
+	// same build again is a no-op, then a new build and an supplement of it
+	if err = b.AddBuild(context.Background(), ""); err != nil {
+		t.Fatal(err)
+	}
+	share.Publish("101", map[string][]byte{
+		"x64/foo.pdb": PDB(GUID(3), 1, "foo"),
+	})
+	if err = b.AddBuild(context.Background(), ""); err != nil || b.BuildsCount != 2 || b.LatestBuild != "101" {
+		t.Fatalf("expect build 101 ingested, got %s (%v)", b.LatestBuild, err)
+	}
+	sup, err := b.AddSupplement("101", []string{"foo.pdb"})
+	if err != nil || sup.SupplementOf == "" {
+		t.Fatalf("expect supplement of 101, got %+v (%v)", sup, err)
+	}
+
+	history, _ := ioutil.ReadFile(filepath.Join(b.StorePath, adminDir, "history.txt"))
+	if n := strings.Count(string(history), "\r\n"); n != 3 {
+		t.Fatalf("expect 3 transactions in history, got %d", n)
+	}
+	if b.GetBranch().Layout != symbol.LayoutFlat {
+		t.Fatalf("expect flat layout, got %d", b.Layout)
+	}
+}
+
+func TestIngestTwoTierAndFailure(t *testing.T) {
+	root, cleanup := setup(t)
+	defer cleanup()
+	config.StoreLayout = symbol.LayoutTwoTier
+	b, share := newBranch(t, root, "ARC")
+
+	share.Publish("7", map[string][]byte{"x64/arc.pdb": PDB(GUID(7), 2, "arc")})
+	fake := &SymStore{Fail: errors.New("access denied")}
+	defer fake.Install()()
+
+	if err := b.AddBuild(context.Background(), ""); err == nil {
+		t.Fatal("expect symstore failure returned")
+	}
+	if fake.Adds != 0 || b.BuildsCount != 0 {
+		t.Fatal("expect nothing added on failure")
+	}
+
+	if err := b.AddBuild(context.Background(), ""); err != nil {
+		t.Fatal(err)
+	}
+	var sym *symbol.Symbol
+	b.ParseSymbols(b.GetLatestID(), func(s *symbol.Symbol) error {
+		sym = s
+		return nil
+	})
+	if sym == nil {
+		t.Fatal("expect arc.pdb ingested")
+	}
+	fpath := b.GetSymbolPath(sym.Hash, sym.Name)
+	if fpath != filepath.Join(b.StorePath, "ar", "arc.pdb", sym.Hash, "arc.pdb") {
+		t.Fatalf("expect two-tier path, got %s", fpath)
+	}
+	if _, err := os.Stat(fpath); err != nil {
+		t.Fatal(err)
+	}
+}
+
+func TestIngestKeepBoth(t *testing.T) {
+	root, cleanup := setup(t)
+	defer cleanup()
+	b, share := newBranch(t, root, "KEEP")
+	b.ConflictPolicy = symbol.ConflictKeepBoth
+
+	share.Publish("1", map[string][]byte{"x64/foo.pdb": PDB(GUID(1), 1, "old")})
+	if err := b.AddBuild(context.Background(), ""); err != nil {
+		t.Fatal(err)
+	}
+	// same key, different content
+	share.Publish("2", map[string][]byte{"x64/foo.pdb": PDB(GUID(1), 1, "new")})
+	if err := b.AddBuild(context.Background(), ""); err != nil {
+		t.Fatal(err)
+	}
+
+	var syms []*symbol.Symbol
+	b.ParseSymbols(b.GetLatestID(), func(sym *symbol.Symbol) error {
+		syms = append(syms, sym)
+		return nil
+	})
+	if len(syms) != 1 || syms[0].Name != "foo_2.pdb" {
+		t.Fatalf("expect new file committed as foo_2.pdb, got %v", syms)
+	}
+	data, err := ioutil.ReadFile(b.GetSymbolPath(syms[0].Hash, "foo_2.pdb"))
+	if err != nil || !bytes.HasSuffix(data, []byte("new")) {
+		t.Fatalf("unexpected kept file (%v)", err)
+	}
+	if data, _ = ioutil.ReadFile(b.GetSymbolPath(syms[0].Hash, "foo.pdb")); !bytes.HasSuffix(data, []byte("old")) {
+		t.Fatal("stored file should be kept")
+	}
+}
+
+func TestIngestFetchFault(t *testing.T) {
+	root, cleanup := setup(t)
+	defer cleanup()
+	defer func(targets []string, rate float64) {
+		config.FaultTargets, config.FaultErrorRate = targets, rate
+	}(config.FaultTargets, config.FaultErrorRate)
+	config.FaultTargets, config.FaultErrorRate = []string{"fetch"}, 1
+
+	b, share := newBranch(t, root, "D2D")
+	share.Publish("1", map[string][]byte{"x64/d2d.pdb": PDB(GUID(9), 1, strings.Repeat("d2d", 1<<16))})
+	if err := b.AddBuild(context.Background(), ""); err == nil {
+		t.Fatal("expect broken copy fail the ingest")
+	}
+	if b.BuildsCount != 0 || b.GetLatestID() != "" {
+		t.Fatal("expect nothing added to store")
+	}
+	if _, err := os.Stat(filepath.Join(b.StorePath, "000Unzip")); !os.IsNotExist(err) {
+		t.Fatal("expect unzip folder removed")
+	}
+
+	config.FaultTargets = nil
+	if err := b.AddBuild(context.Background(), ""); err != nil || b.BuildsCount != 1 {
+		t.Fatalf("expect ingest succeed without fault, got %v", err)
+	}
+}
+
+func TestIngestStorageFault(t *testing.T) {
+	root, cleanup := setup(t)
+	defer cleanup()
+	defer func(targets []string, rate float64) {
+		config.FaultTargets, config.FaultErrorRate = targets, rate
+	}(config.FaultTargets, config.FaultErrorRate)
+
+	b, share := newBranch(t, root, "D2D")
+	share.Publish("1", map[string][]byte{"x64/d2d.pdb": PDB(GUID(9), 1, strings.Repeat("d2d", 1<<10))})
+	config.FaultTargets, config.FaultErrorRate = []string{"storage"}, 1
+	if err := b.AddBuild(context.Background(), ""); err == nil {
+		t.Fatal("expect storage fault fail the ingest")
+	}
+	config.FaultTargets = nil
+	if b.BuildsCount != 0 || b.GetLatestID() != "" {
+		t.Fatal("expect nothing added to store")
+	}
+	if err := b.AddBuild(context.Background(), ""); err != nil || b.BuildsCount != 1 {
+		t.Fatalf("expect ingest succeed without fault, got %v", err)
+	}
+}
+
+func TestIngestRenameRules(t *testing.T) {
+	root, cleanup := setup(t)
+	defer cleanup()
+	b, share := newBranch(t, root, "CA")
+	b.Renames = []symbol.RenameRule{{Pattern: `^(.+)_\d+\.(pdb|dll)$`, Replace: "$1.$2"}}
+
+	// both foo.pdb once renamed, each keep its own original name
+	share.Publish("4175", map[string][]byte{
+		"x64/foo_4175.pdb": PDB(GUID(11), 1, "foo"),
+		"x86/foo_4176.pdb": PDB(GUID(13), 1, "foo"),
+		"x64/bar.pdb":      PDB(GUID(12), 1, "bar"),
+	})
+	if err := b.AddBuild(context.Background(), ""); err != nil {
+		t.Fatal(err)
+	}
+
+	names := make(map[string]string)
+	b.ParseSymbols(b.GetLatestID(), func(sym *symbol.Symbol) error {
+		names[sym.Name+"@"+sym.Arch] = sym.Original
+		if _, err := os.Stat(b.GetSymbolPath(sym.Hash, sym.Name)); err != nil {
+			t.Errorf("symbol %s not stored under new name: %v", sym.Name, err)
+		}
+		return nil
+	})
+	if len(names) != 3 || names["foo.pdb@x64"] != "foo_4175.pdb" || names["foo.pdb@x86"] != "foo_4176.pdb" ||
+		names["bar.pdb@x64"] != "" {
+		t.Fatalf("unexpected renamed symbols %v", names)
+	}
+}
+
+func TestMergeDuplicateBranch(t *testing.T) {
+	root, cleanup := setup(t)
+	defer cleanup()
+	defer func(dest, app string) {
+		config.Destination, config.AppPath = dest, app
+	}(config.Destination, config.AppPath)
+	config.Destination, config.AppPath = root, root
+
+	a, share := newBranch(t, root, "UDP")
+	b, _ := newBranch(t, root, "UDPCopy")
+	b.BuildPath = share.Root
+
+	share.Publish("099", map[string][]byte{"x64/baz.pdb": PDB(GUID(20), 1, "baz")})
+	if err := a.AddBuild(context.Background(), "099"); err != nil {
+		t.Fatal(err)
+	}
+	share.Publish("100", map[string][]byte{"x64/foo.pdb": PDB(GUID(21), 1, "foo")})
+	if err := a.AddBuild(context.Background(), ""); err != nil {
+		t.Fatal(err)
+	}
+	if err := b.AddBuild(context.Background(), ""); err != nil {
+		t.Fatal(err)
+	}
+	share.Publish("101", map[string][]byte{
+		"x64/foo.pdb": PDB(GUID(22), 1, "foo"),
+		"x64/bar.pdb": PDB(GUID(23), 1, "bar"),
+	})
+	if err := b.AddBuild(context.Background(), ""); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := b.AddSupplement("101", []string{"bar.pdb"}); err != nil {
+		t.Fatal(err)
+	}
+	// as written by symstore.exe, both transactions of build 101 reference bar.pdb
+	var bar string
+	b.ParseSymbols("0000000002", func(sym *symbol.Symbol) error {
+		if sym.Name == "bar.pdb" {
+			bar = sym.Hash
+		}
+		return nil
+	})
+	refs := "0000000002,file,1\r\n0000000003,file,1\r\n"
+	ioutil.WriteFile(filepath.Join(filepath.Dir(b.GetSymbolPath(bar, "bar.pdb")), "refs.ptr"), []byte(refs), 0644)
+
+	ss := symbol.GetServer()
+	ss.Add(a.GetBranch())
+	ss.Add(b.GetBranch())
+	defer ss.Delete("UDP")
+	defer ss.Delete("UDPCopy")
+
+	dups := ss.FindDuplicates()
+	if len(dups) != 1 || strings.Join(dups[0].Branches, ",") != "UDP,UDPCopy" {
+		t.Fatalf("expect UDP and UDPCopy share build path, got %+v", dups)
+	}
+	if _, err := ss.MergeBranch("UDP", "udp", "test", true); err != symbol.ErrMergeSelf {
+		t.Fatalf("expect merge into itself refused, got %v", err)
+	}
+
+	report, err := ss.MergeBranch("UDPCopy", "UDP", "test", true)
+	if err != nil || report.Builds != 1 || report.Supplements != 1 || len(report.Duplicates) != 1 || len(report.Conflicts) != 0 {
+		t.Fatalf("unexpected dry run %+v (%v)", report, err)
+	}
+	if ss.Get("UDPCopy") == nil {
+		t.Fatal("expect dry run keep source branch")
+	}
+
+	if report, err = ss.MergeBranch("UDPCopy", "UDP", "test", false); err != nil {
+		t.Fatal(err)
+	}
+	if report.Folders != 2 || ss.Get("UDPCopy") != nil {
+		t.Fatalf("expect 2 folders copied and source removed, got %+v", report)
+	}
+
+	dst := ss.Get("UDP").(*symbol.BrBuilder)
+	if dst.GetLatestID() != "0000000004" || dst.LatestBuild != "101" {
+		t.Fatalf("expect transactions re-keyed after 2, got %s (%s)", dst.GetLatestID(), dst.LatestBuild)
+	}
+	var sup *symbol.Build
+	dst.ParseBuilds(context.Background(), func(build *symbol.Build) error {
+		if build.ID == "0000000004" {
+			sup = build
+		}
+		return nil
+	})
+	if sup == nil || sup.SupplementOf != "0000000003" {
+		t.Fatalf("expect supplement attached to re-keyed build, got %+v", sup)
+	}
+	data, _ := ioutil.ReadFile(filepath.Join(filepath.Dir(dst.GetSymbolPath(bar, "bar.pdb")), "refs.ptr"))
+	if string(data) != "0000000003,file,1\r\n0000000004,file,1\r\n" {
+		t.Fatalf("expect refs.ptr re-keyed, got %q", data)
+	}
+	if _, err := os.Stat(filepath.Join(dst.StorePath, adminDir, "merging")); !os.IsNotExist(err) {
+		t.Fatalf("expect staging folder removed, got %v", err)
+	}
+	n := 0
+	dst.ParseSymbols("0000000003", func(sym *symbol.Symbol) error {
+		if _, err := os.Stat(dst.GetSymbolPath(sym.Hash, sym.Name)); err != nil {
+			t.Errorf("symbol %s not copied: %v", sym.Name, err)
+		}
+		n++
+		return nil
+	})
+	if n != 2 {
+		t.Fatalf("expect 2 symbols in merged build, got %d", n)
+	}
+}
+
+func TestMergeConflictAndRollback(t *testing.T) {
+	root, cleanup := setup(t)
+	defer cleanup()
+	defer func(dest, app string) {
+		config.Destination, config.AppPath = dest, app
+	}(config.Destination, config.AppPath)
+	config.Destination, config.AppPath = root, root
+	defer func(keys encrypt.KeyProvider) { encrypt.Keys = keys }(encrypt.Keys)
+
+	a, share := newBranch(t, root, "UDP")
+	b, other := newBranch(t, root, "UDPCopy")
+	c, next := newBranch(t, root, "UDPNext")
+	share.Publish("100", map[string][]byte{"x64/foo.pdb": PDB(GUID(41), 1, "foo")})
+	other.Publish("100", map[string][]byte{"x64/foo.pdb": PDB(GUID(42), 1, "foo")})
+	next.Publish("101", map[string][]byte{"x64/bar.pdb": PDB(GUID(43), 1, "bar")})
+	for _, br := range []*symbol.BrBuilder{a, b, c} {
+		if err := br.AddBuild(context.Background(), ""); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	ss := symbol.GetServer()
+	for _, br := range []*symbol.BrBuilder{a, b, c} {
+		ss.Add(br.GetBranch())
+		defer ss.Delete(br.Name())
+	}
+
+	// same version with different symbols is reported, and refused
+	report, err := ss.MergeBranch("UDPCopy", "UDP", "test", true)
+	if err != nil || len(report.Conflicts) != 1 || report.Conflicts[0].Version != "100" || len(report.Duplicates) != 0 {
+		t.Fatalf("expect conflict of 100 in dry run, got %+v (%v)", report, err)
+	}
+	if _, err = ss.MergeBranch("UDPCopy", "UDP", "test", false); err != symbol.ErrMergeConflict {
+		t.Fatalf("expect conflicting merge refused, got %v", err)
+	}
+	if ss.Get("UDPCopy") == nil {
+		t.Fatal("expect source of refused merge kept")
+	}
+
+	// encryption fails once the merge is in the store, everything is undone
+	dst := ss.Get("UDP").(*symbol.BrBuilder)
+	dst.Encrypted = true
+	encrypt.Keys = testKeys{}
+	admin := filepath.Join(dst.StorePath, adminDir)
+	server, _ := ioutil.ReadFile(filepath.Join(admin, "server.txt"))
+	if _, err = ss.MergeBranch("UDPNext", "UDP", "test", false); err == nil {
+		t.Fatal("expect merge failed without key")
+	}
+	if ss.Get("UDPNext") == nil || dst.GetLatestID() != "0000000001" {
+		t.Fatalf("expect nothing merged, latest %s", dst.GetLatestID())
+	}
+	if data, _ := ioutil.ReadFile(filepath.Join(admin, "server.txt")); !bytes.Equal(data, server) {
+		t.Fatalf("expect server.txt restored, got %q", data)
+	}
+	for _, name := range []string{"0000000002", "merging"} {
+		if _, err = os.Stat(filepath.Join(admin, name)); !os.IsNotExist(err) {
+			t.Errorf("expect %s removed, got %v", name, err)
+		}
+	}
+	if _, err = os.Stat(filepath.Join(dst.StorePath, "bar.pdb")); !os.IsNotExist(err) {
+		t.Errorf("expect merged symbol folder removed, got %v", err)
+	}
+}
+
+type testKeys map[string][]byte
+
+func (k testKeys) Key(branch string) ([]byte, error) {
+	if key, ok := k[branch]; ok {
+		return key, nil
+	}
+	return nil, encrypt.ErrNoKey
+}
+
+func TestIngestEncrypted(t *testing.T) {
+	root, cleanup := setup(t)
+	defer cleanup()
+	defer func(keys encrypt.KeyProvider) { encrypt.Keys = keys }(encrypt.Keys)
+	encrypt.Keys = testKeys{"SEC": bytes.Repeat([]byte{1}, 32)}
+	b, share := newBranch(t, root, "SEC")
+	b.Encrypted = true
+
+	pdb := PDB(GUID(31), 1, "confidential C:\\src\\secret")
+	share.Publish("1", map[string][]byte{"x64/sec.pdb": pdb})
+	if err := b.AddBuild(context.Background(), ""); err != nil {
+		t.Fatal(err)
+	}
+	var sym *symbol.Symbol
+	b.ParseSymbols(b.GetLatestID(), func(s *symbol.Symbol) error {
+		sym = s
+		return nil
+	})
+	fpath := b.GetSymbolPath(sym.Hash, sym.Name)
+	if stored, _ := ioutil.ReadFile(fpath); bytes.Contains(stored, []byte("secret")) || !encrypt.IsEncrypted(fpath) {
+		t.Fatal("expect symbol encrypted at rest")
+	}
+	r, size, err := b.OpenSymbol(fpath)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer r.Close()
+	if data, _ := ioutil.ReadAll(r); size != int64(len(pdb)) || !bytes.Equal(data, pdb) {
+		t.Fatal("expect plain content served")
+	}
+
+	// re-publish same key with same content is not a conflict
+	share.Publish("2", map[string][]byte{"x64/sec.pdb": pdb})
+	if err = b.AddBuild(context.Background(), ""); err != nil {
+		t.Fatal(err)
+	}
+	if _, err = os.Stat(filepath.Join(b.StorePath, "000Conflict")); !os.IsNotExist(err) {
+		t.Fatal("expect no conflict for same content")
+	}
+
+	// the build is in the store once symstore added it, sealing failure is an alert
+	encrypt.Keys = testKeys{}
+	share.Publish("3", map[string][]byte{"x64/sec.pdb": PDB(GUID(32), 1, "plain C:\\src\\secret")})
+	if err = b.AddBuild(context.Background(), ""); err != nil {
+		t.Fatalf("expect ingest kept when sealing failed, got %v", err)
+	}
+	raised := false
+	for _, a := range alert.Recent(0) {
+		raised = raised || (a.Kind == alert.KindEncryptFailed && a.Branch == "SEC")
+	}
+	if b.LatestBuild != "3" || !raised {
+		t.Fatalf("expect build 3 added with alert, got %s (alert %v)", b.LatestBuild, raised)
+	}
+}
+
+func TestIngestEncryptedCompressed(t *testing.T) {
+	root, cleanup := setup(t)
+	defer cleanup()
+	defer func(keys encrypt.KeyProvider) { encrypt.Keys = keys }(encrypt.Keys)
+	defer func(compress bool) { config.Compress = compress }(config.Compress)
+	encrypt.Keys = testKeys{"SEC": bytes.Repeat([]byte{1}, 32)}
+	config.Compress = true
+	b, share := newBranch(t, root, "SEC")
+	b.Encrypted = true
+
+	data := PDB(GUID(33), 1, "confidential C:\\src\\secret")
+	share.Publish("1", map[string][]byte{"x64/sec.pdb": data})
+	if err := b.AddBuild(context.Background(), ""); err != nil {
+		t.Fatal(err)
+	}
+	var sym *symbol.Symbol
+	b.ParseSymbols(b.GetLatestID(), func(s *symbol.Symbol) error {
+		sym = s
+		return nil
+	})
+	fpath := b.GetSymbolPath(sym.Hash, pdb.CompressedName(sym.Name))
+	if !encrypt.IsEncrypted(fpath) {
+		t.Fatalf("expect compressed symbol %s encrypted at rest", fpath)
+	}
+	r, _, err := b.OpenSymbol(fpath)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer r.Close()
+	cab, err := pdb.OpenCab(r)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if out, _ := ioutil.ReadAll(cab); cab.Name != sym.Name || !bytes.Equal(out, data) {
+		t.Fatalf("expect %s expanded from sealed cabinet", sym.Name)
+	}
+}
+
+// fakeDumper write the MODULE line of pdbs by their key, like dump_syms
+type fakeDumper struct{}
+
+func (fakeDumper) Dump(fpath string, w io.Writer) error {
+	key, err := pdb.Key(fpath)
+	if err != nil || strings.HasPrefix(filepath.Base(fpath), "bad") {
+		return errors.New("unsupported pdb")
+	}
+	_, err = fmt.Fprintf(w, "MODULE windows x86_64 %s %s\nFILE 0 s:\\src\\main.cpp\n", key, filepath.Base(fpath))
+	return err
+}
+
+func TestIngestBreakpad(t *testing.T) {
+	root, cleanup := setup(t)
+	defer cleanup()
+	defer func(exe string, d symbol.SymDumper, dest, app string) {
+		config.DumpSymsExe, symbol.BreakpadDumper = exe, d
+		config.Destination, config.AppPath = dest, app
+	}(config.DumpSymsExe, symbol.BreakpadDumper, config.Destination, config.AppPath)
+	config.DumpSymsExe, symbol.BreakpadDumper = "dump_syms", fakeDumper{}
+	config.Destination, config.AppPath = root, root
+
+	b, share := newBranch(t, root, "Crash")
+	share.Publish("1", map[string][]byte{
+		"x64/a.pdb":   PDB(GUID(51), 1, "a"),
+		"x64/b.pdb":   PDB(GUID(52), 2, "b"),
+		"x64/bad.pdb": PDB(GUID(53), 1, "bad"),
+	})
+	if err := b.AddBuild(context.Background(), ""); err != nil {
+		t.Fatal(err)
+	}
+	share.Publish("2", map[string][]byte{"x64/c.pdb": PDB(GUID(54), 1, "c")})
+	if err := b.AddBuild(context.Background(), ""); err != nil {
+		t.Fatal(err)
+	}
+	syms, err := b.BreakpadSyms()
+	if err != nil || len(syms) != 3 {
+		t.Fatalf("expect 3 breakpad symbols stored, got %d (%v)", len(syms), err)
+	}
+
+	ss := symbol.GetServer()
+	ss.Add(b.GetBranch())
+	defer ss.Delete("Crash")
+	var key string
+	for _, sym := range syms {
+		if sym.File == "c.pdb" {
+			key = sym.DebugID
+		}
+		if f := ss.FindBreakpad(sym.File, strings.ToLower(sym.DebugID), strings.TrimSuffix(sym.File, ".pdb")+".sym"); f == nil {
+			t.Errorf("expect breakpad symbols of %s found", sym.File)
+		}
+	}
+	if f := ss.FindBreakpad("..", key, "...sym"); f != nil {
+		t.Errorf("expect path out of store refused")
+	}
+
+	plan, err := b.PlanPurge(symbol.PurgeOption{Patterns: []string{"c.pdb"}})
+	if err == nil {
+		_, err = b.ExecutePurge(plan.Token, "test")
+	}
+	if err != nil {
+		t.Fatal(err)
+	}
+	if syms, _ = b.BreakpadSyms(); len(syms) != 2 {
+		t.Errorf("expect breakpad symbols of emptied build purged, got %d", len(syms))
+	}
+	if f := ss.FindBreakpad("c.pdb", key, "c.sym"); f != nil {
+		t.Errorf("expect c.sym removed, got %s", f.Path)
+	}
+}
+
+func TestIngestSignedMetadata(t *testing.T) {
+	root, cleanup := setup(t)
+	defer cleanup()
+	defer func(key, audit string) {
+		config.IntegrityKeyFile, config.AuditFile = key, audit
+	}(config.IntegrityKeyFile, config.AuditFile)
+	config.IntegrityKeyFile, config.AuditFile = filepath.Join(root, "integrity.key"), filepath.Join(root, "audit.log")
+	ioutil.WriteFile(config.IntegrityKeyFile, []byte(strings.Repeat("5a", 32)), 0600)
+
+	b, share := newBranch(t, root, "SIG")
+	share.Publish("1", map[string][]byte{"x64/a.pdb": PDB(GUID(41), 1, "a"), "x64/b.pdb": PDB(GUID(42), 1, "b")})
+	if err := b.AddBuild(context.Background(), ""); err != nil {
+		t.Fatal(err)
+	}
+	share.Publish("2", map[string][]byte{"x64/a.pdb": PDB(GUID(43), 1, "a")})
+	if err := b.AddBuild(context.Background(), ""); err != nil {
+		t.Fatal(err)
+	}
+	plan, err := b.PlanPurge(symbol.PurgeOption{Patterns: []string{"b.pdb"}})
+	if err == nil {
+		_, err = b.ExecutePurge(plan.Token, "test")
+	}
+	if err != nil {
+		t.Fatal(err)
+	}
+	report, err := b.Verify()
+	if err != nil || !report.OK() || report.Signed != 3 {
+		t.Fatalf("expect ingest and purge signed, got %+v (%v)", report, err)
+	}
+
+	admin := filepath.Join(b.StorePath, adminDir)
+	server, _ := ioutil.ReadFile(filepath.Join(admin, "server.txt"))
+	ioutil.WriteFile(filepath.Join(admin, "server.txt"), bytes.Replace(server, []byte(`"2"`), []byte(`"3"`), 1), 0644)
+	ioutil.WriteFile(filepath.Join(admin, "0000000001"), []byte("\"c.pdb\\ABC1\",\"x64\\c.pdb\"\r\n"), 0644)
+	if report, _ = b.Verify(); len(report.Tampered) != 2 || report.Chain != "" {
+		t.Fatalf("expect server.txt and transaction change detected, got %+v", report)
+	}
+
+	records, _ := ioutil.ReadFile(filepath.Join(admin, "integrity.txt"))
+	ioutil.WriteFile(filepath.Join(admin, "integrity.txt"), bytes.Replace(records, []byte("0000000001,add,"), []byte("0000000001,add,0"), 1), 0644)
+	if report, _ = b.Verify(); report.Chain == "" {
+		t.Fatal("expect forged record break the chain")
+	}
+}
+
+func TestReproducibleTimestamps(t *testing.T) {
+	root, cleanup := setup(t)
+	defer cleanup()
+	clock := NewClock(time.Date(2017, 7, 4, 14, 44, 14, 0, time.Local))
+	defer clock.Install()()
+	b, share := newBranch(t, root, "UDP")
+
+	if err := share.Publish("100", map[string][]byte{"x64/foo.pdb": PDB(GUID(1), 1, "foo")}); err != nil {
+		t.Fatal(err)
+	}
+	if err := b.AddBuild(context.Background(), ""); err != nil {
+		t.Fatal(err)
+	}
+	clock.Add(time.Hour)
+	if _, err := b.PlaceHold(b.GetLatestID(), "case 1", "legal", "admin"); err != nil {
+		t.Fatal(err)
+	}
+
+	b2 := symbol.NewBranch2(b.GetBranch()).(*symbol.BrBuilder)
+	var build *symbol.Build
+	b2.ParseBuilds(context.Background(), func(bd *symbol.Build) error {
+		build = bd
+		return nil
+	})
+	if build == nil || build.Date != "2017-07-04 14:44:14" || !strings.HasPrefix(build.Comment, "2017-07-04_14:44:14") {
+		t.Fatalf("unexpected build %+v", build)
+	}
+	if build.Stages == nil || build.Stages.Total != 0 {
+		t.Errorf("expect stages timed by the stopped clock, got %+v", build.Stages)
+	}
+	if build.Hold == nil || build.Hold.Date != "2017-07-04 15:44:14" {
+		t.Errorf("unexpected hold %+v", build.Hold)
+	}
+}
+
+func TestIngestFeed(t *testing.T) {
+	root, cleanup := setup(t)
+	defer cleanup()
+
+	var pkg bytes.Buffer
+	zw := zip.NewWriter(&pkg)
+	w, _ := zw.Create("lib/net6.0/Foo.Core.pdb")
+	w.Write(PortablePDB(GUID(1), "foo"))
+	zw.Close()
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		switch r.URL.Path {
+		case "/flat/foo.core/index.json":
+			w.Write([]byte(`{"versions":["1.0.0","1.1.0-rc.1"]}`))
+		case "/flat/foo.core/1.0.0/foo.core.1.0.0.snupkg":
+			w.Write(pkg.Bytes())
+		default:
+			http.NotFound(w, r)
+		}
+	}))
+	defer srv.Close()
+
+	store := filepath.Join(root, "store", "Foo")
+	os.MkdirAll(filepath.Join(store, adminDir), 0755)
+	b := symbol.NewBranch2(&symbol.Branch{
+		BuildName: "Foo",
+		StoreName: "Foo",
+		StorePath: store,
+		Feed:      srv.URL + "/flat",
+		Package:   "Foo.Core",
+	}).(*symbol.BrBuilder)
+	if err := b.AddBuild(context.Background(), ""); err != nil {
+		t.Fatal(err)
+	}
+	if b.LatestBuild != "1.0.0" {
+		t.Fatalf("expect package 1.0.0 ingested, got %s", b.LatestBuild)
+	}
+	sig := &pdb.Signature{GUID: GUID(1), Age: 0xFFFFFFFF}
+	if _, err := os.Stat(b.GetSymbolPath(sig.Key(), "Foo.Core.pdb")); err != nil {
+		t.Fatalf("portable pdb not stored under ssqp key %s: %v", sig.Key(), err)
+	}
+}
+
+func TestIngestBinaries(t *testing.T) {
+	root, cleanup := setup(t)
+	defer cleanup()
+	b, share := newBranch(t, root, "Svc")
+
+	err := share.Publish("100", map[string][]byte{
+		"x64/foo.pdb":      PDB(GUID(1), 1, "foo"),
+		"linux/svc":        ELF([]byte{0x5F, 0x0A, 0x3C}, "act/content", false, "svc"),
+		"linux/svc-go":     ELF(nil, "act1/content1", false, "svc-go"),
+		"linux/svc-strip":  ELF([]byte{0x01}, "", true, ""),
+		"linux/README.txt": []byte("not a binary"),
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err = b.AddBuild(context.Background(), ""); err != nil {
+		t.Fatal(err)
+	}
+	bins, err := b.Binaries()
+	if err != nil || len(bins) != 2 {
+		t.Fatalf("expect 2 binaries stored, got %d (%v)", len(bins), err)
+	}
+
+	for id, name := range map[string]string{"5f0a3c": "svc", "act1/content1": "svc-go"} {
+		found := false
+		for _, bin := range bins {
+			if bin.Key == pdb.BuildIDKey(id) && bin.Name == name {
+				found = true
+			}
+		}
+		if !found {
+			t.Errorf("expect %s stored by build id %s, got %+v", name, id, bins)
+		}
+		if _, err = os.Stat(b.GetSymbolPath(pdb.BuildIDKey(id), name)); err != nil {
+			t.Errorf("binary %s not in store: %v", name, err)
+		}
+	}
+
+	ss := symbol.GetServer()
+	ss.Add(b.GetBranch())
+	defer ss.Delete("Svc")
+	if f := ss.FindBuildID("5F0A3C"); f == nil || f.Info.Name() != "svc" {
+		t.Errorf("expect svc found by build id, got %+v", f)
+	}
+	if f := ss.FindBuildID("act/content"); f != nil {
+		t.Errorf("go build id is shadowed by gnu build-id, got %+v", f)
+	}
+}
+
+func TestIngestValidation(t *testing.T) {
+	root, cleanup := setup(t)
+	defer cleanup()
+	defer func(mode, action string) {
+		config.ValidateMode, config.ValidateAction = mode, action
+	}(config.ValidateMode, config.ValidateAction)
+	config.ValidateMode, config.ValidateAction = "native", "reject"
+	b, share := newBranch(t, root, "Valid")
+
+	corrupt := PDB(GUID(2), 1, "")[:600]
+	err := share.Publish("100", map[string][]byte{
+		"x64/foo.pdb": PDB(GUID(1), 1, "foo"),
+		"x64/foo.dll": BinaryOf(GUID(1), 1, `D:\out\x64\foo.pdb`, "foo"),
+		"x64/bar.pdb": PDB(GUID(2), 2, "bar"),
+		"x64/bar.dll": BinaryOf(GUID(2), 1, `D:\out\x64\bar.pdb`, "bar"),
+		"x64/baz.dll": BinaryOf(GUID(3), 1, `D:\out\x64\baz.pdb`, "no pdb"),
+		"x86/qux.pdb": corrupt,
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err = b.AddBuild(context.Background(), ""); err == nil || !strings.Contains(err.Error(), symbol.ErrInvalidSymbols.Error()) {
+		t.Fatalf("expect build rejected, got %v", err)
+	}
+	if b.BuildsCount != 0 {
+		t.Fatalf("expect nothing stored of a rejected build, got %d builds", b.BuildsCount)
+	}
+
+	config.ValidateAction = "flag"
+	if err = b.AddBuild(context.Background(), ""); err != nil {
+		t.Fatal(err)
+	}
+	validation := func(b *symbol.BrBuilder) (v *symbol.Validation) {
+		b.ParseBuilds(context.Background(), func(build *symbol.Build) error {
+			v = build.Validation
+			return nil
+		})
+		return v
+	}
+	v := validation(b)
+	if v == nil || v.Mode != "native" || v.Checked != 5 || len(v.Failed) != 2 {
+		t.Fatalf("expect 5 checked and 2 failed, got %+v", v)
+	}
+	for _, c := range v.Failed {
+		switch c.Path {
+		case "x64/bar.dll":
+			if c.Status != symbol.ValidMismatched {
+				t.Errorf("expect bar.dll mismatched, got %+v", c)
+			}
+		case "x86/qux.pdb":
+			if c.Status != symbol.ValidCorrupt {
+				t.Errorf("expect qux.pdb corrupt, got %+v", c)
+			}
+		default:
+			t.Errorf("unexpected failure %+v", c)
+		}
+	}
+
+	// kept with the build records
+	reload := symbol.NewBranch2(b.GetBranch()).(*symbol.BrBuilder)
+	if v = validation(reload); v == nil || len(v.Failed) != 2 {
+		t.Errorf("expect validation reloaded, got %+v", v)
+	}
+}
+
+func TestIngestDedup(t *testing.T) {
+	root, cleanup := setup(t)
+	defer cleanup()
+	defer func(dir string) { config.DedupDir = dir }(config.DedupDir)
+	config.DedupDir = filepath.Join(root, "blobs")
+	udp, udpShare := newBranch(t, root, "UDP")
+	asbu, asbuShare := newBranch(t, root, "ASBU")
+
+	foo := PDB(GUID(1), 1, "foo")
+	udpShare.Publish("100", map[string][]byte{"x64/foo.pdb": foo, "x64/bar.pdb": PDB(GUID(2), 1, "bar")})
+	asbuShare.Publish("200", map[string][]byte{"x64/foo.pdb": foo})
+	if err := udp.AddBuild(context.Background(), ""); err != nil {
+		t.Fatal(err)
+	}
+	if err := asbu.AddBuild(context.Background(), ""); err != nil {
+		t.Fatal(err)
+	}
+
+	hash := ""
+	udp.ParseSymbols(udp.GetLatestID(), func(sym *symbol.Symbol) error {
+		if sym.Name == "foo.pdb" {
+			hash = sym.Hash
+		}
+		return nil
+	})
+	a, _ := os.Stat(udp.GetSymbolPath(hash, "foo.pdb"))
+	b, _ := os.Stat(asbu.GetSymbolPath(hash, "foo.pdb"))
+	if a == nil || b == nil || !os.SameFile(a, b) {
+		t.Fatalf("expect foo.pdb of both branches linked to one blob")
+	}
+	blobs := func() (n int) {
+		filepath.Walk(config.DedupDir, func(fpath string, fi os.FileInfo, err error) error {
+			if err == nil && !fi.IsDir() && filepath.Ext(fpath) != ".refs" {
+				n++
+			}
+			return nil
+		})
+		return n
+	}
+	if n := blobs(); n != 2 {
+		t.Fatalf("expect 2 blobs, got %d", n)
+	}
+
+	// blob kept until the last reference is purged
+	purge := func(b *symbol.BrBuilder) {
+		plan, err := b.PlanPurge(symbol.PurgeOption{Patterns: []string{"foo.pdb"}})
+		if err == nil {
+			_, err = b.ExecutePurge(plan.Token, "test")
+		}
+		if err != nil {
+			t.Fatal(err)
+		}
+	}
+	purge(udp)
+	if n := blobs(); n != 2 {
+		t.Fatalf("expect blob of foo.pdb kept for ASBU, got %d blobs", n)
+	}
+	if data, _ := ioutil.ReadFile(asbu.GetSymbolPath(hash, "foo.pdb")); !bytes.Equal(data, foo) {
+		t.Fatalf("expect foo.pdb of ASBU intact")
+	}
+	purge(asbu)
+	if n := blobs(); n != 1 {
+		t.Fatalf("expect blob of foo.pdb removed, got %d blobs", n)
+	}
+}
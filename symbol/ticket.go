@@ -0,0 +1,200 @@
+package symbol
+
+import (
+	"encoding/json"
+	"fmt"
+	"io/ioutil"
+	"regexp"
+	"sort"
+	"strings"
+
+	"github.com/adyzng/GoSymbols/audit"
+	"github.com/adyzng/GoSymbols/config"
+	"github.com/adyzng/GoSymbols/event"
+	log "gopkg.in/clog.v1"
+)
+
+const (
+	ticketsJSON = "tickets.json" // Jira issues linked to builds in 000Admin, build ID => issue keys
+)
+
+var (
+	ErrTicketKey = fmt.Errorf("invalid issue key, expect eg: UDP-123")
+)
+
+var (
+	ticketKey    = regexp.MustCompile(`^[A-Z][A-Z0-9_]+-[1-9][0-9]*$`)
+	ticketInText = regexp.MustCompile(`\b[A-Z][A-Z0-9_]+-[1-9][0-9]*\b`)
+)
+
+// buildTickets read issues linked to builds from 000Admin/tickets.json
+func (b *BrBuilder) buildTickets() map[string][]string {
+	tickets := make(map[string][]string)
+	data, err := ioutil.ReadFile(b.branchFile(ticketsJSON))
+	if err != nil {
+		return tickets
+	}
+	if err = json.Unmarshal(data, &tickets); err != nil {
+		log.Error(2, "[Branch] Invalid %s of %s: %v.", ticketsJSON, b.Name(), err)
+	}
+	return tickets
+}
+
+func (b *BrBuilder) saveTickets(tickets map[string][]string) error {
+	data, _ := json.MarshalIndent(tickets, "", "\t")
+	return writeFileAtomic(b.branchFile(ticketsJSON), data)
+}
+
+// normalizeTickets upper case, check, dedupe and sort issue keys
+func normalizeTickets(keys []string) ([]string, error) {
+	seen := make(map[string]bool, len(keys))
+	arr := make([]string, 0, len(keys))
+	for _, key := range keys {
+		key = strings.ToUpper(strings.TrimSpace(key))
+		if !ticketKey.MatchString(key) {
+			return nil, ErrTicketKey
+		}
+		if !seen[key] {
+			seen[key] = true
+			arr = append(arr, key)
+		}
+	}
+	sort.Strings(arr)
+	return arr, nil
+}
+
+// parseTickets return issue keys of `projects` mentioned in `text`. Other keys are left
+// out, so `UTF-8` or `X64-2` are not taken as issues.
+func parseTickets(text string, projects []string) []string {
+	var keys []string
+	for _, key := range ticketInText.FindAllString(text, -1) {
+		project := key[:strings.LastIndex(key, "-")]
+		for _, p := range projects {
+			if strings.EqualFold(strings.TrimSpace(p), project) {
+				keys = append(keys, key)
+				break
+			}
+		}
+	}
+	return keys
+}
+
+// linkTickets link issues in build-info.json of `version` to ingested `build`, `tickets`
+// and keys of `[jira] PROJECTS` in `changes`. Invalid keys are warned and skipped.
+func (b *BrBuilder) linkTickets(build *Build, version string) error {
+	info := b.readBuildInfo(version)
+	var keys []string
+	for _, key := range append(info.Tickets, parseTickets(info.Changes, config.JiraProjects)...) {
+		if k, err := normalizeTickets([]string{key}); err == nil {
+			keys = append(keys, k...)
+		} else {
+			log.Warn("[Branch] Invalid issue key %q in %s of build %s.", key, buildInfoJSON, version)
+		}
+	}
+	if len(keys) == 0 {
+		return nil
+	}
+	keys, _ = normalizeTickets(keys)
+
+	tickets := b.buildTickets()
+	tickets[build.ID] = keys
+	if err := b.saveTickets(tickets); err != nil {
+		return err
+	}
+	b.mx.Lock()
+	build.Tickets = keys
+	b.mx.Unlock()
+	log.Info("[Branch] Build %s of %s linked to %s.", version, b.Name(), strings.Join(keys, ", "))
+	return nil
+}
+
+// SetTickets replace issues linked to build `buildID`. Newly linked issues of a complete
+// build are commented on by the Jira bus of events.
+//
+func (b *BrBuilder) SetTickets(buildID string, keys []string, user string) ([]string, error) {
+	keys, err := normalizeTickets(keys)
+	if err != nil {
+		return nil, err
+	}
+	build := b.getBuild("", padID(buildID))
+	if build == nil || build.SupplementOf != "" {
+		return nil, ErrBuildNotExist
+	}
+
+	b.ingMx.Lock()
+	defer b.ingMx.Unlock()
+	tickets := b.buildTickets()
+	linked := make(map[string]bool)
+	for _, key := range tickets[build.ID] {
+		linked[key] = true
+	}
+	var added []string
+	for _, key := range keys {
+		if !linked[key] {
+			added = append(added, key)
+		}
+	}
+	if len(keys) == 0 {
+		delete(tickets, build.ID)
+	} else {
+		tickets[build.ID] = keys
+	}
+	if err = b.saveTickets(tickets); err != nil {
+		log.Error(2, "[Branch] Save tickets of %s failed: %v.", b.Name(), err)
+		return nil, err
+	}
+	b.mx.Lock()
+	build.Tickets = keys
+	status := build.Status
+	b.mx.Unlock()
+
+	audit.Record(user, "tickets", b.Name(), "build %s (%s) linked to [%s]", build.Version, build.ID, strings.Join(keys, ", "))
+	if len(added) > 0 && (status == StatusComplete || status == StatusArchived) {
+		b.publish(event.KindTicketLinked, build.Version, []*Build{{ID: build.ID, Tickets: added}}, "")
+	}
+	return keys, nil
+}
+
+// mergeTickets copy linked issues of `src` into the branch with build IDs re-keyed by `ids`
+func (b *BrBuilder) mergeTickets(src *BrBuilder, ids map[string]string) error {
+	moved := src.buildTickets()
+	if len(moved) == 0 {
+		return nil
+	}
+	tickets := b.buildTickets()
+	for id, keys := range moved {
+		if nid, ok := ids[id]; ok {
+			tickets[nid] = keys
+		}
+	}
+	return b.saveTickets(tickets)
+}
+
+// TicketBuilds return builds of all branches linked to issue `key`, newest first.
+//
+func (ss *sserver) TicketBuilds(key string) []*Build {
+	key = strings.ToUpper(strings.TrimSpace(key))
+	arr := make([]*Build, 0)
+	ss.WalkBuilders(func(bu Builder) error {
+		b, ok := bu.(*BrBuilder)
+		if !ok {
+			return nil
+		}
+		for id, keys := range b.buildTickets() {
+			for _, k := range keys {
+				if k != key {
+					continue
+				}
+				if build := b.getBuild("", id); build != nil {
+					arr = append(arr, build)
+				}
+				break
+			}
+		}
+		return nil
+	})
+	sort.Slice(arr, func(i, j int) bool {
+		return arr[i].Date > arr[j].Date
+	})
+	return arr
+}
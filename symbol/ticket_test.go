@@ -0,0 +1,77 @@
+package symbol
+
+import (
+	"context"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/adyzng/GoSymbols/config"
+	"github.com/adyzng/GoSymbols/event"
+)
+
+func TestTickets(t *testing.T) {
+	root, err := ioutil.TempDir("", "ticket")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(root)
+	defer func(file, journal string, projects []string) {
+		config.AuditFile, config.EventJournal, config.JiraProjects = file, journal, projects
+	}(config.AuditFile, config.EventJournal, config.JiraProjects)
+	config.AuditFile = filepath.Join(root, "audit.log")
+	config.EventJournal = filepath.Join(root, "events.log")
+	config.JiraProjects = []string{"UDP"}
+
+	admin := filepath.Join(root, adminDir)
+	os.MkdirAll(admin, 0755)
+	server := ""
+	for i, version := range []string{"100", "101"} {
+		id := padID(string('1' + byte(i)))
+		ioutil.WriteFile(filepath.Join(admin, id), []byte("\"ca_a.pdb\\A"+version+"\",\"S:\\000Unzip\\ca_a.pdb\"\r\n"), 0644)
+		server += id + ",add,file,07/0" + string('4'+byte(i)) + "/2017,14:44:14,\"test\",\"" + version + "\",\"\",\r\n"
+	}
+	ioutil.WriteFile(filepath.Join(admin, serverTxt), []byte(server), 0644)
+	info := filepath.Join(root, buildDirPrefix+"100", buildInfoJSON)
+	os.MkdirAll(filepath.Dir(info), 0755)
+	ioutil.WriteFile(info, []byte(`{"tickets": ["asbu-7", "bad key"], "changes": "UDP-12: fix UTF-8 names, see UDP-12 and X64-2"}`), 0644)
+
+	b := NewBranch2(&Branch{StoreName: "TicketTest", StorePath: root, BuildPath: root}).(*BrBuilder)
+	b.ParseBuilds(context.Background(), nil)
+	build := b.getBuild("100", "")
+	if err = b.linkTickets(build, "100"); err != nil {
+		t.Fatal(err)
+	}
+	if len(build.Tickets) != 2 || build.Tickets[0] != "ASBU-7" || build.Tickets[1] != "UDP-12" {
+		t.Fatalf("expect tickets of build-info.json linked, got %v", build.Tickets)
+	}
+
+	if _, err = b.SetTickets("2", []string{"UDP 1"}, "test"); err != ErrTicketKey {
+		t.Fatalf("expect invalid key refused, got %v", err)
+	}
+	keys, err := b.SetTickets("2", []string{"udp-12", "UDP-13"}, "test")
+	if err != nil || len(keys) != 2 {
+		t.Fatalf("unexpected tickets %v (%v)", keys, err)
+	}
+	events, _ := event.Read(0, 10)
+	if len(events) != 1 || events[0].Kind != event.KindTicketLinked || len(events[0].Tickets) != 2 {
+		t.Errorf("expect linked tickets published, got %+v", events)
+	}
+
+	ss := &sserver{builders: map[string]Builder{"tickettest": b}}
+	found := ss.TicketBuilds("udp-12")
+	if len(found) != 2 || found[0].Version != "101" {
+		t.Fatalf("expect 2 builds of UDP-12 newest first, got %+v", found)
+	}
+
+	// loaded with builds
+	b.builds = make(map[string]*Build)
+	b.ParseBuilds(context.Background(), nil)
+	if build = b.getBuild("101", ""); len(build.Tickets) != 2 {
+		t.Errorf("expect tickets loaded with builds, got %v", build.Tickets)
+	}
+	if _, err = b.SetTickets("1", nil, "test"); err != nil || len(ss.TicketBuilds("ASBU-7")) != 0 {
+		t.Errorf("expect tickets of build 1 unlinked, got %v", err)
+	}
+}
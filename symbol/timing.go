@@ -0,0 +1,147 @@
+package symbol
+
+import (
+	"bufio"
+	"context"
+	"fmt"
+	"os"
+	"path/filepath"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+
+	log "gopkg.in/clog.v1"
+)
+
+const (
+	timingsTxt = "timings.txt" // ingest stage durations, `{ID},{copy},{unzip},{symstore},{metadata},{bytes}` in ms
+)
+
+// StageTimings is the duration of each ingest stage in milliseconds
+//
+type StageTimings struct {
+	Copy     int64 `json:"copy"`     // copy debug zip from build server
+	Unzip    int64 `json:"unzip"`    // extract symbols to 000Unzip and scan them
+	SymStore int64 `json:"symstore"` // key conflict check and symstore.exe
+	Metadata int64 `json:"metadata"` // checksums, signature status and build records
+	Total    int64 `json:"total"`
+	Bytes    int64 `json:"bytes"` // size of the copied zip
+}
+
+// stageClock measure consecutive stages
+type stageClock struct {
+	t      time.Time
+	start  time.Time
+	timing StageTimings
+}
+
+func newStageClock() *stageClock {
+	t := now()
+	return &stageClock{t: t, start: t}
+}
+
+// lap store milliseconds since last lap to `stage`
+func (c *stageClock) lap(stage *int64) {
+	t := now()
+	*stage = int64(t.Sub(c.t) / time.Millisecond)
+	c.t = t
+}
+
+// done finish the timing with total duration
+func (c *stageClock) done() *StageTimings {
+	c.timing.Total = int64(now().Sub(c.start) / time.Millisecond)
+	return &c.timing
+}
+
+// recordTimings attach timings to build and append them to 000Admin/timings.txt
+func (b *BrBuilder) recordTimings(build *Build, t *StageTimings) {
+	b.mx.Lock()
+	build.Stages = t
+	b.mx.Unlock()
+	observeStages(t)
+
+	fpath := filepath.Join(b.StorePath, adminDir, timingsTxt)
+	fd, err := os.OpenFile(fpath, os.O_WRONLY|os.O_CREATE|os.O_APPEND, 0644)
+	if err != nil {
+		log.Warn("[Branch] Open %s failed: %v.", fpath, err)
+		return
+	}
+	defer fd.Close()
+	fmt.Fprintf(fd, "%s,%d,%d,%d,%d,%d\r\n", build.ID, t.Copy, t.Unzip, t.SymStore, t.Metadata, t.Bytes)
+	log.Info("[Branch] Build %s of %s stages: copy %dms (%d bytes), unzip %dms, symstore %dms, metadata %dms.",
+		build.Version, b.Name(), t.Copy, t.Bytes, t.Unzip, t.SymStore, t.Metadata)
+}
+
+// stageTimings read 000Admin/timings.txt, transaction ID => timings
+func (b *BrBuilder) stageTimings() map[string]*StageTimings {
+	timings := make(map[string]*StageTimings)
+	fd, err := os.Open(filepath.Join(b.StorePath, adminDir, timingsTxt))
+	if err != nil {
+		return timings
+	}
+	defer fd.Close()
+
+	scan := bufio.NewScanner(fd)
+	for scan.Scan() {
+		ss := strings.Split(strings.TrimSpace(scan.Text()), ",")
+		if len(ss) != 6 {
+			continue
+		}
+		var v [5]int64
+		for i := range v {
+			v[i], _ = strconv.ParseInt(ss[i+1], 10, 64)
+		}
+		timings[ss[0]] = &StageTimings{
+			Copy:     v[0],
+			Unzip:    v[1],
+			SymStore: v[2],
+			Metadata: v[3],
+			Total:    v[0] + v[1] + v[2] + v[3],
+			Bytes:    v[4],
+		}
+	}
+	return timings
+}
+
+// BuildTiming is the stage timings of one ingested build
+//
+type BuildTiming struct {
+	Branch  string `json:"branch"`
+	ID      string `json:"id"`
+	Version string `json:"version"`
+	Date    string `json:"date"`
+	*StageTimings
+}
+
+// IngestTimings return stage timings of the latest `n` ingested builds of all branches
+// (or the given branch), newest first. n <= 0 return all.
+//
+func (ss *sserver) IngestTimings(branch string, n int) []*BuildTiming {
+	var arr []*BuildTiming
+	ss.WalkBuilders(func(bu Builder) error {
+		if branch != "" && !strings.EqualFold(branch, bu.Name()) {
+			return nil
+		}
+		bu.ParseBuilds(context.Background(), func(build *Build) error {
+			if build.Stages != nil {
+				arr = append(arr, &BuildTiming{
+					Branch:       bu.Name(),
+					ID:           build.ID,
+					Version:      build.Version,
+					Date:         build.Date,
+					StageTimings: build.Stages,
+				})
+			}
+			return nil
+		})
+		return nil
+	})
+	sort.Slice(arr, func(i, j int) bool {
+		return arr[i].Date > arr[j].Date
+	})
+	if n > 0 && len(arr) > n {
+		arr = arr[:n]
+	}
+	return arr
+}
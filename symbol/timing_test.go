@@ -0,0 +1,50 @@
+package symbol
+
+import (
+	"context"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+)
+
+func TestStageTimings(t *testing.T) {
+	root, err := ioutil.TempDir("", "timing")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(root)
+
+	admin := filepath.Join(root, adminDir)
+	os.MkdirAll(admin, 0755)
+	ioutil.WriteFile(filepath.Join(admin, serverTxt), []byte(
+		"0000000001,add,file,07/04/2017,14:44:14,\"test\",\"100\",\"\",\r\n"+
+			"0000000002,add,file,07/05/2017,14:44:14,\"test\",\"101\",\"\",\r\n"), 0644)
+
+	clock := newStageClock()
+	time.Sleep(time.Millisecond * 5)
+	clock.lap(&clock.timing.Copy)
+	clock.lap(&clock.timing.Unzip)
+	timing := clock.done()
+	if timing.Copy < 5 || timing.Total < timing.Copy {
+		t.Fatalf("unexpected timing %+v", timing)
+	}
+
+	b := NewBranch2(&Branch{StoreName: "test", StorePath: root, BuildPath: root}).(*BrBuilder)
+	if _, err := b.ParseBuilds(context.Background(), nil); err != nil {
+		t.Fatal(err)
+	}
+	b.recordTimings(b.getBuild("", "0000000002"), &StageTimings{Copy: 1200, Unzip: 300, SymStore: 4000, Metadata: 50, Bytes: 1 << 20})
+
+	// reload from admin files
+	b = NewBranch2(&Branch{StoreName: "test", StorePath: root, BuildPath: root}).(*BrBuilder)
+	ss := &sserver{builders: map[string]Builder{"test": b}}
+	arr := ss.IngestTimings("", 0)
+	if len(arr) != 1 || arr[0].ID != "0000000002" || arr[0].SymStore != 4000 || arr[0].Total != 5550 || arr[0].Bytes != 1<<20 {
+		t.Fatalf("unexpected timings %+v", arr)
+	}
+	if b.getBuild("", "0000000001").Stages != nil {
+		t.Fatal("build without timings should have nil stages")
+	}
+}
@@ -0,0 +1,117 @@
+package symbol
+
+import (
+	"container/list"
+	"strings"
+	"sync"
+
+	"github.com/adyzng/GoSymbols/config"
+)
+
+// TxCacheStats is the usage of the cache of parsed transactions
+//
+type TxCacheStats struct {
+	Hits         int64 `json:"hits"`
+	Misses       int64 `json:"misses"`
+	Evictions    int64 `json:"evictions"`
+	Transactions int   `json:"transactions"` // cached transactions (builds and supplements)
+	Symbols      int   `json:"symbols"`      // symbol lines of the cached transactions
+	MaxSymbols   int   `json:"maxSymbols"`
+}
+
+// txCached is one parsed transaction file
+type txCached struct {
+	key     string // {store}\{id}
+	stamp   string // size and mod time of the file when parsed
+	entries []*txEntry
+}
+
+// txCache keep symbols of recently browsed builds of all branches in memory, bounded by
+// `[base] SYMBOL_CACHE` symbol lines. The least recently used transactions are evicted,
+// so memory doesn't grow with the number of builds of huge branches.
+type txCache struct {
+	mx      sync.Mutex
+	lru     *list.List               // front is most recently used, of *txCached
+	index   map[string]*list.Element // key => element
+	symbols int
+	counter TxCacheStats
+}
+
+var transactions = &txCache{
+	lru:   list.New(),
+	index: make(map[string]*list.Element),
+}
+
+// get return cached entries of transaction `id` of `store`, if the file is still `stamp`.
+// Entries are shared, callers must not modify them.
+func (c *txCache) get(store, id, stamp string) ([]*txEntry, bool) {
+	c.mx.Lock()
+	defer c.mx.Unlock()
+	if elem, ok := c.index[store+"\\"+id]; ok {
+		if tx := elem.Value.(*txCached); tx.stamp == stamp {
+			c.lru.MoveToFront(elem)
+			c.counter.Hits++
+			return tx.entries, true
+		}
+		c.remove(elem)
+	}
+	c.counter.Misses++
+	return nil, false
+}
+
+// put cache parsed `entries` of transaction `id`, evict the least recently used ones
+// beyond the limit. Transactions bigger than the whole cache are not kept.
+func (c *txCache) put(store, id, stamp string, entries []*txEntry) {
+	limit := config.SymbolCache
+	if stamp == "" || len(entries) > limit {
+		return
+	}
+	c.mx.Lock()
+	defer c.mx.Unlock()
+	key := store + "\\" + id
+	if elem, ok := c.index[key]; ok {
+		c.remove(elem)
+	}
+	c.index[key] = c.lru.PushFront(&txCached{key: key, stamp: stamp, entries: entries})
+	c.symbols += len(entries)
+	for c.symbols > limit {
+		c.remove(c.lru.Back())
+		c.counter.Evictions++
+	}
+}
+
+// remove drop `elem` from cache, caller hold `mx`
+func (c *txCache) remove(elem *list.Element) {
+	tx := c.lru.Remove(elem).(*txCached)
+	delete(c.index, tx.key)
+	c.symbols -= len(tx.entries)
+}
+
+// purge drop all cached transactions of `store`, eg: the branch is deleted or reloaded
+func (c *txCache) purge(store string) {
+	c.mx.Lock()
+	defer c.mx.Unlock()
+	prefix := store + "\\"
+	for elem := c.lru.Front(); elem != nil; {
+		next := elem.Next()
+		if strings.HasPrefix(elem.Value.(*txCached).key, prefix) {
+			c.remove(elem)
+		}
+		elem = next
+	}
+}
+
+// stats of the cache
+func (c *txCache) stats() *TxCacheStats {
+	c.mx.Lock()
+	defer c.mx.Unlock()
+	stats := c.counter
+	stats.Transactions, stats.Symbols, stats.MaxSymbols = c.lru.Len(), c.symbols, config.SymbolCache
+	return &stats
+}
+
+// SymbolCache return usage of the cache of symbols of recently browsed builds.
+//
+func (ss *sserver) SymbolCache() *TxCacheStats {
+	return transactions.stats()
+}
@@ -0,0 +1,82 @@
+package symbol
+
+import (
+	"container/list"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/adyzng/GoSymbols/config"
+)
+
+func TestTxCache(t *testing.T) {
+	defer func(n int) { config.SymbolCache = n }(config.SymbolCache)
+	config.SymbolCache = 5
+	c := &txCache{lru: list.New(), index: make(map[string]*list.Element)}
+	entries := func(n int) []*txEntry {
+		arr := make([]*txEntry, n)
+		for i := range arr {
+			arr[i] = &txEntry{Name: "a.pdb", Hash: "A1"}
+		}
+		return arr
+	}
+
+	c.put("UDP", "0000000001", "s1", entries(2))
+	c.put("UDP", "0000000002", "s2", entries(2))
+	if _, ok := c.get("UDP", "0000000001", "s1"); !ok {
+		t.Fatalf("expect transaction 1 cached")
+	}
+	// 2 is the least recently used
+	c.put("ASBU", "0000000001", "s3", entries(2))
+	if _, ok := c.get("UDP", "0000000002", "s2"); ok {
+		t.Errorf("expect transaction 2 evicted")
+	}
+	if _, ok := c.get("UDP", "0000000001", "s1-changed"); ok {
+		t.Errorf("expect changed transaction file parsed again")
+	}
+	c.put("UDP", "0000000003", "s4", entries(6))
+	c.put("UDP", "0000000004", "s5", entries(1))
+	c.purge("UDP")
+	if _, ok := c.get("ASBU", "0000000001", "s3"); !ok {
+		t.Errorf("expect other store kept")
+	}
+
+	stats := c.stats()
+	if stats.Transactions != 1 || stats.Symbols != 2 || stats.Evictions != 1 || stats.Hits != 2 || stats.Misses != 2 {
+		t.Errorf("unexpected stats %+v", stats)
+	}
+}
+
+func TestReadTransactionCached(t *testing.T) {
+	root, err := ioutil.TempDir("", "txcache")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(root)
+	defer func(n int) { config.SymbolCache = n }(config.SymbolCache)
+	config.SymbolCache = 100
+
+	admin := filepath.Join(root, adminDir)
+	os.MkdirAll(admin, 0755)
+	idPath := filepath.Join(admin, "0000000001")
+	ioutil.WriteFile(idPath, []byte("\"a.pdb\\A1\",\"S:\\000Unzip\\a.pdb\"\r\n"), 0644)
+	b := NewBranch2(&Branch{StoreName: "TxCacheTest", StorePath: root}).(*BrBuilder)
+	defer transactions.purge(b.StoreName)
+
+	first, err := b.readTransaction("0000000001")
+	if err != nil || len(first) != 1 {
+		t.Fatalf("unexpected entries %v (%v)", first, err)
+	}
+	again, _ := b.readTransaction("0000000001")
+	if len(again) != 1 || again[0] != first[0] {
+		t.Errorf("expect entries from cache")
+	}
+
+	ioutil.WriteFile(idPath, []byte("\"a.pdb\\A1\",\"S:\\000Unzip\\a.pdb\"\r\n\"b.pdb\\B1\",\"S:\\000Unzip\\b.pdb\"\r\n"), 0644)
+	os.Chtimes(idPath, time.Now(), time.Now().Add(time.Minute))
+	if changed, _ := b.readTransaction("0000000001"); len(changed) != 2 {
+		t.Errorf("expect changed file parsed again, got %d entries", len(changed))
+	}
+}
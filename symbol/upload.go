@@ -0,0 +1,252 @@
+package symbol
+
+import (
+	"archive/zip"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"strings"
+	"sync"
+
+	"github.com/adyzng/GoSymbols/config"
+	"github.com/adyzng/GoSymbols/util"
+	log "gopkg.in/clog.v1"
+)
+
+var (
+	ErrUploadOffset   = fmt.Errorf("chunk offset doesn't match the bytes received")
+	ErrUploadTooLarge = fmt.Errorf("upload exceed [upload] MAX_SIZE")
+	ErrUploadBusy     = fmt.Errorf("build is being uploaded by another request")
+	ErrUploadVersion  = fmt.Errorf("invalid build version")
+	ErrUploadEmpty    = fmt.Errorf("no symbol file uploaded")
+)
+
+var (
+	uploadMx  sync.Mutex
+	uploading = make(map[string]bool) // upload path => being written
+)
+
+// Upload is the debug zip of a build pushed over http by a build agent, instead of copied
+// from the build share. It's ingested by the same pipeline once complete.
+//
+type Upload struct {
+	Branch   string `json:"branch"`
+	Version  string `json:"version"`
+	Size     int64  `json:"size"`            // bytes received
+	Files    int    `json:"files,omitempty"` // symbol files pushed one by one and packed into the debug zip
+	Complete bool   `json:"complete"`        // the debug zip is ready for ingest
+}
+
+// uploadPath return path of the debug zip uploaded for `version`
+func (b *BrBuilder) uploadPath(version string) string {
+	return filepath.Join(config.UploadDir, b.StoreName, version, config.PDBZipFile)
+}
+
+// beginUpload claim the upload of `version`, return the path of the partial file and
+// the function to release it
+func (b *BrBuilder) beginUpload(version string) (string, func(), error) {
+	if version == "" || strings.ContainsAny(version, "/\\:") || strings.Contains(version, "..") {
+		return "", nil, ErrUploadVersion
+	}
+	if err := b.writable(); err != nil {
+		return "", nil, err
+	}
+	part := b.uploadPath(version) + ".part"
+	uploadMx.Lock()
+	defer uploadMx.Unlock()
+	if uploading[part] {
+		return "", nil, ErrUploadBusy
+	}
+	if err := os.MkdirAll(filepath.Dir(part), 0755); err != nil {
+		return "", nil, err
+	}
+	uploading[part] = true
+	return part, func() {
+		uploadMx.Lock()
+		delete(uploading, part)
+		uploadMx.Unlock()
+	}, nil
+}
+
+// uploadLimit wrap `r` so reading past `[upload] MAX_SIZE` from `offset` fail
+func uploadLimit(r io.Reader, offset int64) io.Reader {
+	if config.UploadMaxSize <= 0 {
+		return r
+	}
+	return &limitReader{r: r, n: config.UploadMaxSize<<20 - offset}
+}
+
+// limitReader fail with ErrUploadTooLarge once more than `n` bytes are read
+type limitReader struct {
+	r io.Reader
+	n int64
+}
+
+func (l *limitReader) Read(p []byte) (int, error) {
+	n, err := l.r.Read(p)
+	if l.n -= int64(n); l.n < 0 {
+		return n, ErrUploadTooLarge
+	}
+	return n, err
+}
+
+// AppendUpload write a chunk of the debug zip of `version` at `offset`, which must be the
+// bytes received so far, 0 start over. Call FinishUpload after the last chunk. On
+// ErrUploadOffset the returned upload tell where to resume.
+//
+func (b *BrBuilder) AppendUpload(version string, offset int64, body io.Reader) (*Upload, error) {
+	part, release, err := b.beginUpload(version)
+	if err != nil {
+		return nil, err
+	}
+	defer release()
+
+	up := &Upload{Branch: b.Name(), Version: version}
+	flag := os.O_WRONLY | os.O_CREATE
+	if offset == 0 {
+		flag |= os.O_TRUNC
+	}
+	fd, err := os.OpenFile(part, flag, 0644)
+	if err != nil {
+		return nil, err
+	}
+	defer fd.Close()
+	if up.Size, err = fd.Seek(0, io.SeekEnd); err != nil {
+		return nil, err
+	}
+	if up.Size != offset {
+		return up, ErrUploadOffset
+	}
+
+	n, err := io.Copy(fd, uploadLimit(body, offset))
+	up.Size += n
+	if err == ErrUploadTooLarge {
+		fd.Close()
+		os.Remove(part)
+		up.Size = 0
+	}
+	return up, err
+}
+
+// UploadFiles pack symbol files pushed one by one into the debug zip of `version` and
+// finish the upload. `next` return the name and content of each file, io.EOF after the last.
+//
+func (b *BrBuilder) UploadFiles(version string, next func() (string, io.Reader, error)) (*Upload, error) {
+	part, release, err := b.beginUpload(version)
+	if err != nil {
+		return nil, err
+	}
+	defer release()
+
+	fd, err := os.OpenFile(part, os.O_WRONLY|os.O_CREATE|os.O_TRUNC, 0644)
+	if err != nil {
+		return nil, err
+	}
+	up := &Upload{Branch: b.Name(), Version: version}
+	zw := zip.NewWriter(fd)
+	err = func() error {
+		for {
+			name, r, err := next()
+			if err == io.EOF {
+				return nil
+			} else if err != nil {
+				return err
+			}
+			name = filepath.Base(strings.Replace(name, "\\", "/", -1))
+			if name == "." || name == "/" || name == ".." {
+				return fmt.Errorf("invalid file name %s", name)
+			}
+			w, err := zw.CreateHeader(&zip.FileHeader{Name: name, Method: zip.Deflate, Modified: now()})
+			if err != nil {
+				return err
+			}
+			n, err := io.Copy(w, uploadLimit(r, up.Size))
+			if up.Size += n; err != nil {
+				return err
+			}
+			up.Files++
+		}
+	}()
+	if err == nil && up.Files == 0 {
+		err = ErrUploadEmpty
+	}
+	if cerr := zw.Close(); err == nil {
+		err = cerr
+	}
+	fd.Close()
+	if err != nil {
+		os.Remove(part)
+		return nil, err
+	}
+
+	done, err := b.finishUpload(version, part)
+	if err != nil {
+		return nil, err
+	}
+	done.Files = up.Files
+	return done, nil
+}
+
+// FinishUpload check the uploaded debug zip of `version` is a valid zip and make it ready
+// for ingest, the build is then added from it instead of the build share.
+//
+func (b *BrBuilder) FinishUpload(version string) (*Upload, error) {
+	part, release, err := b.beginUpload(version)
+	if err != nil {
+		return nil, err
+	}
+	defer release()
+	return b.finishUpload(version, part)
+}
+
+// finishUpload move the checked partial file `part` to the upload of `version`, caller
+// hold the upload. Zip with names leaving the extract folder is refused.
+func (b *BrBuilder) finishUpload(version, part string) (*Upload, error) {
+	zr, err := zip.OpenReader(part)
+	if err != nil {
+		log.Error(2, "[Upload] Invalid debug zip of %s build %s: %v.", b.Name(), version, err)
+		os.Remove(part)
+		return nil, err
+	}
+	for _, file := range zr.File {
+		if !util.SafeZipName(file.Name) {
+			err = fmt.Errorf("unsafe file name %s in debug zip", file.Name)
+			break
+		}
+	}
+	zr.Close()
+	if err != nil {
+		log.Error(2, "[Upload] Invalid debug zip of %s build %s: %v.", b.Name(), version, err)
+		os.Remove(part)
+		return nil, err
+	}
+	st, err := os.Stat(part)
+	if err != nil {
+		return nil, err
+	}
+	if err = os.Rename(part, b.uploadPath(version)); err != nil {
+		return nil, err
+	}
+	log.Info("[Upload] Build %s of %s uploaded, %d bytes.", version, b.Name(), st.Size())
+	return &Upload{Branch: b.Name(), Version: version, Size: st.Size(), Complete: true}, nil
+}
+
+// uploaded return the complete upload of `version`, empty if not uploaded
+func (b *BrBuilder) uploaded(version string) string {
+	fzip := b.uploadPath(version)
+	if st, err := os.Stat(fzip); err != nil || st.IsDir() {
+		return ""
+	}
+	return fzip
+}
+
+// dropUpload remove the upload of `version` once it's ingested
+func (b *BrBuilder) dropUpload(version string) {
+	if b.uploaded(version) == "" {
+		return
+	}
+	if err := os.RemoveAll(filepath.Dir(b.uploadPath(version))); err != nil {
+		log.Warn("[Upload] Remove upload of %s build %s failed: %v.", b.Name(), version, err)
+	}
+}
@@ -0,0 +1,115 @@
+package symbol
+
+import (
+	"archive/zip"
+	"bytes"
+	"context"
+	"io"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/adyzng/GoSymbols/config"
+)
+
+func TestUpload(t *testing.T) {
+	root, err := ioutil.TempDir("", "upload")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(root)
+	defer func(dir string, size int64) {
+		config.UploadDir, config.UploadMaxSize = dir, size
+	}(config.UploadDir, config.UploadMaxSize)
+	config.UploadDir, config.UploadMaxSize = filepath.Join(root, "uploads"), 0
+
+	buf := &bytes.Buffer{}
+	zw := zip.NewWriter(buf)
+	w, _ := zw.Create("x64/foo.pdb")
+	w.Write([]byte("pdb"))
+	zw.Close()
+	data := buf.Bytes()
+
+	b := NewBranch2(&Branch{StoreName: "UDP", StorePath: filepath.Join(root, "store")}).(*BrBuilder)
+	if _, err = b.AppendUpload("../100", 0, bytes.NewReader(data)); err != ErrUploadVersion {
+		t.Errorf("expect invalid version, got %v", err)
+	}
+
+	// two chunks, the second one resent at a wrong offset first
+	half := int64(len(data) / 2)
+	if up, err := b.AppendUpload("100", 0, bytes.NewReader(data[:half])); err != nil || up.Size != half || up.Complete {
+		t.Fatalf("unexpected first chunk %+v (%v)", up, err)
+	}
+	if up, err := b.AppendUpload("100", 1, bytes.NewReader(data[half:])); err != ErrUploadOffset || up.Size != half {
+		t.Fatalf("expect offset mismatch at %d, got %+v (%v)", half, up, err)
+	}
+	if _, err = b.AppendUpload("100", half, bytes.NewReader(data[half:])); err != nil {
+		t.Fatal(err)
+	}
+	if b.uploaded("100") != "" {
+		t.Errorf("upload should not be ready before finish")
+	}
+	if up, err := b.FinishUpload("100"); err != nil || !up.Complete || up.Size != int64(len(data)) {
+		t.Fatalf("unexpected finish %+v (%v)", up, err)
+	}
+	if fzip, err := b.getSymbols(context.Background(), "100"); err != nil || fzip != b.uploadPath("100") {
+		t.Errorf("ingest should use the upload, got %s (%v)", fzip, err)
+	}
+	b.dropUpload("100")
+	if _, err = os.Stat(filepath.Dir(b.uploadPath("100"))); !os.IsNotExist(err) {
+		t.Errorf("upload not removed: %v", err)
+	}
+
+	// not a zip
+	b.AppendUpload("101", 0, strings.NewReader("garbage"))
+	if _, err = b.FinishUpload("101"); err == nil || b.uploaded("101") != "" {
+		t.Errorf("invalid zip should be refused")
+	}
+
+	// entry leaving the extract folder
+	buf.Reset()
+	zw = zip.NewWriter(buf)
+	w, _ = zw.Create("../../evil.dll")
+	w.Write([]byte("dll"))
+	zw.Close()
+	b.AppendUpload("104", 0, bytes.NewReader(buf.Bytes()))
+	if _, err = b.FinishUpload("104"); err == nil || b.uploaded("104") != "" {
+		t.Errorf("zip with traversal entry should be refused")
+	}
+	if _, err = os.Stat(b.uploadPath("104") + ".part"); !os.IsNotExist(err) {
+		t.Errorf("refused upload should be removed: %v", err)
+	}
+
+	// symbol files one by one
+	files := []string{"foo.pdb", "S:\\x64\\bar.exe"}
+	up, err := b.UploadFiles("102", func() (string, io.Reader, error) {
+		if len(files) == 0 {
+			return "", nil, io.EOF
+		}
+		name := files[0]
+		files = files[1:]
+		return name, strings.NewReader(name), nil
+	})
+	if err != nil || !up.Complete || up.Files != 2 {
+		t.Fatalf("unexpected upload %+v (%v)", up, err)
+	}
+	zr, err := zip.OpenReader(b.uploaded("102"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer zr.Close()
+	if len(zr.File) != 2 || zr.File[1].Name != "bar.exe" {
+		t.Errorf("unexpected packed files %v", zr.File)
+	}
+
+	config.UploadMaxSize = 1
+	big := bytes.NewReader(make([]byte, 2<<20))
+	if _, err = b.AppendUpload("103", 0, big); err != ErrUploadTooLarge {
+		t.Errorf("expect too large, got %v", err)
+	}
+	if _, err = os.Stat(b.uploadPath("103") + ".part"); !os.IsNotExist(err) {
+		t.Errorf("partial upload should be removed: %v", err)
+	}
+}
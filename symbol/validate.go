@@ -0,0 +1,255 @@
+package symbol
+
+import (
+	"encoding/json"
+	"fmt"
+	"io/ioutil"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"strings"
+
+	"github.com/adyzng/GoSymbols/alert"
+	"github.com/adyzng/GoSymbols/config"
+	"github.com/adyzng/GoSymbols/pdb"
+	log "gopkg.in/clog.v1"
+)
+
+const (
+	validationJSON = "validation.json" // pdb validation of builds in 000Admin, build ID => Validation
+)
+
+// Validation status of a failed symbol file
+const (
+	ValidCorrupt    = "corrupt"    // pdb header or stream directory can't be parsed
+	ValidMismatched = "mismatched" // binary built with another pdb (guid or age) than the one in the build
+)
+
+var (
+	ErrInvalidSymbols = fmt.Errorf("corrupt or mismatched pdbs, build rejected")
+)
+
+// SymbolCheck is the validation result of one symbol file
+//
+type SymbolCheck struct {
+	Name   string `json:"name"`
+	Path   string `json:"path"` // relative path in debug zip
+	Key    string `json:"key,omitempty"`
+	Status string `json:"status"`
+	Error  string `json:"error,omitempty"`
+}
+
+// Validation is the result of checking pdbs of a build before symstore, by `[validate] MODE`.
+// Files passed are only counted.
+//
+type Validation struct {
+	Mode    string         `json:"mode"` // native or symchk
+	Checked int            `json:"checked"`
+	Failed  []*SymbolCheck `json:"failed,omitempty"`
+}
+
+// SymChk run symchk.exe on binary `fpath` against pdbs under `symPath`, return why it
+// failed, empty if passed. Tests replace it with a fake one.
+//
+var SymChk = func(fpath, symPath string) (string, error) {
+	out, err := exec.Command(config.SymChkExe, "/if", fpath, "/s", symPath, "/od").CombinedOutput()
+	if _, ok := err.(*exec.ExitError); err != nil && !ok {
+		return "", err
+	}
+	return parseSymChk(string(out))
+}
+
+// parseSymChk take the reason of `SYMCHK: foo.dll FAILED - foo.pdb mismatched or not found`
+// from symchk output, empty if `SYMCHK: FAILED files = 0`
+func parseSymChk(out string) (string, error) {
+	reason := ""
+	for _, line := range strings.Split(out, "\n") {
+		line = strings.TrimSpace(line)
+		if !strings.HasPrefix(line, "SYMCHK:") {
+			continue
+		}
+		if strings.Contains(line, "FAILED files = 0") {
+			return "", nil
+		}
+		if idx := strings.Index(line, "FAILED  - "); idx != -1 && reason == "" {
+			reason = strings.TrimSpace(line[idx+len("FAILED  - "):])
+		}
+	}
+	if reason == "" {
+		return "", fmt.Errorf("unexpected symchk output: %s", strings.TrimSpace(out))
+	}
+	return reason, nil
+}
+
+// pdbName return lower case file name of the pdb path in codeview record, built on windows
+func pdbName(fpath string) string {
+	return strings.ToLower(fpath[strings.LastIndexAny(fpath, `\/`)+1:])
+}
+
+// validateSymbols check pdbs under `symPath` are well formed, and binaries match the pdbs
+// of the same name in the build by guid and age (or by symchk.exe). Binaries without pdb
+// in the build are not checked. Nil if validation is disabled.
+//
+func validateSymbols(symPath string) (*Validation, error) {
+	if config.ValidateMode == "" {
+		return nil, nil
+	}
+	v := &Validation{Mode: config.ValidateMode}
+	keys := make(map[string][]string) // pdb name => keys of pdbs in the build
+	var binaries []string
+	err := filepath.Walk(symPath, func(fpath string, info os.FileInfo, err error) error {
+		if err != nil || info.IsDir() {
+			return err
+		}
+		if pdb.IsBinary(info.Name()) {
+			binaries = append(binaries, fpath)
+			return nil
+		}
+		if strings.ToLower(filepath.Ext(info.Name())) != ".pdb" {
+			return nil
+		}
+		v.Checked++
+		key, err := pdb.Key(fpath)
+		if err != nil {
+			v.fail(symPath, fpath, "", ValidCorrupt, err.Error())
+			return nil
+		}
+		name := strings.ToLower(info.Name())
+		keys[name] = append(keys[name], key)
+		return nil
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	for _, fpath := range binaries {
+		fd, err := os.Open(fpath)
+		if err != nil {
+			return nil, err
+		}
+		cv, err := pdb.ReadCodeView(fd)
+		fd.Close()
+		if err == pdb.ErrCorrupted {
+			v.Checked++
+			v.fail(symPath, fpath, "", ValidCorrupt, err.Error())
+			continue
+		}
+		if err != nil {
+			// built without pdb
+			continue
+		}
+		name := pdbName(cv.Path)
+		if len(keys[name]) == 0 {
+			// its pdb is not shipped in the build
+			continue
+		}
+		v.Checked++
+		if config.ValidateMode == "symchk" {
+			reason, err := SymChk(fpath, symPath)
+			if err != nil {
+				log.Error(2, "[Branch] Run symchk on %s failed: %v.", fpath, err)
+				return nil, err
+			}
+			if reason != "" {
+				v.fail(symPath, fpath, cv.Key(), ValidMismatched, reason)
+			}
+			continue
+		}
+		matched := false
+		for _, key := range keys[name] {
+			matched = matched || key == cv.Key()
+		}
+		if !matched {
+			v.fail(symPath, fpath, cv.Key(), ValidMismatched,
+				fmt.Sprintf("built with %s %s, build has %s", name, cv.Key(), strings.Join(keys[name], ", ")))
+		}
+	}
+	return v, nil
+}
+
+// fail record failed file `fpath` under `symPath`
+func (v *Validation) fail(symPath, fpath, key, status, reason string) {
+	rel, _ := filepath.Rel(symPath, fpath)
+	v.Failed = append(v.Failed, &SymbolCheck{
+		Name:   filepath.Base(fpath),
+		Path:   filepath.ToSlash(rel),
+		Key:    key,
+		Status: status,
+		Error:  reason,
+	})
+}
+
+// summary of failed files for logs and alerts, the first few only
+func (v *Validation) summary() string {
+	arr := make([]string, 0, 5)
+	for i, c := range v.Failed {
+		if i == cap(arr) {
+			arr = append(arr, fmt.Sprintf("and %d more", len(v.Failed)-i))
+			break
+		}
+		arr = append(arr, fmt.Sprintf("%s %s (%s)", c.Path, c.Status, c.Error))
+	}
+	return strings.Join(arr, "; ")
+}
+
+// checkSymbols validate symbols of `version` under `symPath` before symstore. Bad pdbs
+// are alerted, and the ingest fails with ErrInvalidSymbols if `[validate] ACTION` is reject.
+func (b *BrBuilder) checkSymbols(version, symPath string) (*Validation, error) {
+	v, err := validateSymbols(symPath)
+	if err != nil || v == nil || len(v.Failed) == 0 {
+		return v, err
+	}
+	log.Warn("[Branch] %d of %d pdbs of build %s invalid: %s.", len(v.Failed), v.Checked, version, v.summary())
+	if config.ValidateAction == "reject" {
+		alert.Raise(alert.KindInvalidSymbols, b.Name(), "build %s rejected, %d pdbs invalid: %s", version, len(v.Failed), v.summary())
+		return v, fmt.Errorf("%v: %s", ErrInvalidSymbols, v.summary())
+	}
+	alert.Raise(alert.KindInvalidSymbols, b.Name(), "build %s ingested with %d invalid pdbs: %s", version, len(v.Failed), v.summary())
+	return v, nil
+}
+
+// buildValidations read validation of builds from 000Admin/validation.json
+func (b *BrBuilder) buildValidations() map[string]*Validation {
+	validations := make(map[string]*Validation)
+	data, err := ioutil.ReadFile(b.branchFile(validationJSON))
+	if err != nil {
+		return validations
+	}
+	if err = json.Unmarshal(data, &validations); err != nil {
+		log.Error(2, "[Branch] Invalid %s of %s: %v.", validationJSON, b.Name(), err)
+	}
+	return validations
+}
+
+func (b *BrBuilder) saveValidations(validations map[string]*Validation) error {
+	data, _ := json.MarshalIndent(validations, "", "\t")
+	return writeFileAtomic(b.branchFile(validationJSON), data)
+}
+
+// recordValidation attach validation `v` to ingested `build` and save it
+func (b *BrBuilder) recordValidation(build *Build, v *Validation) error {
+	if v == nil {
+		return nil
+	}
+	b.mx.Lock()
+	build.Validation = v
+	b.mx.Unlock()
+	validations := b.buildValidations()
+	validations[build.ID] = v
+	return b.saveValidations(validations)
+}
+
+// mergeValidations copy validation of `src` builds into the branch re-keyed by `ids`
+func (b *BrBuilder) mergeValidations(src *BrBuilder, ids map[string]string) error {
+	moved := src.buildValidations()
+	if len(moved) == 0 {
+		return nil
+	}
+	validations := b.buildValidations()
+	for id, v := range moved {
+		if nid, ok := ids[id]; ok {
+			validations[nid] = v
+		}
+	}
+	return b.saveValidations(validations)
+}
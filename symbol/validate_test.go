@@ -0,0 +1,25 @@
+package symbol
+
+import (
+	"testing"
+)
+
+func TestParseSymChk(t *testing.T) {
+	passed := "SYMCHK: FAILED files = 0\r\nSYMCHK: PASSED + IGNORED files = 1\r\n"
+	if reason, err := parseSymChk(passed); err != nil || reason != "" {
+		t.Errorf("expect passed, got %q (%v)", reason, err)
+	}
+
+	failed := "SYMCHK: foo.dll              FAILED  - foo.pdb mismatched or not found\r\n" +
+		"\r\nSYMCHK: FAILED files = 1\r\nSYMCHK: PASSED + IGNORED files = 0\r\n"
+	if reason, err := parseSymChk(failed); err != nil || reason != "foo.pdb mismatched or not found" {
+		t.Errorf("expect mismatched, got %q (%v)", reason, err)
+	}
+
+	if _, err := parseSymChk("'symchk.exe' is not recognized as a command"); err == nil {
+		t.Errorf("expect unknown output failed")
+	}
+	if name := pdbName(`D:\out\x64\Foo.pdb`); name != "foo.pdb" {
+		t.Errorf("unexpected pdb name %s", name)
+	}
+}
@@ -0,0 +1,50 @@
+package symbol
+
+import (
+	"fmt"
+	"regexp"
+	"strings"
+)
+
+var (
+	ErrVirtualDir = fmt.Errorf("invalid or duplicate virtual directory")
+
+	// one path segment, the root of the branch as an standalone symstore share
+	virtualDirRegex = regexp.MustCompile(`^[A-Za-z0-9][A-Za-z0-9._-]*$`)
+
+	// top level paths of the site itself
+	reservedDirs = map[string]bool{"api": true, "static": true, "p": true, "readyz": true, "symbols": true}
+)
+
+// checkVirtualDir normalize virtual directory of `branch` and check it's not taken by
+// another branch, caller hold `ss.lck`.
+func (ss *sserver) checkVirtualDir(branch *Branch) error {
+	branch.VirtualDir = strings.Trim(branch.VirtualDir, "/")
+	dir := branch.VirtualDir
+	if dir == "" {
+		return nil
+	}
+	if !virtualDirRegex.MatchString(dir) || reservedDirs[strings.ToLower(dir)] {
+		return ErrVirtualDir
+	}
+	for name, b := range ss.builders {
+		if name != strings.ToLower(branch.StoreName) && strings.EqualFold(b.GetBranch().VirtualDir, dir) {
+			return ErrVirtualDir
+		}
+	}
+	return nil
+}
+
+// ByVirtualDir return the branch exposed at URL root `/{dir}/`, nil if none.
+//
+func (ss *sserver) ByVirtualDir(dir string) Builder {
+	ss.lck.RLock()
+	defer ss.lck.RUnlock()
+
+	for _, b := range ss.builders {
+		if vd := b.GetBranch().VirtualDir; vd != "" && strings.EqualFold(vd, dir) {
+			return b
+		}
+	}
+	return nil
+}
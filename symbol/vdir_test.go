@@ -0,0 +1,32 @@
+package symbol
+
+import "testing"
+
+func TestVirtualDir(t *testing.T) {
+	ss := &sserver{builders: map[string]Builder{
+		"udp": NewBranch2(&Branch{StoreName: "UDP", VirtualDir: "UDPMAIN"}),
+		"ucp": NewBranch2(&Branch{StoreName: "UCP"}),
+	}}
+	for dir, ok := range map[string]bool{
+		"":          true,
+		"/UCPMAIN/": true,
+		"udpmain":   false, // taken by UDP
+		"api":       false,
+		"a/b":       false,
+		"..":        false,
+	} {
+		b := &Branch{StoreName: "UCP", VirtualDir: dir}
+		if err := ss.checkVirtualDir(b); (err == nil) != ok {
+			t.Errorf("virtual directory %q: expect valid %v, got %v", dir, ok, err)
+		}
+	}
+	if err := ss.checkVirtualDir(&Branch{StoreName: "udp", VirtualDir: "UdpMain"}); err != nil {
+		t.Errorf("branch should keep its own virtual directory, got %v", err)
+	}
+	if b := ss.ByVirtualDir("udpmain"); b == nil || b.Name() != "UDP" {
+		t.Errorf("expect UDP at /udpmain/, got %v", b)
+	}
+	if b := ss.ByVirtualDir("UCP"); b != nil {
+		t.Errorf("expect no branch at /UCP/, got %s", b.Name())
+	}
+}
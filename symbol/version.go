@@ -0,0 +1,146 @@
+package symbol
+
+import (
+	"context"
+	"fmt"
+	"regexp"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+	"unicode"
+)
+
+var (
+	ErrVersionFormat = fmt.Errorf("version format must be an regexp with numeric capture groups")
+)
+
+var (
+	versionMx  sync.Mutex
+	versionRes = make(map[string]*regexp.Regexp) // compiled `Branch.VersionFormat`
+)
+
+// versionRegexp return the compiled version format, nil if invalid
+func versionRegexp(format string) *regexp.Regexp {
+	versionMx.Lock()
+	defer versionMx.Unlock()
+	if re, ok := versionRes[format]; ok {
+		return re
+	}
+	re, err := regexp.Compile(format)
+	if err != nil || re.NumSubexp() == 0 {
+		re = nil
+	}
+	versionRes[format] = re
+	return re
+}
+
+// CheckVersionFormat validate an `Branch.VersionFormat`, empty is valid.
+//
+func CheckVersionFormat(format string) error {
+	if format != "" && versionRegexp(format) == nil {
+		return ErrVersionFormat
+	}
+	return nil
+}
+
+// ParseVersion split `version` into numbers by capture groups of `format`, eg: `4175.2-538`
+// with `^(\d+)\.(\d+)-(\d+)$` give [4175 2 538]. Empty format take all digit runs in order.
+// Return false if the version doesn't match the format.
+//
+func ParseVersion(format, version string) ([]uint64, bool) {
+	var parts []string
+	if format == "" {
+		parts = strings.FieldsFunc(version, func(r rune) bool { return !unicode.IsDigit(r) })
+	} else if re := versionRegexp(format); re != nil {
+		m := re.FindStringSubmatch(version)
+		if m == nil {
+			return nil, false
+		}
+		parts = m[1:]
+	}
+	if len(parts) == 0 {
+		return nil, false
+	}
+	nums := make([]uint64, len(parts))
+	for i, s := range parts {
+		n, err := strconv.ParseUint(s, 10, 64)
+		if err != nil && s != "" {
+			return nil, false
+		}
+		nums[i] = n
+	}
+	return nums, true
+}
+
+// CompareVersions compare versions `a` and `b` parsed by `format` number by number,
+// `4175.2` is less than `4175.2-1`. Versions not matching the format are older than
+// matching ones and compared as strings.
+//
+func CompareVersions(format, a, b string) int {
+	x, okx := ParseVersion(format, a)
+	y, oky := ParseVersion(format, b)
+	switch {
+	case !okx && !oky:
+		return strings.Compare(a, b)
+	case !okx:
+		return -1
+	case !oky:
+		return 1
+	}
+	for i := 0; i < len(x) && i < len(y); i++ {
+		switch {
+		case x[i] < y[i]:
+			return -1
+		case x[i] > y[i]:
+			return 1
+		}
+	}
+	switch {
+	case len(x) < len(y):
+		return -1
+	case len(x) > len(y):
+		return 1
+	}
+	return 0
+}
+
+// CompareVersion compare build versions by the version format of the branch.
+//
+func (b *Branch) CompareVersion(x, y string) int {
+	return CompareVersions(b.VersionFormat, x, y)
+}
+
+// SortBuilds sort `builds` oldest first by version, then by transaction ID.
+//
+func (b *Branch) SortBuilds(builds []*Build) {
+	sort.SliceStable(builds, func(i, j int) bool {
+		if c := b.CompareVersion(builds[i].Version, builds[j].Version); c != 0 {
+			return c < 0
+		}
+		return builds[i].ID < builds[j].ID
+	})
+}
+
+// LastBuilds return the newest `n` builds by version, newest first. Supplementary
+// transactions go with their parent build and are not counted.
+//
+func (b *BrBuilder) LastBuilds(n int) ([]*Build, error) {
+	var builds []*Build
+	if _, err := b.ParseBuilds(context.Background(), func(build *Build) error {
+		if build.SupplementOf == "" {
+			builds = append(builds, build)
+		}
+		return nil
+	}); err != nil {
+		return nil, err
+	}
+	b.SortBuilds(builds)
+	for i, j := 0, len(builds)-1; i < j; i, j = i+1, j-1 {
+		builds[i], builds[j] = builds[j], builds[i]
+	}
+	if n >= 0 && len(builds) > n {
+		builds = builds[:n]
+	}
+	return builds, nil
+}
@@ -0,0 +1,64 @@
+package symbol
+
+import (
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+func TestCompareVersions(t *testing.T) {
+	cases := []struct {
+		format, a, b string
+		expect       int
+	}{
+		{"", "999", "4175", -1},
+		{"", "4175.2-538", "4175.10-1", -1},
+		{"", "4175.2", "4175.2-1", -1},
+		{"", "4175.2-538", "4175.2-538", 0},
+		{"", "beta", "1.0", -1},
+		{`^v(\d+)\.(\d+)_r(\d+)$`, "v2.0_r10", "v2.0_r9", 1},
+		{`^v(\d+)\.(\d+)_r(\d+)$`, "2.1", "v2.0_r9", -1},
+		{`^(\d+)(?:-(\d+))?$`, "100", "100-1", -1},
+	}
+	for _, c := range cases {
+		if got := CompareVersions(c.format, c.a, c.b); got != c.expect {
+			t.Errorf("compare %q %q by %q: expect %d, got %d", c.a, c.b, c.format, c.expect, got)
+		}
+	}
+	if err := CheckVersionFormat(`^\d+$`); err != ErrVersionFormat {
+		t.Errorf("expect format without capture group refused, got %v", err)
+	}
+	if err := CheckVersionFormat(`^(\d+`); err != ErrVersionFormat {
+		t.Errorf("expect invalid regexp refused, got %v", err)
+	}
+}
+
+func TestLastBuilds(t *testing.T) {
+	root, err := ioutil.TempDir("", "version")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(root)
+
+	// 999 backfilled after 4175, 4175.2 supplemented
+	admin := filepath.Join(root, adminDir)
+	os.MkdirAll(admin, 0755)
+	ioutil.WriteFile(filepath.Join(admin, serverTxt), []byte(
+		"0000000001,add,file,07/04/2017,14:44:14,\"UDP\",\"1000\",\"\",\r\n"+
+			"0000000002,add,file,07/05/2017,14:44:14,\"UDP\",\"4175.2\",\"\",\r\n"+
+			"0000000003,add,file,07/06/2017,14:44:14,\"UDP\",\"999\",\"\",\r\n"+
+			"0000000004,add,file,07/07/2017,14:44:14,\"UDP\",\"4175.2\",\"2017/7/7 "+supplementTag+"0000000002\",\r\n"), 0644)
+
+	b := NewBranch2(&Branch{StoreName: "UDP", StorePath: root, BuildPath: root}).(*BrBuilder)
+	builds, err := b.LastBuilds(2)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(builds) != 2 || builds[0].ID != "0000000002" || builds[1].ID != "0000000001" {
+		t.Errorf("unexpected last builds %+v", builds)
+	}
+	if b.LatestBuild != "4175.2" {
+		t.Errorf("expect latest build by version, got %s", b.LatestBuild)
+	}
+}
@@ -0,0 +1,152 @@
+package symbol
+
+import (
+	"context"
+	"sort"
+	"sync"
+	"time"
+
+	"github.com/adyzng/GoSymbols/config"
+	log "gopkg.in/clog.v1"
+)
+
+// Warm-up states, lookup of symbol files is served from disk in all states,
+// browse data of a branch is available once it is parsed.
+const (
+	WarmupStarting = "starting" // branch list not loaded yet
+	WarmupDegraded = "degraded" // parsing branch metadata
+	WarmupReady    = "ready"
+)
+
+// WarmupStatus is the progress of loading branch metadata at startup
+//
+type WarmupStatus struct {
+	State   string   `json:"state"`
+	Total   int      `json:"total"`
+	Done    int      `json:"done"`
+	Failed  []string `json:"failed,omitempty"`
+	Loading []string `json:"loading,omitempty"` // branches being parsed
+	Elapsed string   `json:"elapsed"`
+}
+
+// warmup track the warm-up progress
+type warmup struct {
+	mx      sync.Mutex
+	state   string
+	total   int
+	done    int
+	failed  []string
+	loading map[string]bool
+	start   time.Time
+}
+
+func newWarmup() *warmup {
+	return &warmup{state: WarmupStarting, loading: make(map[string]bool), start: time.Now()}
+}
+
+// WarmupStatus return a copy of current warm-up progress
+//
+func (ss *sserver) WarmupStatus() *WarmupStatus {
+	w := ss.warm
+	w.mx.Lock()
+	defer w.mx.Unlock()
+
+	st := &WarmupStatus{
+		State:   w.state,
+		Total:   w.total,
+		Done:    w.done,
+		Failed:  append([]string{}, w.failed...),
+		Elapsed: time.Since(w.start).String(),
+	}
+	for name := range w.loading {
+		st.Loading = append(st.Loading, name)
+	}
+	sort.Strings(st.Loading)
+	return st
+}
+
+// Ready check if metadata of all branches are loaded
+func (ss *sserver) Ready() bool {
+	ss.warm.mx.Lock()
+	defer ss.warm.mx.Unlock()
+	return ss.warm.state == WarmupReady
+}
+
+// warmUp parse builds of all branches with at most config.WarmupWorkers at a time,
+// larger branches are not blocking the others. Return early if `done` closed, the state
+// stays degraded then since some branches are not parsed.
+func (ss *sserver) warmUp(done <-chan struct{}) {
+	var arr []Builder
+	ss.WalkBuilders(func(bu Builder) error {
+		arr = append(arr, bu)
+		return nil
+	})
+
+	w := ss.warm
+	w.mx.Lock()
+	w.state = WarmupDegraded
+	w.total = len(arr)
+	w.mx.Unlock()
+	log.Info("[SS] Warm up %d branches with %d workers.", len(arr), config.WarmupWorkers)
+
+	var wg sync.WaitGroup
+	sem := make(chan struct{}, config.WarmupWorkers)
+	interrupted := false
+LOOP:
+	for _, bu := range arr {
+		select {
+		case <-done:
+			interrupted = true
+			break LOOP
+		default:
+		}
+		select {
+		case <-done:
+			interrupted = true
+			break LOOP
+		case sem <- struct{}{}:
+		}
+
+		name := bu.Name()
+		w.mx.Lock()
+		w.loading[name] = true
+		w.mx.Unlock()
+
+		wg.Add(1)
+		go func(bu Builder) {
+			defer func() {
+				<-sem
+				wg.Done()
+			}()
+			start := time.Now()
+			if br, ok := bu.(*BrBuilder); ok {
+				if _, err := br.PullBackend(); err != nil {
+					// parse the cached admin files anyway
+					log.Warn("[SS] Pull backend of branch %s failed: %v.", name, err)
+				}
+			}
+			n, err := bu.ParseBuilds(context.Background(), nil)
+
+			w.mx.Lock()
+			defer w.mx.Unlock()
+			delete(w.loading, name)
+			w.done++
+			if err != nil {
+				w.failed = append(w.failed, name)
+				log.Warn("[SS] Warm up branch %s failed: %v.", name, err)
+				return
+			}
+			log.Info("[SS] Warm up branch %s, %d builds in %s.", name, n, time.Since(start))
+		}(bu)
+	}
+	wg.Wait()
+
+	w.mx.Lock()
+	defer w.mx.Unlock()
+	if interrupted {
+		log.Warn("[SS] Warm up interrupted, %d of %d branches loaded.", w.done, w.total)
+		return
+	}
+	w.state = WarmupReady
+	log.Info("[SS] Warm up complete in %s.", time.Since(w.start))
+}
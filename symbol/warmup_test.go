@@ -0,0 +1,51 @@
+package symbol
+
+import (
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/adyzng/GoSymbols/config"
+)
+
+func TestWarmUp(t *testing.T) {
+	root, err := ioutil.TempDir("", "warmup")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(root)
+	defer func(n int) { config.WarmupWorkers = n }(config.WarmupWorkers)
+	config.WarmupWorkers = 1
+
+	ss := &sserver{builders: make(map[string]Builder), warm: newWarmup()}
+	for _, name := range []string{"good", "broken"} {
+		store := filepath.Join(root, name)
+		os.MkdirAll(filepath.Join(store, adminDir), 0755)
+		ss.builders[name] = NewBranch2(&Branch{StoreName: name, StorePath: store, BuildPath: store})
+	}
+	ioutil.WriteFile(filepath.Join(root, "good", adminDir, serverTxt), []byte(
+		"0000000001,add,file,07/04/2017,14:44:14,\"good\",\"100\",\"\",\r\n"), 0644)
+
+	if ss.Ready() || ss.WarmupStatus().State != WarmupStarting {
+		t.Fatal("expect not ready before warm up")
+	}
+	ss.warmUp(make(chan struct{}))
+
+	st := ss.WarmupStatus()
+	if !ss.Ready() || st.Total != 2 || st.Done != 2 || len(st.Failed) != 1 || st.Failed[0] != "broken" {
+		t.Fatalf("unexpected warm up status %+v", st)
+	}
+	if ss.builders["good"].GetBranch().BuildsCount != 1 {
+		t.Fatal("expect builds of good branch parsed")
+	}
+
+	// interrupted before all branches are parsed, not ready
+	ss.warm = newWarmup()
+	done := make(chan struct{})
+	close(done)
+	ss.warmUp(done)
+	if st := ss.WarmupStatus(); ss.Ready() || st.State != WarmupDegraded || st.Done != 0 {
+		t.Fatalf("expect degraded once interrupted, got %+v", st)
+	}
+}
@@ -5,6 +5,7 @@ import (
 	"fmt"
 	"io"
 	"os"
+	"path"
 	"path/filepath"
 	"strings"
 	"time"
@@ -15,6 +16,28 @@ import (
 // Unzip file `srcZip` to given folder `destFolder`
 //
 func Unzip(srcZip string, destFolder string) error {
+	return UnzipFilter(srcZip, destFolder, nil)
+}
+
+// SafeZipName check zip entry `name` stays inside the folder it's extracted to. Absolute
+// names, names with a volume and names leaving the folder, eg: `../../Windows/evil.dll`,
+// are not safe. Backslash is taken as separator, as it is on Windows.
+//
+func SafeZipName(name string) bool {
+	slashed := strings.Replace(name, "\\", "/", -1)
+	if slashed == "" || strings.HasPrefix(slashed, "/") || filepath.VolumeName(name) != "" ||
+		(len(slashed) >= 2 && slashed[1] == ':') {
+		return false
+	}
+	clean := path.Clean(slashed)
+	return clean != ".." && !strings.HasPrefix(clean, "../")
+}
+
+// UnzipFilter unzip only the files that `filter` return true,
+// `filter` receive the slash separated name in zip. nil filter extract all.
+// Nothing is extracted from a zip with any name not SafeZipName.
+//
+func UnzipFilter(srcZip string, destFolder string, filter func(name string) bool) error {
 	if _, err := os.Stat(srcZip); os.IsNotExist(err) {
 		return fmt.Errorf("input is not an zip file")
 	}
@@ -36,6 +59,12 @@ func Unzip(srcZip string, destFolder string) error {
 	}
 	defer rzip.Close()
 
+	for _, file := range rzip.File {
+		if !SafeZipName(file.Name) {
+			log.Error(2, "[Unzip] Unsafe file name %s in %s.", file.Name, srcZip)
+			return fmt.Errorf("unsafe file name %s in zip", file.Name)
+		}
+	}
 	for _, file := range rzip.File {
 		var (
 			err error
@@ -43,6 +72,9 @@ func Unzip(srcZip string, destFolder string) error {
 			fc  io.ReadCloser
 		)
 
+		if filter != nil && !file.FileInfo().IsDir() && !filter(file.Name) {
+			continue
+		}
 		fpath := filepath.Join(destFolder, file.Name)
 		//log.Trace("[Unzip] file : %s.", file.Name)
 		//fmt.Printf("[Unzip] file : %s\n", file.Name)
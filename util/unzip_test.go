@@ -1,6 +1,12 @@
 package util
 
-import "testing"
+import (
+	"archive/zip"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"testing"
+)
 
 func TestUnzip(t *testing.T) {
 	zip := "wpt.zip"
@@ -8,3 +14,47 @@ func TestUnzip(t *testing.T) {
 		t.Error(err)
 	}
 }
+
+func TestUnzipTraversal(t *testing.T) {
+	for name, safe := range map[string]bool{
+		"x64/foo.pdb":          true,
+		"x64/../foo.pdb":       true,
+		"../evil.dll":          false,
+		"x64/../../evil.dll":   false,
+		"..\\..\\evil.dll":     false,
+		"/etc/evil.dll":        false,
+		"\\\\server\\evil.dll": false,
+		"C:\\evil.dll":         false,
+		"c:evil.dll":           false,
+		"..":                   false,
+	} {
+		if SafeZipName(name) != safe {
+			t.Errorf("expect %s safe %v", name, safe)
+		}
+	}
+
+	root, err := ioutil.TempDir("", "unzip")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(root)
+	src := filepath.Join(root, "debug.zip")
+	fd, _ := os.Create(src)
+	zw := zip.NewWriter(fd)
+	for _, name := range []string{"x64/foo.pdb", "../evil.dll"} {
+		w, _ := zw.Create(name)
+		w.Write([]byte(name))
+	}
+	zw.Close()
+	fd.Close()
+
+	dest := filepath.Join(root, "dest")
+	if err = Unzip(src, dest); err == nil {
+		t.Fatal("expect zip with traversal entry refused")
+	}
+	for _, fpath := range []string{filepath.Join(root, "evil.dll"), filepath.Join(dest, "x64", "foo.pdb")} {
+		if _, err = os.Stat(fpath); !os.IsNotExist(err) {
+			t.Errorf("expect nothing extracted, got %s", fpath)
+		}
+	}
+}
@@ -10,7 +10,8 @@ module.exports = {
 		// This should be the URL path where your build.assetsRoot 
 		// will be served from over HTTP. In most cases, this will be root (/). 
 		// Only change this if your backend framework serves static assets with a path prefix.
-		assetsPublicPath: '/',
+		// Relative, so the same build is served at root or behind reverse proxy (`[web] BASE_URL`).
+		assetsPublicPath: './',
 		productionSourceMap: true,
 		// Gzip off by default as many popular static hosts such as
 		// Surge or Netlify already gzip all static assets for you.
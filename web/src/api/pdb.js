@@ -7,12 +7,12 @@ import axios from 'axios'
 import store from '../utils/store';
 
 const http = axios.create({
-	baseURL: '/api',	// base api
+	baseURL: (window.BASE_PATH || '') + '/api',	// base api, prefixed behind reverse proxy
 	timeout: 5000,		// request timeout
 	// `xsrfCookieName` is the name of the cookie to use as a value for xsrf token
-	//xsrfCookieName: 'XSRF-TOKEN', // default
+	xsrfCookieName: 'XSRF-TOKEN',	// csrf token of the session, required on mutating api
 	// `xsrfHeaderName` is the name of the http header that carries the xsrf token value
-	//xsrfHeaderName: 'X-XSRF-TOKEN', // default
+	xsrfHeaderName: 'X-XSRF-TOKEN',
 });
 
 // request interceptor
@@ -179,6 +179,42 @@ export default {
 			});
 	},
 
+	fetchServerBuilds(branch, missing, cb) {
+		if (!branch || !cb) {
+			return
+		}
+		return http.get(`/branches/${branch}/server-builds`, {params: {missing: !!missing}}).then(resp => {
+				let res = resp.data;
+				let data = [];
+				if (res.data) {
+					data = [...res.data];
+					data.reverse();		// newest first
+				} else {
+					console.log("fetchServerBuilds empty:", res)
+				}
+				cb(data);
+			})
+			.catch(err => {
+				console.log("fetchServerBuilds failed:", err);
+				cb([]);
+			});
+	},
+
+	triggerBuild(branch, version, cb) {
+		if (!branch) {
+			return
+		}
+		return http.post(`/branches/${branch}/trigger`, JSON.stringify({version: version})).then(resp => {
+			if (resp.data) {
+				cb && cb(resp.data);
+			}
+		})
+		.catch(err => {
+			console.log(`triggerBuild error ${err}.`);
+			cb && cb(err);
+		})
+	},
+
 	deleteBranch(branch, cb) {
 		if (!branch) {
 			return